@@ -1,52 +1,1069 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/Siruyy/gatify/internal/acl"
+	"github.com/Siruyy/gatify/internal/analytics"
+	"github.com/Siruyy/gatify/internal/api"
+	"github.com/Siruyy/gatify/internal/ban"
+	"github.com/Siruyy/gatify/internal/canary"
+	"github.com/Siruyy/gatify/internal/certs"
+	"github.com/Siruyy/gatify/internal/changes"
+	"github.com/Siruyy/gatify/internal/config"
+	"github.com/Siruyy/gatify/internal/emergency"
+	"github.com/Siruyy/gatify/internal/geoip"
+	"github.com/Siruyy/gatify/internal/grpcapi"
+	"github.com/Siruyy/gatify/internal/jwtauth"
+	"github.com/Siruyy/gatify/internal/keyschema"
+	"github.com/Siruyy/gatify/internal/leader"
+	"github.com/Siruyy/gatify/internal/limiter"
+	"github.com/Siruyy/gatify/internal/logging"
+	"github.com/Siruyy/gatify/internal/policy"
+	"github.com/Siruyy/gatify/internal/proxy"
+	"github.com/Siruyy/gatify/internal/quota"
+	"github.com/Siruyy/gatify/internal/recovery"
+	"github.com/Siruyy/gatify/internal/report"
+	"github.com/Siruyy/gatify/internal/restart"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/rulestats"
+	"github.com/Siruyy/gatify/internal/shed"
+	"github.com/Siruyy/gatify/internal/slo"
+	"github.com/Siruyy/gatify/internal/standby"
+	"github.com/Siruyy/gatify/internal/storage"
+	"github.com/Siruyy/gatify/internal/stream"
+	"github.com/Siruyy/gatify/internal/tracing"
+	"github.com/Siruyy/gatify/internal/upstream"
+	"github.com/Siruyy/gatify/internal/users"
 )
 
 func main() {
+	if err := config.ParseFlags(os.Args[1:], os.Stderr); err != nil {
+		// The problem and usage have been printed already.
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
 	fmt.Println("🛡️  Gatify - Starting...")
 
-	// TODO: Initialize components
-	// - Redis connection
-	// - TimescaleDB connection
-	// - Rate limiter
-	// - Reverse proxy
-	// - Management API
+	cfg, err := config.Load()
+	if err != nil {
+		log.Printf("❌ Invalid configuration, %d problem(s):", len(config.Problems(err)))
+		config.WriteProblems(os.Stderr, err)
+		os.Exit(1)
+	}
+	logFilter := logging.NewFilter(os.Stderr, cfg.LogLevel)
+	log.SetOutput(logFilter)
+	if cfg.ConfigFile != "" {
+		log.Printf("📄 Read configuration from %s", cfg.ConfigFile)
+	}
+
+	var store storage.Storage
+	// Dependencies besides the backends are pinged for /ready; losing
+	// Redis takes the instance out of rotation.
+	var dependencies []upstream.Dependency
+	switch cfg.StorageBackend {
+	case config.StorageMemory:
+		store = storage.NewMemoryStorage()
+		log.Printf("⚠️  Using in-memory storage: limits are per instance and reset on restart")
+	default:
+		redisStore := storage.NewRedisStorage(storage.RedisOptions{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+		})
+		store = redisStore
+		dependencies = append(dependencies, upstream.Dependency{Name: "redis", Ping: store.Ping, Critical: true})
+		pingCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := store.Ping(pingCtx); err != nil {
+			log.Printf("⚠️  Redis unreachable at %s, requests will not be limited: %v", cfg.RedisAddr, err)
+		}
+		cancel()
+		// Counters kept under an older key layout are carried over in the
+		// background; they count from zero until moved.
+		go migrateKeys(redisStore)
+	}
+	defer store.Close()
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	emergencySwitch := emergency.NewSwitch(store, emergency.DefaultRefreshInterval)
+	go emergencySwitch.Run(ctx)
+
+	// Cluster-wide background jobs run on the elected leader only. They
+	// must be scheduled before the job runner starts below.
+	elector := leader.NewElector(store, leader.DefaultLeaseTTL)
+	go elector.Run(ctx)
+
+	var tracer *tracing.Tracer
+	if cfg.OTLPEndpoint != "" {
+		exporter := tracing.NewExporter(cfg.OTLPEndpoint, cfg.OTelServiceName, cfg.OTLPHeaders)
+		go exporter.Run(ctx, tracing.DefaultExportInterval)
+		tracer = tracing.NewTracer(exporter, cfg.TraceSampleRatio)
+		log.Printf("🔭 Exporting traces to %s", cfg.OTLPEndpoint)
+	}
+
+	// Live subscribers see every request; analytics, when enabled, gets
+	// the same events for storage.
+	broker := stream.NewBroker()
+	sinks := []proxy.EventSink{proxy.EventSinkFunc(func(e proxy.Event) {
+		broker.Publish(stream.Event{
+			Time:        e.Timestamp,
+			Seq:         e.Seq,
+			ClientID:    e.ClientID,
+			Method:      e.Method,
+			Path:        e.Path,
+			RuleID:      e.RuleID,
+			Allowed:     e.Allowed,
+			Status:      e.Status,
+			Bytes:       e.Bytes,
+			ResponseMS:  e.Duration.Milliseconds(),
+			BackendMS:   e.BackendLatency.Milliseconds(),
+			BlockReason: e.BlockReason,
+		})
+	})}
+	// Per-rule counters shown in the rules API are shared through storage.
+	ruleStats := rulestats.NewRecorder(store)
+	go ruleStats.Run(ctx, rulestats.DefaultFlushInterval)
+	sinks = append(sinks, proxy.EventSinkFunc(func(e proxy.Event) {
+		if e.RuleID != "" {
+			ruleStats.Record(e.RuleID, e.Allowed, e.Timestamp)
+		}
+	}))
+	// Rule changes go to the configured webhooks and to live subscribers.
+	notifier := changes.NewNotifier(cfg.RuleWebhookURLs, cfg.RuleWebhookSecret)
+	go notifier.Run(ctx)
+	notifier.Subscribe(func(c changes.RuleChange) {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return
+		}
+		broker.Publish(stream.Event{Time: c.Time, RuleID: c.RuleID, Type: stream.TypeRuleChange, Change: data})
+	})
+	if len(cfg.RuleWebhookURLs) > 0 {
+		log.Printf("🪝 Sending rule changes to %d webhook(s)", len(cfg.RuleWebhookURLs))
+	}
+	// A panicking request is answered with 500 rather than crashing the
+	// gateway, and reported to the webhooks.
+	panics := recovery.ReporterFunc(func(_ context.Context, p recovery.Panic) {
+		notifier.Send("gateway.panic", p)
+	})
+
+	bans := ban.New(store)
+	autoBan := ban.Policy{Strikes: int64(cfg.AutoBanStrikes), Window: cfg.AutoBanWindow, Duration: cfg.AutoBanDuration}
+	if autoBan.Enabled() {
+		log.Printf("🚫 Banning clients rate limited %d times within %s for %s", autoBan.Strikes, autoBan.Window, autoBan.Duration)
+	}
+	apiOpts := []api.Option{api.WithStream(broker), api.WithRuleStats(ruleStats), api.WithChangeNotifier(notifier), api.WithBans(bans),
+		api.WithLimiterAlgorithm(cfg.LimiterAlgorithm)}
+	grpcOpts := []grpcapi.Option{grpcapi.WithChangeNotifier(notifier), grpcapi.WithEvents(broker), grpcapi.WithLimiterAlgorithm(cfg.LimiterAlgorithm)}
+
+	// Quota usage and API tokens are persisted to the analytics database
+	// when there is one, so they survive a restart.
+	var quotaStore quota.Store
+	var tokenStore users.Store
+	var eventLogger *analytics.Logger
+	var sloStore slo.Store
+	if writeDB, readDB := openAnalytics(ctx, cfg); writeDB != nil {
+		defer writeDB.Close()
+		if readDB != writeDB {
+			defer readDB.Close()
+		}
+
+		dependencies = append(dependencies, upstream.Dependency{Name: "postgres", Ping: writeDB.PingContext})
+
+		eventLogger = analytics.NewLogger(writeDB, cfg.AnalyticsBatchSize, cfg.AnalyticsFlushInterval)
+		eventLogger.SetMaxClockSkew(cfg.AnalyticsMaxClockSkew)
+		eventLogger.SetTracer(tracer)
+		if cfg.AnalyticsAdaptiveFlush {
+			eventLogger.EnableAdaptiveFlush()
+		}
+		if cfg.AnalyticsSpillDir != "" {
+			if err := eventLogger.EnableSpill(cfg.AnalyticsSpillDir, int64(cfg.AnalyticsSpillMaxMB)<<20); err != nil {
+				log.Printf("⚠️  Analytics spill disabled: %v", err)
+			}
+		}
+		go eventLogger.Run(ctx)
+		sinks = append(sinks, proxy.EventSinkFunc(func(e proxy.Event) {
+			eventLogger.Log(analytics.Event{
+				Time:          e.Timestamp,
+				ClientID:      e.ClientID,
+				Method:        e.Method,
+				Path:          e.Path,
+				Route:         e.Route,
+				Agent:         e.Agent,
+				RuleID:        e.RuleID,
+				Allowed:       e.Allowed,
+				StatusCode:    e.Status,
+				ResponseMS:    e.Duration.Milliseconds(),
+				BackendMS:     e.BackendLatency.Milliseconds(),
+				Bytes:         e.Bytes,
+				ShadowAllowed: e.ShadowAllowed,
+				BlockReason:   e.BlockReason,
+				IdentityError: e.IdentityError,
+				Dimensions:    e.Dimensions,
+			})
+		}))
+
+		// Bans are set on the request path, which must not wait on the
+		// database.
+		banEvents := analytics.NewBanEvents(writeDB)
+		bans.SetObserver(func(e ban.Event) {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				err := banEvents.Record(ctx, analytics.BanEvent{
+					Time:            e.Time,
+					Action:          e.Action,
+					Client:          e.Client,
+					Reason:          e.Reason,
+					DurationSeconds: int64(e.Duration / time.Second),
+				})
+				if err != nil {
+					log.Printf("⚠️  Failed to record ban event: %v", err)
+				}
+			}()
+		})
+
+		usageStore := quota.NewPostgresStore(writeDB)
+		if err := usageStore.Migrate(ctx); err != nil {
+			log.Printf("⚠️  Quota usage will not be persisted: %v", err)
+		} else {
+			quotaStore = usageStore
+		}
+		userStore := users.NewPostgresStore(writeDB)
+		if err := userStore.Migrate(ctx); err != nil {
+			log.Printf("⚠️  API tokens will not be persisted: %v", err)
+		} else {
+			tokenStore = userStore
+		}
+
+		rollup := analytics.NewRollup(writeDB)
+		elector.Schedule("usage-rollup", cfg.UsageRollupInterval, rollup.Refresh)
+		elector.Schedule("traffic-rollup", cfg.TrafficRollupInterval, analytics.NewTrafficRollup(writeDB).Refresh)
+		sloStore = analytics.NewSLOBudgets(writeDB)
+		retention := analytics.NewRetention(writeDB, cfg.AnalyticsRetention)
+		if cfg.AnalyticsRetention > 0 {
+			elector.Schedule("analytics-retention", cfg.AnalyticsRetentionInterval, retention.Purge)
+			log.Printf("🧹 Keeping analytics for %s", cfg.AnalyticsRetention)
+		}
+
+		queries := analytics.NewQueryService(readDB)
+		apiOpts = append(apiOpts, api.WithStats(queries), api.WithBilling(queries), api.WithReports(queries), api.WithSuggestions(queries),
+			api.WithErasures(analytics.NewErasures(writeDB)), api.WithPurge(retention))
+		grpcOpts = append(grpcOpts, grpcapi.WithStats(queries))
+
+		var mailer report.Mailer
+		if cfg.SMTPAddr != "" {
+			mailer = report.NewSMTPMailer(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
+		}
+		reportScheduler := report.NewScheduler(report.NewScheduleStore(store), queries, mailer)
+		// Ticking twice a minute makes sure no scheduled minute is missed;
+		// each schedule runs at most once per minute.
+		elector.Schedule("report-delivery", 30*time.Second, reportScheduler.Tick)
+		apiOpts = append(apiOpts, api.WithReportSchedules(reportScheduler))
+	}
+
+	// Latency objectives count forwarded requests only: rejections are
+	// answered by the gateway itself and say nothing about the backend.
+	if len(cfg.SLOs) > 0 {
+		tracker := slo.New(cfg.SLOs, slo.Options{
+			Window: cfg.SLOWindow,
+			Store:  sloStore,
+			Alert:  func(a slo.Alert) { notifier.Send("slo."+a.Event, a) },
+		})
+		go tracker.Run(ctx, cfg.SLOEvaluationInterval)
+		if sloStore != nil {
+			elector.Schedule("slo-evaluation", cfg.SLOEvaluationInterval, tracker.Evaluate)
+		}
+		sinks = append(sinks, proxy.EventSinkFunc(func(e proxy.Event) {
+			if e.Allowed {
+				tracker.Record(e.Path, e.Duration, e.Timestamp)
+			}
+		}))
+		apiOpts = append(apiOpts, api.WithSLOs(tracker))
+		log.Printf("🎯 Tracking %d latency SLO(s) over %s", len(cfg.SLOs), cfg.SLOWindow)
+	}
+
+	backendURL, err := url.Parse(cfg.BackendURL)
+	if err != nil {
+		log.Fatalf("Invalid backend URL: %v", err)
+	}
+
+	rateLimiter, err := limiter.New(cfg.LimiterAlgorithm, store)
+	if err != nil {
+		log.Fatalf("Invalid LIMITER_ALGORITHM: %v", err)
+	}
+	if cfg.ShadowAlgorithm != "" {
+		candidate, err := limiter.New(cfg.ShadowAlgorithm, store)
+		if err != nil {
+			log.Fatalf("Invalid SHADOW_ALGORITHM: %v", err)
+		}
+		rateLimiter = limiter.NewShadow(rateLimiter, candidate)
+		log.Printf("🌗 Dark-launching %s alongside %s", cfg.ShadowAlgorithm, cfg.LimiterAlgorithm)
+	}
+
+	// Rules may pick any other algorithm for their own traffic.
+	ruleLimiters := make(map[string]limiter.Limiter)
+	for _, name := range limiter.Algorithms() {
+		if name == cfg.LimiterAlgorithm {
+			continue
+		}
+		l, err := limiter.New(name, store)
+		if err != nil {
+			log.Fatalf("Failed to create the %s limiter: %v", name, err)
+		}
+		ruleLimiters[name] = l
+	}
+	if cfg.LocalLimitFraction > 0 {
+		rateLimiter = limiter.NewLocal(rateLimiter, cfg.LocalLimitFraction)
+		for name, l := range ruleLimiters {
+			ruleLimiters[name] = limiter.NewLocal(l, cfg.LocalLimitFraction)
+		}
+		log.Printf("🏠 Local limiting tier at %.0f%% of each limit", cfg.LocalLimitFraction*100)
+	}
+
+	// Upstreams are probed with the BACKEND_HEALTH_* settings unless
+	// their UPSTREAMS entry overrides them.
+	check := upstream.HealthCheck{
+		Path:           cfg.BackendHealthPath,
+		Interval:       cfg.BackendHealthInterval,
+		Timeout:        cfg.BackendHealthTimeout,
+		ExpectedStatus: cfg.BackendHealthStatus,
+	}
+	targets := []upstream.Target{{Name: upstream.DefaultTarget, URL: backendURL, Check: check}}
+	upstreams := make(map[string]*url.URL, len(cfg.Upstreams))
+	for _, up := range cfg.Upstreams {
+		u, err := url.Parse(up.URL)
+		if err != nil {
+			log.Fatalf("Invalid upstream %s: %v", up.Name, err)
+		}
+		upstreams[up.Name] = u
+		targets = append(targets, upstream.Target{Name: up.Name, URL: u, Check: upstreamCheck(check, up)})
+	}
+	var resolver *upstream.Resolver
+	if cfg.BackendDNSRefresh > 0 {
+		resolver = upstream.NewResolver()
+	}
+	transport, err := upstream.TransportConfig{
+		ClientCertFile:        cfg.BackendTLSCertFile,
+		ClientKeyFile:         cfg.BackendTLSKeyFile,
+		CAFile:                cfg.BackendTLSCAFile,
+		MaxIdleConns:          cfg.BackendMaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.BackendMaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.BackendMaxConnsPerHost,
+		DialTimeout:           cfg.BackendDialTimeout,
+		TLSHandshakeTimeout:   cfg.BackendTLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.BackendResponseHeaderTimeout,
+		IdleConnTimeout:       cfg.BackendIdleConnTimeout,
+		KeepAlive:             cfg.BackendKeepAlive,
+		DisableKeepAlives:     cfg.BackendDisableKeepAlives,
+		Resolver:              resolver,
+	}.HTTPTransport()
+	if err != nil {
+		log.Fatalf("Failed to configure the backend transport: %v", err)
+	}
+	if cfg.BackendTLSCertFile != "" {
+		log.Printf("🔐 Presenting client certificate %s to backends", cfg.BackendTLSCertFile)
+	}
+	health := upstream.NewChecker(targets, publishHealth(broker))
+	health.SetTransport(transport)
+	go health.Run(ctx)
+	deps := upstream.NewDependencies(upstream.HealthCheck{}, dependencies...)
+	go deps.Run(ctx)
+	var breaker *upstream.Breaker
+	if cfg.BreakerEnabled {
+		breaker = upstream.NewBreaker(upstream.BreakerConfig{
+			FailureRatio: float64(cfg.BreakerFailurePercent) / 100,
+			MinRequests:  cfg.BreakerMinRequests,
+			Window:       cfg.BreakerWindow,
+			OpenDuration: cfg.BreakerOpenDuration,
+		})
+	}
+
+	quotas := quota.NewTracker(store, quotaStore)
+	go quotas.Run(ctx, quota.DefaultFlushInterval)
+
+	// Load shedding is per instance: each counts its own requests in
+	// flight to the backends.
+	var shedder *shed.Shedder
+	if cfg.ShedThreshold > 0 {
+		shedder = shed.New(int64(cfg.ShedThreshold), int64(cfg.ShedMaxInFlight))
+		apiOpts = append(apiOpts, api.WithShedding(shedder))
+		log.Printf("🪫 Shedding low-priority requests from %d in flight", cfg.ShedThreshold)
+	}
+
+	var debugRing *proxy.DebugRing
+	if cfg.DebugRingSize > 0 {
+		debugRing = proxy.NewDebugRing(cfg.DebugRingSize)
+		apiOpts = append(apiOpts, api.WithDebugRing(debugRing))
+	}
+
+	// ADMIN_API_TOKEN bootstraps the management API; further tokens are
+	// issued through it, and persist only with a database.
+	persistentTokens := tokenStore != nil
+	if !persistentTokens {
+		tokenStore = users.NewInMemoryStore()
+	}
+	var authenticator *users.Authenticator
+	if cfg.AdminAPIToken != "" || persistentTokens {
+		authenticator = users.NewAuthenticator(tokenStore, cfg.AdminAPIToken)
+	}
+
+	gateway := proxy.New(proxy.Options{
+		Backend:            backendURL,
+		Upstreams:          upstreams,
+		Transport:          transport,
+		Limiter:            rateLimiter,
+		Limiters:           ruleLimiters,
+		DefaultLimit:       cfg.RateLimitRequests,
+		DefaultWindow:      cfg.RateLimitWindow,
+		TrustProxy:         cfg.TrustProxy,
+		TrustedProxies:     cfg.TrustedProxies,
+		DebugHeaders:       cfg.DevMode,
+		DebugToken:         cfg.DebugToken,
+		Emergency:          emergencySwitch,
+		Health:             health,
+		Breaker:            breaker,
+		Shedder:            shedder,
+		Bans:               bans,
+		AutoBan:            autoBan,
+		DebugRing:          debugRing,
+		Events:             proxy.MultiSink(sinks...),
+		NonceStore:         store,
+		ConcurrencyStore:   store,
+		WaitForRules:       true,
+		MaxRequestHeaders:  cfg.MaxRequestHeaders,
+		Quotas:             quotas,
+		Tracer:             tracer,
+		HonorBackendLimits: cfg.HonorBackendLimits,
+		MaxBackendBackoff:  cfg.MaxBackendBackoff,
+		AuthorizeDryRun:    authorizeDryRun(authenticator),
+		JWT:                newJWTVerifier(ctx, cfg),
+	})
+	if resolver != nil {
+		resolver.OnStale(gateway.CloseIdleConnections)
+		resolver.OnStale(health.CloseIdleConnections)
+		go resolver.Run(ctx, cfg.BackendDNSRefresh)
+	}
+
+	if cfg.GeoIPDBPath != "" {
+		watcher := geoip.NewWatcher(cfg.GeoIPDBPath, cfg.GeoIPPollInterval, func(db *geoip.DB) {
+			gateway.SetCountries(db)
+		})
+		if err := watcher.Load(); err != nil {
+			log.Fatalf("Invalid GEOIP_DB_PATH: %v", err)
+		}
+		log.Printf("🌍 Loaded GeoIP database from %s", cfg.GeoIPDBPath)
+		go watcher.Run(ctx)
+	}
+
+	// The gateway enforces the rules managed through the API together
+	// with those declared in RULES_FILE.
+	ruleRepo := rules.NewInMemoryRepository()
+	saveRules := func() {}
+	if cfg.RulesSnapshotFile != "" {
+		err := ruleRepo.LoadSnapshot(cfg.RulesSnapshotFile)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			log.Printf("💾 No rules snapshot at %s yet, starting empty", cfg.RulesSnapshotFile)
+		case err != nil:
+			log.Fatalf("Invalid RULES_SNAPSHOT_FILE: %v", err)
+		default:
+			list, _ := ruleRepo.List(ctx)
+			log.Printf("💾 Restored %d rules from %s", len(list), cfg.RulesSnapshotFile)
+		}
+		go ruleRepo.RunSnapshots(ctx, cfg.RulesSnapshotFile, cfg.RulesSnapshotInterval)
+		saveRules = func() {
+			if err := ruleRepo.SaveSnapshot(cfg.RulesSnapshotFile); err != nil {
+				log.Printf("⚠️  Failed to save rules snapshot: %v", err)
+			}
+		}
+	}
+	// The IP allowlist and denylist are managed through the API and kept
+	// the same way.
+	aclRepo := acl.NewInMemoryRepository()
+	saveACL := func() {}
+	if cfg.ACLSnapshotFile != "" {
+		err := aclRepo.LoadSnapshot(cfg.ACLSnapshotFile)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			log.Printf("💾 No ACL snapshot at %s yet, starting empty", cfg.ACLSnapshotFile)
+		case err != nil:
+			log.Fatalf("Invalid ACL_SNAPSHOT_FILE: %v", err)
+		default:
+			list, _ := aclRepo.List(ctx)
+			log.Printf("💾 Restored %d ACL entries from %s", len(list), cfg.ACLSnapshotFile)
+		}
+		go aclRepo.RunSnapshots(ctx, cfg.ACLSnapshotFile, cfg.RulesSnapshotInterval)
+		saveACL = func() {
+			if err := aclRepo.SaveSnapshot(cfg.ACLSnapshotFile); err != nil {
+				log.Printf("⚠️  Failed to save ACL snapshot: %v", err)
+			}
+		}
+	}
+	// Rule policies are kept the same way too.
+	policyRepo := policy.NewInMemoryRepository()
+	savePolicies := func() {}
+	if cfg.PoliciesSnapshotFile != "" {
+		err := policyRepo.LoadSnapshot(cfg.PoliciesSnapshotFile)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			log.Printf("💾 No policies snapshot at %s yet, starting empty", cfg.PoliciesSnapshotFile)
+		case err != nil:
+			log.Fatalf("Invalid POLICIES_SNAPSHOT_FILE: %v", err)
+		default:
+			list, _ := policyRepo.List(ctx)
+			log.Printf("💾 Restored %d policies from %s", len(list), cfg.PoliciesSnapshotFile)
+		}
+		go policyRepo.RunSnapshots(ctx, cfg.PoliciesSnapshotFile, cfg.RulesSnapshotInterval)
+		savePolicies = func() {
+			if err := policyRepo.SaveSnapshot(cfg.PoliciesSnapshotFile); err != nil {
+				log.Printf("⚠️  Failed to save policies snapshot: %v", err)
+			}
+		}
+	}
+	reloadACL := func(ctx context.Context) {
+		list, err := aclRepo.List(ctx)
+		if err != nil {
+			log.Printf("Failed to reload ACL: %v", err)
+			return
+		}
+		gateway.SetACL(list)
+	}
+	reloadACL(ctx)
+
+	var fileRules atomic.Pointer[[]rules.Rule]
+	loadRules := func(ctx context.Context) error {
+		list, err := ruleRepo.List(ctx)
+		if err != nil {
+			return err
+		}
+		if declared := fileRules.Load(); declared != nil {
+			list = append(list, *declared...)
+		}
+		policies, err := policyRepo.List(ctx)
+		if err != nil {
+			return err
+		}
+		list, disabled := policy.Resolve(list, policies)
+		for _, r := range disabled {
+			log.Printf("⚠️  Rule %s references missing policy %q and is disabled", r.ID, r.Policy)
+		}
+		// Rules stored before LIMITER_ALGORITHM changed may rely on
+		// settings it ignores.
+		for _, r := range list {
+			if err := r.CheckAlgorithm(cfg.LimiterAlgorithm); err != nil && r.Enabled {
+				log.Printf("⚠️  Rule %s: %v; its burst is ignored", r.ID, err)
+			}
+		}
+		notifier.AutoDisabled(disabled, func(r rules.Rule) string {
+			return fmt.Sprintf("policy %q does not exist", r.Policy)
+		})
+		gateway.SetRules(list)
+		return nil
+	}
+	reloadRules := func(ctx context.Context) {
+		if err := loadRules(ctx); err != nil {
+			log.Printf("Failed to reload rules: %v", err)
+		}
+	}
+
+	if cfg.RulesFile != "" {
+		watcher := rules.NewFileWatcher(cfg.RulesFile, cfg.RulesFilePollInterval, func(list []rules.Rule) {
+			fileRules.Store(&list)
+			reloadRules(ctx)
+		})
+		watcher.SetDefaultAlgorithm(cfg.LimiterAlgorithm)
+		if err := watcher.Load(); err != nil {
+			log.Fatalf("Invalid RULES_FILE: %v", err)
+		}
+		log.Printf("📄 Loaded %d rules from %s", len(*fileRules.Load()), cfg.RulesFile)
+		go watcher.Run(ctx)
+	}
+
+	go awaitRules(ctx, gateway, loadRules, cfg.RulesLoadTimeout, cfg.RulesLoadTimeoutPolicy)
+	go elector.RunJobs(ctx)
+
+	// A warm standby mirrors the primary's configuration and holds back
+	// traffic until it is promoted through the API.
+	var syncer *standby.Syncer
+	var traffic http.Handler = gateway
+	if cfg.StandbyPrimaryURL != "" {
+		syncer = standby.New(standby.Options{
+			Primary:    cfg.StandbyPrimaryURL,
+			Token:      cfg.StandbyToken,
+			Interval:   cfg.StandbySyncInterval,
+			Rules:      ruleRepo,
+			ACL:        aclRepo,
+			Policies:   policyRepo,
+			Bans:       bans,
+			Applied:    reloadRules,
+			ACLChanged: reloadACL,
+		})
+		go syncer.Run(ctx)
+		traffic = syncer.Gate(gateway)
+		apiOpts = append(apiOpts, api.WithStandby(syncer))
+		log.Printf("🧊 Standing by for %s, syncing every %s", cfg.StandbyPrimaryURL, cfg.StandbySyncInterval)
+	}
 
-	// Temporary HTTP server for testing
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", healthHandler)
-	mux.HandleFunc("/", rootHandler)
+	status := gatewayHealth{backends: health, breaker: breaker, deps: deps, rulesLoaded: gateway.Ready, standby: syncer.Standby}
+	apiOpts = append(apiOpts, api.WithHealth(status))
+	mux.Handle("/ready", readyHandler(status))
+	mux.Handle("/health/ready", readyHandler(status))
+	mux.Handle(proxy.PolicyPath, gateway.PolicyHandler())
+	mux.Handle("/", traffic)
+	if cfg.CanaryPath != "" {
+		monitor := newCanary(cfg, gateway, eventLogger)
+		go monitor.Run(ctx)
+		mux.Handle("GET /metrics", monitor.MetricsHandler())
+		log.Printf("🐤 Canary checking %s %s every %s", cfg.CanaryMethod, cfg.CanaryPath, cfg.CanaryInterval)
+	}
+
+	var grpcServer *http.Server
+	if authenticator != nil {
+		apiOpts = append(apiOpts,
+			api.WithUsers(authenticator),
+			api.WithRulesChanged(reloadRules),
+			api.WithACL(aclRepo, reloadACL),
+			api.WithPolicies(policyRepo, reloadRules),
+			api.WithEmergency(emergencySwitch),
+			api.WithCounterReset(resetCounters(store, quotas)),
+			api.WithRuleTester(gateway),
+			api.WithBudgets(gateway),
+		)
+		mux.Handle("/api/", api.NewHandler(ruleRepo, cfg.AdminAPIToken, apiOpts...))
+
+		if cfg.GRPCListenAddr != "" {
+			grpcOpts = append(grpcOpts, grpcapi.WithRulesChanged(reloadRules), grpcapi.WithPolicies(policyRepo))
+			grpcServer = serveGRPC(cfg, recovery.Handler(grpcapi.NewServer(ruleRepo, authenticator, grpcOpts...), panics))
+		}
+	} else {
+		log.Println("⚠️  ADMIN_API_TOKEN not set and no database for API tokens, management API disabled")
+		if syncer != nil {
+			log.Println("⚠️  Without the management API this standby can only be promoted by restarting it without STANDBY_PRIMARY_URL")
+		}
+	}
 
 	server := &http.Server{
-		Addr:         ":3000",
-		Handler:      mux,
+		Addr:         cfg.ListenAddr,
+		Handler:      recovery.Handler(mux, panics),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
+		// Native gRPC clients without TLS speak HTTP/2 with prior
+		// knowledge.
+		Protocols: new(http.Protocols),
 	}
+	server.Protocols.SetHTTP1(true)
+	server.Protocols.SetHTTP2(true)
+	server.Protocols.SetUnencryptedHTTP2(true)
+	var certFiles *certs.FileLoader
+	server.TLSConfig, certFiles = gatewayTLS(ctx, cfg)
 
-	// Start server in goroutine
+	// The listener is inherited when this process was started by a
+	// handover from a previous gatify binary.
+	ln, inherited, err := restart.Listen(cfg.ListenAddr, cfg.ListenReusePort)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", cfg.ListenAddr, err)
+	}
 	go func() {
-		log.Printf("✅ Gatify listening on %s", server.Addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		serve := server.Serve
+		if server.TLSConfig != nil {
+			serve = func(ln net.Listener) error { return server.ServeTLS(ln, "", "") }
+		}
+		if err := serve(ln); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server error: %v", err)
 		}
 	}()
+	if inherited {
+		log.Printf("♻️  Took over listener on %s from the previous process", ln.Addr())
+	}
+	scheme := "http"
+	if server.TLSConfig != nil {
+		scheme = "https"
+	}
+	log.Printf("✅ Gatify listening on %s (%s), proxying to %s", ln.Addr(), scheme, cfg.BackendURL)
+	if err := restart.Ready(); err != nil {
+		log.Printf("Failed to notify the previous process: %v", err)
+	}
 
-	// Wait for interrupt signal
+	// SIGINT and SIGTERM stop the gateway; UpgradeSignal (SIGUSR2 where
+	// supported) first starts the new binary on the same socket, and
+	// SIGHUP reloads the configuration in place.
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	if restart.UpgradeSignal != nil {
+		signal.Notify(quit, restart.UpgradeSignal)
+	}
+	for sig := range quit {
+		if sig == syscall.SIGHUP {
+			cfg = reloadConfig(cfg, gateway, health, logFilter)
+			if certFiles != nil {
+				if err := certFiles.Reload(); err != nil {
+					log.Printf("⚠️  Keeping the previous TLS certificate: %v", err)
+				} else {
+					log.Printf("🔒 TLS certificate reloaded, valid until %s", certFiles.NotAfter().Format(time.RFC3339))
+				}
+			}
+			continue
+		}
+		if sig != restart.UpgradeSignal {
+			break
+		}
+		// The new process restores rules from the snapshot on startup.
+		saveRules()
+		saveACL()
+		savePolicies()
+		pid, err := restart.Handover(ln, cfg.ShutdownTimeout)
+		if err != nil {
+			log.Printf("⚠️  Upgrade aborted, still serving: %v", err)
+			continue
+		}
+		log.Printf("♻️  Handed over to process %d", pid)
+		break
+	}
 
 	log.Println("🛑 Shutting down Gatify...")
-	// TODO: Graceful shutdown
+	broker.Close()
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("⚠️  Shutdown timed out with requests in flight: %v", err)
+	}
+	if grpcServer != nil {
+		if err := grpcServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("⚠️  gRPC shutdown timed out with calls in flight: %v", err)
+		}
+	}
+	saveRules()
+	saveACL()
+	savePolicies()
+}
+
+// authorizeDryRun accepts admin tokens for X-Gatify-Dry-Run requests.
+// Without a management API there are none, and dry runs are disabled.
+func authorizeDryRun(a *users.Authenticator) func(context.Context, string) bool {
+	if a == nil {
+		return nil
+	}
+	return func(ctx context.Context, token string) bool {
+		p, err := a.Authenticate(ctx, token)
+		return err == nil && p.CanWrite()
+	}
+}
+
+// newJWTVerifier verifies bearer tokens for rules identifying clients by
+// JWT claim, or returns nil when neither JWT_SECRET nor JWT_JWKS_URL is
+// set. An unreachable JWKS endpoint is retried every JWT_JWKS_REFRESH;
+// until it answers, RS and ES tokens are counted by IP.
+func newJWTVerifier(ctx context.Context, cfg *config.Config) *jwtauth.Verifier {
+	if cfg.JWTSecret == "" && cfg.JWTJWKSURL == "" {
+		return nil
+	}
+	jwtCfg := jwtauth.Config{Issuer: cfg.JWTIssuer, Audience: cfg.JWTAudience}
+	if cfg.JWTSecret != "" {
+		jwtCfg.Secret = []byte(cfg.JWTSecret)
+	}
+	if cfg.JWTJWKSURL != "" {
+		keys := jwtauth.NewKeySet(cfg.JWTJWKSURL, &http.Client{Timeout: 10 * time.Second})
+		if err := keys.Refresh(ctx); err != nil {
+			log.Printf("⚠️  JWKS unavailable, retrying every %s: %v", cfg.JWTJWKSRefresh, err)
+		} else {
+			log.Printf("🔑 Loaded JWKS from %s", cfg.JWTJWKSURL)
+		}
+		go keys.Run(ctx, cfg.JWTJWKSRefresh)
+		jwtCfg.Keys = keys
+	}
+	return jwtauth.NewVerifier(jwtCfg)
+}
+
+// reloadConfig loads the configuration again and applies the settings
+// that can change without a restart. An invalid configuration is logged
+// and the running one kept.
+func reloadConfig(cfg *config.Config, gateway *proxy.GatewayProxy, health *upstream.Checker, logFilter *logging.Filter) *config.Config {
+	next, err := config.Load()
+	if err != nil {
+		log.Printf("⚠️  Reload rejected, keeping the running configuration:")
+		config.WriteProblems(log.Writer(), err)
+		return cfg
+	}
+	backend, err := url.Parse(next.BackendURL)
+	if err != nil {
+		log.Printf("⚠️  Reload rejected, invalid BACKEND_URL: %v", err)
+		return cfg
+	}
+
+	gateway.Reconfigure(proxy.Settings{
+		Backend:        backend,
+		DefaultLimit:   next.RateLimitRequests,
+		DefaultWindow:  next.RateLimitWindow,
+		TrustProxy:     next.TrustProxy,
+		TrustedProxies: next.TrustedProxies,
+	})
+	health.SetURL(upstream.DefaultTarget, backend)
+	logFilter.SetLevel(next.LogLevel)
+
+	// Everything else is wired into long-lived components at startup;
+	// keep reporting the values actually in use.
+	applied := *cfg
+	applied.BackendURL = next.BackendURL
+	applied.RateLimitRequests = next.RateLimitRequests
+	applied.RateLimitWindow = next.RateLimitWindow
+	applied.TrustProxy = next.TrustProxy
+	applied.TrustedProxies = next.TrustedProxies
+	applied.LogLevel = next.LogLevel
+	if next.ListenAddr != cfg.ListenAddr || next.StorageBackend != cfg.StorageBackend || next.DatabaseURL != cfg.DatabaseURL {
+		log.Printf("⚠️  LISTEN_ADDR, STORAGE_BACKEND and DATABASE_URL changes need a restart")
+	}
+	log.Printf("🔄 Configuration reloaded: proxying to %s, default limit %d per %s", applied.BackendURL, applied.RateLimitRequests, applied.RateLimitWindow)
+	return &applied
+}
+
+// gatewayTLS returns the TLS configuration of the gateway listener, or
+// nil when it serves plain HTTP. Certificates come from files, returned so
+// SIGHUP can reload them, or from an ACME CA, renewed in the background
+// until ctx is cancelled.
+func gatewayTLS(ctx context.Context, cfg *config.Config) (*tls.Config, *certs.FileLoader) {
+	switch {
+	case cfg.TLSCertFile != "":
+		files, err := certs.NewFileLoader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load the TLS certificate: %v", err)
+		}
+		log.Printf("🔒 TLS certificate %s valid until %s", cfg.TLSCertFile, files.NotAfter().Format(time.RFC3339))
+		return &tls.Config{GetCertificate: files.GetCertificate}, files
+	case len(cfg.TLSACMEDomains) > 0:
+		acme, err := certs.NewACMEManager(certs.ACMEOptions{
+			DirectoryURL: cfg.TLSACMEDirectoryURL,
+			Email:        cfg.TLSACMEEmail,
+			Domains:      cfg.TLSACMEDomains,
+			CacheDir:     cfg.TLSACMECacheDir,
+		})
+		if err != nil {
+			log.Fatalf("Failed to set up ACME certificates: %v", err)
+		}
+		go acme.Run(ctx)
+		return acme.TLSConfig(), nil
+	}
+	return nil, nil
+}
+
+// serveGRPC starts the gRPC management API on its own listener. Native
+// gRPC clients need HTTP/2, which net/http only negotiates over TLS.
+func serveGRPC(cfg *config.Config, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:         cfg.GRPCListenAddr,
+		Handler:      handler,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	tls := cfg.GRPCTLSCertFile != ""
+	go func() {
+		var err error
+		if tls {
+			err = server.ListenAndServeTLS(cfg.GRPCTLSCertFile, cfg.GRPCTLSKeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("gRPC server error: %v", err)
+		}
+	}()
+	if tls {
+		log.Printf("📡 gRPC management API listening on %s", cfg.GRPCListenAddr)
+	} else {
+		log.Printf("⚠️  gRPC management API on %s has no TLS, only gRPC-Web clients can connect", cfg.GRPCListenAddr)
+	}
+	return server
+}
+
+// awaitRules retries the initial rules load every second until it
+// succeeds, then lets proxy traffic through. If it has not succeeded after
+// timeout, the serve policy lets traffic through with the rules in place
+// so far; the reject policy keeps answering 503.
+func awaitRules(ctx context.Context, gateway *proxy.GatewayProxy, load func(context.Context) error, timeout time.Duration, policy string) {
+	timer := time.AfterFunc(timeout, func() {
+		if gateway.Ready() {
+			return
+		}
+		if policy == config.RulesLoadServe {
+			log.Printf("⚠️  Rules not loaded after %v, serving traffic without them", timeout)
+			gateway.MarkReady()
+			return
+		}
+		log.Printf("🚨 Rules not loaded after %v, still rejecting traffic", timeout)
+	})
+	defer timer.Stop()
+
+	for {
+		err := load(ctx)
+		if err == nil {
+			gateway.MarkReady()
+			return
+		}
+		log.Printf("⚠️  Failed to load rules, retrying: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// migrateKeys brings the shared store's key layout up to date. Instances
+// starting together leave the work to whichever takes the lock first.
+func migrateKeys(store keyschema.Store) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	res, err := keyschema.Migrate(ctx, store, false)
+	switch {
+	case errors.Is(err, keyschema.ErrMigrationInProgress):
+		log.Printf("Key schema migration running on another instance")
+	case errors.Is(err, keyschema.ErrNewerSchema):
+		log.Printf("🚨 %v: counters written by newer instances may be misread", err)
+	case err != nil:
+		log.Printf("⚠️  Key schema migration failed, run gatifyctl migrate-keys: %v", err)
+	default:
+		for _, step := range res.Steps {
+			log.Printf("🔑 Key schema %d→%d (%s): moved %d of %d keys", step.From, step.From+1, step.Description, step.Renamed, step.Matched)
+		}
+	}
+}
+
+// newCanary sends its checks through the gateway in process, marked
+// synthetic so they stay out of the regular request events, and records
+// each result as an analytics event of its own when analytics is enabled.
+func newCanary(cfg *config.Config, gateway http.Handler, events *analytics.Logger) *canary.Monitor {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gateway.ServeHTTP(w, r.WithContext(proxy.Synthetic(r.Context())))
+	})
+	return canary.New(handler, canary.Config{
+		Method:         cfg.CanaryMethod,
+		Path:           cfg.CanaryPath,
+		Interval:       cfg.CanaryInterval,
+		Timeout:        cfg.CanaryTimeout,
+		ExpectedStatus: cfg.CanaryStatus,
+	}, func(res canary.Result) {
+		if events == nil {
+			return
+		}
+		events.Log(analytics.Event{
+			Time:       res.Time,
+			ClientID:   canary.ClientID,
+			Method:     res.Method,
+			Path:       res.Path,
+			Route:      res.Path,
+			Allowed:    res.Success,
+			StatusCode: res.Status,
+			ResponseMS: res.Latency.Milliseconds(),
+		})
+	})
+}
+
+// upstreamCheck applies up's health check overrides to the defaults.
+func upstreamCheck(defaults upstream.HealthCheck, up config.Upstream) upstream.HealthCheck {
+	check := defaults
+	if up.HealthPath != "" {
+		check.Path = up.HealthPath
+	}
+	if up.HealthInterval > 0 {
+		check.Interval = up.HealthInterval
+	}
+	if up.HealthStatus != 0 {
+		check.ExpectedStatus = up.HealthStatus
+	}
+	return check
+}
+
+// resetCounters returns the rule reset callback. It clears every client's
+// limiter, in-flight and quota counters for the rule, in its namespace;
+// all three are tracked in the rule's scope index and deleted under its
+// reset lock.
+func resetCounters(store storage.Storage, quotas *quota.Tracker) func(context.Context, rules.Rule) (int64, error) {
+	return func(ctx context.Context, rule rules.Rule) (int64, error) {
+		if err := quotas.Reset(ctx, rule.Namespace, rule.ID); err != nil {
+			return 0, err
+		}
+		return limiter.Reset(ctx, store, proxy.ScopeKey(rule.Namespace, rule.ID))
+	}
+}
+
+// publishHealth returns a health checker callback that reports each
+// upstream turning healthy or unhealthy to live subscribers.
+func publishHealth(broker *stream.Broker) func(upstream.Transition) {
+	return func(tr upstream.Transition) {
+		data, err := json.Marshal(tr)
+		if err != nil {
+			return
+		}
+		broker.Publish(stream.Event{Time: tr.At, Type: stream.TypeHealth, Change: data})
+	}
+}
+
+// openAnalytics connects the analytics write and read pools and prepares
+// the schema. It returns nil pools when analytics is disabled or the
+// database is unusable; the gateway keeps enforcing limits either way.
+// Reads fall back to the write pool when no separate read URL is set or
+// the read database is unreachable. A DATABASE_URL set in a build without
+// a Postgres driver is fatal rather than silently disabling every feature
+// that needs the database.
+func openAnalytics(ctx context.Context, cfg *config.Config) (write, read *sql.DB) {
+	if !cfg.AnalyticsEnabled || cfg.DatabaseURL == "" {
+		log.Println("ℹ️  Analytics disabled")
+		return nil, nil
+	}
+	if !analytics.DriverAvailable() {
+		log.Fatalf("Invalid DATABASE_URL: %v", analytics.ErrNoDriver)
+	}
+
+	pool := analytics.PoolOptions{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+	}
+	initCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	write, err := analytics.Open(initCtx, cfg.DatabaseURL, pool)
+	if err != nil {
+		log.Printf("⚠️  Analytics disabled, database unavailable: %v", err)
+		return nil, nil
+	}
+	if err := analytics.Migrate(initCtx, write); err != nil {
+		log.Printf("⚠️  Analytics disabled, migration failed: %v", err)
+		write.Close()
+		return nil, nil
+	}
+
+	if cfg.DatabaseReadURL == "" || cfg.DatabaseReadURL == cfg.DatabaseURL {
+		return write, write
+	}
+	read, err = analytics.Open(initCtx, cfg.DatabaseReadURL, pool)
+	if err != nil {
+		log.Printf("⚠️  Analytics read database unavailable, querying the primary: %v", err)
+		return write, write
+	}
+	return write, read
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -56,9 +1073,52 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func rootHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write([]byte("🛡️  Gatify API Gateway\n")); err != nil {
-		log.Printf("Failed to write response: %v", err)
+// gatewayHealth combines what the gateway needs to serve traffic: its
+// rules being loaded, a healthy backend to route to and its critical
+// dependencies. A warm standby is never ready. A nil rulesLoaded counts
+// as loaded and a nil standby as serving.
+type gatewayHealth struct {
+	backends    *upstream.Checker
+	breaker     *upstream.Breaker
+	deps        *upstream.Dependencies
+	rulesLoaded func() bool
+	standby     func() bool
+}
+
+// Health implements api.HealthProvider.
+func (g gatewayHealth) Health() upstream.Report {
+	rep := upstream.Report{
+		Status:       upstream.StatusReady,
+		RulesLoaded:  g.rulesLoaded == nil || g.rulesLoaded(),
+		Upstreams:    g.backends.Statuses(),
+		Breakers:     g.breaker.Statuses(),
+		Dependencies: g.deps.Statuses(),
+	}
+	switch {
+	case g.standby != nil && g.standby():
+		rep.Status = upstream.StatusStandby
+	case !rep.RulesLoaded:
+		rep.Status = upstream.StatusStarting
+	case !g.backends.Ready() || !g.deps.Ready():
+		rep.Status = upstream.StatusUnavailable
 	}
+	return rep
+}
+
+// readyHandler reports whether the gateway serves traffic, along with
+// each upstream's and dependency's status and the circuit breaker
+// counters.
+func readyHandler(g gatewayHealth) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rep := g.Health()
+		code := http.StatusOK
+		if !rep.Ready() {
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(rep); err != nil {
+			log.Printf("Failed to write response: %v", err)
+		}
+	})
 }
@@ -1,9 +1,23 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/config"
+	"github.com/Siruyy/gatify/internal/proxy"
+	"github.com/Siruyy/gatify/internal/quota"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+	"github.com/Siruyy/gatify/internal/stream"
+	"github.com/Siruyy/gatify/internal/upstream"
 )
 
 func TestHealthHandler(t *testing.T) {
@@ -22,13 +36,147 @@ func TestHealthHandler(t *testing.T) {
 	}
 }
 
-func TestRootHandler(t *testing.T) {
-	req := httptest.NewRequest(http.MethodGet, "/", nil)
+func TestReadyHandler(t *testing.T) {
+	u, _ := url.Parse("http://backend")
+	health := upstream.NewChecker([]upstream.Target{{
+		Name:  upstream.DefaultTarget,
+		URL:   u,
+		Check: upstream.HealthCheck{Path: "/healthz"},
+	}}, nil)
+
 	w := httptest.NewRecorder()
+	readyHandler(gatewayHealth{backends: health}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before the first probe, got %d", w.Code)
+	}
 
-	rootHandler(w, req)
+	w = httptest.NewRecorder()
+	readyHandler(gatewayHealth{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"ready"`) {
+		t.Errorf("Expected ready without health checks, got %d %s", w.Code, w.Body.String())
+	}
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+	w = httptest.NewRecorder()
+	readyHandler(gatewayHealth{rulesLoaded: func() bool { return false }}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"status":"starting"`) {
+		t.Errorf("Expected 503 while rules load, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	readyHandler(gatewayHealth{standby: func() bool { return true }}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"status":"standby"`) {
+		t.Errorf("Expected 503 on a standby, got %d %s", w.Code, w.Body.String())
+	}
+
+	deps := upstream.NewDependencies(upstream.HealthCheck{},
+		upstream.Dependency{Name: "redis", Critical: true, Ping: func(context.Context) error { return nil }})
+	w = httptest.NewRecorder()
+	readyHandler(gatewayHealth{deps: deps}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"name":"redis"`) {
+		t.Errorf("Expected 503 until Redis answers, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAwaitRules(t *testing.T) {
+	u, _ := url.Parse("http://backend")
+	newGateway := func() *proxy.GatewayProxy {
+		return proxy.New(proxy.Options{Backend: u, WaitForRules: true})
+	}
+	failing := func(context.Context) error { return errors.New("store unavailable") }
+
+	gateway := newGateway()
+	awaitRules(context.Background(), gateway, func(context.Context) error { return nil }, time.Minute, config.RulesLoadReject)
+	if !gateway.Ready() {
+		t.Error("Expected the gateway ready once rules load")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	gateway = newGateway()
+	awaitRules(ctx, gateway, failing, 10*time.Millisecond, config.RulesLoadServe)
+	if !gateway.Ready() {
+		t.Error("Expected the serve policy to open the gateway after the timeout")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	gateway = newGateway()
+	awaitRules(ctx, gateway, failing, 10*time.Millisecond, config.RulesLoadReject)
+	if gateway.Ready() {
+		t.Error("Expected the reject policy to keep the gateway closed")
+	}
+}
+
+func TestPublishHealth(t *testing.T) {
+	broker := stream.NewBroker()
+	sub := broker.Subscribe(1)
+	defer sub.Close()
+
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	publishHealth(broker)(upstream.Transition{Target: "billing", Healthy: false, At: at, Error: "status 503, want 200"})
+
+	select {
+	case e := <-sub.Events():
+		if e.Type != stream.TypeHealth || !e.Time.Equal(at) {
+			t.Errorf("Event = %+v, want a health event at %v", e, at)
+		}
+		var tr upstream.Transition
+		if err := json.Unmarshal(e.Change, &tr); err != nil {
+			t.Fatalf("Change is not a transition: %v", err)
+		}
+		if tr.Target != "billing" || tr.Healthy || tr.Error != "status 503, want 200" {
+			t.Errorf("Transition = %+v", tr)
+		}
+	default:
+		t.Fatal("Expected the transition to be published")
+	}
+}
+
+func TestUpstreamCheck(t *testing.T) {
+	defaults := upstream.HealthCheck{Path: "/health", Interval: 10 * time.Second, Timeout: 2 * time.Second, ExpectedStatus: http.StatusOK}
+
+	if got := upstreamCheck(defaults, config.Upstream{Name: "users"}); got != defaults {
+		t.Errorf("upstreamCheck() = %+v, want the defaults", got)
+	}
+	got := upstreamCheck(defaults, config.Upstream{Name: "billing", HealthPath: "/ready", HealthInterval: 5 * time.Second, HealthStatus: http.StatusNoContent})
+	want := upstream.HealthCheck{Path: "/ready", Interval: 5 * time.Second, Timeout: 2 * time.Second, ExpectedStatus: http.StatusNoContent}
+	if got != want {
+		t.Errorf("upstreamCheck() = %+v, want %+v", got, want)
+	}
+}
+
+func TestResetCountersCoversNamespacedKeys(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	quotas := quota.NewTracker(store, nil)
+	for _, ns := range []string{"acme", "globex"} {
+		index, _ := storage.IndexKey(proxy.ScopeKey(ns, "r1"))
+		tracked := storage.WithIndex(ctx, index)
+		if _, err := store.GCRA(ctx, proxy.ScopeKey(ns, "r1")+"ip:10.0.0.1", 1, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.IncrBy(tracked, proxy.InflightScopeKey(ns, "r1")+"ip:10.0.0.1", 1, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := quotas.Check(tracked, ns, "r1", "ip:10.0.0.1", 1, quota.PeriodDay); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := resetCounters(store, quotas)(ctx, rules.Rule{ID: "r1", Namespace: "acme"})
+	if err != nil || deleted != 3 {
+		t.Fatalf("resetCounters() = %d, %v, want the limiter, in-flight and quota counters", deleted, err)
+	}
+	if n, _ := store.IncrBy(ctx, proxy.InflightScopeKey("acme", "r1")+"ip:10.0.0.1", 0, 0); n != 0 {
+		t.Errorf("acme in-flight count = %d after reset, want 0", n)
+	}
+	if res, _ := quotas.Check(ctx, "acme", "r1", "ip:10.0.0.1", 1, quota.PeriodDay); !res.Allowed {
+		t.Errorf("Expected the acme quota reset, got %+v", res)
+	}
+	if n, _ := store.IncrBy(ctx, proxy.InflightScopeKey("globex", "r1")+"ip:10.0.0.1", 0, 0); n != 1 {
+		t.Errorf("globex in-flight count = %d, want it untouched", n)
+	}
+	if res, _ := quotas.Check(ctx, "globex", "r1", "ip:10.0.0.1", 1, quota.PeriodDay); res.Allowed {
+		t.Errorf("Expected the globex quota untouched, got %+v", res)
 	}
 }
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+type loadgenOptions struct {
+	apiURL         string
+	gatewayURL     string
+	token          string
+	rule           string
+	identities     int
+	overshoot      float64
+	maxPerIdentity int64
+	concurrency    int
+	timeout        time.Duration
+}
+
+// identity is a synthetic client, expressed as the header that carries it.
+type identity struct {
+	header string
+	value  string
+}
+
+// rulePlan is the traffic loadgen will send to exercise one rule.
+type rulePlan struct {
+	rule        rules.Rule
+	method      string
+	path        string
+	identities  []identity
+	perIdentity int64
+	skip        string
+}
+
+// ruleReport summarizes how the gateway treated a rule's traffic.
+type ruleReport struct {
+	plan    rulePlan
+	sent    int64
+	allowed int64
+	limited int64
+	errors  int64
+	failure string
+}
+
+func runLoadgen(args []string, out io.Writer) error {
+	opts := loadgenOptions{}
+	fs := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	fs.StringVar(&opts.apiURL, "api", "http://localhost:3000", "management API base URL")
+	fs.StringVar(&opts.gatewayURL, "gateway", "", "gateway base URL to send traffic to (defaults to -api)")
+	fs.StringVar(&opts.token, "token", os.Getenv("ADMIN_API_TOKEN"), "admin API token (defaults to $ADMIN_API_TOKEN)")
+	fs.StringVar(&opts.rule, "rule", "", "only exercise the rule with this ID or name")
+	fs.IntVar(&opts.identities, "identities", 3, "distinct client identities per rule")
+	fs.Float64Var(&opts.overshoot, "overshoot", 0.5, "fraction of the limit to send beyond it per identity")
+	fs.Int64Var(&opts.maxPerIdentity, "max-requests", 1000, "skip rules needing more requests than this per identity")
+	fs.IntVar(&opts.concurrency, "concurrency", 8, "concurrent requests per identity burst")
+	fs.DurationVar(&opts.timeout, "timeout", 10*time.Second, "per-request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.gatewayURL == "" {
+		opts.gatewayURL = opts.apiURL
+	}
+	if opts.identities < 1 || opts.identities > 256 {
+		return errors.New("identities must be between 1 and 256")
+	}
+	if opts.concurrency < 1 || opts.overshoot <= 0 {
+		return errors.New("concurrency and overshoot must be positive")
+	}
+
+	hc := &http.Client{Timeout: opts.timeout}
+	ctx := context.Background()
+
+	list, err := newAPIClient(opts.apiURL, opts.token, hc).listRules(ctx)
+	if err != nil {
+		return fmt.Errorf("fetch rules: %w", err)
+	}
+
+	runID, err := newRunID()
+	if err != nil {
+		return err
+	}
+
+	plans := planLoad(list, opts, runID)
+	if len(plans) == 0 {
+		return errors.New("no enabled rules to exercise")
+	}
+
+	reports := make([]ruleReport, 0, len(plans))
+	for _, p := range plans {
+		reports = append(reports, executePlan(ctx, hc, opts, p))
+	}
+
+	printReports(out, reports)
+
+	for _, r := range reports {
+		if r.failure != "" {
+			return errors.New("one or more rules did not behave as configured")
+		}
+	}
+	return nil
+}
+
+// planLoad builds a traffic plan for every enabled rule. Each identity is
+// unique to this run so counters left over from earlier traffic do not
+// skew the results.
+func planLoad(list []rules.Rule, opts loadgenOptions, runID string) []rulePlan {
+	var plans []rulePlan
+	for i, rule := range list {
+		if !rule.Enabled {
+			continue
+		}
+		if opts.rule != "" && rule.ID != opts.rule && rule.Name != opts.rule {
+			continue
+		}
+
+		p := rulePlan{
+			rule:        rule,
+			method:      http.MethodGet,
+			path:        concretePath(rule.Pattern),
+			perIdentity: rule.Limit + int64(math.Ceil(float64(rule.Limit)*opts.overshoot)),
+		}
+		if len(rule.Methods) > 0 {
+			p.method = rule.Methods[0]
+		}
+		if reason := untestable(rule); reason != "" {
+			p.skip = reason
+		} else if p.perIdentity > opts.maxPerIdentity {
+			p.skip = fmt.Sprintf("needs %d requests per identity (max %d)", p.perIdentity, opts.maxPerIdentity)
+		}
+
+		for n := 0; n < opts.identities; n++ {
+			p.identities = append(p.identities, syntheticIdentity(rule, runID, i, n))
+		}
+		plans = append(plans, p)
+	}
+	return plans
+}
+
+// untestable explains why loadgen cannot check a rule's limit from its
+// definition alone, or returns "" when it can.
+func untestable(rule rules.Rule) string {
+	if rule.Policy != "" {
+		return fmt.Sprintf("limit comes from policy %q", rule.Policy)
+	}
+	if rule.Shadow {
+		return "shadow mode, limit not enforced"
+	}
+	if rule.Honeypot != nil {
+		return "honeypot, its traffic would be banned"
+	}
+	if rule.Action != nil {
+		return fmt.Sprintf("answered by a %s action at the gateway", rule.Action.Type)
+	}
+	return ""
+}
+
+// concretePath turns a rule pattern into a request path that matches it.
+func concretePath(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, ":") || seg == "*" {
+			segments[i] = "loadgen"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// syntheticIdentity derives a distinct client for the rule. IP identities
+// are drawn from the 198.18.0.0/15 benchmarking range and sent through
+// X-Forwarded-For, so the gateway must be configured to trust proxy
+// headers for them to be told apart. Composite identities vary their
+// first header or cookie part unless they include the IP.
+func syntheticIdentity(rule rules.Rule, runID string, ruleIdx, n int) identity {
+	source, name := rule.IdentifyBy, ""
+	if rule.Composite() {
+		source, name = compositeSource(rule)
+	}
+	switch source {
+	case rules.IdentifyByHeader:
+		if name == "" {
+			name = rule.IdentityHeaders()[0]
+		}
+		return identity{
+			header: name,
+			value:  fmt.Sprintf("loadgen-%s-%d-%d", runID, ruleIdx, n),
+		}
+	case rules.IdentifyByCookie:
+		if name == "" {
+			name = rule.CookieName
+		}
+		return identity{
+			header: "Cookie",
+			value:  fmt.Sprintf("%s=loadgen-%s-%d-%d", name, runID, ruleIdx, n),
+		}
+	}
+	var base uint32
+	if v, err := strconv.ParseUint(runID[:4], 16, 32); err == nil {
+		base = uint32(v)
+	}
+	offset := (base + uint32(ruleIdx)<<8 + uint32(n)) % (1 << 17)
+	return identity{
+		header: "X-Forwarded-For",
+		value:  fmt.Sprintf("198.%d.%d.%d", 18+offset>>16, (offset>>8)&0xff, offset&0xff),
+	}
+}
+
+// compositeSource picks the part of a composite identity loadgen varies:
+// the IP when it is included, or else the first header or cookie.
+func compositeSource(rule rules.Rule) (source, name string) {
+	parts, _ := rule.IdentityParts()
+	for _, part := range parts {
+		if part.Source == rules.IdentifyByIP {
+			return part.Source, ""
+		}
+		if source == "" && (part.Source == rules.IdentifyByHeader || part.Source == rules.IdentifyByCookie) {
+			source, name = part.Source, part.Name
+		}
+	}
+	return source, name
+}
+
+func executePlan(ctx context.Context, hc *http.Client, opts loadgenOptions, p rulePlan) ruleReport {
+	report := ruleReport{plan: p}
+	if p.skip != "" {
+		return report
+	}
+
+	url := strings.TrimRight(opts.gatewayURL, "/") + p.path
+	for _, id := range p.identities {
+		var allowed, limited, errs atomic.Int64
+		var wg sync.WaitGroup
+		jobs := make(chan struct{})
+
+		for w := 0; w < opts.concurrency; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range jobs {
+					status, err := send(ctx, hc, p.method, url, id)
+					switch {
+					case err != nil:
+						errs.Add(1)
+					case status == http.StatusTooManyRequests:
+						limited.Add(1)
+					default:
+						allowed.Add(1)
+					}
+				}
+			}()
+		}
+		for i := int64(0); i < p.perIdentity; i++ {
+			jobs <- struct{}{}
+		}
+		close(jobs)
+		wg.Wait()
+
+		report.sent += p.perIdentity
+		report.allowed += allowed.Load()
+		report.limited += limited.Load()
+		report.errors += errs.Load()
+
+		if report.failure != "" {
+			continue
+		}
+		switch {
+		case errs.Load() > 0:
+			report.failure = fmt.Sprintf("%d request errors", errs.Load())
+		case allowed.Load() > p.rule.Limit:
+			report.failure = fmt.Sprintf("identity %s allowed %d > limit %d", id.value, allowed.Load(), p.rule.Limit)
+		case limited.Load() == 0:
+			report.failure = fmt.Sprintf("identity %s was never limited", id.value)
+		}
+	}
+	return report
+}
+
+func send(ctx context.Context, hc *http.Client, method, url string, id identity) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set(id.header, id.value)
+	req.Header.Set("User-Agent", "gatifyctl-loadgen")
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func printReports(out io.Writer, reports []ruleReport) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RULE\tROUTE\tLIMIT\tSENT\tALLOWED\tLIMITED\tERRORS\tRESULT")
+	for _, r := range reports {
+		result := "PASS"
+		switch {
+		case r.plan.skip != "":
+			result = "SKIP: " + r.plan.skip
+		case r.failure != "":
+			result = "FAIL: " + r.failure
+		}
+		fmt.Fprintf(tw, "%s\t%s %s\t%d/%ds\t%d\t%d\t%d\t%d\t%s\n",
+			r.plan.rule.Name, r.plan.method, r.plan.path,
+			r.plan.rule.Limit, r.plan.rule.WindowSeconds,
+			r.sent, r.allowed, r.limited, r.errors, result)
+	}
+	tw.Flush()
+}
+
+func newRunID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
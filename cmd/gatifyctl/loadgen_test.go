@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+func TestConcretePath(t *testing.T) {
+	tests := map[string]string{
+		"/api/users":          "/api/users",
+		"/api/users/:id":      "/api/users/loadgen",
+		"/static/*":           "/static/loadgen",
+		"/orgs/:org/repos/:r": "/orgs/loadgen/repos/loadgen",
+	}
+
+	for pattern, want := range tests {
+		if got := concretePath(pattern); got != want {
+			t.Errorf("concretePath(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+}
+
+func TestPlanLoad(t *testing.T) {
+	list := []rules.Rule{
+		{ID: "a", Name: "login", Pattern: "/login", Methods: []string{"POST"}, Limit: 4, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Enabled: true},
+		{ID: "b", Name: "keys", Pattern: "/v1/*", Limit: 10, WindowSeconds: 60, IdentifyBy: rules.IdentifyByHeader, HeaderName: "X-Api-Key", Enabled: true},
+		{ID: "c", Name: "off", Pattern: "/off", Limit: 1, WindowSeconds: 1, Enabled: false},
+		{ID: "d", Name: "huge", Pattern: "/bulk", Limit: 5000, WindowSeconds: 60, Enabled: true},
+	}
+	opts := loadgenOptions{identities: 2, overshoot: 0.5, maxPerIdentity: 100}
+
+	plans := planLoad(list, opts, "abcd1234")
+	if len(plans) != 3 {
+		t.Fatalf("Expected 3 plans (disabled rule skipped), got %d", len(plans))
+	}
+
+	login := plans[0]
+	if login.method != http.MethodPost || login.perIdentity != 6 {
+		t.Errorf("Unexpected login plan: method %s, perIdentity %d", login.method, login.perIdentity)
+	}
+	if login.identities[0].header != "X-Forwarded-For" || login.identities[0].value == login.identities[1].value {
+		t.Errorf("Expected distinct forwarded IPs, got %+v", login.identities)
+	}
+
+	keys := plans[1]
+	if keys.path != "/v1/loadgen" || keys.identities[0].header != "X-Api-Key" {
+		t.Errorf("Unexpected header plan: %+v", keys)
+	}
+	if !strings.Contains(keys.identities[0].value, "abcd1234") {
+		t.Errorf("Expected identity scoped to run ID, got %s", keys.identities[0].value)
+	}
+
+	if plans[2].skip == "" {
+		t.Error("Expected rule above max-requests to be skipped")
+	}
+}
+
+func TestPlanLoadSkipsUntestableRules(t *testing.T) {
+	list := []rules.Rule{
+		{ID: "a", Name: "tiered", Pattern: "/v1/*", Policy: "plans", Enabled: true},
+		{ID: "b", Name: "trial", Pattern: "/trial", Limit: 5, WindowSeconds: 60, Shadow: true, Enabled: true},
+		{ID: "c", Name: "trap", Pattern: "/wp-admin", Limit: 5, WindowSeconds: 60, Honeypot: &rules.Honeypot{}, Enabled: true},
+		{ID: "d", Name: "legacy", Pattern: "/v0/*", Limit: 5, WindowSeconds: 60, Action: &rules.RuleAction{Type: "block"}, Enabled: true},
+	}
+	opts := loadgenOptions{identities: 1, overshoot: 0.5, maxPerIdentity: 100}
+
+	plans := planLoad(list, opts, "abcd1234")
+	if len(plans) != len(list) {
+		t.Fatalf("Expected a plan per rule, got %d", len(plans))
+	}
+	for _, p := range plans {
+		if p.skip == "" {
+			t.Errorf("Expected rule %s to be skipped", p.rule.Name)
+		}
+	}
+}
+
+func TestPlanLoadRuleFilter(t *testing.T) {
+	list := []rules.Rule{
+		{ID: "a", Name: "login", Pattern: "/login", Limit: 1, WindowSeconds: 1, Enabled: true},
+		{ID: "b", Name: "search", Pattern: "/search", Limit: 1, WindowSeconds: 1, Enabled: true},
+	}
+	opts := loadgenOptions{identities: 1, overshoot: 1, maxPerIdentity: 10, rule: "search"}
+
+	plans := planLoad(list, opts, "00000000")
+	if len(plans) != 1 || plans[0].rule.ID != "b" {
+		t.Fatalf("Expected only the search rule, got %+v", plans)
+	}
+}
+
+// fakeGateway serves the rules API and limits each identity to limit
+// requests, mimicking a correctly configured gateway.
+func fakeGateway(t *testing.T, list []rules.Rule, limit int) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	seen := make(map[string]int)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/rules" {
+			if r.Header.Get("Authorization") != "Bearer tok" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(list)
+			return
+		}
+
+		key := r.Header.Get("X-Forwarded-For") + r.Header.Get("X-Api-Key")
+		mu.Lock()
+		seen[key]++
+		n := seen[key]
+		mu.Unlock()
+
+		if n > limit {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestRunLoadgenPasses(t *testing.T) {
+	list := []rules.Rule{
+		{ID: "a", Name: "login", Pattern: "/login/:id", Limit: 3, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Enabled: true},
+	}
+	srv := fakeGateway(t, list, 3)
+	defer srv.Close()
+
+	var out bytes.Buffer
+	err := runLoadgen([]string{"-api", srv.URL, "-token", "tok", "-identities", "2"}, &out)
+	if err != nil {
+		t.Fatalf("runLoadgen() error = %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "PASS") {
+		t.Errorf("Expected PASS in report, got:\n%s", out.String())
+	}
+}
+
+func TestRunLoadgenDetectsMisconfiguredLimit(t *testing.T) {
+	list := []rules.Rule{
+		{ID: "a", Name: "login", Pattern: "/login", Limit: 3, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Enabled: true},
+	}
+	// Gateway enforces a looser limit than the rule declares.
+	srv := fakeGateway(t, list, 100)
+	defer srv.Close()
+
+	var out bytes.Buffer
+	err := runLoadgen([]string{"-api", srv.URL, "-token", "tok"}, &out)
+	if err == nil {
+		t.Fatal("Expected loadgen to report a failure")
+	}
+	if !strings.Contains(out.String(), "FAIL") {
+		t.Errorf("Expected FAIL in report, got:\n%s", out.String())
+	}
+}
+
+func TestRunLoadgenUnauthorized(t *testing.T) {
+	srv := fakeGateway(t, nil, 1)
+	defer srv.Close()
+
+	err := runLoadgen([]string{"-api", srv.URL, "-token", "wrong"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "fetch rules") {
+		t.Errorf("Expected fetch rules error, got %v", err)
+	}
+}
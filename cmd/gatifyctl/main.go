@@ -0,0 +1,42 @@
+// Command gatifyctl is the operator CLI for a running Gatify gateway.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: gatifyctl <command> [flags]
+
+Commands:
+  loadgen       Generate traffic that exercises every enabled rule
+  migrate-keys  Move Redis keys to the current key schema
+
+Run "gatifyctl <command> -h" for command flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "loadgen":
+		err = runLoadgen(os.Args[2:], os.Stdout)
+	case "migrate-keys":
+		err = runMigrateKeys(os.Args[2:], os.Stdout)
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gatifyctl: %v\n", err)
+		os.Exit(1)
+	}
+}
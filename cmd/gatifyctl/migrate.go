@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/keyschema"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// runMigrateKeys moves the keys in Redis to the current key schema. The
+// gateway does the same at startup; the command lets operators preview a
+// migration with -dry-run or run it ahead of a rollout.
+func runMigrateKeys(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("migrate-keys", flag.ContinueOnError)
+	addr := fs.String("redis-addr", envOr("REDIS_ADDR", "localhost:6379"), "Redis address (defaults to $REDIS_ADDR)")
+	password := fs.String("redis-password", os.Getenv("REDIS_PASSWORD"), "Redis password (defaults to $REDIS_PASSWORD)")
+	db := fs.Int("redis-db", envIntOr("REDIS_DB", 0), "Redis database (defaults to $REDIS_DB)")
+	dryRun := fs.Bool("dry-run", false, "count the keys to move without changing anything")
+	timeout := fs.Duration("timeout", 10*time.Minute, "give up after this long")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store := storage.NewRedisStorage(storage.RedisOptions{Addr: *addr, Password: *password, DB: *db})
+	defer store.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if err := store.Ping(ctx); err != nil {
+		return fmt.Errorf("connect to redis at %s: %w", *addr, err)
+	}
+	return migrateKeys(ctx, store, *dryRun, out)
+}
+
+func migrateKeys(ctx context.Context, store keyschema.Store, dryRun bool, out io.Writer) error {
+	res, err := keyschema.Migrate(ctx, store, dryRun)
+	for _, step := range res.Steps {
+		if dryRun {
+			fmt.Fprintf(out, "%d → %d  %s: would move %d keys\n", step.From, step.From+1, step.Description, step.Matched)
+			continue
+		}
+		fmt.Fprintf(out, "%d → %d  %s: moved %d of %d keys\n", step.From, step.From+1, step.Description, step.Renamed, step.Matched)
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(res.Steps) == 0:
+		fmt.Fprintf(out, "Key schema is up to date (version %d)\n", res.To)
+	case dryRun:
+		fmt.Fprintf(out, "Dry run: key schema would go from version %d to %d\n", res.From, res.To)
+	default:
+		fmt.Fprintf(out, "Key schema migrated from version %d to %d\n", res.From, res.To)
+	}
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envIntOr(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return n
+	}
+	return fallback
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestMigrateKeys(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	_ = store.Set(ctx, "gatify:rl:r1:ip:10.0.0.1", "3", time.Minute)
+
+	var out strings.Builder
+	if err := migrateKeys(ctx, store, true, &out); err != nil {
+		t.Fatalf("migrateKeys(dry run) error = %v", err)
+	}
+	if !strings.Contains(out.String(), "would move 1 keys") || !strings.Contains(out.String(), "from version 1 to 3") {
+		t.Errorf("Unexpected dry run output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := migrateKeys(ctx, store, false, &out); err != nil {
+		t.Fatalf("migrateKeys() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "moved 1 of 1 keys") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+
+	out.Reset()
+	_ = migrateKeys(ctx, store, false, &out)
+	if !strings.Contains(out.String(), "up to date (version 3)") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+}
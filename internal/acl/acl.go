@@ -0,0 +1,139 @@
+// Package acl manages the IP allowlist and denylist the gateway checks
+// before rate limiting.
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry actions.
+const (
+	// ActionDeny rejects every request from the range with 403.
+	ActionDeny = "deny"
+	// ActionAllow exempts the range from rate and concurrency limits.
+	ActionAllow = "allow"
+)
+
+// maxCommentLength bounds the free-form note kept with an entry.
+const maxCommentLength = 256
+
+// Entry allows or denies an IP address or CIDR range.
+type Entry struct {
+	ID string `json:"id"`
+	// CIDR is a range such as 10.0.0.0/8 or a single address, which is
+	// stored as a /32 or /128.
+	CIDR      string    `json:"cidr"`
+	Action    string    `json:"action"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Normalize canonicalizes the entry's range and action. Invalid ranges
+// are left for Validate to report.
+func (e *Entry) Normalize() {
+	e.Action = strings.ToLower(strings.TrimSpace(e.Action))
+	e.Comment = strings.TrimSpace(e.Comment)
+	e.CIDR = strings.TrimSpace(e.CIDR)
+	if prefix, err := parsePrefix(e.CIDR); err == nil {
+		e.CIDR = prefix.String()
+	}
+}
+
+// Validate reports whether the entry can be enforced.
+func (e *Entry) Validate() error {
+	if e.CIDR == "" {
+		return errors.New("cidr is required")
+	}
+	if _, err := parsePrefix(e.CIDR); err != nil {
+		return fmt.Errorf("cidr %q is not an IP address or CIDR range", e.CIDR)
+	}
+	if e.Action != ActionAllow && e.Action != ActionDeny {
+		return fmt.Errorf("action must be %q or %q", ActionAllow, ActionDeny)
+	}
+	if len(e.Comment) > maxCommentLength {
+		return fmt.Errorf("comment must be at most %d characters", maxCommentLength)
+	}
+	return nil
+}
+
+// parsePrefix accepts a CIDR range or a single address. Host bits of a
+// range are cleared, so 10.1.2.3/8 means 10.0.0.0/8.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap().WithZone("")
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// List is a compiled set of entries, safe for concurrent lookups. A nil
+// List matches nothing.
+type List struct {
+	entries []compiled
+}
+
+type compiled struct {
+	prefix netip.Prefix
+	entry  Entry
+}
+
+// Compile builds a List from entries, skipping any that are invalid.
+func Compile(entries []Entry) *List {
+	l := &List{entries: make([]compiled, 0, len(entries))}
+	for _, e := range entries {
+		prefix, err := parsePrefix(e.CIDR)
+		if err != nil {
+			continue
+		}
+		l.entries = append(l.entries, compiled{prefix: prefix, entry: e})
+	}
+	// The most specific range wins, so an allowed host can sit inside a
+	// denied network and vice versa. Deny wins between equal ranges.
+	sort.SliceStable(l.entries, func(i, j int) bool {
+		a, b := l.entries[i], l.entries[j]
+		if a.prefix.Bits() != b.prefix.Bits() {
+			return a.prefix.Bits() > b.prefix.Bits()
+		}
+		return a.entry.Action == ActionDeny && b.entry.Action != ActionDeny
+	})
+	return l
+}
+
+// Len returns the number of entries in the list.
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.entries)
+}
+
+// Lookup returns the entry deciding addr, if any.
+func (l *List) Lookup(addr netip.Addr) (Entry, bool) {
+	if l == nil || !addr.IsValid() {
+		return Entry{}, false
+	}
+	addr = addr.Unmap().WithZone("")
+	for _, c := range l.entries {
+		if c.prefix.Contains(addr) {
+			return c.entry, true
+		}
+	}
+	return Entry{}, false
+}
@@ -0,0 +1,75 @@
+package acl
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestEntryNormalizeAndValidate(t *testing.T) {
+	tests := map[string]string{
+		"10.1.2.3":            "10.1.2.3/32",
+		" 10.1.2.3/8 ":        "10.0.0.0/8",
+		"2001:db8::1":         "2001:db8::1/128",
+		"::ffff:10.0.0.1":     "10.0.0.1/32",
+		"2001:db8::/32":       "2001:db8::/32",
+		"::ffff:10.0.0.0/104": "10.0.0.0/8",
+	}
+	for in, want := range tests {
+		e := Entry{CIDR: in, Action: " Deny "}
+		e.Normalize()
+		if err := e.Validate(); err != nil {
+			t.Errorf("Validate(%q) error = %v", in, err)
+		}
+		if e.CIDR != want || e.Action != ActionDeny {
+			t.Errorf("Normalize(%q) = %q %q, want %q deny", in, e.CIDR, e.Action, want)
+		}
+	}
+
+	for name, e := range map[string]Entry{
+		"empty cidr":     {Action: ActionDeny},
+		"bad cidr":       {CIDR: "10.0.0.0/33", Action: ActionDeny},
+		"hostname":       {CIDR: "example.com", Action: ActionAllow},
+		"unknown action": {CIDR: "10.0.0.1", Action: "block"},
+	} {
+		e.Normalize()
+		if err := e.Validate(); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+}
+
+func TestListLookup(t *testing.T) {
+	list := Compile([]Entry{
+		{ID: "net", CIDR: "10.0.0.0/8", Action: ActionDeny},
+		{ID: "office", CIDR: "10.1.0.0/16", Action: ActionAllow},
+		{ID: "laptop", CIDR: "10.1.2.3/32", Action: ActionDeny},
+		{ID: "v6", CIDR: "2001:db8::/32", Action: ActionAllow},
+		{ID: "tie-allow", CIDR: "192.0.2.0/24", Action: ActionAllow},
+		{ID: "tie-deny", CIDR: "192.0.2.0/24", Action: ActionDeny},
+		{ID: "broken", CIDR: "nope", Action: ActionDeny},
+	})
+	if list.Len() != 6 {
+		t.Errorf("Expected the invalid entry skipped, got %d entries", list.Len())
+	}
+
+	tests := map[string]string{
+		"10.9.9.9":        "net",
+		"10.1.9.9":        "office",
+		"10.1.2.3":        "laptop",
+		"::ffff:10.1.9.9": "office",
+		"2001:db8::42":    "v6",
+		"192.0.2.10":      "tie-deny",
+		"203.0.113.1":     "",
+	}
+	for ip, want := range tests {
+		got, ok := list.Lookup(netip.MustParseAddr(ip))
+		if got.ID != want || ok != (want != "") {
+			t.Errorf("Lookup(%s) = %q, %v; want %q", ip, got.ID, ok, want)
+		}
+	}
+
+	var empty *List
+	if _, ok := empty.Lookup(netip.MustParseAddr("10.0.0.1")); ok {
+		t.Error("Expected a nil list to match nothing")
+	}
+}
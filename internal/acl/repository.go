@@ -0,0 +1,173 @@
+package acl
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when an entry does not exist.
+	ErrNotFound = errors.New("acl entry not found")
+	// ErrDuplicate is returned when another entry already covers exactly
+	// the same range.
+	ErrDuplicate = errors.New("an acl entry for this range already exists")
+)
+
+// Repository persists ACL entries.
+type Repository interface {
+	List(ctx context.Context) ([]Entry, error)
+	Get(ctx context.Context, id string) (Entry, error)
+	Create(ctx context.Context, entry Entry) (Entry, error)
+	Update(ctx context.Context, entry Entry) (Entry, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// InMemoryRepository is a Repository backed by a map, persisted through
+// snapshots like the rules repository. It is safe for concurrent use.
+type InMemoryRepository struct {
+	mu      sync.RWMutex
+	entries map[string]Entry
+	// changes counts mutations so snapshots are only written when there
+	// is something new to save.
+	changes uint64
+	now     func() time.Time
+}
+
+// NewInMemoryRepository creates an empty in-memory repository.
+func NewInMemoryRepository() *InMemoryRepository {
+	return &InMemoryRepository{entries: make(map[string]Entry), now: time.Now}
+}
+
+// List returns all entries ordered by range.
+func (r *InMemoryRepository) List(_ context.Context) ([]Entry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]Entry, 0, len(r.entries))
+	for _, e := range r.entries {
+		out = append(out, e)
+	}
+	sortEntries(out)
+	return out, nil
+}
+
+// Get returns the entry with the given ID.
+func (r *InMemoryRepository) Get(_ context.Context, id string) (Entry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.entries[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	return e, nil
+}
+
+// Create stores a new entry, assigning it an ID and timestamps.
+func (r *InMemoryRepository) Create(_ context.Context, entry Entry) (Entry, error) {
+	id, err := newID()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.duplicate(entry) {
+		return Entry{}, ErrDuplicate
+	}
+	now := r.now().UTC()
+	entry.ID = id
+	entry.CreatedAt = now
+	entry.UpdatedAt = now
+	r.entries[id] = entry
+	r.changes++
+	return entry, nil
+}
+
+// Update replaces an existing entry, preserving its creation time.
+func (r *InMemoryRepository) Update(_ context.Context, entry Entry) (Entry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.entries[entry.ID]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	if r.duplicate(entry) {
+		return Entry{}, ErrDuplicate
+	}
+	entry.CreatedAt = existing.CreatedAt
+	entry.UpdatedAt = r.now().UTC()
+	r.entries[entry.ID] = entry
+	r.changes++
+	return entry, nil
+}
+
+// Delete removes the entry with the given ID.
+func (r *InMemoryRepository) Delete(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.entries[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.entries, id)
+	r.changes++
+	return nil
+}
+
+// Replace makes the repository hold exactly entries, keeping their IDs
+// and timestamps, as a standby mirroring its primary does. It reports
+// whether anything changed.
+func (r *InMemoryRepository) Replace(entries []Entry) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next := make(map[string]Entry, len(entries))
+	changed := len(entries) != len(r.entries)
+	for _, e := range entries {
+		next[e.ID] = e
+		if existing, ok := r.entries[e.ID]; !ok || !existing.UpdatedAt.Equal(e.UpdatedAt) {
+			changed = true
+		}
+	}
+	if changed {
+		r.entries = next
+		r.changes++
+	}
+	return changed
+}
+
+// duplicate reports whether another entry has entry's range. The caller
+// must hold the lock.
+func (r *InMemoryRepository) duplicate(entry Entry) bool {
+	for id, e := range r.entries {
+		if id != entry.ID && e.CIDR == entry.CIDR {
+			return true
+		}
+	}
+	return false
+}
+
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].CIDR != entries[j].CIDR {
+			return entries[i].CIDR < entries[j].CIDR
+		}
+		return entries[i].ID < entries[j].ID
+	})
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,62 @@
+package acl
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepositoryCRUD(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryRepository()
+
+	created, err := repo.Create(ctx, Entry{CIDR: "10.0.0.0/8", Action: ActionDeny})
+	if err != nil || created.ID == "" || created.CreatedAt.IsZero() {
+		t.Fatalf("Create() = %+v, %v", created, err)
+	}
+	if _, err := repo.Create(ctx, Entry{CIDR: "10.0.0.0/8", Action: ActionAllow}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected ErrDuplicate, got %v", err)
+	}
+
+	created.Action = ActionAllow
+	updated, err := repo.Update(ctx, created)
+	if err != nil || updated.Action != ActionAllow || !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("Update() = %+v, %v", updated, err)
+	}
+	if _, err := repo.Update(ctx, Entry{ID: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	if err := repo.Delete(ctx, created.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := repo.Get(ctx, created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "acl.json")
+
+	repo := NewInMemoryRepository()
+	created, _ := repo.Create(ctx, Entry{CIDR: "192.0.2.0/24", Action: ActionDeny, Comment: "scanner"})
+	if err := repo.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+
+	restored := NewInMemoryRepository()
+	if err := restored.LoadSnapshot(path); err != nil {
+		t.Fatalf("LoadSnapshot() error = %v", err)
+	}
+	got, err := restored.Get(ctx, created.ID)
+	if err != nil || got.CIDR != "192.0.2.0/24" || got.Comment != "scanner" {
+		t.Errorf("Restored entry = %+v, %v", got, err)
+	}
+
+	if err := restored.LoadSnapshot(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package acl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/snapshot"
+)
+
+// snapshotFile is the on-disk form of an InMemoryRepository.
+type snapshotFile struct {
+	SavedAt time.Time `json:"saved_at"`
+	Entries []Entry   `json:"entries"`
+}
+
+// SaveSnapshot writes every entry to path as JSON. The file is replaced
+// atomically, so a crash mid-write leaves the previous snapshot intact.
+func (r *InMemoryRepository) SaveSnapshot(path string) error {
+	_, err := r.saveSnapshot(path)
+	return err
+}
+
+func (r *InMemoryRepository) saveSnapshot(path string) (uint64, error) {
+	r.mu.RLock()
+	snap := snapshotFile{SavedAt: r.now().UTC(), Entries: make([]Entry, 0, len(r.entries))}
+	for _, e := range r.entries {
+		snap.Entries = append(snap.Entries, e)
+	}
+	changes := r.changes
+	r.mu.RUnlock()
+
+	sortEntries(snap.Entries)
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("encode acl snapshot: %w", err)
+	}
+
+	if err := snapshot.WriteFile(path, data); err != nil {
+		return 0, fmt.Errorf("write acl snapshot: %w", err)
+	}
+	return changes, nil
+}
+
+// LoadSnapshot replaces the repository's contents with the snapshot at
+// path. A missing file is reported as an error satisfying
+// errors.Is(err, fs.ErrNotExist).
+func (r *InMemoryRepository) LoadSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read acl snapshot: %w", err)
+	}
+	var snap snapshotFile
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode acl snapshot %s: %w", path, err)
+	}
+
+	entries := make(map[string]Entry, len(snap.Entries))
+	for _, e := range snap.Entries {
+		if e.ID == "" {
+			return fmt.Errorf("decode acl snapshot %s: entry without id", path)
+		}
+		if err := e.Validate(); err != nil {
+			return fmt.Errorf("decode acl snapshot %s: entry %s: %w", path, e.ID, err)
+		}
+		entries[e.ID] = e
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = entries
+	r.changes = 0
+	return nil
+}
+
+// RunSnapshots saves the repository to path every interval while it has
+// unsaved changes, until ctx is cancelled.
+func (r *InMemoryRepository) RunSnapshots(ctx context.Context, path string, interval time.Duration) {
+	snapshot.Run(ctx, "ACL", interval, r.changeCount, func() (uint64, error) {
+		return r.saveSnapshot(path)
+	})
+}
+
+// changeCount returns the number of changes made to the repository since
+// it was created or last loaded.
+func (r *InMemoryRepository) changeCount() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.changes
+}
@@ -0,0 +1,118 @@
+package analytics
+
+import (
+	"log"
+	"time"
+)
+
+// Bounds of adaptive flushing, relative to the configured batch size and
+// flush interval.
+const (
+	// maxBatchFactor caps batch growth at the event buffer's capacity,
+	// and never beyond MaxBatchSize.
+	maxBatchFactor = 10
+	// minIntervalFactor and maxIntervalFactor bound the flush interval to
+	// between a tenth and four times the configured one.
+	minIntervalFactor = 10
+	maxIntervalFactor = 4
+	// slowWrite is the insert latency above which the database is taken
+	// to be struggling.
+	slowWrite = time.Second
+)
+
+// flushTuner adapts the Logger's batch size and flush interval to the
+// event arrival rate and the database's write latency, AIMD-style:
+//
+//   - While batches fill before the interval ends and inserts are fast,
+//     the batch size grows by the configured size, so a burst is written
+//     in fewer, larger inserts instead of overflowing the buffer.
+//   - While traffic is too light to fill a batch within the interval and
+//     inserts are fast, the interval shrinks by a tenth of the configured
+//     one, so quiet periods do not hold events back.
+//   - A slow or failed insert halves the batch size and doubles the
+//     interval, easing the load on the database at once.
+//
+// It is owned by the Logger's Run goroutine.
+type flushTuner struct {
+	enabled bool
+
+	batch, baseBatch, maxBatch int
+	interval, baseInterval     time.Duration
+	minInterval, maxInterval   time.Duration
+	arrived                    int
+	lastTick                   time.Time
+	healthy                    bool
+	rate                       float64
+	now                        func() time.Time
+	onIntervalChange           func(time.Duration)
+}
+
+func newFlushTuner(batch int, interval time.Duration, now func() time.Time) *flushTuner {
+	return &flushTuner{
+		batch:        batch,
+		baseBatch:    batch,
+		maxBatch:     min(batch*maxBatchFactor, MaxBatchSize),
+		interval:     interval,
+		baseInterval: interval,
+		minInterval:  interval / minIntervalFactor,
+		maxInterval:  interval * maxIntervalFactor,
+		healthy:      true,
+		now:          now,
+	}
+}
+
+// received counts an event taken off the buffer.
+func (t *flushTuner) received() {
+	t.arrived++
+}
+
+// wrote adjusts to an insert of n events that took took.
+func (t *flushTuner) wrote(n int, took time.Duration, err error) {
+	if !t.enabled {
+		return
+	}
+	t.healthy = err == nil && took <= slowWrite
+	if !t.healthy {
+		batch, interval := max(t.batch/2, t.baseBatch), min(t.interval*2, t.maxInterval)
+		// Failures are reported by the circuit breaker.
+		if err == nil && (batch != t.batch || interval != t.interval) {
+			log.Printf("⚠️  Analytics insert of %d events took %s, batching %d events every %s",
+				n, took.Round(time.Millisecond), batch, interval)
+		}
+		t.batch = batch
+		t.setInterval(interval)
+		return
+	}
+	if n >= t.batch {
+		t.batch = min(t.batch+t.baseBatch, t.maxBatch)
+	}
+}
+
+// ticked measures the arrival rate over the interval that just ended and
+// shortens the interval when it is too light to fill a batch.
+func (t *flushTuner) ticked() {
+	now := t.now()
+	last, arrived := t.lastTick, t.arrived
+	t.lastTick, t.arrived = now, 0
+	elapsed := now.Sub(last).Seconds()
+	if last.IsZero() || elapsed <= 0 {
+		return
+	}
+	t.rate = float64(arrived) / elapsed
+	if !t.enabled || !t.healthy {
+		return
+	}
+	if t.rate*t.interval.Seconds() < float64(t.batch) {
+		t.setInterval(max(t.interval-t.baseInterval/minIntervalFactor, t.minInterval))
+	}
+}
+
+func (t *flushTuner) setInterval(d time.Duration) {
+	if d == t.interval || d <= 0 {
+		return
+	}
+	t.interval = d
+	if t.onIntervalChange != nil {
+		t.onIntervalChange(d)
+	}
+}
@@ -0,0 +1,144 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFlushTunerGrowsBatchesDuringBursts(t *testing.T) {
+	tuner := newFlushTuner(100, 5*time.Second, time.Now)
+	tuner.enabled = true
+
+	tuner.wrote(100, 10*time.Millisecond, nil)
+	if tuner.batch != 200 {
+		t.Errorf("batch after a full fast insert = %d, want 200", tuner.batch)
+	}
+	tuner.wrote(50, 10*time.Millisecond, nil)
+	if tuner.batch != 200 {
+		t.Errorf("batch after a partial insert = %d, want 200", tuner.batch)
+	}
+	for i := 0; i < 20; i++ {
+		tuner.wrote(tuner.batch, 10*time.Millisecond, nil)
+	}
+	if tuner.batch != 1000 {
+		t.Errorf("batch after a long burst = %d, want the cap of 1000", tuner.batch)
+	}
+}
+
+func TestFlushTunerCapsBatchesAtInsertLimit(t *testing.T) {
+	tuner := newFlushTuner(1000, 5*time.Second, time.Now)
+	tuner.enabled = true
+	for i := 0; i < 20; i++ {
+		tuner.wrote(tuner.batch, 10*time.Millisecond, nil)
+	}
+	if tuner.batch != MaxBatchSize {
+		t.Errorf("batch after a long burst = %d, want %d", tuner.batch, MaxBatchSize)
+	}
+}
+
+func TestFlushTunerBacksOffWhenWritesAreSlow(t *testing.T) {
+	tuner := newFlushTuner(100, 5*time.Second, time.Now)
+	tuner.enabled = true
+	var reset []time.Duration
+	tuner.onIntervalChange = func(d time.Duration) { reset = append(reset, d) }
+	tuner.batch = 800
+
+	tuner.wrote(800, 2*time.Second, nil)
+	if tuner.batch != 400 || tuner.interval != 10*time.Second {
+		t.Errorf("after a slow insert batch = %d interval = %s, want 400 and 10s", tuner.batch, tuner.interval)
+	}
+	tuner.wrote(400, 10*time.Millisecond, errors.New("connection refused"))
+	tuner.wrote(400, 10*time.Millisecond, errors.New("connection refused"))
+	tuner.wrote(400, 10*time.Millisecond, errors.New("connection refused"))
+	if tuner.batch != 100 || tuner.interval != 20*time.Second {
+		t.Errorf("after failed inserts batch = %d interval = %s, want the floor of 100 and cap of 20s", tuner.batch, tuner.interval)
+	}
+	if len(reset) != 2 || reset[1] != 20*time.Second {
+		t.Errorf("interval changes = %v, want 10s then 20s", reset)
+	}
+
+	// A slow database keeps the interval from shrinking.
+	tuner.ticked()
+	if tuner.interval != 20*time.Second {
+		t.Errorf("interval after a quiet tick while unhealthy = %s, want 20s", tuner.interval)
+	}
+}
+
+func TestFlushTunerShortensIntervalWhenQuiet(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	tuner := newFlushTuner(100, 5*time.Second, func() time.Time { return now })
+	tuner.enabled = true
+
+	// 1000 events in 5s would fill ten batches per interval.
+	tuner.ticked()
+	for i := 0; i < 1000; i++ {
+		tuner.received()
+	}
+	now = now.Add(5 * time.Second)
+	tuner.ticked()
+	if tuner.rate != 200 || tuner.interval != 5*time.Second {
+		t.Errorf("busy tick rate = %v interval = %s, want 200/s and 5s", tuner.rate, tuner.interval)
+	}
+
+	// Two events per interval leave batches waiting for the timer.
+	for i := 0; i < 30; i++ {
+		tuner.received()
+		tuner.received()
+		now = now.Add(tuner.interval)
+		tuner.ticked()
+	}
+	if tuner.interval != 500*time.Millisecond {
+		t.Errorf("interval after a quiet period = %s, want the floor of 500ms", tuner.interval)
+	}
+}
+
+func TestFlushTunerDisabled(t *testing.T) {
+	tuner := newFlushTuner(100, 5*time.Second, time.Now)
+	tuner.wrote(100, 10*time.Millisecond, nil)
+	tuner.wrote(100, 5*time.Second, nil)
+	tuner.ticked()
+	tuner.ticked()
+	if tuner.batch != 100 || tuner.interval != 5*time.Second {
+		t.Errorf("disabled tuner changed to batch %d interval %s", tuner.batch, tuner.interval)
+	}
+}
+
+func TestLoggerAdaptiveFlushGrowsBatch(t *testing.T) {
+	f, db := newFakeDB(t)
+	l := NewLogger(db, 2, time.Hour)
+	l.EnableAdaptiveFlush()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.Run(ctx)
+		close(done)
+	}()
+	waitInserts := func(n int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for len(f.execCalls()) < n && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if got := len(f.execCalls()); got != n {
+			t.Fatalf("inserts = %d, want %d", got, n)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		l.Log(Event{Time: time.Now(), ClientID: "ip:1.1.1.1"})
+	}
+	waitInserts(1)
+	for i := 0; i < 4; i++ {
+		l.Log(Event{Time: time.Now(), ClientID: "ip:1.1.1.1"})
+	}
+	waitInserts(2)
+	cancel()
+	<-done
+
+	if args := len(f.execCalls()[1].args); args != 4*eventColumns {
+		t.Errorf("second insert has %d args, want a grown batch of 4 events", args)
+	}
+}
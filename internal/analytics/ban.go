@@ -0,0 +1,44 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// BanEvent is a ban set or lifted, as stored in the ban_events table.
+type BanEvent struct {
+	Time time.Time `json:"time"`
+	// Action is "ban" or "lift".
+	Action string `json:"action"`
+	// Client is the banned identity, such as ip:203.0.113.7, in the
+	// format of the events' client_id.
+	Client string `json:"client"`
+	Reason string `json:"reason"`
+	// DurationSeconds is how long a ban lasts; it is zero for lifts.
+	DurationSeconds int64 `json:"duration_seconds"`
+}
+
+// BanEvents records bans in the ban_events table, so they can be audited
+// and correlated with traffic after they expire.
+type BanEvents struct {
+	db *sql.DB
+}
+
+// NewBanEvents creates BanEvents writing to db.
+func NewBanEvents(db *sql.DB) *BanEvents {
+	return &BanEvents{db: db}
+}
+
+// Record stores e.
+func (b *BanEvents) Record(ctx context.Context, e BanEvent) error {
+	_, err := b.db.ExecContext(ctx, `
+		INSERT INTO ban_events (time, action, client, reason, duration_seconds)
+		VALUES ($1, $2, $3, $4, $5)`,
+		e.Time.UTC(), e.Action, e.Client, e.Reason, e.DurationSeconds)
+	if err != nil {
+		return fmt.Errorf("record ban of %s: %w", e.Client, err)
+	}
+	return nil
+}
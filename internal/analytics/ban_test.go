@@ -0,0 +1,25 @@
+package analytics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBanEventsRecord(t *testing.T) {
+	f, db := newFakeDB(t)
+
+	at := time.Date(2024, 3, 5, 10, 4, 31, 0, time.UTC)
+	e := BanEvent{Time: at, Action: "ban", Client: "10.0.0.1", Reason: "rate_limit", DurationSeconds: 3600}
+	if err := NewBanEvents(db).Record(context.Background(), e); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	calls := f.execCalls()
+	if len(calls) != 1 || !strings.Contains(calls[0].query, "INSERT INTO ban_events") {
+		t.Fatalf("Expected one insert, got %+v", calls)
+	}
+	if calls[0].args[2] != "10.0.0.1" || calls[0].args[4] != int64(3600) {
+		t.Errorf("Unexpected args %v", calls[0].args)
+	}
+}
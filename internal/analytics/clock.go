@@ -0,0 +1,74 @@
+package analytics
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// DefaultMaxClockSkew is how far ahead of the logger's clock an event may
+// be stamped before it is rejected.
+const DefaultMaxClockSkew = 5 * time.Second
+
+const (
+	// clockSyncInterval is how often the logger compares its clock with
+	// the database's.
+	clockSyncInterval = 5 * time.Minute
+	// clockTolerance is the offset below which the clocks are considered
+	// in sync; smaller differences are mostly query latency noise.
+	clockTolerance = 100 * time.Millisecond
+)
+
+// SetMaxClockSkew sets how far in the future an event may be stamped,
+// relative to the logger's clock, before Log rejects it. It must be
+// called before Run.
+func (l *Logger) SetMaxClockSkew(d time.Duration) {
+	if d > 0 {
+		l.maxSkew = d
+	}
+}
+
+// Skewed returns the number of events rejected because their timestamp
+// was too far ahead of the logger's clock.
+func (l *Logger) Skewed() int64 {
+	return l.skewed.Load()
+}
+
+// ClockOffset returns how far the database's clock is ahead of this
+// instance's, as last measured. Event timestamps are shifted by it so
+// that replicas with drifting clocks fill the same time buckets.
+func (l *Logger) ClockOffset() time.Duration {
+	return time.Duration(l.offset.Load())
+}
+
+// syncClock measures the offset of the database's clock, taking the
+// midpoint of the query as the local reference.
+func (l *Logger) syncClock(ctx context.Context) error {
+	start := l.now()
+	var dbNow time.Time
+	if err := l.db.QueryRowContext(ctx, "SELECT now()").Scan(&dbNow); err != nil {
+		return err
+	}
+	end := l.now()
+
+	offset := dbNow.Sub(start.Add(end.Sub(start) / 2))
+	if offset.Abs() < clockTolerance {
+		offset = 0
+	}
+	if previous := l.ClockOffset(); offset.Abs() > l.maxSkew && offset != previous {
+		log.Printf("⏰ Analytics database clock is %s off ours; correcting event timestamps", offset)
+	}
+	l.offset.Store(int64(offset))
+	return nil
+}
+
+// correct shifts an event to the database's clock. It reports false for
+// events stamped too far in the future, which would otherwise land in a
+// time bucket that has not happened yet.
+func (l *Logger) correct(e *Event) bool {
+	if e.Time.Sub(l.now()) > l.maxSkew {
+		return false
+	}
+	e.Time = e.Time.Add(l.ClockOffset()).UTC()
+	return true
+}
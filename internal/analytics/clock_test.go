@@ -0,0 +1,54 @@
+package analytics
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+func TestLoggerCorrectsClockOffset(t *testing.T) {
+	f, db := newFakeDB(t)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	f.respond("SELECT now()", []string{"now"}, []driver.Value{now.Add(2 * time.Second)})
+	l := NewLogger(db, 10, time.Hour)
+	l.now = func() time.Time { return now }
+
+	if err := l.syncClock(context.Background()); err != nil {
+		t.Fatalf("syncClock() error = %v", err)
+	}
+	if l.ClockOffset() != 2*time.Second {
+		t.Fatalf("Expected a 2s offset, got %s", l.ClockOffset())
+	}
+
+	l.Log(Event{Time: now, ClientID: "ip:1.1.1.1"})
+	if e := <-l.events; !e.Time.Equal(now.Add(2 * time.Second)) {
+		t.Errorf("Expected event moved to the database clock, got %v", e.Time)
+	}
+}
+
+func TestLoggerIgnoresSmallClockOffset(t *testing.T) {
+	f, db := newFakeDB(t)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	f.respond("SELECT now()", []string{"now"}, []driver.Value{now.Add(-20 * time.Millisecond)})
+	l := NewLogger(db, 10, time.Hour)
+	l.now = func() time.Time { return now }
+
+	if err := l.syncClock(context.Background()); err != nil || l.ClockOffset() != 0 {
+		t.Errorf("Expected latency-sized offset ignored, got %s, %v", l.ClockOffset(), err)
+	}
+}
+
+func TestLoggerRejectsFutureEvents(t *testing.T) {
+	_, db := newFakeDB(t)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLogger(db, 10, time.Hour)
+	l.now = func() time.Time { return now }
+	l.SetMaxClockSkew(time.Second)
+
+	l.Log(Event{Time: now.Add(time.Minute), ClientID: "ip:1.1.1.1"})
+	l.Log(Event{Time: now.Add(-time.Hour), ClientID: "ip:1.1.1.1"})
+	if l.Skewed() != 1 || len(l.events) != 1 {
+		t.Errorf("Expected only the future event rejected, got %d skewed and %d queued", l.Skewed(), len(l.events))
+	}
+}
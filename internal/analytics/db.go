@@ -0,0 +1,63 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+)
+
+// DriverName is the database/sql driver analytics connections are opened
+// with. It must be registered by a driver package import.
+const DriverName = "postgres"
+
+// ErrNoDriver is returned by Open when no driver is registered as
+// DriverName. Gatify has no dependencies, so builds that use a database
+// must import one, such as github.com/lib/pq.
+var ErrNoDriver = errors.New(`no Postgres driver compiled in: import a database/sql driver registered as "postgres"`)
+
+// DriverAvailable reports whether a driver is registered as DriverName.
+func DriverAvailable() bool {
+	return slices.Contains(sql.Drivers(), DriverName)
+}
+
+// PoolOptions sizes a connection pool. Zero values keep the database/sql
+// defaults.
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// Apply configures db's pool.
+func (o PoolOptions) Apply(db *sql.DB) {
+	if o.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(o.MaxOpenConns)
+	}
+	if o.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(o.MaxIdleConns)
+	}
+	if o.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(o.ConnMaxLifetime)
+	}
+}
+
+// Open connects to dsn with the given pool settings and verifies the
+// connection. The Logger and QueryService each get their own pool so that
+// dashboards cannot starve event writes, and reads can target a replica.
+func Open(ctx context.Context, dsn string, pool PoolOptions) (*sql.DB, error) {
+	if !DriverAvailable() {
+		return nil, ErrNoDriver
+	}
+	db, err := sql.Open(DriverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	pool.Apply(db)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
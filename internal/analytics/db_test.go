@@ -0,0 +1,32 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPoolOptionsApply(t *testing.T) {
+	_, db := newFakeDB(t)
+
+	PoolOptions{MaxOpenConns: 7, MaxIdleConns: 3, ConnMaxLifetime: time.Minute}.Apply(db)
+	if got := db.Stats().MaxOpenConnections; got != 7 {
+		t.Errorf("MaxOpenConnections = %d, want 7", got)
+	}
+
+	_, untouched := newFakeDB(t)
+	PoolOptions{}.Apply(untouched)
+	if got := untouched.Stats().MaxOpenConnections; got != 0 {
+		t.Errorf("Expected zero options to keep the unlimited default, got %d", got)
+	}
+}
+
+func TestOpenWithoutDriver(t *testing.T) {
+	if DriverAvailable() {
+		t.Skip("a postgres driver is compiled in")
+	}
+	if _, err := Open(context.Background(), "postgres://localhost/gatify", PoolOptions{}); !errors.Is(err, ErrNoDriver) {
+		t.Errorf("Open() error = %v, want ErrNoDriver", err)
+	}
+}
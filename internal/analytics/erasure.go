@@ -0,0 +1,188 @@
+package analytics
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Erasure modes.
+const (
+	// ErasureDelete deletes the client's events.
+	ErasureDelete = "delete"
+	// ErasureAnonymize keeps the client's events for aggregate statistics
+	// but replaces their client ID with AnonymizedClientID.
+	ErasureAnonymize = "anonymize"
+)
+
+// AnonymizedClientID replaces the client ID of anonymized events.
+const AnonymizedClientID = "anonymized"
+
+// Erasure job states.
+const (
+	ErasureRunning = "running"
+	ErasureDone    = "done"
+	ErasureFailed  = "failed"
+)
+
+// erasureTimeout bounds one erasure job.
+const erasureTimeout = 10 * time.Minute
+
+// erasureJobTTL is how long finished jobs can still be looked up.
+const erasureJobTTL = 24 * time.Hour
+
+// ErasureJob is the status of a client data erasure. It deliberately does
+// not record the client ID it erases.
+type ErasureJob struct {
+	ID     string `json:"id"`
+	Mode   string `json:"mode"`
+	Status string `json:"status"`
+	// Events, UsageRows and BanEvents count the raw events, daily usage
+	// rollups and ban_events rows erased, once the job is done.
+	Events     int64      `json:"events"`
+	UsageRows  int64      `json:"usage_rows"`
+	BanEvents  int64      `json:"ban_events"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Erasures erases clients' stored analytics in background jobs, to honour
+// data deletion requests, and keeps the jobs' status.
+type Erasures struct {
+	db   *sql.DB
+	mu   sync.Mutex
+	jobs map[string]*ErasureJob
+	wg   sync.WaitGroup
+}
+
+// NewErasures creates an Erasures working on db.
+func NewErasures(db *sql.DB) *Erasures {
+	return &Erasures{db: db, jobs: make(map[string]*ErasureJob)}
+}
+
+// Start begins erasing every stored event of clientID, from the raw
+// events, the daily usage rollups and the ban events, and returns the
+// running job.
+func (e *Erasures) Start(clientID, mode string) (ErasureJob, error) {
+	if clientID == "" {
+		return ErasureJob{}, errors.New("client ID is required")
+	}
+	if mode != ErasureDelete && mode != ErasureAnonymize {
+		return ErasureJob{}, fmt.Errorf("mode must be %q or %q", ErasureDelete, ErasureAnonymize)
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ErasureJob{}, err
+	}
+	now := time.Now().UTC()
+	job := &ErasureJob{ID: hex.EncodeToString(b), Mode: mode, Status: ErasureRunning, StartedAt: now}
+
+	e.mu.Lock()
+	for id, j := range e.jobs {
+		if j.FinishedAt != nil && now.Sub(*j.FinishedAt) > erasureJobTTL {
+			delete(e.jobs, id)
+		}
+	}
+	e.jobs[job.ID] = job
+	started := *job
+	e.mu.Unlock()
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), erasureTimeout)
+		defer cancel()
+		events, usage, bans, err := e.erase(ctx, clientID, mode)
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		finished := time.Now().UTC()
+		job.FinishedAt = &finished
+		if err != nil {
+			log.Printf("Analytics erasure %s failed: %v", job.ID, err)
+			job.Status = ErasureFailed
+			job.Error = "erasure failed"
+			return
+		}
+		job.Status = ErasureDone
+		job.Events, job.UsageRows, job.BanEvents = events, usage, bans
+		log.Printf("🧹 Analytics erasure %s: %s %d events and %d ban events, deleted %d usage rows", job.ID, mode, events, bans, usage)
+	}()
+	return started, nil
+}
+
+// Job returns the status of the job with the given ID.
+func (e *Erasures) Job(id string) (ErasureJob, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	job, ok := e.jobs[id]
+	if !ok {
+		return ErasureJob{}, false
+	}
+	return *job, true
+}
+
+// Wait blocks until every started job has finished.
+func (e *Erasures) Wait() {
+	e.wg.Wait()
+}
+
+// erase deletes or anonymizes the client's events and ban events and
+// deletes its usage rollups in one transaction. Rollups are deleted in
+// both modes: an anonymized client's traffic is rolled up again under
+// AnonymizedClientID. Bans recorded before they were keyed on identities
+// hold a bare IP address, which an ip: client ID matches as well.
+func (e *Erasures) erase(ctx context.Context, clientID, mode string) (events, usage, bans int64, err error) {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("erasure: %w", err)
+	}
+	defer tx.Rollback()
+
+	var res sql.Result
+	if mode == ErasureAnonymize {
+		res, err = tx.ExecContext(ctx, `UPDATE rate_limit_events SET client_id = $2 WHERE client_id = $1`, clientID, AnonymizedClientID)
+	} else {
+		res, err = tx.ExecContext(ctx, `DELETE FROM rate_limit_events WHERE client_id = $1`, clientID)
+	}
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("erasing events: %w", err)
+	}
+	if events, err = res.RowsAffected(); err != nil {
+		return 0, 0, 0, fmt.Errorf("erasing events: %w", err)
+	}
+
+	res, err = tx.ExecContext(ctx, `DELETE FROM client_daily_usage WHERE client_id = $1`, clientID)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("erasing usage: %w", err)
+	}
+	if usage, err = res.RowsAffected(); err != nil {
+		return 0, 0, 0, fmt.Errorf("erasing usage: %w", err)
+	}
+
+	legacy := strings.TrimPrefix(clientID, "ip:")
+	if mode == ErasureAnonymize {
+		res, err = tx.ExecContext(ctx, `UPDATE ban_events SET client = $3 WHERE client IN ($1, $2)`, clientID, legacy, AnonymizedClientID)
+	} else {
+		res, err = tx.ExecContext(ctx, `DELETE FROM ban_events WHERE client IN ($1, $2)`, clientID, legacy)
+	}
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("erasing ban events: %w", err)
+	}
+	if bans, err = res.RowsAffected(); err != nil {
+		return 0, 0, 0, fmt.Errorf("erasing ban events: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, 0, fmt.Errorf("erasure: %w", err)
+	}
+	return events, usage, bans, nil
+}
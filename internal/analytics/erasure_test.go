@@ -0,0 +1,75 @@
+package analytics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestErasuresDeleteClient(t *testing.T) {
+	f, db := newFakeDB(t)
+	e := NewErasures(db)
+
+	job, err := e.Start("ip:10.0.0.1", ErasureDelete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != ErasureRunning {
+		t.Errorf("Expected the job to start running, got %s", job.Status)
+	}
+	e.Wait()
+
+	done, ok := e.Job(job.ID)
+	if !ok || done.Status != ErasureDone || done.Events != 1 || done.UsageRows != 1 || done.BanEvents != 1 || done.FinishedAt == nil {
+		t.Fatalf("Unexpected finished job %+v", done)
+	}
+	calls := f.execCalls()
+	if len(calls) != 3 || !strings.HasPrefix(calls[0].query, "DELETE FROM rate_limit_events") ||
+		!strings.HasPrefix(calls[1].query, "DELETE FROM client_daily_usage") || calls[0].args[0] != "ip:10.0.0.1" {
+		t.Errorf("Unexpected statements %+v", calls)
+	}
+	// Ban events match the identity and the bare address older bans held.
+	if !strings.HasPrefix(calls[2].query, "DELETE FROM ban_events") || calls[2].args[0] != "ip:10.0.0.1" || calls[2].args[1] != "10.0.0.1" {
+		t.Errorf("Expected ban events erased, got %+v", calls[2])
+	}
+}
+
+func TestErasuresAnonymizeClient(t *testing.T) {
+	f, db := newFakeDB(t)
+	e := NewErasures(db)
+	if _, err := e.Start("ip:10.0.0.1", ErasureAnonymize); err != nil {
+		t.Fatal(err)
+	}
+	e.Wait()
+	calls := f.execCalls()
+	if !strings.HasPrefix(calls[0].query, "UPDATE rate_limit_events") || calls[0].args[1] != AnonymizedClientID {
+		t.Errorf("Expected events to be anonymized, got %+v", calls[0])
+	}
+	if !strings.HasPrefix(calls[2].query, "UPDATE ban_events") || calls[2].args[2] != AnonymizedClientID {
+		t.Errorf("Expected ban events to be anonymized, got %+v", calls[2])
+	}
+}
+
+func TestErasuresReportFailure(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.fail("client_daily_usage", errors.New("connection reset"))
+	e := NewErasures(db)
+	job, _ := e.Start("ip:10.0.0.1", ErasureDelete)
+	e.Wait()
+	if failed, _ := e.Job(job.ID); failed.Status != ErasureFailed || failed.Error == "" {
+		t.Errorf("Expected a failed job, got %+v", failed)
+	}
+}
+
+func TestErasuresValidate(t *testing.T) {
+	e := NewErasures(nil)
+	if _, err := e.Start("", ErasureDelete); err == nil {
+		t.Error("Expected an empty client ID to be rejected")
+	}
+	if _, err := e.Start("ip:10.0.0.1", "shred"); err == nil {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+	if _, ok := e.Job("missing"); ok {
+		t.Error("Expected an unknown job not to be found")
+	}
+}
@@ -0,0 +1,38 @@
+// Package analytics records request events and answers traffic queries
+package analytics
+
+import "time"
+
+// Event is a single request as stored in the rate_limit_events table.
+type Event struct {
+	Time     time.Time `json:"time"`
+	ClientID string    `json:"client_id"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	// Route is the path's rule template, used to group path statistics.
+	Route string `json:"route"`
+	// Agent is the client's user agent family, such as "bot".
+	Agent      string `json:"agent,omitempty"`
+	RuleID     string `json:"rule_id,omitempty"`
+	Allowed    bool   `json:"allowed"`
+	StatusCode int    `json:"status_code"`
+	// ResponseMS is how long the client waited for the whole response,
+	// including the time the backend took.
+	ResponseMS int64 `json:"response_ms"`
+	// BackendMS is the part of ResponseMS spent waiting for the backend's
+	// response headers, and zero for requests never forwarded.
+	BackendMS int64 `json:"backend_ms,omitempty"`
+	Bytes     int64 `json:"bytes"`
+	// ShadowAllowed is the dark-launched algorithm's decision, or nil when
+	// no candidate algorithm is being evaluated.
+	ShadowAllowed *bool `json:"shadow_allowed,omitempty"`
+	// BlockReason classifies rejections that were not rate limits, such
+	// as header violations. It is empty otherwise.
+	BlockReason string `json:"block_reason,omitempty"`
+	// IdentityError is why the client's bearer token was rejected, such
+	// as "expired", under a rule identifying clients by JWT claim.
+	IdentityError string `json:"identity_error,omitempty"`
+	// Dimensions are backend response headers captured by the matched
+	// rule, such as X-Tenant, stored as a JSON object.
+	Dimensions map[string]string `json:"dimensions,omitempty"`
+}
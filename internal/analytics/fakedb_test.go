@@ -0,0 +1,152 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDB is a scripted database/sql driver. Queries are answered by the
+// first response whose fragment appears in the SQL text, and every
+// statement is recorded for assertions.
+type fakeDB struct {
+	mu        sync.Mutex
+	responses []fakeResponse
+	execs     []fakeCall
+	queries   []fakeCall
+}
+
+type fakeResponse struct {
+	fragment string
+	columns  []string
+	rows     [][]driver.Value
+	err      error
+}
+
+type fakeCall struct {
+	query string
+	args  []driver.Value
+}
+
+func newFakeDB(t *testing.T) (*fakeDB, *sql.DB) {
+	t.Helper()
+	f := &fakeDB{}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { db.Close() })
+	return f, db
+}
+
+func (f *fakeDB) respond(fragment string, columns []string, rows ...[]driver.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, fakeResponse{fragment: fragment, columns: columns, rows: rows})
+}
+
+func (f *fakeDB) fail(fragment string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, fakeResponse{fragment: fragment, err: err})
+}
+
+// reset forgets every scripted response, e.g. to let a failing database
+// recover.
+func (f *fakeDB) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = nil
+}
+
+func (f *fakeDB) execCalls() []fakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeCall(nil), f.execs...)
+}
+
+func (f *fakeDB) lookup(query string) (fakeResponse, bool) {
+	for _, r := range f.responses {
+		if strings.Contains(query, r.fragment) {
+			return r, true
+		}
+	}
+	return fakeResponse{}, false
+}
+
+// Connect implements driver.Connector.
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: f}, nil }
+
+// Driver implements driver.Connector.
+func (f *fakeDB) Driver() driver.Driver { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fakeDB: use sql.OpenDB")
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fakeDB: prepared statements not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.execs = append(c.db.execs, fakeCall{query: query, args: values(args)})
+	if r, ok := c.db.lookup(query); ok && r.err != nil {
+		return nil, r.err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.queries = append(c.db.queries, fakeCall{query: query, args: values(args)})
+	r, ok := c.db.lookup(query)
+	if !ok {
+		return nil, errors.New("fakeDB: unexpected query: " + query)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &fakeRows{columns: r.columns, rows: r.rows}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	pos     int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	out := make([]driver.Value, len(args))
+	for i, a := range args {
+		out[i] = a.Value
+	}
+	return out
+}
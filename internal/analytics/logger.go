@@ -0,0 +1,332 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/tracing"
+)
+
+// Circuit breaker settings for database writes.
+const (
+	// breakerThreshold is how many consecutive failed flushes open the
+	// circuit.
+	breakerThreshold = 3
+	// breakerMinBackoff and breakerMaxBackoff bound how long an open
+	// circuit pauses writes; the pause doubles each time a probe fails.
+	breakerMinBackoff = 10 * time.Second
+	breakerMaxBackoff = 5 * time.Minute
+)
+
+// Logger batches events and writes them to the database in the background
+// so recording an event never blocks the request path.
+//
+// Repeated write failures open a circuit breaker: writes pause for a
+// backoff period instead of hammering a database that is down, and then a
+// single flush probes whether it is back. Batches that cannot be written
+// are kept in a bounded on-disk spill queue, when one is enabled, and
+// replayed once writes succeed again.
+//
+// With EnableAdaptiveFlush, the batch size and flush interval follow the
+// traffic and the database's latency instead of staying fixed, see
+// flushTuner.
+type Logger struct {
+	db            *sql.DB
+	batchSize     int
+	flushInterval time.Duration
+	events        chan Event
+	dropped       atomic.Int64
+
+	// Clock skew handling, see clock.go.
+	maxSkew time.Duration
+	offset  atomic.Int64
+	skewed  atomic.Int64
+
+	// Breaker state, owned by the Run goroutine.
+	failures  int
+	backoff   time.Duration
+	openUntil time.Time
+	open      atomic.Bool
+	spill     *spillQueue
+	now       func() time.Time
+	tuner     *flushTuner
+
+	tracer *tracing.Tracer
+}
+
+// NewLogger creates a Logger, capping batchSize at MaxBatchSize. Events
+// beyond the buffer capacity are dropped rather than applying
+// backpressure to the proxy.
+func NewLogger(db *sql.DB, batchSize int, flushInterval time.Duration) *Logger {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	batchSize = min(batchSize, MaxBatchSize)
+	if flushInterval <= 0 {
+		flushInterval = 5 * time.Second
+	}
+	l := &Logger{
+		db:            db,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		events:        make(chan Event, batchSize*maxBatchFactor),
+		maxSkew:       DefaultMaxClockSkew,
+		now:           time.Now,
+	}
+	l.tuner = newFlushTuner(batchSize, flushInterval, func() time.Time { return l.now() })
+	return l
+}
+
+// EnableAdaptiveFlush lets the batch size grow up to ten times the
+// configured one during bursts, and the flush interval range from a tenth
+// to four times the configured one, following the event rate and the
+// database's write latency. It must be called before Run.
+func (l *Logger) EnableAdaptiveFlush() {
+	l.tuner.enabled = true
+}
+
+// EnableSpill keeps batches that cannot be written in dir, up to maxBytes,
+// for replay once the database recovers. Batches left from a previous run
+// are replayed too. It must be called before Run.
+func (l *Logger) EnableSpill(dir string, maxBytes int64) error {
+	q, err := openSpillQueue(dir, maxBytes)
+	if err != nil {
+		return err
+	}
+	l.spill = q
+	return nil
+}
+
+// SetTracer records a span for every batch written to the database. It
+// must be called before Run.
+func (l *Logger) SetTracer(t *tracing.Tracer) {
+	l.tracer = t
+}
+
+// CircuitOpen reports whether database writes are currently paused after
+// repeated failures.
+func (l *Logger) CircuitOpen() bool {
+	return l.open.Load()
+}
+
+// Log queues an event for writing, first moving its timestamp to the
+// database's clock. Events stamped too far in the future are rejected.
+func (l *Logger) Log(e Event) {
+	if !l.correct(&e) {
+		l.skewed.Add(1)
+		return
+	}
+	select {
+	case l.events <- e:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of events discarded because the buffer was
+// full or because they could not be written nor spilled.
+func (l *Logger) Dropped() int64 {
+	return l.dropped.Load()
+}
+
+// Run writes batches until ctx is cancelled, then flushes what is left.
+func (l *Logger) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+	l.tuner.onIntervalChange = ticker.Reset
+	l.tuner.lastTick = l.tuner.now()
+	clockTicker := time.NewTicker(clockSyncInterval)
+	defer clockTicker.Stop()
+	if err := l.syncClock(ctx); err != nil {
+		log.Printf("Failed to compare clock with the analytics database: %v", err)
+	}
+
+	batch := make([]Event, 0, l.batchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		l.write(ctx, batch)
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case e := <-l.events:
+			batch = append(batch, e)
+			l.tuner.received()
+			if len(batch) >= l.tuner.batch {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			l.tuner.ticked()
+			flush(ctx)
+			l.replay(ctx)
+		case <-clockTicker.C:
+			if !l.CircuitOpen() {
+				if err := l.syncClock(ctx); err != nil {
+					log.Printf("Failed to compare clock with the analytics database: %v", err)
+				}
+			}
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			for l.drain(&batch) {
+				flush(shutdownCtx)
+			}
+			flush(shutdownCtx)
+			cancel()
+			return
+		}
+	}
+}
+
+// write inserts a batch unless the circuit is open, spilling it when it
+// cannot be written.
+func (l *Logger) write(ctx context.Context, batch []Event) {
+	if l.now().Before(l.openUntil) {
+		l.keep(batch)
+		return
+	}
+	if err := l.attempt(ctx, batch); err != nil {
+		log.Printf("Failed to write %d analytics events: %v", len(batch), err)
+		l.keep(batch)
+	}
+}
+
+// replay writes the oldest spilled batch back to the database while the
+// circuit is closed. One batch per tick keeps a recovering database from
+// being flooded.
+func (l *Logger) replay(ctx context.Context) {
+	if l.spill == nil || !l.spill.pending() || l.failures > 0 || l.now().Before(l.openUntil) {
+		return
+	}
+	events, err := l.spill.peek()
+	if err != nil {
+		log.Printf("Discarding unreadable spilled analytics batch: %v", err)
+		l.spill.pop()
+		return
+	}
+	if err := l.attempt(ctx, events); err != nil {
+		log.Printf("Failed to replay %d spilled analytics events: %v", len(events), err)
+		return
+	}
+	l.spill.pop()
+}
+
+// attempt inserts events and updates the circuit breaker with the result.
+func (l *Logger) attempt(ctx context.Context, events []Event) error {
+	start := time.Now()
+	err := l.insert(ctx, events)
+	l.tuner.wrote(len(events), time.Since(start), err)
+	if err == nil {
+		if l.open.Load() {
+			log.Printf("✅ Analytics database recovered, resuming writes")
+		}
+		l.failures = 0
+		l.backoff = 0
+		l.open.Store(false)
+		return nil
+	}
+
+	l.failures++
+	if l.failures >= breakerThreshold {
+		l.backoff = min(max(l.backoff*2, breakerMinBackoff), breakerMaxBackoff)
+		l.openUntil = l.now().Add(l.backoff)
+		l.open.Store(true)
+		log.Printf("🚨 Analytics database failing after %d attempts, pausing writes for %s: %v", l.failures, l.backoff, err)
+	}
+	return err
+}
+
+// keep spills a batch that could not be written, or drops it when no
+// spill queue is enabled or the queue is full.
+func (l *Logger) keep(batch []Event) {
+	if l.spill != nil {
+		ok, err := l.spill.push(batch)
+		if err != nil {
+			log.Printf("Failed to spill %d analytics events: %v", len(batch), err)
+		}
+		if ok {
+			return
+		}
+	}
+	l.dropped.Add(int64(len(batch)))
+}
+
+// drain moves buffered events into batch until the buffer is empty or
+// the batch holds MaxBatchSize events, reporting whether it filled up.
+func (l *Logger) drain(batch *[]Event) bool {
+	for len(*batch) < MaxBatchSize {
+		select {
+		case e := <-l.events:
+			*batch = append(*batch, e)
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+const eventColumns = 16
+
+// MaxBatchSize is the most events one insert can hold: PostgreSQL allows
+// 65535 bind parameters per statement, and every event takes
+// eventColumns of them.
+const MaxBatchSize = 65535 / eventColumns
+
+func (l *Logger) insert(ctx context.Context, events []Event) error {
+	ctx, span := l.tracer.StartRoot(ctx, "analytics insert")
+	defer span.End()
+	span.SetAttr("db.system", "postgresql")
+	span.SetAttr("gatify.events", len(events))
+
+	var sb strings.Builder
+	sb.WriteString(`INSERT INTO rate_limit_events
+		(time, client_id, method, path, route, rule_id, allowed, status_code, response_ms, bytes, shadow_allowed, block_reason, agent, dimensions, identity_error, backend_ms) VALUES `)
+
+	args := make([]any, 0, len(events)*eventColumns)
+	for i, e := range events {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("(")
+		for c := 1; c <= eventColumns; c++ {
+			if c > 1 {
+				sb.WriteString(", ")
+			}
+			fmt.Fprintf(&sb, "$%d", i*eventColumns+c)
+		}
+		sb.WriteString(")")
+		args = append(args, e.Time, e.ClientID, e.Method, e.Path, e.Route, e.RuleID, e.Allowed, e.StatusCode, e.ResponseMS, e.Bytes, nullBool(e.ShadowAllowed), e.BlockReason, e.Agent, nullJSON(e.Dimensions), e.IdentityError, e.BackendMS)
+	}
+
+	_, err := l.db.ExecContext(ctx, sb.String(), args...)
+	span.SetError(err)
+	return err
+}
+
+// nullJSON encodes dimensions for a JSONB column, or NULL when there are
+// none.
+func nullJSON(m map[string]string) sql.NullString {
+	if len(m) == 0 {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+func nullBool(b *bool) sql.NullBool {
+	if b == nil {
+		return sql.NullBool{}
+	}
+	return sql.NullBool{Bool: *b, Valid: true}
+}
@@ -0,0 +1,166 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggerFlushesOnBatchSize(t *testing.T) {
+	f, db := newFakeDB(t)
+	l := NewLogger(db, 2, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.Run(ctx)
+		close(done)
+	}()
+
+	now := time.Now()
+	l.Log(Event{Time: now, ClientID: "ip:1.1.1.1", Method: "GET", Path: "/a", Allowed: true, StatusCode: 200, ResponseMS: 40, BackendMS: 35})
+	l.Log(Event{Time: now, ClientID: "ip:2.2.2.2", Method: "GET", Path: "/b/7", Route: "/b/:id", RuleID: "r1", StatusCode: 429,
+		Dimensions: map[string]string{"X-Tenant": "acme"}, IdentityError: "expired"})
+
+	deadline := time.Now().Add(time.Second)
+	for len(f.execCalls()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	calls := f.execCalls()
+	if len(calls) != 1 {
+		t.Fatalf("Expected one batch insert, got %d", len(calls))
+	}
+	if !strings.Contains(calls[0].query, "($17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32)") {
+		t.Errorf("Expected two-row insert, got %s", calls[0].query)
+	}
+	if len(calls[0].args) != 32 || calls[0].args[20] != "/b/:id" || calls[0].args[21] != "r1" || calls[0].args[30] != "expired" {
+		t.Errorf("Unexpected insert args %v", calls[0].args)
+	}
+	if calls[0].args[13] != nil || calls[0].args[29] != `{"X-Tenant":"acme"}` {
+		t.Errorf("Expected dimensions as JSON or NULL, got %v and %v", calls[0].args[13], calls[0].args[29])
+	}
+	if calls[0].args[8] != int64(40) || calls[0].args[15] != int64(35) || calls[0].args[31] != int64(0) {
+		t.Errorf("Expected response and backend latency stored, got %v, %v and %v", calls[0].args[8], calls[0].args[15], calls[0].args[31])
+	}
+}
+
+func TestLoggerFlushesOnShutdown(t *testing.T) {
+	f, db := newFakeDB(t)
+	l := NewLogger(db, 100, time.Hour)
+
+	l.Log(Event{Time: time.Now(), ClientID: "ip:1.1.1.1"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l.Run(ctx)
+
+	if len(f.execCalls()) != 1 {
+		t.Errorf("Expected pending events flushed on shutdown, got %d inserts", len(f.execCalls()))
+	}
+}
+
+func TestLoggerSplitsShutdownFlushAtInsertLimit(t *testing.T) {
+	f, db := newFakeDB(t)
+	l := NewLogger(db, MaxBatchSize, time.Hour)
+
+	for i := 0; i < 2*MaxBatchSize+1; i++ {
+		l.Log(Event{Time: time.Now(), ClientID: "ip:1.1.1.1"})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l.Run(ctx)
+
+	var inserts, events int
+	for _, c := range f.execCalls() {
+		if !strings.Contains(c.query, "INSERT INTO rate_limit_events") {
+			continue
+		}
+		inserts++
+		events += len(c.args) / eventColumns
+		if len(c.args) > 65535 {
+			t.Errorf("Expected at most 65535 parameters per insert, got %d", len(c.args))
+		}
+	}
+	if inserts != 3 || events != 2*MaxBatchSize+1 {
+		t.Errorf("Expected 3 inserts of %d events, got %d of %d", 2*MaxBatchSize+1, inserts, events)
+	}
+}
+
+func TestLoggerDropsWhenFull(t *testing.T) {
+	_, db := newFakeDB(t)
+	l := NewLogger(db, 1, time.Hour)
+
+	for i := 0; i < 15; i++ {
+		l.Log(Event{})
+	}
+	if l.Dropped() != 5 {
+		t.Errorf("Expected 5 dropped events, got %d", l.Dropped())
+	}
+}
+
+func TestLoggerCircuitBreakerSpillsAndReplays(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.fail("INSERT INTO rate_limit_events", errors.New("connection refused"))
+	l := NewLogger(db, 10, time.Hour)
+	if err := l.EnableSpill(t.TempDir(), 1<<20); err != nil {
+		t.Fatalf("EnableSpill() error = %v", err)
+	}
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < breakerThreshold; i++ {
+		l.write(ctx, []Event{{ClientID: "ip:1.1.1.1"}})
+	}
+	if !l.CircuitOpen() {
+		t.Fatal("Expected the circuit to open after repeated failures")
+	}
+
+	// While open, batches go straight to disk.
+	l.write(ctx, []Event{{ClientID: "ip:2.2.2.2"}, {ClientID: "ip:3.3.3.3"}})
+	if got := len(f.execCalls()); got != breakerThreshold {
+		t.Errorf("Expected no writes while open, got %d attempts", got)
+	}
+	if len(l.spill.files) != breakerThreshold+1 || l.Dropped() != 0 {
+		t.Fatalf("Expected every batch spilled, got %d files and %d dropped", len(l.spill.files), l.Dropped())
+	}
+
+	// After the backoff a probe succeeds and spilled batches are replayed
+	// one per tick.
+	f.reset()
+	now = now.Add(breakerMinBackoff)
+	l.write(ctx, []Event{{ClientID: "ip:4.4.4.4"}})
+	if l.CircuitOpen() {
+		t.Fatal("Expected a successful probe to close the circuit")
+	}
+	for l.spill.pending() {
+		l.replay(ctx)
+	}
+	calls := f.execCalls()
+	if len(calls) != breakerThreshold+1+breakerThreshold+1 {
+		t.Errorf("Expected the probe and every spilled batch written, got %d writes", len(calls))
+	}
+	if last := calls[len(calls)-1]; len(last.args) != 2*eventColumns {
+		t.Errorf("Expected the two-event batch replayed last, got %d args", len(last.args))
+	}
+}
+
+func TestLoggerDropsWhenSpillFull(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.fail("INSERT INTO rate_limit_events", errors.New("connection refused"))
+	l := NewLogger(db, 10, time.Hour)
+	if err := l.EnableSpill(t.TempDir(), 10); err != nil {
+		t.Fatalf("EnableSpill() error = %v", err)
+	}
+
+	l.write(context.Background(), []Event{{ClientID: "ip:1.1.1.1"}})
+	if l.Dropped() != 1 {
+		t.Errorf("Expected the batch dropped once the spill queue is full, got %d", l.Dropped())
+	}
+}
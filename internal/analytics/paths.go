@@ -0,0 +1,150 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MaxTopPaths bounds how many paths TopPaths lists in each ranking.
+const MaxTopPaths = 100
+
+// PathTraffic is the traffic on one route: a matched rule's pattern, or
+// the raw path of requests no rule matched.
+type PathTraffic struct {
+	Route     string  `json:"route"`
+	Total     int64   `json:"total"`
+	Blocked   int64   `json:"blocked"`
+	Clients   int64   `json:"clients"`
+	BlockRate float64 `json:"block_rate"`
+}
+
+// TopPaths ranks routes by traffic since a point in time.
+type TopPaths struct {
+	Since         time.Time     `json:"since"`
+	MostRequested []PathTraffic `json:"most_requested"`
+	// MostBlocked leaves out routes that had no request blocked.
+	MostBlocked []PathTraffic `json:"most_blocked"`
+}
+
+// MethodTraffic is the traffic of one HTTP method on a route.
+type MethodTraffic struct {
+	Method  string `json:"method"`
+	Total   int64  `json:"total"`
+	Blocked int64  `json:"blocked"`
+}
+
+// PathStats summarizes the traffic on one route.
+type PathStats struct {
+	Route           string    `json:"route"`
+	Since           time.Time `json:"since"`
+	TotalRequests   int64     `json:"total_requests"`
+	BlockedRequests int64     `json:"blocked_requests"`
+	UniqueClients   int64     `json:"unique_clients"`
+	BlockRate       float64   `json:"block_rate"`
+	// PeakRPM is the most requests the route received within a minute,
+	// for sizing limits and backends.
+	PeakRPM int64           `json:"peak_rpm"`
+	Methods []MethodTraffic `json:"methods"`
+}
+
+// TopPaths returns the limit routes with the most requests, and the limit
+// with the most blocked requests, since the given time.
+func (q *QueryService) TopPaths(ctx context.Context, since time.Time, limit int) (TopPaths, error) {
+	out := TopPaths{Since: since}
+	var err error
+	if out.MostRequested, err = q.topPaths(ctx, since, limit, "total"); err != nil {
+		return TopPaths{}, err
+	}
+	if out.MostBlocked, err = q.topPaths(ctx, since, limit, "blocked"); err != nil {
+		return TopPaths{}, err
+	}
+	return out, nil
+}
+
+// topPaths ranks routes by the total or blocked column of the query.
+// Ranked by blocked, routes without blocked requests are left out.
+func (q *QueryService) topPaths(ctx context.Context, since time.Time, limit int, by string) ([]PathTraffic, error) {
+	having := ""
+	if by == "blocked" {
+		having = "HAVING count(*) FILTER (WHERE NOT allowed) > 0"
+	}
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT route,
+		       count(*) AS total,
+		       count(*) FILTER (WHERE NOT allowed) AS blocked,
+		       count(DISTINCT client_id)
+		FROM rate_limit_events
+		WHERE time >= $1 AND (time < $3 OR $3 IS NULL)
+		GROUP BY route `+having+`
+		ORDER BY `+by+` DESC, route
+		LIMIT $2`, since, limit, asOf(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("top paths query: %w", err)
+	}
+	defer rows.Close()
+
+	out := []PathTraffic{}
+	for rows.Next() {
+		var p PathTraffic
+		if err := rows.Scan(&p.Route, &p.Total, &p.Blocked, &p.Clients); err != nil {
+			return nil, fmt.Errorf("top paths scan: %w", err)
+		}
+		p.BlockRate = blockRate(p.Blocked, p.Total)
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// PathStats returns totals, the busiest minute and a breakdown by method
+// for the traffic on route since the given time.
+func (q *QueryService) PathStats(ctx context.Context, route string, since time.Time) (PathStats, error) {
+	out := PathStats{Route: route, Since: since}
+	err := q.db.QueryRowContext(ctx, `
+		SELECT count(*),
+		       count(*) FILTER (WHERE NOT allowed),
+		       count(DISTINCT client_id)
+		FROM rate_limit_events
+		WHERE route = $1 AND time >= $2 AND (time < $3 OR $3 IS NULL)`, route, since, asOf(ctx),
+	).Scan(&out.TotalRequests, &out.BlockedRequests, &out.UniqueClients)
+	if err != nil {
+		return PathStats{}, fmt.Errorf("path stats query: %w", err)
+	}
+	out.BlockRate = blockRate(out.BlockedRequests, out.TotalRequests)
+
+	err = q.db.QueryRowContext(ctx, `
+		SELECT coalesce(max(n), 0)
+		FROM (
+			SELECT count(*) AS n
+			FROM rate_limit_events
+			WHERE route = $1 AND time >= $2 AND (time < $3 OR $3 IS NULL)
+			GROUP BY time_bucket('1 minute', time)
+		) per_minute`, route, since, asOf(ctx),
+	).Scan(&out.PeakRPM)
+	if err != nil {
+		return PathStats{}, fmt.Errorf("path peak query: %w", err)
+	}
+
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT method,
+		       count(*) AS total,
+		       count(*) FILTER (WHERE NOT allowed)
+		FROM rate_limit_events
+		WHERE route = $1 AND time >= $2 AND (time < $3 OR $3 IS NULL)
+		GROUP BY method
+		ORDER BY total DESC, method`, route, since, asOf(ctx))
+	if err != nil {
+		return PathStats{}, fmt.Errorf("path methods query: %w", err)
+	}
+	defer rows.Close()
+
+	out.Methods = []MethodTraffic{}
+	for rows.Next() {
+		var m MethodTraffic
+		if err := rows.Scan(&m.Method, &m.Total, &m.Blocked); err != nil {
+			return PathStats{}, fmt.Errorf("path methods scan: %w", err)
+		}
+		out.Methods = append(out.Methods, m)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,75 @@
+package analytics
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryServiceTopPaths(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.respond("ORDER BY total DESC", []string{"route", "total", "blocked", "clients"},
+		[]driver.Value{"/api/users/:id", int64(900), int64(9), int64(40)},
+		[]driver.Value{"/health", int64(300), int64(0), int64(2)},
+	)
+	f.respond("ORDER BY blocked DESC", []string{"route", "total", "blocked", "clients"},
+		[]driver.Value{"/login", int64(200), int64(50), int64(7)},
+	)
+
+	since := time.Now().Add(-time.Hour)
+	got, err := NewQueryService(db).TopPaths(context.Background(), since, 5)
+	if err != nil {
+		t.Fatalf("TopPaths() error = %v", err)
+	}
+	if !got.Since.Equal(since) || len(got.MostRequested) != 2 || got.MostRequested[0].Route != "/api/users/:id" || got.MostRequested[0].BlockRate != 0.01 {
+		t.Errorf("Unexpected most requested %+v", got)
+	}
+	if len(got.MostBlocked) != 1 || got.MostBlocked[0].Route != "/login" || got.MostBlocked[0].BlockRate != 0.25 {
+		t.Errorf("Unexpected most blocked %+v", got.MostBlocked)
+	}
+	if strings.Contains(f.queries[0].query, "HAVING") || !strings.Contains(f.queries[1].query, "HAVING") {
+		t.Errorf("Expected only the blocked ranking to skip routes without blocks")
+	}
+	if f.queries[0].args[1] != int64(5) {
+		t.Errorf("Expected the limit as an argument, got %v", f.queries[0].args)
+	}
+}
+
+func TestQueryServicePathStats(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.respond("max(n)", []string{"peak"}, []driver.Value{int64(120)})
+	f.respond("GROUP BY method", []string{"method", "total", "blocked"},
+		[]driver.Value{"GET", int64(80), int64(4)},
+		[]driver.Value{"POST", int64(20), int64(6)},
+	)
+	f.respond("WHERE route = $1", []string{"total", "blocked", "clients"}, []driver.Value{int64(100), int64(10), int64(12)})
+
+	got, err := NewQueryService(db).PathStats(context.Background(), "/api/users/:id", time.Now())
+	if err != nil {
+		t.Fatalf("PathStats() error = %v", err)
+	}
+	if got.Route != "/api/users/:id" || got.TotalRequests != 100 || got.UniqueClients != 12 || got.BlockRate != 0.1 || got.PeakRPM != 120 {
+		t.Errorf("Unexpected path stats %+v", got)
+	}
+	if len(got.Methods) != 2 || got.Methods[1].Method != "POST" || got.Methods[1].Blocked != 6 {
+		t.Errorf("Unexpected methods %+v", got.Methods)
+	}
+	for _, q := range f.queries {
+		if q.args[0] != "/api/users/:id" {
+			t.Errorf("Expected the route as the first argument, got %v", q.args)
+		}
+	}
+}
+
+func TestQueryServicePathStatsError(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.fail("max(n)", errors.New("connection reset"))
+	f.respond("WHERE route = $1", []string{"total", "blocked", "clients"}, []driver.Value{int64(1), int64(0), int64(1)})
+
+	if _, err := NewQueryService(db).PathStats(context.Background(), "/login", time.Now()); err == nil {
+		t.Error("Expected query error to propagate")
+	}
+}
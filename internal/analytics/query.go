@@ -0,0 +1,491 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Overview summarizes all traffic since a point in time.
+type Overview struct {
+	Since           time.Time `json:"since"`
+	TotalRequests   int64     `json:"total_requests"`
+	BlockedRequests int64     `json:"blocked_requests"`
+	UniqueClients   int64     `json:"unique_clients"`
+	BlockRate       float64   `json:"block_rate"`
+}
+
+// RuleStats summarizes the traffic a single rule matched.
+type RuleStats struct {
+	RuleID          string    `json:"rule_id"`
+	Since           time.Time `json:"since"`
+	TotalRequests   int64     `json:"total_requests"`
+	BlockedRequests int64     `json:"blocked_requests"`
+	UniqueClients   int64     `json:"unique_clients"`
+	BlockRate       float64   `json:"block_rate"`
+	// ShadowBlocked counts the requests a shadow rule forwarded but
+	// would have rejected.
+	ShadowBlocked int64 `json:"shadow_blocked"`
+}
+
+// TimelinePoint is the traffic within one time bucket.
+type TimelinePoint struct {
+	Bucket  time.Time `json:"bucket"`
+	Total   int64     `json:"total"`
+	Blocked int64     `json:"blocked"`
+}
+
+// ShadowComparison compares the enforced algorithm's decisions with those
+// of a dark-launched candidate on the same requests.
+type ShadowComparison struct {
+	Since time.Time `json:"since"`
+	// Evaluated counts requests the candidate produced a decision for.
+	Evaluated int64 `json:"evaluated"`
+	Agreed    int64 `json:"agreed"`
+	// OnlyEnforcedBlocked counts requests the enforced algorithm blocked
+	// but the candidate would have allowed, and OnlyShadowBlocked the
+	// reverse.
+	OnlyEnforcedBlocked int64   `json:"only_enforced_blocked"`
+	OnlyShadowBlocked   int64   `json:"only_shadow_blocked"`
+	AgreementRate       float64 `json:"agreement_rate"`
+}
+
+// AgentTraffic is the traffic from one user agent family.
+type AgentTraffic struct {
+	Agent     string  `json:"agent"`
+	Total     int64   `json:"total"`
+	Blocked   int64   `json:"blocked"`
+	Clients   int64   `json:"clients"`
+	BlockRate float64 `json:"block_rate"`
+}
+
+// DimensionTraffic is the traffic carrying one value of a captured
+// response header.
+type DimensionTraffic struct {
+	Value     string  `json:"value"`
+	Total     int64   `json:"total"`
+	Blocked   int64   `json:"blocked"`
+	Clients   int64   `json:"clients"`
+	BlockRate float64 `json:"block_rate"`
+}
+
+// MaxDimensionValues bounds the values DimensionBreakdown returns, since
+// a captured header may have many.
+const MaxDimensionValues = 100
+
+// ClientTraffic is one client's share of traffic.
+type ClientTraffic struct {
+	ClientID string `json:"client_id"`
+	Total    int64  `json:"total"`
+	Blocked  int64  `json:"blocked"`
+}
+
+// ClientStats summarizes one client's traffic.
+type ClientStats struct {
+	ClientID        string    `json:"client_id"`
+	Since           time.Time `json:"since"`
+	TotalRequests   int64     `json:"total_requests"`
+	BlockedRequests int64     `json:"blocked_requests"`
+	BlockRate       float64   `json:"block_rate"`
+	// TopPaths are the client's MaxClientPaths busiest routes.
+	TopPaths []PathTraffic `json:"top_paths"`
+	// Rules are the rules the client's requests matched, busiest first,
+	// with an empty RuleID for the default limit.
+	Rules []RuleTraffic `json:"rules"`
+}
+
+// MaxClientPaths bounds the routes ClientStats lists.
+const MaxClientPaths = 10
+
+// RuleTraffic is the traffic one rule matched.
+type RuleTraffic struct {
+	RuleID  string `json:"rule_id"`
+	Total   int64  `json:"total"`
+	Blocked int64  `json:"blocked"`
+}
+
+// RouteTraffic is the traffic no rule matched on one method and route,
+// with how hard individual clients pushed it.
+type RouteTraffic struct {
+	Method  string `json:"method"`
+	Route   string `json:"route"`
+	Total   int64  `json:"total"`
+	Clients int64  `json:"clients"`
+	// P95ClientRPM and PeakClientRPM summarize the requests one client
+	// sent to the route within a single minute.
+	P95ClientRPM  float64 `json:"p95_client_rpm"`
+	PeakClientRPM int64   `json:"peak_client_rpm"`
+}
+
+// ClientRate is one client's busiest minute on a route no rule matched.
+type ClientRate struct {
+	ClientID string `json:"client_id"`
+	Method   string `json:"method"`
+	Route    string `json:"route"`
+	PeakRPM  int64  `json:"peak_rpm"`
+	Total    int64  `json:"total"`
+}
+
+// unprotectedMinutes counts, per client and minute, the requests no rule
+// matched since $1.
+const unprotectedMinutes = `
+		SELECT method, route, client_id,
+		       time_bucket('1 minute', time) AS minute,
+		       count(*) AS n
+		FROM rate_limit_events
+		WHERE time >= $1 AND rule_id = ''
+		GROUP BY method, route, client_id, minute`
+
+// QueryService answers analytics queries over rate_limit_events.
+type QueryService struct {
+	db *sql.DB
+}
+
+// NewQueryService creates a QueryService reading from db.
+func NewQueryService(db *sql.DB) *QueryService {
+	return &QueryService{db: db}
+}
+
+// Overview returns totals for all traffic since the given time.
+func (q *QueryService) Overview(ctx context.Context, since time.Time) (Overview, error) {
+	out := Overview{Since: since}
+	err := q.db.QueryRowContext(ctx, `
+		SELECT count(*),
+		       count(*) FILTER (WHERE NOT allowed),
+		       count(DISTINCT client_id)
+		FROM rate_limit_events
+		WHERE time >= $1 AND (time < $2 OR $2 IS NULL)`, since, asOf(ctx),
+	).Scan(&out.TotalRequests, &out.BlockedRequests, &out.UniqueClients)
+	if err != nil {
+		return Overview{}, fmt.Errorf("overview query: %w", err)
+	}
+	out.BlockRate = blockRate(out.BlockedRequests, out.TotalRequests)
+	return out, nil
+}
+
+// RuleStats returns totals for the traffic matched by ruleID.
+func (q *QueryService) RuleStats(ctx context.Context, ruleID string, since time.Time) (RuleStats, error) {
+	out := RuleStats{RuleID: ruleID, Since: since}
+	err := q.db.QueryRowContext(ctx, `
+		SELECT count(*),
+		       count(*) FILTER (WHERE NOT allowed),
+		       count(DISTINCT client_id),
+		       count(*) FILTER (WHERE allowed AND block_reason = 'shadow')
+		FROM rate_limit_events
+		WHERE rule_id = $1 AND time >= $2 AND (time < $3 OR $3 IS NULL)`, ruleID, since, asOf(ctx),
+	).Scan(&out.TotalRequests, &out.BlockedRequests, &out.UniqueClients, &out.ShadowBlocked)
+	if err != nil {
+		return RuleStats{}, fmt.Errorf("rule stats query: %w", err)
+	}
+	out.BlockRate = blockRate(out.BlockedRequests, out.TotalRequests)
+	return out, nil
+}
+
+// Timeline returns request counts grouped into buckets of the given size.
+// Buckets made of whole minutes or hours are summed from the traffic
+// rollups up to the last settled hour, and from raw events after it.
+func (q *QueryService) Timeline(ctx context.Context, since time.Time, bucket time.Duration) ([]TimelinePoint, error) {
+	settled := time.Now().UTC().Truncate(time.Hour).Add(-rollupSettled)
+	table := rollupTable(bucket)
+	if table == "" || !since.Before(settled) {
+		table, settled = TrafficMinuteTable, since
+	}
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT time_bucket(make_interval(secs => $1), t) AS bucket,
+		       sum(total)::bigint,
+		       sum(blocked)::bigint
+		FROM (
+			SELECT bucket AS t, requests AS total, blocked
+			FROM `+table+`
+			WHERE bucket >= $2 AND bucket < $4 AND (bucket < $3 OR $3 IS NULL)
+			UNION ALL
+			SELECT time, 1, CASE WHEN allowed THEN 0 ELSE 1 END
+			FROM rate_limit_events
+			WHERE time >= greatest($2, $4) AND (time < $3 OR $3 IS NULL)
+		) traffic
+		GROUP BY bucket
+		ORDER BY bucket`, bucket.Seconds(), since, asOf(ctx), settled)
+	if err != nil {
+		return nil, fmt.Errorf("timeline query: %w", err)
+	}
+	defer rows.Close()
+
+	points := []TimelinePoint{}
+	for rows.Next() {
+		var p TimelinePoint
+		if err := rows.Scan(&p.Bucket, &p.Total, &p.Blocked); err != nil {
+			return nil, fmt.Errorf("timeline scan: %w", err)
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// ShadowComparison returns how often the dark-launched algorithm agreed
+// with the enforced one since the given time.
+func (q *QueryService) ShadowComparison(ctx context.Context, since time.Time) (ShadowComparison, error) {
+	out := ShadowComparison{Since: since}
+	err := q.db.QueryRowContext(ctx, `
+		SELECT count(*),
+		       count(*) FILTER (WHERE allowed = shadow_allowed),
+		       count(*) FILTER (WHERE NOT allowed AND shadow_allowed),
+		       count(*) FILTER (WHERE allowed AND NOT shadow_allowed)
+		FROM rate_limit_events
+		WHERE shadow_allowed IS NOT NULL AND time >= $1 AND (time < $2 OR $2 IS NULL)`, since, asOf(ctx),
+	).Scan(&out.Evaluated, &out.Agreed, &out.OnlyEnforcedBlocked, &out.OnlyShadowBlocked)
+	if err != nil {
+		return ShadowComparison{}, fmt.Errorf("shadow comparison query: %w", err)
+	}
+	if out.Evaluated > 0 {
+		out.AgreementRate = float64(out.Agreed) / float64(out.Evaluated)
+	}
+	return out, nil
+}
+
+// AgentBreakdown returns the traffic of each user agent family since the
+// given time, busiest first. Events logged before agents were recorded
+// are reported as "unknown".
+func (q *QueryService) AgentBreakdown(ctx context.Context, since time.Time) ([]AgentTraffic, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT coalesce(nullif(agent, ''), 'unknown') AS family,
+		       count(*) AS total,
+		       count(*) FILTER (WHERE NOT allowed),
+		       count(DISTINCT client_id)
+		FROM rate_limit_events
+		WHERE time >= $1 AND (time < $2 OR $2 IS NULL)
+		GROUP BY family
+		ORDER BY total DESC, family`, since, asOf(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("agent breakdown query: %w", err)
+	}
+	defer rows.Close()
+
+	out := []AgentTraffic{}
+	for rows.Next() {
+		var a AgentTraffic
+		if err := rows.Scan(&a.Agent, &a.Total, &a.Blocked, &a.Clients); err != nil {
+			return nil, fmt.Errorf("agent breakdown scan: %w", err)
+		}
+		a.BlockRate = blockRate(a.Blocked, a.Total)
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// DimensionBreakdown returns the traffic of each value of the captured
+// response header name since the given time, busiest first. Events
+// without the header are left out.
+func (q *QueryService) DimensionBreakdown(ctx context.Context, name string, since time.Time) ([]DimensionTraffic, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT dimensions ->> $1 AS value,
+		       count(*) AS total,
+		       count(*) FILTER (WHERE NOT allowed),
+		       count(DISTINCT client_id)
+		FROM rate_limit_events
+		WHERE time >= $2 AND (time < $3 OR $3 IS NULL) AND dimensions ->> $1 IS NOT NULL
+		GROUP BY value
+		ORDER BY total DESC, value
+		LIMIT $4`, name, since, asOf(ctx), MaxDimensionValues)
+	if err != nil {
+		return nil, fmt.Errorf("dimension breakdown query: %w", err)
+	}
+	defer rows.Close()
+
+	out := []DimensionTraffic{}
+	for rows.Next() {
+		var d DimensionTraffic
+		if err := rows.Scan(&d.Value, &d.Total, &d.Blocked, &d.Clients); err != nil {
+			return nil, fmt.Errorf("dimension breakdown scan: %w", err)
+		}
+		d.BlockRate = blockRate(d.Blocked, d.Total)
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// TopClients returns the limit clients with the most requests since the
+// given time.
+func (q *QueryService) TopClients(ctx context.Context, since time.Time, limit int) ([]ClientTraffic, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT client_id,
+		       count(*) AS total,
+		       count(*) FILTER (WHERE NOT allowed)
+		FROM rate_limit_events
+		WHERE time >= $1 AND (time < $3 OR $3 IS NULL)
+		GROUP BY client_id
+		ORDER BY total DESC, client_id
+		LIMIT $2`, since, limit, asOf(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("top clients query: %w", err)
+	}
+	defer rows.Close()
+
+	out := []ClientTraffic{}
+	for rows.Next() {
+		var c ClientTraffic
+		if err := rows.Scan(&c.ClientID, &c.Total, &c.Blocked); err != nil {
+			return nil, fmt.Errorf("top clients scan: %w", err)
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// ClientStats returns clientID's totals, busiest routes and the rules
+// its requests matched since the given time.
+func (q *QueryService) ClientStats(ctx context.Context, clientID string, since time.Time) (ClientStats, error) {
+	out := ClientStats{ClientID: clientID, Since: since}
+	err := q.db.QueryRowContext(ctx, `
+		SELECT count(*),
+		       count(*) FILTER (WHERE NOT allowed)
+		FROM rate_limit_events
+		WHERE client_id = $1 AND time >= $2 AND (time < $3 OR $3 IS NULL)`, clientID, since, asOf(ctx),
+	).Scan(&out.TotalRequests, &out.BlockedRequests)
+	if err != nil {
+		return ClientStats{}, fmt.Errorf("client stats query: %w", err)
+	}
+	out.BlockRate = blockRate(out.BlockedRequests, out.TotalRequests)
+
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT route,
+		       count(*) AS total,
+		       count(*) FILTER (WHERE NOT allowed)
+		FROM rate_limit_events
+		WHERE client_id = $1 AND time >= $2 AND (time < $3 OR $3 IS NULL)
+		GROUP BY route
+		ORDER BY total DESC, route
+		LIMIT $4`, clientID, since, asOf(ctx), MaxClientPaths)
+	if err != nil {
+		return ClientStats{}, fmt.Errorf("client paths query: %w", err)
+	}
+	defer rows.Close()
+	out.TopPaths = []PathTraffic{}
+	for rows.Next() {
+		p := PathTraffic{Clients: 1}
+		if err := rows.Scan(&p.Route, &p.Total, &p.Blocked); err != nil {
+			return ClientStats{}, fmt.Errorf("client paths scan: %w", err)
+		}
+		p.BlockRate = blockRate(p.Blocked, p.Total)
+		out.TopPaths = append(out.TopPaths, p)
+	}
+	if err := rows.Err(); err != nil {
+		return ClientStats{}, err
+	}
+
+	rows, err = q.db.QueryContext(ctx, `
+		SELECT rule_id,
+		       count(*) AS total,
+		       count(*) FILTER (WHERE NOT allowed)
+		FROM rate_limit_events
+		WHERE client_id = $1 AND time >= $2 AND (time < $3 OR $3 IS NULL)
+		GROUP BY rule_id
+		ORDER BY total DESC, rule_id`, clientID, since, asOf(ctx))
+	if err != nil {
+		return ClientStats{}, fmt.Errorf("client rules query: %w", err)
+	}
+	defer rows.Close()
+	out.Rules = []RuleTraffic{}
+	for rows.Next() {
+		var r RuleTraffic
+		if err := rows.Scan(&r.RuleID, &r.Total, &r.Blocked); err != nil {
+			return ClientStats{}, fmt.Errorf("client rules scan: %w", err)
+		}
+		out.Rules = append(out.Rules, r)
+	}
+	return out, rows.Err()
+}
+
+// TopRules returns the limit rules that matched the most requests since
+// the given time. Requests no rule matched are not included.
+func (q *QueryService) TopRules(ctx context.Context, since time.Time, limit int) ([]RuleTraffic, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT rule_id,
+		       count(*) AS total,
+		       count(*) FILTER (WHERE NOT allowed)
+		FROM rate_limit_events
+		WHERE time >= $1 AND (time < $3 OR $3 IS NULL) AND rule_id <> ''
+		GROUP BY rule_id
+		ORDER BY total DESC, rule_id
+		LIMIT $2`, since, limit, asOf(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("top rules query: %w", err)
+	}
+	defer rows.Close()
+
+	out := []RuleTraffic{}
+	for rows.Next() {
+		var r RuleTraffic
+		if err := rows.Scan(&r.RuleID, &r.Total, &r.Blocked); err != nil {
+			return nil, fmt.Errorf("top rules scan: %w", err)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// UnprotectedRoutes returns the limit busiest routes that no rule matched
+// since the given time, skipping those with fewer than minRequests.
+func (q *QueryService) UnprotectedRoutes(ctx context.Context, since time.Time, minRequests int64, limit int) ([]RouteTraffic, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT method, route,
+		       sum(n) AS total,
+		       count(DISTINCT client_id),
+		       percentile_cont(0.95) WITHIN GROUP (ORDER BY n),
+		       max(n)
+		FROM (`+unprotectedMinutes+`) per_minute
+		GROUP BY method, route
+		HAVING sum(n) >= $2
+		ORDER BY total DESC, route, method
+		LIMIT $3`, since, minRequests, limit)
+	if err != nil {
+		return nil, fmt.Errorf("unprotected routes query: %w", err)
+	}
+	defer rows.Close()
+
+	out := []RouteTraffic{}
+	for rows.Next() {
+		var r RouteTraffic
+		if err := rows.Scan(&r.Method, &r.Route, &r.Total, &r.Clients, &r.P95ClientRPM, &r.PeakClientRPM); err != nil {
+			return nil, fmt.Errorf("unprotected routes scan: %w", err)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// HeavyClients returns up to limit clients that sent at least minRPM
+// requests within a minute to a route no rule matched since the given
+// time, busiest first.
+func (q *QueryService) HeavyClients(ctx context.Context, since time.Time, minRPM int64, limit int) ([]ClientRate, error) {
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT client_id, method, route,
+		       max(n) AS peak,
+		       sum(n)
+		FROM (`+unprotectedMinutes+`) per_minute
+		GROUP BY client_id, method, route
+		HAVING max(n) >= $2
+		ORDER BY peak DESC, client_id, route
+		LIMIT $3`, since, minRPM, limit)
+	if err != nil {
+		return nil, fmt.Errorf("heavy clients query: %w", err)
+	}
+	defer rows.Close()
+
+	out := []ClientRate{}
+	for rows.Next() {
+		var c ClientRate
+		if err := rows.Scan(&c.ClientID, &c.Method, &c.Route, &c.PeakRPM, &c.Total); err != nil {
+			return nil, fmt.Errorf("heavy clients scan: %w", err)
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func blockRate(blocked, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(blocked) / float64(total)
+}
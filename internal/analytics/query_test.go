@@ -0,0 +1,234 @@
+package analytics
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryServiceOverview(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.respond("FROM rate_limit_events", []string{"total", "blocked", "clients"}, []driver.Value{int64(200), int64(50), int64(7)})
+
+	since := time.Now().Add(-time.Hour)
+	got, err := NewQueryService(db).Overview(context.Background(), since)
+	if err != nil {
+		t.Fatalf("Overview() error = %v", err)
+	}
+	if got.TotalRequests != 200 || got.BlockedRequests != 50 || got.UniqueClients != 7 {
+		t.Errorf("Unexpected overview %+v", got)
+	}
+	if got.BlockRate != 0.25 {
+		t.Errorf("Expected block rate 0.25, got %v", got.BlockRate)
+	}
+}
+
+func TestQueryServiceRuleStats(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.respond("rule_id = $1", []string{"total", "blocked", "clients", "shadow"}, []driver.Value{int64(0), int64(0), int64(0), int64(3)})
+
+	got, err := NewQueryService(db).RuleStats(context.Background(), "r1", time.Now())
+	if err != nil {
+		t.Fatalf("RuleStats() error = %v", err)
+	}
+	if got.RuleID != "r1" || got.BlockRate != 0 || got.ShadowBlocked != 3 {
+		t.Errorf("Unexpected rule stats %+v", got)
+	}
+	if f.queries[0].args[0] != "r1" {
+		t.Errorf("Expected rule ID argument, got %v", f.queries[0].args)
+	}
+}
+
+func TestQueryServiceShadowComparison(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.respond("shadow_allowed IS NOT NULL", []string{"evaluated", "agreed", "enforced", "shadow"},
+		[]driver.Value{int64(100), int64(90), int64(4), int64(6)})
+
+	got, err := NewQueryService(db).ShadowComparison(context.Background(), time.Now())
+	if err != nil {
+		t.Fatalf("ShadowComparison() error = %v", err)
+	}
+	if got.Evaluated != 100 || got.OnlyEnforcedBlocked != 4 || got.OnlyShadowBlocked != 6 || got.AgreementRate != 0.9 {
+		t.Errorf("Unexpected comparison %+v", got)
+	}
+}
+
+func TestQueryServiceTimeline(t *testing.T) {
+	f, db := newFakeDB(t)
+	b1 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	f.respond("time_bucket", []string{"bucket", "total", "blocked"},
+		[]driver.Value{b1, int64(10), int64(1)},
+		[]driver.Value{b1.Add(time.Hour), int64(20), int64(4)},
+	)
+
+	points, err := NewQueryService(db).Timeline(context.Background(), b1, time.Hour)
+	if err != nil {
+		t.Fatalf("Timeline() error = %v", err)
+	}
+	if len(points) != 2 || points[1].Total != 20 || points[1].Blocked != 4 {
+		t.Errorf("Unexpected timeline %+v", points)
+	}
+	if f.queries[0].args[0] != float64(3600) {
+		t.Errorf("Expected bucket size in seconds, got %v", f.queries[0].args[0])
+	}
+}
+
+func TestQueryServiceTopClientsAndRules(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.respond("GROUP BY client_id", []string{"client_id", "total", "blocked"},
+		[]driver.Value{"ip:1.1.1.1", int64(90), int64(30)},
+		[]driver.Value{"ip:2.2.2.2", int64(10), int64(0)},
+	)
+	f.respond("GROUP BY rule_id", []string{"rule_id", "total", "blocked"},
+		[]driver.Value{"login", int64(40), int64(12)},
+	)
+	q := NewQueryService(db)
+
+	clients, err := q.TopClients(context.Background(), time.Now(), 5)
+	if err != nil {
+		t.Fatalf("TopClients() error = %v", err)
+	}
+	if len(clients) != 2 || clients[0].ClientID != "ip:1.1.1.1" || clients[0].Blocked != 30 {
+		t.Errorf("Unexpected top clients %+v", clients)
+	}
+	if f.queries[0].args[1] != int64(5) {
+		t.Errorf("Expected the limit as an argument, got %v", f.queries[0].args)
+	}
+
+	ruleTraffic, err := q.TopRules(context.Background(), time.Now(), 5)
+	if err != nil {
+		t.Fatalf("TopRules() error = %v", err)
+	}
+	if len(ruleTraffic) != 1 || ruleTraffic[0].RuleID != "login" || ruleTraffic[0].Total != 40 {
+		t.Errorf("Unexpected top rules %+v", ruleTraffic)
+	}
+}
+
+func TestQueryServiceClientStats(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.respond("GROUP BY route", []string{"route", "total", "blocked"},
+		[]driver.Value{"/search", int64(30), int64(10)},
+	)
+	f.respond("GROUP BY rule_id", []string{"rule_id", "total", "blocked"},
+		[]driver.Value{"search", int64(30), int64(10)},
+		[]driver.Value{"", int64(10), int64(0)},
+	)
+	f.respond("WHERE client_id = $1", []string{"total", "blocked"}, []driver.Value{int64(40), int64(10)})
+
+	got, err := NewQueryService(db).ClientStats(context.Background(), "ip:1.1.1.1", time.Now())
+	if err != nil {
+		t.Fatalf("ClientStats() error = %v", err)
+	}
+	if got.ClientID != "ip:1.1.1.1" || got.TotalRequests != 40 || got.BlockRate != 0.25 {
+		t.Errorf("Unexpected client stats %+v", got)
+	}
+	if len(got.TopPaths) != 1 || got.TopPaths[0].Route != "/search" || got.TopPaths[0].Blocked != 10 {
+		t.Errorf("Unexpected top paths %+v", got.TopPaths)
+	}
+	if len(got.Rules) != 2 || got.Rules[1].RuleID != "" {
+		t.Errorf("Unexpected rules %+v", got.Rules)
+	}
+	for _, q := range f.queries {
+		if q.args[0] != "ip:1.1.1.1" {
+			t.Errorf("Expected the client as the first argument, got %v", q.args)
+		}
+	}
+}
+
+func TestQueryServiceUnprotectedTraffic(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.respond("GROUP BY method, route\n", []string{"method", "route", "total", "clients", "p95", "peak"},
+		[]driver.Value{"GET", "/search", int64(500), int64(12), float64(40.5), int64(90)},
+	)
+	f.respond("GROUP BY client_id, method, route", []string{"client_id", "method", "route", "peak", "total"},
+		[]driver.Value{"ip:1.1.1.1", "GET", "/search", int64(90), int64(300)},
+	)
+	q := NewQueryService(db)
+
+	routes, err := q.UnprotectedRoutes(context.Background(), time.Now(), 100, 20)
+	if err != nil {
+		t.Fatalf("UnprotectedRoutes() error = %v", err)
+	}
+	if len(routes) != 1 || routes[0].Route != "/search" || routes[0].P95ClientRPM != 40.5 || routes[0].PeakClientRPM != 90 {
+		t.Errorf("Unexpected routes %+v", routes)
+	}
+	if !strings.Contains(f.queries[0].query, "rule_id = ''") || f.queries[0].args[1] != int64(100) {
+		t.Errorf("Expected unmatched traffic above the minimum, got %s %v", f.queries[0].query, f.queries[0].args)
+	}
+
+	clients, err := q.HeavyClients(context.Background(), time.Now(), 60, 50)
+	if err != nil {
+		t.Fatalf("HeavyClients() error = %v", err)
+	}
+	if len(clients) != 1 || clients[0].ClientID != "ip:1.1.1.1" || clients[0].PeakRPM != 90 {
+		t.Errorf("Unexpected heavy clients %+v", clients)
+	}
+}
+
+func TestQueryServiceAgentBreakdown(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.respond("GROUP BY family", []string{"family", "total", "blocked", "clients"},
+		[]driver.Value{"browser", int64(80), int64(2), int64(30)},
+		[]driver.Value{"bot", int64(40), int64(10), int64(5)},
+	)
+
+	got, err := NewQueryService(db).AgentBreakdown(context.Background(), time.Now())
+	if err != nil {
+		t.Fatalf("AgentBreakdown() error = %v", err)
+	}
+	if len(got) != 2 || got[1].Agent != "bot" || got[1].Clients != 5 || got[1].BlockRate != 0.25 {
+		t.Errorf("Unexpected breakdown %+v", got)
+	}
+}
+
+func TestQueryServiceDimensionBreakdown(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.respond("dimensions ->>", []string{"value", "total", "blocked", "clients"},
+		[]driver.Value{"acme", int64(60), int64(6), int64(4)},
+		[]driver.Value{"globex", int64(20), int64(0), int64(2)},
+	)
+
+	got, err := NewQueryService(db).DimensionBreakdown(context.Background(), "X-Tenant", time.Now())
+	if err != nil {
+		t.Fatalf("DimensionBreakdown() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Value != "acme" || got[0].BlockRate != 0.1 || got[1].Clients != 2 {
+		t.Errorf("Unexpected breakdown %+v", got)
+	}
+	if f.queries[0].args[0] != "X-Tenant" || f.queries[0].args[3] != int64(MaxDimensionValues) {
+		t.Errorf("Unexpected query args %v", f.queries[0].args)
+	}
+}
+
+func TestQueryServiceError(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.fail("rate_limit_events", errors.New("connection refused"))
+
+	if _, err := NewQueryService(db).Overview(context.Background(), time.Now()); err == nil {
+		t.Error("Expected query error to propagate")
+	}
+}
+
+func TestQueryServiceAsOf(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.respond("FROM rate_limit_events", []string{"total", "blocked", "clients"}, []driver.Value{int64(1), int64(0), int64(1)})
+	q := NewQueryService(db)
+	since := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	asOf := since.Add(time.Hour)
+
+	if _, err := q.Overview(context.Background(), since); err != nil {
+		t.Fatalf("Overview() error = %v", err)
+	}
+	if _, err := q.Overview(AsOf(context.Background(), asOf), since); err != nil {
+		t.Fatalf("Overview() error = %v", err)
+	}
+	if got := f.queries[0].args[1]; got != nil {
+		t.Errorf("Expected no upper bound without AsOf, got %v", got)
+	}
+	if got, _ := f.queries[1].args[1].(time.Time); !got.Equal(asOf) {
+		t.Errorf("Expected upper bound %v, got %v", asOf, f.queries[1].args[1])
+	}
+}
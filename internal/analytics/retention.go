@@ -0,0 +1,106 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// MinRetention is the shortest retention window allowed. The usage rollup
+// recomputes yesterday and today from raw events, and the traffic rollups
+// the last few hours, so younger events must survive until then.
+const MinRetention = 72 * time.Hour
+
+// prunedTables are the per-minute and per-event tables purged along with
+// rate_limit_events, by their time column. The hourly traffic rollup and
+// daily usage rollup are small and back billing and long-range charts, so
+// they are kept.
+var prunedTables = []struct{ table, column string }{
+	{TrafficMinuteTable, "bucket"},
+	{"slo_budget_1m", "bucket"},
+	{"ban_events", "time"},
+}
+
+// PurgeResult reports what a purge deleted.
+type PurgeResult struct {
+	Before time.Time `json:"before"`
+	// Chunks counts the TimescaleDB chunks of rate_limit_events dropped
+	// whole; their events are not counted in Events.
+	Chunks int64 `json:"chunks"`
+	Events int64 `json:"events"`
+	// Rows counts the rows deleted from the minute rollups and ban events.
+	Rows int64 `json:"rows"`
+}
+
+// Retention deletes analytics older than a retention window, so the
+// events table does not grow forever.
+type Retention struct {
+	db     *sql.DB
+	window time.Duration
+	now    func() time.Time
+}
+
+// NewRetention creates a Retention keeping window of analytics in db.
+func NewRetention(db *sql.DB, window time.Duration) *Retention {
+	return &Retention{db: db, window: window, now: time.Now}
+}
+
+// Window returns how long analytics are kept.
+func (r *Retention) Window() time.Duration {
+	return r.window
+}
+
+// Purge deletes analytics older than the retention window. It suits
+// leader.Elector.Schedule.
+func (r *Retention) Purge(ctx context.Context) error {
+	res, err := r.PurgeBefore(ctx, r.now().Add(-r.window))
+	if err != nil {
+		return err
+	}
+	if res.Chunks > 0 || res.Events > 0 || res.Rows > 0 {
+		log.Printf("🧹 Analytics retention: dropped %d chunks, deleted %d events and %d rollup rows older than %s",
+			res.Chunks, res.Events, res.Rows, res.Before.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// PurgeBefore deletes analytics recorded before before. On a TimescaleDB
+// hypertable, chunks entirely older are dropped, which is far cheaper than
+// deleting their rows; the remaining old events are deleted.
+func (r *Retention) PurgeBefore(ctx context.Context, before time.Time) (PurgeResult, error) {
+	res := PurgeResult{Before: before.UTC()}
+	// drop_chunks fails on plain PostgreSQL, where the DELETE below does
+	// all the work.
+	if err := r.db.QueryRowContext(ctx,
+		`SELECT count(*) FROM drop_chunks('rate_limit_events', older_than => $1::timestamptz)`, res.Before,
+	).Scan(&res.Chunks); err != nil {
+		res.Chunks = 0
+	}
+
+	var err error
+	if res.Events, err = r.delete(ctx, "rate_limit_events", "time", res.Before); err != nil {
+		return res, err
+	}
+	for _, t := range prunedTables {
+		n, err := r.delete(ctx, t.table, t.column, res.Before)
+		if err != nil {
+			return res, err
+		}
+		res.Rows += n
+	}
+	return res, nil
+}
+
+func (r *Retention) delete(ctx context.Context, table, column string, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM `+table+` WHERE `+column+` < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("purge %s: %w", table, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("purge %s: %w", table, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,67 @@
+package analytics
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetentionPurgeDropsChunksAndDeletes(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.respond("drop_chunks('rate_limit_events'", []string{"count"}, []driver.Value{int64(3)})
+
+	now := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	r := NewRetention(db, 30*24*time.Hour)
+	r.now = func() time.Time { return now }
+	res, err := r.PurgeBefore(context.Background(), now.Add(-r.Window()))
+	if err != nil {
+		t.Fatalf("PurgeBefore() error = %v", err)
+	}
+	cutoff := now.Add(-30 * 24 * time.Hour)
+	if !res.Before.Equal(cutoff) || res.Chunks != 3 || res.Events != 1 || res.Rows != 3 {
+		t.Errorf("PurgeBefore() = %+v", res)
+	}
+
+	calls := f.execCalls()
+	want := []string{"rate_limit_events WHERE time", "traffic_rollup_1m WHERE bucket", "slo_budget_1m WHERE bucket", "ban_events WHERE time"}
+	if len(calls) != len(want) {
+		t.Fatalf("Expected %d deletes, got %+v", len(want), calls)
+	}
+	for i, c := range calls {
+		if !strings.Contains(c.query, "DELETE FROM "+want[i]) || c.args[0] != cutoff {
+			t.Errorf("delete %d = %s %v, want %s before %v", i, c.query, c.args, want[i], cutoff)
+		}
+	}
+	for _, table := range []string{"traffic_rollup_1h", "client_daily_usage"} {
+		for _, c := range calls {
+			if strings.Contains(c.query, table) {
+				t.Errorf("%s purged: %s", table, c.query)
+			}
+		}
+	}
+}
+
+func TestRetentionPurgeWithoutTimescale(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.fail("drop_chunks", errors.New(`function drop_chunks(unknown, timestamp with time zone) does not exist`))
+
+	if err := NewRetention(db, MinRetention).Purge(context.Background()); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if calls := f.execCalls(); len(calls) != 4 || !strings.Contains(calls[0].query, "DELETE FROM rate_limit_events") {
+		t.Errorf("Expected plain deletes, got %+v", calls)
+	}
+}
+
+func TestRetentionPurgeFails(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.fail("DELETE FROM slo_budget_1m", errors.New("connection reset"))
+
+	err := NewRetention(db, MinRetention).Purge(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "slo_budget_1m") {
+		t.Errorf("Purge() error = %v, want the failing table", err)
+	}
+}
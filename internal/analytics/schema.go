@@ -0,0 +1,91 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// schema creates the events, rollup, SLO budget and ban tables and their
+// indexes. It is idempotent.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS rate_limit_events (
+		time        TIMESTAMPTZ NOT NULL,
+		client_id   TEXT        NOT NULL,
+		method      TEXT        NOT NULL,
+		path        TEXT        NOT NULL,
+		rule_id     TEXT        NOT NULL DEFAULT '',
+		allowed     BOOLEAN     NOT NULL,
+		status_code INTEGER     NOT NULL,
+		response_ms BIGINT      NOT NULL DEFAULT 0
+	)`,
+	`ALTER TABLE rate_limit_events ADD COLUMN IF NOT EXISTS shadow_allowed BOOLEAN`,
+	`ALTER TABLE rate_limit_events ADD COLUMN IF NOT EXISTS bytes BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE rate_limit_events ADD COLUMN IF NOT EXISTS route TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE rate_limit_events ADD COLUMN IF NOT EXISTS block_reason TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE rate_limit_events ADD COLUMN IF NOT EXISTS agent TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE rate_limit_events ADD COLUMN IF NOT EXISTS dimensions JSONB`,
+	`ALTER TABLE rate_limit_events ADD COLUMN IF NOT EXISTS identity_error TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE rate_limit_events ADD COLUMN IF NOT EXISTS backend_ms BIGINT NOT NULL DEFAULT 0`,
+	`CREATE INDEX IF NOT EXISTS rate_limit_events_rule_time_idx ON rate_limit_events (rule_id, time DESC)`,
+	`CREATE INDEX IF NOT EXISTS rate_limit_events_client_time_idx ON rate_limit_events (client_id, time DESC)`,
+	`CREATE TABLE IF NOT EXISTS client_daily_usage (
+		day       DATE   NOT NULL,
+		client_id TEXT   NOT NULL,
+		requests  BIGINT NOT NULL,
+		blocked   BIGINT NOT NULL,
+		bytes     BIGINT NOT NULL,
+		PRIMARY KEY (day, client_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS traffic_rollup_1m (
+		bucket      TIMESTAMPTZ NOT NULL,
+		rule_id     TEXT        NOT NULL,
+		requests    BIGINT      NOT NULL,
+		blocked     BIGINT      NOT NULL,
+		bytes       BIGINT      NOT NULL,
+		response_ms BIGINT      NOT NULL,
+		PRIMARY KEY (bucket, rule_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS traffic_rollup_1h (
+		bucket      TIMESTAMPTZ NOT NULL,
+		rule_id     TEXT        NOT NULL,
+		requests    BIGINT      NOT NULL,
+		blocked     BIGINT      NOT NULL,
+		bytes       BIGINT      NOT NULL,
+		response_ms BIGINT      NOT NULL,
+		PRIMARY KEY (bucket, rule_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS slo_budget_1m (
+		bucket TIMESTAMPTZ NOT NULL,
+		slo    TEXT        NOT NULL,
+		total  BIGINT      NOT NULL,
+		slow   BIGINT      NOT NULL,
+		PRIMARY KEY (bucket, slo)
+	)`,
+	`CREATE TABLE IF NOT EXISTS ban_events (
+		time             TIMESTAMPTZ NOT NULL,
+		action           TEXT        NOT NULL,
+		client           TEXT        NOT NULL,
+		reason           TEXT        NOT NULL DEFAULT '',
+		duration_seconds BIGINT      NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS ban_events_client_time_idx ON ban_events (client, time DESC)`,
+}
+
+// hypertable converts the events table into a TimescaleDB hypertable.
+const hypertable = `SELECT create_hypertable('rate_limit_events', 'time', if_not_exists => TRUE)`
+
+// Migrate creates the analytics schema. The hypertable conversion is best
+// effort so plain PostgreSQL keeps working without TimescaleDB.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("analytics migration: %w", err)
+		}
+	}
+	if _, err := db.ExecContext(ctx, hypertable); err != nil {
+		log.Printf("⚠️  TimescaleDB hypertable unavailable, using a plain table: %v", err)
+	}
+	return nil
+}
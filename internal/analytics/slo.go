@@ -0,0 +1,50 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SLOBudgets keeps the per-minute request counts latency objectives are
+// measured against in the slo_budget_1m table, shared by every gateway
+// instance. It implements slo.Store.
+type SLOBudgets struct {
+	db *sql.DB
+}
+
+// NewSLOBudgets creates SLOBudgets writing to db.
+func NewSLOBudgets(db *sql.DB) *SLOBudgets {
+	return &SLOBudgets{db: db}
+}
+
+// AddSLO adds total requests, slow of which missed the objective's
+// threshold, to the minute starting at bucket.
+func (b *SLOBudgets) AddSLO(ctx context.Context, name string, bucket time.Time, total, slow int64) error {
+	_, err := b.db.ExecContext(ctx, `
+		INSERT INTO slo_budget_1m (bucket, slo, total, slow)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (bucket, slo) DO UPDATE
+		SET total = slo_budget_1m.total + EXCLUDED.total,
+		    slow  = slo_budget_1m.slow + EXCLUDED.slow`,
+		bucket.UTC().Truncate(time.Minute), name, total, slow)
+	if err != nil {
+		return fmt.Errorf("slo budget for %s: %w", name, err)
+	}
+	return nil
+}
+
+// SLOTotals sums an objective's counts from the minute containing since
+// onwards.
+func (b *SLOBudgets) SLOTotals(ctx context.Context, name string, since time.Time) (total, slow int64, err error) {
+	err = b.db.QueryRowContext(ctx, `
+		SELECT COALESCE(sum(total), 0), COALESCE(sum(slow), 0)
+		FROM slo_budget_1m
+		WHERE slo = $1 AND bucket >= $2`,
+		name, since.UTC().Truncate(time.Minute)).Scan(&total, &slow)
+	if err != nil {
+		return 0, 0, fmt.Errorf("slo budget query for %s: %w", name, err)
+	}
+	return total, slow, nil
+}
@@ -0,0 +1,38 @@
+package analytics
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSLOBudgetsAddSLO(t *testing.T) {
+	f, db := newFakeDB(t)
+
+	at := time.Date(2024, 3, 5, 10, 4, 31, 0, time.UTC)
+	if err := NewSLOBudgets(db).AddSLO(context.Background(), "api", at, 10, 2); err != nil {
+		t.Fatalf("AddSLO() error = %v", err)
+	}
+	calls := f.execCalls()
+	if len(calls) != 1 || !strings.Contains(calls[0].query, "INSERT INTO slo_budget_1m") {
+		t.Fatalf("Expected one upsert, got %+v", calls)
+	}
+	if calls[0].args[0] != at.Truncate(time.Minute) || calls[0].args[1] != "api" {
+		t.Errorf("Unexpected args %v", calls[0].args)
+	}
+}
+
+func TestSLOBudgetsTotals(t *testing.T) {
+	f, db := newFakeDB(t)
+	f.respond("FROM slo_budget_1m", []string{"total", "slow"}, []driver.Value{int64(500), int64(7)})
+
+	total, slow, err := NewSLOBudgets(db).SLOTotals(context.Background(), "api", time.Now())
+	if err != nil {
+		t.Fatalf("SLOTotals() error = %v", err)
+	}
+	if total != 500 || slow != 7 {
+		t.Errorf("SLOTotals() = %d, %d, want 500, 7", total, slow)
+	}
+}
@@ -0,0 +1,23 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type asOfKey struct{}
+
+// AsOf returns a context under which QueryService counts only events
+// before t. Dashboards pass the same t to every panel so that overview,
+// timeline and top lists agree even while new events keep arriving.
+func AsOf(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, asOfKey{}, t)
+}
+
+// asOf returns the upper time bound set by AsOf, or NULL, which leaves
+// queries unbounded.
+func asOf(ctx context.Context) sql.NullTime {
+	t, ok := ctx.Value(asOfKey{}).(time.Time)
+	return sql.NullTime{Time: t, Valid: ok}
+}
@@ -0,0 +1,110 @@
+package analytics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// spillSuffix marks the batch files of a spill queue.
+const spillSuffix = ".jsonl"
+
+// spillQueue keeps batches that could not be written to the database as
+// JSON-lines files in a directory, oldest first, up to maxBytes in total.
+// Files left over from a previous run are picked up and replayed.
+type spillQueue struct {
+	dir      string
+	maxBytes int64
+	size     int64
+	files    []string
+	seq      int
+}
+
+func openSpillQueue(dir string, maxBytes int64) (*spillQueue, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create spill directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read spill directory: %w", err)
+	}
+	q := &spillQueue{dir: dir, maxBytes: maxBytes}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), spillSuffix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		q.files = append(q.files, e.Name())
+		q.size += info.Size()
+	}
+	// Names start with a zero-padded timestamp, so they sort oldest first.
+	sort.Strings(q.files)
+	return q, nil
+}
+
+// push writes a batch to a new file. It reports false, writing nothing,
+// when the batch would take the queue past its size bound.
+func (q *spillQueue) push(events []Event) (bool, error) {
+	var buf strings.Builder
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return false, fmt.Errorf("encode spilled event: %w", err)
+		}
+	}
+	if q.size+int64(buf.Len()) > q.maxBytes {
+		return false, nil
+	}
+
+	q.seq++
+	name := fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), q.seq%1000000, spillSuffix)
+	if err := os.WriteFile(filepath.Join(q.dir, name), []byte(buf.String()), 0o600); err != nil {
+		return false, fmt.Errorf("write spill file: %w", err)
+	}
+	q.files = append(q.files, name)
+	q.size += int64(buf.Len())
+	return true, nil
+}
+
+func (q *spillQueue) pending() bool {
+	return len(q.files) > 0
+}
+
+// peek reads the oldest batch without removing it.
+func (q *spillQueue) peek() ([]Event, error) {
+	f, err := os.Open(filepath.Join(q.dir, q.files[0]))
+	if err != nil {
+		return nil, fmt.Errorf("read spill file: %w", err)
+	}
+	defer f.Close()
+
+	var events []Event
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for sc.Scan() {
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("decode spill file %s: %w", q.files[0], err)
+		}
+		events = append(events, e)
+	}
+	return events, sc.Err()
+}
+
+// pop removes the oldest batch.
+func (q *spillQueue) pop() {
+	path := filepath.Join(q.dir, q.files[0])
+	if info, err := os.Stat(path); err == nil {
+		q.size -= info.Size()
+	}
+	_ = os.Remove(path)
+	q.files = q.files[1:]
+}
@@ -0,0 +1,27 @@
+package analytics
+
+import "testing"
+
+func TestSpillQueueSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	q, err := openSpillQueue(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("openSpillQueue() error = %v", err)
+	}
+	if ok, err := q.push([]Event{{ClientID: "ip:1.1.1.1", Path: "/a"}}); !ok || err != nil {
+		t.Fatalf("push() = %v, %v", ok, err)
+	}
+
+	reopened, err := openSpillQueue(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("openSpillQueue() error = %v", err)
+	}
+	events, err := reopened.peek()
+	if err != nil || len(events) != 1 || events[0].Path != "/a" {
+		t.Fatalf("peek() = %+v, %v", events, err)
+	}
+	reopened.pop()
+	if reopened.pending() || reopened.size != 0 {
+		t.Errorf("Expected an empty queue after pop, size %d", reopened.size)
+	}
+}
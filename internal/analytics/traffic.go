@@ -0,0 +1,134 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Traffic rollup tables. Each row holds one rule's traffic in one bucket;
+// requests no rule matched are rolled up under the empty rule ID. They are
+// kept for dashboards such as Grafana to chart long windows without
+// scanning rate_limit_events, and back Timeline for windows older than
+// rollupSettled.
+const (
+	TrafficMinuteTable = "traffic_rollup_1m"
+	TrafficHourTable   = "traffic_rollup_1h"
+)
+
+// rollupSettled is how far back from the start of the current hour
+// rollups are trusted to be complete. Timeline reads raw events after
+// that point, so refreshes may lag by up to an hour without gaps.
+const rollupSettled = time.Hour
+
+// rollupLookback is how much history before the current hour every
+// refresh recomputes, so events flushed late still land in their bucket.
+const rollupLookback = 2 * time.Hour
+
+// TrafficRollup aggregates rate_limit_events into the minute and hour
+// rollup tables.
+type TrafficRollup struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// NewTrafficRollup creates a TrafficRollup writing to db.
+func NewTrafficRollup(db *sql.DB) *TrafficRollup {
+	return &TrafficRollup{db: db, now: time.Now}
+}
+
+// Refresh recomputes the rollups of the last few hours. When the minute
+// table is empty, or was last refreshed before that, it first catches up
+// from the oldest event or the last rolled up bucket.
+func (r *TrafficRollup) Refresh(ctx context.Context) error {
+	now := r.now().UTC()
+	from := now.Truncate(time.Hour).Add(-rollupLookback)
+
+	var last, first sql.NullTime
+	if err := r.db.QueryRowContext(ctx, `SELECT max(bucket) FROM `+TrafficMinuteTable).Scan(&last); err != nil {
+		return fmt.Errorf("traffic rollup watermark: %w", err)
+	}
+	switch {
+	case last.Valid:
+		if last.Time.Before(from) {
+			from = last.Time.UTC().Truncate(time.Hour)
+		}
+	default:
+		if err := r.db.QueryRowContext(ctx, `SELECT min(time) FROM rate_limit_events`).Scan(&first); err != nil {
+			return fmt.Errorf("traffic rollup backfill: %w", err)
+		}
+		if first.Valid && first.Time.Before(from) {
+			from = first.Time.UTC().Truncate(time.Hour)
+		}
+	}
+	return r.Range(ctx, from, now.Truncate(time.Minute).Add(time.Minute))
+}
+
+// Range recomputes the minute buckets from from up to to, and the hour
+// buckets overlapping them. It replaces existing rows, so running it
+// repeatedly is safe.
+func (r *TrafficRollup) Range(ctx context.Context, from, to time.Time) error {
+	from, to = from.UTC().Truncate(time.Minute), to.UTC()
+	hourFrom, hourTo := from.Truncate(time.Hour), to.Truncate(time.Hour)
+	if hourTo.Before(to) {
+		hourTo = hourTo.Add(time.Hour)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("traffic rollup: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO `+TrafficMinuteTable+` (bucket, rule_id, requests, blocked, bytes, response_ms)
+		SELECT date_trunc('minute', time) AS minute,
+		       rule_id,
+		       count(*),
+		       count(*) FILTER (WHERE NOT allowed),
+		       COALESCE(sum(bytes), 0),
+		       COALESCE(sum(response_ms), 0)
+		FROM rate_limit_events
+		WHERE time >= $1 AND time < $2
+		GROUP BY minute, rule_id
+		ON CONFLICT (bucket, rule_id) DO UPDATE
+		SET requests    = EXCLUDED.requests,
+		    blocked     = EXCLUDED.blocked,
+		    bytes       = EXCLUDED.bytes,
+		    response_ms = EXCLUDED.response_ms`, from, to); err != nil {
+		return fmt.Errorf("minute rollup: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO `+TrafficHourTable+` (bucket, rule_id, requests, blocked, bytes, response_ms)
+		SELECT date_trunc('hour', bucket) AS hour,
+		       rule_id,
+		       sum(requests),
+		       sum(blocked),
+		       sum(bytes),
+		       sum(response_ms)
+		FROM `+TrafficMinuteTable+`
+		WHERE bucket >= $1 AND bucket < $2
+		GROUP BY hour, rule_id
+		ON CONFLICT (bucket, rule_id) DO UPDATE
+		SET requests    = EXCLUDED.requests,
+		    blocked     = EXCLUDED.blocked,
+		    bytes       = EXCLUDED.bytes,
+		    response_ms = EXCLUDED.response_ms`, hourFrom, hourTo); err != nil {
+		return fmt.Errorf("hour rollup: %w", err)
+	}
+	return tx.Commit()
+}
+
+// rollupTable returns the rollup table a timeline of the given bucket size
+// can be summed from, or "" when the buckets do not align with either.
+func rollupTable(bucket time.Duration) string {
+	switch {
+	case bucket%time.Hour == 0:
+		return TrafficHourTable
+	case bucket%time.Minute == 0:
+		return TrafficMinuteTable
+	default:
+		return ""
+	}
+}
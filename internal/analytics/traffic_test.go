@@ -0,0 +1,98 @@
+package analytics
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrafficRollupRange(t *testing.T) {
+	f, db := newFakeDB(t)
+
+	from := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 5, 12, 31, 0, 0, time.UTC)
+	if err := NewTrafficRollup(db).Range(context.Background(), from, to); err != nil {
+		t.Fatalf("Range() error = %v", err)
+	}
+
+	calls := f.execCalls()
+	if len(calls) != 2 || !strings.Contains(calls[0].query, "INSERT INTO traffic_rollup_1m") ||
+		!strings.Contains(calls[1].query, "INSERT INTO traffic_rollup_1h") {
+		t.Fatalf("Expected minute then hour upserts, got %+v", calls)
+	}
+	if calls[0].args[0] != from || calls[0].args[1] != to {
+		t.Errorf("Unexpected minute bounds %v", calls[0].args)
+	}
+	if calls[1].args[0] != from || calls[1].args[1] != to.Truncate(time.Hour).Add(time.Hour) {
+		t.Errorf("Expected the partial hour rolled up too, got %v", calls[1].args)
+	}
+}
+
+func TestTrafficRollupRefresh(t *testing.T) {
+	now := time.Date(2024, 3, 5, 12, 30, 20, 0, time.UTC)
+	for _, tc := range []struct {
+		name      string
+		last      driver.Value
+		first     driver.Value
+		wantStart time.Time
+	}{
+		{"recent", now.Add(-time.Minute), nil, time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)},
+		{"catch up", time.Date(2024, 3, 4, 23, 59, 0, 0, time.UTC), nil, time.Date(2024, 3, 4, 23, 0, 0, 0, time.UTC)},
+		{"backfill", nil, time.Date(2024, 2, 1, 8, 15, 0, 0, time.UTC), time.Date(2024, 2, 1, 8, 0, 0, 0, time.UTC)},
+		{"no events", nil, nil, time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, db := newFakeDB(t)
+			f.respond("max(bucket)", []string{"max"}, []driver.Value{tc.last})
+			f.respond("min(time)", []string{"min"}, []driver.Value{tc.first})
+			r := NewTrafficRollup(db)
+			r.now = func() time.Time { return now }
+
+			if err := r.Refresh(context.Background()); err != nil {
+				t.Fatalf("Refresh() error = %v", err)
+			}
+			calls := f.execCalls()
+			if len(calls) != 2 {
+				t.Fatalf("Expected two upserts, got %d", len(calls))
+			}
+			if calls[0].args[0] != tc.wantStart || calls[0].args[1] != time.Date(2024, 3, 5, 12, 31, 0, 0, time.UTC) {
+				t.Errorf("Unexpected refresh range %v", calls[0].args)
+			}
+		})
+	}
+}
+
+func TestQueryServiceTimelineSources(t *testing.T) {
+	long := time.Now().Add(-30 * 24 * time.Hour)
+	for _, tc := range []struct {
+		name   string
+		since  time.Time
+		bucket time.Duration
+		table  string
+		raw    bool
+	}{
+		{"hourly", long, 6 * time.Hour, TrafficHourTable, false},
+		{"minutely", long, 15 * time.Minute, TrafficMinuteTable, false},
+		{"odd bucket", long, 90 * time.Second, TrafficMinuteTable, true},
+		{"recent", time.Now().Add(-30 * time.Minute), time.Minute, TrafficMinuteTable, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, db := newFakeDB(t)
+			f.respond("time_bucket", []string{"bucket", "total", "blocked"})
+			if _, err := NewQueryService(db).Timeline(context.Background(), tc.since, tc.bucket); err != nil {
+				t.Fatalf("Timeline() error = %v", err)
+			}
+			q := f.queries[0]
+			if !strings.Contains(q.query, "FROM "+tc.table) {
+				t.Errorf("Expected rollups from %s, got %s", tc.table, q.query)
+			}
+			// Raw events alone are read when the rollups start where the
+			// window does.
+			if raw := q.args[3] == tc.since; raw != tc.raw {
+				t.Errorf("Expected raw only %v, got rollups up to %v", tc.raw, q.args[3])
+			}
+		})
+	}
+}
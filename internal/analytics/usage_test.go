@@ -0,0 +1,64 @@
+package analytics
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRollupDay(t *testing.T) {
+	f, db := newFakeDB(t)
+
+	day := time.Date(2024, 3, 5, 17, 30, 0, 0, time.UTC)
+	if err := NewRollup(db).Day(context.Background(), day); err != nil {
+		t.Fatalf("Day() error = %v", err)
+	}
+
+	calls := f.execCalls()
+	if len(calls) != 1 || !strings.Contains(calls[0].query, "ON CONFLICT (day, client_id)") {
+		t.Fatalf("Expected one upsert, got %+v", calls)
+	}
+	start := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	args := calls[0].args
+	if args[0] != start || args[1] != start.AddDate(0, 0, 1) || args[2] != "2024-03-05" {
+		t.Errorf("Unexpected rollup bounds %v", args)
+	}
+}
+
+func TestRollupRefreshCoversYesterday(t *testing.T) {
+	f, db := newFakeDB(t)
+
+	if err := NewRollup(db).Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	calls := f.execCalls()
+	if len(calls) != 2 {
+		t.Fatalf("Expected rollups for yesterday and today, got %d", len(calls))
+	}
+	today := time.Now().UTC().Format(DayLayout)
+	if calls[1].args[2] != today || calls[0].args[2] == today {
+		t.Errorf("Unexpected rollup days %v, %v", calls[0].args[2], calls[1].args[2])
+	}
+}
+
+func TestQueryServiceDailyUsage(t *testing.T) {
+	f, db := newFakeDB(t)
+	d1 := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	f.respond("FROM client_daily_usage", []string{"day", "client_id", "requests", "blocked", "bytes"},
+		[]driver.Value{d1, "key:a", int64(100), int64(3), int64(2048)},
+		[]driver.Value{d1.AddDate(0, 0, 1), "key:a", int64(50), int64(0), int64(1024)},
+	)
+
+	usage, err := NewQueryService(db).DailyUsage(context.Background(), d1, d1.AddDate(0, 0, 30))
+	if err != nil {
+		t.Fatalf("DailyUsage() error = %v", err)
+	}
+	if len(usage) != 2 || usage[1].Day != "2024-03-02" || usage[0].Bytes != 2048 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+	if f.queries[0].args[0] != "2024-03-01" || f.queries[0].args[1] != "2024-03-31" {
+		t.Errorf("Expected inclusive day bounds, got %v", f.queries[0].args)
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Siruyy/gatify/internal/acl"
+)
+
+// WithACL enables the /api/acl endpoints, which manage the IP allowlist
+// and denylist in repo. changed runs after every successful mutation,
+// typically to reload the proxy's list.
+func WithACL(repo acl.Repository, changed func(ctx context.Context)) Option {
+	if changed == nil {
+		changed = func(context.Context) {}
+	}
+	return func(h *Handler) {
+		h.acl = repo
+		h.aclChanged = changed
+	}
+}
+
+func (h *Handler) listACL(w http.ResponseWriter, r *http.Request) {
+	list, err := h.acl.List(r.Context())
+	if err != nil {
+		h.writeACLError(w, "list", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) getACLEntry(w http.ResponseWriter, r *http.Request) {
+	entry, err := h.acl.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeACLError(w, "get", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+func (h *Handler) createACLEntry(w http.ResponseWriter, r *http.Request) {
+	var entry acl.Entry
+	if err := decodeJSON(w, r, &entry); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	entry.Normalize()
+	if err := entry.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := h.acl.Create(r.Context(), entry)
+	if err != nil {
+		h.writeACLError(w, "create", err)
+		return
+	}
+	h.aclChanged(r.Context())
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) updateACLEntry(w http.ResponseWriter, r *http.Request) {
+	var entry acl.Entry
+	if err := decodeJSON(w, r, &entry); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	entry.ID = r.PathValue("id")
+	entry.Normalize()
+	if err := entry.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	updated, err := h.acl.Update(r.Context(), entry)
+	if err != nil {
+		h.writeACLError(w, "update", err)
+		return
+	}
+	h.aclChanged(r.Context())
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) deleteACLEntry(w http.ResponseWriter, r *http.Request) {
+	if err := h.acl.Delete(r.Context(), r.PathValue("id")); err != nil {
+		h.writeACLError(w, "delete", err)
+		return
+	}
+	h.aclChanged(r.Context())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) writeACLError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, acl.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, acl.ErrDuplicate):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		log.Printf("Failed to %s ACL entry: %v", op, err)
+		writeError(w, http.StatusInternalServerError, "failed to "+op+" acl entry")
+	}
+}
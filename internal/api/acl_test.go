@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/acl"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+func TestACLEndpoints(t *testing.T) {
+	repo := acl.NewInMemoryRepository()
+	reloads := 0
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithACL(repo, func(context.Context) { reloads++ }))
+
+	w := doRequest(h, http.MethodPost, "/api/acl", `{"cidr":"203.0.113.9","action":"deny","comment":"scraper"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created acl.Entry
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	if created.ID == "" || created.CIDR != "203.0.113.9/32" || reloads != 1 {
+		t.Errorf("Unexpected entry %+v after %d reloads", created, reloads)
+	}
+
+	if w := doRequest(h, http.MethodPost, "/api/acl", `{"cidr":"203.0.113.9/32","action":"allow"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate range, got %d", w.Code)
+	}
+	if w := doRequest(h, http.MethodPost, "/api/acl", `{"cidr":"not-an-ip","action":"deny"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid range, got %d", w.Code)
+	}
+
+	w = doRequest(h, http.MethodPut, "/api/acl/"+created.ID, `{"cidr":"203.0.113.0/24","action":"deny"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doRequest(h, http.MethodGet, "/api/acl", "")
+	var list []acl.Entry
+	_ = json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].CIDR != "203.0.113.0/24" {
+		t.Errorf("Unexpected list %+v", list)
+	}
+
+	if w := doRequest(h, http.MethodDelete, "/api/acl/"+created.ID, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", w.Code)
+	}
+	if w := doRequest(h, http.MethodGet, "/api/acl/"+created.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %d", w.Code)
+	}
+	if reloads != 3 {
+		t.Errorf("Expected a reload per mutation, got %d", reloads)
+	}
+}
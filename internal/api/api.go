@@ -0,0 +1,441 @@
+// Package api provides the management HTTP API
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Siruyy/gatify/internal/acl"
+	"github.com/Siruyy/gatify/internal/changes"
+	"github.com/Siruyy/gatify/internal/emergency"
+	"github.com/Siruyy/gatify/internal/policy"
+	"github.com/Siruyy/gatify/internal/report"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/stream"
+	"github.com/Siruyy/gatify/internal/suggest"
+	"github.com/Siruyy/gatify/internal/users"
+)
+
+// maxBodyBytes caps request bodies accepted by the management API.
+const maxBodyBytes = 1 << 20
+
+// Handler serves the management API under /api/.
+type Handler struct {
+	rules           rules.Repository
+	adminToken      string
+	users           *users.Authenticator
+	mux             *http.ServeMux
+	rulesChanged    func(ctx context.Context)
+	changes         *changes.Notifier
+	emergency       *emergency.Switch
+	stats           StatsProvider
+	usage           UsageProvider
+	reports         report.Source
+	schedules       ReportScheduler
+	suggestions     suggest.Source
+	ruleStats       RuleStatsProvider
+	shedding        SheddingProvider
+	slos            SLOProvider
+	ruleTester      RuleTester
+	budgets         BudgetReader
+	health          HealthProvider
+	erasures        ErasureRunner
+	purger          Purger
+	resetRule       func(ctx context.Context, rule rules.Rule) (int64, error)
+	acl             acl.Repository
+	aclChanged      func(ctx context.Context)
+	policies        policy.Repository
+	policiesChanged func(ctx context.Context)
+	stream          http.Handler
+	streamSSE       http.Handler
+	subscribers     func() []stream.SubscriberStats
+	standby         StandbyController
+	bans            BanManager
+	debugRing       DebugRecorder
+	algorithm       string
+}
+
+// Option customizes a Handler.
+type Option func(*Handler)
+
+// WithRulesChanged registers fn to run after every successful rule
+// mutation, typically to reload the proxy's matcher.
+func WithRulesChanged(fn func(ctx context.Context)) Option {
+	return func(h *Handler) { h.rulesChanged = fn }
+}
+
+// WithLimiterAlgorithm rejects rules relying on settings that name, the
+// gateway's LIMITER_ALGORITHM, ignores.
+func WithLimiterAlgorithm(name string) Option {
+	return func(h *Handler) { h.algorithm = name }
+}
+
+// WithUsers authenticates callers with the tokens of a, instead of the
+// admin token alone, enforces their roles, records every mutation in the
+// audit log and enables the /api/admin/tokens and /api/admin/audit
+// endpoints.
+func WithUsers(a *users.Authenticator) Option {
+	return func(h *Handler) { h.users = a }
+}
+
+// WithChangeNotifier reports every rule created, updated, rolled back or
+// deleted through the API to n, with a diff of the change.
+func WithChangeNotifier(n *changes.Notifier) Option {
+	return func(h *Handler) { h.changes = n }
+}
+
+// WithEmergency enables the /api/admin/emergency endpoints.
+func WithEmergency(sw *emergency.Switch) Option {
+	return func(h *Handler) { h.emergency = sw }
+}
+
+// WithStandby enables GET /api/admin/standby and
+// POST /api/admin/standby/promote, which report and end a warm standby.
+func WithStandby(s StandbyController) Option {
+	return func(h *Handler) { h.standby = s }
+}
+
+// WithStats enables the /api/stats endpoints.
+func WithStats(stats StatsProvider) Option {
+	return func(h *Handler) { h.stats = stats }
+}
+
+// WithBilling enables the /api/billing/export endpoint.
+func WithBilling(usage UsageProvider) Option {
+	return func(h *Handler) { h.usage = usage }
+}
+
+// WithReports enables the summary report at /api/reports/summary.
+func WithReports(src report.Source) Option {
+	return func(h *Handler) { h.reports = src }
+}
+
+// WithReportSchedules enables the /api/reports/schedules endpoints for
+// scheduled report delivery.
+func WithReportSchedules(s ReportScheduler) Option {
+	return func(h *Handler) { h.schedules = s }
+}
+
+// WithSuggestions enables GET /api/rules/suggestions, which proposes rules
+// from recent traffic.
+func WithSuggestions(src suggest.Source) Option {
+	return func(h *Handler) { h.suggestions = src }
+}
+
+// WithRuleStats embeds live enforcement counters in rule responses.
+func WithRuleStats(p RuleStatsProvider) Option {
+	return func(h *Handler) { h.ruleStats = p }
+}
+
+// WithShedding enables GET /api/stats/shedding, which reports this
+// instance's load shedding counters.
+func WithShedding(p SheddingProvider) Option {
+	return func(h *Handler) { h.shedding = p }
+}
+
+// WithRuleTester enables POST /api/rules/test, which explains how the
+// gateway would limit a request without sending it.
+func WithRuleTester(t RuleTester) Option {
+	return func(h *Handler) { h.ruleTester = t }
+}
+
+// WithBudgets adds each client's live rate limit budgets to
+// GET /api/stats/clients/{client_id}.
+func WithBudgets(b BudgetReader) Option {
+	return func(h *Handler) { h.budgets = b }
+}
+
+// WithBans enables GET /api/bans, which lists the banned clients, and
+// DELETE /api/bans/{client}, which lifts a ban.
+func WithBans(m BanManager) Option {
+	return func(h *Handler) { h.bans = m }
+}
+
+// WithDebugRing enables GET /api/admin/debug/requests, which returns the
+// detailed diagnostics of the latest requests this instance handled.
+func WithDebugRing(d DebugRecorder) Option {
+	return func(h *Handler) { h.debugRing = d }
+}
+
+// WithSLOs enables GET /api/stats/slos, which reports the error budgets
+// of the gateway's latency objectives.
+func WithSLOs(p SLOProvider) Option {
+	return func(h *Handler) { h.slos = p }
+}
+
+// WithHealth enables GET /api/stats/health, which reports the gateway's
+// readiness and the state of its backends and dependencies.
+func WithHealth(p HealthProvider) Option {
+	return func(h *Handler) { h.health = p }
+}
+
+// WithErasures enables DELETE /api/analytics/clients/{id}, which erases
+// a client's stored analytics in a background job, and the job status
+// endpoint.
+func WithErasures(e ErasureRunner) Option {
+	return func(h *Handler) { h.erasures = e }
+}
+
+// WithPurge enables POST /api/stats/purge, which deletes analytics older
+// than the retention window, or than a given age, at once.
+func WithPurge(p Purger) Option {
+	return func(h *Handler) { h.purger = p }
+}
+
+// WithStream enables the live event stream at /api/stats/stream, over
+// WebSocket, and at /api/stats/stream/sse as Server-Sent Events, and
+// GET /api/admin/stream/subscribers, which lists its subscribers.
+func WithStream(broker *stream.Broker) Option {
+	return func(h *Handler) {
+		h.stream = broker
+		h.streamSSE = http.HandlerFunc(broker.ServeSSE)
+		h.subscribers = broker.SubscriberStats
+	}
+}
+
+// WithCounterReset enables POST /api/rules/{id}/reset, which clears every
+// client's counters for a rule through fn, and
+// POST /api/namespaces/{name}/reset, which does so for every rule in a
+// namespace.
+func WithCounterReset(fn func(ctx context.Context, rule rules.Rule) (int64, error)) Option {
+	return func(h *Handler) { h.resetRule = fn }
+}
+
+// NewHandler creates the management API handler. Every route requires the
+// admin token as a bearer credential.
+func NewHandler(repo rules.Repository, adminToken string, opts ...Option) *Handler {
+	h := &Handler{
+		rules:        repo,
+		adminToken:   adminToken,
+		mux:          http.NewServeMux(),
+		rulesChanged: func(context.Context) {},
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.mux.HandleFunc("GET /api/rules", h.listRules)
+	h.mux.HandleFunc("POST /api/rules", h.createRule)
+	h.mux.HandleFunc("GET /api/rules/{id}", h.getRule)
+	h.mux.HandleFunc("PUT /api/rules/{id}", h.updateRule)
+	h.mux.HandleFunc("DELETE /api/rules/{id}", h.deleteRule)
+	h.mux.HandleFunc("PUT /api/rules:apply", h.applyRules)
+	h.mux.HandleFunc("GET /api/rules/{id}/revisions", h.listRevisions)
+	if h.ruleTester != nil {
+		h.mux.HandleFunc("POST /api/rules/test", h.testRule)
+	}
+	h.mux.HandleFunc("POST /api/rules/{id}/rollback/{rev}", h.rollbackRule)
+	if h.resetRule != nil {
+		h.mux.HandleFunc("POST /api/rules/{id}/reset", h.resetCounters)
+		h.mux.HandleFunc("POST /api/namespaces/{name}/reset", h.resetNamespace)
+	}
+	if h.suggestions != nil {
+		h.mux.HandleFunc("GET /api/rules/suggestions", h.getSuggestions)
+	}
+
+	if h.acl != nil {
+		h.mux.HandleFunc("GET /api/acl", h.listACL)
+		h.mux.HandleFunc("POST /api/acl", h.createACLEntry)
+		h.mux.HandleFunc("GET /api/acl/{id}", h.getACLEntry)
+		h.mux.HandleFunc("PUT /api/acl/{id}", h.updateACLEntry)
+		h.mux.HandleFunc("DELETE /api/acl/{id}", h.deleteACLEntry)
+	}
+
+	if h.bans != nil {
+		h.mux.HandleFunc("GET /api/bans", h.listBans)
+		h.mux.HandleFunc("DELETE /api/bans/{client}", h.liftBan)
+	}
+
+	if h.policies != nil {
+		h.mux.HandleFunc("GET /api/policies", h.listPolicies)
+		h.mux.HandleFunc("POST /api/policies", h.createPolicy)
+		h.mux.HandleFunc("GET /api/policies/{name}", h.getPolicy)
+		h.mux.HandleFunc("PUT /api/policies/{name}", h.updatePolicy)
+		h.mux.HandleFunc("DELETE /api/policies/{name}", h.deletePolicy)
+	}
+
+	if h.users != nil {
+		h.mux.HandleFunc("GET /api/admin/tokens", h.listTokens)
+		h.mux.HandleFunc("POST /api/admin/tokens", h.createToken)
+		h.mux.HandleFunc("DELETE /api/admin/tokens/{id}", h.revokeToken)
+		h.mux.HandleFunc("GET /api/admin/audit", h.listAudit)
+	}
+
+	if h.emergency != nil {
+		h.mux.HandleFunc("GET /api/admin/emergency", h.getEmergency)
+		h.mux.HandleFunc("POST /api/admin/emergency", h.activateEmergency)
+		h.mux.HandleFunc("DELETE /api/admin/emergency", h.deactivateEmergency)
+	}
+	if h.debugRing != nil {
+		h.mux.HandleFunc("GET /api/admin/debug/requests", h.listDebugRequests)
+	}
+	if h.standby != nil {
+		h.mux.HandleFunc("GET /api/admin/standby", h.getStandby)
+		h.mux.HandleFunc("POST /api/admin/standby/promote", h.promoteStandby)
+	}
+
+	if h.stats != nil {
+		h.mux.HandleFunc("GET /api/stats/overview", h.getOverview)
+		h.mux.HandleFunc("GET /api/stats/rules/{id}", h.getRuleStats)
+		h.mux.HandleFunc("GET /api/stats/timeline", h.getTimeline)
+		h.mux.HandleFunc("GET /api/stats/shadow", h.getShadowComparison)
+		h.mux.HandleFunc("GET /api/stats/agents", h.getAgentBreakdown)
+		h.mux.HandleFunc("GET /api/stats/dimensions/{name}", h.getDimensionBreakdown)
+		h.mux.HandleFunc("GET /api/stats/top-paths", h.getTopPaths)
+		h.mux.HandleFunc("GET /api/stats/paths/{pattern...}", h.getPathStats)
+		h.mux.HandleFunc("GET /api/stats/clients/{client_id}", h.getClientStats)
+		h.mux.HandleFunc("POST /api/stats/batch", h.batchStats)
+		h.mux.HandleFunc("GET /api/stats/snapshot", h.getSnapshot)
+	}
+	if h.shedding != nil {
+		h.mux.HandleFunc("GET /api/stats/shedding", h.getShedding)
+	}
+	if h.slos != nil {
+		h.mux.HandleFunc("GET /api/stats/slos", h.getSLOs)
+	}
+	if h.health != nil {
+		h.mux.HandleFunc("GET /api/stats/health", h.getHealth)
+	}
+	if h.stream != nil {
+		h.mux.Handle("GET /api/stats/stream", h.stream)
+		h.mux.Handle("GET /api/stats/stream/sse", h.streamSSE)
+		h.mux.HandleFunc("GET /api/admin/stream/subscribers", h.listSubscribers)
+	}
+	if h.usage != nil {
+		h.mux.HandleFunc("GET /api/billing/export", h.exportUsage)
+	}
+	if h.purger != nil {
+		h.mux.HandleFunc("POST /api/stats/purge", h.purgeStats)
+	}
+	if h.erasures != nil {
+		h.mux.HandleFunc("DELETE /api/analytics/clients/{id}", h.eraseClient)
+		h.mux.HandleFunc("GET /api/analytics/erasures/{id}", h.getErasure)
+	}
+	if h.reports != nil {
+		h.mux.HandleFunc("GET /api/reports/summary", h.getSummaryReport)
+	}
+	if h.schedules != nil {
+		h.mux.HandleFunc("GET /api/reports/schedules", h.listSchedules)
+		h.mux.HandleFunc("POST /api/reports/schedules", h.createSchedule)
+		h.mux.HandleFunc("GET /api/reports/schedules/{id}", h.getSchedule)
+		h.mux.HandleFunc("PUT /api/reports/schedules/{id}", h.updateSchedule)
+		h.mux.HandleFunc("DELETE /api/reports/schedules/{id}", h.deleteSchedule)
+		h.mux.HandleFunc("POST /api/reports/schedules/{id}/send", h.sendSchedule)
+	}
+
+	return h
+}
+
+// ServeHTTP authenticates the request, checks the caller's role and
+// dispatches it to a route. Mutations are recorded in the audit log.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p, err := h.authenticate(r)
+	if err != nil {
+		if !errors.Is(err, users.ErrUnauthenticated) {
+			log.Printf("Failed to authenticate API request: %v", err)
+			writeError(w, http.StatusInternalServerError, "failed to authenticate")
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gatify"`)
+		writeError(w, http.StatusUnauthorized, "missing or invalid admin token")
+		return
+	}
+	if !p.CanWrite() && !readOnly(r) {
+		writeError(w, http.StatusForbidden, "token is read-only")
+		return
+	}
+	r = r.WithContext(users.WithPrincipal(r.Context(), p))
+
+	if h.users == nil || readOnly(r) {
+		h.mux.ServeHTTP(w, r)
+		return
+	}
+	rec := &statusRecorder{ResponseWriter: w}
+	h.mux.ServeHTTP(rec, r)
+	if err := h.users.Audit(r.Context(), p, r.Method, r.URL.Path, rec.statusCode()); err != nil {
+		log.Printf("Failed to audit %s %s by token %s: %v", r.Method, r.URL.Path, p.TokenID, err)
+	}
+}
+
+// authenticate returns the caller presenting the request's bearer token.
+// Without users, only the admin token is accepted.
+func (h *Handler) authenticate(r *http.Request) (users.Principal, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return users.Principal{}, users.ErrUnauthenticated
+	}
+	if h.users != nil {
+		return h.users.Authenticate(r.Context(), token)
+	}
+	if h.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) != 1 {
+		return users.Principal{}, users.ErrUnauthenticated
+	}
+	return users.Principal{TokenID: users.BootstrapID, Name: "ADMIN_API_TOKEN", Role: users.RoleAdmin}, nil
+}
+
+// readOnly reports whether r only reads configuration or stats, which
+// read-only tokens may do. Tokens, the audit log and request diagnostics,
+// which show clients' headers, are admin only.
+func readOnly(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/admin/tokens") || r.URL.Path == "/api/admin/audit" ||
+		strings.HasPrefix(r.URL.Path, "/api/admin/debug/") {
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	}
+	// Batch stats queries and rule tests are POSTed for their body but
+	// change nothing.
+	return r.Method == http.MethodPost && (r.URL.Path == "/api/stats/batch" || r.URL.Path == "/api/rules/test")
+}
+
+// statusRecorder captures the status of an audited response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Siruyy/gatify/internal/changes"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// applyRequest is the complete desired rule set. Rules are decoded one
+// by one, honoring the client's rule schema version like single rule
+// writes.
+type applyRequest struct {
+	Rules []json.RawMessage `json:"rules"`
+}
+
+// applyResult is the plan of an apply: what was, or with dry_run would
+// be, created, updated and deleted.
+type applyResult struct {
+	DryRun    bool                 `json:"dry_run"`
+	Changes   []changes.RuleChange `json:"changes"`
+	Unchanged int                  `json:"unchanged"`
+}
+
+// applyRules reconciles the stored rules with the desired set, so rules
+// can be managed declaratively by infrastructure-as-code tools. Rules are
+// matched by name: desired rules without a stored counterpart are
+// created, stored rules missing from the set are deleted, and the rest
+// are updated when any field differs. Fields a client declaring a newer
+// rule schema sends are skipped and listed in X-Gatify-Ignored-Fields, as
+// for single rules.
+func (h *Handler) applyRules(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	if err != nil && r.URL.Query().Get("dry_run") != "" {
+		writeError(w, http.StatusBadRequest, "dry_run must be a boolean")
+		return
+	}
+	version, err := rules.ParseSchemaVersion(r.Header.Get(rules.SchemaHeader))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req applyRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	list := make([]rules.Rule, len(req.Rules))
+	var ignored []string
+	for i, data := range req.Rules {
+		skipped, err := rules.DecodeRule(data, version, &list[i])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON body: rule %d: %v", i, err))
+			return
+		}
+		for _, field := range skipped {
+			if !slices.Contains(ignored, field) {
+				ignored = append(ignored, field)
+			}
+		}
+	}
+	if len(ignored) > 0 {
+		w.Header().Set("X-Gatify-Ignored-Fields", strings.Join(ignored, ", "))
+	}
+
+	desired := make(map[string]bool, len(list))
+	for i := range list {
+		rule := &list[i]
+		rule.Normalize()
+		if err := h.validateRule(rule); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("rule %q: %v", rule.Name, err))
+			return
+		}
+		if desired[rule.Name] {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("rule %q appears more than once", rule.Name))
+			return
+		}
+		desired[rule.Name] = true
+		if status, err := h.checkRulePolicy(r.Context(), *rule); err != nil {
+			writeError(w, status, fmt.Sprintf("rule %q: %v", rule.Name, err))
+			return
+		}
+	}
+
+	current, err := h.rules.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list rules: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to list rules")
+		return
+	}
+	stored := make(map[string]rules.Rule, len(current))
+	for _, rule := range current {
+		if _, dup := stored[rule.Name]; dup && desired[rule.Name] {
+			writeError(w, http.StatusConflict, fmt.Sprintf("several stored rules are named %q; rename or delete all but one first", rule.Name))
+			return
+		}
+		stored[rule.Name] = rule
+	}
+
+	result := applyResult{DryRun: dryRun, Changes: []changes.RuleChange{}}
+	var plan []applyStep
+	for _, rule := range list {
+		old, ok := stored[rule.Name]
+		if !ok {
+			plan = append(plan, applyStep{action: changes.ActionCreated, rule: rule})
+			continue
+		}
+		rule.ID, rule.Revision = old.ID, old.Revision
+		rule.CreatedAt, rule.UpdatedAt = old.CreatedAt, old.UpdatedAt
+		if len(changes.Diff(&old, &rule)) == 0 {
+			result.Unchanged++
+			continue
+		}
+		plan = append(plan, applyStep{action: changes.ActionUpdated, rule: rule, old: &old})
+	}
+	for _, rule := range current {
+		if !desired[rule.Name] {
+			plan = append(plan, applyStep{action: changes.ActionDeleted, old: &rule})
+		}
+	}
+
+	for _, step := range plan {
+		if dryRun {
+			result.Changes = append(result.Changes, step.change())
+			continue
+		}
+		c, err := step.run(r.Context(), h.rules)
+		if err != nil {
+			// Steps already run stay applied; re-running the apply
+			// converges on the desired set.
+			if len(result.Changes) > 0 {
+				h.rulesChanged(r.Context())
+			}
+			h.writeRuleError(w, "apply", err)
+			return
+		}
+		h.changes.Notify(c)
+		result.Changes = append(result.Changes, c)
+	}
+	if !dryRun && len(result.Changes) > 0 {
+		h.rulesChanged(r.Context())
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// applyStep is one mutation planned by an apply.
+type applyStep struct {
+	action string
+	// rule is the desired rule, unset for deletes; old is the stored
+	// rule, unset for creates.
+	rule rules.Rule
+	old  *rules.Rule
+}
+
+func (s applyStep) change() changes.RuleChange {
+	if s.action == changes.ActionDeleted {
+		return changes.New(s.action, *s.old, changes.Diff(s.old, nil))
+	}
+	return changes.New(s.action, s.rule, changes.Diff(s.old, &s.rule))
+}
+
+func (s applyStep) run(ctx context.Context, repo rules.Repository) (changes.RuleChange, error) {
+	switch s.action {
+	case changes.ActionCreated:
+		created, err := repo.Create(ctx, s.rule)
+		return changes.New(s.action, created, changes.Diff(nil, &created)), err
+	case changes.ActionUpdated:
+		// The stored revision guards against concurrent edits made since
+		// the plan was computed.
+		updated, err := repo.Update(ctx, s.rule)
+		return changes.New(s.action, updated, changes.Diff(s.old, &updated)), err
+	default:
+		err := repo.Delete(ctx, s.old.ID)
+		return changes.New(s.action, *s.old, changes.Diff(s.old, nil)), err
+	}
+}
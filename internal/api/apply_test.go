@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/changes"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+func seedApplyRules(t *testing.T, repo rules.Repository) {
+	t.Helper()
+	for _, rule := range []rules.Rule{
+		{Name: "login", Pattern: "/login", Limit: 5, WindowSeconds: 60, Enabled: true},
+		{Name: "search", Pattern: "/search", Limit: 10, WindowSeconds: 60, Enabled: true},
+		{Name: "legacy", Pattern: "/v1/*", Limit: 100, WindowSeconds: 60, Enabled: true},
+	} {
+		rule.Normalize()
+		if _, err := repo.Create(context.Background(), rule); err != nil {
+			t.Fatalf("seed rule: %v", err)
+		}
+	}
+}
+
+const desiredRules = `{"rules":[
+	{"name":"login","pattern":"/login","limit":5,"window_seconds":60,"enabled":true},
+	{"name":"search","pattern":"/search","limit":20,"window_seconds":60,"enabled":true},
+	{"name":"upload","pattern":"/upload","limit":2,"window_seconds":60,"enabled":true}
+]}`
+
+func decodeApply(t *testing.T, body []byte) applyResult {
+	t.Helper()
+	var res applyResult
+	if err := json.Unmarshal(body, &res); err != nil {
+		t.Fatalf("decode apply result: %v", err)
+	}
+	return res
+}
+
+func actions(res applyResult) map[string]string {
+	out := map[string]string{}
+	for _, c := range res.Changes {
+		out[c.RuleName] = c.Action
+	}
+	return out
+}
+
+func TestApplyRulesDryRun(t *testing.T) {
+	repo := rules.NewInMemoryRepository()
+	seedApplyRules(t, repo)
+	h := NewHandler(repo, testToken)
+
+	w := doRequest(h, http.MethodPut, "/api/rules:apply?dry_run=true", desiredRules)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	res := decodeApply(t, w.Body.Bytes())
+	want := map[string]string{"search": changes.ActionUpdated, "upload": changes.ActionCreated, "legacy": changes.ActionDeleted}
+	if !res.DryRun || res.Unchanged != 1 || len(res.Changes) != 3 {
+		t.Fatalf("unexpected plan %+v", res)
+	}
+	for name, action := range want {
+		if actions(res)[name] != action {
+			t.Errorf("expected %s to be %s, got %q", name, action, actions(res)[name])
+		}
+	}
+	for _, c := range res.Changes {
+		if c.RuleName == "search" && (len(c.Diff) != 1 || c.Diff[0].Field != "limit") {
+			t.Errorf("expected only the limit to change, got %+v", c.Diff)
+		}
+	}
+
+	list, _ := repo.List(context.Background())
+	if len(list) != 3 {
+		t.Fatalf("dry run changed the rules: %+v", list)
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	repo := rules.NewInMemoryRepository()
+	seedApplyRules(t, repo)
+	reloads := 0
+	var notified []changes.RuleChange
+	notifier := changes.NewNotifier(nil, "")
+	notifier.Subscribe(func(c changes.RuleChange) { notified = append(notified, c) })
+	h := NewHandler(repo, testToken,
+		WithRulesChanged(func(context.Context) { reloads++ }),
+		WithChangeNotifier(notifier))
+
+	w := doRequest(h, http.MethodPut, "/api/rules:apply", desiredRules)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if res := decodeApply(t, w.Body.Bytes()); res.DryRun || len(res.Changes) != 3 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if reloads != 1 || len(notified) != 3 {
+		t.Fatalf("expected one reload and three notifications, got %d and %d", reloads, len(notified))
+	}
+
+	list, _ := repo.List(context.Background())
+	limits := map[string]int64{}
+	for _, rule := range list {
+		limits[rule.Name] = rule.Limit
+	}
+	if len(limits) != 3 || limits["search"] != 20 || limits["upload"] != 2 || limits["login"] != 5 {
+		t.Fatalf("unexpected rules after apply: %v", limits)
+	}
+
+	// Applying the same set again is a no-op.
+	w = doRequest(h, http.MethodPut, "/api/rules:apply", desiredRules)
+	if res := decodeApply(t, w.Body.Bytes()); len(res.Changes) != 0 || res.Unchanged != 3 {
+		t.Fatalf("expected a no-op, got %+v", res)
+	}
+	if reloads != 1 {
+		t.Fatalf("expected no reload for a no-op, got %d", reloads)
+	}
+}
+
+func TestApplyRulesValidates(t *testing.T) {
+	repo := rules.NewInMemoryRepository()
+	seedApplyRules(t, repo)
+	h := NewHandler(repo, testToken)
+
+	for name, body := range map[string]string{
+		"invalid rule":  `{"rules":[{"name":"x","limit":5,"window_seconds":60}]}`,
+		"duplicate":     `{"rules":[{"name":"x","pattern":"/a","limit":1,"window_seconds":1},{"name":"x","pattern":"/b","limit":1,"window_seconds":1}]}`,
+		"unknown":       `{"rules":[],"bogus":1}`,
+		"unknown field": `{"rules":[{"name":"x","pattern":"/a","limit":1,"window_seconds":1,"owner":"a"}]}`,
+	} {
+		if w := doRequest(h, http.MethodPut, "/api/rules:apply", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, w.Code)
+		}
+	}
+	if w := doRequest(h, http.MethodPut, "/api/rules:apply?dry_run=maybe", desiredRules); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad dry_run, got %d", w.Code)
+	}
+
+	list, _ := repo.List(context.Background())
+	if len(list) != 3 {
+		t.Fatalf("rejected applies changed the rules: %+v", list)
+	}
+}
+
+func TestApplyRulesFromNewerSchema(t *testing.T) {
+	repo := rules.NewInMemoryRepository()
+	h := NewHandler(repo, testToken)
+	body := `{"rules":[
+		{"name":"x","pattern":"/x","limit":1,"window_seconds":1,"owner":"search-team"},
+		{"name":"y","pattern":"/y","limit":1,"window_seconds":1,"labels":["a"],"owner":"search-team"}
+	]}`
+
+	w := doRequestWithHeaders(h, http.MethodPut, "/api/rules:apply", body, map[string]string{rules.SchemaHeader: "99"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("X-Gatify-Ignored-Fields"); got != "owner, labels" {
+		t.Errorf("X-Gatify-Ignored-Fields = %q, want the skipped fields", got)
+	}
+	if list, _ := repo.List(context.Background()); len(list) != 2 {
+		t.Errorf("Expected both rules created, got %+v", list)
+	}
+
+	w = doRequestWithHeaders(h, http.MethodPut, "/api/rules:apply", body, map[string]string{rules.SchemaHeader: "bogus"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid schema version, got %d", w.Code)
+	}
+}
+
+func TestApplyRulesAmbiguousNames(t *testing.T) {
+	repo := rules.NewInMemoryRepository()
+	seedApplyRules(t, repo)
+	_, _ = repo.Create(context.Background(), rules.Rule{Name: "login", Pattern: "/signin", Limit: 5, WindowSeconds: 60})
+	h := NewHandler(repo, testToken)
+
+	if w := doRequest(h, http.MethodPut, "/api/rules:apply", desiredRules); w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for duplicate stored names, got %d", w.Code)
+	}
+}
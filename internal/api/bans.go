@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/netip"
+
+	"github.com/Siruyy/gatify/internal/ban"
+)
+
+// BanManager lists and lifts client bans. *ban.Store implements it.
+type BanManager interface {
+	List(ctx context.Context) ([]ban.Ban, error)
+	Lift(ctx context.Context, client string) (bool, error)
+}
+
+func (h *Handler) listBans(w http.ResponseWriter, r *http.Request) {
+	list, err := h.bans.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list bans: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to list bans")
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// liftBan lifts the ban of a client identity, such as ip:203.0.113.7 or
+// header:key-1. A bare IP address stands for its ip: identity.
+func (h *Handler) liftBan(w http.ResponseWriter, r *http.Request) {
+	client := r.PathValue("client")
+	if addr, err := netip.ParseAddr(client); err == nil {
+		client = "ip:" + addr.String()
+	}
+	lifted, err := h.bans.Lift(r.Context(), client)
+	if err != nil {
+		log.Printf("Failed to lift ban: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to lift ban")
+		return
+	}
+	if !lifted {
+		writeError(w, http.StatusNotFound, "client is not banned")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
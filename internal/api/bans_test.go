@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/ban"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestBans(t *testing.T) {
+	if w := doRequest(newTestHandler(), http.MethodGet, "/api/bans", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 without bans, got %d", w.Code)
+	}
+
+	bans := ban.New(storage.NewMemoryStorage())
+	if err := bans.Ban(t.Context(), "ip:203.0.113.7", ban.ReasonRateLimit, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithBans(bans))
+
+	w := doRequest(h, http.MethodGet, "/api/bans", "")
+	var got []ban.Ban
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if len(got) != 1 || got[0].Client != "ip:203.0.113.7" || got[0].Reason != ban.ReasonRateLimit {
+		t.Errorf("Unexpected bans %+v", got)
+	}
+
+	// A bare address lifts the ban of its ip: identity.
+	if w := doRequest(h, http.MethodDelete, "/api/bans/203.0.113.7", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 lifting the ban, got %d %s", w.Code, w.Body.String())
+	}
+	if _, banned, _ := bans.Banned(t.Context(), "ip:203.0.113.7"); banned {
+		t.Error("Expected the ban to be lifted")
+	}
+	if w := doRequest(h, http.MethodDelete, "/api/bans/ip:203.0.113.7", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a client without a ban, got %d", w.Code)
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+)
+
+// maxExportDays bounds the date range of a single billing export.
+const maxExportDays = 366
+
+// UsageProvider answers the daily usage queries behind /api/billing.
+type UsageProvider interface {
+	DailyUsage(ctx context.Context, from, to time.Time) ([]analytics.ClientUsage, error)
+}
+
+type usageExport struct {
+	From  string                  `json:"from"`
+	To    string                  `json:"to"`
+	Usage []analytics.ClientUsage `json:"usage"`
+}
+
+// exportUsage returns per-client daily usage between the from and to
+// dates (inclusive, YYYY-MM-DD) as JSON or, with format=csv, as CSV.
+// The range defaults to the current month so far.
+func (h *Handler) exportUsage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		writeError(w, http.StatusBadRequest, "format must be json or csv")
+		return
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	to, err := parseDay("to", query.Get("to"), today)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	from, err := parseDay("from", query.Get("from"), to.AddDate(0, 0, 1-to.Day()))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if to.Before(from) {
+		writeError(w, http.StatusBadRequest, "to must not be before from")
+		return
+	}
+	if to.Sub(from) >= maxExportDays*24*time.Hour {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d days per export", maxExportDays))
+		return
+	}
+
+	usage, err := h.usage.DailyUsage(r.Context(), from, to)
+	if err != nil {
+		log.Printf("Billing export failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "usage query failed")
+		return
+	}
+
+	export := usageExport{
+		From:  from.Format(analytics.DayLayout),
+		To:    to.Format(analytics.DayLayout),
+		Usage: usage,
+	}
+	if format == "csv" {
+		writeUsageCSV(w, export)
+		return
+	}
+	writeJSON(w, http.StatusOK, export)
+}
+
+func writeUsageCSV(w http.ResponseWriter, export usageExport) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="usage-%s-%s.csv"`, export.From, export.To))
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"day", "client_id", "requests", "blocked", "bytes"})
+	for _, u := range export.Usage {
+		_ = cw.Write([]string{
+			u.Day,
+			u.ClientID,
+			strconv.FormatInt(u.Requests, 10),
+			strconv.FormatInt(u.Blocked, 10),
+			strconv.FormatInt(u.Bytes, 10),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("Failed to write billing export: %v", err)
+	}
+}
+
+func parseDay(name, raw string, fallback time.Time) (time.Time, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	day, err := time.Parse(analytics.DayLayout, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be a date such as 2024-01-31", name)
+	}
+	return day, nil
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+type fakeUsage struct {
+	from, to time.Time
+	err      error
+}
+
+func (f *fakeUsage) DailyUsage(_ context.Context, from, to time.Time) ([]analytics.ClientUsage, error) {
+	f.from, f.to = from, to
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []analytics.ClientUsage{
+		{Day: "2024-03-01", ClientID: "key:acme", Requests: 120, Blocked: 4, Bytes: 2048},
+	}, nil
+}
+
+func TestBillingExportJSON(t *testing.T) {
+	usage := &fakeUsage{}
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithBilling(usage))
+
+	w := doRequest(h, http.MethodGet, "/api/billing/export?from=2024-03-01&to=2024-03-31", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var got usageExport
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode export: %v", err)
+	}
+	if got.From != "2024-03-01" || got.To != "2024-03-31" || len(got.Usage) != 1 || got.Usage[0].Requests != 120 {
+		t.Errorf("Unexpected export %+v", got)
+	}
+	if usage.from.Day() != 1 || usage.to.Day() != 31 {
+		t.Errorf("Unexpected range passed to provider: %v - %v", usage.from, usage.to)
+	}
+}
+
+func TestBillingExportCSV(t *testing.T) {
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithBilling(&fakeUsage{}))
+
+	w := doRequest(h, http.MethodGet, "/api/billing/export?from=2024-03-01&to=2024-03-02&format=csv", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("Expected CSV response, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	want := "day,client_id,requests,blocked,bytes\n2024-03-01,key:acme,120,4,2048\n"
+	if w.Body.String() != want {
+		t.Errorf("Unexpected CSV:\n%s", w.Body.String())
+	}
+	if !strings.Contains(w.Header().Get("Content-Disposition"), "usage-2024-03-01-2024-03-02.csv") {
+		t.Errorf("Unexpected Content-Disposition %q", w.Header().Get("Content-Disposition"))
+	}
+}
+
+func TestBillingExportDefaultsToCurrentMonth(t *testing.T) {
+	usage := &fakeUsage{}
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithBilling(usage))
+
+	if w := doRequest(h, http.MethodGet, "/api/billing/export", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	now := time.Now().UTC()
+	if usage.from.Day() != 1 || usage.from.Month() != now.Month() || usage.to.Day() != now.Day() {
+		t.Errorf("Expected month to date, got %v - %v", usage.from, usage.to)
+	}
+}
+
+func TestBillingExportValidation(t *testing.T) {
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithBilling(&fakeUsage{}))
+
+	for _, path := range []string{
+		"/api/billing/export?from=March",
+		"/api/billing/export?from=2024-03-02&to=2024-03-01",
+		"/api/billing/export?from=2022-01-01&to=2024-01-01",
+		"/api/billing/export?format=xml",
+	} {
+		if w := doRequest(h, http.MethodGet, path, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, w.Code)
+		}
+	}
+
+	h = NewHandler(rules.NewInMemoryRepository(), testToken, WithBilling(&fakeUsage{err: errors.New("db down")}))
+	w := doRequest(h, http.MethodGet, "/api/billing/export", "")
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "db down") {
+		t.Errorf("Expected masked 500, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+	"github.com/Siruyy/gatify/internal/proxy"
+)
+
+// BudgetReader reads what is left of a client's rate limit budgets
+// without counting a request.
+type BudgetReader interface {
+	Budgets(ctx context.Context, identity string, ruleIDs []string) ([]proxy.Budget, error)
+}
+
+// clientStats is a client's traffic along with its live budgets, to
+// answer "why am I being limited?".
+type clientStats struct {
+	analytics.ClientStats
+	// Budgets cover the rules the client's requests matched in the
+	// window. They are read live, whatever the window or snapshot, and
+	// left out when the limiter cannot be reached.
+	Budgets []proxy.Budget `json:"budgets,omitempty"`
+}
+
+func (h *Handler) getClientStats(w http.ResponseWriter, r *http.Request) {
+	q := statQuery{Type: statClient, ClientID: r.PathValue("client_id"), Window: r.URL.Query().Get("window")}
+	h.writeStat(w, r, q)
+}
+
+// clientStats answers a client query, adding the client's budgets when
+// the handler can read them.
+func (h *Handler) clientStats(ctx context.Context, clientID string, since time.Time) (clientStats, error) {
+	stats, err := h.stats.ClientStats(ctx, clientID, since)
+	if err != nil {
+		return clientStats{}, err
+	}
+	out := clientStats{ClientStats: stats}
+	if h.budgets == nil || len(stats.Rules) == 0 {
+		return out, nil
+	}
+	ids := make([]string, len(stats.Rules))
+	for i, rule := range stats.Rules {
+		ids[i] = rule.RuleID
+	}
+	if out.Budgets, err = h.budgets.Budgets(ctx, clientID, ids); err != nil {
+		log.Printf("Failed to read budgets of %s: %v", clientID, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/proxy"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+type fakeBudgets struct {
+	identity string
+	ruleIDs  []string
+	err      error
+}
+
+func (f *fakeBudgets) Budgets(_ context.Context, identity string, ruleIDs []string) ([]proxy.Budget, error) {
+	f.identity, f.ruleIDs = identity, ruleIDs
+	if f.err != nil {
+		return nil, f.err
+	}
+	out := make([]proxy.Budget, len(ruleIDs))
+	for i, id := range ruleIDs {
+		out[i] = proxy.Budget{RuleID: id, Limit: 10, Counter: &proxy.Counter{Remaining: 3}}
+	}
+	return out, nil
+}
+
+func TestClientStats(t *testing.T) {
+	budgets := &fakeBudgets{}
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithStats(&fakeStats{}), WithBudgets(budgets))
+
+	w := doRequest(h, http.MethodGet, "/api/stats/clients/header:k1?window=1h", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var got clientStats
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if got.ClientID != "header:k1" || got.TotalRequests != 12 || len(got.TopPaths) != 1 {
+		t.Errorf("Unexpected client stats %+v", got)
+	}
+	if budgets.identity != "header:k1" || len(budgets.ruleIDs) != 2 || budgets.ruleIDs[0] != "search" || budgets.ruleIDs[1] != "" {
+		t.Errorf("Budgets read for %q %q, want the client's rules", budgets.identity, budgets.ruleIDs)
+	}
+	if len(got.Budgets) != 2 || got.Budgets[0].Counter.Remaining != 3 {
+		t.Errorf("Unexpected budgets %+v", got.Budgets)
+	}
+}
+
+func TestClientStatsWithoutLimiter(t *testing.T) {
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithStats(&fakeStats{}),
+		WithBudgets(&fakeBudgets{err: errors.New("redis down")}))
+
+	w := doRequest(h, http.MethodGet, "/api/stats/clients/ip:1.1.1.1", "")
+	var got clientStats
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if got.TotalRequests != 12 || got.Budgets != nil {
+		t.Errorf("Expected stats without budgets, got %+v", got)
+	}
+
+	h = NewHandler(rules.NewInMemoryRepository(), testToken, WithStats(&fakeStats{}))
+	w = doRequest(h, http.MethodPost, "/api/stats/batch", `{"queries":[{"id":"c","type":"client","client_id":"ip:1.1.1.1"},{"id":"bad","type":"client"}]}`)
+	var batch struct {
+		Results map[string]struct {
+			Data  clientStats `json:"data"`
+			Error string      `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &batch); err != nil {
+		t.Fatalf("Failed to decode batch: %v", err)
+	}
+	if batch.Results["c"].Data.ClientID != "ip:1.1.1.1" || batch.Results["bad"].Error == "" {
+		t.Errorf("Unexpected batch results %+v", batch.Results)
+	}
+}
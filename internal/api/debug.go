@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Siruyy/gatify/internal/proxy"
+)
+
+// maxDebugLimit caps how many request diagnostics one call returns.
+const maxDebugLimit = 1000
+
+// DebugRecorder returns the diagnostics of the requests an instance
+// handled last. *proxy.DebugRing implements it.
+type DebugRecorder interface {
+	Recent(n int, keep func(proxy.Diagnostic) bool) []proxy.Diagnostic
+}
+
+// listDebugRequests returns the instance's latest request diagnostics,
+// newest first, optionally only those of a rule, client identity or
+// status.
+func (h *Handler) listDebugRequests(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxDebugLimit {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxDebugLimit))
+			return
+		}
+		limit = n
+	}
+	status := 0
+	if v := q.Get("status"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 100 || n > 599 {
+			writeError(w, http.StatusBadRequest, "status must be an HTTP status code")
+			return
+		}
+		status = n
+	}
+	rule, identity := q.Get("rule_id"), q.Get("identity")
+	keep := func(d proxy.Diagnostic) bool {
+		return (rule == "" || d.RuleID == rule) &&
+			(identity == "" || d.Identity == identity) &&
+			(status == 0 || d.Status == status)
+	}
+	writeJSON(w, http.StatusOK, h.debugRing.Recent(limit, keep))
+}
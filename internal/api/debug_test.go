@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/proxy"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/users"
+)
+
+func TestListDebugRequests(t *testing.T) {
+	if w := doRequest(newTestHandler(), http.MethodGet, "/api/admin/debug/requests", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 without a debug ring, got %d", w.Code)
+	}
+
+	ring := proxy.NewDebugRing(10)
+	ring.Add(proxy.Diagnostic{Path: "/a", RuleID: "r1", Identity: "ip:10.0.0.1", Status: http.StatusOK})
+	ring.Add(proxy.Diagnostic{Path: "/b", RuleID: "r2", Identity: "ip:10.0.0.1", Status: http.StatusTooManyRequests})
+	ring.Add(proxy.Diagnostic{Path: "/c", RuleID: "r1", Identity: "ip:10.0.0.2", Status: http.StatusOK})
+	auth := users.NewAuthenticator(users.NewInMemoryStore(), testToken)
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithUsers(auth), WithDebugRing(ring))
+
+	list := func(query string) []proxy.Diagnostic {
+		t.Helper()
+		w := doRequest(h, http.MethodGet, "/api/admin/debug/requests"+query, "")
+		var got []proxy.Diagnostic
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+		}
+		return got
+	}
+	if got := list(""); len(got) != 3 || got[0].Path != "/c" {
+		t.Errorf("Expected every request newest first, got %+v", got)
+	}
+	if got := list("?limit=1&rule_id=r1"); len(got) != 1 || got[0].Path != "/c" {
+		t.Errorf("Expected the newest r1 request, got %+v", got)
+	}
+	if got := list("?identity=ip:10.0.0.1&status=429"); len(got) != 1 || got[0].Path != "/b" {
+		t.Errorf("Expected the limited request, got %+v", got)
+	}
+	if w := doRequest(h, http.MethodGet, "/api/admin/debug/requests?limit=0", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a zero limit, got %d", w.Code)
+	}
+	if w := doRequest(h, http.MethodGet, "/api/admin/debug/requests?status=abc", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a bad status, got %d", w.Code)
+	}
+
+	reader := issueToken(t, h, users.RoleReadOnly)
+	if w := doRequestAs(h, reader.Secret, http.MethodGet, "/api/admin/debug/requests", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected diagnostics to be admin only, got %d", w.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/emergency"
+)
+
+type emergencyRequest struct {
+	LimitFactor     float64  `json:"limit_factor"`
+	BlockPaths      []string `json:"block_paths"`
+	Reason          string   `json:"reason"`
+	DurationSeconds int64    `json:"duration_seconds"`
+}
+
+type emergencyResponse struct {
+	Active bool             `json:"active"`
+	State  *emergency.State `json:"state,omitempty"`
+}
+
+func (h *Handler) getEmergency(w http.ResponseWriter, _ *http.Request) {
+	state, ok := h.emergency.Current()
+	if !ok {
+		writeJSON(w, http.StatusOK, emergencyResponse{})
+		return
+	}
+	writeJSON(w, http.StatusOK, emergencyResponse{Active: true, State: &state})
+}
+
+func (h *Handler) activateEmergency(w http.ResponseWriter, r *http.Request) {
+	var req emergencyRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if req.DurationSeconds < 0 {
+		writeError(w, http.StatusBadRequest, "duration_seconds must not be negative")
+		return
+	}
+
+	state := emergency.State{
+		LimitFactor: req.LimitFactor,
+		BlockPaths:  req.BlockPaths,
+		Reason:      req.Reason,
+	}
+	if err := state.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	state, err := h.emergency.Activate(r.Context(), state, time.Duration(req.DurationSeconds)*time.Second)
+	if err != nil {
+		log.Printf("Failed to activate emergency throttle: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to activate emergency throttle")
+		return
+	}
+
+	log.Printf("🚨 Emergency throttle activated: factor=%v block=%v reason=%q", state.LimitFactor, state.BlockPaths, state.Reason)
+	writeJSON(w, http.StatusOK, emergencyResponse{Active: true, State: &state})
+}
+
+func (h *Handler) deactivateEmergency(w http.ResponseWriter, r *http.Request) {
+	if err := h.emergency.Deactivate(r.Context()); err != nil {
+		log.Printf("Failed to lift emergency throttle: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to lift emergency throttle")
+		return
+	}
+
+	log.Println("✅ Emergency throttle lifted")
+	w.WriteHeader(http.StatusNoContent)
+}
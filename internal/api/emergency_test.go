@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/emergency"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+type kvStore struct {
+	storage.Storage
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func (s *kvStore) Get(_ context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	if !ok {
+		return "", storage.ErrKeyNotFound
+	}
+	return v, nil
+}
+
+func (s *kvStore) Set(_ context.Context, key, value string, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	return nil
+}
+
+func (s *kvStore) Delete(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range keys {
+		delete(s.data, k)
+	}
+	return nil
+}
+
+func TestEmergencyEndpoints(t *testing.T) {
+	sw := emergency.NewSwitch(&kvStore{data: make(map[string]string)}, time.Second)
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithEmergency(sw))
+
+	w := doRequest(h, http.MethodPost, "/api/admin/emergency", `{"limit_factor":0.1,"reason":"ddos","duration_seconds":600}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if sw.ClampLimit(100) != 10 {
+		t.Error("Expected switch to be active after POST")
+	}
+
+	w = doRequest(h, http.MethodGet, "/api/admin/emergency", "")
+	var resp emergencyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !resp.Active || resp.State.Reason != "ddos" || resp.State.ExpiresAt.IsZero() {
+		t.Errorf("Unexpected state %+v", resp.State)
+	}
+
+	w = doRequest(h, http.MethodDelete, "/api/admin/emergency", "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", w.Code)
+	}
+	if _, ok := sw.Current(); ok {
+		t.Error("Expected switch to be inactive after DELETE")
+	}
+}
+
+func TestEmergencyValidation(t *testing.T) {
+	sw := emergency.NewSwitch(&kvStore{data: make(map[string]string)}, time.Second)
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithEmergency(sw))
+
+	for _, body := range []string{`{}`, `{"limit_factor":2}`, `{"block_paths":["x"]}`, `{"limit_factor":0.5,"duration_seconds":-1}`} {
+		if w := doRequest(h, http.MethodPost, "/api/admin/emergency", body); w.Code != http.StatusBadRequest {
+			t.Errorf("Body %s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestEmergencyDisabledWithoutSwitch(t *testing.T) {
+	h := newTestHandler()
+	if w := doRequest(h, http.MethodPost, "/api/admin/emergency", `{"limit_factor":0.1}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without switch, got %d", w.Code)
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+)
+
+// ErasureRunner erases clients' stored analytics in background jobs.
+type ErasureRunner interface {
+	Start(clientID, mode string) (analytics.ErasureJob, error)
+	Job(id string) (analytics.ErasureJob, bool)
+}
+
+// eraseClient starts erasing a client's analytics, deleting its events or,
+// with mode=anonymize, unlinking them from the client. It answers 202
+// with the job, whose status is served at the Location.
+func (h *Handler) eraseClient(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = analytics.ErasureDelete
+	}
+	job, err := h.erasures.Start(r.PathValue("id"), mode)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/api/analytics/erasures/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (h *Handler) getErasure(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.erasures.Job(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "erasure job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// fakeErasures records the erasures started and reports them done.
+type fakeErasures struct {
+	started []string
+}
+
+func (f *fakeErasures) Start(clientID, mode string) (analytics.ErasureJob, error) {
+	if mode != analytics.ErasureDelete && mode != analytics.ErasureAnonymize {
+		return analytics.ErasureJob{}, errors.New("unknown mode")
+	}
+	f.started = append(f.started, clientID+" "+mode)
+	return analytics.ErasureJob{ID: "job1", Mode: mode, Status: analytics.ErasureRunning}, nil
+}
+
+func (f *fakeErasures) Job(id string) (analytics.ErasureJob, bool) {
+	if id != "job1" {
+		return analytics.ErasureJob{}, false
+	}
+	return analytics.ErasureJob{ID: id, Status: analytics.ErasureDone, Events: 42}, true
+}
+
+func TestEraseClient(t *testing.T) {
+	if w := doRequest(newTestHandler(), http.MethodDelete, "/api/analytics/clients/ip:10.0.0.1", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 without erasures, got %d", w.Code)
+	}
+
+	f := &fakeErasures{}
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithErasures(f))
+
+	w := doRequest(h, http.MethodDelete, "/api/analytics/clients/ip:10.0.0.1", "")
+	if w.Code != http.StatusAccepted || w.Header().Get("Location") != "/api/analytics/erasures/job1" {
+		t.Fatalf("Expected 202 with the job's location, got %d %v", w.Code, w.Header())
+	}
+	doRequest(h, http.MethodDelete, "/api/analytics/clients/header:abc?mode=anonymize", "")
+	if len(f.started) != 2 || f.started[0] != "ip:10.0.0.1 delete" || f.started[1] != "header:abc anonymize" {
+		t.Errorf("Unexpected erasures %q", f.started)
+	}
+	if w := doRequest(h, http.MethodDelete, "/api/analytics/clients/x?mode=shred", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown mode, got %d", w.Code)
+	}
+
+	w = doRequest(h, http.MethodGet, "/api/analytics/erasures/job1", "")
+	var job analytics.ErasureJob
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil || job.Status != analytics.ErasureDone || job.Events != 42 {
+		t.Fatalf("Unexpected job %d %s", w.Code, w.Body)
+	}
+	if w := doRequest(h, http.MethodGet, "/api/analytics/erasures/nope", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown job, got %d", w.Code)
+	}
+}
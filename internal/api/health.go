@@ -0,0 +1,18 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Siruyy/gatify/internal/upstream"
+)
+
+// HealthProvider reports the gateway's readiness and dependency health.
+type HealthProvider interface {
+	Health() upstream.Report
+}
+
+// getHealth answers 200 even when the gateway is not ready, unlike /ready,
+// since the dashboard wants the report rather than a probe result.
+func (h *Handler) getHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.health.Health())
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/upstream"
+)
+
+type fakeHealth upstream.Report
+
+func (f fakeHealth) Health() upstream.Report { return upstream.Report(f) }
+
+func TestGetHealth(t *testing.T) {
+	if w := doRequest(newTestHandler(), http.MethodGet, "/api/stats/health", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 without a health provider, got %d", w.Code)
+	}
+
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithHealth(fakeHealth{
+		Status:       upstream.StatusUnavailable,
+		RulesLoaded:  true,
+		Dependencies: []upstream.DependencyStatus{{Name: "redis", Critical: true, Probed: true, LastError: "connection refused"}},
+	}))
+	w := doRequest(h, http.MethodGet, "/api/stats/health", "")
+	var got upstream.Report
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if got.Status != upstream.StatusUnavailable || len(got.Dependencies) != 1 || got.Dependencies[0].LastError != "connection refused" {
+		t.Errorf("Unexpected report %+v", got)
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/Siruyy/gatify/internal/policy"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// WithPolicies enables the /api/policies endpoints, which manage the named
+// limit sets rules can reference, and makes rule mutations check that the
+// policy they name exists. changed runs after every successful mutation,
+// typically to recompile the proxy's rules.
+func WithPolicies(repo policy.Repository, changed func(ctx context.Context)) Option {
+	if changed == nil {
+		changed = func(context.Context) {}
+	}
+	return func(h *Handler) {
+		h.policies = repo
+		h.policiesChanged = changed
+	}
+}
+
+func (h *Handler) listPolicies(w http.ResponseWriter, r *http.Request) {
+	list, err := h.policies.List(r.Context())
+	if err != nil {
+		h.writePolicyError(w, "list", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) getPolicy(w http.ResponseWriter, r *http.Request) {
+	p, err := h.policies.Get(r.Context(), r.PathValue("name"))
+	if err != nil {
+		h.writePolicyError(w, "get", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (h *Handler) createPolicy(w http.ResponseWriter, r *http.Request) {
+	var p policy.Policy
+	if err := decodeJSON(w, r, &p); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	p.Normalize()
+	if err := p.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := h.policies.Create(r.Context(), p)
+	if err != nil {
+		h.writePolicyError(w, "create", err)
+		return
+	}
+	h.policiesChanged(r.Context())
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) updatePolicy(w http.ResponseWriter, r *http.Request) {
+	var p policy.Policy
+	if err := decodeJSON(w, r, &p); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	p.Name = r.PathValue("name")
+	p.Normalize()
+	if err := p.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	updated, err := h.policies.Update(r.Context(), p)
+	if err != nil {
+		h.writePolicyError(w, "update", err)
+		return
+	}
+	h.policiesChanged(r.Context())
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// deletePolicy refuses to delete a policy rules still reference, since
+// those rules would stop being enforced.
+func (h *Handler) deletePolicy(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	list, err := h.rules.List(r.Context())
+	if err != nil {
+		h.writePolicyError(w, "delete", err)
+		return
+	}
+	for _, rule := range list {
+		if rule.Policy == name {
+			writeError(w, http.StatusConflict, fmt.Sprintf("policy is used by rule %s", rule.ID))
+			return
+		}
+	}
+
+	if err := h.policies.Delete(r.Context(), name); err != nil {
+		h.writePolicyError(w, "delete", err)
+		return
+	}
+	h.policiesChanged(r.Context())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkRulePolicy reports a rule naming a policy that does not exist.
+func (h *Handler) checkRulePolicy(ctx context.Context, rule rules.Rule) (status int, err error) {
+	if h.policies == nil || rule.Policy == "" {
+		return 0, nil
+	}
+	_, err = h.policies.Get(ctx, rule.Policy)
+	switch {
+	case errors.Is(err, policy.ErrNotFound):
+		return http.StatusBadRequest, fmt.Errorf("unknown policy %q", rule.Policy)
+	case err != nil:
+		log.Printf("Failed to get policy %s: %v", rule.Policy, err)
+		return http.StatusInternalServerError, errors.New("failed to get policy")
+	}
+	return 0, nil
+}
+
+func (h *Handler) writePolicyError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, policy.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, policy.ErrExists):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		log.Printf("Failed to %s policy: %v", op, err)
+		writeError(w, http.StatusInternalServerError, "failed to "+op+" policy")
+	}
+}
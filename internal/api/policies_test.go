@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/policy"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+func TestPolicyEndpoints(t *testing.T) {
+	repo := policy.NewInMemoryRepository()
+	reloads := 0
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithPolicies(repo, func(context.Context) { reloads++ }))
+
+	w := doRequest(h, http.MethodPost, "/api/policies", `{"name":"free-tier","limit":100,"window_seconds":60,"quota":10000,"quota_period":"day"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(h, http.MethodPost, "/api/policies", `{"name":"free-tier","limit":5,"window_seconds":1}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a taken name, got %d", w.Code)
+	}
+	if w := doRequest(h, http.MethodPost, "/api/policies", `{"name":"pro","limit":0,"window_seconds":60}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid policy, got %d", w.Code)
+	}
+
+	if w := doRequest(h, http.MethodPost, "/api/rules", `{"name":"search","pattern":"/search","policy":"missing"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a rule naming an unknown policy, got %d", w.Code)
+	}
+	w = doRequest(h, http.MethodPost, "/api/rules", `{"name":"search","pattern":"/search","policy":"free-tier","enabled":true}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 for a rule using the policy, got %d: %s", w.Code, w.Body.String())
+	}
+	var rule rules.Rule
+	_ = json.Unmarshal(w.Body.Bytes(), &rule)
+
+	w = doRequest(h, http.MethodPut, "/api/policies/free-tier", `{"limit":200,"window_seconds":60}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	w = doRequest(h, http.MethodGet, "/api/policies", "")
+	var list []policy.Policy
+	_ = json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Limit != 200 || list[0].Quota != 0 {
+		t.Errorf("Unexpected list %+v", list)
+	}
+
+	if w := doRequest(h, http.MethodDelete, "/api/policies/free-tier", ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 deleting a policy in use, got %d", w.Code)
+	}
+	doRequest(h, http.MethodDelete, "/api/rules/"+rule.ID, "")
+	if w := doRequest(h, http.MethodDelete, "/api/policies/free-tier", ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", w.Code)
+	}
+	if w := doRequest(h, http.MethodGet, "/api/policies/free-tier", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %d", w.Code)
+	}
+	if reloads != 3 {
+		t.Errorf("Expected a reload per policy mutation, got %d", reloads)
+	}
+}
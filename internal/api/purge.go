@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+)
+
+// Purger deletes old analytics. *analytics.Retention implements it.
+type Purger interface {
+	// Window is the configured retention, zero when analytics are kept
+	// forever.
+	Window() time.Duration
+	PurgeBefore(ctx context.Context, before time.Time) (analytics.PurgeResult, error)
+}
+
+// purgeRequest is the optional body of POST /api/stats/purge.
+type purgeRequest struct {
+	// OlderThan overrides the retention window, such as "720h".
+	OlderThan string `json:"older_than"`
+}
+
+// purgeStats deletes analytics older than the retention window or the
+// requested age, and reports how much was deleted.
+func (h *Handler) purgeStats(w http.ResponseWriter, r *http.Request) {
+	var req purgeRequest
+	if err := decodeJSON(w, r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	age := h.purger.Window()
+	if req.OlderThan != "" {
+		d, err := time.ParseDuration(req.OlderThan)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "older_than must be a duration such as 720h")
+			return
+		}
+		age = d
+	}
+	if age == 0 {
+		writeError(w, http.StatusBadRequest, "older_than is required when ANALYTICS_RETENTION is not set")
+		return
+	}
+	if age < analytics.MinRetention {
+		writeError(w, http.StatusBadRequest, "older_than must be at least "+analytics.MinRetention.String()+", as rollups are recomputed from recent events")
+		return
+	}
+	res, err := h.purger.PurgeBefore(r.Context(), time.Now().Add(-age))
+	if err != nil {
+		log.Printf("Failed to purge analytics: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to purge analytics")
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/users"
+)
+
+// fakePurger records the cutoffs it is asked to purge before.
+type fakePurger struct {
+	window time.Duration
+	before []time.Time
+}
+
+func (f *fakePurger) Window() time.Duration { return f.window }
+
+func (f *fakePurger) PurgeBefore(_ context.Context, before time.Time) (analytics.PurgeResult, error) {
+	f.before = append(f.before, before)
+	return analytics.PurgeResult{Before: before, Chunks: 2, Events: 10, Rows: 5}, nil
+}
+
+func TestPurgeStats(t *testing.T) {
+	if w := doRequest(newTestHandler(), http.MethodPost, "/api/stats/purge", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 without a purger, got %d", w.Code)
+	}
+
+	f := &fakePurger{window: 30 * 24 * time.Hour}
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithPurge(f))
+
+	w := doRequest(h, http.MethodPost, "/api/stats/purge", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var res analytics.PurgeResult
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Events != 10 || res.Chunks != 2 {
+		t.Errorf("Unexpected result %s (%v)", w.Body, err)
+	}
+	if len(f.before) != 1 || time.Since(f.before[0])-f.window > time.Minute || time.Since(f.before[0]) < f.window {
+		t.Errorf("Expected a purge of events older than the retention window, got %v", f.before)
+	}
+
+	if w := doRequest(h, http.MethodPost, "/api/stats/purge", `{"older_than":"2160h"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 with older_than, got %d", w.Code)
+	}
+	if age := time.Since(f.before[1]); age < 2160*time.Hour || age > 2161*time.Hour {
+		t.Errorf("Expected a purge of events older than 90 days, got %v", f.before[1])
+	}
+
+	for body, want := range map[string]int{
+		`{"older_than":"1h"}`:     http.StatusBadRequest,
+		`{"older_than":"soon"}`:   http.StatusBadRequest,
+		`{"older_than":"-720h"}`:  http.StatusBadRequest,
+		`{"before":"2024-01-01"}`: http.StatusBadRequest,
+	} {
+		if w := doRequest(h, http.MethodPost, "/api/stats/purge", body); w.Code != want {
+			t.Errorf("%s: expected %d, got %d", body, want, w.Code)
+		}
+	}
+	if len(f.before) != 2 {
+		t.Errorf("Rejected requests purged: %v", f.before)
+	}
+}
+
+func TestPurgeStatsWithoutRetention(t *testing.T) {
+	f := &fakePurger{}
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithPurge(f))
+	if w := doRequest(h, http.MethodPost, "/api/stats/purge", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a retention window, got %d", w.Code)
+	}
+	if w := doRequest(h, http.MethodPost, "/api/stats/purge", `{"older_than":"720h"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 with older_than, got %d", w.Code)
+	}
+}
+
+func TestPurgeStatsIsAdminOnly(t *testing.T) {
+	h := NewHandler(rules.NewInMemoryRepository(), testToken,
+		WithUsers(users.NewAuthenticator(users.NewInMemoryStore(), testToken)),
+		WithPurge(&fakePurger{window: 30 * 24 * time.Hour}))
+	reader := issueToken(t, h, users.RoleReadOnly)
+	if w := doRequestAs(h, reader.Secret, http.MethodPost, "/api/stats/purge", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a read-only token, got %d", w.Code)
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/report"
+)
+
+// getSummaryReport renders the daily or weekly traffic report as HTML or,
+// with format=json, as JSON.
+func (h *Handler) getSummaryReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	period := query.Get("period")
+	if period == "" {
+		period = report.PeriodDaily
+	}
+	if !report.ValidPeriod(period) {
+		writeError(w, http.StatusBadRequest, report.ErrUnknownPeriod.Error())
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != "html" && format != "json" {
+		writeError(w, http.StatusBadRequest, "format must be html or json")
+		return
+	}
+
+	rep, err := report.Generate(r.Context(), h.reports, period, time.Now().UTC())
+	if err != nil {
+		log.Printf("Report generation failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "report generation failed")
+		return
+	}
+	if format == "json" {
+		writeJSON(w, http.StatusOK, rep)
+		return
+	}
+
+	// Render fully before writing so a template error can still be
+	// reported with a proper status.
+	var buf bytes.Buffer
+	if err := rep.WriteHTML(&buf); err != nil {
+		log.Printf("Report rendering failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "report generation failed")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+// ReportScheduler manages the schedules behind /api/reports/schedules.
+type ReportScheduler interface {
+	List(ctx context.Context) ([]report.Schedule, error)
+	Get(ctx context.Context, id string) (report.Schedule, error)
+	Create(ctx context.Context, sch report.Schedule) (report.Schedule, error)
+	Update(ctx context.Context, sch report.Schedule) (report.Schedule, error)
+	Delete(ctx context.Context, id string) error
+	Send(ctx context.Context, id string) error
+}
+
+func (h *Handler) listSchedules(w http.ResponseWriter, r *http.Request) {
+	list, err := h.schedules.List(r.Context())
+	if err != nil {
+		writeScheduleError(w, "list", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) getSchedule(w http.ResponseWriter, r *http.Request) {
+	sch, err := h.schedules.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeScheduleError(w, "get", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sch)
+}
+
+func (h *Handler) createSchedule(w http.ResponseWriter, r *http.Request) {
+	sch, ok := decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+	created, err := h.schedules.Create(r.Context(), sch)
+	if err != nil {
+		writeScheduleError(w, "create", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) updateSchedule(w http.ResponseWriter, r *http.Request) {
+	sch, ok := decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+	sch.ID = r.PathValue("id")
+	updated, err := h.schedules.Update(r.Context(), sch)
+	if err != nil {
+		writeScheduleError(w, "update", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) deleteSchedule(w http.ResponseWriter, r *http.Request) {
+	if err := h.schedules.Delete(r.Context(), r.PathValue("id")); err != nil {
+		writeScheduleError(w, "delete", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendSchedule delivers a schedule's report now, so targets can be tested
+// without waiting for the cron expression to fire.
+func (h *Handler) sendSchedule(w http.ResponseWriter, r *http.Request) {
+	err := h.schedules.Send(r.Context(), r.PathValue("id"))
+	if errors.Is(err, report.ErrScheduleNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Report delivery failed: %v", err)
+		writeError(w, http.StatusBadGateway, "report delivery failed: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+}
+
+func decodeSchedule(w http.ResponseWriter, r *http.Request) (report.Schedule, bool) {
+	var sch report.Schedule
+	if err := decodeJSON(w, r, &sch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return report.Schedule{}, false
+	}
+	sch.Normalize()
+	if err := sch.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return report.Schedule{}, false
+	}
+	return sch, true
+}
+
+func writeScheduleError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, report.ErrScheduleNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, report.ErrEmailDisabled):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Printf("Failed to %s report schedule: %v", op, err)
+		writeError(w, http.StatusInternalServerError, "failed to "+op+" report schedule")
+	}
+}
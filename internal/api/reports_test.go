@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+	"github.com/Siruyy/gatify/internal/report"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// fakeReports extends fakeStats with the top-N queries reports need.
+type fakeReports struct {
+	fakeStats
+	err error
+}
+
+func (f *fakeReports) TopClients(context.Context, time.Time, int) ([]analytics.ClientTraffic, error) {
+	return []analytics.ClientTraffic{{ClientID: "key:acme", Total: 8, Blocked: 2}}, f.err
+}
+
+func (f *fakeReports) TopRules(context.Context, time.Time, int) ([]analytics.RuleTraffic, error) {
+	return []analytics.RuleTraffic{{RuleID: "login", Total: 6, Blocked: 2}}, f.err
+}
+
+func TestSummaryReport(t *testing.T) {
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithReports(&fakeReports{}))
+
+	w := doRequest(h, http.MethodGet, "/api/reports/summary", "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Expected an HTML report, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "Daily traffic report") || !strings.Contains(w.Body.String(), "key:acme") {
+		t.Errorf("Unexpected report body:\n%s", w.Body.String())
+	}
+
+	w = doRequest(h, http.MethodGet, "/api/reports/summary?period=weekly&format=json", "")
+	var rep report.Report
+	if err := json.Unmarshal(w.Body.Bytes(), &rep); err != nil || rep.Period != report.PeriodWeekly || len(rep.TopRules) != 1 {
+		t.Errorf("Unexpected JSON report %d %s", w.Code, w.Body.String())
+	}
+
+	for _, path := range []string{"/api/reports/summary?period=monthly", "/api/reports/summary?format=pdf"} {
+		if w := doRequest(h, http.MethodGet, path, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestSummaryReportQueryError(t *testing.T) {
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithReports(&fakeReports{err: errors.New("pq: secret detail")}))
+
+	w := doRequest(h, http.MethodGet, "/api/reports/summary", "")
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("Expected a masked 500, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestReportScheduleEndpoints(t *testing.T) {
+	var delivered int
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { delivered++ }))
+	defer hook.Close()
+
+	store := report.NewScheduleStore(&kvStore{data: make(map[string]string)})
+	h := NewHandler(rules.NewInMemoryRepository(), testToken,
+		WithReportSchedules(report.NewScheduler(store, &fakeReports{}, nil)))
+
+	w := doRequest(h, http.MethodPost, "/api/reports/schedules",
+		`{"name":"ops","cron":"0  9 * * 1","period":"weekly","webhook_url":"`+hook.URL+`","enabled":true}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created report.Schedule
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	if created.ID == "" || created.Cron != "0 9 * * 1" {
+		t.Fatalf("Unexpected schedule %+v", created)
+	}
+
+	w = doRequest(h, http.MethodPut, "/api/reports/schedules/"+created.ID,
+		`{"name":"ops","cron":"0 8 * * 1","period":"weekly","webhook_url":"`+hook.URL+`","enabled":true}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"cron":"0 8 * * 1"`) {
+		t.Errorf("Unexpected update %d %s", w.Code, w.Body.String())
+	}
+
+	if w := doRequest(h, http.MethodPost, "/api/reports/schedules/"+created.ID+"/send", ""); w.Code != http.StatusOK || delivered != 1 {
+		t.Errorf("Expected an immediate delivery, got %d (%d deliveries)", w.Code, delivered)
+	}
+
+	w = doRequest(h, http.MethodGet, "/api/reports/schedules", "")
+	var list []report.Schedule
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != 1 {
+		t.Errorf("Unexpected list %d %s", w.Code, w.Body.String())
+	}
+
+	if w := doRequest(h, http.MethodDelete, "/api/reports/schedules/"+created.ID, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", w.Code)
+	}
+	if w := doRequest(h, http.MethodGet, "/api/reports/schedules/"+created.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %d", w.Code)
+	}
+}
+
+func TestReportScheduleValidation(t *testing.T) {
+	store := report.NewScheduleStore(&kvStore{data: make(map[string]string)})
+	h := NewHandler(rules.NewInMemoryRepository(), testToken,
+		WithReportSchedules(report.NewScheduler(store, &fakeReports{}, nil)))
+
+	for _, body := range []string{
+		`{"name":"ops","cron":"daily","webhook_url":"https://hooks.example.com/r"}`,
+		`{"name":"ops","cron":"0 9 * * *"}`,
+		// Email is rejected while no SMTP relay is configured.
+		`{"name":"ops","cron":"0 9 * * *","email_to":["ops@example.com"]}`,
+	} {
+		if w := doRequest(h, http.MethodPost, "/api/reports/schedules", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Siruyy/gatify/internal/changes"
+	"github.com/Siruyy/gatify/internal/limiter"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/rulestats"
+)
+
+// RuleStatsProvider reports live enforcement counters by rule ID.
+type RuleStatsProvider interface {
+	Stats(ctx context.Context, ruleIDs []string) (map[string]rulestats.Stats, error)
+}
+
+// ruleWithStats is a rule as listed by the API, with its live counters
+// when rule stats are enabled.
+type ruleWithStats struct {
+	rules.Rule
+	Stats *rulestats.Stats `json:"stats,omitempty"`
+}
+
+// listRules refuses a reader declaring an older rule schema when a rule
+// uses fields it would skip, such as a standby that would mirror the rule
+// and enforce it differently.
+func (h *Handler) listRules(w http.ResponseWriter, r *http.Request) {
+	version, err := rules.ParseSchemaVersion(r.Header.Get(rules.SchemaHeader))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	list, err := h.rules.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list rules: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to list rules")
+		return
+	}
+	if err := rules.CheckSchema(list, version); err != nil {
+		writeError(w, http.StatusNotAcceptable, err.Error())
+		return
+	}
+	w.Header().Set(rules.SchemaHeader, strconv.Itoa(rules.SchemaVersion))
+	writeJSON(w, http.StatusOK, h.withStats(r.Context(), list))
+}
+
+// withStats attaches live counters to rules. Counters are best effort: if
+// they cannot be read the rules are returned without them.
+func (h *Handler) withStats(ctx context.Context, list []rules.Rule) []ruleWithStats {
+	out := make([]ruleWithStats, len(list))
+	for i, rule := range list {
+		out[i].Rule = rule
+	}
+	if h.ruleStats == nil || len(list) == 0 {
+		return out
+	}
+	ids := make([]string, len(list))
+	for i, rule := range list {
+		ids[i] = rule.ID
+	}
+	stats, err := h.ruleStats.Stats(ctx, ids)
+	if err != nil {
+		log.Printf("Failed to read rule stats: %v", err)
+		return out
+	}
+	for i := range out {
+		if s, ok := stats[out[i].ID]; ok {
+			out[i].Stats = &s
+		}
+	}
+	return out
+}
+
+func (h *Handler) getRule(w http.ResponseWriter, r *http.Request) {
+	rule, err := h.rules.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeRuleError(w, "get", err)
+		return
+	}
+	w.Header().Set("ETag", ruleETag(rule))
+	w.Header().Set(rules.SchemaHeader, strconv.Itoa(rules.SchemaVersion))
+	writeJSON(w, http.StatusOK, h.withStats(r.Context(), []rules.Rule{rule})[0])
+}
+
+// decodeRule reads a rule body. Fields a client declaring a newer rule
+// schema sends are skipped rather than rejected, and listed in
+// X-Gatify-Ignored-Fields so the client knows they took no effect.
+func decodeRule(w http.ResponseWriter, r *http.Request, rule *rules.Rule) error {
+	version, err := rules.ParseSchemaVersion(r.Header.Get(rules.SchemaHeader))
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		return err
+	}
+	ignored, err := rules.DecodeRule(data, version, rule)
+	if len(ignored) > 0 {
+		w.Header().Set("X-Gatify-Ignored-Fields", strings.Join(ignored, ", "))
+	}
+	return err
+}
+
+// validateRule checks a rule, including against the gateway's limiter
+// algorithm when it runs under it.
+func (h *Handler) validateRule(rule *rules.Rule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	return rule.CheckAlgorithm(h.algorithm)
+}
+
+func (h *Handler) createRule(w http.ResponseWriter, r *http.Request) {
+	var rule rules.Rule
+	if err := decodeRule(w, r, &rule); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+
+	rule.Normalize()
+	if err := h.validateRule(&rule); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if status, err := h.checkRulePolicy(r.Context(), rule); err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+
+	created, err := h.rules.Create(r.Context(), rule)
+	if err != nil {
+		h.writeRuleError(w, "create", err)
+		return
+	}
+	h.rulesChanged(r.Context())
+	h.changes.Notify(changes.New(changes.ActionCreated, created, changes.Diff(nil, &created)))
+	w.Header().Set("ETag", ruleETag(created))
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// updateRule requires If-Match with the rule's current ETag so concurrent
+// editors cannot silently overwrite each other's changes.
+func (h *Handler) updateRule(w http.ResponseWriter, r *http.Request) {
+	match := r.Header.Get("If-Match")
+	if match == "" {
+		writeError(w, http.StatusPreconditionRequired, "If-Match header with the rule's ETag is required")
+		return
+	}
+	revision, ok := parseIfMatch(match)
+	if !ok {
+		writeError(w, http.StatusPreconditionFailed, rules.ErrRevisionConflict.Error())
+		return
+	}
+
+	var rule rules.Rule
+	if err := decodeRule(w, r, &rule); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+
+	rule.ID = r.PathValue("id")
+	rule.Revision = revision
+	rule.Normalize()
+	if err := h.validateRule(&rule); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if status, err := h.checkRulePolicy(r.Context(), rule); err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+
+	old := h.previous(r.Context(), rule.ID)
+	updated, err := h.rules.Update(r.Context(), rule)
+	if err != nil {
+		h.writeRuleError(w, "update", err)
+		return
+	}
+	h.rulesChanged(r.Context())
+	h.changes.Notify(changes.New(changes.ActionUpdated, updated, changes.Diff(old, &updated)))
+	w.Header().Set("ETag", ruleETag(updated))
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) deleteRule(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	old := h.previous(r.Context(), id)
+	if err := h.rules.Delete(r.Context(), id); err != nil {
+		h.writeRuleError(w, "delete", err)
+		return
+	}
+	h.rulesChanged(r.Context())
+	if old != nil {
+		h.changes.Notify(changes.New(changes.ActionDeleted, *old, changes.Diff(old, nil)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) listRevisions(w http.ResponseWriter, r *http.Request) {
+	revs, err := h.rules.Revisions(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeRuleError(w, "list revisions of", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, revs)
+}
+
+func (h *Handler) rollbackRule(w http.ResponseWriter, r *http.Request) {
+	rev, err := strconv.ParseInt(r.PathValue("rev"), 10, 64)
+	if err != nil || rev <= 0 {
+		writeError(w, http.StatusBadRequest, "revision must be a positive integer")
+		return
+	}
+
+	old := h.previous(r.Context(), r.PathValue("id"))
+	rule, err := h.rules.Rollback(r.Context(), r.PathValue("id"), rev)
+	if err != nil {
+		h.writeRuleError(w, "roll back", err)
+		return
+	}
+	h.rulesChanged(r.Context())
+	change := changes.New(changes.ActionUpdated, rule, changes.Diff(old, &rule))
+	change.Reason = "rolled back to revision " + strconv.FormatInt(rev, 10)
+	h.changes.Notify(change)
+	w.Header().Set("ETag", ruleETag(rule))
+	writeJSON(w, http.StatusOK, rule)
+}
+
+type resetResponse struct {
+	RuleID  string `json:"rule_id"`
+	Deleted int64  `json:"deleted"`
+}
+
+// resetCounters clears every client's counters for an existing rule.
+func (h *Handler) resetCounters(w http.ResponseWriter, r *http.Request) {
+	rule, err := h.rules.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeRuleError(w, "reset", err)
+		return
+	}
+
+	deleted, err := h.resetRule(r.Context(), rule)
+	if errors.Is(err, limiter.ErrResetInProgress) {
+		writeError(w, http.StatusConflict, "a reset of this rule is already in progress")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to reset counters for rule %s: %v", rule.ID, err)
+		writeError(w, http.StatusInternalServerError, "failed to reset rule counters")
+		return
+	}
+	log.Printf("Reset %d counters for rule %s", deleted, rule.ID)
+	writeJSON(w, http.StatusOK, resetResponse{RuleID: rule.ID, Deleted: deleted})
+}
+
+type namespaceResetResponse struct {
+	Namespace string `json:"namespace"`
+	Rules     int    `json:"rules"`
+	Deleted   int64  `json:"deleted"`
+}
+
+// resetNamespace clears the counters of every rule in a namespace, such as
+// all of one tenant's limits.
+func (h *Handler) resetNamespace(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !rules.ValidNamespace(name) {
+		writeError(w, http.StatusBadRequest, "invalid namespace")
+		return
+	}
+	list, err := h.rules.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list rules: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to list rules")
+		return
+	}
+
+	res := namespaceResetResponse{Namespace: name}
+	for _, rule := range list {
+		if rule.Namespace != name {
+			continue
+		}
+		deleted, err := h.resetRule(r.Context(), rule)
+		if errors.Is(err, limiter.ErrResetInProgress) {
+			writeError(w, http.StatusConflict, fmt.Sprintf("a reset of rule %s is already in progress", rule.ID))
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to reset counters for rule %s: %v", rule.ID, err)
+			writeError(w, http.StatusInternalServerError, "failed to reset namespace counters")
+			return
+		}
+		res.Rules++
+		res.Deleted += deleted
+	}
+	log.Printf("Reset %d counters for %d rules in namespace %s", res.Deleted, res.Rules, name)
+	writeJSON(w, http.StatusOK, res)
+}
+
+// previous returns the stored rule a mutation is about to replace, for
+// change notifications. It is nil when changes are not reported or the
+// rule cannot be read; the mutation itself reports the error.
+func (h *Handler) previous(ctx context.Context, id string) *rules.Rule {
+	if h.changes == nil {
+		return nil
+	}
+	rule, err := h.rules.Get(ctx, id)
+	if err != nil {
+		return nil
+	}
+	return &rule
+}
+
+func (h *Handler) writeRuleError(w http.ResponseWriter, op string, err error) {
+	if errors.Is(err, rules.ErrNotFound) || errors.Is(err, rules.ErrRevisionNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, rules.ErrRevisionConflict) {
+		writeError(w, http.StatusPreconditionFailed, err.Error())
+		return
+	}
+	log.Printf("Failed to %s rule: %v", op, err)
+	writeError(w, http.StatusInternalServerError, "failed to "+op+" rule")
+}
+
+// ruleETag identifies a stored version of a rule. Revisions only ever
+// grow, so the revision alone is a strong validator.
+func ruleETag(rule rules.Rule) string {
+	return `"` + strconv.FormatInt(rule.Revision, 10) + `"`
+}
+
+// parseIfMatch returns the revision named by an If-Match header. "*"
+// matches any revision and yields 0; weak or malformed tags never match.
+func parseIfMatch(header string) (int64, bool) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return 0, true
+	}
+	if len(header) < 3 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, false
+	}
+	rev, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+	if err != nil || rev <= 0 {
+		return 0, false
+	}
+	return rev, true
+}
@@ -0,0 +1,449 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/changes"
+	"github.com/Siruyy/gatify/internal/limiter"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/rulestats"
+)
+
+const testToken = "test-token"
+
+func newTestHandler() *Handler {
+	return NewHandler(rules.NewInMemoryRepository(), testToken)
+}
+
+func doRequest(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	return doRequestWithHeaders(h, method, path, body, nil)
+}
+
+func doRequestWithHeaders(h http.Handler, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandlerRequiresToken(t *testing.T) {
+	h := newTestHandler()
+
+	for _, auth := range []string{"", "Bearer wrong", testToken} {
+		req := httptest.NewRequest(http.MethodGet, "/api/rules", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected 401, got %d", auth, w.Code)
+		}
+	}
+}
+
+func TestHandlerDisabledWithoutToken(t *testing.T) {
+	h := NewHandler(rules.NewInMemoryRepository(), "")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/rules", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with empty admin token, got %d", w.Code)
+	}
+}
+
+func TestRuleLifecycle(t *testing.T) {
+	h := newTestHandler()
+
+	w := doRequest(h, http.MethodPost, "/api/rules",
+		`{"name":"login","pattern":"/login","methods":["post"],"limit":5,"window_seconds":60,"enabled":true}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var created rules.Rule
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to decode rule: %v", err)
+	}
+	if created.ID == "" || created.IdentifyBy != rules.IdentifyByIP || created.Methods[0] != "POST" {
+		t.Errorf("Unexpected created rule: %+v", created)
+	}
+
+	w = doRequest(h, http.MethodGet, "/api/rules/"+created.ID, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	w = doRequestWithHeaders(h, http.MethodPut, "/api/rules/"+created.ID,
+		`{"name":"login","pattern":"/login","limit":10,"window_seconds":60,"enabled":true}`,
+		map[string]string{"If-Match": w.Header().Get("ETag")})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from update, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doRequest(h, http.MethodGet, "/api/rules", "")
+	var list []rules.Rule
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode list: %v", err)
+	}
+	if len(list) != 1 || list[0].Limit != 10 {
+		t.Errorf("Expected one rule with limit 10, got %+v", list)
+	}
+
+	w = doRequest(h, http.MethodDelete, "/api/rules/"+created.ID, "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", w.Code)
+	}
+
+	w = doRequest(h, http.MethodGet, "/api/rules/"+created.ID, "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %d", w.Code)
+	}
+}
+
+func TestRulesChangedHook(t *testing.T) {
+	var calls int
+	h := NewHandler(rules.NewInMemoryRepository(), testToken,
+		WithRulesChanged(func(context.Context) { calls++ }))
+
+	w := doRequest(h, http.MethodPost, "/api/rules",
+		`{"name":"a","pattern":"/a","limit":1,"window_seconds":1,"enabled":true}`)
+	var created rules.Rule
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+
+	doRequestWithHeaders(h, http.MethodPut, "/api/rules/"+created.ID,
+		`{"name":"a","pattern":"/a","limit":2,"window_seconds":1,"enabled":true}`,
+		map[string]string{"If-Match": `"1"`})
+	doRequest(h, http.MethodPost, "/api/rules", `{"name":"invalid"}`)
+	doRequest(h, http.MethodDelete, "/api/rules/"+created.ID, "")
+
+	if calls != 3 {
+		t.Errorf("Expected hook after create, update and delete only, got %d calls", calls)
+	}
+}
+
+func TestRuleChangeNotifications(t *testing.T) {
+	notifier := changes.NewNotifier(nil, "")
+	var got []changes.RuleChange
+	notifier.Subscribe(func(c changes.RuleChange) { got = append(got, c) })
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithChangeNotifier(notifier))
+
+	w := doRequest(h, http.MethodPost, "/api/rules",
+		`{"name":"a","pattern":"/a","limit":1,"window_seconds":1,"enabled":true}`)
+	var created rules.Rule
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	doRequestWithHeaders(h, http.MethodPut, "/api/rules/"+created.ID,
+		`{"name":"a","pattern":"/a","limit":2,"window_seconds":1,"enabled":true}`,
+		map[string]string{"If-Match": `"1"`})
+	doRequest(h, http.MethodPost, "/api/rules/"+created.ID+"/rollback/1", "")
+	doRequest(h, http.MethodDelete, "/api/rules/"+created.ID, "")
+	doRequest(h, http.MethodDelete, "/api/rules/"+created.ID, "")
+
+	want := []string{changes.ActionCreated, changes.ActionUpdated, changes.ActionUpdated, changes.ActionDeleted}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d changes, got %+v", len(want), got)
+	}
+	for i, c := range got {
+		if c.Action != want[i] || c.RuleID != created.ID {
+			t.Errorf("Change %d: expected %s of %s, got %+v", i, want[i], created.ID, c)
+		}
+	}
+	if d := got[1].Diff; len(d) != 1 || d[0].Field != "limit" || d[0].Old != float64(1) || d[0].New != float64(2) {
+		t.Errorf("Expected the update to diff the limit, got %+v", d)
+	}
+	if got[2].Reason != "rolled back to revision 1" || len(got[2].Diff) != 1 {
+		t.Errorf("Unexpected rollback change: %+v", got[2])
+	}
+	if d := got[3].Diff; len(d) == 0 || d[0].New != nil {
+		t.Errorf("Expected the delete to diff the old fields, got %+v", d)
+	}
+}
+
+func TestCreateRuleValidation(t *testing.T) {
+	h := newTestHandler()
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"malformed", `{"name":`},
+		{"unknown field", `{"name":"x","pattern":"/x","limit":1,"window_seconds":1,"bogus":true}`},
+		{"invalid rule", `{"name":"x","pattern":"x","limit":1,"window_seconds":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(h, http.MethodPost, "/api/rules", tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestCreateRuleChecksLimiterAlgorithm(t *testing.T) {
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithLimiterAlgorithm("gcra"))
+	body := `{"name":"x","pattern":"/x","limit":1,"window_seconds":1,"burst":5}`
+
+	if w := doRequest(h, http.MethodPost, "/api/rules", body); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for burst under a gcra gateway, got %d", w.Code)
+	}
+	body = `{"name":"x","pattern":"/x","limit":1,"window_seconds":1,"burst":5,"algorithm":"sliding_window"}`
+	if w := doRequest(h, http.MethodPost, "/api/rules", body); w.Code != http.StatusCreated {
+		t.Errorf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCreateRuleFromNewerSchema(t *testing.T) {
+	h := newTestHandler()
+	body := `{"name":"x","pattern":"/x","limit":1,"window_seconds":1,"labels":["a"],"owner":"search-team"}`
+
+	w := doRequestWithHeaders(h, http.MethodPost, "/api/rules", body, map[string]string{rules.SchemaHeader: "99"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("X-Gatify-Ignored-Fields"); got != "labels, owner" {
+		t.Errorf("X-Gatify-Ignored-Fields = %q, want the skipped fields", got)
+	}
+
+	w = doRequestWithHeaders(h, http.MethodPost, "/api/rules", body, map[string]string{rules.SchemaHeader: "bogus"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid schema version, got %d", w.Code)
+	}
+}
+
+func TestListRulesForOlderSchema(t *testing.T) {
+	h := newTestHandler()
+	if w := doRequest(h, http.MethodPost, "/api/rules", `{"name":"x","pattern":"/x","limit":1,"window_seconds":1}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := doRequestWithHeaders(h, http.MethodGet, "/api/rules", "", map[string]string{rules.SchemaHeader: "1"})
+	if w.Code != http.StatusOK || w.Header().Get(rules.SchemaHeader) == "" {
+		t.Fatalf("Expected rules using no newer fields to be listed with the schema version, got %d", w.Code)
+	}
+
+	claim := `{"name":"y","pattern":"/y","limit":1,"window_seconds":1,"identify_by":"jwt_claim","jwt_claim":"sub"}`
+	if w := doRequest(h, http.MethodPost, "/api/rules", claim); w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	w = doRequestWithHeaders(h, http.MethodGet, "/api/rules", "", map[string]string{rules.SchemaHeader: "1"})
+	if w.Code != http.StatusNotAcceptable || !strings.Contains(w.Body.String(), "jwt_claim") {
+		t.Errorf("Expected 406 naming jwt_claim, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(h, http.MethodGet, "/api/rules", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected readers not declaring a version to be served, got %d", w.Code)
+	}
+}
+
+func TestRuleRevisionsAndRollback(t *testing.T) {
+	reloads := 0
+	h := NewHandler(rules.NewInMemoryRepository(), testToken,
+		WithRulesChanged(func(context.Context) { reloads++ }))
+
+	w := doRequest(h, http.MethodPost, "/api/rules",
+		`{"name":"login","pattern":"/login","limit":5,"window_seconds":60,"enabled":true}`)
+	var created rules.Rule
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to decode rule: %v", err)
+	}
+	doRequestWithHeaders(h, http.MethodPut, "/api/rules/"+created.ID,
+		`{"name":"login","pattern":"/login","limit":1,"window_seconds":60,"enabled":true}`,
+		map[string]string{"If-Match": `"1"`})
+
+	w = doRequest(h, http.MethodGet, "/api/rules/"+created.ID+"/revisions", "")
+	var revs []rules.Revision
+	if err := json.Unmarshal(w.Body.Bytes(), &revs); err != nil {
+		t.Fatalf("Failed to decode revisions: %v", err)
+	}
+	if len(revs) != 2 || revs[0].Revision != 2 || revs[0].Rule.Limit != 1 {
+		t.Fatalf("Unexpected revisions %+v", revs)
+	}
+
+	w = doRequest(h, http.MethodPost, "/api/rules/"+created.ID+"/rollback/1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var restored rules.Rule
+	if err := json.Unmarshal(w.Body.Bytes(), &restored); err != nil {
+		t.Fatalf("Failed to decode rule: %v", err)
+	}
+	if restored.Limit != 5 || restored.Revision != 3 {
+		t.Errorf("Expected limit 5 restored as revision 3, got %+v", restored)
+	}
+	if reloads != 3 {
+		t.Errorf("Expected rollback to reload rules, got %d reloads", reloads)
+	}
+
+	tests := map[string]int{
+		"/api/rules/" + created.ID + "/rollback/9":    http.StatusNotFound,
+		"/api/rules/" + created.ID + "/rollback/zero": http.StatusBadRequest,
+		"/api/rules/missing/rollback/1":               http.StatusNotFound,
+	}
+	for path, want := range tests {
+		if w := doRequest(h, http.MethodPost, path, ""); w.Code != want {
+			t.Errorf("POST %s: expected %d, got %d", path, want, w.Code)
+		}
+	}
+}
+
+func TestResetRuleCounters(t *testing.T) {
+	var resetErr error
+	var resetID string
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithCounterReset(func(_ context.Context, rule rules.Rule) (int64, error) {
+		resetID = rule.ID
+		return 7, resetErr
+	}))
+
+	w := doRequest(h, http.MethodPost, "/api/rules", `{"name":"login","pattern":"/login","limit":5,"window_seconds":60}`)
+	var created rules.Rule
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to decode rule: %v", err)
+	}
+
+	w = doRequest(h, http.MethodPost, "/api/rules/"+created.ID+"/reset", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"deleted":7`) || resetID != created.ID {
+		t.Fatalf("Unexpected reset response %d %s", w.Code, w.Body.String())
+	}
+
+	if w := doRequest(h, http.MethodPost, "/api/rules/missing/reset", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown rule, got %d", w.Code)
+	}
+
+	resetErr = limiter.ErrResetInProgress
+	if w := doRequest(h, http.MethodPost, "/api/rules/"+created.ID+"/reset", ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 while another reset runs, got %d", w.Code)
+	}
+
+	resetErr = errors.New("redis down")
+	if w := doRequest(h, http.MethodPost, "/api/rules/"+created.ID+"/reset", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 on storage error, got %d", w.Code)
+	}
+}
+
+func TestResetNamespaceCounters(t *testing.T) {
+	repo := rules.NewInMemoryRepository()
+	var resetIDs []string
+	h := NewHandler(repo, testToken, WithCounterReset(func(_ context.Context, rule rules.Rule) (int64, error) {
+		resetIDs = append(resetIDs, rule.ID)
+		return 3, nil
+	}))
+	ctx := context.Background()
+	acme, _ := repo.Create(ctx, rules.Rule{Name: "acme", Pattern: "/acme", Limit: 5, WindowSeconds: 60, Namespace: "acme"})
+	repo.Create(ctx, rules.Rule{Name: "other", Pattern: "/other", Limit: 5, WindowSeconds: 60, Namespace: "globex"})
+
+	w := doRequest(h, http.MethodPost, "/api/namespaces/acme/reset", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"rules":1,"deleted":3`) {
+		t.Fatalf("Unexpected reset response %d %s", w.Code, w.Body.String())
+	}
+	if len(resetIDs) != 1 || resetIDs[0] != acme.ID {
+		t.Errorf("Expected only the acme rule reset, got %v", resetIDs)
+	}
+
+	if w := doRequest(h, http.MethodPost, "/api/namespaces/a:b/reset", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid namespace, got %d", w.Code)
+	}
+}
+
+func TestResetDisabledWithoutOption(t *testing.T) {
+	if w := doRequest(newTestHandler(), http.MethodPost, "/api/rules/r1/reset", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected reset route to be absent, got %d", w.Code)
+	}
+}
+
+func TestUpdateRuleRequiresIfMatch(t *testing.T) {
+	h := newTestHandler()
+	w := doRequest(h, http.MethodPost, "/api/rules", `{"name":"login","pattern":"/login","limit":5,"window_seconds":60}`)
+	var created rules.Rule
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to decode rule: %v", err)
+	}
+	etag := doRequest(h, http.MethodGet, "/api/rules/"+created.ID, "").Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("Expected ETag \"1\", got %q", etag)
+	}
+
+	path := "/api/rules/" + created.ID
+	body := `{"name":"login","pattern":"/login","limit":7,"window_seconds":60}`
+	tests := []struct {
+		name    string
+		ifMatch string
+		want    int
+	}{
+		{"missing", "", http.StatusPreconditionRequired},
+		{"weak", `W/"1"`, http.StatusPreconditionFailed},
+		{"stale", `"9"`, http.StatusPreconditionFailed},
+		{"current", etag, http.StatusOK},
+		{"superseded", etag, http.StatusPreconditionFailed},
+		{"wildcard", "*", http.StatusOK},
+	}
+	for _, tt := range tests {
+		headers := map[string]string{}
+		if tt.ifMatch != "" {
+			headers["If-Match"] = tt.ifMatch
+		}
+		w := doRequestWithHeaders(h, http.MethodPut, path, body, headers)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, w.Code, w.Body.String())
+		}
+		if w.Code == http.StatusOK && w.Header().Get("ETag") == etag {
+			t.Errorf("%s: expected a new ETag after update", tt.name)
+		}
+	}
+}
+
+type fakeRuleStats struct {
+	stats map[string]rulestats.Stats
+	err   error
+}
+
+func (f fakeRuleStats) Stats(context.Context, []string) (map[string]rulestats.Stats, error) {
+	return f.stats, f.err
+}
+
+func TestListRulesIncludesStats(t *testing.T) {
+	repo := rules.NewInMemoryRepository()
+	rule, err := repo.Create(context.Background(), rules.Rule{Name: "login", Pattern: "/login", Limit: 5, WindowSeconds: 60, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	h := NewHandler(repo, testToken, WithRuleStats(fakeRuleStats{stats: map[string]rulestats.Stats{
+		rule.ID: {MatchedLastHour: 40, BlockedLastHour: 3, LastMatchedAt: &last},
+	}}))
+
+	w := doRequest(h, http.MethodGet, "/api/rules", "")
+	var list []struct {
+		rules.Rule
+		Stats *rulestats.Stats `json:"stats"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode list: %v", err)
+	}
+	if len(list) != 1 || list[0].Name != "login" || list[0].Stats == nil ||
+		list[0].Stats.MatchedLastHour != 40 || list[0].Stats.BlockedLastHour != 3 || !list[0].Stats.LastMatchedAt.Equal(last) {
+		t.Errorf("Unexpected list %s", w.Body.String())
+	}
+
+	// Unreadable counters leave the rules list intact.
+	h = NewHandler(repo, testToken, WithRuleStats(fakeRuleStats{err: errors.New("redis down")}))
+	w = doRequest(h, http.MethodGet, "/api/rules/"+rule.ID, "")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"stats"`) {
+		t.Errorf("Expected the rule without stats, got %d %s", w.Code, w.Body.String())
+	}
+}
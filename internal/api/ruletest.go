@@ -0,0 +1,71 @@
+package api
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/Siruyy/gatify/internal/proxy"
+)
+
+// RuleTester explains how the gateway would limit a request.
+type RuleTester interface {
+	Explain(r *http.Request) (proxy.Explanation, error)
+}
+
+// ruleTestRequest describes a hypothetical request to the gateway.
+type ruleTestRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	// ClientIP is the address the request comes from. It defaults to the
+	// caller's.
+	ClientIP string `json:"client_ip"`
+}
+
+// testRule reports the rule, identity and counter a request would be
+// checked against, without sending it through the gateway.
+func (h *Handler) testRule(w http.ResponseWriter, r *http.Request) {
+	var req ruleTestRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+	req.Method = strings.ToUpper(req.Method)
+	if !strings.HasPrefix(req.Path, "/") {
+		writeError(w, http.StatusBadRequest, "path must start with /")
+		return
+	}
+
+	probe, err := http.NewRequestWithContext(r.Context(), req.Method, req.Path, nil)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid method or path")
+		return
+	}
+	for name, value := range req.Headers {
+		probe.Header.Set(name, value)
+	}
+	probe.Host = probe.Header.Get("Host")
+	probe.RemoteAddr = r.RemoteAddr
+	if req.ClientIP != "" {
+		addr, err := netip.ParseAddr(req.ClientIP)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "client_ip must be an IP address")
+			return
+		}
+		probe.RemoteAddr = net.JoinHostPort(addr.String(), "0")
+	}
+
+	e, err := h.ruleTester.Explain(probe)
+	if err != nil {
+		log.Printf("Failed to test rules for %s %s: %v", req.Method, req.Path, err)
+		writeError(w, http.StatusInternalServerError, "failed to read counter state")
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
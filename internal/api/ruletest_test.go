@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/proxy"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+type fakeRuleTester struct {
+	got *http.Request
+}
+
+func (f *fakeRuleTester) Explain(r *http.Request) (proxy.Explanation, error) {
+	f.got = r
+	return proxy.Explanation{Rule: &rules.Rule{ID: "users"}, Key: "gatify:rl:{users}:header:k1"}, nil
+}
+
+func TestTestRule(t *testing.T) {
+	if w := doRequest(newTestHandler(), http.MethodPost, "/api/rules/test", `{"path":"/x"}`); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected 405 without a tester, got %d", w.Code)
+	}
+
+	tester := &fakeRuleTester{}
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithRuleTester(tester))
+
+	w := doRequest(h, http.MethodPost, "/api/rules/test",
+		`{"method":"post","path":"/api/users/7?page=2","headers":{"X-API-Key":"k1"},"client_ip":"203.0.113.9"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var got proxy.Explanation
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Rule == nil || got.Rule.ID != "users" {
+		t.Fatalf("Unexpected body %s", w.Body.String())
+	}
+	r := tester.got
+	if r.Method != http.MethodPost || r.URL.Path != "/api/users/7" || r.URL.Query().Get("page") != "2" {
+		t.Errorf("Unexpected probe %s %s", r.Method, r.URL)
+	}
+	if r.Header.Get("X-API-Key") != "k1" || r.RemoteAddr != "203.0.113.9:0" {
+		t.Errorf("Unexpected probe headers %v from %s", r.Header, r.RemoteAddr)
+	}
+
+	for _, body := range []string{`{"path":"api"}`, `{"path":"/x","client_ip":"host"}`, `{"path":"/x","bogus":1}`} {
+		if w := doRequest(h, http.MethodPost, "/api/rules/test", body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Siruyy/gatify/internal/shed"
+)
+
+// SheddingProvider reports the gateway's load shedding counters.
+type SheddingProvider interface {
+	Stats() shed.Stats
+}
+
+func (h *Handler) getShedding(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.shedding.Stats())
+}
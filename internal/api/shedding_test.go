@@ -0,0 +1,29 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/shed"
+)
+
+func TestGetShedding(t *testing.T) {
+	if w := doRequest(newTestHandler(), http.MethodGet, "/api/stats/shedding", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 without shedding, got %d", w.Code)
+	}
+
+	s := shed.New(0, 0)
+	s.Admit("search", 0)
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithShedding(s))
+
+	w := doRequest(h, http.MethodGet, "/api/stats/shedding", "")
+	var got shed.Stats
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if got.Shed != 1 || got.ByRule["search"] != 1 || got.ByPriority[0] != 1 {
+		t.Errorf("Unexpected stats %+v", got)
+	}
+}
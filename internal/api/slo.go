@@ -0,0 +1,24 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/Siruyy/gatify/internal/slo"
+)
+
+// SLOProvider reports the standing of the gateway's latency objectives.
+type SLOProvider interface {
+	Statuses(ctx context.Context) ([]slo.Status, error)
+}
+
+func (h *Handler) getSLOs(w http.ResponseWriter, r *http.Request) {
+	statuses, err := h.slos.Statuses(r.Context())
+	if err != nil {
+		log.Printf("SLO query failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "slo query failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
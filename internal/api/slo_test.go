@@ -0,0 +1,33 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/slo"
+)
+
+func TestGetSLOs(t *testing.T) {
+	if w := doRequest(newTestHandler(), http.MethodGet, "/api/stats/slos", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 without SLOs, got %d", w.Code)
+	}
+
+	tracker := slo.New([]slo.SLO{{Name: "api", Pattern: "/api/*", Threshold: 300 * time.Millisecond, Objective: 0.99}}, slo.Options{})
+	tracker.Record("/api/users", time.Second, time.Now())
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithSLOs(tracker))
+	if err := tracker.Flush(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	w := doRequest(h, http.MethodGet, "/api/stats/slos", "")
+	var got []slo.Status
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if len(got) != 1 || got[0].Name != "api" || got[0].Slow != 1 || !got[0].Exhausted {
+		t.Errorf("Unexpected statuses %+v", got)
+	}
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Siruyy/gatify/internal/standby"
+)
+
+// StandbyController reports and ends an instance's warm standby.
+type StandbyController interface {
+	Status() standby.Status
+	Promote() bool
+}
+
+func (h *Handler) getStandby(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, h.standby.Status())
+}
+
+// promoteStandby is idempotent: promoting a serving instance answers with
+// its status too.
+func (h *Handler) promoteStandby(w http.ResponseWriter, _ *http.Request) {
+	if h.standby.Promote() {
+		log.Println("👑 Promoted from standby, now serving traffic")
+	}
+	writeJSON(w, http.StatusOK, h.standby.Status())
+}
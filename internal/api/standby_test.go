@@ -0,0 +1,31 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/standby"
+)
+
+func TestStandbyEndpoints(t *testing.T) {
+	s := standby.New(standby.Options{Primary: "http://primary:8080"})
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithStandby(s))
+
+	w := doRequest(h, http.MethodGet, "/api/admin/standby", "")
+	var status standby.Status
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || w.Code != http.StatusOK || !status.Standby {
+		t.Fatalf("Expected a standby status, got %d %s", w.Code, w.Body.String())
+	}
+
+	for range 2 {
+		w = doRequest(h, http.MethodPost, "/api/admin/standby/promote", "")
+		if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || w.Code != http.StatusOK || status.Standby {
+			t.Fatalf("Expected promotion to succeed, got %d %s", w.Code, w.Body.String())
+		}
+	}
+	if s.Standby() {
+		t.Error("Expected the instance to serve traffic after promotion")
+	}
+}
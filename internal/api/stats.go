@@ -0,0 +1,346 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+)
+
+const (
+	defaultStatsWindow    = 24 * time.Hour
+	maxStatsWindow        = 90 * 24 * time.Hour
+	defaultTimelineBucket = time.Hour
+	// maxTimelinePoints bounds the number of buckets a timeline may return.
+	maxTimelinePoints = 2000
+	// maxBatchQueries bounds the work a single batch request can trigger.
+	maxBatchQueries = 20
+	defaultTopPaths = 10
+)
+
+// StatsProvider answers the analytics queries behind /api/stats.
+type StatsProvider interface {
+	Overview(ctx context.Context, since time.Time) (analytics.Overview, error)
+	RuleStats(ctx context.Context, ruleID string, since time.Time) (analytics.RuleStats, error)
+	Timeline(ctx context.Context, since time.Time, bucket time.Duration) ([]analytics.TimelinePoint, error)
+	ShadowComparison(ctx context.Context, since time.Time) (analytics.ShadowComparison, error)
+	AgentBreakdown(ctx context.Context, since time.Time) ([]analytics.AgentTraffic, error)
+	DimensionBreakdown(ctx context.Context, name string, since time.Time) ([]analytics.DimensionTraffic, error)
+	TopPaths(ctx context.Context, since time.Time, limit int) (analytics.TopPaths, error)
+	PathStats(ctx context.Context, route string, since time.Time) (analytics.PathStats, error)
+	ClientStats(ctx context.Context, clientID string, since time.Time) (analytics.ClientStats, error)
+}
+
+// Stat query types understood by the batch endpoint.
+const (
+	statOverview  = "overview"
+	statRule      = "rule"
+	statTimeline  = "timeline"
+	statShadow    = "shadow"
+	statAgents    = "agents"
+	statDimension = "dimension"
+	statTopPaths  = "top_paths"
+	statPath      = "path"
+	statClient    = "client"
+)
+
+// statQuery is one query in a batch request. Window and bucket are Go
+// duration strings such as "1h" or "15m".
+type statQuery struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	RuleID string `json:"rule_id,omitempty"`
+	// Dimension names the captured response header a dimension query
+	// breaks traffic down by.
+	Dimension string `json:"dimension,omitempty"`
+	// Route names the rule pattern or raw path a path query reports on.
+	Route string `json:"route,omitempty"`
+	// ClientID names the client a client query reports on, such as
+	// "ip:203.0.113.7".
+	ClientID string `json:"client_id,omitempty"`
+	Window   string `json:"window,omitempty"`
+	Bucket   string `json:"bucket,omitempty"`
+	// Limit is how many paths a top paths query ranks.
+	Limit int `json:"limit,omitempty"`
+}
+
+type batchRequest struct {
+	Queries []statQuery `json:"queries"`
+	// SnapshotID pins every query to the moment a snapshot was taken.
+	SnapshotID string `json:"snapshot_id,omitempty"`
+}
+
+// batchResult holds either a query's data or the error it failed with, so
+// one failing panel does not fail the whole dashboard.
+type batchResult struct {
+	Data  any    `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	SnapshotID string                 `json:"snapshot_id"`
+	Results    map[string]batchResult `json:"results"`
+}
+
+// snapshotHeader carries the snapshot a stats response was computed at,
+// so a dashboard can pass it on to its remaining panels.
+const snapshotHeader = "X-Stats-Snapshot"
+
+// statsSnapshot is a fixed point in time stats queries count events up
+// to. Its ID encodes the time itself, so snapshots need no storage and
+// work on every replica.
+type statsSnapshot struct {
+	ID   string    `json:"snapshot_id"`
+	AsOf time.Time `json:"as_of"`
+}
+
+func newStatsSnapshot(t time.Time) statsSnapshot {
+	t = t.Truncate(time.Millisecond).UTC()
+	return statsSnapshot{ID: strconv.FormatInt(t.UnixMilli(), 36), AsOf: t}
+}
+
+// resolveSnapshot returns the snapshot id names, or one taken now when id
+// is empty.
+func resolveSnapshot(id string) (statsSnapshot, error) {
+	if id == "" {
+		return newStatsSnapshot(time.Now()), nil
+	}
+	ms, err := strconv.ParseInt(id, 36, 64)
+	if err != nil || ms <= 0 || time.UnixMilli(ms).After(time.Now()) {
+		return statsSnapshot{}, badQueryError{fmt.Sprintf("invalid snapshot_id %q", id)}
+	}
+	return newStatsSnapshot(time.UnixMilli(ms)), nil
+}
+
+// getSnapshot takes a snapshot for a dashboard to pass as snapshot_id to
+// each of its stats queries.
+func (h *Handler) getSnapshot(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, newStatsSnapshot(time.Now()))
+}
+
+func (h *Handler) getOverview(w http.ResponseWriter, r *http.Request) {
+	q := statQuery{Type: statOverview, Window: r.URL.Query().Get("window")}
+	h.writeStat(w, r, q)
+}
+
+func (h *Handler) getRuleStats(w http.ResponseWriter, r *http.Request) {
+	q := statQuery{Type: statRule, RuleID: r.PathValue("id"), Window: r.URL.Query().Get("window")}
+	h.writeStat(w, r, q)
+}
+
+func (h *Handler) getTimeline(w http.ResponseWriter, r *http.Request) {
+	q := statQuery{
+		Type:   statTimeline,
+		Window: r.URL.Query().Get("window"),
+		Bucket: r.URL.Query().Get("bucket"),
+	}
+	h.writeStat(w, r, q)
+}
+
+func (h *Handler) getShadowComparison(w http.ResponseWriter, r *http.Request) {
+	q := statQuery{Type: statShadow, Window: r.URL.Query().Get("window")}
+	h.writeStat(w, r, q)
+}
+
+func (h *Handler) getAgentBreakdown(w http.ResponseWriter, r *http.Request) {
+	q := statQuery{Type: statAgents, Window: r.URL.Query().Get("window")}
+	h.writeStat(w, r, q)
+}
+
+func (h *Handler) getDimensionBreakdown(w http.ResponseWriter, r *http.Request) {
+	q := statQuery{Type: statDimension, Dimension: r.PathValue("name"), Window: r.URL.Query().Get("window")}
+	h.writeStat(w, r, q)
+}
+
+func (h *Handler) getTopPaths(w http.ResponseWriter, r *http.Request) {
+	q := statQuery{Type: statTopPaths, Window: r.URL.Query().Get("window")}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", analytics.MaxTopPaths))
+			return
+		}
+		q.Limit = n
+	}
+	h.writeStat(w, r, q)
+}
+
+// getPathStats reports on the route in the rest of the URL, so
+// /api/stats/paths/api/users/:id covers the /api/users/:id pattern.
+func (h *Handler) getPathStats(w http.ResponseWriter, r *http.Request) {
+	q := statQuery{Type: statPath, Route: "/" + r.PathValue("pattern"), Window: r.URL.Query().Get("window")}
+	h.writeStat(w, r, q)
+}
+
+func (h *Handler) writeStat(w http.ResponseWriter, r *http.Request, q statQuery) {
+	snap, err := resolveSnapshot(r.URL.Query().Get("snapshot_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	data, err := h.runStatQuery(r.Context(), snap.AsOf, q)
+	if err != nil {
+		var bad badQueryError
+		if errors.As(err, &bad) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("Stats query %s failed: %v", q.Type, err)
+		writeError(w, http.StatusInternalServerError, "stats query failed")
+		return
+	}
+	w.Header().Set(snapshotHeader, snap.ID)
+	writeJSON(w, http.StatusOK, data)
+}
+
+// batchStats evaluates several stat queries concurrently and returns their
+// results keyed by query ID. All queries count events up to the same
+// moment, the request's snapshot or the time the batch arrived.
+func (h *Handler) batchStats(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if len(req.Queries) == 0 {
+		writeError(w, http.StatusBadRequest, "queries must not be empty")
+		return
+	}
+	if len(req.Queries) > maxBatchQueries {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d queries per batch", maxBatchQueries))
+		return
+	}
+
+	seen := make(map[string]bool, len(req.Queries))
+	for _, q := range req.Queries {
+		if q.ID == "" {
+			writeError(w, http.StatusBadRequest, "every query needs an id")
+			return
+		}
+		if seen[q.ID] {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("duplicate query id %q", q.ID))
+			return
+		}
+		seen[q.ID] = true
+	}
+
+	snap, err := resolveSnapshot(req.SnapshotID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := batchResponse{SnapshotID: snap.ID, Results: make(map[string]batchResult, len(req.Queries))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, q := range req.Queries {
+		wg.Add(1)
+		go func(q statQuery) {
+			defer wg.Done()
+			data, err := h.runStatQuery(r.Context(), snap.AsOf, q)
+
+			result := batchResult{Data: data}
+			if err != nil {
+				var bad badQueryError
+				if !errors.As(err, &bad) {
+					log.Printf("Batch stats query %s (%s) failed: %v", q.ID, q.Type, err)
+					err = errors.New("stats query failed")
+				}
+				result = batchResult{Error: err.Error()}
+			}
+
+			mu.Lock()
+			resp.Results[q.ID] = result
+			mu.Unlock()
+		}(q)
+	}
+	wg.Wait()
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// badQueryError marks query parameters the client got wrong.
+type badQueryError struct{ msg string }
+
+func (e badQueryError) Error() string { return e.msg }
+
+// runStatQuery answers q as of now: the window ends at now and later
+// events are not counted.
+func (h *Handler) runStatQuery(ctx context.Context, now time.Time, q statQuery) (any, error) {
+	window, err := parseStatDuration("window", q.Window, defaultStatsWindow, maxStatsWindow)
+	if err != nil {
+		return nil, err
+	}
+	since := now.Add(-window)
+	ctx = analytics.AsOf(ctx, now)
+
+	switch q.Type {
+	case statOverview:
+		return h.stats.Overview(ctx, since)
+	case statRule:
+		if q.RuleID == "" {
+			return nil, badQueryError{"rule_id is required for rule stats"}
+		}
+		return h.stats.RuleStats(ctx, q.RuleID, since)
+	case statTimeline:
+		bucket, err := parseStatDuration("bucket", q.Bucket, defaultTimelineBucket, window)
+		if err != nil {
+			return nil, err
+		}
+		if window/bucket > maxTimelinePoints {
+			return nil, badQueryError{fmt.Sprintf("bucket too small: at most %d points per timeline", maxTimelinePoints)}
+		}
+		return h.stats.Timeline(ctx, since, bucket)
+	case statShadow:
+		return h.stats.ShadowComparison(ctx, since)
+	case statAgents:
+		return h.stats.AgentBreakdown(ctx, since)
+	case statDimension:
+		if strings.TrimSpace(q.Dimension) == "" {
+			return nil, badQueryError{"dimension is required for dimension stats"}
+		}
+		return h.stats.DimensionBreakdown(ctx, http.CanonicalHeaderKey(strings.TrimSpace(q.Dimension)), since)
+	case statTopPaths:
+		limit := q.Limit
+		if limit == 0 {
+			limit = defaultTopPaths
+		}
+		if limit < 1 || limit > analytics.MaxTopPaths {
+			return nil, badQueryError{fmt.Sprintf("limit must be between 1 and %d", analytics.MaxTopPaths)}
+		}
+		return h.stats.TopPaths(ctx, since, limit)
+	case statPath:
+		if !strings.HasPrefix(q.Route, "/") {
+			return nil, badQueryError{"route must start with /"}
+		}
+		return h.stats.PathStats(ctx, q.Route, since)
+	case statClient:
+		if strings.TrimSpace(q.ClientID) == "" {
+			return nil, badQueryError{"client_id is required for client stats"}
+		}
+		return h.clientStats(ctx, q.ClientID, since)
+	default:
+		return nil, badQueryError{fmt.Sprintf("unknown query type %q", q.Type)}
+	}
+}
+
+func parseStatDuration(name, raw string, fallback, max time.Duration) (time.Duration, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return 0, badQueryError{fmt.Sprintf("%s must be a positive duration such as 1h", name)}
+	}
+	if d > max {
+		return 0, badQueryError{fmt.Sprintf("%s must not exceed %s", name, max)}
+	}
+	return d, nil
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/stream"
+)
+
+type fakeStats struct {
+	ruleErr error
+}
+
+func (f *fakeStats) Overview(_ context.Context, since time.Time) (analytics.Overview, error) {
+	return analytics.Overview{Since: since, TotalRequests: 10, BlockedRequests: 2}, nil
+}
+
+func (f *fakeStats) RuleStats(_ context.Context, ruleID string, since time.Time) (analytics.RuleStats, error) {
+	if f.ruleErr != nil {
+		return analytics.RuleStats{}, f.ruleErr
+	}
+	return analytics.RuleStats{RuleID: ruleID, TotalRequests: 4}, nil
+}
+
+func (f *fakeStats) Timeline(_ context.Context, since time.Time, bucket time.Duration) ([]analytics.TimelinePoint, error) {
+	return []analytics.TimelinePoint{{Bucket: since.Truncate(bucket), Total: 3}}, nil
+}
+
+func (f *fakeStats) ShadowComparison(_ context.Context, since time.Time) (analytics.ShadowComparison, error) {
+	return analytics.ShadowComparison{Since: since, Evaluated: 10, Agreed: 9, AgreementRate: 0.9}, nil
+}
+
+func (f *fakeStats) AgentBreakdown(_ context.Context, since time.Time) ([]analytics.AgentTraffic, error) {
+	return []analytics.AgentTraffic{{Agent: "bot", Total: 5, Blocked: 1, BlockRate: 0.2}}, nil
+}
+
+func (f *fakeStats) DimensionBreakdown(_ context.Context, name string, since time.Time) ([]analytics.DimensionTraffic, error) {
+	return []analytics.DimensionTraffic{{Value: name + "=acme", Total: 4}}, nil
+}
+
+func (f *fakeStats) TopPaths(_ context.Context, since time.Time, limit int) (analytics.TopPaths, error) {
+	return analytics.TopPaths{
+		Since:         since,
+		MostRequested: []analytics.PathTraffic{{Route: "/api/users/:id", Total: int64(limit)}},
+		MostBlocked:   []analytics.PathTraffic{},
+	}, nil
+}
+
+func (f *fakeStats) PathStats(_ context.Context, route string, since time.Time) (analytics.PathStats, error) {
+	return analytics.PathStats{Route: route, Since: since, TotalRequests: 7}, nil
+}
+
+func (f *fakeStats) ClientStats(_ context.Context, clientID string, since time.Time) (analytics.ClientStats, error) {
+	return analytics.ClientStats{
+		ClientID:      clientID,
+		Since:         since,
+		TotalRequests: 12,
+		TopPaths:      []analytics.PathTraffic{{Route: "/search", Total: 12}},
+		Rules:         []analytics.RuleTraffic{{RuleID: "search", Total: 10}, {RuleID: "", Total: 2}},
+	}, nil
+}
+
+func TestStatsEndpoints(t *testing.T) {
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithStats(&fakeStats{}))
+
+	w := doRequest(h, http.MethodGet, "/api/stats/overview?window=1h", "")
+	var ov analytics.Overview
+	if err := json.Unmarshal(w.Body.Bytes(), &ov); err != nil || ov.TotalRequests != 10 {
+		t.Fatalf("Unexpected overview %d %s", w.Code, w.Body.String())
+	}
+	if time.Since(ov.Since) > time.Hour+time.Minute {
+		t.Errorf("Expected window of 1h, got since %v", ov.Since)
+	}
+
+	w = doRequest(h, http.MethodGet, "/api/stats/rules/r1", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"r1"`) {
+		t.Errorf("Unexpected rule stats %d %s", w.Code, w.Body.String())
+	}
+
+	w = doRequest(h, http.MethodGet, "/api/stats/shadow?window=6h", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"agreement_rate":0.9`) {
+		t.Errorf("Unexpected shadow comparison %d %s", w.Code, w.Body.String())
+	}
+
+	w = doRequest(h, http.MethodGet, "/api/stats/agents?window=1h", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"agent":"bot"`) {
+		t.Errorf("Unexpected agent breakdown %d %s", w.Code, w.Body.String())
+	}
+
+	w = doRequest(h, http.MethodGet, "/api/stats/dimensions/x-tenant?window=1h", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"value":"X-Tenant=acme"`) {
+		t.Errorf("Expected a breakdown by the canonical header, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = doRequest(h, http.MethodGet, "/api/stats/top-paths?window=1h", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"route":"/api/users/:id","total":10`) {
+		t.Errorf("Expected the default of 10 top paths, got %d %s", w.Code, w.Body.String())
+	}
+	w = doRequest(h, http.MethodGet, "/api/stats/top-paths?limit=3", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"total":3`) {
+		t.Errorf("Unexpected top paths %d %s", w.Code, w.Body.String())
+	}
+
+	w = doRequest(h, http.MethodGet, "/api/stats/paths/api/users/:id?window=6h", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"route":"/api/users/:id"`) {
+		t.Errorf("Unexpected path stats %d %s", w.Code, w.Body.String())
+	}
+
+	for _, path := range []string{
+		"/api/stats/overview?window=yesterday",
+		"/api/stats/overview?window=-1h",
+		"/api/stats/timeline?window=24h&bucket=1s",
+		"/api/stats/timeline?window=1h&bucket=2h",
+		"/api/stats/top-paths?limit=0",
+		"/api/stats/top-paths?limit=1000",
+		"/api/stats/top-paths?limit=ten",
+	} {
+		if w := doRequest(h, http.MethodGet, path, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestStatsDisabledWithoutProvider(t *testing.T) {
+	h := newTestHandler()
+	if w := doRequest(h, http.MethodGet, "/api/stats/overview", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without stats provider, got %d", w.Code)
+	}
+}
+
+func TestBatchStats(t *testing.T) {
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithStats(&fakeStats{ruleErr: errors.New("db down")}))
+
+	body := `{"queries":[
+		{"id":"ov","type":"overview","window":"24h"},
+		{"id":"r1","type":"rule","rule_id":"r1"},
+		{"id":"tl","type":"timeline","window":"6h","bucket":"1h"},
+		{"id":"bad","type":"histogram"}
+	]}`
+	w := doRequest(h, http.MethodPost, "/api/stats/batch", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Results map[string]struct {
+			Data  json.RawMessage `json:"data"`
+			Error string          `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(resp.Results))
+	}
+	if !strings.Contains(string(resp.Results["ov"].Data), `"total_requests":10`) {
+		t.Errorf("Unexpected overview result %s", resp.Results["ov"].Data)
+	}
+	if resp.Results["r1"].Error != "stats query failed" {
+		t.Errorf("Expected internal error to be masked, got %q", resp.Results["r1"].Error)
+	}
+	if resp.Results["tl"].Error != "" || len(resp.Results["tl"].Data) == 0 {
+		t.Errorf("Unexpected timeline result %+v", resp.Results["tl"])
+	}
+	if !strings.Contains(resp.Results["bad"].Error, "unknown query type") {
+		t.Errorf("Unexpected error for bad query %q", resp.Results["bad"].Error)
+	}
+}
+
+func TestStatsSnapshot(t *testing.T) {
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithStats(&fakeStats{}))
+
+	w := doRequest(h, http.MethodGet, "/api/stats/snapshot", "")
+	var snap statsSnapshot
+	if err := json.Unmarshal(w.Body.Bytes(), &snap); err != nil || snap.ID == "" {
+		t.Fatalf("Unexpected snapshot %d %s", w.Code, w.Body.String())
+	}
+
+	// Panels loaded later still count up to the snapshot.
+	time.Sleep(5 * time.Millisecond)
+	w = doRequest(h, http.MethodGet, "/api/stats/overview?window=1h&snapshot_id="+snap.ID, "")
+	var ov analytics.Overview
+	if err := json.Unmarshal(w.Body.Bytes(), &ov); err != nil {
+		t.Fatalf("Unexpected overview %d %s", w.Code, w.Body.String())
+	}
+	if !ov.Since.Equal(snap.AsOf.Add(-time.Hour)) {
+		t.Errorf("Expected window to end at %v, got since %v", snap.AsOf, ov.Since)
+	}
+	if got := w.Header().Get(snapshotHeader); got != snap.ID {
+		t.Errorf("Expected %s %q, got %q", snapshotHeader, snap.ID, got)
+	}
+
+	w = doRequest(h, http.MethodPost, "/api/stats/batch", `{"snapshot_id":"`+snap.ID+`","queries":[{"id":"ov","type":"overview","window":"1h"}]}`)
+	if !strings.Contains(w.Body.String(), `"snapshot_id":"`+snap.ID+`"`) || !strings.Contains(w.Body.String(), ov.Since.Format(time.RFC3339Nano)) {
+		t.Errorf("Expected the batch to use the snapshot, got %s", w.Body.String())
+	}
+
+	// Without a snapshot, the response names the one it was computed at.
+	w = doRequest(h, http.MethodGet, "/api/stats/overview", "")
+	if _, err := resolveSnapshot(w.Header().Get(snapshotHeader)); err != nil || w.Header().Get(snapshotHeader) == "" {
+		t.Errorf("Expected a usable snapshot header, got %q", w.Header().Get(snapshotHeader))
+	}
+
+	future := newStatsSnapshot(time.Now().Add(time.Hour)).ID
+	for _, id := range []string{"???", "0", future} {
+		if w := doRequest(h, http.MethodGet, "/api/stats/overview?snapshot_id="+id, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("snapshot_id %q: expected 400, got %d", id, w.Code)
+		}
+	}
+}
+
+func TestBatchStatsValidation(t *testing.T) {
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithStats(&fakeStats{}))
+
+	var many []string
+	for i := 0; i <= maxBatchQueries; i++ {
+		many = append(many, fmt.Sprintf(`{"id":"q%d","type":"overview"}`, i))
+	}
+
+	tests := map[string]string{
+		"empty":     `{"queries":[]}`,
+		"no id":     `{"queries":[{"type":"overview"}]}`,
+		"duplicate": `{"queries":[{"id":"a","type":"overview"},{"id":"a","type":"overview"}]}`,
+		"too many":  `{"queries":[` + strings.Join(many, ",") + `]}`,
+		"unknown":   `{"queries":[],"extra":true}`,
+		"snapshot":  `{"queries":[{"id":"a","type":"overview"}],"snapshot_id":"not-a-snapshot"}`,
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			if w := doRequest(h, http.MethodPost, "/api/stats/batch", body); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestStatsStreamSSE(t *testing.T) {
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithStream(stream.NewBroker()))
+
+	// A client that has already gone away ends the stream right after
+	// the headers.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/api/stats/stream/sse", nil).WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected an event stream, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+}
+
+func TestStreamSubscribers(t *testing.T) {
+	broker := stream.NewBroker()
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithStream(broker))
+	sub := broker.SubscribeAs(1, stream.SubscriberInfo{Transport: "websocket", Remote: "10.0.0.1:5000"})
+	defer sub.Close()
+	broker.Publish(stream.Event{Path: "/a"})
+	broker.Publish(stream.Event{Path: "/b"})
+
+	w := doRequest(h, http.MethodGet, "/api/admin/stream/subscribers", "")
+	var subs []stream.SubscriberStats
+	if err := json.Unmarshal(w.Body.Bytes(), &subs); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Expected a subscriber list, got %d %s", w.Code, w.Body.String())
+	}
+	if len(subs) != 1 || subs[0].Transport != "websocket" || subs[0].Dropped != 1 {
+		t.Errorf("Expected one websocket subscriber with 1 drop, got %+v", subs)
+	}
+}
@@ -0,0 +1,10 @@
+package api
+
+import "net/http"
+
+// listSubscribers reports each live stream subscriber with how many events
+// it lost by falling behind, so dashboards can tell when their view is
+// incomplete.
+func (h *Handler) listSubscribers(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, h.subscribers())
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/suggest"
+)
+
+// getSuggestions proposes rules for busy unprotected routes and clients
+// exceeding a reasonable rate. The window, min_requests and max_rpm query
+// parameters tune the analysis.
+func (h *Handler) getSuggestions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	window, err := parseStatDuration("window", query.Get("window"), defaultStatsWindow, maxStatsWindow)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var opts suggest.Options
+	var ok bool
+	if opts.MinRequests, ok = parsePositiveParam(query.Get("min_requests")); !ok {
+		writeError(w, http.StatusBadRequest, "min_requests must be a positive integer")
+		return
+	}
+	if opts.ReasonableRPM, ok = parsePositiveParam(query.Get("max_rpm")); !ok {
+		writeError(w, http.StatusBadRequest, "max_rpm must be a positive integer")
+		return
+	}
+
+	list, err := suggest.Analyze(r.Context(), h.suggestions, time.Now().Add(-window), opts)
+	if err != nil {
+		log.Printf("Rule suggestions failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "rule suggestions failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// parsePositiveParam parses an optional positive integer, returning 0 when
+// raw is empty.
+func parsePositiveParam(raw string) (int64, bool) {
+	if raw == "" {
+		return 0, true
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	return n, err == nil && n > 0
+}
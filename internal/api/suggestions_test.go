@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/suggest"
+)
+
+type fakeSuggestions struct {
+	err    error
+	minRPM int64
+}
+
+func (f *fakeSuggestions) UnprotectedRoutes(context.Context, time.Time, int64, int) ([]analytics.RouteTraffic, error) {
+	return []analytics.RouteTraffic{{Method: "GET", Route: "/search", Total: 500, Clients: 4, P95ClientRPM: 10}}, f.err
+}
+
+func (f *fakeSuggestions) HeavyClients(_ context.Context, _ time.Time, minRPM int64, _ int) ([]analytics.ClientRate, error) {
+	f.minRPM = minRPM
+	return nil, nil
+}
+
+func TestRuleSuggestions(t *testing.T) {
+	src := &fakeSuggestions{}
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithSuggestions(src))
+
+	w := doRequest(h, http.MethodGet, "/api/rules/suggestions?window=1h&max_rpm=30", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var list []suggest.Suggestion
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Decode suggestions: %v", err)
+	}
+	if len(list) != 1 || list[0].Rule.Pattern != "/search" || list[0].Rule.Limit != 20 {
+		t.Errorf("Unexpected suggestions %+v", list)
+	}
+	if src.minRPM != 30 {
+		t.Errorf("Expected max_rpm to be passed through, got %d", src.minRPM)
+	}
+
+	for _, path := range []string{"/api/rules/suggestions?window=soon", "/api/rules/suggestions?min_requests=-1"} {
+		if w := doRequest(h, http.MethodGet, path, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestRuleSuggestionsError(t *testing.T) {
+	h := NewHandler(rules.NewInMemoryRepository(), testToken, WithSuggestions(&fakeSuggestions{err: errors.New("pq: secret detail")}))
+
+	w := doRequest(h, http.MethodGet, "/api/rules/suggestions", "")
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("Expected opaque 500, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Siruyy/gatify/internal/users"
+)
+
+// defaultAuditLimit and maxAuditLimit bound GET /api/admin/audit.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type tokenRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// createdToken is a newly issued token with its secret, shown only once.
+type createdToken struct {
+	users.Token
+	Secret string `json:"secret"`
+}
+
+func (h *Handler) listTokens(w http.ResponseWriter, r *http.Request) {
+	list, err := h.users.Store().ListTokens(r.Context())
+	if err != nil {
+		log.Printf("Failed to list tokens: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to list tokens")
+		return
+	}
+	if list == nil {
+		list = []users.Token{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) createToken(w http.ResponseWriter, r *http.Request) {
+	var req tokenRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if req.Role == "" {
+		req.Role = users.RoleReadOnly
+	}
+
+	by, _ := users.FromContext(r.Context())
+	tok, secret, err := h.users.Issue(r.Context(), req.Name, req.Role, by)
+	if errors.Is(err, users.ErrInvalid) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to create token: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to create token")
+		return
+	}
+	log.Printf("🔑 Token %s (%s, %s) created by %s", tok.ID, tok.Name, tok.Role, by.Name)
+	writeJSON(w, http.StatusCreated, createdToken{Token: tok, Secret: secret})
+}
+
+func (h *Handler) revokeToken(w http.ResponseWriter, r *http.Request) {
+	err := h.users.Revoke(r.Context(), r.PathValue("id"))
+	if errors.Is(err, users.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to revoke token: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to revoke token")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) listAudit(w http.ResponseWriter, r *http.Request) {
+	limit := defaultAuditLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxAuditLimit {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxAuditLimit))
+			return
+		}
+		limit = n
+	}
+	entries, err := h.users.Store().ListAudit(r.Context(), limit)
+	if err != nil {
+		log.Printf("Failed to list audit log: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to list audit log")
+		return
+	}
+	if entries == nil {
+		entries = []users.AuditEntry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
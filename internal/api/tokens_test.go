@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/users"
+)
+
+func newUsersHandler() (*Handler, *users.Authenticator) {
+	auth := users.NewAuthenticator(users.NewInMemoryStore(), testToken)
+	return NewHandler(rules.NewInMemoryRepository(), testToken, WithUsers(auth)), auth
+}
+
+func doRequestAs(h http.Handler, token, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func issueToken(t *testing.T, h http.Handler, role string) createdToken {
+	t.Helper()
+	w := doRequest(h, http.MethodPost, "/api/admin/tokens", `{"name":"`+role+`-bot","role":"`+role+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created createdToken
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to decode token: %v", err)
+	}
+	return created
+}
+
+func TestTokenRoles(t *testing.T) {
+	h, _ := newUsersHandler()
+	reader := issueToken(t, h, users.RoleReadOnly)
+	admin := issueToken(t, h, users.RoleAdmin)
+	if reader.Secret == "" || reader.Role != users.RoleReadOnly || reader.CreatedBy != "ADMIN_API_TOKEN" {
+		t.Fatalf("Unexpected token %+v", reader)
+	}
+
+	if w := doRequestAs(h, reader.Secret, http.MethodGet, "/api/rules", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected a read-only token to list rules, got %d", w.Code)
+	}
+	rule := `{"name":"a","pattern":"/a","limit":1,"window_seconds":1,"enabled":true}`
+	if w := doRequestAs(h, reader.Secret, http.MethodPost, "/api/rules", rule); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a read-only token to be refused a mutation, got %d", w.Code)
+	}
+	if w := doRequestAs(h, reader.Secret, http.MethodGet, "/api/admin/tokens", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a read-only token to be refused the token list, got %d", w.Code)
+	}
+	if w := doRequestAs(h, admin.Secret, http.MethodPost, "/api/rules", rule); w.Code != http.StatusCreated {
+		t.Errorf("Expected an admin token to create a rule, got %d", w.Code)
+	}
+
+	if w := doRequest(h, http.MethodDelete, "/api/admin/tokens/"+admin.ID, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 from revoke, got %d", w.Code)
+	}
+	if w := doRequestAs(h, admin.Secret, http.MethodGet, "/api/rules", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a revoked token to be rejected, got %d", w.Code)
+	}
+	if w := doRequest(h, http.MethodDelete, "/api/admin/tokens/missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 revoking an unknown token, got %d", w.Code)
+	}
+
+	w := doRequest(h, http.MethodGet, "/api/admin/tokens", "")
+	var list []users.Token
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != 2 || list[1].RevokedAt == nil {
+		t.Errorf("Expected both tokens listed, the admin one revoked, got %s", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), reader.Secret) {
+		t.Error("Token list leaked a secret")
+	}
+}
+
+func TestCreateTokenValidation(t *testing.T) {
+	h, _ := newUsersHandler()
+	for _, body := range []string{`{"role":"admin"}`, `{"name":"x","role":"root"}`, `{"name":"x","scope":"all"}`} {
+		if w := doRequest(h, http.MethodPost, "/api/admin/tokens", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestAuditLogRecordsMutations(t *testing.T) {
+	h, _ := newUsersHandler()
+	admin := issueToken(t, h, users.RoleAdmin)
+
+	doRequestAs(h, admin.Secret, http.MethodPost, "/api/rules", `{"name":"a","pattern":"/a","limit":1,"window_seconds":1,"enabled":true}`)
+	doRequestAs(h, admin.Secret, http.MethodPost, "/api/rules", `{"name":"invalid"}`)
+	doRequestAs(h, admin.Secret, http.MethodGet, "/api/rules", "")
+
+	w := doRequest(h, http.MethodGet, "/api/admin/audit?limit=10", "")
+	var entries []users.AuditEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("Failed to decode audit log: %v", err)
+	}
+	// Newest first: the rejected create, the create, then issuing the token.
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 audited mutations, got %+v", entries)
+	}
+	if entries[0].TokenID != admin.ID || entries[0].Status != http.StatusBadRequest {
+		t.Errorf("Unexpected entry %+v", entries[0])
+	}
+	if entries[1].Path != "/api/rules" || entries[1].Status != http.StatusCreated || entries[1].TokenName != "admin-bot" {
+		t.Errorf("Unexpected entry %+v", entries[1])
+	}
+	if entries[2].TokenID != users.BootstrapID || entries[2].Path != "/api/admin/tokens" {
+		t.Errorf("Unexpected entry %+v", entries[2])
+	}
+
+	if w := doRequest(h, http.MethodGet, "/api/admin/audit?limit=0", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for limit=0, got %d", w.Code)
+	}
+}
@@ -0,0 +1,268 @@
+// Package ban keeps the clients banned from the gateway in storage shared
+// by every instance, and bans clients that keep hitting their rate limit.
+package ban
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+const (
+	// keyPrefix namespaces ban keys; the banned client follows it. Its
+	// hash tag keeps every ban on one cluster slot with banIndex.
+	keyPrefix = "gatify:ban:{bans}:"
+	// banIndex tracks the current bans, so listing them reads one index
+	// instead of scanning the keyspace.
+	banIndex = "gatify:ban:{bans}:index"
+	// strikePrefix namespaces the rate limit rejections counted towards
+	// an automatic ban. The client follows it in a hash tag, so lifting a
+	// ban can clear them through the scope index.
+	strikePrefix = "gatify:strikes:"
+)
+
+// ReasonRateLimit is the reason of bans set by a Policy.
+const ReasonRateLimit = "rate_limit"
+
+// Actions of ban Events.
+const (
+	ActionBan  = "ban"
+	ActionLift = "lift"
+)
+
+// Ban is a client's ban.
+type Ban struct {
+	Client    string    `json:"client"`
+	Reason    string    `json:"reason"`
+	BannedAt  time.Time `json:"banned_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Event reports a ban being set or lifted.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Client string    `json:"client"`
+	Reason string    `json:"reason,omitempty"`
+	// Duration is how long a ban lasts; it is zero for lifts.
+	Duration time.Duration `json:"duration"`
+}
+
+// Policy bans clients whose requests are rejected by a rate limit Strikes
+// times within Window, for Duration. A zero Strikes disables it.
+type Policy struct {
+	Strikes  int64
+	Window   time.Duration
+	Duration time.Duration
+}
+
+// Enabled reports whether the policy bans anyone.
+func (p Policy) Enabled() bool {
+	return p.Strikes > 0 && p.Window > 0 && p.Duration > 0
+}
+
+// Store records bans. A nil *Store bans nobody.
+type Store struct {
+	store   storage.Storage
+	now     func() time.Time
+	observe func(Event)
+}
+
+// New creates a Store backed by store.
+func New(store storage.Storage) *Store {
+	return &Store{store: store, now: time.Now, observe: func(Event) {}}
+}
+
+// SetObserver makes the store call fn for every ban it sets or lifts,
+// for example to record them in analytics. It must be called before the
+// store is used, and fn must not block.
+func (s *Store) SetObserver(fn func(Event)) {
+	s.observe = fn
+}
+
+// Ban bans client, an identity such as ip:203.0.113.7, for d, recording
+// why. Banning a client again replaces its ban.
+func (s *Store) Ban(ctx context.Context, client, reason string, d time.Duration) error {
+	if s == nil {
+		return nil
+	}
+	if d <= 0 {
+		return errors.New("ban duration must be positive")
+	}
+	now := s.now().UTC()
+	data, err := json.Marshal(Ban{Client: client, Reason: reason, BannedAt: now, ExpiresAt: now.Add(d)})
+	if err != nil {
+		return err
+	}
+	if err := s.store.Set(storage.WithIndex(ctx, banIndex), keyPrefix+client, string(data), d); err != nil {
+		return err
+	}
+	s.observe(Event{Time: now, Action: ActionBan, Client: client, Reason: reason, Duration: d})
+	return nil
+}
+
+// Banned reports whether client is banned, and why.
+func (s *Store) Banned(ctx context.Context, client string) (string, bool, error) {
+	if s == nil {
+		return "", false, nil
+	}
+	b, ok, err := s.get(ctx, client)
+	return b.Reason, ok, err
+}
+
+func (s *Store) get(ctx context.Context, client string) (Ban, bool, error) {
+	value, err := s.store.Get(ctx, keyPrefix+client)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return Ban{}, false, nil
+	}
+	if err != nil {
+		return Ban{}, false, err
+	}
+	return decode(client, value), true, nil
+}
+
+// decode reads a stored ban. Bans set by earlier versions hold only the
+// reason.
+func decode(client, value string) Ban {
+	var b Ban
+	if err := json.Unmarshal([]byte(value), &b); err != nil {
+		return Ban{Client: client, Reason: value}
+	}
+	b.Client = client
+	return b
+}
+
+// List returns every current ban, those expiring soonest first.
+func (s *Store) List(ctx context.Context) ([]Ban, error) {
+	if s == nil {
+		return []Ban{}, nil
+	}
+	values, err := s.store.GetIndexed(ctx, banIndex)
+	if err != nil {
+		return nil, fmt.Errorf("list bans: %w", err)
+	}
+	out := make([]Ban, 0, len(values))
+	for key, value := range values {
+		out = append(out, decode(strings.TrimPrefix(key, keyPrefix), value))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].ExpiresAt.Equal(out[j].ExpiresAt) {
+			return out[i].ExpiresAt.Before(out[j].ExpiresAt)
+		}
+		return out[i].Client < out[j].Client
+	})
+	return out, nil
+}
+
+// Lift ends client's ban early and forgets its strikes, reporting false
+// when it was not banned.
+func (s *Store) Lift(ctx context.Context, client string) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+	b, ok, err := s.get(ctx, client)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := s.store.Delete(ctx, keyPrefix+client); err != nil {
+		return false, err
+	}
+	if index, ok := storage.IndexKey(strikeKey(client)); ok {
+		if _, err := s.store.DeleteIndexed(ctx, index); err != nil {
+			log.Printf("⚠️  Failed to clear strikes of %s: %v", client, err)
+		}
+	}
+	s.observe(Event{Time: s.now().UTC(), Action: ActionLift, Client: client, Reason: b.Reason})
+	return true, nil
+}
+
+// Replace makes the current bans match list, the bans of another
+// instance with its own storage, such as a standby's primary. Bans in
+// list are set for the time they have left, and other bans are lifted.
+// Mirrored bans are not reported to the observer, since the instance
+// that set them already was. Bans without an expiry, set by earlier
+// versions, are left as they are. It reports whether anything changed.
+func (s *Store) Replace(ctx context.Context, list []Ban) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+	current, err := s.List(ctx)
+	if err != nil {
+		return false, err
+	}
+	have := make(map[string]Ban, len(current))
+	for _, b := range current {
+		have[b.Client] = b
+	}
+
+	now := s.now().UTC()
+	changed := false
+	want := make(map[string]bool, len(list))
+	for _, b := range list {
+		want[b.Client] = true
+		left := b.ExpiresAt.Sub(now)
+		if b.ExpiresAt.IsZero() || left <= 0 {
+			continue
+		}
+		if old, ok := have[b.Client]; ok && old.ExpiresAt.Equal(b.ExpiresAt) && old.Reason == b.Reason {
+			continue
+		}
+		data, err := json.Marshal(b)
+		if err != nil {
+			return changed, err
+		}
+		if err := s.store.Set(storage.WithIndex(ctx, banIndex), keyPrefix+b.Client, string(data), left); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+	for _, b := range current {
+		if want[b.Client] || b.ExpiresAt.IsZero() {
+			continue
+		}
+		if err := s.store.Delete(ctx, keyPrefix+b.Client); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// Strike counts a rate limit rejection of client against p and bans the
+// client once it reaches p.Strikes within p.Window, reporting whether it
+// did. Strikes are counted in a sliding window shared by every instance.
+func (s *Store) Strike(ctx context.Context, client string, p Policy) (bool, error) {
+	if s == nil || !p.Enabled() {
+		return false, nil
+	}
+	if p.Strikes > 1 {
+		// The window admits Strikes-1 hits; the one it rejects is the
+		// strike that earns the ban.
+		res, err := s.store.SlidingWindow(ctx, strikeKey(client), p.Strikes-1, p.Window)
+		if err != nil {
+			return false, err
+		}
+		if res.Allowed {
+			return false, nil
+		}
+	}
+	if err := s.Ban(ctx, client, ReasonRateLimit, p.Duration); err != nil {
+		return false, err
+	}
+	log.Printf("🚫 Banned %s for %s after %d rate limited requests within %s", client, p.Duration, p.Strikes, p.Window)
+	return true, nil
+}
+
+// strikeKey escapes client, so braces in an identity such as a header
+// value cannot end the hash tag early and share another client's index.
+func strikeKey(client string) string {
+	return strikePrefix + "{" + url.PathEscape(client) + "}"
+}
@@ -0,0 +1,201 @@
+package ban
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestStoreBans(t *testing.T) {
+	ctx := context.Background()
+	s := New(storage.NewMemoryStorage())
+
+	if _, banned, err := s.Banned(ctx, "10.0.0.1"); err != nil || banned {
+		t.Fatalf("Expected no ban, got %v %v", banned, err)
+	}
+	if err := s.Ban(ctx, "10.0.0.1", "honeypot", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	reason, banned, err := s.Banned(ctx, "10.0.0.1")
+	if err != nil || !banned || reason != "honeypot" {
+		t.Fatalf("Expected a honeypot ban, got %q %v %v", reason, banned, err)
+	}
+	if _, banned, _ := s.Banned(ctx, "10.0.0.2"); banned {
+		t.Error("Expected other clients not to be banned")
+	}
+	if err := s.Ban(ctx, "10.0.0.1", "honeypot", 0); err == nil {
+		t.Error("Expected a zero duration to be rejected")
+	}
+}
+
+func TestStoreBanExpires(t *testing.T) {
+	ctx := context.Background()
+	s := New(storage.NewMemoryStorage())
+	if err := s.Ban(ctx, "10.0.0.1", "honeypot", 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, banned, _ := s.Banned(ctx, "10.0.0.1"); banned {
+		t.Error("Expected the ban to lift once it expired")
+	}
+}
+
+func TestNilStoreBansNobody(t *testing.T) {
+	var s *Store
+	if err := s.Ban(context.Background(), "10.0.0.1", "honeypot", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, banned, _ := s.Banned(context.Background(), "10.0.0.1"); banned {
+		t.Error("Expected a nil store to ban nobody")
+	}
+}
+
+func TestStoreListsAndLiftsBans(t *testing.T) {
+	ctx := context.Background()
+	mem := storage.NewMemoryStorage()
+	s := New(mem)
+	var events []Event
+	s.SetObserver(func(e Event) { events = append(events, e) })
+
+	if err := s.Ban(ctx, "10.0.0.1", "honeypot", 2*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Ban(ctx, "10.0.0.2", ReasonRateLimit, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// A ban written by an earlier version holds only its reason; the key
+	// schema migration tracks it in the index.
+	if err := mem.Set(storage.WithIndex(ctx, banIndex), keyPrefix+"10.0.0.3", "honeypot", 3*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("Expected 3 bans, got %+v", list)
+	}
+	if list[0].Client != "10.0.0.3" || list[0].Reason != "honeypot" || !list[0].ExpiresAt.IsZero() {
+		t.Errorf("Expected the legacy ban first without times, got %+v", list[0])
+	}
+	if list[1].Client != "10.0.0.2" || list[1].Reason != ReasonRateLimit || list[1].ExpiresAt.Sub(list[1].BannedAt) != time.Hour {
+		t.Errorf("Unexpected ban %+v", list[1])
+	}
+
+	lifted, err := s.Lift(ctx, "10.0.0.2")
+	if err != nil || !lifted {
+		t.Fatalf("Lift() = %v, %v", lifted, err)
+	}
+	if _, banned, _ := s.Banned(ctx, "10.0.0.2"); banned {
+		t.Error("Expected the lifted client to be let in")
+	}
+	if lifted, _ := s.Lift(ctx, "10.0.0.2"); lifted {
+		t.Error("Expected lifting a client without a ban to report false")
+	}
+
+	if list, _ := s.List(ctx); len(list) != 2 {
+		t.Errorf("Expected the lifted ban dropped from the list, got %+v", list)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("Expected 2 bans and a lift observed, got %+v", events)
+	}
+	if e := events[2]; e.Action != ActionLift || e.Client != "10.0.0.2" || e.Reason != ReasonRateLimit {
+		t.Errorf("Unexpected lift event %+v", e)
+	}
+	if e := events[0]; e.Action != ActionBan || e.Duration != 2*time.Hour {
+		t.Errorf("Unexpected ban event %+v", e)
+	}
+}
+
+func TestStoreListIgnoresUntrackedKeys(t *testing.T) {
+	ctx := context.Background()
+	mem := storage.NewMemoryStorage()
+	s := New(mem)
+	// Listing reads the ban index and never scans the keyspace.
+	_ = mem.Set(ctx, keyPrefix+"stray", "honeypot", time.Hour)
+	if list, err := s.List(ctx); err != nil || len(list) != 0 {
+		t.Errorf("List() = %+v, %v; want no bans", list, err)
+	}
+}
+
+func TestStrikeKeyEscapesBraces(t *testing.T) {
+	a, _ := storage.IndexKey(strikeKey("header:a}b"))
+	b, _ := storage.IndexKey(strikeKey("header:a}c"))
+	if a == b {
+		t.Errorf("Expected clients with braces to keep separate strike indexes, both got %s", a)
+	}
+}
+
+func TestStrikeBansRepeatOffenders(t *testing.T) {
+	ctx := context.Background()
+	s := New(storage.NewMemoryStorage())
+	p := Policy{Strikes: 3, Window: time.Minute, Duration: time.Hour}
+
+	for i := 1; i <= 2; i++ {
+		if banned, err := s.Strike(ctx, "10.0.0.1", p); err != nil || banned {
+			t.Fatalf("strike %d: banned=%v err=%v", i, banned, err)
+		}
+	}
+	if banned, err := s.Strike(ctx, "10.0.0.2", p); err != nil || banned {
+		t.Fatalf("Expected strikes counted per client, got %v %v", banned, err)
+	}
+	if banned, err := s.Strike(ctx, "10.0.0.1", p); err != nil || !banned {
+		t.Fatalf("strike 3: banned=%v err=%v", banned, err)
+	}
+	reason, banned, _ := s.Banned(ctx, "10.0.0.1")
+	if !banned || reason != ReasonRateLimit {
+		t.Errorf("Expected a rate limit ban, got %q %v", reason, banned)
+	}
+
+	if banned, _ := s.Strike(ctx, "10.0.0.3", Policy{}); banned {
+		t.Error("Expected a disabled policy to ban nobody")
+	}
+	if banned, _ := s.Strike(ctx, "10.0.0.4", Policy{Strikes: 1, Window: time.Minute, Duration: time.Hour}); !banned {
+		t.Error("Expected a single strike policy to ban at once")
+	}
+}
+
+func TestStoreReplaceMirrorsBans(t *testing.T) {
+	ctx := context.Background()
+	mem := storage.NewMemoryStorage()
+	s := New(mem)
+	var events []Event
+	s.SetObserver(func(e Event) { events = append(events, e) })
+
+	if err := s.Ban(ctx, "10.0.0.9", "honeypot", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// A ban written by an earlier version holds only its reason.
+	if err := mem.Set(storage.WithIndex(ctx, banIndex), keyPrefix+"10.0.0.3", "honeypot", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	events = nil
+
+	now := time.Now().UTC().Truncate(time.Second)
+	primary := []Ban{
+		{Client: "10.0.0.1", Reason: ReasonRateLimit, BannedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{Client: "10.0.0.2", Reason: "honeypot", BannedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+	}
+	changed, err := s.Replace(ctx, primary)
+	if err != nil || !changed {
+		t.Fatalf("Replace() = %v, %v", changed, err)
+	}
+	list, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Client != "10.0.0.3" || list[1].Client != "10.0.0.1" || !list[1].ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected the primary's live ban and the legacy one, got %+v", list)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected mirrored bans not to be observed, got %+v", events)
+	}
+
+	if changed, err := s.Replace(ctx, primary); err != nil || changed {
+		t.Errorf("Expected an unchanged list to change nothing, got %v, %v", changed, err)
+	}
+}
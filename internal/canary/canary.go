@@ -0,0 +1,230 @@
+// Package canary sends synthetic requests through the gateway's full
+// proxy path, checking it end to end independently of real traffic.
+package canary
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Canary defaults applied to zero-valued Config fields.
+const (
+	DefaultMethod         = http.MethodGet
+	DefaultInterval       = 30 * time.Second
+	DefaultTimeout        = 5 * time.Second
+	DefaultExpectedStatus = http.StatusOK
+)
+
+// UserAgent identifies canary requests to the backend.
+const UserAgent = "gatify-canary"
+
+// ClientID is the client canary requests are recorded as.
+const ClientID = "canary"
+
+// Config describes the synthetic request.
+type Config struct {
+	Method         string
+	Path           string
+	Interval       time.Duration
+	Timeout        time.Duration
+	ExpectedStatus int
+}
+
+func (c Config) withDefaults() Config {
+	if c.Method == "" {
+		c.Method = DefaultMethod
+	}
+	if c.Interval <= 0 {
+		c.Interval = DefaultInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.ExpectedStatus == 0 {
+		c.ExpectedStatus = DefaultExpectedStatus
+	}
+	return c
+}
+
+// Result is the outcome of one synthetic request.
+type Result struct {
+	Time    time.Time     `json:"time"`
+	Method  string        `json:"method"`
+	Path    string        `json:"path"`
+	Success bool          `json:"success"`
+	Status  int           `json:"status"`
+	Latency time.Duration `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// Monitor periodically sends the synthetic request to a handler, usually
+// the gateway itself, and keeps the results for /metrics.
+type Monitor struct {
+	handler http.Handler
+	cfg     Config
+	record  func(Result)
+
+	mu       sync.Mutex
+	last     Result
+	checks   int64
+	failures int64
+}
+
+// New creates a Monitor sending cfg's request to handler. record, if
+// non-nil, is called with every result.
+func New(handler http.Handler, cfg Config, record func(Result)) *Monitor {
+	return &Monitor{handler: handler, cfg: cfg.withDefaults(), record: record}
+}
+
+// Run checks once per interval until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		m.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check sends the synthetic request once and records the result.
+func (m *Monitor) Check(ctx context.Context) Result {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+	defer cancel()
+
+	res := Result{Time: time.Now().UTC(), Method: m.cfg.Method, Path: m.cfg.Path}
+	req, err := http.NewRequestWithContext(ctx, m.cfg.Method, m.cfg.Path, nil)
+	if err != nil {
+		res.Error = err.Error()
+		m.store(res)
+		return res
+	}
+	req.RemoteAddr = "127.0.0.1:0"
+	req.Header.Set("User-Agent", UserAgent)
+
+	w := &discardWriter{header: make(http.Header)}
+	start := time.Now()
+	m.handler.ServeHTTP(w, req)
+	res.Latency = time.Since(start)
+	res.Status = w.statusCode()
+
+	switch {
+	case ctx.Err() != nil:
+		res.Error = fmt.Sprintf("timed out after %s", m.cfg.Timeout)
+	case res.Status != m.cfg.ExpectedStatus:
+		res.Error = fmt.Sprintf("status %d, expected %d", res.Status, m.cfg.ExpectedStatus)
+	default:
+		res.Success = true
+	}
+	m.store(res)
+	return res
+}
+
+func (m *Monitor) store(res Result) {
+	m.mu.Lock()
+	recovered := !m.last.Time.IsZero() && !m.last.Success && res.Success
+	failed := (m.last.Time.IsZero() || m.last.Success) && !res.Success
+	m.last = res
+	m.checks++
+	if !res.Success {
+		m.failures++
+	}
+	m.mu.Unlock()
+
+	if failed {
+		log.Printf("🐤 Canary %s %s failing: %s", res.Method, res.Path, res.Error)
+	} else if recovered {
+		log.Printf("🐤 Canary %s %s recovered", res.Method, res.Path)
+	}
+	if m.record != nil {
+		m.record(res)
+	}
+}
+
+// Last returns the most recent result, if any check has run.
+func (m *Monitor) Last() (Result, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last, !m.last.Time.IsZero()
+}
+
+// WriteMetrics writes the canary's metrics in the Prometheus text format.
+func (m *Monitor) WriteMetrics(w io.Writer) error {
+	m.mu.Lock()
+	last, checks, failures := m.last, m.checks, m.failures
+	m.mu.Unlock()
+
+	up := 0
+	if last.Success {
+		up = 1
+	}
+	var lastCheck float64
+	if !last.Time.IsZero() {
+		lastCheck = float64(last.Time.UnixMilli()) / 1000
+	}
+	_, err := fmt.Fprintf(w, `# HELP gatify_canary_up Whether the last synthetic request succeeded.
+# TYPE gatify_canary_up gauge
+gatify_canary_up %d
+# HELP gatify_canary_latency_seconds Latency of the last synthetic request.
+# TYPE gatify_canary_latency_seconds gauge
+gatify_canary_latency_seconds %g
+# HELP gatify_canary_checks_total Synthetic requests sent.
+# TYPE gatify_canary_checks_total counter
+gatify_canary_checks_total %d
+# HELP gatify_canary_failures_total Synthetic requests that failed.
+# TYPE gatify_canary_failures_total counter
+gatify_canary_failures_total %d
+# HELP gatify_canary_last_check_timestamp_seconds When the last synthetic request was sent.
+# TYPE gatify_canary_last_check_timestamp_seconds gauge
+gatify_canary_last_check_timestamp_seconds %g
+`, up, last.Latency.Seconds(), checks, failures, lastCheck)
+	return err
+}
+
+// MetricsHandler serves WriteMetrics.
+func (m *Monitor) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := m.WriteMetrics(w); err != nil {
+			log.Printf("Failed to write metrics: %v", err)
+		}
+	})
+}
+
+// discardWriter is the ResponseWriter of a synthetic request. Only the
+// status is kept.
+type discardWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *discardWriter) Header() http.Header { return w.header }
+
+func (w *discardWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return len(b), nil
+}
+
+// Flush implements http.Flusher, for handlers that stream.
+func (w *discardWriter) Flush() {}
+
+func (w *discardWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
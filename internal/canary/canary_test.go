@@ -0,0 +1,66 @@
+package canary
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitorCheck(t *testing.T) {
+	status := http.StatusOK
+	var seen *http.Request
+	var recorded []Result
+	m := New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r
+		w.WriteHeader(status)
+		w.Write([]byte("ok"))
+	}), Config{Path: "/healthz"}, func(r Result) { recorded = append(recorded, r) })
+
+	res := m.Check(context.Background())
+	if !res.Success || res.Status != http.StatusOK || res.Method != http.MethodGet {
+		t.Fatalf("Expected a successful check, got %+v", res)
+	}
+	if seen.URL.Path != "/healthz" || seen.UserAgent() != UserAgent {
+		t.Errorf("Unexpected synthetic request %s %s", seen.URL.Path, seen.UserAgent())
+	}
+
+	status = http.StatusBadGateway
+	res = m.Check(context.Background())
+	if res.Success || res.Error != "status 502, expected 200" {
+		t.Fatalf("Expected a failed check, got %+v", res)
+	}
+	if last, ok := m.Last(); !ok || last.Status != http.StatusBadGateway {
+		t.Errorf("Unexpected last result %+v", last)
+	}
+	if len(recorded) != 2 {
+		t.Errorf("Expected every result to be recorded, got %d", len(recorded))
+	}
+}
+
+func TestMonitorTimeout(t *testing.T) {
+	m := New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.WriteHeader(http.StatusOK)
+	}), Config{Path: "/slow", Timeout: 20 * time.Millisecond}, nil)
+
+	if res := m.Check(context.Background()); res.Success || !strings.Contains(res.Error, "timed out") {
+		t.Errorf("Expected the check to time out, got %+v", res)
+	}
+}
+
+func TestMonitorMetrics(t *testing.T) {
+	m := New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), Config{Path: "/"}, nil)
+	m.Check(context.Background())
+
+	var b strings.Builder
+	if err := m.WriteMetrics(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"gatify_canary_up 1\n", "gatify_canary_checks_total 1\n", "gatify_canary_failures_total 0\n"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("Expected %q in metrics:\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,636 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LetsEncrypt is the ACME directory of Let's Encrypt's production CA.
+const LetsEncrypt = "https://acme-v02.api.letsencrypt.org/directory"
+
+const (
+	// alpnProto is the ALPN protocol tls-alpn-01 challenges are answered
+	// on (RFC 8737).
+	alpnProto = "acme-tls/1"
+	// renewBefore is how long before expiry a certificate is renewed.
+	renewBefore = 30 * 24 * time.Hour
+	// checkInterval is how often the certificate's expiry is checked,
+	// and the longest wait between failed attempts.
+	checkInterval = 12 * time.Hour
+	// maxPolls bounds how long an authorization or order is waited on.
+	maxPolls = 120
+
+	accountKeyFile  = "account.key"
+	certificateFile = "certificate.pem"
+)
+
+// idPeAcmeIdentifier marks the tls-alpn-01 challenge certificate's
+// extension holding the key authorization digest.
+var idPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// ACMEOptions configures an ACMEManager.
+type ACMEOptions struct {
+	// DirectoryURL is the CA's ACME directory; LetsEncrypt by default.
+	DirectoryURL string
+	// Email is given to the CA as the account's contact, for expiry
+	// notices. It may be empty.
+	Email string
+	// Domains are the names the certificate covers. The first one is its
+	// subject.
+	Domains []string
+	// CacheDir keeps the account key and the issued certificate, so
+	// restarts do not request a new one.
+	CacheDir string
+	// HTTPClient talks to the CA; a client with a 30s timeout by default.
+	HTTPClient *http.Client
+}
+
+// ACMEManager obtains and renews a certificate from an ACME CA such as
+// Let's Encrypt. It answers the CA's tls-alpn-01 challenges through
+// GetCertificate on the gateway's own TLS listener, which must therefore
+// be reachable on port 443 of every domain.
+type ACMEManager struct {
+	opts   ACMEOptions
+	client *http.Client
+	poll   time.Duration
+	now    func() time.Time
+
+	cert atomic.Pointer[tls.Certificate]
+
+	mu         sync.Mutex
+	challenges map[string]*tls.Certificate
+}
+
+// NewACMEManager creates an ACMEManager, loading the certificate cached
+// by a previous run if there is one. Run obtains a certificate when none
+// is cached.
+func NewACMEManager(opts ACMEOptions) (*ACMEManager, error) {
+	if len(opts.Domains) == 0 {
+		return nil, errors.New("acme: no domains")
+	}
+	if opts.DirectoryURL == "" {
+		opts.DirectoryURL = LetsEncrypt
+	}
+	m := &ACMEManager{
+		opts:       opts,
+		client:     opts.HTTPClient,
+		poll:       time.Second,
+		now:        time.Now,
+		challenges: make(map[string]*tls.Certificate),
+	}
+	if m.client == nil {
+		m.client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if err := os.MkdirAll(opts.CacheDir, 0o700); err != nil {
+		return nil, fmt.Errorf("acme cache: %w", err)
+	}
+	data, err := os.ReadFile(filepath.Join(opts.CacheDir, certificateFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("acme cache: %w", err)
+	default:
+		cert, err := tls.X509KeyPair(data, data)
+		if err != nil {
+			log.Printf("⚠️  Ignoring unreadable cached certificate: %v", err)
+		} else {
+			m.cert.Store(&cert)
+		}
+	}
+	return m, nil
+}
+
+// TLSConfig returns a server configuration serving the managed
+// certificate and answering challenges.
+func (m *ACMEManager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1", alpnProto},
+	}
+}
+
+// GetCertificate implements tls.Config.GetCertificate. Handshakes
+// offering only the acme-tls/1 protocol are the CA validating a
+// challenge and get its challenge certificate.
+func (m *ACMEManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == alpnProto {
+		m.mu.Lock()
+		cert := m.challenges[strings.ToLower(hello.ServerName)]
+		m.mu.Unlock()
+		if cert == nil {
+			return nil, fmt.Errorf("acme: no pending challenge for %q", hello.ServerName)
+		}
+		return cert, nil
+	}
+	cert := m.cert.Load()
+	if cert == nil {
+		return nil, errors.New("acme: certificate not issued yet")
+	}
+	return cert, nil
+}
+
+// NotAfter returns when the current certificate expires, or the zero time
+// before one is issued.
+func (m *ACMEManager) NotAfter() time.Time {
+	if cert := m.cert.Load(); cert != nil && cert.Leaf != nil {
+		return cert.Leaf.NotAfter
+	}
+	return time.Time{}
+}
+
+// needsCertificate reports whether there is no certificate covering every
+// domain for longer than renewBefore.
+func (m *ACMEManager) needsCertificate() bool {
+	cert := m.cert.Load()
+	if cert == nil || cert.Leaf == nil || cert.Leaf.NotAfter.Sub(m.now()) < renewBefore {
+		return true
+	}
+	for _, d := range m.opts.Domains {
+		if cert.Leaf.VerifyHostname(d) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Run obtains a certificate if needed, then renews it before it expires,
+// until ctx is cancelled. Failed attempts are retried with backoff.
+func (m *ACMEManager) Run(ctx context.Context) {
+	retry := time.Minute
+	for {
+		wait := checkInterval
+		if m.needsCertificate() {
+			if err := m.Obtain(ctx); err != nil {
+				log.Printf("⚠️  Failed to obtain a certificate for %s, retrying in %s: %v",
+					strings.Join(m.opts.Domains, ", "), retry, err)
+				wait, retry = retry, min(2*retry, checkInterval)
+			} else {
+				retry = time.Minute
+				log.Printf("🔒 Obtained a certificate for %s, valid until %s",
+					strings.Join(m.opts.Domains, ", "), m.NotAfter().Format(time.RFC3339))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Obtain requests a new certificate for the domains and starts serving it.
+func (m *ACMEManager) Obtain(ctx context.Context) error {
+	key, err := m.accountKey()
+	if err != nil {
+		return err
+	}
+	c := &acmeClient{m: m, key: key}
+	if err := c.register(ctx); err != nil {
+		return err
+	}
+
+	identifiers := make([]map[string]string, len(m.opts.Domains))
+	for i, d := range m.opts.Domains {
+		identifiers[i] = map[string]string{"type": "dns", "value": d}
+	}
+	var order acmeOrder
+	resp, err := c.post(ctx, c.dir.NewOrder, map[string]any{"identifiers": identifiers}, &order)
+	if err != nil {
+		return fmt.Errorf("new order: %w", err)
+	}
+	orderURL := resp.Header.Get("Location")
+	for _, authz := range order.Authorizations {
+		if err := c.authorize(ctx, authz); err != nil {
+			return err
+		}
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.opts.Domains[0]},
+		DNSNames: m.opts.Domains,
+	}, certKey)
+	if err != nil {
+		return fmt.Errorf("create csr: %w", err)
+	}
+	if _, err := c.post(ctx, order.Finalize, map[string]string{"csr": b64(csr)}, &order); err != nil {
+		return fmt.Errorf("finalize order: %w", err)
+	}
+	for i := 0; order.Status != "valid"; i++ {
+		if order.Status == "invalid" || i == maxPolls {
+			return fmt.Errorf("order is %s", order.Status)
+		}
+		if err := m.sleep(ctx); err != nil {
+			return err
+		}
+		if _, err := c.post(ctx, orderURL, nil, &order); err != nil {
+			return fmt.Errorf("poll order: %w", err)
+		}
+	}
+
+	_, chain, err := c.postRaw(ctx, order.Certificate, nil)
+	if err != nil {
+		return fmt.Errorf("download certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(certKey)
+	if err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(chain, keyPEM)
+	if err != nil {
+		return fmt.Errorf("issued certificate: %w", err)
+	}
+	m.cert.Store(&cert)
+	if err := writeFile(filepath.Join(m.opts.CacheDir, certificateFile), append(keyPEM, chain...)); err != nil {
+		log.Printf("⚠️  Failed to cache the certificate: %v", err)
+	}
+	return nil
+}
+
+// accountKey loads the cached account key, creating one on first use.
+func (m *ACMEManager) accountKey() (*ecdsa.PrivateKey, error) {
+	path := filepath.Join(m.opts.CacheDir, accountKeyFile)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("acme account key %s: not PEM", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, fmt.Errorf("save acme account key: %w", err)
+	}
+	return key, nil
+}
+
+func (m *ACMEManager) sleep(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(m.poll):
+		return nil
+	}
+}
+
+// writeFile replaces path atomically, readable by its owner only.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+type acmeOrder struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+}
+
+type acmeAuthorization struct {
+	Status     string `json:"status"`
+	Identifier struct {
+		Value string `json:"value"`
+	} `json:"identifier"`
+	Challenges []struct {
+		Type   string       `json:"type"`
+		URL    string       `json:"url"`
+		Token  string       `json:"token"`
+		Status string       `json:"status"`
+		Error  *acmeProblem `json:"error"`
+	} `json:"challenges"`
+}
+
+// acmeProblem is an RFC 7807 error from the CA.
+type acmeProblem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+func (p *acmeProblem) Error() string {
+	return p.Type + ": " + p.Detail
+}
+
+// acmeClient speaks RFC 8555 to the CA for one Obtain call.
+type acmeClient struct {
+	m   *ACMEManager
+	key *ecdsa.PrivateKey
+	kid string
+	dir struct {
+		NewNonce   string `json:"newNonce"`
+		NewAccount string `json:"newAccount"`
+		NewOrder   string `json:"newOrder"`
+	}
+	nonce string
+}
+
+// register reads the directory and finds or creates the account.
+func (c *acmeClient) register(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.m.opts.DirectoryURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("acme directory: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("acme directory: status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&c.dir); err != nil {
+		return fmt.Errorf("acme directory: %w", err)
+	}
+
+	account := map[string]any{"termsOfServiceAgreed": true}
+	if c.m.opts.Email != "" {
+		account["contact"] = []string{"mailto:" + c.m.opts.Email}
+	}
+	resp, err = c.post(ctx, c.dir.NewAccount, account, nil)
+	if err != nil {
+		return fmt.Errorf("acme account: %w", err)
+	}
+	c.kid = resp.Header.Get("Location")
+	if c.kid == "" {
+		return errors.New("acme account: no account URL")
+	}
+	return nil
+}
+
+// authorize proves control of an authorization's domain through its
+// tls-alpn-01 challenge.
+func (c *acmeClient) authorize(ctx context.Context, url string) error {
+	var authz acmeAuthorization
+	if _, err := c.post(ctx, url, nil, &authz); err != nil {
+		return fmt.Errorf("authorization: %w", err)
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+	domain := authz.Identifier.Value
+	i := -1
+	for j, ch := range authz.Challenges {
+		if ch.Type == "tls-alpn-01" {
+			i = j
+		}
+	}
+	if i < 0 {
+		return fmt.Errorf("authorization of %s offers no tls-alpn-01 challenge", domain)
+	}
+	challenge := authz.Challenges[i]
+	cert, err := challengeCert(domain, challenge.Token+"."+thumbprint(c.key))
+	if err != nil {
+		return err
+	}
+	c.m.mu.Lock()
+	c.m.challenges[strings.ToLower(domain)] = cert
+	c.m.mu.Unlock()
+	defer func() {
+		c.m.mu.Lock()
+		delete(c.m.challenges, strings.ToLower(domain))
+		c.m.mu.Unlock()
+	}()
+
+	if _, err := c.post(ctx, challenge.URL, struct{}{}, nil); err != nil {
+		return fmt.Errorf("accept challenge for %s: %w", domain, err)
+	}
+	for i := 0; authz.Status != "valid"; i++ {
+		if authz.Status == "invalid" || i == maxPolls {
+			for _, ch := range authz.Challenges {
+				if ch.Error != nil {
+					return fmt.Errorf("challenge for %s failed: %w", domain, ch.Error)
+				}
+			}
+			return fmt.Errorf("authorization of %s is %s", domain, authz.Status)
+		}
+		if err := c.m.sleep(ctx); err != nil {
+			return err
+		}
+		if _, err := c.post(ctx, url, nil, &authz); err != nil {
+			return fmt.Errorf("poll authorization: %w", err)
+		}
+	}
+	return nil
+}
+
+// post sends a signed request, decoding a JSON response into out when it
+// is not nil. A nil payload makes a POST-as-GET.
+func (c *acmeClient) post(ctx context.Context, url string, payload, out any) (*http.Response, error) {
+	resp, body, err := c.postRaw(ctx, url, payload)
+	if err != nil || out == nil {
+		return resp, err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return resp, fmt.Errorf("decode %s: %w", url, err)
+	}
+	return resp, nil
+}
+
+// postRaw sends a signed request and returns the response body, retrying
+// once when the CA rejects the nonce.
+func (c *acmeClient) postRaw(ctx context.Context, url string, payload any) (*http.Response, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		resp, body, err := c.send(ctx, url, payload)
+		var problem *acmeProblem
+		if attempt == 0 && errors.As(err, &problem) && problem.Type == "urn:ietf:params:acme:error:badNonce" {
+			continue
+		}
+		return resp, body, err
+	}
+}
+
+func (c *acmeClient) send(ctx context.Context, url string, payload any) (*http.Response, []byte, error) {
+	if c.nonce == "" {
+		if err := c.fetchNonce(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	jws, err := c.sign(url, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jws))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/jose+json")
+	resp, err := c.m.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	c.nonce = resp.Header.Get("Replay-Nonce")
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		problem := &acmeProblem{}
+		if json.Unmarshal(body, problem) != nil || problem.Type == "" {
+			return resp, nil, fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return resp, nil, problem
+	}
+	return resp, body, nil
+}
+
+func (c *acmeClient) fetchNonce(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.dir.NewNonce, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("acme nonce: %w", err)
+	}
+	resp.Body.Close()
+	c.nonce = resp.Header.Get("Replay-Nonce")
+	if c.nonce == "" {
+		return errors.New("acme nonce: none returned")
+	}
+	return nil
+}
+
+// sign builds the flattened JWS of a request (RFC 8555, section 6.2). The
+// account is named by its key until it has a URL.
+func (c *acmeClient) sign(url string, payload any) ([]byte, error) {
+	protected := map[string]any{"alg": "ES256", "nonce": c.nonce, "url": url}
+	if c.kid == "" {
+		protected["jwk"] = jwk(c.key)
+	} else {
+		protected["kid"] = c.kid
+	}
+	header, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	if payload != nil {
+		if body, err = json.Marshal(payload); err != nil {
+			return nil, err
+		}
+	}
+	signingInput := b64(header) + "." + b64(body)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := signES256(c.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]string{
+		"protected": b64(header),
+		"payload":   b64(body),
+		"signature": b64(sig),
+	})
+}
+
+// signES256 signs digest as JWS wants it: r and s as 32 bytes each.
+func signES256(key *ecdsa.PrivateKey, digest []byte) ([]byte, error) {
+	der, err := key.Sign(rand.Reader, digest, crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 64)
+	sig.R.FillBytes(out[:32])
+	sig.S.FillBytes(out[32:])
+	return out, nil
+}
+
+// jwk returns the public JSON Web Key of key, with its members in the
+// lexicographic order thumbprints require.
+func jwk(key *ecdsa.PrivateKey) map[string]string {
+	pub, err := key.PublicKey.ECDH()
+	if err != nil {
+		panic(err) // P-256 keys always convert
+	}
+	point := pub.Bytes() // 0x04 || X || Y
+	return map[string]string{"crv": "P-256", "kty": "EC", "x": b64(point[1:33]), "y": b64(point[33:])}
+}
+
+// thumbprint returns the RFC 7638 thumbprint of key's JWK.
+func thumbprint(key *ecdsa.PrivateKey) string {
+	k := jwk(key)
+	canonical := `{"crv":"P-256","kty":"EC","x":"` + k["x"] + `","y":"` + k["y"] + `"}`
+	sum := sha256.Sum256([]byte(canonical))
+	return b64(sum[:])
+}
+
+// challengeCert creates the self-signed certificate answering a
+// tls-alpn-01 challenge for domain (RFC 8737, section 3).
+func challengeCert(domain, keyAuth string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(keyAuth))
+	value, err := asn1.Marshal(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:    serial,
+		Subject:         pkix.Name{CommonName: "ACME challenge"},
+		NotBefore:       now.Add(-time.Hour),
+		NotAfter:        now.Add(24 * time.Hour),
+		DNSNames:        []string{domain},
+		ExtraExtensions: []pkix.Extension{{Id: idPeAcmeIdentifier, Critical: true, Value: value}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("challenge certificate: %w", err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
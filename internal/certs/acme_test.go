@@ -0,0 +1,430 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCA is a minimal ACME server. It checks every request's signature and
+// nonce, and validates tls-alpn-01 challenges by asking the manager for
+// the challenge certificate, as a real CA would over a TLS handshake.
+type fakeCA struct {
+	t      *testing.T
+	srv    *httptest.Server
+	m      *ACMEManager
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+	// failChallenge makes every challenge fail validation.
+	failChallenge bool
+
+	mu          sync.Mutex
+	nonce       int
+	nonces      map[string]bool
+	account     *ecdsa.PublicKey
+	authzStatus string
+	orderStatus string
+	chain       []byte
+}
+
+func newFakeCA(t *testing.T) *fakeCA {
+	t.Helper()
+	ca := &fakeCA{t: t, nonces: map[string]bool{}, authzStatus: "pending", orderStatus: "pending"}
+	var err error
+	if ca.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &ca.caKey.PublicKey, ca.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca.caCert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	ca.srv = httptest.NewServer(http.HandlerFunc(ca.serve))
+	t.Cleanup(ca.srv.Close)
+	return ca
+}
+
+func (ca *fakeCA) url(path string) string { return ca.srv.URL + path }
+
+func (ca *fakeCA) newNonce(w http.ResponseWriter) {
+	ca.nonce++
+	n := fmt.Sprintf("nonce-%d", ca.nonce)
+	ca.nonces[n] = true
+	w.Header().Set("Replay-Nonce", n)
+}
+
+func (ca *fakeCA) problem(w http.ResponseWriter, status int, typ, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"type": typ, "detail": detail})
+}
+
+func (ca *fakeCA) serve(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	switch {
+	case r.URL.Path == "/directory":
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"newNonce":   ca.url("/nonce"),
+			"newAccount": ca.url("/account"),
+			"newOrder":   ca.url("/order"),
+		})
+		return
+	case r.URL.Path == "/nonce":
+		ca.newNonce(w)
+		return
+	}
+
+	payload, ok := ca.verify(w, r)
+	if !ok {
+		return
+	}
+	ca.newNonce(w)
+	switch r.URL.Path {
+	case "/account":
+		w.Header().Set("Location", ca.url("/account/1"))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"status":"valid"}`))
+	case "/order":
+		var req struct {
+			Identifiers []struct{ Value string } `json:"identifiers"`
+		}
+		if err := json.Unmarshal(payload, &req); err != nil || len(req.Identifiers) != 1 || req.Identifiers[0].Value != "example.com" {
+			ca.problem(w, http.StatusBadRequest, "urn:ietf:params:acme:error:malformed", "bad identifiers")
+			return
+		}
+		w.Header().Set("Location", ca.url("/order/1"))
+		w.WriteHeader(http.StatusCreated)
+		ca.writeOrder(w)
+	case "/order/1":
+		if ca.orderStatus == "processing" {
+			ca.orderStatus = "valid"
+		}
+		ca.writeOrder(w)
+	case "/authz/1":
+		ca.writeAuthz(w)
+	case "/challenge/1":
+		ca.validate()
+		_, _ = w.Write([]byte(`{"status":"processing"}`))
+	case "/finalize/1":
+		ca.finalize(w, payload)
+	case "/cert/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_, _ = w.Write(ca.chain)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// verify checks the JWS of a request and returns its payload.
+func (ca *fakeCA) verify(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	t := ca.t
+	if r.Header.Get("Content-Type") != "application/jose+json" {
+		t.Errorf("%s Content-Type = %q", r.URL.Path, r.Header.Get("Content-Type"))
+	}
+	var jws struct{ Protected, Payload, Signature string }
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		t.Errorf("%s: decode JWS: %v", r.URL.Path, err)
+		return nil, false
+	}
+	var header struct {
+		Alg, Nonce, URL, Kid string
+		JWK                  map[string]string
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	if err := json.Unmarshal(raw, &header); err != nil {
+		t.Errorf("%s: decode protected header: %v", r.URL.Path, err)
+		return nil, false
+	}
+	if header.URL != ca.url(r.URL.Path) || header.Alg != "ES256" {
+		t.Errorf("%s: header url %q alg %q", r.URL.Path, header.URL, header.Alg)
+	}
+	if !ca.nonces[header.Nonce] {
+		ca.newNonce(w)
+		ca.problem(w, http.StatusBadRequest, "urn:ietf:params:acme:error:badNonce", "unknown nonce")
+		return nil, false
+	}
+	delete(ca.nonces, header.Nonce)
+
+	key := ca.account
+	if r.URL.Path == "/account" {
+		if header.JWK == nil {
+			t.Errorf("new account request without jwk")
+			return nil, false
+		}
+		x, _ := base64.RawURLEncoding.DecodeString(header.JWK["x"])
+		y, _ := base64.RawURLEncoding.DecodeString(header.JWK["y"])
+		key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		ca.account = key
+	} else if header.Kid != ca.url("/account/1") {
+		t.Errorf("%s: kid = %q", r.URL.Path, header.Kid)
+		return nil, false
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(jws.Signature)
+	digest := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	if len(sig) != 64 || !ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		t.Errorf("%s: bad signature", r.URL.Path)
+		return nil, false
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return payload, true
+}
+
+func (ca *fakeCA) writeOrder(w http.ResponseWriter) {
+	order := map[string]any{
+		"status":         ca.orderStatus,
+		"authorizations": []string{ca.url("/authz/1")},
+		"finalize":       ca.url("/finalize/1"),
+	}
+	if ca.orderStatus == "valid" {
+		order["certificate"] = ca.url("/cert/1")
+	}
+	_ = json.NewEncoder(w).Encode(order)
+}
+
+func (ca *fakeCA) writeAuthz(w http.ResponseWriter) {
+	challenge := map[string]any{"type": "tls-alpn-01", "url": ca.url("/challenge/1"), "token": "token-1", "status": ca.authzStatus}
+	if ca.authzStatus == "invalid" {
+		challenge["error"] = map[string]string{"type": "urn:ietf:params:acme:error:unauthorized", "detail": "wrong key authorization"}
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"status":     ca.authzStatus,
+		"identifier": map[string]string{"type": "dns", "value": "example.com"},
+		"challenges": []any{
+			map[string]any{"type": "http-01", "url": ca.url("/challenge/2"), "token": "token-2", "status": "pending"},
+			challenge,
+		},
+	})
+}
+
+// validate performs the tls-alpn-01 check of RFC 8737 against the
+// manager's challenge certificate.
+func (ca *fakeCA) validate() {
+	ca.authzStatus = "invalid"
+	if ca.failChallenge {
+		return
+	}
+	cert, err := ca.m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com", SupportedProtos: []string{"acme-tls/1"}})
+	if err != nil {
+		ca.t.Errorf("challenge GetCertificate() error = %v", err)
+		return
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil || len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != "example.com" {
+		ca.t.Errorf("challenge certificate = %v, %v", leaf, err)
+		return
+	}
+	k := jwkOf(ca.account)
+	canonical := fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%s","y":"%s"}`, k["x"], k["y"])
+	thumb := sha256.Sum256([]byte(canonical))
+	want := sha256.Sum256([]byte("token-1." + base64.RawURLEncoding.EncodeToString(thumb[:])))
+	for _, ext := range leaf.Extensions {
+		if !ext.Id.Equal(idPeAcmeIdentifier) {
+			continue
+		}
+		var got []byte
+		if _, err := asn1.Unmarshal(ext.Value, &got); err != nil || !ext.Critical || !bytes.Equal(got, want[:]) {
+			ca.t.Errorf("acmeIdentifier extension = %x (critical %v), want %x", got, ext.Critical, want)
+			return
+		}
+		ca.authzStatus = "valid"
+		ca.orderStatus = "ready"
+		return
+	}
+	ca.t.Error("challenge certificate lacks the acmeIdentifier extension")
+}
+
+func jwkOf(pub *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"x": base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+		"y": base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func (ca *fakeCA) finalize(w http.ResponseWriter, payload []byte) {
+	if ca.orderStatus != "ready" {
+		ca.problem(w, http.StatusForbidden, "urn:ietf:params:acme:error:orderNotReady", "order is "+ca.orderStatus)
+		return
+	}
+	var req struct{ CSR string }
+	_ = json.Unmarshal(payload, &req)
+	der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil || csr.CheckSignature() != nil {
+		ca.problem(w, http.StatusBadRequest, "urn:ietf:params:acme:error:badCSR", "bad csr")
+		return
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, template, ca.caCert, csr.PublicKey, ca.caKey)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	ca.chain = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.caCert.Raw})...)
+	ca.orderStatus = "processing"
+	ca.writeOrder(w)
+}
+
+func newTestManager(t *testing.T, ca *fakeCA, dir string) *ACMEManager {
+	t.Helper()
+	m, err := NewACMEManager(ACMEOptions{
+		DirectoryURL: ca.url("/directory"),
+		Email:        "ops@example.com",
+		Domains:      []string{"example.com"},
+		CacheDir:     dir,
+	})
+	if err != nil {
+		t.Fatalf("NewACMEManager() error = %v", err)
+	}
+	m.poll = time.Millisecond
+	ca.m = m
+	return m
+}
+
+func TestACMEObtain(t *testing.T) {
+	ca := newFakeCA(t)
+	dir := t.TempDir()
+	m := newTestManager(t, ca, dir)
+
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"}); err == nil {
+		t.Error("GetCertificate() before issuance succeeded")
+	}
+	if !m.needsCertificate() {
+		t.Error("needsCertificate() = false without a certificate")
+	}
+	if err := m.Obtain(context.Background()); err != nil {
+		t.Fatalf("Obtain() error = %v", err)
+	}
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	if err != nil {
+		t.Fatalf("GetCertificate() error = %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.caCert)
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots}); err != nil {
+		t.Errorf("issued certificate does not verify: %v", err)
+	}
+	if m.needsCertificate() {
+		t.Error("needsCertificate() = true with a fresh certificate")
+	}
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com", SupportedProtos: []string{"acme-tls/1"}}); err == nil {
+		t.Error("challenge certificate still served after validation")
+	}
+
+	// A restart serves the cached certificate with the same account.
+	for _, name := range []string{accountKeyFile, certificateFile} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("cache %s: %v", name, err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Errorf("cache %s mode = %v, want 0600", name, info.Mode().Perm())
+		}
+	}
+	restarted := newTestManager(t, ca, dir)
+	if restarted.needsCertificate() || !restarted.NotAfter().Equal(m.NotAfter()) {
+		t.Errorf("restarted manager NotAfter() = %v, want cached %v", restarted.NotAfter(), m.NotAfter())
+	}
+
+	// Renewal is due within 30 days of expiry, and for new domains.
+	restarted.now = func() time.Time { return m.NotAfter().Add(-29 * 24 * time.Hour) }
+	if !restarted.needsCertificate() {
+		t.Error("needsCertificate() = false 29 days before expiry")
+	}
+	restarted.now = time.Now
+	restarted.opts.Domains = []string{"example.com", "www.example.com"}
+	if !restarted.needsCertificate() {
+		t.Error("needsCertificate() = false for an uncovered domain")
+	}
+}
+
+func TestACMEObtainFailedChallenge(t *testing.T) {
+	ca := newFakeCA(t)
+	ca.failChallenge = true
+	m := newTestManager(t, ca, t.TempDir())
+
+	err := m.Obtain(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "wrong key authorization") {
+		t.Fatalf("Obtain() error = %v, want the CA's challenge error", err)
+	}
+	if m.cert.Load() != nil {
+		t.Error("certificate stored after a failed order")
+	}
+}
+
+func TestACMEBadNonceRetried(t *testing.T) {
+	ca := newFakeCA(t)
+	m := newTestManager(t, ca, t.TempDir())
+	c := &acmeClient{m: m}
+	var err error
+	if c.key, err = m.accountKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.register(context.Background()); err != nil {
+		t.Fatalf("register() error = %v", err)
+	}
+	c.nonce = "stale"
+	if _, err := c.post(context.Background(), ca.url("/order/1"), nil, nil); err != nil {
+		t.Errorf("post() with a stale nonce error = %v, want a retry", err)
+	}
+}
+
+func TestChallengeCertIsSelfSigned(t *testing.T) {
+	cert, err := challengeCert("example.com", "token.thumb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.CheckSignature(leaf.SignatureAlgorithm, leaf.RawTBSCertificate, leaf.Signature); err != nil {
+		t.Errorf("challenge certificate not self-signed: %v", err)
+	}
+}
+
+func TestNewACMEManagerNeedsDomains(t *testing.T) {
+	if _, err := NewACMEManager(ACMEOptions{CacheDir: t.TempDir()}); err == nil {
+		t.Error("NewACMEManager() without domains succeeded")
+	}
+}
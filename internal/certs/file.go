@@ -0,0 +1,56 @@
+// Package certs supplies the certificates the gateway terminates TLS
+// with, either from files or issued by an ACME certificate authority
+// such as Let's Encrypt.
+package certs
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// FileLoader serves a certificate and key read from PEM files. Reload
+// picks up renewed files without a restart.
+type FileLoader struct {
+	certFile, keyFile string
+	cert              atomic.Pointer[tls.Certificate]
+}
+
+// NewFileLoader loads the certificate in certFile with the key in keyFile.
+func NewFileLoader(certFile, keyFile string) (*FileLoader, error) {
+	l := &FileLoader{certFile: certFile, keyFile: keyFile}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload reads the files again. On error the previous certificate stays
+// in use.
+func (l *FileLoader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate %s: %w", l.certFile, err)
+	}
+	l.cert.Store(&cert)
+	return nil
+}
+
+// NotAfter returns when the loaded certificate expires.
+func (l *FileLoader) NotAfter() time.Time {
+	if leaf := l.cert.Load().Leaf; leaf != nil {
+		return leaf.NotAfter
+	}
+	return time.Time{}
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (l *FileLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert := l.cert.Load()
+	if cert == nil {
+		return nil, errors.New("no certificate loaded")
+	}
+	return cert, nil
+}
@@ -0,0 +1,93 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePair writes a self-signed certificate for name, expiring at
+// notAfter, and its key into dir.
+func writePair(t *testing.T, dir, name string, notAfter time.Time) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestFileLoaderReload(t *testing.T) {
+	dir := t.TempDir()
+	first := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	certFile, keyFile := writePair(t, dir, "example.com", first)
+
+	l, err := NewFileLoader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewFileLoader() error = %v", err)
+	}
+	if !l.NotAfter().Equal(first) {
+		t.Errorf("NotAfter() = %v, want %v", l.NotAfter(), first)
+	}
+	cert, err := l.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	if err != nil || cert.Leaf.Subject.CommonName != "example.com" {
+		t.Fatalf("GetCertificate() = %v, %v", cert, err)
+	}
+
+	second := time.Now().Add(90 * 24 * time.Hour).Truncate(time.Second)
+	writePair(t, dir, "example.com", second)
+	if err := l.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if !l.NotAfter().Equal(second) {
+		t.Errorf("NotAfter() after reload = %v, want %v", l.NotAfter(), second)
+	}
+
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reload(); err == nil {
+		t.Error("Reload() of a broken file succeeded")
+	}
+	if !l.NotAfter().Equal(second) {
+		t.Errorf("NotAfter() after a failed reload = %v, want the previous %v", l.NotAfter(), second)
+	}
+}
+
+func TestNewFileLoaderMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewFileLoader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")); err == nil {
+		t.Error("NewFileLoader() of missing files succeeded")
+	}
+}
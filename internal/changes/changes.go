@@ -0,0 +1,100 @@
+// Package changes reports changes to the gateway's rules, with a diff of
+// what changed, so external change-management systems and chat bots can
+// track configuration drift.
+package changes
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// Change actions.
+const (
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionDeleted = "deleted"
+	// ActionDisabled is a rule the gateway stopped enforcing on its own,
+	// such as one whose policy no longer exists.
+	ActionDisabled = "disabled"
+)
+
+// FieldChange is a rule field that differs between two versions, named as
+// in the rule's JSON. Old is absent for fields that were unset, New for
+// fields that were cleared.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old,omitempty"`
+	New   any    `json:"new,omitempty"`
+}
+
+// RuleChange describes one change to a rule.
+type RuleChange struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	RuleID   string    `json:"rule_id"`
+	RuleName string    `json:"rule_name,omitempty"`
+	// Revision is the rule's revision after the change.
+	Revision int64 `json:"revision,omitempty"`
+	// Reason explains changes the API caller did not spell out, such as
+	// a rollback or an automatic disable.
+	Reason string        `json:"reason,omitempty"`
+	Diff   []FieldChange `json:"diff,omitempty"`
+}
+
+// bookkeeping are fields every change touches, left out of diffs.
+var bookkeeping = map[string]bool{"revision": true, "created_at": true, "updated_at": true}
+
+// Diff returns the fields that differ from old to new, in name order. A
+// nil old describes a created rule and a nil new a deleted one.
+func Diff(old, new *rules.Rule) []FieldChange {
+	before, after := fields(old), fields(new)
+	names := make([]string, 0, len(before)+len(after))
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var diff []FieldChange
+	for _, name := range names {
+		if bookkeeping[name] || reflect.DeepEqual(before[name], after[name]) {
+			continue
+		}
+		diff = append(diff, FieldChange{Field: name, Old: before[name], New: after[name]})
+	}
+	return diff
+}
+
+// fields returns r's JSON fields, so diffs use the names API clients see.
+func fields(r *rules.Rule) map[string]any {
+	out := map[string]any{}
+	if r == nil {
+		return out
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return out
+	}
+	_ = json.Unmarshal(data, &out)
+	return out
+}
+
+// New returns a change of rule with the given action and diff.
+func New(action string, rule rules.Rule, diff []FieldChange) RuleChange {
+	return RuleChange{
+		Time:     time.Now().UTC(),
+		Action:   action,
+		RuleID:   rule.ID,
+		RuleName: rule.Name,
+		Revision: rule.Revision,
+		Diff:     diff,
+	}
+}
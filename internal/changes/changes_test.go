@@ -0,0 +1,46 @@
+package changes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+func TestDiff(t *testing.T) {
+	old := rules.Rule{ID: "r1", Name: "api", Pattern: "/api/*", Limit: 10, WindowSeconds: 60, Enabled: true, Revision: 1}
+	updated := old
+	updated.Limit = 20
+	updated.Revision = 2
+
+	diff := Diff(&old, &updated)
+	if len(diff) != 1 || diff[0].Field != "limit" || diff[0].Old != float64(10) || diff[0].New != float64(20) {
+		t.Fatalf("diff = %+v", diff)
+	}
+	if diff := Diff(&old, &old); len(diff) != 0 {
+		t.Errorf("identical rules diff = %+v", diff)
+	}
+}
+
+func TestDiffCreatedAndDeleted(t *testing.T) {
+	r := rules.Rule{ID: "r1", Name: "api", Pattern: "/api/*", Limit: 10, WindowSeconds: 60}
+
+	for _, f := range Diff(nil, &r) {
+		if f.Old != nil {
+			t.Errorf("created %s has old value %v", f.Field, f.Old)
+		}
+		if f.Field == "revision" || f.Field == "created_at" {
+			t.Errorf("created diff includes bookkeeping field %s", f.Field)
+		}
+	}
+	created := Diff(nil, &r)
+	deleted := Diff(&r, nil)
+	if len(created) == 0 || len(created) != len(deleted) {
+		t.Fatalf("created %d fields, deleted %d", len(created), len(deleted))
+	}
+	for i, f := range deleted {
+		if f.New != nil || !reflect.DeepEqual(f.Old, created[i].New) {
+			t.Errorf("deleted %+v does not mirror created %+v", f, created[i])
+		}
+	}
+}
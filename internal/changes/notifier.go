@@ -0,0 +1,225 @@
+package changes
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 of the body, as
+	// "sha256=<hex>", when a webhook secret is configured.
+	SignatureHeader = "X-Gatify-Signature"
+	// EventHeader names the change or report, such as "rule.updated".
+	EventHeader = "X-Gatify-Event"
+
+	webhookTimeout  = 10 * time.Second
+	webhookAttempts = 3
+	queueSize       = 256
+)
+
+// Notifier delivers rule changes to webhooks and to local subscribers.
+// Notify never blocks: webhook deliveries are queued, and changes that do
+// not fit in the queue are dropped and counted.
+type Notifier struct {
+	urls    []string
+	secret  []byte
+	client  *http.Client
+	queue   chan delivery
+	dropped atomic.Uint64
+	// retryDelay is the pause before the first retry; it doubles after
+	// every failed attempt.
+	retryDelay time.Duration
+
+	mu          sync.Mutex
+	subscribers []func(RuleChange)
+	// disabled holds the IDs of rules currently disabled automatically.
+	disabled map[string]bool
+}
+
+// NewNotifier creates a Notifier posting to urls, signing each delivery
+// with secret when it is set.
+func NewNotifier(urls []string, secret string) *Notifier {
+	n := &Notifier{
+		urls:       urls,
+		client:     &http.Client{Timeout: webhookTimeout},
+		queue:      make(chan delivery, queueSize),
+		retryDelay: time.Second,
+		disabled:   make(map[string]bool),
+	}
+	if secret != "" {
+		n.secret = []byte(secret)
+	}
+	return n
+}
+
+// Subscribe calls fn with every change, on the goroutine that reports it.
+// fn must not block.
+func (n *Notifier) Subscribe(fn func(RuleChange)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.subscribers = append(n.subscribers, fn)
+}
+
+// Dropped returns how many webhook deliveries were discarded because the
+// queue was full.
+func (n *Notifier) Dropped() uint64 {
+	return n.dropped.Load()
+}
+
+// Notify reports c. A nil Notifier ignores it.
+func (n *Notifier) Notify(c RuleChange) {
+	if n == nil {
+		return
+	}
+	if c.Time.IsZero() {
+		c.Time = time.Now().UTC()
+	}
+	n.mu.Lock()
+	subscribers := n.subscribers
+	if c.Action != ActionDisabled {
+		// A rule edited through the API gets a fresh chance to be
+		// reported as disabled.
+		delete(n.disabled, c.RuleID)
+	}
+	n.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(c)
+	}
+
+	n.enqueue(delivery{event: "rule." + c.Action, payload: c})
+}
+
+// delivery is a webhook payload queued for every URL.
+type delivery struct {
+	event   string
+	payload any
+}
+
+// Send queues payload for the webhooks as event, such as
+// "slo.budget_exhausted", for reports that are not rule changes. A nil
+// Notifier ignores it.
+func (n *Notifier) Send(event string, payload any) {
+	if n == nil {
+		return
+	}
+	n.enqueue(delivery{event: event, payload: payload})
+}
+
+func (n *Notifier) enqueue(d delivery) {
+	if len(n.urls) == 0 {
+		return
+	}
+	select {
+	case n.queue <- d:
+	default:
+		n.dropped.Add(1)
+	}
+}
+
+// AutoDisabled reports the rules the gateway currently refuses to enforce,
+// as they were stored, with reason explaining each. It is called on every rules reload; a rule
+// is reported once when it becomes disabled, not on every call.
+func (n *Notifier) AutoDisabled(list []rules.Rule, reason func(rules.Rule) string) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	current := make(map[string]bool, len(list))
+	var fresh []rules.Rule
+	for _, r := range list {
+		current[r.ID] = true
+		if !n.disabled[r.ID] {
+			fresh = append(fresh, r)
+		}
+	}
+	n.disabled = current
+	n.mu.Unlock()
+
+	for _, r := range fresh {
+		off := r
+		off.Enabled = false
+		c := New(ActionDisabled, r, Diff(&r, &off))
+		c.Reason = reason(r)
+		n.Notify(c)
+	}
+}
+
+// Run delivers queued changes and reports to every webhook until ctx is
+// cancelled.
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-n.queue:
+			for _, url := range n.urls {
+				if err := n.deliver(ctx, url, d.event, d.payload); err != nil {
+					log.Printf("Failed to deliver %s webhook to %s: %v", d.event, url, err)
+				}
+			}
+		}
+	}
+}
+
+// deliver posts payload to url as event, retrying failed attempts with a
+// doubling delay.
+func (n *Notifier) deliver(ctx context.Context, url, event string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	delay := n.retryDelay
+	for attempt := 1; ; attempt++ {
+		err = n.post(ctx, url, event, body)
+		if err == nil || attempt == webhookAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, url, event string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	if n.secret != nil {
+		req.Header.Set(SignatureHeader, Sign(n.secret, body))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the signature header value of body under secret, for
+// receivers verifying deliveries.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,137 @@
+package changes
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+func TestNotifierDeliversSignedWebhook(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	n := NewNotifier([]string{srv.URL}, "s3cret")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	n.Notify(New(ActionCreated, rules.Rule{ID: "r1", Name: "api"}, nil))
+
+	select {
+	case r := <-received:
+		body := <-bodies
+		if got := r.Header.Get(EventHeader); got != "rule.created" {
+			t.Errorf("event header = %q", got)
+		}
+		if got, want := r.Header.Get(SignatureHeader), Sign([]byte("s3cret"), body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		var c RuleChange
+		if err := json.Unmarshal(body, &c); err != nil || c.RuleID != "r1" || c.Action != ActionCreated {
+			t.Errorf("body = %s, %v", body, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+}
+
+func TestNotifierSendsReports(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+	}))
+	defer srv.Close()
+
+	n := NewNotifier([]string{srv.URL}, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	n.Send("slo.budget_exhausted", map[string]string{"slo": "api"})
+
+	select {
+	case r := <-received:
+		if got := r.Header.Get(EventHeader); got != "slo.budget_exhausted" {
+			t.Errorf("event header = %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("report was not delivered")
+	}
+}
+
+func TestNotifierRetriesFailedDelivery(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 2 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	n := NewNotifier([]string{srv.URL}, "")
+	n.retryDelay = time.Millisecond
+	if err := n.deliver(context.Background(), srv.URL, "rule.deleted", New(ActionDeleted, rules.Rule{ID: "r1"}, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if attempts.Load() != 2 {
+		t.Errorf("attempts = %d, want 2", attempts.Load())
+	}
+}
+
+func TestNotifierSubscribers(t *testing.T) {
+	n := NewNotifier(nil, "")
+	var got []RuleChange
+	n.Subscribe(func(c RuleChange) { got = append(got, c) })
+
+	n.Notify(New(ActionUpdated, rules.Rule{ID: "r1"}, nil))
+	if len(got) != 1 || got[0].Time.IsZero() {
+		t.Fatalf("subscriber got %+v", got)
+	}
+	if n.Dropped() != 0 {
+		t.Errorf("dropped = %d without webhooks", n.Dropped())
+	}
+
+	var nilNotifier *Notifier
+	nilNotifier.Notify(RuleChange{})
+}
+
+func TestNotifierAutoDisabledReportsOnce(t *testing.T) {
+	n := NewNotifier(nil, "")
+	var got []RuleChange
+	n.Subscribe(func(c RuleChange) { got = append(got, c) })
+	reason := func(r rules.Rule) string { return "policy " + r.Policy + " not found" }
+	disabled := []rules.Rule{{ID: "r1", Policy: "gold", Enabled: true}}
+
+	n.AutoDisabled(disabled, reason)
+	n.AutoDisabled(disabled, reason)
+	if len(got) != 1 {
+		t.Fatalf("reported %d changes, want 1", len(got))
+	}
+	c := got[0]
+	if c.Action != ActionDisabled || c.Reason != "policy gold not found" {
+		t.Errorf("change = %+v", c)
+	}
+	if len(c.Diff) != 1 || c.Diff[0].Field != "enabled" || c.Diff[0].Old != true {
+		t.Errorf("diff = %+v", c.Diff)
+	}
+
+	// Once the rule recovers, a later disable is reported again.
+	n.AutoDisabled(nil, reason)
+	n.AutoDisabled(disabled, reason)
+	if len(got) != 2 {
+		t.Errorf("reported %d changes after recovery, want 2", len(got))
+	}
+}
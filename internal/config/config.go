@@ -1,4 +1,1103 @@
 // Package config provides configuration management
 package config
 
-// TODO: Implement configuration loading
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+	"github.com/Siruyy/gatify/internal/logging"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/slo"
+	"github.com/Siruyy/gatify/internal/upstream"
+)
+
+// Policies accepted in RULES_LOAD_TIMEOUT_POLICY.
+const (
+	RulesLoadServe  = "serve"
+	RulesLoadReject = "reject"
+)
+
+// Storage backends accepted in STORAGE_BACKEND.
+const (
+	StorageRedis  = "redis"
+	StorageMemory = "memory"
+)
+
+// maxDebugRingSize caps DEBUG_RING_SIZE, since every record holds a
+// request's headers in memory.
+const maxDebugRingSize = 10000
+
+// minAnalyticsRetention is the shortest ANALYTICS_RETENTION accepted,
+// matching analytics.MinRetention: the rollups are recomputed from up to
+// two days of raw events.
+const minAnalyticsRetention = 72 * time.Hour
+
+// Config holds the runtime configuration for the gateway.
+type Config struct {
+	// ConfigFile, if set, is a file of KEY=VALUE lines overriding the
+	// environment. It is re-read on SIGHUP.
+	ConfigFile string
+	// ListenAddr is the address the gateway HTTP server binds to.
+	ListenAddr string
+	// ListenReusePort binds the listener with SO_REUSEPORT so several
+	// gatify processes can share the address.
+	ListenReusePort bool
+	// TLSCertFile and TLSKeyFile, when set, make the gateway terminate
+	// TLS itself, serving HTTP/2 to clients that support it. The files
+	// are re-read on SIGHUP, so renewed certificates apply without a
+	// restart.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSACMEDomains, instead of certificate files, has a certificate for
+	// these domains issued and renewed by an ACME CA, Let's Encrypt unless
+	// TLSACMEDirectoryURL names another. The CA validates through the
+	// TLS listener itself, so it must be reachable on port 443 of every
+	// domain. TLSACMECacheDir keeps the account key and certificate
+	// across restarts; TLSACMEEmail receives the CA's expiry notices.
+	TLSACMEDomains      []string
+	TLSACMEEmail        string
+	TLSACMECacheDir     string
+	TLSACMEDirectoryURL string
+	// ShutdownTimeout bounds how long in-flight requests may take to
+	// finish when the process stops or hands over to a new binary.
+	ShutdownTimeout time.Duration
+	// BackendURL is the upstream service requests are proxied to.
+	BackendURL string
+	// BackendTLSCertFile and BackendTLSKeyFile are the client certificate
+	// presented to backends requiring mutual TLS, and BackendTLSCAFile a
+	// PEM bundle of the CAs trusted to sign backend certificates instead
+	// of the system roots.
+	BackendTLSCertFile string
+	BackendTLSKeyFile  string
+	BackendTLSCAFile   string
+	// BackendMaxIdleConns, BackendMaxIdleConnsPerHost and
+	// BackendMaxConnsPerHost size the connection pools to backends; a
+	// zero BackendMaxConnsPerHost leaves connections unlimited.
+	BackendMaxIdleConns        int
+	BackendMaxIdleConnsPerHost int
+	BackendMaxConnsPerHost     int
+	// BackendDialTimeout, BackendTLSHandshakeTimeout and
+	// BackendResponseHeaderTimeout bound the steps of a backend request;
+	// a zero BackendResponseHeaderTimeout waits as long as the client
+	// does. Idle connections close after BackendIdleConnTimeout.
+	BackendDialTimeout           time.Duration
+	BackendTLSHandshakeTimeout   time.Duration
+	BackendResponseHeaderTimeout time.Duration
+	BackendIdleConnTimeout       time.Duration
+	// BackendKeepAlive is the interval of TCP keep-alive probes, and
+	// BackendDisableKeepAlives opens a connection per request.
+	BackendKeepAlive         time.Duration
+	BackendDisableKeepAlives bool
+	// BackendDNSRefresh is how often backend hostnames are resolved
+	// again, closing connections to addresses they no longer have; 0
+	// leaves resolution to each new connection.
+	BackendDNSRefresh time.Duration
+	// Upstreams are additional named backends that rules can route to
+	// with their upstream field, parsed from UPSTREAMS
+	// ("users=http://users:8080,billing=http://billing:8080").
+	Upstreams []Upstream
+	// AdminAPIToken is an admin credential for the management API, used
+	// to issue further tokens. Without it, and without a database to keep
+	// issued tokens in, the management API is disabled. It is read from
+	// ADMIN_API_TOKEN_FILE instead when that is set.
+	AdminAPIToken string
+
+	// RulesFile, when set, is a JSON file of declarative rules that is
+	// loaded at startup and reloaded when it changes, checked every
+	// RulesFilePollInterval.
+	RulesFile             string
+	RulesFilePollInterval time.Duration
+	// GeoIPDBPath, when set, is a MaxMind DB file such as
+	// GeoLite2-Country.mmdb that rules identifying or filtering clients by
+	// country look them up in. It is reloaded when it changes, checked
+	// every GeoIPPollInterval.
+	GeoIPDBPath       string
+	GeoIPPollInterval time.Duration
+	// JWTSecret and JWTJWKSURL verify the bearer tokens of rules
+	// identifying clients by JWT claim: HS256/384/512 tokens against the
+	// shared secret, RS and ES tokens against the keys published at the
+	// URL, which are fetched again every JWTJWKSRefresh. JWTIssuer and
+	// JWTAudience, when set, must match the tokens' iss and aud claims.
+	JWTSecret      string
+	JWTJWKSURL     string
+	JWTJWKSRefresh time.Duration
+	JWTIssuer      string
+	JWTAudience    string
+	// RulesSnapshotFile, when set, keeps the rules managed through the API
+	// across restarts: they are saved there every RulesSnapshotInterval
+	// while changed, and on shutdown, and reloaded on startup.
+	RulesSnapshotFile     string
+	RulesSnapshotInterval time.Duration
+	// RulesLoadTimeout bounds how long proxy traffic is held back with 503
+	// while the rules load at startup. RulesLoadTimeoutPolicy decides what
+	// happens after it: RulesLoadServe serves with the rules loaded so far,
+	// RulesLoadReject keeps answering 503 until the load succeeds.
+	RulesLoadTimeout       time.Duration
+	RulesLoadTimeoutPolicy string
+	// ACLSnapshotFile and PoliciesSnapshotFile do the same for the IP
+	// allowlist and denylist and for rule policies, on the same interval.
+	ACLSnapshotFile      string
+	PoliciesSnapshotFile string
+
+	// StorageBackend selects where rate limit state lives: StorageRedis,
+	// shared by every instance, or StorageMemory for a single node.
+	StorageBackend string
+	// RedisAddr, RedisPassword and RedisDB locate the rate limit store.
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+
+	// RateLimitRequests and RateLimitWindow are the default limit applied
+	// to requests that match no rule. The window may be as short as a
+	// millisecond, which tests use to exercise the limiter quickly.
+	RateLimitRequests int64
+	RateLimitWindow   time.Duration
+
+	// LimiterAlgorithm selects the enforced rate limiting algorithm.
+	// ShadowAlgorithm, when set, is evaluated on the same traffic without
+	// being enforced so the two can be compared in analytics.
+	LimiterAlgorithm string
+	ShadowAlgorithm  string
+	// LocalLimitFraction, when above zero, puts a per-instance token
+	// bucket holding this fraction of each limit in front of the global
+	// limiter, rejecting floods without a storage round trip.
+	LocalLimitFraction float64
+
+	// TrustProxy honors X-Forwarded-For / X-Real-IP for client identity.
+	TrustProxy bool
+	// TrustedProxies are the addresses and CIDR ranges of the proxies in
+	// front of the gateway. The client IP is the rightmost
+	// X-Forwarded-For address outside them; when empty, only the
+	// connection's peer is trusted.
+	TrustedProxies []netip.Prefix
+	// LogLevel is the least severe log output written.
+	LogLevel logging.Level
+	// DevMode enables development conveniences such as diagnostic
+	// response headers on every request.
+	DevMode bool
+	// DebugToken lets individual requests opt into diagnostic headers.
+	DebugToken string
+	// DebugRingSize is how many of the latest requests each instance
+	// keeps detailed diagnostics of; zero disables the ring.
+	DebugRingSize int
+
+	// BackendHealthPath enables active health checks of the backend when
+	// set. Checks run every BackendHealthInterval, time out after
+	// BackendHealthTimeout and expect BackendHealthStatus.
+	BackendHealthPath     string
+	BackendHealthInterval time.Duration
+	BackendHealthTimeout  time.Duration
+	BackendHealthStatus   int
+	// CanaryPath enables a synthetic request sent through the gateway
+	// itself every CanaryInterval, recorded in analytics and /metrics. It
+	// uses CanaryMethod, times out after CanaryTimeout and expects
+	// CanaryStatus.
+	CanaryPath     string
+	CanaryMethod   string
+	CanaryInterval time.Duration
+	CanaryTimeout  time.Duration
+	CanaryStatus   int
+	// BreakerEnabled opens an upstream's circuit, answering 503 for
+	// BreakerOpenDuration, once BreakerFailurePercent of at least
+	// BreakerMinRequests responses within BreakerWindow were 5xx or
+	// failed outright.
+	BreakerEnabled        bool
+	BreakerFailurePercent int
+	BreakerMinRequests    int
+	BreakerWindow         time.Duration
+	BreakerOpenDuration   time.Duration
+
+	// MaxRequestHeaders rejects requests with more header values than
+	// this with 431; zero disables the check. Duplicate framing headers
+	// are rejected regardless.
+	MaxRequestHeaders int
+
+	// HonorBackendLimits turns backend 429 / Retry-After responses into
+	// temporary gateway-side penalties for the same client and rule,
+	// capped at MaxBackendBackoff.
+	HonorBackendLimits bool
+	MaxBackendBackoff  time.Duration
+
+	// ShedThreshold is the number of requests in flight to the backends,
+	// per instance, at which load shedding starts with the lowest
+	// shed_priority; zero disables shedding. ShedMaxInFlight is where even
+	// the highest priority is shed, twice the threshold by default.
+	ShedThreshold   int
+	ShedMaxInFlight int
+
+	// AutoBanStrikes bans a client for AutoBanDuration once this many of
+	// its requests were rate limited within AutoBanWindow; zero disables
+	// automatic bans.
+	AutoBanStrikes  int
+	AutoBanWindow   time.Duration
+	AutoBanDuration time.Duration
+
+	// DatabaseURL locates the TimescaleDB/PostgreSQL analytics store.
+	// Analytics is disabled when it is empty.
+	DatabaseURL string
+	// DatabaseReadURL, when set, points stats queries at a separate
+	// database such as a read replica. Event writes always use DatabaseURL.
+	DatabaseReadURL string
+	// DBMaxOpenConns, DBMaxIdleConns and DBConnMaxLifetime size each of
+	// the analytics connection pools.
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	// AnalyticsEnabled toggles request event logging and the stats API.
+	AnalyticsEnabled bool
+	// AnalyticsBatchSize and AnalyticsFlushInterval control how request
+	// events are batched before being written.
+	AnalyticsBatchSize     int
+	AnalyticsFlushInterval time.Duration
+	// AnalyticsAdaptiveFlush lets the batch size and flush interval
+	// follow the event rate and the database's write latency, starting
+	// from the configured values.
+	AnalyticsAdaptiveFlush bool
+	// AnalyticsSpillDir is where batches are queued on disk while the
+	// database is failing; spilling is disabled when it is empty.
+	// AnalyticsSpillMaxMB bounds the queue's size.
+	AnalyticsSpillDir   string
+	AnalyticsSpillMaxMB int
+	// AnalyticsMaxClockSkew is how far in the future an event may be
+	// stamped before it is rejected rather than stored.
+	AnalyticsMaxClockSkew time.Duration
+	// UsageRollupInterval is how often the leader refreshes the daily
+	// per-client usage rollups behind the billing export.
+	UsageRollupInterval time.Duration
+	// TrafficRollupInterval is how often the leader refreshes the minute
+	// and hour traffic rollups behind timelines. At most an hour, as
+	// timelines read rollups only for settled hours.
+	TrafficRollupInterval time.Duration
+	// AnalyticsRetention, when set, is how long raw events, minute
+	// rollups, SLO budgets and ban events are kept; the leader deletes
+	// older ones every AnalyticsRetentionInterval. Hourly and daily
+	// rollups are kept forever.
+	AnalyticsRetention         time.Duration
+	AnalyticsRetentionInterval time.Duration
+
+	// SMTPAddr (host:port) enables email delivery of scheduled reports,
+	// sent from SMTPFrom. SMTPUsername and SMTPPassword are optional.
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// RuleWebhookURLs receive a signed JSON POST whenever a rule is
+	// created, updated, deleted or automatically disabled, parsed from the
+	// comma-separated RULE_WEBHOOK_URLS. RuleWebhookSecret, when set, keys
+	// the HMAC-SHA256 signature of each delivery.
+	RuleWebhookURLs   []string
+	RuleWebhookSecret string
+
+	// GRPCListenAddr, when set, serves the management API over gRPC on
+	// its own listener as well. Native gRPC needs HTTP/2, which requires
+	// TLS from GRPCTLSCertFile and GRPCTLSKeyFile; without them only
+	// gRPC-Web clients can connect.
+	GRPCListenAddr  string
+	GRPCTLSCertFile string
+	GRPCTLSKeyFile  string
+
+	// OTLPEndpoint is the base URL of an OTLP/HTTP collector, such as
+	// http://localhost:4318. Tracing is disabled when it is empty.
+	OTLPEndpoint string
+	// OTLPHeaders are sent with every export, typically for auth.
+	OTLPHeaders map[string]string
+	// OTelServiceName names the gateway in traces.
+	OTelServiceName string
+	// TraceSampleRatio is the share of new traces recorded, from 0 to 1.
+	// Requests arriving with a traceparent follow the caller's decision.
+	TraceSampleRatio float64
+
+	// StandbyPrimaryURL, when set, runs the instance as a warm standby of
+	// the gateway at that URL: it copies the primary's rules, ACL and
+	// policies every StandbySyncInterval and answers proxy traffic with
+	// 503 until promoted. StandbyToken authenticates to the primary's
+	// management API and defaults to AdminAPIToken.
+	StandbyPrimaryURL   string
+	StandbyToken        string
+	StandbySyncInterval time.Duration
+
+	// SLOs are latency objectives tracked against measured request
+	// durations, parsed from SLOS as comma-separated
+	// "name=pattern threshold objective%" entries. Error budgets are
+	// measured over SLOWindow and evaluated every SLOEvaluationInterval;
+	// exhausted budgets are reported to RuleWebhookURLs.
+	SLOs                  []slo.SLO
+	SLOWindow             time.Duration
+	SLOEvaluationInterval time.Duration
+}
+
+// Upstream is a named backend. Its health check settings, when set,
+// override BACKEND_HEALTH_PATH, BACKEND_HEALTH_INTERVAL and
+// BACKEND_HEALTH_STATUS.
+type Upstream struct {
+	Name           string
+	URL            string
+	HealthPath     string
+	HealthInterval time.Duration
+	HealthStatus   int
+}
+
+// Load reads the configuration from command-line flags given to
+// ParseFlags, environment variables and the file named by CONFIG_FILE, in
+// that order of precedence, applying defaults for anything unset, and
+// validates the result.
+func Load() (*Config, error) {
+	if path := getenv("CONFIG_FILE"); path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return nil, &FieldError{Var: "CONFIG_FILE", Problem: "could not be read", Err: err}
+		}
+		fileValues = values
+		defer func() { fileValues = nil }()
+	}
+
+	cfg := &Config{
+		ConfigFile:             getenv("CONFIG_FILE"),
+		ListenAddr:             getEnv("LISTEN_ADDR", ":3000"),
+		TLSCertFile:            getenv("TLS_CERT_FILE"),
+		TLSKeyFile:             getenv("TLS_KEY_FILE"),
+		TLSACMEDomains:         getEnvList("TLS_ACME_DOMAINS"),
+		TLSACMEEmail:           getenv("TLS_ACME_EMAIL"),
+		TLSACMECacheDir:        getEnv("TLS_ACME_CACHE_DIR", "acme-cache"),
+		TLSACMEDirectoryURL:    getEnv("TLS_ACME_DIRECTORY_URL", "https://acme-v02.api.letsencrypt.org/directory"),
+		BackendURL:             getEnv("BACKEND_URL", "http://localhost:8080"),
+		AdminAPIToken:          getenv("ADMIN_API_TOKEN"),
+		StorageBackend:         getEnv("STORAGE_BACKEND", StorageRedis),
+		RedisAddr:              getEnv("REDIS_ADDR", "localhost:6379"),
+		RedisPassword:          getenv("REDIS_PASSWORD"),
+		DebugToken:             getenv("DEBUG_TOKEN"),
+		DatabaseURL:            getenv("DATABASE_URL"),
+		BackendHealthPath:      getenv("BACKEND_HEALTH_PATH"),
+		BackendTLSCertFile:     getenv("BACKEND_TLS_CERT_FILE"),
+		BackendTLSKeyFile:      getenv("BACKEND_TLS_KEY_FILE"),
+		BackendTLSCAFile:       getenv("BACKEND_TLS_CA_FILE"),
+		CanaryPath:             getenv("CANARY_PATH"),
+		CanaryMethod:           strings.ToUpper(getEnv("CANARY_METHOD", http.MethodGet)),
+		DatabaseReadURL:        getenv("DATABASE_READ_URL"),
+		LimiterAlgorithm:       getEnv("LIMITER_ALGORITHM", "sliding_window"),
+		ShadowAlgorithm:        getenv("SHADOW_ALGORITHM"),
+		RulesFile:              getenv("RULES_FILE"),
+		GeoIPDBPath:            getenv("GEOIP_DB_PATH"),
+		JWTSecret:              getenv("JWT_SECRET"),
+		JWTJWKSURL:             getenv("JWT_JWKS_URL"),
+		JWTIssuer:              getenv("JWT_ISSUER"),
+		JWTAudience:            getenv("JWT_AUDIENCE"),
+		RulesSnapshotFile:      getenv("RULES_SNAPSHOT_FILE"),
+		ACLSnapshotFile:        getenv("ACL_SNAPSHOT_FILE"),
+		PoliciesSnapshotFile:   getenv("POLICIES_SNAPSHOT_FILE"),
+		RulesLoadTimeoutPolicy: getEnv("RULES_LOAD_TIMEOUT_POLICY", RulesLoadServe),
+		SMTPAddr:               getenv("SMTP_ADDR"),
+		SMTPUsername:           getenv("SMTP_USERNAME"),
+		SMTPPassword:           getenv("SMTP_PASSWORD"),
+		SMTPFrom:               getenv("SMTP_FROM"),
+		RuleWebhookURLs:        getEnvList("RULE_WEBHOOK_URLS"),
+		RuleWebhookSecret:      getenv("RULE_WEBHOOK_SECRET"),
+		GRPCListenAddr:         getenv("GRPC_LISTEN_ADDR"),
+		GRPCTLSCertFile:        getenv("GRPC_TLS_CERT_FILE"),
+		GRPCTLSKeyFile:         getenv("GRPC_TLS_KEY_FILE"),
+		OTLPEndpoint:           getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		OTelServiceName:        getEnv("OTEL_SERVICE_NAME", "gatify"),
+		AnalyticsSpillDir:      getenv("ANALYTICS_SPILL_DIR"),
+		StandbyPrimaryURL:      getenv("STANDBY_PRIMARY_URL"),
+		StandbyToken:           getenv("STANDBY_TOKEN"),
+	}
+
+	// Malformed values are collected rather than returned one at a time,
+	// so a single run reports everything that needs fixing.
+	var errs []error
+	collect := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	var err error
+	cfg.Upstreams, err = getEnvUpstreams("UPSTREAMS")
+	collect(err)
+	cfg.RedisDB, err = getEnvInt("REDIS_DB", 0)
+	collect(err)
+	requests, err := getEnvInt("RATE_LIMIT_REQUESTS", 100)
+	collect(err)
+	cfg.RateLimitRequests = int64(requests)
+	cfg.RateLimitWindow, err = getEnvDuration("RATE_LIMIT_WINDOW", time.Minute)
+	collect(err)
+	cfg.ListenReusePort, err = getEnvBool("LISTEN_REUSE_PORT", false)
+	collect(err)
+	cfg.ShutdownTimeout, err = getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	collect(err)
+	cfg.TrustProxy, err = getEnvBool("TRUST_PROXY", false)
+	collect(err)
+	cfg.TrustedProxies, err = getEnvPrefixes("TRUSTED_PROXIES")
+	collect(err)
+	if cfg.LogLevel, err = logging.ParseLevel(getEnv("LOG_LEVEL", "info")); err != nil {
+		collect(&FieldError{Var: "LOG_LEVEL", Problem: "must be debug, info, warn or error"})
+	}
+	cfg.DevMode, err = getEnvBool("DEV_MODE", false)
+	collect(err)
+	cfg.BackendMaxIdleConns, err = getEnvInt("BACKEND_MAX_IDLE_CONNS", 100)
+	collect(err)
+	cfg.BackendMaxIdleConnsPerHost, err = getEnvInt("BACKEND_MAX_IDLE_CONNS_PER_HOST", 2)
+	collect(err)
+	cfg.BackendMaxConnsPerHost, err = getEnvInt("BACKEND_MAX_CONNS_PER_HOST", 0)
+	collect(err)
+	cfg.BackendDialTimeout, err = getEnvDuration("BACKEND_DIAL_TIMEOUT", 30*time.Second)
+	collect(err)
+	cfg.BackendTLSHandshakeTimeout, err = getEnvDuration("BACKEND_TLS_HANDSHAKE_TIMEOUT", 10*time.Second)
+	collect(err)
+	cfg.BackendResponseHeaderTimeout, err = getEnvDuration("BACKEND_RESPONSE_HEADER_TIMEOUT", 0)
+	collect(err)
+	cfg.BackendIdleConnTimeout, err = getEnvDuration("BACKEND_IDLE_CONN_TIMEOUT", 90*time.Second)
+	collect(err)
+	cfg.BackendKeepAlive, err = getEnvDuration("BACKEND_KEEP_ALIVE", 30*time.Second)
+	collect(err)
+	cfg.BackendDisableKeepAlives, err = getEnvBool("BACKEND_DISABLE_KEEP_ALIVES", false)
+	collect(err)
+	cfg.BackendDNSRefresh, err = getEnvDuration("BACKEND_DNS_REFRESH", 30*time.Second)
+	collect(err)
+	cfg.BackendHealthInterval, err = getEnvDuration("BACKEND_HEALTH_INTERVAL", 10*time.Second)
+	collect(err)
+	cfg.BackendHealthTimeout, err = getEnvDuration("BACKEND_HEALTH_TIMEOUT", 2*time.Second)
+	collect(err)
+	cfg.BackendHealthStatus, err = getEnvInt("BACKEND_HEALTH_STATUS", http.StatusOK)
+	collect(err)
+	cfg.CanaryInterval, err = getEnvDuration("CANARY_INTERVAL", 30*time.Second)
+	collect(err)
+	cfg.CanaryTimeout, err = getEnvDuration("CANARY_TIMEOUT", 5*time.Second)
+	collect(err)
+	cfg.CanaryStatus, err = getEnvInt("CANARY_STATUS", http.StatusOK)
+	collect(err)
+	cfg.BreakerEnabled, err = getEnvBool("BREAKER_ENABLED", true)
+	collect(err)
+	cfg.BreakerFailurePercent, err = getEnvInt("BREAKER_FAILURE_PERCENT", 50)
+	collect(err)
+	cfg.BreakerMinRequests, err = getEnvInt("BREAKER_MIN_REQUESTS", 20)
+	collect(err)
+	cfg.BreakerWindow, err = getEnvDuration("BREAKER_WINDOW", 30*time.Second)
+	collect(err)
+	cfg.BreakerOpenDuration, err = getEnvDuration("BREAKER_OPEN_DURATION", 30*time.Second)
+	collect(err)
+	cfg.MaxRequestHeaders, err = getEnvInt("MAX_REQUEST_HEADERS", 100)
+	collect(err)
+	cfg.DebugRingSize, err = getEnvInt("DEBUG_RING_SIZE", 100)
+	collect(err)
+	cfg.HonorBackendLimits, err = getEnvBool("HONOR_BACKEND_LIMITS", false)
+	collect(err)
+	cfg.MaxBackendBackoff, err = getEnvDuration("MAX_BACKEND_BACKOFF", time.Minute)
+	collect(err)
+	cfg.ShedThreshold, err = getEnvInt("SHED_IN_FLIGHT_THRESHOLD", 0)
+	collect(err)
+	cfg.ShedMaxInFlight, err = getEnvInt("SHED_MAX_IN_FLIGHT", 2*cfg.ShedThreshold)
+	collect(err)
+	cfg.AutoBanStrikes, err = getEnvInt("AUTO_BAN_STRIKES", 0)
+	collect(err)
+	cfg.AutoBanWindow, err = getEnvDuration("AUTO_BAN_WINDOW", 10*time.Minute)
+	collect(err)
+	cfg.AutoBanDuration, err = getEnvDuration("AUTO_BAN_DURATION", time.Hour)
+	collect(err)
+	cfg.DBMaxOpenConns, err = getEnvInt("DB_MAX_OPEN_CONNS", 10)
+	collect(err)
+	cfg.DBMaxIdleConns, err = getEnvInt("DB_MAX_IDLE_CONNS", 5)
+	collect(err)
+	cfg.DBConnMaxLifetime, err = getEnvDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute)
+	collect(err)
+	cfg.AnalyticsEnabled, err = getEnvBool("ANALYTICS_ENABLED", true)
+	collect(err)
+	cfg.AnalyticsBatchSize, err = getEnvInt("ANALYTICS_BATCH_SIZE", 100)
+	collect(err)
+	cfg.AnalyticsFlushInterval, err = getEnvDuration("ANALYTICS_FLUSH_INTERVAL", 5*time.Second)
+	collect(err)
+	cfg.AnalyticsAdaptiveFlush, err = getEnvBool("ANALYTICS_ADAPTIVE_FLUSH", true)
+	collect(err)
+	cfg.AnalyticsSpillMaxMB, err = getEnvInt("ANALYTICS_SPILL_MAX_MB", 64)
+	collect(err)
+	cfg.AnalyticsMaxClockSkew, err = getEnvDuration("ANALYTICS_MAX_CLOCK_SKEW", 5*time.Second)
+	collect(err)
+	cfg.UsageRollupInterval, err = getEnvDuration("USAGE_ROLLUP_INTERVAL", 15*time.Minute)
+	collect(err)
+	cfg.TrafficRollupInterval, err = getEnvDuration("TRAFFIC_ROLLUP_INTERVAL", time.Minute)
+	collect(err)
+	cfg.AnalyticsRetention, err = getEnvDuration("ANALYTICS_RETENTION", 0)
+	collect(err)
+	cfg.AnalyticsRetentionInterval, err = getEnvDuration("ANALYTICS_RETENTION_INTERVAL", time.Hour)
+	collect(err)
+	cfg.RulesFilePollInterval, err = getEnvDuration("RULES_FILE_POLL_INTERVAL", 5*time.Second)
+	collect(err)
+	cfg.GeoIPPollInterval, err = getEnvDuration("GEOIP_POLL_INTERVAL", time.Minute)
+	collect(err)
+	cfg.JWTJWKSRefresh, err = getEnvDuration("JWT_JWKS_REFRESH", 5*time.Minute)
+	collect(err)
+	cfg.RulesSnapshotInterval, err = getEnvDuration("RULES_SNAPSHOT_INTERVAL", 30*time.Second)
+	collect(err)
+	cfg.RulesLoadTimeout, err = getEnvDuration("RULES_LOAD_TIMEOUT", 30*time.Second)
+	collect(err)
+	cfg.OTLPHeaders, err = getEnvHeaders("OTEL_EXPORTER_OTLP_HEADERS")
+	collect(err)
+	cfg.TraceSampleRatio, err = getEnvFloat("OTEL_TRACES_SAMPLER_ARG", 1)
+	collect(err)
+	cfg.LocalLimitFraction, err = getEnvFloat("LOCAL_LIMIT_FRACTION", 0)
+	collect(err)
+	cfg.StandbySyncInterval, err = getEnvDuration("STANDBY_SYNC_INTERVAL", 15*time.Second)
+	collect(err)
+	if cfg.SLOs, err = slo.Parse(getenv("SLOS")); err != nil {
+		collect(&FieldError{Var: "SLOS", Problem: err.Error()})
+	}
+	cfg.SLOWindow, err = getEnvDuration("SLO_WINDOW", slo.DefaultWindow)
+	collect(err)
+	cfg.SLOEvaluationInterval, err = getEnvDuration("SLO_EVALUATION_INTERVAL", slo.DefaultInterval)
+	collect(err)
+	if path := getenv("ADMIN_API_TOKEN_FILE"); path != "" {
+		token, err := os.ReadFile(path)
+		if err != nil {
+			collect(&FieldError{Var: "ADMIN_API_TOKEN_FILE", Problem: "could not be read", Err: err})
+		}
+		cfg.AdminAPIToken = strings.TrimSpace(string(token))
+	}
+	if cfg.StandbyToken == "" {
+		cfg.StandbyToken = cfg.AdminAPIToken
+	}
+
+	// A variable that failed to parse holds a zero value; skip the range
+	// checks on it so it is reported once.
+	malformed := make(map[string]bool, len(errs))
+	for _, p := range Problems(errors.Join(errs...)) {
+		malformed[p.Var] = true
+	}
+	for _, p := range Problems(cfg.Validate()) {
+		if !malformed[p.Var] {
+			errs = append(errs, p)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return cfg, nil
+}
+
+// FieldError is a problem with one environment variable.
+type FieldError struct {
+	Var     string
+	Problem string
+	// Err is the underlying parse error, if any.
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	if e.Err != nil {
+		return e.Var + " " + e.Problem + ": " + e.Err.Error()
+	}
+	return e.Var + " " + e.Problem
+}
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// Problems flattens an error returned by Load or Validate into the field
+// errors it joins, in the order they were found.
+func Problems(err error) []*FieldError {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var out []*FieldError
+		for _, e := range joined.Unwrap() {
+			out = append(out, Problems(e)...)
+		}
+		return out
+	}
+	var fe *FieldError
+	if errors.As(err, &fe) {
+		return []*FieldError{fe}
+	}
+	return []*FieldError{{Problem: err.Error()}}
+}
+
+// WriteProblems prints the problems in err as a table, one variable per
+// row, so every mistake can be fixed before the next start.
+func WriteProblems(w io.Writer, err error) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VARIABLE\tPROBLEM")
+	for _, p := range Problems(err) {
+		problem := p.Problem
+		if p.Err != nil {
+			problem += ": " + p.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", p.Var, problem)
+	}
+	tw.Flush()
+}
+
+// Validate reports every problem found in the configuration, joined with
+// errors.Join. Each one is a *FieldError; use Problems to list them.
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(name, format string, args ...any) {
+		errs = append(errs, &FieldError{Var: name, Problem: fmt.Sprintf(format, args...)})
+	}
+	if c.ListenAddr == "" {
+		add("LISTEN_ADDR", "must not be empty")
+	}
+	if c.ShutdownTimeout <= 0 {
+		add("SHUTDOWN_TIMEOUT", "must be positive")
+	}
+
+	if err := validateUpstreamURL("BACKEND_URL", c.BackendURL); err != nil {
+		errs = append(errs, err)
+	}
+	seen := make(map[string]bool, len(c.Upstreams))
+	for _, up := range c.Upstreams {
+		if !rules.ValidUpstreamName(up.Name) || up.Name == upstream.DefaultTarget {
+			add("UPSTREAMS", "has an invalid name %q", up.Name)
+			continue
+		}
+		if seen[up.Name] {
+			add("UPSTREAMS", "lists %q twice", up.Name)
+			continue
+		}
+		seen[up.Name] = true
+		if err := validateUpstreamURL("UPSTREAMS", up.URL); err != nil {
+			err.Problem = fmt.Sprintf("entry %q %s", up.Name, err.Problem)
+			errs = append(errs, err)
+		}
+		if up.HealthPath != "" && !strings.HasPrefix(up.HealthPath, "/") {
+			add("UPSTREAMS", "entry %q health must start with /", up.Name)
+		}
+		if up.HealthStatus != 0 && (up.HealthStatus < 100 || up.HealthStatus > 599) {
+			add("UPSTREAMS", "entry %q status must be an HTTP status code", up.Name)
+		}
+	}
+
+	switch c.StorageBackend {
+	case StorageRedis:
+		if c.RedisAddr == "" {
+			add("REDIS_ADDR", "must not be empty")
+		}
+	case StorageMemory:
+	default:
+		add("STORAGE_BACKEND", "must be %s or %s", StorageRedis, StorageMemory)
+	}
+	if c.RedisDB < 0 {
+		add("REDIS_DB", "must not be negative")
+	}
+	if c.RateLimitRequests <= 0 {
+		add("RATE_LIMIT_REQUESTS", "must be positive")
+	}
+	// Limiter state is kept with millisecond precision, so shorter
+	// windows would round to nothing.
+	if c.RateLimitWindow < time.Millisecond {
+		add("RATE_LIMIT_WINDOW", "must be at least 1ms")
+	}
+	if c.ShadowAlgorithm != "" && c.ShadowAlgorithm == c.LimiterAlgorithm {
+		add("SHADOW_ALGORITHM", "must differ from LIMITER_ALGORITHM")
+	}
+	if c.LocalLimitFraction < 0 || c.LocalLimitFraction > 1 {
+		add("LOCAL_LIMIT_FRACTION", "must be between 0 and 1")
+	}
+	if (c.BackendTLSCertFile == "") != (c.BackendTLSKeyFile == "") {
+		add("BACKEND_TLS_CERT_FILE", "and BACKEND_TLS_KEY_FILE must be set together")
+	}
+	if c.BackendMaxIdleConns <= 0 {
+		add("BACKEND_MAX_IDLE_CONNS", "must be positive")
+	}
+	if c.BackendMaxIdleConnsPerHost <= 0 {
+		add("BACKEND_MAX_IDLE_CONNS_PER_HOST", "must be positive")
+	}
+	if c.BackendMaxConnsPerHost < 0 {
+		add("BACKEND_MAX_CONNS_PER_HOST", "must not be negative")
+	}
+	if c.BackendDialTimeout <= 0 {
+		add("BACKEND_DIAL_TIMEOUT", "must be positive")
+	}
+	if c.BackendTLSHandshakeTimeout <= 0 {
+		add("BACKEND_TLS_HANDSHAKE_TIMEOUT", "must be positive")
+	}
+	if c.BackendResponseHeaderTimeout < 0 {
+		add("BACKEND_RESPONSE_HEADER_TIMEOUT", "must not be negative")
+	}
+	if c.BackendIdleConnTimeout <= 0 {
+		add("BACKEND_IDLE_CONN_TIMEOUT", "must be positive")
+	}
+	if c.BackendKeepAlive <= 0 {
+		add("BACKEND_KEEP_ALIVE", "must be positive")
+	}
+	if c.BackendDNSRefresh < 0 {
+		add("BACKEND_DNS_REFRESH", "must not be negative")
+	}
+	if c.BackendHealthPath != "" && !strings.HasPrefix(c.BackendHealthPath, "/") {
+		add("BACKEND_HEALTH_PATH", "must start with /")
+	}
+	if c.BackendHealthInterval <= 0 {
+		add("BACKEND_HEALTH_INTERVAL", "must be positive")
+	}
+	if c.BackendHealthTimeout <= 0 {
+		add("BACKEND_HEALTH_TIMEOUT", "must be positive")
+	}
+	if c.BackendHealthStatus < 100 || c.BackendHealthStatus > 599 {
+		add("BACKEND_HEALTH_STATUS", "must be an HTTP status code")
+	}
+	if c.CanaryPath != "" && !strings.HasPrefix(c.CanaryPath, "/") {
+		add("CANARY_PATH", "must start with /")
+	}
+	if c.CanaryInterval <= 0 {
+		add("CANARY_INTERVAL", "must be positive")
+	}
+	if c.CanaryTimeout <= 0 {
+		add("CANARY_TIMEOUT", "must be positive")
+	}
+	if c.CanaryStatus < 100 || c.CanaryStatus > 599 {
+		add("CANARY_STATUS", "must be an HTTP status code")
+	}
+	if c.BreakerFailurePercent < 1 || c.BreakerFailurePercent > 100 {
+		add("BREAKER_FAILURE_PERCENT", "must be between 1 and 100")
+	}
+	if c.BreakerMinRequests <= 0 {
+		add("BREAKER_MIN_REQUESTS", "must be positive")
+	}
+	if c.BreakerWindow <= 0 {
+		add("BREAKER_WINDOW", "must be positive")
+	}
+	if c.BreakerOpenDuration <= 0 {
+		add("BREAKER_OPEN_DURATION", "must be positive")
+	}
+	if c.MaxRequestHeaders < 0 {
+		add("MAX_REQUEST_HEADERS", "must not be negative")
+	}
+	if c.DebugRingSize < 0 || c.DebugRingSize > maxDebugRingSize {
+		add("DEBUG_RING_SIZE", "must be between 0 and %d", maxDebugRingSize)
+	}
+	if c.ShedThreshold < 0 {
+		add("SHED_IN_FLIGHT_THRESHOLD", "must not be negative")
+	}
+	if c.ShedThreshold > 0 && c.ShedMaxInFlight < c.ShedThreshold {
+		add("SHED_MAX_IN_FLIGHT", "must be at least SHED_IN_FLIGHT_THRESHOLD (%d)", c.ShedThreshold)
+	}
+	if c.MaxBackendBackoff < 0 {
+		add("MAX_BACKEND_BACKOFF", "must not be negative")
+	}
+	if c.AutoBanStrikes < 0 {
+		add("AUTO_BAN_STRIKES", "must not be negative")
+	}
+	if c.AutoBanStrikes > 0 {
+		if c.AutoBanWindow <= 0 {
+			add("AUTO_BAN_WINDOW", "must be positive")
+		}
+		if c.AutoBanDuration <= 0 {
+			add("AUTO_BAN_DURATION", "must be positive")
+		}
+	}
+	if c.DBMaxOpenConns < 0 {
+		add("DB_MAX_OPEN_CONNS", "must not be negative")
+	}
+	if c.DBMaxIdleConns < 0 {
+		add("DB_MAX_IDLE_CONNS", "must not be negative")
+	}
+	if c.DBConnMaxLifetime < 0 {
+		add("DB_CONN_MAX_LIFETIME", "must not be negative")
+	}
+	if c.DBMaxOpenConns > 0 && c.DBMaxIdleConns > c.DBMaxOpenConns {
+		add("DB_MAX_IDLE_CONNS", "must not exceed DB_MAX_OPEN_CONNS")
+	}
+	if c.AnalyticsBatchSize <= 0 || c.AnalyticsBatchSize > analytics.MaxBatchSize {
+		add("ANALYTICS_BATCH_SIZE", "must be between 1 and %d", analytics.MaxBatchSize)
+	}
+	if c.AnalyticsFlushInterval <= 0 {
+		add("ANALYTICS_FLUSH_INTERVAL", "must be positive")
+	}
+	if c.AnalyticsSpillMaxMB <= 0 {
+		add("ANALYTICS_SPILL_MAX_MB", "must be positive")
+	}
+	if c.AnalyticsMaxClockSkew <= 0 {
+		add("ANALYTICS_MAX_CLOCK_SKEW", "must be positive")
+	}
+	if c.UsageRollupInterval <= 0 {
+		add("USAGE_ROLLUP_INTERVAL", "must be positive")
+	}
+	if c.TrafficRollupInterval <= 0 || c.TrafficRollupInterval > time.Hour {
+		add("TRAFFIC_ROLLUP_INTERVAL", "must be between 0 and 1h")
+	}
+	if c.AnalyticsRetention != 0 {
+		if c.AnalyticsRetention < minAnalyticsRetention {
+			add("ANALYTICS_RETENTION", "must be 0 (keep forever) or at least %s, as rollups are recomputed from recent events", minAnalyticsRetention)
+		} else if len(c.SLOs) > 0 && c.AnalyticsRetention < c.SLOWindow {
+			add("ANALYTICS_RETENTION", "must be at least SLO_WINDOW (%s) to keep the error budgets it covers", c.SLOWindow)
+		}
+	}
+	if c.AnalyticsRetentionInterval <= 0 {
+		add("ANALYTICS_RETENTION_INTERVAL", "must be positive")
+	}
+	if c.RulesFilePollInterval <= 0 {
+		add("RULES_FILE_POLL_INTERVAL", "must be positive")
+	}
+	if c.GeoIPPollInterval <= 0 {
+		add("GEOIP_POLL_INTERVAL", "must be positive")
+	}
+	if c.JWTSecret != "" && len(c.JWTSecret) < 32 {
+		add("JWT_SECRET", "must be at least 32 bytes")
+	}
+	if c.JWTJWKSURL != "" {
+		if err := validateBackendURL("JWT_JWKS_URL", c.JWTJWKSURL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.JWTJWKSRefresh <= 0 {
+		add("JWT_JWKS_REFRESH", "must be positive")
+	}
+	if c.RulesSnapshotInterval <= 0 {
+		add("RULES_SNAPSHOT_INTERVAL", "must be positive")
+	}
+	if c.RulesLoadTimeout <= 0 {
+		add("RULES_LOAD_TIMEOUT", "must be positive")
+	}
+	if c.RulesLoadTimeoutPolicy != RulesLoadServe && c.RulesLoadTimeoutPolicy != RulesLoadReject {
+		add("RULES_LOAD_TIMEOUT_POLICY", "must be %s or %s", RulesLoadServe, RulesLoadReject)
+	}
+	if c.SMTPAddr != "" && c.SMTPFrom == "" {
+		add("SMTP_FROM", "is required when SMTP_ADDR is set")
+	}
+	for _, u := range c.RuleWebhookURLs {
+		if err := validateBackendURL("RULE_WEBHOOK_URLS", u); err != nil {
+			err.Problem = fmt.Sprintf("entry %q %s", u, err.Problem)
+			errs = append(errs, err)
+		}
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		add("TLS_CERT_FILE", "and TLS_KEY_FILE must be set together")
+	}
+	if len(c.TLSACMEDomains) > 0 {
+		if c.TLSCertFile != "" {
+			add("TLS_ACME_DOMAINS", "cannot be combined with TLS_CERT_FILE")
+		}
+		for _, d := range c.TLSACMEDomains {
+			if strings.Contains(d, "*") {
+				add("TLS_ACME_DOMAINS", "entry %q is a wildcard, which tls-alpn-01 validation cannot prove", d)
+			}
+		}
+		if err := validateBackendURL("TLS_ACME_DIRECTORY_URL", c.TLSACMEDirectoryURL); err != nil {
+			errs = append(errs, err)
+		}
+		if c.TLSACMECacheDir == "" {
+			add("TLS_ACME_CACHE_DIR", "is required when TLS_ACME_DOMAINS is set")
+		}
+	}
+	if (c.GRPCTLSCertFile == "") != (c.GRPCTLSKeyFile == "") {
+		add("GRPC_TLS_CERT_FILE", "and GRPC_TLS_KEY_FILE must be set together")
+	}
+	if c.OTLPEndpoint != "" {
+		if err := validateBackendURL("OTEL_EXPORTER_OTLP_ENDPOINT", c.OTLPEndpoint); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		add("OTEL_TRACES_SAMPLER_ARG", "must be between 0 and 1")
+	}
+	if c.StandbyPrimaryURL != "" {
+		if err := validateBackendURL("STANDBY_PRIMARY_URL", c.StandbyPrimaryURL); err != nil {
+			errs = append(errs, err)
+		}
+		if c.StandbyToken == "" {
+			add("STANDBY_TOKEN", "or ADMIN_API_TOKEN is required when STANDBY_PRIMARY_URL is set")
+		}
+		if c.StandbySyncInterval <= 0 {
+			add("STANDBY_SYNC_INTERVAL", "must be positive")
+		}
+	}
+	if len(c.SLOs) > 0 {
+		if c.SLOWindow < time.Hour {
+			add("SLO_WINDOW", "must be at least 1h")
+		}
+		if c.SLOEvaluationInterval <= 0 {
+			add("SLO_EVALUATION_INTERVAL", "must be positive")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateUpstreamURL is validateBackendURL for backends requests are
+// proxied to, which may also use h2c for cleartext HTTP/2.
+func validateUpstreamURL(name, raw string) *FieldError {
+	if rest, ok := strings.CutPrefix(raw, "h2c://"); ok {
+		raw = "http://" + rest
+	}
+	err := validateBackendURL(name, raw)
+	if err != nil {
+		err.Problem = strings.Replace(err.Problem, "http or https", "http, https or h2c", 1)
+	}
+	return err
+}
+
+func validateBackendURL(name, raw string) *FieldError {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return &FieldError{Var: name, Problem: "is invalid", Err: err}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &FieldError{Var: name, Problem: fmt.Sprintf("must use http or https, got %q", u.Scheme)}
+	}
+	if u.Host == "" {
+		return &FieldError{Var: name, Problem: "must include a host"}
+	}
+	return nil
+}
+
+func getEnv(key, fallback string) string {
+	if v, ok := lookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) (int, error) {
+	v := getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, &FieldError{Var: key, Problem: "must be an integer", Err: err}
+	}
+	return n, nil
+}
+
+func getEnvBool(key string, fallback bool) (bool, error) {
+	v := getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, &FieldError{Var: key, Problem: "must be a boolean", Err: err}
+	}
+	return b, nil
+}
+
+func getEnvFloat(key string, fallback float64) (float64, error) {
+	v := getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, &FieldError{Var: key, Problem: "must be a number", Err: err}
+	}
+	return f, nil
+}
+
+// getEnvList splits a comma-separated list, dropping empty entries.
+func getEnvList(key string) []string {
+	var out []string
+	for _, item := range strings.Split(getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// getEnvPrefixes parses a comma-separated list of CIDR ranges and single
+// addresses.
+func getEnvPrefixes(key string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, item := range getEnvList(key) {
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(item)
+			if aerr != nil {
+				return nil, &FieldError{Var: key, Problem: fmt.Sprintf("entries must be IP addresses or CIDR ranges, got %q", item), Err: err}
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		out = append(out, prefix.Masked())
+	}
+	return out, nil
+}
+
+// getEnvHeaders parses a comma-separated list of key=value pairs, as the
+// OpenTelemetry OTEL_EXPORTER_OTLP_HEADERS variable does.
+func getEnvHeaders(key string) (map[string]string, error) {
+	v := getenv(key)
+	if v == "" {
+		return nil, nil
+	}
+	out := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, &FieldError{Var: key, Problem: fmt.Sprintf("entries must look like key=value, got %q", pair)}
+		}
+		out[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return out, nil
+}
+
+// getEnvUpstreams parses a comma-separated list of name=url pairs. Each
+// url may be followed by ;-separated health check settings, as in
+// billing=http://billing:8080;health=/ready;interval=5s;status=204.
+func getEnvUpstreams(key string) ([]Upstream, error) {
+	v := getenv(key)
+	if v == "" {
+		return nil, nil
+	}
+	var out []Upstream
+	for _, pair := range strings.Split(v, ",") {
+		name, rest, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, &FieldError{Var: key, Problem: fmt.Sprintf("entries must look like name=url, got %q", pair)}
+		}
+		settings := strings.Split(rest, ";")
+		up := Upstream{Name: strings.TrimSpace(name), URL: strings.TrimSpace(settings[0])}
+		for _, setting := range settings[1:] {
+			k, val, _ := strings.Cut(strings.TrimSpace(setting), "=")
+			val = strings.TrimSpace(val)
+			var err error
+			switch strings.TrimSpace(k) {
+			case "health":
+				up.HealthPath = val
+			case "interval":
+				up.HealthInterval, err = parseDuration(val)
+				if err == nil && up.HealthInterval <= 0 {
+					err = errors.New("must be positive")
+				}
+			case "status":
+				up.HealthStatus, err = strconv.Atoi(val)
+			default:
+				return nil, &FieldError{Var: key, Problem: fmt.Sprintf("entry %q has an unknown setting %q, want health, interval or status", up.Name, setting)}
+			}
+			if err != nil {
+				return nil, &FieldError{Var: key, Problem: fmt.Sprintf("entry %q has an invalid %s %q", up.Name, k, val), Err: err}
+			}
+		}
+		out = append(out, up)
+	}
+	return out, nil
+}
+
+// getEnvDuration accepts a Go duration ("5s", "1m30s") or a bare number of
+// seconds.
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := parseDuration(v)
+	if err != nil {
+		return 0, &FieldError{Var: key, Problem: "must be a duration such as 5s", Err: err}
+	}
+	return d, nil
+}
+
+// parseDuration parses a Go duration or a bare number of seconds.
+func parseDuration(v string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	return time.ParseDuration(v)
+}
@@ -0,0 +1,702 @@
+package config
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/logging"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("LISTEN_ADDR", "")
+	t.Setenv("BACKEND_URL", "")
+	t.Setenv("ADMIN_API_TOKEN", "")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.ListenAddr != ":3000" {
+		t.Errorf("Expected ListenAddr :3000, got %s", cfg.ListenAddr)
+	}
+	if cfg.BackendURL != "http://localhost:8080" {
+		t.Errorf("Expected default BackendURL, got %s", cfg.BackendURL)
+	}
+	if cfg.AdminAPIToken != "" {
+		t.Errorf("Expected empty AdminAPIToken, got %s", cfg.AdminAPIToken)
+	}
+	if cfg.StorageBackend != StorageRedis || cfg.RedisAddr != "localhost:6379" {
+		t.Errorf("Expected default Redis storage, got %s at %s", cfg.StorageBackend, cfg.RedisAddr)
+	}
+	if cfg.RateLimitRequests != 100 || cfg.RateLimitWindow != time.Minute {
+		t.Errorf("Expected default limit 100/1m, got %d/%v", cfg.RateLimitRequests, cfg.RateLimitWindow)
+	}
+	if cfg.TrustProxy || cfg.DevMode {
+		t.Error("Expected TrustProxy and DevMode to default to false")
+	}
+	if cfg.LogLevel != logging.LevelInfo {
+		t.Errorf("Expected log level info, got %v", cfg.LogLevel)
+	}
+	if cfg.LimiterAlgorithm != "sliding_window" || cfg.ShadowAlgorithm != "" {
+		t.Errorf("Expected sliding window without shadow, got %q/%q", cfg.LimiterAlgorithm, cfg.ShadowAlgorithm)
+	}
+	if cfg.RulesLoadTimeout != 30*time.Second || cfg.RulesLoadTimeoutPolicy != RulesLoadServe {
+		t.Errorf("Expected rules load timeout 30s then serve, got %v then %s", cfg.RulesLoadTimeout, cfg.RulesLoadTimeoutPolicy)
+	}
+	if cfg.MaxRequestHeaders != 100 {
+		t.Errorf("Expected at most 100 request headers by default, got %d", cfg.MaxRequestHeaders)
+	}
+	if cfg.DebugRingSize != 100 {
+		t.Errorf("Expected diagnostics of 100 requests kept by default, got %d", cfg.DebugRingSize)
+	}
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	t.Setenv("LISTEN_ADDR", ":4000")
+	t.Setenv("BACKEND_URL", "https://api.internal:9443")
+	t.Setenv("ADMIN_API_TOKEN", "secret")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.ListenAddr != ":4000" {
+		t.Errorf("Expected ListenAddr :4000, got %s", cfg.ListenAddr)
+	}
+	if cfg.BackendURL != "https://api.internal:9443" {
+		t.Errorf("Unexpected BackendURL %s", cfg.BackendURL)
+	}
+	if cfg.AdminAPIToken != "secret" {
+		t.Errorf("Unexpected AdminAPIToken %s", cfg.AdminAPIToken)
+	}
+}
+
+func TestLoadRateLimitAndFlags(t *testing.T) {
+	t.Setenv("RATE_LIMIT_REQUESTS", "25")
+	t.Setenv("RATE_LIMIT_WINDOW", "30")
+	t.Setenv("TRUST_PROXY", "true")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.10")
+	t.Setenv("DEV_MODE", "1")
+	t.Setenv("REDIS_DB", "2")
+	t.Setenv("HONOR_BACKEND_LIMITS", "true")
+	t.Setenv("MAX_BACKEND_BACKOFF", "30s")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.RateLimitRequests != 25 || cfg.RateLimitWindow != 30*time.Second {
+		t.Errorf("Expected 25/30s, got %d/%v", cfg.RateLimitRequests, cfg.RateLimitWindow)
+	}
+	if !cfg.TrustProxy || !cfg.DevMode {
+		t.Error("Expected TrustProxy and DevMode to be enabled")
+	}
+	if want := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.0.2.10/32")}; !slices.Equal(cfg.TrustedProxies, want) {
+		t.Errorf("Expected trusted proxies %v, got %v", want, cfg.TrustedProxies)
+	}
+	if cfg.RedisDB != 2 {
+		t.Errorf("Expected RedisDB 2, got %d", cfg.RedisDB)
+	}
+	if !cfg.HonorBackendLimits || cfg.MaxBackendBackoff != 30*time.Second {
+		t.Errorf("Expected backend limits honored up to 30s, got %v/%v", cfg.HonorBackendLimits, cfg.MaxBackendBackoff)
+	}
+}
+
+func TestLoadRateLimitWindowDurations(t *testing.T) {
+	tests := map[string]time.Duration{
+		"90":    90 * time.Second,
+		"90s":   90 * time.Second,
+		"5m":    5 * time.Minute,
+		"1h":    time.Hour,
+		"250ms": 250 * time.Millisecond,
+	}
+	for value, want := range tests {
+		t.Run(value, func(t *testing.T) {
+			t.Setenv("RATE_LIMIT_WINDOW", value)
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.RateLimitWindow != want {
+				t.Errorf("RateLimitWindow = %v, want %v", cfg.RateLimitWindow, want)
+			}
+		})
+	}
+
+	t.Setenv("RATE_LIMIT_WINDOW", "500us")
+	if _, err := Load(); err == nil {
+		t.Error("Expected a window under 1ms to be rejected")
+	}
+}
+
+func TestLoadBackendHealth(t *testing.T) {
+	t.Setenv("BACKEND_HEALTH_PATH", "/healthz")
+	t.Setenv("BACKEND_HEALTH_INTERVAL", "5s")
+	t.Setenv("BACKEND_HEALTH_STATUS", "204")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.BackendHealthPath != "/healthz" || cfg.BackendHealthInterval != 5*time.Second {
+		t.Errorf("Unexpected health check %s every %v", cfg.BackendHealthPath, cfg.BackendHealthInterval)
+	}
+	if cfg.BackendHealthTimeout != 2*time.Second || cfg.BackendHealthStatus != 204 {
+		t.Errorf("Unexpected timeout/status %v/%d", cfg.BackendHealthTimeout, cfg.BackendHealthStatus)
+	}
+}
+
+func TestLoadAnalytics(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/gatify")
+	t.Setenv("ANALYTICS_BATCH_SIZE", "50")
+	t.Setenv("ANALYTICS_FLUSH_INTERVAL", "2s")
+	t.Setenv("DATABASE_READ_URL", "postgres://replica/gatify")
+	t.Setenv("DB_MAX_OPEN_CONNS", "20")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "5m")
+	t.Setenv("USAGE_ROLLUP_INTERVAL", "1h")
+	t.Setenv("TRAFFIC_ROLLUP_INTERVAL", "5m")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.DatabaseURL != "postgres://localhost/gatify" || !cfg.AnalyticsEnabled {
+		t.Errorf("Unexpected analytics config %+v", cfg)
+	}
+	if cfg.AnalyticsBatchSize != 50 || cfg.AnalyticsFlushInterval != 2*time.Second {
+		t.Errorf("Expected batch 50 every 2s, got %d every %v", cfg.AnalyticsBatchSize, cfg.AnalyticsFlushInterval)
+	}
+	if !cfg.AnalyticsAdaptiveFlush {
+		t.Error("Expected adaptive flushing by default")
+	}
+	if cfg.UsageRollupInterval != time.Hour {
+		t.Errorf("Expected hourly usage rollups, got %v", cfg.UsageRollupInterval)
+	}
+	if cfg.TrafficRollupInterval != 5*time.Minute {
+		t.Errorf("Expected traffic rollups every 5m, got %v", cfg.TrafficRollupInterval)
+	}
+	if cfg.DatabaseReadURL != "postgres://replica/gatify" {
+		t.Errorf("Unexpected DatabaseReadURL %s", cfg.DatabaseReadURL)
+	}
+	if cfg.DBMaxOpenConns != 20 || cfg.DBMaxIdleConns != 5 || cfg.DBConnMaxLifetime != 5*time.Minute {
+		t.Errorf("Unexpected pool sizing %d/%d/%v", cfg.DBMaxOpenConns, cfg.DBMaxIdleConns, cfg.DBConnMaxLifetime)
+	}
+
+	t.Setenv("ANALYTICS_FLUSH_INTERVAL", "10")
+	if cfg, err = Load(); err != nil || cfg.AnalyticsFlushInterval != 10*time.Second {
+		t.Errorf("Expected bare seconds to parse, got %v (err %v)", cfg, err)
+	}
+
+	t.Setenv("ANALYTICS_ADAPTIVE_FLUSH", "false")
+	if cfg, err = Load(); err != nil || cfg.AnalyticsAdaptiveFlush {
+		t.Errorf("Expected ANALYTICS_ADAPTIVE_FLUSH=false to fix batching, got %v (err %v)", cfg.AnalyticsAdaptiveFlush, err)
+	}
+}
+
+func TestLoadAnalyticsRetention(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.AnalyticsRetention != 0 || cfg.AnalyticsRetentionInterval != time.Hour {
+		t.Errorf("retention defaults = %v every %v", cfg.AnalyticsRetention, cfg.AnalyticsRetentionInterval)
+	}
+
+	t.Setenv("ANALYTICS_RETENTION", "720h")
+	t.Setenv("ANALYTICS_RETENTION_INTERVAL", "6h")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.AnalyticsRetention != 720*time.Hour || cfg.AnalyticsRetentionInterval != 6*time.Hour {
+		t.Errorf("retention = %v every %v", cfg.AnalyticsRetention, cfg.AnalyticsRetentionInterval)
+	}
+
+	t.Setenv("ANALYTICS_RETENTION", "24h")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for a retention shorter than the rollups' lookback")
+	}
+
+	t.Setenv("ANALYTICS_RETENTION", "168h")
+	t.Setenv("SLOS", "api=/api/* 300ms 99%")
+	t.Setenv("SLO_WINDOW", "720h")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for a retention shorter than SLO_WINDOW")
+	}
+}
+
+func TestLoadUpstreamHealthChecks(t *testing.T) {
+	t.Setenv("UPSTREAMS", "users=http://users:8080;health=/ready;interval=5s;status=204, billing=http://billing:8080;interval=30")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := []Upstream{
+		{Name: "users", URL: "http://users:8080", HealthPath: "/ready", HealthInterval: 5 * time.Second, HealthStatus: 204},
+		{Name: "billing", URL: "http://billing:8080", HealthInterval: 30 * time.Second},
+	}
+	if len(cfg.Upstreams) != len(want) || cfg.Upstreams[0] != want[0] || cfg.Upstreams[1] != want[1] {
+		t.Errorf("Upstreams = %+v, want %+v", cfg.Upstreams, want)
+	}
+}
+
+func TestLoadUpstreams(t *testing.T) {
+	t.Setenv("UPSTREAMS", "users=http://users:8080, billing=https://billing.internal, orders=h2c://orders:50051")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := []Upstream{{Name: "users", URL: "http://users:8080"}, {Name: "billing", URL: "https://billing.internal"}, {Name: "orders", URL: "h2c://orders:50051"}}
+	if len(cfg.Upstreams) != len(want) || cfg.Upstreams[0] != want[0] || cfg.Upstreams[1] != want[1] || cfg.Upstreams[2] != want[2] {
+		t.Errorf("Upstreams = %+v, want %+v", cfg.Upstreams, want)
+	}
+
+	for _, bad := range []string{
+		"default=http://a", "users=ftp://a", "users=h2c://", "a=http://a,a=http://b", "bad name=http://a",
+		"users=http://a;health=ready", "users=http://a;interval=soon", "users=http://a;interval=0",
+		"users=http://a;status=42", "users=http://a;status=ok", "users=http://a;timeout=1s",
+	} {
+		t.Setenv("UPSTREAMS", bad)
+		if _, err := Load(); err == nil {
+			t.Errorf("Expected error for UPSTREAMS=%s", bad)
+		}
+	}
+}
+
+func TestLoadRuleWebhooks(t *testing.T) {
+	t.Setenv("RULE_WEBHOOK_URLS", "https://ops.example.com/hooks/gatify, ,http://bot:9000/changes")
+	t.Setenv("RULE_WEBHOOK_SECRET", "s3cret")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.RuleWebhookURLs) != 2 || cfg.RuleWebhookURLs[1] != "http://bot:9000/changes" || cfg.RuleWebhookSecret != "s3cret" {
+		t.Errorf("rule webhooks = %v %q", cfg.RuleWebhookURLs, cfg.RuleWebhookSecret)
+	}
+
+	t.Setenv("RULE_WEBHOOK_URLS", "ftp://ops.example.com")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for a non-HTTP rule webhook")
+	}
+}
+
+func TestLoadTLS(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "/etc/gatify/tls.crt")
+	t.Setenv("TLS_KEY_FILE", "/etc/gatify/tls.key")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.TLSCertFile != "/etc/gatify/tls.crt" || cfg.TLSKeyFile != "/etc/gatify/tls.key" {
+		t.Errorf("TLS files = %q %q", cfg.TLSCertFile, cfg.TLSKeyFile)
+	}
+
+	t.Setenv("TLS_KEY_FILE", "")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for a certificate without a key")
+	}
+
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("TLS_ACME_DOMAINS", "example.com, www.example.com")
+	t.Setenv("TLS_ACME_EMAIL", "ops@example.com")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.TLSACMEDomains) != 2 || cfg.TLSACMEDomains[1] != "www.example.com" || cfg.TLSACMEEmail != "ops@example.com" {
+		t.Errorf("ACME config = %v %q", cfg.TLSACMEDomains, cfg.TLSACMEEmail)
+	}
+	if cfg.TLSACMECacheDir != "acme-cache" || !strings.Contains(cfg.TLSACMEDirectoryURL, "letsencrypt.org") {
+		t.Errorf("ACME defaults = %q %q", cfg.TLSACMECacheDir, cfg.TLSACMEDirectoryURL)
+	}
+
+	t.Setenv("TLS_ACME_DOMAINS", "*.example.com")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for a wildcard ACME domain")
+	}
+
+	t.Setenv("TLS_ACME_DOMAINS", "example.com")
+	t.Setenv("TLS_CERT_FILE", "/etc/gatify/tls.crt")
+	t.Setenv("TLS_KEY_FILE", "/etc/gatify/tls.key")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for ACME combined with certificate files")
+	}
+}
+
+func TestLoadBackendTransport(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.BackendMaxIdleConns != 100 || cfg.BackendMaxIdleConnsPerHost != 2 || cfg.BackendMaxConnsPerHost != 0 {
+		t.Errorf("pool defaults = %d/%d/%d", cfg.BackendMaxIdleConns, cfg.BackendMaxIdleConnsPerHost, cfg.BackendMaxConnsPerHost)
+	}
+	if cfg.BackendDialTimeout != 30*time.Second || cfg.BackendResponseHeaderTimeout != 0 || cfg.BackendIdleConnTimeout != 90*time.Second {
+		t.Errorf("timeout defaults = %v/%v/%v", cfg.BackendDialTimeout, cfg.BackendResponseHeaderTimeout, cfg.BackendIdleConnTimeout)
+	}
+	if cfg.BackendDNSRefresh != 30*time.Second {
+		t.Errorf("BackendDNSRefresh = %v, want 30s", cfg.BackendDNSRefresh)
+	}
+
+	t.Setenv("BACKEND_TLS_CERT_FILE", "/etc/gatify/client.crt")
+	t.Setenv("BACKEND_TLS_KEY_FILE", "/etc/gatify/client.key")
+	t.Setenv("BACKEND_TLS_CA_FILE", "/etc/gatify/backend-ca.pem")
+	t.Setenv("BACKEND_MAX_IDLE_CONNS_PER_HOST", "64")
+	t.Setenv("BACKEND_MAX_CONNS_PER_HOST", "256")
+	t.Setenv("BACKEND_RESPONSE_HEADER_TIMEOUT", "15s")
+	t.Setenv("BACKEND_DISABLE_KEEP_ALIVES", "true")
+	t.Setenv("BACKEND_DNS_REFRESH", "0")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.BackendTLSCertFile != "/etc/gatify/client.crt" || cfg.BackendTLSKeyFile != "/etc/gatify/client.key" || cfg.BackendTLSCAFile != "/etc/gatify/backend-ca.pem" {
+		t.Errorf("backend TLS = %q %q %q", cfg.BackendTLSCertFile, cfg.BackendTLSKeyFile, cfg.BackendTLSCAFile)
+	}
+	if cfg.BackendMaxIdleConnsPerHost != 64 || cfg.BackendMaxConnsPerHost != 256 ||
+		cfg.BackendResponseHeaderTimeout != 15*time.Second || !cfg.BackendDisableKeepAlives {
+		t.Errorf("backend transport = %d %d %v %v", cfg.BackendMaxIdleConnsPerHost, cfg.BackendMaxConnsPerHost,
+			cfg.BackendResponseHeaderTimeout, cfg.BackendDisableKeepAlives)
+	}
+	if cfg.BackendDNSRefresh != 0 {
+		t.Errorf("BackendDNSRefresh = %v, want 0 to disable it", cfg.BackendDNSRefresh)
+	}
+
+	t.Setenv("BACKEND_TLS_KEY_FILE", "")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for a client certificate without a key")
+	}
+}
+
+func TestLoadGRPC(t *testing.T) {
+	t.Setenv("GRPC_LISTEN_ADDR", ":9090")
+	t.Setenv("GRPC_TLS_CERT_FILE", "/etc/gatify/tls.crt")
+	t.Setenv("GRPC_TLS_KEY_FILE", "/etc/gatify/tls.key")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.GRPCListenAddr != ":9090" || cfg.GRPCTLSCertFile != "/etc/gatify/tls.crt" || cfg.GRPCTLSKeyFile != "/etc/gatify/tls.key" {
+		t.Errorf("gRPC config = %q %q %q", cfg.GRPCListenAddr, cfg.GRPCTLSCertFile, cfg.GRPCTLSKeyFile)
+	}
+
+	t.Setenv("GRPC_TLS_KEY_FILE", "")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for a certificate without a key")
+	}
+}
+
+func TestLoadShedding(t *testing.T) {
+	t.Setenv("SHED_IN_FLIGHT_THRESHOLD", "200")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.ShedThreshold != 200 || cfg.ShedMaxInFlight != 400 {
+		t.Errorf("shedding config = %d %d", cfg.ShedThreshold, cfg.ShedMaxInFlight)
+	}
+
+	t.Setenv("SHED_MAX_IN_FLIGHT", "100")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for a maximum below the threshold")
+	}
+}
+
+func TestLoadAutoBan(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.AutoBanStrikes != 0 || cfg.AutoBanWindow != 10*time.Minute || cfg.AutoBanDuration != time.Hour {
+		t.Errorf("auto ban defaults = %d %v %v", cfg.AutoBanStrikes, cfg.AutoBanWindow, cfg.AutoBanDuration)
+	}
+
+	t.Setenv("AUTO_BAN_STRIKES", "20")
+	t.Setenv("AUTO_BAN_WINDOW", "5m")
+	t.Setenv("AUTO_BAN_DURATION", "24h")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.AutoBanStrikes != 20 || cfg.AutoBanWindow != 5*time.Minute || cfg.AutoBanDuration != 24*time.Hour {
+		t.Errorf("auto ban config = %d %v %v", cfg.AutoBanStrikes, cfg.AutoBanWindow, cfg.AutoBanDuration)
+	}
+
+	t.Setenv("AUTO_BAN_DURATION", "0s")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for a zero ban duration")
+	}
+}
+
+func TestLoadGeoIP(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.GeoIPDBPath != "" || cfg.GeoIPPollInterval != time.Minute {
+		t.Errorf("GeoIP defaults = %q %v", cfg.GeoIPDBPath, cfg.GeoIPPollInterval)
+	}
+
+	t.Setenv("GEOIP_DB_PATH", "/var/lib/GeoIP/GeoLite2-Country.mmdb")
+	t.Setenv("GEOIP_POLL_INTERVAL", "10m")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.GeoIPDBPath != "/var/lib/GeoIP/GeoLite2-Country.mmdb" || cfg.GeoIPPollInterval != 10*time.Minute {
+		t.Errorf("GeoIP config = %q %v", cfg.GeoIPDBPath, cfg.GeoIPPollInterval)
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gatify.env")
+	content := `# reloaded on SIGHUP
+BACKEND_URL="http://backend-v2:8080"
+export RATE_LIMIT_REQUESTS=250
+LOG_LEVEL='warn'
+
+TRUST_PROXY=true
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("BACKEND_URL", "http://backend-v1:8080")
+	t.Setenv("RATE_LIMIT_WINDOW", "30s")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.BackendURL != "http://backend-v1:8080" {
+		t.Errorf("Expected the environment to override the file, got %s", cfg.BackendURL)
+	}
+	if cfg.RateLimitRequests != 250 || cfg.RateLimitWindow != 30*time.Second || !cfg.TrustProxy || cfg.LogLevel != logging.LevelWarn {
+		t.Errorf("Unexpected config %d/%v trust=%v level=%v", cfg.RateLimitRequests, cfg.RateLimitWindow, cfg.TrustProxy, cfg.LogLevel)
+	}
+	if cfg.ConfigFile != path {
+		t.Errorf("Expected ConfigFile %s, got %s", path, cfg.ConfigFile)
+	}
+
+	// Values from the file do not leak into later loads.
+	t.Setenv("CONFIG_FILE", "")
+	if cfg, _ := Load(); cfg.RateLimitRequests == 250 {
+		t.Error("Expected RATE_LIMIT_REQUESTS from the file to be forgotten")
+	}
+
+	if err := os.WriteFile(path, []byte("NOT A VARIABLE\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	if _, err := Load(); err == nil || Problems(err)[0].Var != "CONFIG_FILE" {
+		t.Errorf("Expected a malformed file to be reported, got %v", err)
+	}
+}
+
+func TestLoadCanary(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.CanaryPath != "" || cfg.CanaryMethod != "GET" || cfg.CanaryInterval != 30*time.Second ||
+		cfg.CanaryTimeout != 5*time.Second || cfg.CanaryStatus != 200 {
+		t.Errorf("canary defaults = %q %q %v %v %d", cfg.CanaryPath, cfg.CanaryMethod, cfg.CanaryInterval, cfg.CanaryTimeout, cfg.CanaryStatus)
+	}
+
+	t.Setenv("CANARY_PATH", "/api/status")
+	t.Setenv("CANARY_METHOD", "head")
+	t.Setenv("CANARY_INTERVAL", "1m")
+	t.Setenv("CANARY_STATUS", "204")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.CanaryPath != "/api/status" || cfg.CanaryMethod != "HEAD" || cfg.CanaryInterval != time.Minute || cfg.CanaryStatus != 204 {
+		t.Errorf("canary config = %q %q %v %d", cfg.CanaryPath, cfg.CanaryMethod, cfg.CanaryInterval, cfg.CanaryStatus)
+	}
+}
+
+func TestLoadTracing(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.OTLPEndpoint != "" || cfg.OTelServiceName != "gatify" || cfg.TraceSampleRatio != 1 {
+		t.Errorf("tracing defaults = %q %q %v", cfg.OTLPEndpoint, cfg.OTelServiceName, cfg.TraceSampleRatio)
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "authorization=Bearer abc, x-tenant=acme")
+	t.Setenv("OTEL_SERVICE_NAME", "edge-gateway")
+	t.Setenv("OTEL_TRACES_SAMPLER_ARG", "0.25")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.OTLPEndpoint != "http://collector:4318" || cfg.OTelServiceName != "edge-gateway" || cfg.TraceSampleRatio != 0.25 {
+		t.Errorf("tracing = %q %q %v", cfg.OTLPEndpoint, cfg.OTelServiceName, cfg.TraceSampleRatio)
+	}
+	if cfg.OTLPHeaders["authorization"] != "Bearer abc" || cfg.OTLPHeaders["x-tenant"] != "acme" {
+		t.Errorf("OTLPHeaders = %v", cfg.OTLPHeaders)
+	}
+}
+
+func TestLoadStandby(t *testing.T) {
+	t.Setenv("STANDBY_PRIMARY_URL", "http://gatify-a:8080")
+	if _, err := Load(); err == nil {
+		t.Fatal("Expected a standby without a token to be rejected")
+	}
+
+	t.Setenv("ADMIN_API_TOKEN", "secret")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.StandbyToken != "secret" || cfg.StandbySyncInterval != 15*time.Second {
+		t.Errorf("standby = %q %v", cfg.StandbyToken, cfg.StandbySyncInterval)
+	}
+}
+
+func TestLoadSLOs(t *testing.T) {
+	t.Setenv("SLOS", "api=/api/* 300ms 99%")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.SLOs) != 1 || cfg.SLOs[0].Threshold != 300*time.Millisecond || cfg.SLOWindow != 30*24*time.Hour {
+		t.Errorf("SLOs = %+v over %v", cfg.SLOs, cfg.SLOWindow)
+	}
+
+	t.Setenv("SLO_WINDOW", "5m")
+	if _, err := Load(); err == nil {
+		t.Error("Expected a window under an hour to be rejected")
+	}
+}
+
+func TestLoadRejectsMalformedValues(t *testing.T) {
+	tests := map[string]string{
+		"RATE_LIMIT_REQUESTS":         "lots",
+		"RATE_LIMIT_WINDOW":           "0",
+		"TRUST_PROXY":                 "maybe",
+		"TRUSTED_PROXIES":             "10.0.0.0/8, lb.internal",
+		"REDIS_DB":                    "-1",
+		"BACKEND_HEALTH_PATH":         "healthz",
+		"BACKEND_HEALTH_STATUS":       "42",
+		"BACKEND_MAX_CONNS_PER_HOST":  "-1",
+		"BACKEND_DIAL_TIMEOUT":        "0s",
+		"BACKEND_DNS_REFRESH":         "-30s",
+		"CANARY_PATH":                 "status",
+		"LOG_LEVEL":                   "verbose",
+		"CANARY_STATUS":               "1000",
+		"CANARY_INTERVAL":             "0s",
+		"MAX_BACKEND_BACKOFF":         "-1s",
+		"MAX_REQUEST_HEADERS":         "-1",
+		"BREAKER_FAILURE_PERCENT":     "150",
+		"BREAKER_OPEN_DURATION":       "0",
+		"SHADOW_ALGORITHM":            "sliding_window",
+		"DB_MAX_IDLE_CONNS":           "50",
+		"ANALYTICS_BATCH_SIZE":        "5000",
+		"ANALYTICS_FLUSH_INTERVAL":    "soon",
+		"ANALYTICS_SPILL_MAX_MB":      "0",
+		"ANALYTICS_MAX_CLOCK_SKEW":    "-1s",
+		"USAGE_ROLLUP_INTERVAL":       "0",
+		"TRAFFIC_ROLLUP_INTERVAL":     "2h",
+		"RULES_FILE_POLL_INTERVAL":    "0s",
+		"GEOIP_POLL_INTERVAL":         "0s",
+		"JWT_SECRET":                  "too-short",
+		"JWT_JWKS_URL":                "ftp://auth.example.com/jwks",
+		"JWT_JWKS_REFRESH":            "0s",
+		"SHED_IN_FLIGHT_THRESHOLD":    "-1",
+		"AUTO_BAN_STRIKES":            "-1",
+		"DEBUG_RING_SIZE":             "100000",
+		"RULES_SNAPSHOT_INTERVAL":     "-5s",
+		"RULES_LOAD_TIMEOUT":          "0",
+		"RULES_LOAD_TIMEOUT_POLICY":   "wait",
+		"UPSTREAMS":                   "users",
+		"SMTP_ADDR":                   "smtp.example.com:587",
+		"SHUTDOWN_TIMEOUT":            "0",
+		"LISTEN_REUSE_PORT":           "sometimes",
+		"STORAGE_BACKEND":             "etcd",
+		"OTEL_EXPORTER_OTLP_ENDPOINT": "collector:4318",
+		"OTEL_EXPORTER_OTLP_HEADERS":  "token",
+		"OTEL_TRACES_SAMPLER_ARG":     "1.5",
+		"LOCAL_LIMIT_FRACTION":        "2",
+		"STANDBY_PRIMARY_URL":         "gatify-a:8080",
+		"SLOS":                        "api=/api/* 300ms",
+		"SLO_WINDOW":                  "forever",
+	}
+
+	for key, value := range tests {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := Load(); err == nil {
+				t.Errorf("Expected error for %s=%s", key, value)
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	t.Setenv("RATE_LIMIT_REQUESTS", "lots")
+	t.Setenv("BREAKER_FAILURE_PERCENT", "150")
+	t.Setenv("BACKEND_URL", "ftp://example.com")
+	t.Setenv("SHUTDOWN_TIMEOUT", "0")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	var vars []string
+	for _, p := range Problems(err) {
+		vars = append(vars, p.Var)
+	}
+	// RATE_LIMIT_REQUESTS fails to parse and must not also be reported as
+	// not positive.
+	want := []string{"RATE_LIMIT_REQUESTS", "SHUTDOWN_TIMEOUT", "BACKEND_URL", "BREAKER_FAILURE_PERCENT"}
+	if strings.Join(vars, ",") != strings.Join(want, ",") {
+		t.Errorf("Problems = %v, want %v", vars, want)
+	}
+
+	var buf bytes.Buffer
+	WriteProblems(&buf, err)
+	out := buf.String()
+	for _, s := range append(want, "VARIABLE", "must be an integer", "must be between 1 and 100") {
+		if !strings.Contains(out, s) {
+			t.Errorf("table is missing %q:\n%s", s, out)
+		}
+	}
+}
+
+func TestValidateRejectsBadBackend(t *testing.T) {
+	tests := []string{
+		"ftp://example.com",
+		"http://",
+		"://nope",
+	}
+
+	for _, backend := range tests {
+		cfg := &Config{
+			ListenAddr:        ":3000",
+			BackendURL:        backend,
+			StorageBackend:    StorageRedis,
+			RedisAddr:         "localhost:6379",
+			RateLimitRequests: 1,
+			RateLimitWindow:   time.Second,
+		}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected error for BACKEND_URL %q", backend)
+		}
+	}
+}
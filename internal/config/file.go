@@ -0,0 +1,60 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// fileValues holds the variables read from CONFIG_FILE while Load runs.
+var fileValues map[string]string
+
+// lookupEnv finds a variable in the command-line overrides, then the
+// environment, then CONFIG_FILE.
+func lookupEnv(key string) (string, bool) {
+	if v, ok := overrides[key]; ok {
+		return v, true
+	}
+	if v, ok := os.LookupEnv(key); ok {
+		return v, true
+	}
+	v, ok := fileValues[key]
+	return v, ok
+}
+
+func getenv(key string) string {
+	v, _ := lookupEnv(key)
+	return v
+}
+
+// readConfigFile parses a file of KEY=VALUE lines in the format of
+// .env.example. Blank lines and lines starting with # are ignored, and
+// values may be wrapped in single or double quotes.
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+)
+
+// flagVars maps each command-line flag to the variable it overrides.
+var flagVars = []struct {
+	name, variable, usage string
+}{
+	{"config", "CONFIG_FILE", "`file` of KEY=VALUE settings, re-read on SIGHUP"},
+	{"listen", "LISTEN_ADDR", "`address` to serve on"},
+	{"backend-url", "BACKEND_URL", "`URL` of the default backend"},
+	{"redis-addr", "REDIS_ADDR", "Redis `address`"},
+	{"admin-token-file", "ADMIN_API_TOKEN_FILE", "`file` holding the management API admin token"},
+}
+
+// overrides holds the variables set with command-line flags. Unlike
+// fileValues they are kept for the life of the process, so a reload
+// keeps honoring them.
+var overrides map[string]string
+
+// ParseFlags parses the gateway's command-line flags. Each overrides the
+// environment variable of the same meaning in this and every later Load.
+// Problems are printed to output with the usage; flag.ErrHelp is returned
+// when usage was requested.
+func ParseFlags(args []string, output io.Writer) error {
+	fs := flag.NewFlagSet("gatify", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintf(output, "Usage: gatify [flags]\n\nFlags take precedence over environment variables, which take\nprecedence over the config file.\n\n")
+		fs.PrintDefaults()
+	}
+	values := make(map[string]*string, len(flagVars))
+	for _, f := range flagVars {
+		values[f.name] = fs.String(f.name, "", f.usage+" ("+f.variable+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		err := fmt.Errorf("unexpected argument %q", fs.Arg(0))
+		fmt.Fprintln(output, err)
+		fs.Usage()
+		return err
+	}
+
+	set := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		for _, fv := range flagVars {
+			if fv.name == f.Name {
+				set[fv.variable] = *values[f.Name]
+			}
+		}
+	})
+	overrides = set
+	return nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseFlagsOverridesEnvironmentAndFile(t *testing.T) {
+	t.Cleanup(func() { overrides = nil })
+	dir := t.TempDir()
+	file := filepath.Join(dir, "gatify.env")
+	if err := os.WriteFile(file, []byte("LISTEN_ADDR=:5000\nBACKEND_URL=http://file:8080\nREDIS_ADDR=file:6379\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	token := filepath.Join(dir, "token")
+	if err := os.WriteFile(token, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BACKEND_URL", "http://env:8080")
+	t.Setenv("REDIS_ADDR", "env:6379")
+	t.Setenv("ADMIN_API_TOKEN", "from-env")
+
+	err := ParseFlags([]string{"-config", file, "-redis-addr", "flag:6379", "-admin-token-file", token}, io.Discard)
+	if err != nil {
+		t.Fatalf("ParseFlags() error = %v", err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.ConfigFile != file || cfg.ListenAddr != ":5000" {
+		t.Errorf("Expected settings from the file, got %q %q", cfg.ConfigFile, cfg.ListenAddr)
+	}
+	if cfg.BackendURL != "http://env:8080" {
+		t.Errorf("Expected the environment to override the file, got %s", cfg.BackendURL)
+	}
+	if cfg.RedisAddr != "flag:6379" {
+		t.Errorf("Expected the flag to override the environment, got %s", cfg.RedisAddr)
+	}
+	if cfg.AdminAPIToken != "s3cret" {
+		t.Errorf("Expected the token from the file, got %q", cfg.AdminAPIToken)
+	}
+}
+
+func TestParseFlagsErrors(t *testing.T) {
+	t.Cleanup(func() { overrides = nil })
+	var out strings.Builder
+	if err := ParseFlags([]string{"-h"}, &out); !errors.Is(err, flag.ErrHelp) || !strings.Contains(out.String(), "-backend-url") {
+		t.Errorf("Expected usage, got %v: %s", err, out.String())
+	}
+	if err := ParseFlags([]string{"-port", "3000"}, io.Discard); err == nil {
+		t.Error("Expected unknown flag to be rejected")
+	}
+	if err := ParseFlags([]string{"serve"}, io.Discard); err == nil {
+		t.Error("Expected positional argument to be rejected")
+	}
+
+	if err := ParseFlags([]string{"-admin-token-file", filepath.Join(t.TempDir(), "missing")}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(); err == nil || Problems(err)[0].Var != "ADMIN_API_TOKEN_FILE" {
+		t.Errorf("Expected unreadable token file to be reported, got %v", err)
+	}
+}
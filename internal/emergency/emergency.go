@@ -0,0 +1,191 @@
+// Package emergency provides a cluster-wide throttle switch for incidents
+package emergency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// stateKey is the shared key every gateway instance polls.
+const stateKey = "gatify:emergency"
+
+// DefaultRefreshInterval is how often instances re-read the shared state.
+const DefaultRefreshInterval = time.Second
+
+// State describes an active emergency throttle.
+type State struct {
+	// LimitFactor scales every limit, e.g. 0.1 keeps 10% of normal
+	// capacity. Zero leaves limits untouched.
+	LimitFactor float64 `json:"limit_factor,omitempty"`
+	// BlockPaths are rule-style path patterns rejected outright.
+	BlockPaths  []string  `json:"block_paths,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	ActivatedAt time.Time `json:"activated_at"`
+	ExpiresAt   time.Time `json:"expires_at,omitempty"`
+}
+
+// Validate checks that the state clamps or blocks something.
+func (s State) Validate() error {
+	if s.LimitFactor < 0 || s.LimitFactor > 1 {
+		return errors.New("limit_factor must be between 0 and 1")
+	}
+	if s.LimitFactor == 0 && len(s.BlockPaths) == 0 {
+		return errors.New("limit_factor or block_paths is required")
+	}
+	for _, p := range s.BlockPaths {
+		if err := rules.ValidatePattern(p); err != nil {
+			return fmt.Errorf("block path %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// active is a State compiled for fast per-request checks.
+type active struct {
+	state   State
+	blocked *rules.Matcher
+}
+
+// Switch reads and writes the emergency state shared through storage. Each
+// instance keeps a local copy refreshed by Run so the proxy never waits on
+// storage to check it.
+type Switch struct {
+	store    storage.Storage
+	interval time.Duration
+	current  atomic.Pointer[active]
+}
+
+// NewSwitch creates a Switch backed by store.
+func NewSwitch(store storage.Storage, interval time.Duration) *Switch {
+	if interval <= 0 {
+		interval = DefaultRefreshInterval
+	}
+	return &Switch{store: store, interval: interval}
+}
+
+// Activate stores the state for all instances. A positive ttl lifts the
+// throttle automatically once it elapses.
+func (s *Switch) Activate(ctx context.Context, state State, ttl time.Duration) (State, error) {
+	if err := state.Validate(); err != nil {
+		return State{}, err
+	}
+
+	state.ActivatedAt = time.Now().UTC()
+	state.ExpiresAt = time.Time{}
+	if ttl > 0 {
+		state.ExpiresAt = state.ActivatedAt.Add(ttl)
+	}
+
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return State{}, err
+	}
+	if err := s.store.Set(ctx, stateKey, string(raw), ttl); err != nil {
+		return State{}, fmt.Errorf("store emergency state: %w", err)
+	}
+
+	s.current.Store(compile(state))
+	return state, nil
+}
+
+// Deactivate lifts the throttle on all instances.
+func (s *Switch) Deactivate(ctx context.Context) error {
+	if err := s.store.Delete(ctx, stateKey); err != nil {
+		return fmt.Errorf("clear emergency state: %w", err)
+	}
+	s.current.Store(nil)
+	return nil
+}
+
+// Current returns this instance's view of the emergency state.
+func (s *Switch) Current() (State, bool) {
+	a := s.load()
+	if a == nil {
+		return State{}, false
+	}
+	return a.state, true
+}
+
+// ClampLimit applies the active limit factor, never going below one.
+func (s *Switch) ClampLimit(limit int64) int64 {
+	a := s.load()
+	if a == nil || a.state.LimitFactor == 0 {
+		return limit
+	}
+	return int64(math.Max(1, math.Floor(float64(limit)*a.state.LimitFactor)))
+}
+
+// Blocks reports whether the active state blocks the request outright.
+func (s *Switch) Blocks(method, path string) bool {
+	a := s.load()
+	if a == nil {
+		return false
+	}
+	_, ok := a.blocked.Match(method, path)
+	return ok
+}
+
+// Refresh reloads the shared state from storage.
+func (s *Switch) Refresh(ctx context.Context) error {
+	raw, err := s.store.Get(ctx, stateKey)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		s.current.Store(nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state State
+	if err := json.Unmarshal([]byte(raw), &state); err != nil {
+		return fmt.Errorf("decode emergency state: %w", err)
+	}
+	s.current.Store(compile(state))
+	return nil
+}
+
+// Run refreshes the state every interval until ctx is cancelled. On
+// storage errors the last known state is kept.
+func (s *Switch) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to refresh emergency state: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Switch) load() *active {
+	if s == nil {
+		return nil
+	}
+	a := s.current.Load()
+	if a == nil || (!a.state.ExpiresAt.IsZero() && time.Now().After(a.state.ExpiresAt)) {
+		return nil
+	}
+	return a
+}
+
+func compile(state State) *active {
+	blocks := make([]rules.Rule, 0, len(state.BlockPaths))
+	for _, p := range state.BlockPaths {
+		blocks = append(blocks, rules.Rule{ID: p, Pattern: p, Enabled: true})
+	}
+	return &active{state: state, blocked: rules.NewMatcher(blocks)}
+}
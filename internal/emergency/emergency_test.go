@@ -0,0 +1,145 @@
+package emergency
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// mapStorage is a minimal key/value store standing in for Redis.
+type mapStorage struct {
+	storage.Storage
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func newMapStorage() *mapStorage {
+	return &mapStorage{data: make(map[string]string)}
+}
+
+func (m *mapStorage) Get(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.data[key]
+	if !ok {
+		return "", storage.ErrKeyNotFound
+	}
+	return v, nil
+}
+
+func (m *mapStorage) Set(_ context.Context, key, value string, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = value
+	return nil
+}
+
+func (m *mapStorage) Delete(_ context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range keys {
+		delete(m.data, k)
+	}
+	return nil
+}
+
+func TestSwitchSharedAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	store := newMapStorage()
+	a := NewSwitch(store, time.Second)
+	b := NewSwitch(store, time.Second)
+
+	if _, err := a.Activate(ctx, State{LimitFactor: 0.1, Reason: "incident"}, 0); err != nil {
+		t.Fatalf("Activate() error = %v", err)
+	}
+	if got := a.ClampLimit(100); got != 10 {
+		t.Errorf("Expected activating instance to clamp immediately, got %d", got)
+	}
+
+	if got := b.ClampLimit(100); got != 100 {
+		t.Errorf("Expected other instance unchanged before refresh, got %d", got)
+	}
+	if err := b.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	state, ok := b.Current()
+	if !ok || state.Reason != "incident" || b.ClampLimit(100) != 10 {
+		t.Errorf("Expected other instance to pick up state, got %+v", state)
+	}
+
+	if err := a.Deactivate(ctx); err != nil {
+		t.Fatalf("Deactivate() error = %v", err)
+	}
+	if err := b.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if _, ok := b.Current(); ok {
+		t.Error("Expected throttle lifted on all instances")
+	}
+}
+
+func TestSwitchClampNeverBelowOne(t *testing.T) {
+	s := NewSwitch(newMapStorage(), 0)
+	if _, err := s.Activate(context.Background(), State{LimitFactor: 0.01}, 0); err != nil {
+		t.Fatalf("Activate() error = %v", err)
+	}
+	if got := s.ClampLimit(5); got != 1 {
+		t.Errorf("Expected clamp floor of 1, got %d", got)
+	}
+}
+
+func TestSwitchBlocks(t *testing.T) {
+	s := NewSwitch(newMapStorage(), 0)
+	if s.Blocks("GET", "/api/export") {
+		t.Error("Expected nothing blocked while inactive")
+	}
+
+	if _, err := s.Activate(context.Background(), State{BlockPaths: []string{"/api/export/*"}}, 0); err != nil {
+		t.Fatalf("Activate() error = %v", err)
+	}
+	if !s.Blocks("POST", "/api/export/csv") {
+		t.Error("Expected blocked path to be rejected")
+	}
+	if s.Blocks("GET", "/api/users") {
+		t.Error("Expected other paths to pass")
+	}
+	if s.ClampLimit(50) != 50 {
+		t.Error("Expected block-only state to leave limits untouched")
+	}
+}
+
+func TestSwitchExpires(t *testing.T) {
+	s := NewSwitch(newMapStorage(), 0)
+	if _, err := s.Activate(context.Background(), State{LimitFactor: 0.5}, time.Millisecond); err != nil {
+		t.Fatalf("Activate() error = %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := s.Current(); ok {
+		t.Error("Expected state to expire after its ttl")
+	}
+}
+
+func TestNilSwitch(t *testing.T) {
+	var s *Switch
+	if s.Blocks("GET", "/") || s.ClampLimit(7) != 7 {
+		t.Error("Expected nil switch to be inert")
+	}
+}
+
+func TestStateValidate(t *testing.T) {
+	invalid := []State{
+		{},
+		{LimitFactor: 1.5},
+		{LimitFactor: -0.1},
+		{BlockPaths: []string{"no-slash"}},
+	}
+	for _, s := range invalid {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Expected error for %+v", s)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+// Package geoip looks up the country of client IPs in a MaxMind DB file,
+// such as GeoLite2-Country.mmdb or GeoIP2-City.mmdb, for rules that
+// identify or filter clients by country. It reads the MaxMind DB format
+// directly and only decodes what country lookups need.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+)
+
+// metadataMarker precedes the metadata map at the end of the file.
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSeparator is the size of the zeroes between the search tree and
+// the data section.
+const dataSeparator = 16
+
+var errInvalid = errors.New("invalid MaxMind DB")
+
+// DB is an opened MaxMind DB. It is immutable and safe for concurrent
+// use.
+type DB struct {
+	buf        []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// ipv4Start is the node IPv4 lookups start from in an IPv6 tree.
+	ipv4Start uint
+	// Type is the database_type from the metadata, e.g. GeoLite2-Country.
+	Type string
+
+	// countries caches decoded country codes by data offset; country
+	// databases have only a few hundred distinct records.
+	countries sync.Map
+}
+
+// Open reads the MaxMind DB at path.
+func Open(path string) (*DB, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := Parse(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+// Parse opens a MaxMind DB held in memory.
+func Parse(buf []byte) (*DB, error) {
+	at := bytes.LastIndex(buf, metadataMarker)
+	if at < 0 {
+		return nil, fmt.Errorf("%w: metadata not found", errInvalid)
+	}
+	meta := buf[at+len(metadataMarker):]
+	v, _, err := decode(meta, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", errInvalid, err)
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", errInvalid)
+	}
+
+	db := &DB{buf: buf}
+	db.nodeCount = metaUint(m, "node_count")
+	db.recordSize = metaUint(m, "record_size")
+	db.ipVersion = metaUint(m, "ip_version")
+	db.Type, _ = m["database_type"].(string)
+	switch {
+	case db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32:
+		return nil, fmt.Errorf("%w: unsupported record size %d", errInvalid, db.recordSize)
+	case db.ipVersion != 4 && db.ipVersion != 6:
+		return nil, fmt.Errorf("%w: unsupported IP version %d", errInvalid, db.ipVersion)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+dataSeparator > uint(at) {
+		return nil, fmt.Errorf("%w: search tree larger than file", errInvalid)
+	}
+	db.data = buf[treeSize+dataSeparator : at]
+
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country ip is in,
+// falling back to the country the network is registered in. ok is false
+// when the database has no country for ip.
+func (db *DB) Country(ip netip.Addr) (code string, ok bool) {
+	if db == nil || !ip.IsValid() {
+		return "", false
+	}
+	offset, found := db.lookup(ip.Unmap())
+	if !found {
+		return "", false
+	}
+	if cached, ok := db.countries.Load(offset); ok {
+		code = cached.(string)
+		return code, code != ""
+	}
+
+	v, _, err := decode(db.data, offset, 0)
+	if err == nil {
+		code = countryCode(v)
+	}
+	db.countries.Store(offset, code)
+	return code, code != ""
+}
+
+func countryCode(v any) string {
+	m, _ := v.(map[string]any)
+	for _, key := range []string{"country", "registered_country"} {
+		c, _ := m[key].(map[string]any)
+		if code, _ := c["iso_code"].(string); code != "" {
+			return strings.ToUpper(code)
+		}
+	}
+	return ""
+}
+
+// lookup walks the search tree and returns the data offset of ip's
+// record.
+func (db *DB) lookup(ip netip.Addr) (uint, bool) {
+	node, bits := uint(0), ip.AsSlice()
+	if ip.Is4() {
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	} else if db.ipVersion == 4 {
+		return 0, false
+	}
+
+	for i := 0; i < len(bits)*8 && node < db.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-i%8)) & 1
+		node = db.record(node, bit)
+	}
+	if node <= db.nodeCount {
+		return 0, false
+	}
+	offset := node - db.nodeCount - dataSeparator
+	if offset >= uint(len(db.data)) {
+		return 0, false
+	}
+	return offset, true
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node.
+func (db *DB) record(node, bit uint) uint {
+	size := db.recordSize / 4
+	b := db.buf[node*size : node*size+size]
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+func metaUint(m map[string]any, key string) uint {
+	n, _ := m[key].(uint64)
+	return uint(n)
+}
+
+// Data section types.
+const (
+	typePointer = 1
+	typeString  = 2
+	typeDouble  = 3
+	typeBytes   = 4
+	typeUint16  = 5
+	typeUint32  = 6
+	typeMap     = 7
+	typeInt32   = 8
+	typeUint64  = 9
+	typeUint128 = 10
+	typeArray   = 11
+	typeBool    = 14
+	typeFloat   = 15
+)
+
+// maxDepth bounds nesting, so a corrupt file cannot recurse forever.
+const maxDepth = 32
+
+// decode decodes the value at offset in the data section, returning it
+// and the offset after it. Maps decode to map[string]any, arrays to
+// []any, unsigned integers to uint64 and signed ones to int64; uint128
+// values are skipped as nil.
+func decode(data []byte, offset uint, depth int) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+	typ, size, offset, err := decodeControl(data, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		target, next, err := decodePointer(data, offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := decode(data, target, depth+1)
+		return v, next, err
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := decode(data, offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			v, next, err := decode(data, next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key], offset = v, next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			v, next, err := decode(data, offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a, offset = append(a, v), next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(data)) {
+		return nil, 0, errors.New("value runs past the data section")
+	}
+	b, next := data[offset:offset+size], offset+size
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("double must be 8 bytes")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("float must be 4 bytes")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, errors.New("integer too large")
+		}
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errors.New("int32 too large")
+		}
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n << (8 * (4 - size)) >> (8 * (4 - size)))), next, nil
+	case typeUint128:
+		return nil, next, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", typ)
+	}
+}
+
+// decodeControl reads a field's control byte and any extended type and
+// size bytes. For pointers, size holds the control byte's low five bits.
+func decodeControl(data []byte, offset uint) (typ, size, next uint, err error) {
+	if offset >= uint(len(data)) {
+		return 0, 0, 0, errors.New("offset past the data section")
+	}
+	ctrl := data[offset]
+	offset++
+	typ = uint(ctrl >> 5)
+	if typ == 0 {
+		if offset >= uint(len(data)) {
+			return 0, 0, 0, errors.New("truncated extended type")
+		}
+		typ = 7 + uint(data[offset])
+		offset++
+	}
+	size = uint(ctrl & 0x1F)
+	if typ == typePointer {
+		return typ, size, offset, nil
+	}
+
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(data)) {
+			return 0, 0, 0, errors.New("truncated size")
+		}
+		var extra uint
+		for _, c := range data[offset : offset+n] {
+			extra = extra<<8 | uint(c)
+		}
+		offset += n
+		switch size {
+		case 29:
+			size = 29 + extra
+		case 30:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+	return typ, size, offset, nil
+}
+
+// decodePointer resolves a pointer whose control bits are ctrl.
+func decodePointer(data []byte, offset, ctrl uint) (target, next uint, err error) {
+	n := (ctrl>>3)&3 + 1
+	if offset+n > uint(len(data)) {
+		return 0, 0, errors.New("truncated pointer")
+	}
+	var p uint
+	if n < 4 {
+		p = ctrl & 7
+	}
+	for _, c := range data[offset : offset+n] {
+		p = p<<8 | uint(c)
+	}
+	switch n {
+	case 2:
+		p += 2048
+	case 3:
+		p += 526336
+	}
+	return p, offset + n, nil
+}
@@ -0,0 +1,252 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testNetwork maps a network to the raw data record stored for it.
+type testNetwork struct {
+	prefix string
+	record []byte
+}
+
+// encodeControl writes a control byte for a field of typ and size < 29.
+func encodeControl(typ, size int) []byte {
+	if typ > 7 {
+		return []byte{byte(size), byte(typ - 7)}
+	}
+	return []byte{byte(typ<<5 | size)}
+}
+
+func encodeString(s string) []byte {
+	return append(encodeControl(typeString, len(s)), s...)
+}
+
+func encodeUint(typ int, n uint64) []byte {
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append(encodeControl(typ, len(b)), b...)
+}
+
+// encodeMap encodes alternating keys and already encoded values.
+func encodeMap(pairs ...any) []byte {
+	out := encodeControl(typeMap, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		out = append(out, encodeString(pairs[i].(string))...)
+		out = append(out, pairs[i+1].([]byte)...)
+	}
+	return out
+}
+
+func countryRecord(key, code string) []byte {
+	return encodeMap(key, encodeMap("iso_code", encodeString(code), "names", encodeMap("en", encodeString("Somewhere"))))
+}
+
+type trieNode struct {
+	kids [2]*trieNode
+	// leaf is the data offset plus one for terminal entries.
+	leaf int
+}
+
+// buildDB writes a MaxMind DB holding networks, the way a real writer
+// lays one out.
+func buildDB(t *testing.T, ipVersion, recordSize int, networks []testNetwork) []byte {
+	t.Helper()
+	var data []byte
+	root := &trieNode{}
+	for _, n := range networks {
+		p := netip.MustParsePrefix(n.prefix)
+		addr, bits := p.Addr().AsSlice(), p.Bits()
+		if p.Addr().Is4() && ipVersion == 6 {
+			addr, bits = append(make([]byte, 12), addr...), bits+96
+		}
+		node := root
+		for i := 0; i < bits; i++ {
+			bit := addr[i/8] >> (7 - i%8) & 1
+			if node.kids[bit] == nil {
+				node.kids[bit] = &trieNode{}
+			}
+			node = node.kids[bit]
+		}
+		node.leaf = len(data) + 1
+		data = append(data, n.record...)
+	}
+
+	// Number the inner nodes breadth first.
+	var nodes []*trieNode
+	index := map[*trieNode]int{}
+	queue := []*trieNode{root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		index[n] = len(nodes)
+		nodes = append(nodes, n)
+		for _, k := range n.kids {
+			if k != nil && k.leaf == 0 {
+				queue = append(queue, k)
+			}
+		}
+	}
+	count := len(nodes)
+	value := func(k *trieNode) uint32 {
+		switch {
+		case k == nil:
+			return uint32(count)
+		case k.leaf > 0:
+			return uint32(count + dataSeparator + k.leaf - 1)
+		default:
+			return uint32(index[k])
+		}
+	}
+
+	var tree []byte
+	for _, n := range nodes {
+		l, r := value(n.kids[0]), value(n.kids[1])
+		switch recordSize {
+		case 24:
+			tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(r>>16), byte(r>>8), byte(r))
+		case 28:
+			tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(l>>20&0xF0|r>>24&0x0F), byte(r>>16), byte(r>>8), byte(r))
+		default:
+			tree = binary.BigEndian.AppendUint32(tree, l)
+			tree = binary.BigEndian.AppendUint32(tree, r)
+		}
+	}
+
+	out := append(tree, make([]byte, dataSeparator)...)
+	out = append(out, data...)
+	out = append(out, metadataMarker...)
+	out = append(out, encodeMap(
+		"node_count", encodeUint(typeUint32, uint64(count)),
+		"record_size", encodeUint(typeUint16, uint64(recordSize)),
+		"ip_version", encodeUint(typeUint16, uint64(ipVersion)),
+		"database_type", encodeString("Test-Country"),
+	)...)
+	return out
+}
+
+var testNetworks = []testNetwork{
+	{"81.2.69.0/24", countryRecord("country", "gb")},
+	{"2.125.160.0/20", countryRecord("country", "DE")},
+	{"2001:db8::/32", countryRecord("registered_country", "FR")},
+	{"192.0.2.0/24", encodeMap("continent", encodeMap("code", encodeString("EU")))},
+}
+
+func TestCountry(t *testing.T) {
+	for _, size := range []int{24, 28, 32} {
+		db, err := Parse(buildDB(t, 6, size, testNetworks))
+		if err != nil {
+			t.Fatalf("record size %d: Parse: %v", size, err)
+		}
+		if db.Type != "Test-Country" {
+			t.Errorf("record size %d: type = %q", size, db.Type)
+		}
+		for ip, want := range map[string]string{
+			"81.2.69.160":         "GB",
+			"::ffff:81.2.69.1":    "GB",
+			"2.125.175.255":       "DE",
+			"2001:db8::1":         "FR",
+			"192.0.2.1":           "",
+			"10.0.0.1":            "",
+			"2001:db9::1":         "",
+			"2.125.176.0":         "",
+			"2001:db8:ffff::ffff": "FR",
+		} {
+			// The second lookup is answered from the cache.
+			for pass := 0; pass < 2; pass++ {
+				got, ok := db.Country(netip.MustParseAddr(ip))
+				if got != want || ok != (want != "") {
+					t.Errorf("record size %d: Country(%s) = %q, %v; want %q", size, ip, got, ok, want)
+				}
+			}
+		}
+	}
+}
+
+func TestCountryIPv4Database(t *testing.T) {
+	db, err := Parse(buildDB(t, 4, 24, testNetworks[:2]))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got, _ := db.Country(netip.MustParseAddr("2.125.160.1")); got != "DE" {
+		t.Errorf("expected DE, got %q", got)
+	}
+	if _, ok := db.Country(netip.MustParseAddr("2001:db8::1")); ok {
+		t.Error("expected IPv6 lookups to miss in an IPv4 database")
+	}
+	var nilDB *DB
+	if _, ok := nilDB.Country(netip.MustParseAddr("2.125.160.1")); ok {
+		t.Error("expected a nil database to find nothing")
+	}
+}
+
+func TestParseRejectsInvalid(t *testing.T) {
+	valid := buildDB(t, 6, 24, testNetworks)
+	for name, buf := range map[string][]byte{
+		"empty":        nil,
+		"no metadata":  valid[:len(valid)/2],
+		"bad metadata": append(append([]byte{}, metadataMarker...), 0xFF),
+		"record size": append(append([]byte{}, metadataMarker...), encodeMap(
+			"node_count", encodeUint(typeUint32, 1), "record_size", encodeUint(typeUint16, 20), "ip_version", encodeUint(typeUint16, 6))...),
+		"tree too large": append(append([]byte{}, metadataMarker...), encodeMap(
+			"node_count", encodeUint(typeUint32, 1000), "record_size", encodeUint(typeUint16, 24), "ip_version", encodeUint(typeUint16, 6))...),
+	} {
+		if _, err := Parse(buf); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestDecodePointer(t *testing.T) {
+	// A map whose value points back at the string at offset 0.
+	data := encodeString("DE")
+	start := uint(len(data))
+	data = append(data, encodeControl(typeMap, 1)...)
+	data = append(data, encodeString("iso_code")...)
+	data = append(data, typePointer<<5, 0x00)
+
+	v, _, err := decode(data, start, 0)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if m, _ := v.(map[string]any); m["iso_code"] != "DE" {
+		t.Fatalf("expected the pointer to resolve to DE, got %v", v)
+	}
+
+	// A pointer to itself must not recurse forever.
+	if _, _, err := decode([]byte{typePointer << 5, 0x00}, 0, 0); err == nil {
+		t.Fatal("expected an error for a pointer loop")
+	}
+}
+
+func TestWatcherLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	if err := os.WriteFile(path, buildDB(t, 6, 24, testNetworks), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var loaded *DB
+	w := NewWatcher(path, 0, func(db *DB) { loaded = db })
+	if err := w.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got, _ := loaded.Country(netip.MustParseAddr("81.2.69.1")); got != "GB" {
+		t.Fatalf("expected GB from the loaded database, got %q", got)
+	}
+
+	if err := os.WriteFile(path, []byte("not a database"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	previous := loaded
+	if err := w.Load(); err == nil {
+		t.Fatal("expected an invalid database to fail")
+	}
+	if loaded != previous {
+		t.Fatal("expected the previous database to stay in use")
+	}
+}
@@ -0,0 +1,72 @@
+package geoip
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// Watcher reloads a MaxMind DB file whenever it changes, such as after a
+// geoipupdate run. Changes are detected by polling the file's
+// modification time and size.
+type Watcher struct {
+	path     string
+	interval time.Duration
+	onLoad   func(*DB)
+
+	modTime time.Time
+	size    int64
+}
+
+// NewWatcher creates a watcher that passes the database at path to
+// onLoad, checking for changes every interval.
+func NewWatcher(path string, interval time.Duration, onLoad func(*DB)) *Watcher {
+	return &Watcher{path: path, interval: interval, onLoad: onLoad}
+}
+
+// Load opens the database and hands it to onLoad. A database that fails
+// to open is reported without calling onLoad, so the previous one stays
+// in use.
+func (w *Watcher) Load() error {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return err
+	}
+	w.modTime, w.size = info.ModTime(), info.Size()
+
+	db, err := Open(w.path)
+	if err != nil {
+		return err
+	}
+	w.onLoad(db)
+	return nil
+}
+
+// Run polls the file until ctx is cancelled, reloading it after each
+// change.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(w.path)
+		if err != nil {
+			log.Printf("Failed to check GeoIP database %s: %v", w.path, err)
+			continue
+		}
+		if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+			continue
+		}
+		if err := w.Load(); err != nil {
+			log.Printf("⚠️  Keeping previous GeoIP database, %s is invalid: %v", w.path, err)
+			continue
+		}
+		log.Printf("🔄 Reloaded GeoIP database from %s", w.path)
+	}
+}
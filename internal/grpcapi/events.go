@@ -0,0 +1,140 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/stream"
+)
+
+const (
+	// eventBuffer is how many events a slow consumer may lag by before
+	// events are dropped, as for WebSocket subscribers.
+	eventBuffer = 1024
+	// eventWriteTimeout ends streams whose consumer stops reading.
+	eventWriteTimeout = 10 * time.Second
+)
+
+// streamMethod is a server-streaming call. It sends response messages
+// with send until it returns.
+type streamMethod func(ctx context.Context, req []byte, send func(msg []byte) error) error
+
+// serveStream authenticates and runs a server-streaming call. Each
+// message is flushed as it is sent, so HTTP/2 flow control holds back a
+// consumer that reads slowly instead of the server buffering for it.
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request, web bool, call streamMethod) {
+	_, status := s.authenticate(r)
+	var req []byte
+	if status == nil {
+		req, status = readMessage(r.Body)
+	}
+	rc := http.NewResponseController(w)
+	// The server's write timeout would otherwise end the stream; each
+	// message sets its own deadline instead.
+	if err := rc.SetWriteDeadline(time.Time{}); status == nil && err != nil && !errors.Is(err, http.ErrNotSupported) {
+		status = statusf(codeInternal, "streaming not supported")
+	}
+	if status != nil {
+		writeResponse(w, web, nil, status)
+		return
+	}
+
+	startResponse(w, web)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	send := func(msg []byte) error {
+		_ = rc.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		if _, err := w.Write(frame(0, msg)); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	err := call(context.WithValue(r.Context(), remoteAddrKey{}, r.RemoteAddr), req, send)
+	if r.Context().Err() != nil {
+		return
+	}
+	_ = rc.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+	finishResponse(w, web, toStatus(err))
+}
+
+// remoteAddrKey carries the caller's address to stream methods.
+type remoteAddrKey struct{}
+
+func remoteFrom(ctx context.Context) string {
+	addr, _ := ctx.Value(remoteAddrKey{}).(string)
+	return addr
+}
+
+// eventFilter is the StreamEventsRequest message.
+type eventFilter struct {
+	ruleID      string
+	blockedOnly bool
+}
+
+func unmarshalEventFilter(buf []byte) (eventFilter, error) {
+	var f eventFilter
+	err := decode(buf, func(v fieldValue) error {
+		switch v.num {
+		case 1:
+			if err := v.want(wireBytes); err != nil {
+				return err
+			}
+			f.ruleID = v.string()
+		case 2:
+			if err := v.want(wireVarint); err != nil {
+				return err
+			}
+			f.blockedOnly = v.bool()
+		}
+		return nil
+	})
+	return f, err
+}
+
+// match reports whether e passes the filter. Rule changes are never
+// blocked requests, so blockedOnly leaves them out.
+func (f eventFilter) match(e stream.Event) bool {
+	if f.ruleID != "" && e.RuleID != f.ruleID {
+		return false
+	}
+	return !f.blockedOnly || (e.Type == "" && !e.Allowed)
+}
+
+// streamEvents sends live events matching the request until the caller
+// hangs up or the gateway shuts down. Meta-events reporting dropped
+// events are sent whatever the filter.
+func (s *Server) streamEvents(ctx context.Context, req []byte, send func([]byte) error) error {
+	filter, err := unmarshalEventFilter(req)
+	if err != nil {
+		return err
+	}
+	sub := s.broker.SubscribeAs(eventBuffer, stream.SubscriberInfo{Transport: "grpc", Remote: remoteFrom(ctx)})
+	defer sub.Close()
+	meta := time.NewTicker(stream.MetaInterval)
+	defer meta.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-meta.C:
+			if e, ok := sub.Meta(); ok {
+				if err := send(e.MarshalProto()); err != nil {
+					return nil
+				}
+			}
+		case e, ok := <-sub.Events():
+			if !ok {
+				return statusf(codeUnavailable, "server shutting down")
+			}
+			if !filter.match(e) {
+				continue
+			}
+			if err := send(e.MarshalProto()); err != nil {
+				return nil
+			}
+		}
+	}
+}
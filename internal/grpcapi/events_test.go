@@ -0,0 +1,84 @@
+package grpcapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/stream"
+	"github.com/Siruyy/gatify/internal/users"
+)
+
+// readFrame reads one gRPC-Web frame.
+func readFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		t.Fatalf("reading frame: %v", err)
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("reading frame payload: %v", err)
+	}
+	return prefix[0], payload
+}
+
+func TestStreamEvents(t *testing.T) {
+	broker := stream.NewBroker()
+	auth := users.NewAuthenticator(users.NewInMemoryStore(), testToken)
+	srv := httptest.NewServer(NewServer(rules.NewInMemoryRepository(), auth, WithEvents(broker)))
+	defer srv.Close()
+
+	var e encoder
+	e.string(1, "r1")
+	e.bool(2, true)
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/gatify.management.v1.Events/StreamEvents", bytes.NewReader(frame(0, e)))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for broker.Subscribers() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	broker.Publish(stream.Event{RuleID: "r1", Path: "/allowed", Allowed: true})
+	broker.Publish(stream.Event{RuleID: "r2", Path: "/other-rule"})
+	broker.Publish(stream.Event{RuleID: "r1", Type: stream.TypeRuleChange})
+	broker.Publish(stream.Event{RuleID: "r1", Path: "/blocked", Status: http.StatusTooManyRequests})
+	broker.Close()
+
+	body := bufio.NewReader(resp.Body)
+	flags, msg := readFrame(t, body)
+	want := stream.Event{RuleID: "r1", Path: "/blocked", Status: http.StatusTooManyRequests}.MarshalProto()
+	if flags != 0 || !bytes.Equal(msg, want) {
+		t.Errorf("Expected only the blocked r1 event, got flags %x %q", flags, msg)
+	}
+	flags, msg = readFrame(t, body)
+	if flags&0x80 == 0 || !strings.Contains(string(msg), "grpc-status: 14") {
+		t.Errorf("Expected UNAVAILABLE trailer on shutdown, got %q", msg)
+	}
+}
+
+func TestStreamEventsRequiresToken(t *testing.T) {
+	auth := users.NewAuthenticator(users.NewInMemoryStore(), testToken)
+	s := NewServer(rules.NewInMemoryRepository(), auth, WithEvents(stream.NewBroker()))
+	if _, code, _ := callWeb(t, s, "Events/StreamEvents", "wrong", nil); code != codeUnauthenticated {
+		t.Errorf("Expected UNAUTHENTICATED, got %d", code)
+	}
+
+	s, _, _ = newTestServer(t)
+	if _, code, _ := callWeb(t, s, "Events/StreamEvents", testToken, nil); code != codeUnimplemented {
+		t.Errorf("Expected UNIMPLEMENTED without a broker, got %d", code)
+	}
+}
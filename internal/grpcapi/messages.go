@@ -0,0 +1,324 @@
+package grpcapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// ruleOptions are the nested rule options carried as JSON in the Rule
+// message's options_json field.
+type ruleOptions struct {
+	CacheHeaders map[string]string       `json:"cache_headers,omitempty"`
+	Headers      *rules.HeaderRewrite    `json:"headers,omitempty"`
+	Progressive  *rules.Progressive      `json:"progressive,omitempty"`
+	Rejection    *rules.Rejection        `json:"rejection,omitempty"`
+	Replay       *rules.ReplayProtection `json:"replay,omitempty"`
+	Hedge        *rules.Hedge            `json:"hedge,omitempty"`
+	WebSocket    *rules.WebSocketLimit   `json:"websocket,omitempty"`
+	Honeypot     *rules.Honeypot         `json:"honeypot,omitempty"`
+	Action       *rules.RuleAction       `json:"action,omitempty"`
+	Schedule     *rules.Schedule         `json:"schedule,omitempty"`
+}
+
+// ruleStringFields are the Rule fields with wire type bytes; the others
+// are varints.
+var ruleStringFields = map[int]bool{1: true, 2: true, 3: true, 4: true, 8: true, 9: true, 10: true, 11: true, 14: true, 15: true, 17: true, 18: true, 25: true, 26: true, 27: true, 28: true, 29: true, 31: true, 32: true, 34: true, 37: true, 38: true}
+
+// maxRuleField is the highest Rule field number in management.proto.
+const maxRuleField = 38
+
+func marshalRule(r rules.Rule) []byte {
+	var e encoder
+	e.string(1, r.ID)
+	e.string(2, r.Name)
+	e.string(3, r.Pattern)
+	e.strings(4, r.Methods)
+	e.int64(5, int64(r.Priority))
+	e.int64(6, r.Limit)
+	e.int64(7, r.WindowSeconds)
+	e.string(8, r.IdentifyBy)
+	e.string(9, r.HeaderName)
+	e.strings(10, r.HeaderNames)
+	e.strings(11, r.KeyTransforms)
+	e.int64(12, r.MaxConcurrency)
+	e.int64(13, r.Quota)
+	e.string(14, r.QuotaPeriod)
+	e.string(15, r.Policy)
+	e.int64(16, r.MaxResponseBytes)
+	e.string(17, r.Upstream)
+	e.string(18, r.Algorithm)
+	e.bool(19, r.Debug)
+	e.bool(20, r.Public)
+	e.bool(21, r.Enabled)
+	e.int64(22, r.Revision)
+	e.int64(23, unixNano(r.CreatedAt))
+	e.int64(24, unixNano(r.UpdatedAt))
+	opts := ruleOptions{
+		CacheHeaders: r.CacheHeaders,
+		Headers:      r.Headers,
+		Progressive:  r.Progressive,
+		Rejection:    r.Rejection,
+		Replay:       r.Replay,
+		Hedge:        r.Hedge,
+		WebSocket:    r.WebSocket,
+		Honeypot:     r.Honeypot,
+		Action:       r.Action,
+		Schedule:     r.Schedule,
+	}
+	if data, err := json.Marshal(opts); err == nil && string(data) != "{}" {
+		e.string(25, string(data))
+	}
+	e.strings(26, r.AllowCountries)
+	e.strings(27, r.DenyCountries)
+	e.strings(28, r.Agents)
+	e.strings(29, r.ExemptAgents)
+	e.int64(30, int64(r.ShedPriority))
+	e.strings(31, r.CaptureHeaders)
+	e.string(32, r.CookieName)
+	e.int64(33, r.Burst)
+	e.string(34, r.Namespace)
+	e.bool(35, r.Shadow)
+	e.int64(36, r.RejectionMaxAge)
+	e.string(37, r.JWTClaim)
+	e.strings(38, r.Tags)
+	return e
+}
+
+func unmarshalRule(buf []byte) (rules.Rule, error) {
+	var r rules.Rule
+	var options string
+	err := decode(buf, func(f fieldValue) error {
+		if f.num > maxRuleField {
+			return nil
+		}
+		want := wireVarint
+		if ruleStringFields[f.num] {
+			want = wireBytes
+		}
+		if err := f.want(want); err != nil {
+			return err
+		}
+		switch f.num {
+		case 1:
+			r.ID = f.string()
+		case 2:
+			r.Name = f.string()
+		case 3:
+			r.Pattern = f.string()
+		case 4:
+			r.Methods = append(r.Methods, f.string())
+		case 5:
+			r.Priority = int(f.int64())
+		case 6:
+			r.Limit = f.int64()
+		case 7:
+			r.WindowSeconds = f.int64()
+		case 8:
+			r.IdentifyBy = f.string()
+		case 9:
+			r.HeaderName = f.string()
+		case 10:
+			r.HeaderNames = append(r.HeaderNames, f.string())
+		case 11:
+			r.KeyTransforms = append(r.KeyTransforms, f.string())
+		case 12:
+			r.MaxConcurrency = f.int64()
+		case 13:
+			r.Quota = f.int64()
+		case 14:
+			r.QuotaPeriod = f.string()
+		case 15:
+			r.Policy = f.string()
+		case 16:
+			r.MaxResponseBytes = f.int64()
+		case 17:
+			r.Upstream = f.string()
+		case 18:
+			r.Algorithm = f.string()
+		case 19:
+			r.Debug = f.bool()
+		case 20:
+			r.Public = f.bool()
+		case 21:
+			r.Enabled = f.bool()
+		case 22:
+			r.Revision = f.int64()
+		case 23:
+			r.CreatedAt = fromUnixNano(f.int64())
+		case 24:
+			r.UpdatedAt = fromUnixNano(f.int64())
+		case 25:
+			options = f.string()
+		case 26:
+			r.AllowCountries = append(r.AllowCountries, f.string())
+		case 27:
+			r.DenyCountries = append(r.DenyCountries, f.string())
+		case 28:
+			r.Agents = append(r.Agents, f.string())
+		case 29:
+			r.ExemptAgents = append(r.ExemptAgents, f.string())
+		case 30:
+			r.ShedPriority = int(f.int64())
+		case 31:
+			r.CaptureHeaders = append(r.CaptureHeaders, f.string())
+		case 32:
+			r.CookieName = f.string()
+		case 33:
+			r.Burst = f.int64()
+		case 34:
+			r.Namespace = f.string()
+		case 35:
+			r.Shadow = f.bool()
+		case 36:
+			r.RejectionMaxAge = f.int64()
+		case 37:
+			r.JWTClaim = f.string()
+		case 38:
+			r.Tags = append(r.Tags, f.string())
+		}
+		return nil
+	})
+	if err != nil || options == "" {
+		return r, err
+	}
+
+	var opts ruleOptions
+	dec := json.NewDecoder(bytes.NewReader([]byte(options)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&opts); err != nil {
+		return r, fmt.Errorf("%w: invalid options_json: %v", errMalformed, err)
+	}
+	r.CacheHeaders = opts.CacheHeaders
+	r.Headers = opts.Headers
+	r.Progressive = opts.Progressive
+	r.Rejection = opts.Rejection
+	r.Replay = opts.Replay
+	r.Hedge = opts.Hedge
+	r.WebSocket = opts.WebSocket
+	r.Honeypot = opts.Honeypot
+	r.Schedule = opts.Schedule
+	r.Action = opts.Action
+	return r, nil
+}
+
+func marshalRuleList(list []rules.Rule) []byte {
+	var e encoder
+	for _, r := range list {
+		e.bytes(1, marshalRule(r))
+	}
+	return e
+}
+
+// unmarshalID decodes the GetRuleRequest and DeleteRuleRequest messages,
+// whose only field is the rule ID.
+func unmarshalID(buf []byte) (string, error) {
+	var id string
+	err := decode(buf, func(f fieldValue) error {
+		if f.num != 1 {
+			return nil
+		}
+		if err := f.want(wireBytes); err != nil {
+			return err
+		}
+		id = f.string()
+		return nil
+	})
+	return id, err
+}
+
+// updateRequest is the UpdateRuleRequest message.
+type updateRequest struct {
+	rule             rules.Rule
+	expectedRevision int64
+}
+
+func unmarshalUpdate(buf []byte) (updateRequest, error) {
+	var req updateRequest
+	err := decode(buf, func(f fieldValue) error {
+		switch f.num {
+		case 1:
+			if err := f.want(wireBytes); err != nil {
+				return err
+			}
+			rule, err := unmarshalRule(f.b)
+			if err != nil {
+				return err
+			}
+			req.rule = rule
+		case 2:
+			if err := f.want(wireVarint); err != nil {
+				return err
+			}
+			req.expectedRevision = f.int64()
+		}
+		return nil
+	})
+	return req, err
+}
+
+// statsRequest is the StatsRequest message.
+type statsRequest struct {
+	window time.Duration
+	ruleID string
+}
+
+func unmarshalStatsRequest(buf []byte) (statsRequest, error) {
+	var req statsRequest
+	err := decode(buf, func(f fieldValue) error {
+		switch f.num {
+		case 1:
+			if err := f.want(wireVarint); err != nil {
+				return err
+			}
+			req.window = time.Duration(f.int64()) * time.Second
+		case 2:
+			if err := f.want(wireBytes); err != nil {
+				return err
+			}
+			req.ruleID = f.string()
+		}
+		return nil
+	})
+	return req, err
+}
+
+func marshalOverview(o analytics.Overview) []byte {
+	var e encoder
+	e.int64(1, unixNano(o.Since))
+	e.int64(2, o.TotalRequests)
+	e.int64(3, o.BlockedRequests)
+	e.int64(4, o.UniqueClients)
+	e.double(5, o.BlockRate)
+	return e
+}
+
+func marshalRuleStats(s analytics.RuleStats) []byte {
+	var e encoder
+	e.string(1, s.RuleID)
+	e.int64(2, unixNano(s.Since))
+	e.int64(3, s.TotalRequests)
+	e.int64(4, s.BlockedRequests)
+	e.int64(5, s.UniqueClients)
+	e.double(6, s.BlockRate)
+	e.int64(7, s.ShadowBlocked)
+	return e
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n).UTC()
+}
@@ -0,0 +1,477 @@
+// Package grpcapi serves the rules and stats management API over gRPC, for
+// platforms that standardize internal tooling on it. It shares the rules
+// repository, stats provider and API tokens of the REST API, and speaks
+// both native gRPC, which needs HTTP/2 and therefore TLS, and gRPC-Web,
+// which also works over HTTP/1.1. Messages are defined in
+// management.proto; calls are unary except for the live event stream, and
+// compression is not supported.
+package grpcapi
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+	"github.com/Siruyy/gatify/internal/changes"
+	"github.com/Siruyy/gatify/internal/policy"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/stream"
+	"github.com/Siruyy/gatify/internal/users"
+)
+
+const (
+	// maxMessageBytes caps request messages, like the REST API's bodies.
+	maxMessageBytes = 1 << 20
+
+	defaultStatsWindow = 24 * time.Hour
+	maxStatsWindow     = 90 * 24 * time.Hour
+)
+
+// gRPC status codes.
+const (
+	codeOK                = 0
+	codeInvalidArgument   = 3
+	codeNotFound          = 5
+	codePermissionDenied  = 7
+	codeResourceExhausted = 8
+	codeAborted           = 10
+	codeUnimplemented     = 12
+	codeInternal          = 13
+	codeUnavailable       = 14
+	codeUnauthenticated   = 16
+)
+
+// Status is a failed call's gRPC status.
+type Status struct {
+	Code    int
+	Message string
+}
+
+func (s *Status) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", s.Code, s.Message)
+}
+
+func statusf(code int, format string, args ...any) *Status {
+	return &Status{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// StatsProvider answers the stats calls. The analytics query service
+// implements it.
+type StatsProvider interface {
+	Overview(ctx context.Context, since time.Time) (analytics.Overview, error)
+	RuleStats(ctx context.Context, ruleID string, since time.Time) (analytics.RuleStats, error)
+}
+
+// method is a unary call. write marks calls that change configuration.
+type method struct {
+	write bool
+	call  func(ctx context.Context, req []byte) ([]byte, error)
+}
+
+// Server serves the management API over gRPC.
+type Server struct {
+	rules        rules.Repository
+	users        *users.Authenticator
+	stats        StatsProvider
+	policies     policy.Repository
+	algorithm    string
+	changes      *changes.Notifier
+	rulesChanged func(ctx context.Context)
+	broker       *stream.Broker
+	methods      map[string]method
+	streams      map[string]streamMethod
+}
+
+// Option customizes a Server.
+type Option func(*Server)
+
+// WithRulesChanged registers fn to run after every successful rule
+// mutation, as the REST API's option of the same name does.
+func WithRulesChanged(fn func(ctx context.Context)) Option {
+	return func(s *Server) { s.rulesChanged = fn }
+}
+
+// WithStats enables the Stats service.
+func WithStats(stats StatsProvider) Option {
+	return func(s *Server) { s.stats = stats }
+}
+
+// WithPolicies rejects rules naming policies missing from repo.
+func WithPolicies(repo policy.Repository) Option {
+	return func(s *Server) { s.policies = repo }
+}
+
+// WithLimiterAlgorithm rejects rules relying on settings that name, the
+// gateway's LIMITER_ALGORITHM, ignores.
+func WithLimiterAlgorithm(name string) Option {
+	return func(s *Server) { s.algorithm = name }
+}
+
+// WithEvents enables the Events service, streaming what broker publishes.
+func WithEvents(broker *stream.Broker) Option {
+	return func(s *Server) { s.broker = broker }
+}
+
+// WithChangeNotifier reports rule changes to n.
+func WithChangeNotifier(n *changes.Notifier) Option {
+	return func(s *Server) { s.changes = n }
+}
+
+// NewServer creates a Server managing repo for callers authenticated by
+// auth.
+func NewServer(repo rules.Repository, auth *users.Authenticator, opts ...Option) *Server {
+	s := &Server{rules: repo, users: auth, rulesChanged: func(context.Context) {}}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.methods = map[string]method{
+		"/gatify.management.v1.Rules/ListRules":  {call: s.listRules},
+		"/gatify.management.v1.Rules/GetRule":    {call: s.getRule},
+		"/gatify.management.v1.Rules/CreateRule": {write: true, call: s.createRule},
+		"/gatify.management.v1.Rules/UpdateRule": {write: true, call: s.updateRule},
+		"/gatify.management.v1.Rules/DeleteRule": {write: true, call: s.deleteRule},
+	}
+	if s.stats != nil {
+		s.methods["/gatify.management.v1.Stats/GetOverview"] = method{call: s.getOverview}
+		s.methods["/gatify.management.v1.Stats/GetRuleStats"] = method{call: s.getRuleStats}
+	}
+	s.streams = make(map[string]streamMethod)
+	if s.broker != nil {
+		s.streams["/gatify.management.v1.Events/StreamEvents"] = s.streamEvents
+	}
+	return s
+}
+
+// ServeHTTP implements http.Handler for gRPC and gRPC-Web requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	if r.Method != http.MethodPost || !strings.HasPrefix(contentType, "application/grpc") {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+	web := strings.HasPrefix(contentType, "application/grpc-web")
+	if call, ok := s.streams[r.URL.Path]; ok {
+		s.serveStream(w, r, web, call)
+		return
+	}
+	resp, status := s.handle(r)
+	writeResponse(w, web, resp, status)
+}
+
+// authenticate identifies the caller and rejects compressed requests.
+func (s *Server) authenticate(r *http.Request) (users.Principal, *Status) {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	p, err := s.users.Authenticate(r.Context(), token)
+	if errors.Is(err, users.ErrUnauthenticated) {
+		return p, statusf(codeUnauthenticated, "missing or invalid token")
+	}
+	if err != nil {
+		log.Printf("Failed to authenticate gRPC call: %v", err)
+		return p, statusf(codeInternal, "failed to authenticate")
+	}
+	if r.Header.Get("Grpc-Encoding") != "" && r.Header.Get("Grpc-Encoding") != "identity" {
+		return p, statusf(codeUnimplemented, "compression is not supported")
+	}
+	return p, nil
+}
+
+// handle authenticates and runs one call, returning the response message
+// or the status it failed with.
+func (s *Server) handle(r *http.Request) ([]byte, *Status) {
+	p, status := s.authenticate(r)
+	if status != nil {
+		return nil, status
+	}
+	m, ok := s.methods[r.URL.Path]
+	if !ok {
+		return nil, statusf(codeUnimplemented, "unknown method %s", r.URL.Path)
+	}
+	if m.write && !p.CanWrite() {
+		return nil, statusf(codePermissionDenied, "token is read-only")
+	}
+
+	ctx := users.WithPrincipal(r.Context(), p)
+	req, status := readMessage(r.Body)
+	var resp []byte
+	if status == nil {
+		var err error
+		resp, err = m.call(ctx, req)
+		status = toStatus(err)
+	}
+	if m.write {
+		code := codeOK
+		if status != nil {
+			code = status.Code
+		}
+		if err := s.users.Audit(ctx, p, "GRPC", r.URL.Path, httpStatus(code)); err != nil {
+			log.Printf("Failed to audit %s by token %s: %v", r.URL.Path, p.TokenID, err)
+		}
+	}
+	return resp, status
+}
+
+func (s *Server) listRules(ctx context.Context, _ []byte) ([]byte, error) {
+	list, err := s.rules.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return marshalRuleList(list), nil
+}
+
+func (s *Server) getRule(ctx context.Context, req []byte) ([]byte, error) {
+	id, err := unmarshalID(req)
+	if err != nil {
+		return nil, err
+	}
+	rule, err := s.rules.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return marshalRule(rule), nil
+}
+
+func (s *Server) createRule(ctx context.Context, req []byte) ([]byte, error) {
+	rule, err := unmarshalRule(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate(ctx, &rule); err != nil {
+		return nil, err
+	}
+	created, err := s.rules.Create(ctx, rule)
+	if err != nil {
+		return nil, err
+	}
+	s.rulesChanged(ctx)
+	s.changes.Notify(changes.New(changes.ActionCreated, created, changes.Diff(nil, &created)))
+	return marshalRule(created), nil
+}
+
+func (s *Server) updateRule(ctx context.Context, req []byte) ([]byte, error) {
+	upd, err := unmarshalUpdate(req)
+	if err != nil {
+		return nil, err
+	}
+	rule := upd.rule
+	if rule.ID == "" {
+		return nil, statusf(codeInvalidArgument, "rule.id is required")
+	}
+	rule.Revision = upd.expectedRevision
+	if err := s.validate(ctx, &rule); err != nil {
+		return nil, err
+	}
+	old, err := s.rules.Get(ctx, rule.ID)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.rules.Update(ctx, rule)
+	if err != nil {
+		return nil, err
+	}
+	s.rulesChanged(ctx)
+	s.changes.Notify(changes.New(changes.ActionUpdated, updated, changes.Diff(&old, &updated)))
+	return marshalRule(updated), nil
+}
+
+func (s *Server) deleteRule(ctx context.Context, req []byte) ([]byte, error) {
+	id, err := unmarshalID(req)
+	if err != nil {
+		return nil, err
+	}
+	old, err := s.rules.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.rules.Delete(ctx, id); err != nil {
+		return nil, err
+	}
+	s.rulesChanged(ctx)
+	s.changes.Notify(changes.New(changes.ActionDeleted, old, changes.Diff(&old, nil)))
+	return nil, nil
+}
+
+// validate normalizes and checks a rule as the REST API does.
+func (s *Server) validate(ctx context.Context, rule *rules.Rule) error {
+	rule.Normalize()
+	if err := rule.Validate(); err != nil {
+		return statusf(codeInvalidArgument, "%v", err)
+	}
+	if err := rule.CheckAlgorithm(s.algorithm); err != nil {
+		return statusf(codeInvalidArgument, "%v", err)
+	}
+	if s.policies == nil || rule.Policy == "" {
+		return nil
+	}
+	_, err := s.policies.Get(ctx, rule.Policy)
+	if errors.Is(err, policy.ErrNotFound) {
+		return statusf(codeInvalidArgument, "unknown policy %q", rule.Policy)
+	}
+	return err
+}
+
+func (s *Server) getOverview(ctx context.Context, req []byte) ([]byte, error) {
+	_, since, err := parseStatsRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	o, err := s.stats.Overview(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	return marshalOverview(o), nil
+}
+
+func (s *Server) getRuleStats(ctx context.Context, req []byte) ([]byte, error) {
+	q, since, err := parseStatsRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if q.ruleID == "" {
+		return nil, statusf(codeInvalidArgument, "rule_id is required for rule stats")
+	}
+	st, err := s.stats.RuleStats(ctx, q.ruleID, since)
+	if err != nil {
+		return nil, err
+	}
+	return marshalRuleStats(st), nil
+}
+
+func parseStatsRequest(req []byte) (statsRequest, time.Time, error) {
+	q, err := unmarshalStatsRequest(req)
+	if err != nil {
+		return q, time.Time{}, err
+	}
+	if q.window == 0 {
+		q.window = defaultStatsWindow
+	}
+	if q.window < 0 || q.window > maxStatsWindow {
+		return q, time.Time{}, statusf(codeInvalidArgument, "window_seconds must be between 1 and %d", int64(maxStatsWindow/time.Second))
+	}
+	return q, time.Now().Add(-q.window), nil
+}
+
+// toStatus maps repository and decoding errors to gRPC statuses.
+func toStatus(err error) *Status {
+	var st *Status
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &st):
+		return st
+	case errors.Is(err, errMalformed):
+		return statusf(codeInvalidArgument, "%v", err)
+	case errors.Is(err, rules.ErrNotFound):
+		return statusf(codeNotFound, "%v", err)
+	case errors.Is(err, rules.ErrRevisionConflict):
+		return statusf(codeAborted, "%v", err)
+	}
+	log.Printf("gRPC call failed: %v", err)
+	return statusf(codeInternal, "internal error")
+}
+
+// httpStatus maps a gRPC code to the HTTP status recorded in the audit
+// log, so REST and gRPC entries read alike.
+func httpStatus(code int) int {
+	switch code {
+	case codeOK:
+		return http.StatusOK
+	case codeInvalidArgument:
+		return http.StatusBadRequest
+	case codeNotFound:
+		return http.StatusNotFound
+	case codePermissionDenied:
+		return http.StatusForbidden
+	case codeResourceExhausted:
+		return http.StatusRequestEntityTooLarge
+	case codeAborted:
+		return http.StatusPreconditionFailed
+	case codeUnimplemented:
+		return http.StatusNotImplemented
+	case codeUnavailable:
+		return http.StatusServiceUnavailable
+	case codeUnauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// readMessage reads the single length-prefixed message of a unary call.
+func readMessage(body io.Reader) ([]byte, *Status) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, statusf(codeInvalidArgument, "missing request message")
+	}
+	if prefix[0] != 0 {
+		return nil, statusf(codeUnimplemented, "compression is not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxMessageBytes {
+		return nil, statusf(codeResourceExhausted, "request message larger than %d bytes", maxMessageBytes)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, statusf(codeInvalidArgument, "truncated request message")
+	}
+	return msg, nil
+}
+
+// writeResponse writes the response message, if any, and the call's
+// status: as HTTP trailers for gRPC, and as a trailer frame for gRPC-Web.
+func writeResponse(w http.ResponseWriter, web bool, msg []byte, status *Status) {
+	startResponse(w, web)
+	if status == nil {
+		_, _ = w.Write(frame(0, msg))
+	}
+	finishResponse(w, web, status)
+}
+
+// startResponse sends the response headers, before any message.
+func startResponse(w http.ResponseWriter, web bool) {
+	h := w.Header()
+	if web {
+		h.Set("Content-Type", "application/grpc-web+proto")
+	} else {
+		h.Set("Content-Type", "application/grpc")
+		h.Set("Trailer", "Grpc-Status, Grpc-Message")
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// finishResponse sends the call's status after the last message.
+func finishResponse(w http.ResponseWriter, web bool, status *Status) {
+	code, message := codeOK, ""
+	if status != nil {
+		code, message = status.Code, status.Message
+	}
+	h := w.Header()
+	if web {
+		trailer := "grpc-status: " + strconv.Itoa(code) + "\r\n"
+		if message != "" {
+			trailer += "grpc-message: " + url.PathEscape(message) + "\r\n"
+		}
+		_, _ = w.Write(frame(0x80, []byte(trailer)))
+		return
+	}
+	h.Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		h.Set("Grpc-Message", url.PathEscape(message))
+	}
+}
+
+// frame prefixes msg with its flags and length.
+func frame(flags byte, msg []byte) []byte {
+	out := make([]byte, 5, 5+len(msg))
+	out[0] = flags
+	binary.BigEndian.PutUint32(out[1:], uint32(len(msg)))
+	return append(out, msg...)
+}
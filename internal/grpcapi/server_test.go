@@ -0,0 +1,271 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/users"
+)
+
+const testToken = "test-token"
+
+type fakeStats struct{}
+
+func (fakeStats) Overview(_ context.Context, since time.Time) (analytics.Overview, error) {
+	return analytics.Overview{Since: since, TotalRequests: 10, BlockedRequests: 2, BlockRate: 0.2}, nil
+}
+
+func (fakeStats) RuleStats(_ context.Context, ruleID string, since time.Time) (analytics.RuleStats, error) {
+	return analytics.RuleStats{RuleID: ruleID, Since: since, TotalRequests: 4}, nil
+}
+
+// callWeb makes a gRPC-Web call and returns the response message and the
+// status from the trailer frame.
+func callWeb(t *testing.T, h http.Handler, method, token string, msg []byte) ([]byte, int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/gatify.management.v1."+method, bytes.NewReader(frame(0, msg)))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected HTTP 200, got %d", rec.Code)
+	}
+
+	var resp []byte
+	body := rec.Body.Bytes()
+	for len(body) > 0 {
+		if len(body) < 5 {
+			t.Fatalf("truncated frame")
+		}
+		flags, size := body[0], binary.BigEndian.Uint32(body[1:5])
+		payload := body[5 : 5+size]
+		body = body[5+size:]
+		if flags&0x80 == 0 {
+			resp = payload
+			continue
+		}
+		code, message := -1, ""
+		for _, line := range strings.Split(strings.TrimSpace(string(payload)), "\r\n") {
+			k, v, _ := strings.Cut(line, ": ")
+			switch k {
+			case "grpc-status":
+				code, _ = strconv.Atoi(v)
+			case "grpc-message":
+				message, _ = url.PathUnescape(v)
+			}
+		}
+		return resp, code, message
+	}
+	t.Fatalf("response has no trailer frame")
+	return nil, 0, ""
+}
+
+func newTestServer(t *testing.T) (*Server, *users.Authenticator, rules.Repository) {
+	t.Helper()
+	repo := rules.NewInMemoryRepository()
+	auth := users.NewAuthenticator(users.NewInMemoryStore(), testToken)
+	return NewServer(repo, auth, WithStats(fakeStats{})), auth, repo
+}
+
+func TestRuleCalls(t *testing.T) {
+	s, _, _ := newTestServer(t)
+
+	resp, code, msg := callWeb(t, s, "Rules/CreateRule", testToken,
+		marshalRule(rules.Rule{Name: "login", Pattern: "/login", Limit: 5, WindowSeconds: 60, Enabled: true}))
+	if code != codeOK {
+		t.Fatalf("CreateRule failed: %d %s", code, msg)
+	}
+	created, err := unmarshalRule(resp)
+	if err != nil {
+		t.Fatalf("decode created rule: %v", err)
+	}
+	if created.ID == "" || created.Revision != 1 {
+		t.Fatalf("expected stored rule, got %+v", created)
+	}
+
+	var get encoder
+	get.string(1, created.ID)
+	resp, code, _ = callWeb(t, s, "Rules/GetRule", testToken, get)
+	if got, _ := unmarshalRule(resp); code != codeOK || got.Name != "login" {
+		t.Fatalf("GetRule: code %d, rule %+v", code, got)
+	}
+
+	created.Limit = 10
+	var upd encoder
+	upd.bytes(1, marshalRule(created))
+	upd.int64(2, 1)
+	resp, code, msg = callWeb(t, s, "Rules/UpdateRule", testToken, upd)
+	if code != codeOK {
+		t.Fatalf("UpdateRule failed: %d %s", code, msg)
+	}
+	if got, _ := unmarshalRule(resp); got.Limit != 10 || got.Revision != 2 {
+		t.Fatalf("unexpected updated rule %+v", got)
+	}
+
+	// The same expected revision is now stale.
+	if _, code, _ = callWeb(t, s, "Rules/UpdateRule", testToken, upd); code != codeAborted {
+		t.Fatalf("expected ABORTED for a stale revision, got %d", code)
+	}
+
+	resp, code, _ = callWeb(t, s, "Rules/ListRules", testToken, nil)
+	var count int
+	_ = decode(resp, func(fieldValue) error { count++; return nil })
+	if code != codeOK || count != 1 {
+		t.Fatalf("ListRules: code %d, %d rules", code, count)
+	}
+
+	if _, code, _ = callWeb(t, s, "Rules/DeleteRule", testToken, get); code != codeOK {
+		t.Fatalf("DeleteRule: code %d", code)
+	}
+	if _, code, _ = callWeb(t, s, "Rules/GetRule", testToken, get); code != codeNotFound {
+		t.Fatalf("expected NOT_FOUND after delete, got %d", code)
+	}
+}
+
+func TestCreateRuleValidates(t *testing.T) {
+	s, _, _ := newTestServer(t)
+
+	_, code, msg := callWeb(t, s, "Rules/CreateRule", testToken, marshalRule(rules.Rule{Name: "no pattern"}))
+	if code != codeInvalidArgument || msg == "" {
+		t.Fatalf("expected INVALID_ARGUMENT with a message, got %d %q", code, msg)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	s, auth, _ := newTestServer(t)
+	_, readOnly, err := auth.Issue(context.Background(), "dashboards", users.RoleReadOnly, users.Principal{Name: "test"})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	if _, code, _ := callWeb(t, s, "Rules/ListRules", "", nil); code != codeUnauthenticated {
+		t.Fatalf("expected UNAUTHENTICATED without a token, got %d", code)
+	}
+	if _, code, _ := callWeb(t, s, "Rules/ListRules", readOnly, nil); code != codeOK {
+		t.Fatalf("expected read-only token to list rules, got %d", code)
+	}
+	rule := marshalRule(rules.Rule{Name: "login", Pattern: "/login", Limit: 5, WindowSeconds: 60})
+	if _, code, _ := callWeb(t, s, "Rules/CreateRule", readOnly, rule); code != codePermissionDenied {
+		t.Fatalf("expected PERMISSION_DENIED for a read-only token, got %d", code)
+	}
+
+	audit, err := auth.Store().ListAudit(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	if len(audit) != 0 {
+		t.Fatalf("expected denied calls to stay out of the audit log, got %+v", audit)
+	}
+}
+
+func TestWritesAreAudited(t *testing.T) {
+	s, auth, _ := newTestServer(t)
+	rule := marshalRule(rules.Rule{Name: "login", Pattern: "/login", Limit: 5, WindowSeconds: 60})
+	if _, code, _ := callWeb(t, s, "Rules/CreateRule", testToken, rule); code != codeOK {
+		t.Fatalf("CreateRule: code %d", code)
+	}
+
+	audit, err := auth.Store().ListAudit(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	if len(audit) != 1 || audit[0].Method != "GRPC" || audit[0].Path != "/gatify.management.v1.Rules/CreateRule" || audit[0].Status != http.StatusOK {
+		t.Fatalf("unexpected audit log %+v", audit)
+	}
+}
+
+func TestStatsCalls(t *testing.T) {
+	s, _, _ := newTestServer(t)
+
+	resp, code, _ := callWeb(t, s, "Stats/GetOverview", testToken, nil)
+	if code != codeOK {
+		t.Fatalf("GetOverview: code %d", code)
+	}
+	var total int64
+	_ = decode(resp, func(f fieldValue) error {
+		if f.num == 2 {
+			total = f.int64()
+		}
+		return nil
+	})
+	if total != 10 {
+		t.Fatalf("expected 10 total requests, got %d", total)
+	}
+
+	if _, code, _ = callWeb(t, s, "Stats/GetRuleStats", testToken, nil); code != codeInvalidArgument {
+		t.Fatalf("expected INVALID_ARGUMENT without rule_id, got %d", code)
+	}
+	var req encoder
+	req.int64(1, -1)
+	if _, code, _ = callWeb(t, s, "Stats/GetOverview", testToken, req); code != codeInvalidArgument {
+		t.Fatalf("expected INVALID_ARGUMENT for a negative window, got %d", code)
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	if _, code, _ := callWeb(t, s, "Rules/Nope", testToken, nil); code != codeUnimplemented {
+		t.Fatalf("expected UNIMPLEMENTED, got %d", code)
+	}
+
+	noStats := NewServer(rules.NewInMemoryRepository(), users.NewAuthenticator(users.NewInMemoryStore(), testToken))
+	if _, code, _ := callWeb(t, noStats, "Stats/GetOverview", testToken, nil); code != codeUnimplemented {
+		t.Fatalf("expected UNIMPLEMENTED without a stats provider, got %d", code)
+	}
+}
+
+func TestRejectsNonGRPCRequests(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/gatify.management.v1.Rules/ListRules", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %d", rec.Code)
+	}
+}
+
+func TestNativeGRPCOverHTTP2(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	srv := httptest.NewUnstartedServer(s)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/gatify.management.v1.Rules/ListRules", bytes.NewReader(frame(0, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("expected HTTP/2, got %s", resp.Proto)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if len(body) != 5 {
+		t.Fatalf("expected one empty message frame, got %d bytes", len(body))
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Fatalf("expected grpc-status trailer 0, got %q", got)
+	}
+}
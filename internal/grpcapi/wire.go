@@ -0,0 +1,136 @@
+package grpcapi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errMalformed = errors.New("malformed protobuf message")
+
+// encoder appends protobuf fields. Zero values are omitted, as in proto3.
+type encoder []byte
+
+func (e *encoder) tag(field, wire int) {
+	*e = binary.AppendUvarint(*e, uint64(field)<<3|uint64(wire))
+}
+
+func (e *encoder) int64(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireVarint)
+	*e = binary.AppendUvarint(*e, uint64(v))
+}
+
+func (e *encoder) bool(field int, v bool) {
+	if v {
+		e.int64(field, 1)
+	}
+}
+
+func (e *encoder) double(field int, v float64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireFixed64)
+	*e = binary.LittleEndian.AppendUint64(*e, math.Float64bits(v))
+}
+
+func (e *encoder) string(field int, s string) {
+	if s != "" {
+		e.bytes(field, []byte(s))
+	}
+}
+
+// bytes always writes the field, so repeated and embedded messages keep
+// their empty elements.
+func (e *encoder) bytes(field int, b []byte) {
+	e.tag(field, wireBytes)
+	*e = binary.AppendUvarint(*e, uint64(len(b)))
+	*e = append(*e, b...)
+}
+
+func (e *encoder) strings(field int, list []string) {
+	for _, s := range list {
+		e.bytes(field, []byte(s))
+	}
+}
+
+// fieldValue is one decoded field: v holds varint and fixed values, b the
+// contents of length-delimited ones.
+type fieldValue struct {
+	num  int
+	wire int
+	v    uint64
+	b    []byte
+}
+
+func (f fieldValue) int64() int64    { return int64(f.v) }
+func (f fieldValue) bool() bool      { return f.v != 0 }
+func (f fieldValue) double() float64 { return math.Float64frombits(f.v) }
+func (f fieldValue) string() string  { return string(f.b) }
+
+// want checks that a known field arrived with the wire type its
+// declaration implies.
+func (f fieldValue) want(wire int) error {
+	if f.wire != wire {
+		return fmt.Errorf("%w: field %d has wire type %d", errMalformed, f.num, f.wire)
+	}
+	return nil
+}
+
+// decode calls fn with every field of buf in order. Unknown fields are
+// passed along too, for fn to ignore.
+func decode(buf []byte, fn func(f fieldValue) error) error {
+	for len(buf) > 0 {
+		tag, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return errMalformed
+		}
+		buf = buf[n:]
+		f := fieldValue{num: int(tag >> 3), wire: int(tag & 7)}
+		if f.num == 0 {
+			return errMalformed
+		}
+		switch f.wire {
+		case wireVarint:
+			f.v, n = binary.Uvarint(buf)
+			if n <= 0 {
+				return errMalformed
+			}
+			buf = buf[n:]
+		case wireFixed64:
+			if len(buf) < 8 {
+				return errMalformed
+			}
+			f.v, buf = binary.LittleEndian.Uint64(buf), buf[8:]
+		case wireFixed32:
+			if len(buf) < 4 {
+				return errMalformed
+			}
+			f.v, buf = uint64(binary.LittleEndian.Uint32(buf)), buf[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(buf)
+			if n <= 0 || size > uint64(len(buf)-n) {
+				return errMalformed
+			}
+			f.b, buf = buf[n:n+int(size)], buf[n+int(size):]
+		default:
+			return errMalformed
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package grpcapi
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+func TestRuleRoundTrip(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	want := rules.Rule{
+		ID:              "r1",
+		Name:            "api",
+		Pattern:         "/api/*",
+		Methods:         []string{"GET", "POST"},
+		Priority:        -5,
+		Limit:           100,
+		WindowSeconds:   60,
+		IdentifyBy:      "header",
+		HeaderName:      "X-Key",
+		CookieName:      "sid",
+		JWTClaim:        "org.id",
+		Burst:           5,
+		Namespace:       "acme",
+		Shadow:          true,
+		Policy:          "standard",
+		DenyCountries:   []string{"GB"},
+		Agents:          []string{"bot", "tool"},
+		ShedPriority:    7,
+		CaptureHeaders:  []string{"X-Tenant"},
+		Enabled:         true,
+		Revision:        3,
+		CreatedAt:       now,
+		UpdatedAt:       now.Add(time.Minute),
+		CacheHeaders:    map[string]string{"Cache-Control": "no-store"},
+		Rejection:       &rules.Rejection{ContentType: "text/plain", Body: "slow down"},
+		RejectionMaxAge: 5,
+		Tags:            []string{"team:billing"},
+		Schedule:        &rules.Schedule{Days: []string{"mon"}, Start: "09:00", End: "17:00"},
+	}
+
+	got, err := unmarshalRule(marshalRule(want))
+	if err != nil {
+		t.Fatalf("unmarshalRule: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("round trip mismatch:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestUnmarshalRuleSkipsUnknownFields(t *testing.T) {
+	var e encoder
+	e.string(2, "api")
+	e.string(99, "from a newer client")
+	e.int64(100, 7)
+
+	got, err := unmarshalRule(e)
+	if err != nil {
+		t.Fatalf("unmarshalRule: %v", err)
+	}
+	if got.Name != "api" {
+		t.Fatalf("expected name api, got %q", got.Name)
+	}
+}
+
+func TestUnmarshalRuleRejectsMalformed(t *testing.T) {
+	wrongType := encoder{}
+	wrongType.int64(2, 1) // name sent as a varint
+
+	unknownOption := encoder{}
+	unknownOption.string(25, `{"bogus":true}`)
+
+	for name, buf := range map[string][]byte{
+		"truncated":      {0x12, 0x05, 'a'},
+		"wrong type":     wrongType,
+		"unknown option": unknownOption,
+		"zero field":     {0x00, 0x01},
+	} {
+		if _, err := unmarshalRule(buf); !errors.Is(err, errMalformed) {
+			t.Errorf("%s: expected errMalformed, got %v", name, err)
+		}
+	}
+}
+
+func TestUnmarshalUpdate(t *testing.T) {
+	var e encoder
+	e.bytes(1, marshalRule(rules.Rule{ID: "r1", Name: "api"}))
+	e.int64(2, 4)
+
+	req, err := unmarshalUpdate(e)
+	if err != nil {
+		t.Fatalf("unmarshalUpdate: %v", err)
+	}
+	if req.rule.ID != "r1" || req.rule.Name != "api" || req.expectedRevision != 4 {
+		t.Fatalf("unexpected request %+v", req)
+	}
+}
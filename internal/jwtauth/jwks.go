@@ -0,0 +1,225 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxJWKSBytes bounds the JWKS document read from the endpoint.
+const maxJWKSBytes = 1 << 20
+
+// KeySet holds the public keys published at a JWKS URL, by key ID. It is
+// safe for concurrent use.
+type KeySet struct {
+	url    string
+	client *http.Client
+
+	mu   sync.RWMutex
+	keys map[string]publicKey
+}
+
+type publicKey struct {
+	key crypto.PublicKey
+	// alg is the algorithm the JWKS restricts the key to, if any.
+	alg string
+}
+
+// NewKeySet returns an empty KeySet fetching from url with client, or
+// http.DefaultClient when client is nil. Call Refresh to load it.
+func NewKeySet(url string, client *http.Client) *KeySet {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &KeySet{url: url, client: client, keys: map[string]publicKey{}}
+}
+
+// Run refreshes the keys every interval until ctx is cancelled, so keys
+// the issuer rotates in are picked up. Failures keep the previous keys.
+func (s *KeySet) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx); err != nil {
+				log.Printf("⚠️  JWKS refresh failed, keeping previous keys: %v", err)
+			}
+		}
+	}
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Refresh fetches the JWKS and replaces the keys. Keys of unsupported
+// types, or meant for encryption, are skipped.
+func (s *KeySet) Refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch JWKS: unexpected status %s", resp.Status)
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSBytes)).Decode(&doc); err != nil {
+		return fmt.Errorf("decode JWKS: %w", err)
+	}
+	keys := make(map[string]publicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Printf("⚠️  Skipping JWKS key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = publicKey{key: key, alg: k.Alg}
+	}
+	if len(keys) == 0 {
+		return errors.New("JWKS has no usable signing keys")
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+	return nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		if n.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		// Let crypto/ecdh reject points that are not on the curve.
+		size := (curve.elliptic.Params().BitSize + 7) / 8
+		if len(x.Bytes()) > size || len(y.Bytes()) > size {
+			return nil, errors.New("invalid EC point")
+		}
+		uncompressed := append([]byte{4}, append(x.FillBytes(make([]byte, size)), y.FillBytes(make([]byte, size))...)...)
+		if _, err := curve.ecdh.NewPublicKey(uncompressed); err != nil {
+			return nil, errors.New("invalid EC point")
+		}
+		return &ecdsa.PublicKey{Curve: curve.elliptic, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+type curve struct {
+	elliptic elliptic.Curve
+	ecdh     ecdh.Curve
+	alg      string
+}
+
+var curves = map[string]curve{
+	"P-256": {elliptic.P256(), ecdh.P256(), "ES256"},
+	"P-384": {elliptic.P384(), ecdh.P384(), "ES384"},
+	"P-521": {elliptic.P521(), ecdh.P521(), "ES512"},
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// key returns the key that verifies alg signatures under kid. Tokens
+// without a kid use the set's only key for alg, if there is just one.
+func (s *KeySet) key(kid, alg string) (crypto.PublicKey, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if kid != "" {
+		k, ok := s.keys[kid]
+		if !ok || !k.accepts(alg) {
+			return nil, false
+		}
+		return k.key, true
+	}
+	var found crypto.PublicKey
+	for _, k := range s.keys {
+		if k.accepts(alg) {
+			if found != nil {
+				return nil, false
+			}
+			found = k.key
+		}
+	}
+	return found, found != nil
+}
+
+// accepts reports whether the key may verify alg signatures.
+func (k publicKey) accepts(alg string) bool {
+	if k.alg != "" && k.alg != alg {
+		return false
+	}
+	switch key := k.key.(type) {
+	case *rsa.PublicKey:
+		return alg == "RS256" || alg == "RS384" || alg == "RS512"
+	case *ecdsa.PublicKey:
+		c, ok := curves[key.Curve.Params().Name]
+		return ok && c.alg == alg
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func serveJWKS(t *testing.T, keys ...map[string]any) *KeySet {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	t.Cleanup(srv.Close)
+	s := NewKeySet(srv.URL, srv.Client())
+	if err := s.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	return s
+}
+
+func TestVerifyWithJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := serveJWKS(t,
+		map[string]any{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		map[string]any{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		map[string]any{"kty": "RSA", "kid": "enc", "use": "enc", "n": b64(rsaKey.N.Bytes()), "e": "AQAB"},
+	)
+	v := NewVerifier(Config{Keys: keys})
+
+	rs256 := func(input []byte) []byte {
+		digest := sha256.Sum256(input)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	es256 := func(input []byte) []byte {
+		digest := sha256.Sum256(input)
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	claims := map[string]any{"sub": "user-1"}
+
+	for name, token := range map[string]string{
+		"RS256": sign(t, map[string]any{"alg": "RS256", "kid": "rsa-1"}, claims, rs256),
+		"ES256": sign(t, map[string]any{"alg": "ES256", "kid": "ec-1"}, claims, es256),
+		// Without a kid, the only key for the algorithm is used.
+		"ES256 without kid": sign(t, map[string]any{"alg": "ES256"}, claims, es256),
+	} {
+		if c, err := v.Verify(token); err != nil || c["sub"] != "user-1" {
+			t.Errorf("%s: Verify() = %v, %v", name, c, err)
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		token string
+		want  error
+	}{
+		"unknown kid":        {sign(t, map[string]any{"alg": "RS256", "kid": "rsa-2"}, claims, rs256), ErrUnknownKey},
+		"encryption key":     {sign(t, map[string]any{"alg": "RS256", "kid": "enc"}, claims, rs256), ErrUnknownKey},
+		"algorithm mismatch": {sign(t, map[string]any{"alg": "ES384", "kid": "ec-1"}, claims, es256), ErrUnknownKey},
+		"tampered":           {sign(t, map[string]any{"alg": "RS256", "kid": "rsa-1"}, claims, func(b []byte) []byte { return rs256(append(b, 'x')) }), ErrSignature},
+		// The RSA key's bytes must not verify an HMAC signature.
+		"HMAC with public key": {sign(t, map[string]any{"alg": "HS256", "kid": "rsa-1"}, claims, hs256(rsaKey.N.Bytes())), ErrUnknownKey},
+	} {
+		if _, err := v.Verify(tc.token); !errors.Is(err, tc.want) {
+			t.Errorf("%s: Verify() error = %v, want %v", name, err, tc.want)
+		}
+	}
+}
+
+func TestKeySetRefreshKeepsKeysOnFailure(t *testing.T) {
+	failing := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"keys":[{"kty":"EC","kid":"bad","crv":"P-256","x":"AQ","y":"AQ"}]}`))
+	}))
+	defer srv.Close()
+
+	s := NewKeySet(srv.URL, srv.Client())
+	if err := s.Refresh(context.Background()); err == nil {
+		t.Error("Expected a JWKS without usable keys to fail")
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.keys = map[string]publicKey{"ec-1": {key: &ecKey.PublicKey}}
+	failing = true
+	if err := s.Refresh(context.Background()); err == nil {
+		t.Error("Expected an error status to fail the refresh")
+	}
+	if _, ok := s.key("ec-1", "ES256"); !ok {
+		t.Error("Expected the previous keys to be kept")
+	}
+}
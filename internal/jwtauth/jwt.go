@@ -0,0 +1,265 @@
+// Package jwtauth verifies the JSON Web Tokens clients present, so rules
+// can identify them by a signed claim such as sub instead of a header they
+// could set to anything. Tokens are checked against a shared HMAC secret
+// or the RSA and ECDSA keys of a JWKS endpoint.
+package jwtauth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	// Register the hashes the supported algorithms sign with.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// DefaultLeeway absorbs clock skew between the token issuer and the
+// gateway when checking exp and nbf.
+const DefaultLeeway = 30 * time.Second
+
+// Error is a verification failure. Reason is a short code suitable for
+// analytics, such as "expired".
+type Error struct {
+	Reason string
+}
+
+func (e *Error) Error() string { return "jwt: " + e.Reason }
+
+// Verification failures.
+var (
+	ErrMalformed    = &Error{"malformed"}
+	ErrAlgorithm    = &Error{"unsupported_alg"}
+	ErrUnknownKey   = &Error{"unknown_key"}
+	ErrSignature    = &Error{"bad_signature"}
+	ErrExpired      = &Error{"expired"}
+	ErrNotYetValid  = &Error{"not_yet_valid"}
+	ErrIssuer       = &Error{"wrong_issuer"}
+	ErrAudience     = &Error{"wrong_audience"}
+	ErrMissingClaim = &Error{"missing_claim"}
+)
+
+// Config configures a Verifier. At least one of Secret and Keys should be
+// set, or every token fails with ErrUnknownKey.
+type Config struct {
+	// Secret verifies HS256, HS384 and HS512 tokens.
+	Secret []byte
+	// Keys verifies RS256/384/512 and ES256/384/512 tokens.
+	Keys *KeySet
+	// Issuer and Audience, when set, must match the iss claim and one of
+	// the aud claim's values.
+	Issuer   string
+	Audience string
+	// Leeway is the clock skew tolerated on exp and nbf; DefaultLeeway
+	// when zero.
+	Leeway time.Duration
+}
+
+// Verifier checks token signatures and registered claims. It is safe for
+// concurrent use.
+type Verifier struct {
+	cfg Config
+	now func() time.Time
+}
+
+// NewVerifier returns a Verifier for cfg.
+func NewVerifier(cfg Config) *Verifier {
+	if cfg.Leeway == 0 {
+		cfg.Leeway = DefaultLeeway
+	}
+	return &Verifier{cfg: cfg, now: time.Now}
+}
+
+// Claims are a verified token's payload. Numbers are json.Number so large
+// numeric IDs keep their precision.
+type Claims map[string]any
+
+// String returns the claim at name, with dots reaching into nested
+// objects (e.g. "org.id"), as a string. Strings and numbers qualify;
+// other values, and empty strings, are reported missing.
+func (c Claims) String(name string) (string, bool) {
+	var v any = map[string]any(c)
+	for _, key := range strings.Split(name, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if v, ok = obj[key]; !ok {
+			return "", false
+		}
+	}
+	switch v := v.(type) {
+	case string:
+		return v, v != ""
+	case json.Number:
+		return v.String(), true
+	}
+	return "", false
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks token's signature, its exp and nbf times and, when
+// configured, its issuer and audience, and returns its claims. Failures
+// are one of the package's *Error values.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, ErrMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if err := v.verifySignature(h, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformed
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, dst any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(dst)
+}
+
+// algorithms maps each supported alg to its hash.
+var algorithms = map[string]crypto.Hash{
+	"HS256": crypto.SHA256, "HS384": crypto.SHA384, "HS512": crypto.SHA512,
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// verifySignature checks sig over signed. The key must be of the kind the
+// algorithm names, so an RSA public key cannot be replayed as an HMAC
+// secret.
+func (v *Verifier) verifySignature(h header, signed string, sig []byte) error {
+	hash, ok := algorithms[h.Alg]
+	if !ok {
+		return ErrAlgorithm
+	}
+
+	if strings.HasPrefix(h.Alg, "HS") {
+		if len(v.cfg.Secret) == 0 {
+			return ErrUnknownKey
+		}
+		mac := hmac.New(hash.New, v.cfg.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrSignature
+		}
+		return nil
+	}
+
+	key, ok := v.cfg.Keys.key(h.Kid, h.Alg)
+	if !ok {
+		return ErrUnknownKey
+	}
+	d := hash.New()
+	d.Write([]byte(signed))
+	digest := d.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, hash, digest, sig) != nil {
+			return ErrSignature
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return ErrSignature
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return ErrSignature
+		}
+	default:
+		return ErrUnknownKey
+	}
+	return nil
+}
+
+func (v *Verifier) checkClaims(c Claims) error {
+	now := v.now()
+	exp, hasExp, err := numericDate(c, "exp")
+	if err != nil {
+		return err
+	}
+	if hasExp && !now.Before(exp.Add(v.cfg.Leeway)) {
+		return ErrExpired
+	}
+	nbf, hasNbf, err := numericDate(c, "nbf")
+	if err != nil {
+		return err
+	}
+	if hasNbf && now.Add(v.cfg.Leeway).Before(nbf) {
+		return ErrNotYetValid
+	}
+	if v.cfg.Issuer != "" {
+		if iss, _ := c["iss"].(string); iss != v.cfg.Issuer {
+			return ErrIssuer
+		}
+	}
+	if v.cfg.Audience != "" && !audience(c["aud"], v.cfg.Audience) {
+		return ErrAudience
+	}
+	return nil
+}
+
+// numericDate reads a time claim, reporting whether it is present. A
+// present claim that is not a number makes the token malformed.
+func numericDate(c Claims, name string) (time.Time, bool, error) {
+	v, ok := c[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false, ErrMalformed
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false, ErrMalformed
+	}
+	return time.Unix(int64(f), 0), true, nil
+}
+
+// audience reports whether aud, a string or an array of strings, names
+// want.
+func audience(aud any, want string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == want
+	case []any:
+		return slices.Contains(aud, any(want))
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package jwtauth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("test-secret")
+
+// sign builds a token with header and claims, signed by sign over the
+// signing input.
+func sign(t *testing.T, header, claims map[string]any, sign func([]byte) []byte) string {
+	t.Helper()
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return input + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(input)))
+}
+
+func hs256(secret []byte) func([]byte) []byte {
+	return func(input []byte) []byte {
+		mac := hmac.New(crypto.SHA256.New, secret)
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+}
+
+func TestVerifyHMAC(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := NewVerifier(Config{Secret: testSecret, Issuer: "https://auth.example.com", Audience: "api"})
+	v.now = func() time.Time { return now }
+
+	valid := map[string]any{
+		"sub": "user-1", "iss": "https://auth.example.com", "aud": []string{"web", "api"},
+		"exp": now.Add(time.Minute).Unix(), "org": map[string]any{"id": 12345678901234567},
+	}
+	claims, err := v.Verify(sign(t, map[string]any{"alg": "HS256"}, valid, hs256(testSecret)))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if sub, _ := claims.String("sub"); sub != "user-1" {
+		t.Errorf("sub = %q, want user-1", sub)
+	}
+	if org, _ := claims.String("org.id"); org != "12345678901234567" {
+		t.Errorf("org.id = %q, want the exact number", org)
+	}
+	if _, ok := claims.String("org"); ok {
+		t.Error("Expected an object claim to be missing as a string")
+	}
+
+	with := func(key string, value any) map[string]any {
+		c := map[string]any{}
+		for k, v := range valid {
+			c[k] = v
+		}
+		c[key] = value
+		return c
+	}
+	for name, tc := range map[string]struct {
+		token string
+		want  error
+	}{
+		"malformed":      {"a.b", ErrMalformed},
+		"none":           {sign(t, map[string]any{"alg": "none"}, valid, func([]byte) []byte { return nil }), ErrAlgorithm},
+		"wrong secret":   {sign(t, map[string]any{"alg": "HS256"}, valid, hs256([]byte("other"))), ErrSignature},
+		"no public keys": {sign(t, map[string]any{"alg": "RS256"}, valid, hs256(testSecret)), ErrUnknownKey},
+		"expired":        {sign(t, map[string]any{"alg": "HS256"}, with("exp", now.Add(-time.Minute).Unix()), hs256(testSecret)), ErrExpired},
+		"not yet valid":  {sign(t, map[string]any{"alg": "HS256"}, with("nbf", now.Add(time.Minute).Unix()), hs256(testSecret)), ErrNotYetValid},
+		"bad exp":        {sign(t, map[string]any{"alg": "HS256"}, with("exp", "tomorrow"), hs256(testSecret)), ErrMalformed},
+		"wrong issuer":   {sign(t, map[string]any{"alg": "HS256"}, with("iss", "https://evil.example.com"), hs256(testSecret)), ErrIssuer},
+		"wrong audience": {sign(t, map[string]any{"alg": "HS256"}, with("aud", "admin"), hs256(testSecret)), ErrAudience},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := v.Verify(tc.token); !errors.Is(err, tc.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestVerifyLeeway(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := NewVerifier(Config{Secret: testSecret})
+	v.now = func() time.Time { return now }
+
+	token := sign(t, map[string]any{"alg": "HS256"}, map[string]any{"sub": "u", "exp": now.Add(-10 * time.Second).Unix()}, hs256(testSecret))
+	if _, err := v.Verify(token); err != nil {
+		t.Errorf("Expected a token expired within the leeway to verify, got %v", err)
+	}
+}
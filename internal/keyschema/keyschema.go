@@ -0,0 +1,262 @@
+// Package keyschema versions the layout of the keys Gatify keeps in shared
+// storage and migrates them when the layout changes, so an upgrade carries
+// counters over instead of silently starting them from zero.
+//
+// Schema version 3, the current one, uses these keys. A {rule} hash tag
+// keeps a rule's keys on one cluster slot and lets them be tracked in the
+// rule's scope index.
+//
+//	gatify:schema:version                         schema version of the store
+//	gatify:rl:{rule}:identity                     GCRA state ("global" rule without a match)
+//	gatify:rl:{rule}:identity:window-start-ms     sliding window counters
+//	gatify:rl:{rule}:identity:burst               sliding window burst allowance in use
+//	gatify:rl:{rule}:identity:leaky               leaky bucket state
+//	gatify:rl:{rule}:identity:log                 sliding log hit times
+//	gatify:rl:{rule}:identity:shadow:algorithm    shadow limiter state, same suffixes
+//	gatify:rl:{rule}:index                        live limiter, in-flight and quota counters of the rule, for resets
+//	gatify:rl:{rule}:index:lock                   reset lock
+//	gatify:rl:ns:namespace:{rule}:...             the keys above for rules in a namespace
+//	gatify:nonce:{rule}:nonce                     replay protection nonces
+//	gatify:inflight:{rule}:identity               max_concurrency slots
+//	gatify:quota:{rule}:identity:period           quota usage, period as 2006-01 or 2006-01-02
+//	gatify:inflight|quota:ns:namespace:{rule}:... the two above for rules in a namespace
+//	gatify:rulestats:rule:matched|blocked:hour    hourly rule counters
+//	gatify:rulestats:rule:last                    last match of a rule
+//	gatify:ban:{bans}:identity                    client bans
+//	gatify:ban:{bans}:index                       current bans, for listing
+//	gatify:strikes:{client}:...                   rate limit strikes towards an automatic ban, client path escaped
+//	gatify:leader                                 leader lease
+//	gatify:emergency                              emergency throttle state
+//	gatify:reports:schedules                      report schedules
+//
+// Version 1 is the layout before versioning, whose limiter keys had no
+// hash tag: gatify:rl:rule:identity. A store without a version key is
+// taken to be version 1; migrating a store whose keys already have the
+// version 2 layout only records the version. Version 2 kept bans at
+// gatify:ban:address, outside any index.
+package keyschema
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// Current is the schema version this build reads and writes.
+const Current = 3
+
+// VersionKey holds the store's schema version.
+const VersionKey = "gatify:schema:version"
+
+const (
+	lockKey = "gatify:schema:lock"
+	// lockTTL bounds how long a crashed migration blocks the next one.
+	lockTTL = 10 * time.Minute
+)
+
+var (
+	// ErrMigrationInProgress is returned while another instance holds the
+	// migration lock.
+	ErrMigrationInProgress = errors.New("keyschema: migration already in progress")
+	// ErrNewerSchema is returned when the store was written by a newer
+	// build, which this one cannot read correctly.
+	ErrNewerSchema = errors.New("keyschema: store uses a newer key schema")
+)
+
+// Store is the storage a migration needs.
+type Store interface {
+	storage.Storage
+	storage.Mover
+}
+
+// Migration converts keys from schema version From to From+1.
+type Migration struct {
+	From        int
+	Description string
+	// Pattern selects candidate keys, as a Redis glob.
+	Pattern string
+	// Rename returns a key's name in the next version, or false to leave
+	// the key alone.
+	Rename func(key string) (string, bool)
+}
+
+// migrations holds one entry per schema change, in version order.
+var migrations = []Migration{
+	{
+		From:        1,
+		Description: "wrap limiter rule IDs in a hash tag",
+		Pattern:     "gatify:rl:*",
+		Rename:      hashTagLimiterKey,
+	},
+	{
+		From:        2,
+		Description: "move bans under a hash tag and into the ban index",
+		Pattern:     "gatify:ban:*",
+		Rename:      indexedBanKey,
+	},
+}
+
+// hashTagLimiterKey turns gatify:rl:rule:rest into gatify:rl:{rule}:rest.
+func hashTagLimiterKey(key string) (string, bool) {
+	const prefix = "gatify:rl:"
+	rest, ok := strings.CutPrefix(key, prefix)
+	if !ok || strings.ContainsAny(rest, "{}") {
+		return "", false
+	}
+	rule, identity, ok := strings.Cut(rest, ":")
+	if !ok || rule == "" {
+		return "", false
+	}
+	return prefix + "{" + rule + "}:" + identity, true
+}
+
+// indexedBanKey turns gatify:ban:address into gatify:ban:{bans}:ip:address,
+// the rule identity bans are keyed on now.
+func indexedBanKey(key string) (string, bool) {
+	const prefix = "gatify:ban:"
+	rest, ok := strings.CutPrefix(key, prefix)
+	if !ok || strings.ContainsAny(rest, "{}") {
+		return "", false
+	}
+	addr, err := netip.ParseAddr(rest)
+	if err != nil {
+		return "", false
+	}
+	return prefix + "{bans}:ip:" + addr.String(), true
+}
+
+// Pending returns the migrations that bring a store at version up to
+// Current.
+func Pending(version int) []Migration {
+	var out []Migration
+	for _, m := range migrations {
+		if m.From >= version {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Version returns the store's schema version.
+func Version(ctx context.Context, store storage.Storage) (int, error) {
+	v, err := store.Get(ctx, VersionKey)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read key schema version: %w", err)
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid key schema version %q", v)
+	}
+	return n, nil
+}
+
+// Step reports what one migration did.
+type Step struct {
+	From        int    `json:"from"`
+	Description string `json:"description"`
+	// Matched counts keys the migration renames, or would rename in a dry
+	// run. Renamed falls short of it for keys that expired meanwhile or
+	// whose new name was already taken.
+	Matched int64 `json:"matched"`
+	Renamed int64 `json:"renamed"`
+}
+
+// Result reports the outcome of Migrate.
+type Result struct {
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+	Steps []Step `json:"steps,omitempty"`
+}
+
+// Migrate brings store up to Current, one version at a time, recording
+// the version after each step so an interrupted migration resumes where
+// it stopped. A lock keeps instances starting together from migrating
+// concurrently. With dryRun set it only counts the keys it would rename.
+func Migrate(ctx context.Context, store Store, dryRun bool) (Result, error) {
+	token := lockToken()
+	held, err := store.SetNX(ctx, lockKey, token, lockTTL)
+	if err != nil {
+		return Result{}, fmt.Errorf("acquire migration lock: %w", err)
+	}
+	if !held {
+		return Result{}, ErrMigrationInProgress
+	}
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_, _ = store.CompareAndDelete(releaseCtx, lockKey, token)
+	}()
+
+	version, err := Version(ctx, store)
+	if err != nil {
+		return Result{}, err
+	}
+	res := Result{From: version, To: version}
+	if version > Current {
+		return res, fmt.Errorf("%w: version %d, this build uses %d", ErrNewerSchema, version, Current)
+	}
+
+	for _, m := range Pending(version) {
+		step, err := run(ctx, store, m, dryRun)
+		res.Steps = append(res.Steps, step)
+		if err != nil {
+			return res, fmt.Errorf("migrate key schema from version %d: %w", m.From, err)
+		}
+		res.To = m.From + 1
+		if dryRun {
+			continue
+		}
+		if err := store.Set(ctx, VersionKey, strconv.Itoa(res.To), 0); err != nil {
+			return res, fmt.Errorf("record key schema version: %w", err)
+		}
+	}
+	if version == Current && !dryRun {
+		// Stamp fresh stores so later builds know their layout.
+		if err := store.Set(ctx, VersionKey, strconv.Itoa(Current), 0); err != nil {
+			return res, fmt.Errorf("record key schema version: %w", err)
+		}
+	}
+	return res, nil
+}
+
+func run(ctx context.Context, store Store, m Migration, dryRun bool) (Step, error) {
+	step := Step{From: m.From, Description: m.Description}
+	// Keys renamed during the scan may be returned again under their new
+	// name; Rename leaves those alone.
+	err := store.ScanKeys(ctx, m.Pattern, func(key string) error {
+		to, ok := m.Rename(key)
+		if !ok {
+			return nil
+		}
+		step.Matched++
+		if dryRun {
+			return nil
+		}
+		renamed, err := store.RenameKey(ctx, key, to)
+		if err != nil {
+			return err
+		}
+		if renamed {
+			step.Renamed++
+		}
+		return nil
+	})
+	return step, err
+}
+
+func lockToken() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
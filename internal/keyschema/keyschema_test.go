@@ -0,0 +1,113 @@
+package keyschema
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestHashTagLimiterKey(t *testing.T) {
+	tests := map[string]string{
+		"gatify:rl:r1:ip:10.0.0.1":               "gatify:rl:{r1}:ip:10.0.0.1",
+		"gatify:rl:global:header:abc:1700000000": "gatify:rl:{global}:header:abc:1700000000",
+		"gatify:rl:{r1}:ip:10.0.0.1":             "",
+		"gatify:rl:{r1}:index":                   "",
+		"gatify:rl:r1":                           "",
+		"gatify:nonce:{r1}:abc":                  "",
+	}
+	for key, want := range tests {
+		got, ok := hashTagLimiterKey(key)
+		if got != want || ok != (want != "") {
+			t.Errorf("hashTagLimiterKey(%q) = %q, %v; want %q", key, got, ok, want)
+		}
+	}
+}
+
+func TestIndexedBanKey(t *testing.T) {
+	tests := map[string]string{
+		"gatify:ban:10.0.0.1":              "gatify:ban:{bans}:ip:10.0.0.1",
+		"gatify:ban:2001:db8::1":           "gatify:ban:{bans}:ip:2001:db8::1",
+		"gatify:ban:{bans}:ip:10.0.0.1":    "",
+		"gatify:ban:{bans}:index":          "",
+		"gatify:ban:header:abc":            "",
+		"gatify:strikes:{10.0.0.1}:strike": "",
+	}
+	for key, want := range tests {
+		got, ok := indexedBanKey(key)
+		if got != want || ok != (want != "") {
+			t.Errorf("indexedBanKey(%q) = %q, %v; want %q", key, got, ok, want)
+		}
+	}
+}
+
+func TestMigrateFromUnversionedStore(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	_ = store.Set(ctx, "gatify:rl:r1:ip:10.0.0.1", "41", time.Minute)
+	_ = store.Set(ctx, "gatify:rl:r1:ip:10.0.0.2:leaky", "1700000000000.000", time.Minute)
+	_ = store.Set(ctx, "gatify:rl:{r2}:ip:10.0.0.3", "7", time.Minute)
+	_ = store.Set(ctx, "gatify:emergency", "{}", 0)
+	_ = store.Set(ctx, "gatify:ban:10.0.0.4", "honeypot", time.Hour)
+
+	dry, err := Migrate(ctx, store, true)
+	if err != nil {
+		t.Fatalf("Migrate(dry run) error = %v", err)
+	}
+	if dry.From != 1 || dry.To != Current || len(dry.Steps) != 2 || dry.Steps[0].Matched != 2 || dry.Steps[0].Renamed != 0 {
+		t.Errorf("Unexpected dry run result %+v", dry)
+	}
+	if v, _ := Version(ctx, store); v != 1 {
+		t.Errorf("Expected a dry run to leave version 1, got %d", v)
+	}
+
+	res, err := Migrate(ctx, store, false)
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if res.To != Current || len(res.Steps) != 2 || res.Steps[0].Renamed != 2 || res.Steps[1].Renamed != 1 {
+		t.Errorf("Unexpected result %+v", res)
+	}
+	if v, _ := store.Get(ctx, "gatify:rl:{r1}:ip:10.0.0.1"); v != "41" {
+		t.Errorf("Expected the counter carried over, got %q", v)
+	}
+	if _, err := store.Get(ctx, "gatify:rl:r1:ip:10.0.0.1"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("Expected the old key gone, got %v", err)
+	}
+	if v, _ := Version(ctx, store); v != Current {
+		t.Errorf("Version() = %d, want %d", v, Current)
+	}
+	// Migrated counters join their rule's scope index, so resets see them.
+	if n, _ := store.DeleteIndexed(ctx, "gatify:rl:{r1}:index"); n != 2 {
+		t.Errorf("Expected 2 indexed counters, got %d", n)
+	}
+	// Migrated bans join the ban index, so listing them finds them.
+	if bans, _ := store.GetIndexed(ctx, "gatify:ban:{bans}:index"); bans["gatify:ban:{bans}:ip:10.0.0.4"] != "honeypot" {
+		t.Errorf("Expected the ban carried over, got %v", bans)
+	}
+
+	again, err := Migrate(ctx, store, false)
+	if err != nil || again.From != Current || len(again.Steps) != 0 {
+		t.Errorf("Expected a second migration to do nothing, got %+v, %v", again, err)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	_ = store.Set(ctx, VersionKey, "99", 0)
+	if _, err := Migrate(ctx, store, false); !errors.Is(err, ErrNewerSchema) {
+		t.Errorf("Expected ErrNewerSchema, got %v", err)
+	}
+}
+
+func TestMigrateHoldsLock(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	_, _ = store.SetNX(ctx, lockKey, "other", time.Minute)
+	if _, err := Migrate(ctx, store, false); !errors.Is(err, ErrMigrationInProgress) {
+		t.Errorf("Expected ErrMigrationInProgress, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+// Package leader elects a single gateway instance to run background jobs
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// leaseKey is the shared key the current leader holds.
+const leaseKey = "gatify:leader"
+
+// DefaultLeaseTTL is how long a lease survives without renewal. A crashed
+// leader is replaced within roughly this long.
+const DefaultLeaseTTL = 15 * time.Second
+
+// Elector campaigns for leadership through a lease in shared storage. The
+// holder renews it at a third of the TTL; everyone else retries to acquire
+// it on the same cadence.
+type Elector struct {
+	store storage.Storage
+	id    string
+	ttl   time.Duration
+
+	leader atomic.Bool
+	mu     sync.Mutex
+	jobs   []*job
+}
+
+// NewElector creates an Elector with a unique instance ID.
+func NewElector(store storage.Storage, ttl time.Duration) *Elector {
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+	return &Elector{store: store, id: instanceID(), ttl: ttl}
+}
+
+// ID identifies this instance in the lease.
+func (e *Elector) ID() string { return e.id }
+
+// IsLeader reports whether this instance currently holds the lease.
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run campaigns until ctx is cancelled, then releases the lease so another
+// instance can take over immediately.
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		e.campaign(ctx)
+		select {
+		case <-ctx.Done():
+			e.release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign renews the lease when held and tries to acquire it otherwise.
+// Storage errors cost leadership: without a confirmed lease another
+// instance may already be running the jobs.
+func (e *Elector) campaign(ctx context.Context) {
+	var (
+		held bool
+		err  error
+	)
+	if e.leader.Load() {
+		held, err = e.store.CompareAndExpire(ctx, leaseKey, e.id, e.ttl)
+	} else {
+		held, err = e.store.SetNX(ctx, leaseKey, e.id, e.ttl)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Leader election error: %v", err)
+		}
+		held = false
+	}
+
+	if was := e.leader.Swap(held); was != held {
+		if held {
+			log.Printf("👑 Instance %s is now the leader", e.id)
+		} else {
+			log.Printf("Instance %s lost leadership", e.id)
+		}
+	}
+}
+
+func (e *Elector) release() {
+	if !e.leader.Swap(false) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := e.store.CompareAndDelete(ctx, leaseKey, e.id); err != nil {
+		log.Printf("Failed to release leadership: %v", err)
+	}
+}
+
+type job struct {
+	name     string
+	interval time.Duration
+	fn       func(ctx context.Context) error
+}
+
+// Schedule registers fn to run every interval on the leader only. Jobs
+// start when RunJobs is called.
+func (e *Elector) Schedule(name string, interval time.Duration, fn func(ctx context.Context) error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.jobs = append(e.jobs, &job{name: name, interval: interval, fn: fn})
+}
+
+// RunJobs runs every scheduled job on its interval until ctx is cancelled.
+// Ticks on non-leader instances are skipped.
+func (e *Elector) RunJobs(ctx context.Context) {
+	e.mu.Lock()
+	jobs := append([]*job(nil), e.jobs...)
+	e.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j *job) {
+			defer wg.Done()
+			ticker := time.NewTicker(j.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					e.runOnce(ctx, j)
+				}
+			}
+		}(j)
+	}
+	wg.Wait()
+}
+
+func (e *Elector) runOnce(ctx context.Context, j *job) {
+	if !e.IsLeader() {
+		return
+	}
+	if err := j.fn(ctx); err != nil {
+		log.Printf("Background job %s failed: %v", j.name, err)
+	}
+}
+
+// instanceID combines the hostname with random bytes so restarts and
+// co-located instances never share an ID.
+func instanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "gatify"
+	}
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,140 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// leaseStore implements the lease primitives over a map, ignoring TTLs.
+type leaseStore struct {
+	storage.Storage
+	mu   sync.Mutex
+	data map[string]string
+	err  error
+}
+
+func newLeaseStore() *leaseStore {
+	return &leaseStore{data: make(map[string]string)}
+}
+
+func (s *leaseStore) SetNX(_ context.Context, key, value string, _ time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return false, s.err
+	}
+	if _, ok := s.data[key]; ok {
+		return false, nil
+	}
+	s.data[key] = value
+	return true, nil
+}
+
+func (s *leaseStore) CompareAndExpire(_ context.Context, key, value string, _ time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return false, s.err
+	}
+	return s.data[key] == value, nil
+}
+
+func (s *leaseStore) CompareAndDelete(_ context.Context, key, value string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data[key] != value {
+		return false, nil
+	}
+	delete(s.data, key)
+	return true, nil
+}
+
+func TestElectorSingleLeader(t *testing.T) {
+	store := newLeaseStore()
+	a, b := NewElector(store, time.Minute), NewElector(store, time.Minute)
+	ctx := context.Background()
+
+	a.campaign(ctx)
+	b.campaign(ctx)
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("Expected only the first instance to lead, got a=%v b=%v", a.IsLeader(), b.IsLeader())
+	}
+
+	a.campaign(ctx)
+	if !a.IsLeader() {
+		t.Error("Expected leader to keep its lease on renewal")
+	}
+
+	a.release()
+	b.campaign(ctx)
+	if a.IsLeader() || !b.IsLeader() {
+		t.Error("Expected leadership to move after release")
+	}
+}
+
+func TestElectorLosesLeadershipOnError(t *testing.T) {
+	store := newLeaseStore()
+	e := NewElector(store, time.Minute)
+	e.campaign(context.Background())
+
+	store.err = errors.New("redis down")
+	e.campaign(context.Background())
+	if e.IsLeader() {
+		t.Error("Expected storage errors to drop leadership")
+	}
+}
+
+func TestElectorLosesExpiredLease(t *testing.T) {
+	store := newLeaseStore()
+	e := NewElector(store, time.Minute)
+	e.campaign(context.Background())
+
+	// Simulate the lease expiring and another instance taking it.
+	store.data[leaseKey] = "someone-else"
+	e.campaign(context.Background())
+	if e.IsLeader() {
+		t.Error("Expected leadership to be lost when the lease changed hands")
+	}
+}
+
+func TestScheduledJobsRunOnLeaderOnly(t *testing.T) {
+	store := newLeaseStore()
+	leader, follower := NewElector(store, time.Minute), NewElector(store, time.Minute)
+	leader.campaign(context.Background())
+	follower.campaign(context.Background())
+
+	var mu sync.Mutex
+	runs := map[string]int{}
+	for _, e := range []*Elector{leader, follower} {
+		e := e
+		e.Schedule("count", time.Millisecond, func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			runs[e.ID()]++
+			return nil
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, e := range []*Elector{leader, follower} {
+		wg.Add(1)
+		go func(e *Elector) {
+			defer wg.Done()
+			e.RunJobs(ctx)
+		}(e)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if runs[leader.ID()] == 0 || runs[follower.ID()] != 0 {
+		t.Errorf("Expected jobs on the leader only, got %v", runs)
+	}
+}
@@ -1,4 +1,220 @@
 // Package limiter provides rate limiting functionality
 package limiter
 
-// TODO: Implement rate limiting algorithms
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+	"github.com/Siruyy/gatify/internal/tracing"
+)
+
+// Algorithm names accepted by New.
+const (
+	// AlgorithmSlidingWindow is the sliding window counter algorithm.
+	AlgorithmSlidingWindow = "sliding_window"
+	// AlgorithmGCRA is the generic cell rate algorithm.
+	AlgorithmGCRA = "gcra"
+	// AlgorithmLeakyBucket is the leaky bucket algorithm used as a queue.
+	AlgorithmLeakyBucket = "leaky_bucket"
+	// AlgorithmSlidingLog is the exact sliding window log algorithm.
+	AlgorithmSlidingLog = "sliding_log"
+)
+
+// DefaultLeakyBucketMaxDelay is how long the leaky bucket holds a request
+// waiting for its slot before rejecting it instead.
+const DefaultLeakyBucketMaxDelay = time.Second
+
+// Algorithms lists every algorithm name accepted by New.
+func Algorithms() []string {
+	return []string{AlgorithmSlidingWindow, AlgorithmGCRA, AlgorithmLeakyBucket, AlgorithmSlidingLog}
+}
+
+// Known reports whether New accepts the algorithm name.
+func Known(algorithm string) bool {
+	for _, name := range Algorithms() {
+		if name == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+// Result is the outcome of a rate limit check.
+type Result struct {
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	ResetAt   time.Time
+	// Delay is how long an allowed request should be held before it is
+	// forwarded, so that bursts reach the backend evenly spaced.
+	Delay time.Duration
+	// Shadow is the dark-launched algorithm's hypothetical decision for
+	// the same request, when a Shadow limiter is in use.
+	Shadow *ShadowDecision
+	// BurstRemaining is how much of the burst allowance is left, when
+	// the request was checked with storage.WithBurst.
+	BurstRemaining int64
+}
+
+// ShadowDecision is what a dark-launched algorithm would have decided.
+type ShadowDecision struct {
+	Algorithm string
+	Allowed   bool
+	Remaining int64
+}
+
+// Limiter decides whether a request identified by key may proceed.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit int64, window time.Duration) (Result, error)
+	// Algorithm returns the algorithm name reported in diagnostics.
+	Algorithm() string
+}
+
+// New returns the limiter for the named algorithm backed by store.
+func New(algorithm string, store storage.Storage) (Limiter, error) {
+	switch algorithm {
+	case AlgorithmSlidingWindow:
+		return NewSlidingWindow(store), nil
+	case AlgorithmGCRA:
+		return NewGCRA(store), nil
+	case AlgorithmLeakyBucket:
+		return NewLeakyBucket(store, DefaultLeakyBucketMaxDelay), nil
+	case AlgorithmSlidingLog:
+		return NewSlidingLog(store), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limiting algorithm %q", algorithm)
+	}
+}
+
+// SlidingWindow limits requests with a sliding window counter kept in
+// shared storage.
+type SlidingWindow struct {
+	store storage.Storage
+}
+
+// NewSlidingWindow creates a sliding window limiter backed by store.
+func NewSlidingWindow(store storage.Storage) *SlidingWindow {
+	return &SlidingWindow{store: store}
+}
+
+// Allow implements Limiter.
+func (l *SlidingWindow) Allow(ctx context.Context, key string, limit int64, window time.Duration) (Result, error) {
+	return decide(ctx, AlgorithmSlidingWindow, limit, func(ctx context.Context) (storage.WindowResult, error) {
+		return l.store.SlidingWindow(ctx, key, limit, window)
+	})
+}
+
+// Algorithm implements Limiter.
+func (l *SlidingWindow) Algorithm() string {
+	return AlgorithmSlidingWindow
+}
+
+// GCRA limits requests with the generic cell rate algorithm kept in shared
+// storage. Unlike the sliding window it spaces requests evenly instead of
+// letting a whole window's worth through at once after a quiet period.
+type GCRA struct {
+	store storage.Storage
+}
+
+// NewGCRA creates a GCRA limiter backed by store.
+func NewGCRA(store storage.Storage) *GCRA {
+	return &GCRA{store: store}
+}
+
+// Allow implements Limiter.
+func (l *GCRA) Allow(ctx context.Context, key string, limit int64, window time.Duration) (Result, error) {
+	return decide(ctx, AlgorithmGCRA, limit, func(ctx context.Context) (storage.WindowResult, error) {
+		return l.store.GCRA(ctx, key, limit, window)
+	})
+}
+
+// Algorithm implements Limiter.
+func (l *GCRA) Algorithm() string {
+	return AlgorithmGCRA
+}
+
+// LeakyBucket smooths requests with a leaky bucket kept in shared storage.
+// Where GCRA still admits a burst at once, the leaky bucket queues it and
+// has each request wait for its slot, so the backend sees at most limit per
+// window evenly spaced. Requests that would wait longer than MaxDelay are
+// rejected.
+type LeakyBucket struct {
+	store    storage.Storage
+	maxDelay time.Duration
+}
+
+// NewLeakyBucket creates a leaky bucket limiter backed by store that holds
+// requests for at most maxDelay.
+func NewLeakyBucket(store storage.Storage, maxDelay time.Duration) *LeakyBucket {
+	return &LeakyBucket{store: store, maxDelay: maxDelay}
+}
+
+// Allow implements Limiter.
+func (l *LeakyBucket) Allow(ctx context.Context, key string, limit int64, window time.Duration) (Result, error) {
+	return decide(ctx, AlgorithmLeakyBucket, limit, func(ctx context.Context) (storage.WindowResult, error) {
+		return l.store.LeakyBucket(ctx, key, limit, window, l.maxDelay)
+	})
+}
+
+// Algorithm implements Limiter.
+func (l *LeakyBucket) Algorithm() string {
+	return AlgorithmLeakyBucket
+}
+
+// SlidingLog limits requests with an exact log of request times kept in
+// shared storage. The sliding window counter assumes the previous window's
+// requests were spread evenly, which lets a burst at the end of one window
+// and the start of the next through; the log counts exactly the requests
+// in the last window, at the cost of storing each of them.
+type SlidingLog struct {
+	store storage.Storage
+}
+
+// NewSlidingLog creates a sliding log limiter backed by store.
+func NewSlidingLog(store storage.Storage) *SlidingLog {
+	return &SlidingLog{store: store}
+}
+
+// Allow implements Limiter.
+func (l *SlidingLog) Allow(ctx context.Context, key string, limit int64, window time.Duration) (Result, error) {
+	return decide(ctx, AlgorithmSlidingLog, limit, func(ctx context.Context) (storage.WindowResult, error) {
+		return l.store.SlidingLog(ctx, key, limit, window)
+	})
+}
+
+// Algorithm implements Limiter.
+func (l *SlidingLog) Algorithm() string {
+	return AlgorithmSlidingLog
+}
+
+// decide runs one storage round trip for algorithm in its own span.
+func decide(ctx context.Context, algorithm string, limit int64, call func(context.Context) (storage.WindowResult, error)) (Result, error) {
+	ctx, span := tracing.Start(ctx, "limiter "+algorithm, tracing.KindInternal)
+	defer span.End()
+	span.SetAttr("gatify.limit", limit)
+	res, err := call(ctx)
+	if err != nil {
+		span.SetError(err)
+		return Result{}, err
+	}
+	span.SetAttr("gatify.allowed", res.Allowed)
+	return fromWindow(res, limit), nil
+}
+
+func fromWindow(res storage.WindowResult, limit int64) Result {
+	remaining := limit - res.Count
+	if remaining < 0 {
+		remaining = 0
+	}
+	return Result{
+		Allowed:   res.Allowed,
+		Limit:     limit,
+		Remaining: remaining,
+		ResetAt:   res.ResetAt,
+		Delay:     res.Wait,
+
+		BurstRemaining: res.BurstRemaining,
+	}
+}
@@ -0,0 +1,132 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+type fakeStorage struct {
+	storage.Storage
+	result storage.WindowResult
+	err    error
+	key    string
+}
+
+func (f *fakeStorage) SlidingWindow(_ context.Context, key string, _ int64, _ time.Duration) (storage.WindowResult, error) {
+	f.key = key
+	return f.result, f.err
+}
+
+func (f *fakeStorage) GCRA(_ context.Context, key string, _ int64, _ time.Duration) (storage.WindowResult, error) {
+	f.key = "gcra:" + key
+	return f.result, f.err
+}
+
+func (f *fakeStorage) LeakyBucket(_ context.Context, key string, _ int64, _, _ time.Duration) (storage.WindowResult, error) {
+	f.key = "leaky:" + key
+	return f.result, f.err
+}
+
+func (f *fakeStorage) SlidingLog(_ context.Context, key string, _ int64, _ time.Duration) (storage.WindowResult, error) {
+	f.key = "log:" + key
+	return f.result, f.err
+}
+
+func TestSlidingWindowAllow(t *testing.T) {
+	reset := time.Now().Add(time.Minute)
+	store := &fakeStorage{result: storage.WindowResult{Allowed: true, Count: 3, ResetAt: reset}}
+	l := NewSlidingWindow(store)
+
+	res, err := l.Allow(context.Background(), "k", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	if !res.Allowed || res.Limit != 10 || res.Remaining != 7 || !res.ResetAt.Equal(reset) {
+		t.Errorf("Unexpected result %+v", res)
+	}
+	if store.key != "k" {
+		t.Errorf("Expected key k, got %s", store.key)
+	}
+}
+
+func TestSlidingWindowRemainingNeverNegative(t *testing.T) {
+	store := &fakeStorage{result: storage.WindowResult{Allowed: false, Count: 15}}
+	res, err := NewSlidingWindow(store).Allow(context.Background(), "k", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	if res.Allowed || res.Remaining != 0 {
+		t.Errorf("Expected rejected with 0 remaining, got %+v", res)
+	}
+}
+
+func TestSlidingWindowStorageError(t *testing.T) {
+	store := &fakeStorage{err: errors.New("down")}
+	if _, err := NewSlidingWindow(store).Allow(context.Background(), "k", 1, time.Second); err == nil {
+		t.Error("Expected storage error to propagate")
+	}
+}
+
+func TestGCRAAllow(t *testing.T) {
+	store := &fakeStorage{result: storage.WindowResult{Allowed: true, Count: 4}}
+	l := NewGCRA(store)
+
+	res, err := l.Allow(context.Background(), "k", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	if !res.Allowed || res.Remaining != 6 || store.key != "gcra:k" {
+		t.Errorf("Unexpected result %+v via %s", res, store.key)
+	}
+	if l.Algorithm() != AlgorithmGCRA {
+		t.Errorf("Algorithm() = %s", l.Algorithm())
+	}
+}
+
+func TestLeakyBucketAllow(t *testing.T) {
+	store := &fakeStorage{result: storage.WindowResult{Allowed: true, Count: 2, Wait: 300 * time.Millisecond}}
+	l := NewLeakyBucket(store, time.Second)
+
+	res, err := l.Allow(context.Background(), "k", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	if !res.Allowed || res.Remaining != 8 || res.Delay != 300*time.Millisecond || store.key != "leaky:k" {
+		t.Errorf("Unexpected result %+v via %s", res, store.key)
+	}
+	if l.Algorithm() != AlgorithmLeakyBucket {
+		t.Errorf("Algorithm() = %s", l.Algorithm())
+	}
+}
+
+func TestSlidingLogAllow(t *testing.T) {
+	store := &fakeStorage{result: storage.WindowResult{Allowed: true, Count: 4}}
+	l := NewSlidingLog(store)
+
+	res, err := l.Allow(context.Background(), "k", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	if !res.Allowed || res.Remaining != 6 || store.key != "log:k" {
+		t.Errorf("Unexpected result %+v via %s", res, store.key)
+	}
+	if l.Algorithm() != AlgorithmSlidingLog {
+		t.Errorf("Algorithm() = %s", l.Algorithm())
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, name := range Algorithms() {
+		l, err := New(name, &fakeStorage{})
+		if err != nil || l.Algorithm() != name {
+			t.Errorf("New(%s) = %v, %v", name, l, err)
+		}
+	}
+	if _, err := New("token_bucket", &fakeStorage{}); err == nil {
+		t.Error("Expected error for unknown algorithm")
+	}
+}
@@ -0,0 +1,120 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// localSweepInterval is how often Local forgets buckets that have
+// refilled completely.
+const localSweepInterval = time.Minute
+
+// Local puts a per-instance token bucket in front of another limiter. Each
+// key's bucket holds fraction of its limit and refills over the window, so
+// a client flooding one instance is rejected from memory without a round
+// trip to storage, while requests the bucket lets through are still
+// decided globally by next.
+//
+// With fraction 1 the bucket only rejects traffic this instance alone
+// has seen exceed the limit, which the global limiter would reject as
+// well. Lower fractions shed floods sooner, but cap what a client sending
+// all its traffic to one instance can use.
+type Local struct {
+	next     Limiter
+	fraction float64
+	now      func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*localBucket
+	lastSweep time.Time
+}
+
+type localBucket struct {
+	tokens   float64
+	capacity float64
+	rate     float64 // tokens per second
+	updated  time.Time
+}
+
+// NewLocal creates a Local tier with buckets holding fraction of each
+// limit, in (0, 1], in front of next.
+func NewLocal(next Limiter, fraction float64) *Local {
+	return &Local{
+		next:     next,
+		fraction: fraction,
+		now:      time.Now,
+		buckets:  make(map[string]*localBucket),
+	}
+}
+
+// Allow implements Limiter.
+func (l *Local) Allow(ctx context.Context, key string, limit int64, window time.Duration) (Result, error) {
+	if limit <= 0 || window <= 0 {
+		return l.next.Allow(ctx, key, limit, window)
+	}
+	// A burst allowance lets the shared tier admit more than limit, so
+	// the bucket holds room for it too.
+	if wait, ok := l.take(key, storage.CostFrom(ctx), limit+storage.BurstFrom(ctx), window); !ok {
+		return Result{Limit: limit, ResetAt: l.now().Add(wait)}, nil
+	}
+	return l.next.Allow(ctx, key, limit, window)
+}
+
+// take removes cost tokens from key's bucket. When the bucket holds
+// fewer it returns how long until it holds enough. A request costing more
+// than the bucket holds needs a full one.
+func (l *Local) take(key string, cost, limit int64, window time.Duration) (time.Duration, bool) {
+	now := l.now()
+	capacity := math.Max(1, math.Ceil(float64(limit)*l.fraction))
+	rate := capacity / window.Seconds()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) >= localSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &localBucket{tokens: capacity, updated: now}
+		l.buckets[key] = b
+	}
+	// Rules can change between requests; the bucket follows the limit
+	// it is asked about.
+	b.capacity, b.rate = capacity, rate
+	b.refill(now)
+	need := math.Min(float64(cost), capacity)
+	if b.tokens < need {
+		return time.Duration((need - b.tokens) / rate * float64(time.Second)), false
+	}
+	b.tokens -= need
+	return 0, true
+}
+
+// sweep drops buckets that are full again; a new bucket starts full, so
+// forgetting them changes no decision.
+func (l *Local) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= b.capacity {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (b *localBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+	}
+	b.updated = now
+}
+
+// Algorithm implements Limiter, reporting the global algorithm.
+func (l *Local) Algorithm() string {
+	return l.next.Algorithm()
+}
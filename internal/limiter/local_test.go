@@ -0,0 +1,124 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// countingStub allows everything and counts the calls reaching it.
+type countingStub struct {
+	calls int
+	err   error
+}
+
+func (s *countingStub) Allow(_ context.Context, _ string, limit int64, _ time.Duration) (Result, error) {
+	s.calls++
+	return Result{Allowed: true, Limit: limit}, s.err
+}
+
+func (s *countingStub) Algorithm() string { return "stub" }
+
+func TestLocalRejectsFloodsWithoutConsultingNext(t *testing.T) {
+	next := &countingStub{}
+	l := NewLocal(next, 0.5)
+	now := time.Unix(1_700_000_000, 0)
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if res, err := l.Allow(ctx, "k", 10, 10*time.Second); err != nil || !res.Allowed {
+			t.Fatalf("request %d: expected allowed, got %+v, %v", i, res, err)
+		}
+	}
+	res, err := l.Allow(ctx, "k", 10, 10*time.Second)
+	if err != nil || res.Allowed {
+		t.Fatalf("Expected local rejection, got %+v, %v", res, err)
+	}
+	if next.calls != 5 {
+		t.Errorf("Expected 5 calls to reach the global limiter, got %d", next.calls)
+	}
+	if res.Limit != 10 || res.Remaining != 0 || !res.ResetAt.Equal(now.Add(2*time.Second)) {
+		t.Errorf("Unexpected rejection %+v", res)
+	}
+
+	if res, _ := l.Allow(ctx, "other", 10, 10*time.Second); !res.Allowed {
+		t.Error("Expected other keys to have their own bucket")
+	}
+	now = now.Add(2 * time.Second)
+	if res, _ := l.Allow(ctx, "k", 10, 10*time.Second); !res.Allowed {
+		t.Error("Expected a token after the refill interval")
+	}
+	if l.Algorithm() != "stub" {
+		t.Errorf("Algorithm() = %s, want the global algorithm", l.Algorithm())
+	}
+}
+
+func TestLocalChargesCost(t *testing.T) {
+	next := &countingStub{}
+	l := NewLocal(next, 0.5)
+	now := time.Unix(1_700_000_000, 0)
+	l.now = func() time.Time { return now }
+	ctx := storage.WithCost(context.Background(), 3)
+
+	// The bucket holds 5 tokens and refills one every 2 seconds.
+	if res, _ := l.Allow(ctx, "k", 10, 10*time.Second); !res.Allowed {
+		t.Fatal("Expected the first request to fit the bucket")
+	}
+	res, err := l.Allow(ctx, "k", 10, 10*time.Second)
+	if err != nil || res.Allowed {
+		t.Fatalf("Expected a cost of 3 not to fit the 2 tokens left, got %+v, %v", res, err)
+	}
+	if !res.ResetAt.Equal(now.Add(2 * time.Second)) {
+		t.Errorf("ResetAt = %v, want when the third token is back", res.ResetAt)
+	}
+	if res, _ := l.Allow(context.Background(), "k", 10, 10*time.Second); !res.Allowed {
+		t.Error("Expected a plain request to fit the tokens left")
+	}
+
+	huge := storage.WithCost(context.Background(), 50)
+	if res, _ := l.Allow(huge, "full", 10, 10*time.Second); !res.Allowed {
+		t.Error("Expected a cost above the bucket's capacity to pass a full bucket")
+	}
+	if res, _ := l.Allow(context.Background(), "full", 10, 10*time.Second); res.Allowed {
+		t.Error("Expected it to empty the bucket")
+	}
+	if next.calls != 3 {
+		t.Errorf("Expected 3 calls to reach the global limiter, got %d", next.calls)
+	}
+}
+
+func TestLocalKeepsAtLeastOneToken(t *testing.T) {
+	next := &countingStub{}
+	l := NewLocal(next, 0.1)
+	if res, _ := l.Allow(context.Background(), "k", 2, time.Minute); !res.Allowed {
+		t.Error("Expected a small limit to keep one local token")
+	}
+}
+
+func TestLocalPassesErrorsThrough(t *testing.T) {
+	l := NewLocal(&countingStub{err: errors.New("down")}, 1)
+	if _, err := l.Allow(context.Background(), "k", 5, time.Second); err == nil {
+		t.Error("Expected the global limiter's error")
+	}
+}
+
+func TestLocalSweepsFullBuckets(t *testing.T) {
+	l := NewLocal(&countingStub{}, 1)
+	now := time.Unix(1_700_000_000, 0)
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	l.Allow(ctx, "idle", 5, time.Second)
+	now = now.Add(localSweepInterval)
+	l.Allow(ctx, "busy", 5, time.Hour)
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("Expected refilled bucket to be swept")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("Expected bucket in use to be kept")
+	}
+}
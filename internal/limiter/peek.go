@@ -0,0 +1,71 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// Peeker is implemented by limiters that can report a key's state without
+// counting a hit against it. Result.Allowed reports whether the next
+// request would be admitted.
+type Peeker interface {
+	Peek(ctx context.Context, key string, limit int64, window time.Duration) (Result, error)
+}
+
+// Peek reports key's state under l without counting a hit. It returns
+// false when l's algorithm cannot be read that way.
+func Peek(ctx context.Context, l Limiter, key string, limit int64, window time.Duration) (Result, bool, error) {
+	p, ok := l.(Peeker)
+	if !ok {
+		return Result{}, false, nil
+	}
+	res, err := p.Peek(ctx, key, limit, window)
+	if errors.Is(err, errNotPeekable) {
+		return Result{}, false, nil
+	}
+	return res, true, err
+}
+
+// errNotPeekable is returned by wrapping limiters whose inner limiter is
+// not a Peeker.
+var errNotPeekable = errors.New("limiter: algorithm cannot be peeked")
+
+// Peek implements Peeker.
+func (l *SlidingWindow) Peek(ctx context.Context, key string, limit int64, window time.Duration) (Result, error) {
+	res, err := storage.PeekSlidingWindow(ctx, l.store, key, limit, window, time.Now())
+	if err != nil {
+		return Result{}, err
+	}
+	return fromWindow(res, limit), nil
+}
+
+// Peek implements Peeker.
+func (l *GCRA) Peek(ctx context.Context, key string, limit int64, window time.Duration) (Result, error) {
+	res, err := storage.PeekGCRA(ctx, l.store, key, limit, window, time.Now())
+	if err != nil {
+		return Result{}, err
+	}
+	return fromWindow(res, limit), nil
+}
+
+// Peek implements Peeker, reporting the global state; the local buckets
+// are not consulted.
+func (l *Local) Peek(ctx context.Context, key string, limit int64, window time.Duration) (Result, error) {
+	return peekInner(ctx, l.next, key, limit, window)
+}
+
+// Peek implements Peeker, reporting the enforced algorithm's state.
+func (l *Shadow) Peek(ctx context.Context, key string, limit int64, window time.Duration) (Result, error) {
+	return peekInner(ctx, l.primary, key, limit, window)
+}
+
+func peekInner(ctx context.Context, next Limiter, key string, limit int64, window time.Duration) (Result, error) {
+	p, ok := next.(Peeker)
+	if !ok {
+		return Result{}, errNotPeekable
+	}
+	return p.Peek(ctx, key, limit, window)
+}
@@ -0,0 +1,40 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestPeekDoesNotCount(t *testing.T) {
+	ctx := context.Background()
+	for _, l := range []Limiter{
+		NewSlidingWindow(storage.NewMemoryStorage()),
+		NewGCRA(storage.NewMemoryStorage()),
+	} {
+		t.Run(l.Algorithm(), func(t *testing.T) {
+			wrapped := NewShadow(NewLocal(l, 1), NewGCRA(storage.NewMemoryStorage()))
+			if _, err := wrapped.Allow(ctx, "k", 2, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 3; i++ {
+				res, ok, err := Peek(ctx, wrapped, "k", 2, time.Minute)
+				if err != nil || !ok {
+					t.Fatalf("Peek() = %v, %v", ok, err)
+				}
+				if !res.Allowed || res.Remaining != 1 {
+					t.Fatalf("peek %d = %+v, want one request left", i, res)
+				}
+			}
+		})
+	}
+}
+
+func TestPeekUnsupportedAlgorithm(t *testing.T) {
+	l := NewShadow(NewSlidingLog(storage.NewMemoryStorage()), NewGCRA(storage.NewMemoryStorage()))
+	if _, ok, err := Peek(context.Background(), l, "k", 2, time.Minute); ok || err != nil {
+		t.Errorf("Peek() = %v, %v, want unsupported", ok, err)
+	}
+}
@@ -0,0 +1,54 @@
+package limiter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// ErrResetInProgress is returned when another instance is already
+// resetting the same counters.
+var ErrResetInProgress = errors.New("limiter: reset already in progress")
+
+// resetLockTTL bounds how long a crashed instance can hold a reset lock.
+const resetLockTTL = 30 * time.Second
+
+// Reset deletes every counter in the scope of key, such as all clients'
+// counters for one rule. Only the counters tracked in the scope's index
+// are touched, and a lock in shared storage keeps concurrent resets of the
+// same scope from racing each other across instances.
+func Reset(ctx context.Context, store storage.Storage, key string) (int64, error) {
+	index, ok := storage.IndexKey(key)
+	if !ok {
+		return 0, fmt.Errorf("limiter: key %q has no scope to reset", key)
+	}
+
+	lock, token := index+":lock", lockToken()
+	held, err := store.SetNX(ctx, lock, token, resetLockTTL)
+	if err != nil {
+		return 0, fmt.Errorf("acquire reset lock: %w", err)
+	}
+	if !held {
+		return 0, ErrResetInProgress
+	}
+	defer func() {
+		// Release with a fresh context so a cancelled request still
+		// frees the lock instead of waiting out its TTL.
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_, _ = store.CompareAndDelete(releaseCtx, lock, token)
+	}()
+
+	return store.DeleteIndexed(ctx, index)
+}
+
+func lockToken() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,99 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// lockStore implements the lock and index primitives over a map.
+type lockStore struct {
+	storage.Storage
+	mu      sync.Mutex
+	locks   map[string]string
+	deleted []string
+	err     error
+}
+
+func newLockStore() *lockStore {
+	return &lockStore{locks: make(map[string]string)}
+}
+
+func (s *lockStore) SetNX(_ context.Context, key, value string, _ time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.locks[key]; ok {
+		return false, nil
+	}
+	s.locks[key] = value
+	return true, nil
+}
+
+func (s *lockStore) CompareAndDelete(_ context.Context, key, value string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locks[key] != value {
+		return false, nil
+	}
+	delete(s.locks, key)
+	return true, nil
+}
+
+func (s *lockStore) DeleteIndexed(_ context.Context, index string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return 0, s.err
+	}
+	s.deleted = append(s.deleted, index)
+	return 3, nil
+}
+
+func TestResetDeletesScope(t *testing.T) {
+	store := newLockStore()
+
+	n, err := Reset(context.Background(), store, "gatify:rl:{r1}:")
+	if err != nil || n != 3 {
+		t.Fatalf("Reset() = %d, %v; want 3", n, err)
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != "gatify:rl:{r1}:index" {
+		t.Errorf("Unexpected deletions %v", store.deleted)
+	}
+	if len(store.locks) != 0 {
+		t.Errorf("Expected lock to be released, got %v", store.locks)
+	}
+}
+
+func TestResetReleasesLockOnError(t *testing.T) {
+	store := newLockStore()
+	store.err = errors.New("redis down")
+
+	if _, err := Reset(context.Background(), store, "gatify:rl:{r1}:"); err == nil {
+		t.Fatal("Expected storage error")
+	}
+	if len(store.locks) != 0 {
+		t.Errorf("Expected lock to be released, got %v", store.locks)
+	}
+}
+
+func TestResetRejectsConcurrentReset(t *testing.T) {
+	store := newLockStore()
+	store.locks["gatify:rl:{r1}:index:lock"] = "other-instance"
+
+	if _, err := Reset(context.Background(), store, "gatify:rl:{r1}:"); !errors.Is(err, ErrResetInProgress) {
+		t.Errorf("Expected ErrResetInProgress, got %v", err)
+	}
+	if len(store.deleted) != 0 {
+		t.Error("Expected no deletion without the lock")
+	}
+}
+
+func TestResetRequiresScope(t *testing.T) {
+	if _, err := Reset(context.Background(), newLockStore(), "gatify:rl:global:"); err == nil {
+		t.Error("Expected error for an unscoped key")
+	}
+}
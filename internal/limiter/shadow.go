@@ -0,0 +1,55 @@
+package limiter
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Shadow enforces the primary limiter while evaluating a candidate
+// algorithm on the same traffic, so its decisions can be compared before
+// switching over. The candidate counts under its own keys and its errors
+// never affect the request.
+type Shadow struct {
+	primary   Limiter
+	candidate Limiter
+}
+
+// NewShadow creates a limiter that enforces primary and dark-launches
+// candidate.
+func NewShadow(primary, candidate Limiter) *Shadow {
+	return &Shadow{primary: primary, candidate: candidate}
+}
+
+// Allow implements Limiter. Both algorithms are evaluated concurrently so
+// the candidate adds no latency beyond the slower of the two.
+func (l *Shadow) Allow(ctx context.Context, key string, limit int64, window time.Duration) (Result, error) {
+	shadowKey := key + ":shadow:" + l.candidate.Algorithm()
+	done := make(chan *ShadowDecision, 1)
+	go func() {
+		res, err := l.candidate.Allow(ctx, shadowKey, limit, window)
+		if err != nil {
+			log.Printf("Shadow limiter %s error for %s: %v", l.candidate.Algorithm(), key, err)
+			done <- nil
+			return
+		}
+		done <- &ShadowDecision{
+			Algorithm: l.candidate.Algorithm(),
+			Allowed:   res.Allowed,
+			Remaining: res.Remaining,
+		}
+	}()
+
+	res, err := l.primary.Allow(ctx, key, limit, window)
+	shadow := <-done
+	if err != nil {
+		return Result{}, err
+	}
+	res.Shadow = shadow
+	return res, nil
+}
+
+// Algorithm implements Limiter, reporting the enforced algorithm.
+func (l *Shadow) Algorithm() string {
+	return l.primary.Algorithm()
+}
@@ -0,0 +1,63 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// stubLimiter returns a fixed decision and records the key it was asked
+// about.
+type stubLimiter struct {
+	name    string
+	allowed bool
+	err     error
+	key     string
+}
+
+func (s *stubLimiter) Allow(_ context.Context, key string, limit int64, _ time.Duration) (Result, error) {
+	s.key = key
+	if s.err != nil {
+		return Result{}, s.err
+	}
+	return Result{Allowed: s.allowed, Limit: limit}, nil
+}
+
+func (s *stubLimiter) Algorithm() string { return s.name }
+
+func TestShadowRecordsCandidateDecision(t *testing.T) {
+	primary := &stubLimiter{name: AlgorithmSlidingWindow, allowed: true}
+	candidate := &stubLimiter{name: AlgorithmGCRA, allowed: false}
+	l := NewShadow(primary, candidate)
+
+	res, err := l.Allow(context.Background(), "gatify:rl:r1:ip:1.2.3.4", 5, time.Minute)
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	if !res.Allowed {
+		t.Error("Expected the primary decision to be enforced")
+	}
+	if res.Shadow == nil || res.Shadow.Allowed || res.Shadow.Algorithm != AlgorithmGCRA {
+		t.Errorf("Unexpected shadow decision %+v", res.Shadow)
+	}
+	if primary.key != "gatify:rl:r1:ip:1.2.3.4" || candidate.key != "gatify:rl:r1:ip:1.2.3.4:shadow:gcra" {
+		t.Errorf("Unexpected keys %s / %s", primary.key, candidate.key)
+	}
+	if l.Algorithm() != AlgorithmSlidingWindow {
+		t.Errorf("Algorithm() = %s, want the enforced algorithm", l.Algorithm())
+	}
+}
+
+func TestShadowIgnoresCandidateErrors(t *testing.T) {
+	l := NewShadow(&stubLimiter{name: "a", allowed: true}, &stubLimiter{name: "b", err: errors.New("boom")})
+	res, err := l.Allow(context.Background(), "k", 1, time.Second)
+	if err != nil || !res.Allowed || res.Shadow != nil {
+		t.Errorf("Expected candidate error to be ignored, got %+v, %v", res, err)
+	}
+
+	l = NewShadow(&stubLimiter{name: "a", err: errors.New("down")}, &stubLimiter{name: "b"})
+	if _, err := l.Allow(context.Background(), "k", 1, time.Second); err == nil {
+		t.Error("Expected primary error to propagate")
+	}
+}
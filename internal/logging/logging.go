@@ -0,0 +1,88 @@
+// Package logging filters the gateway's standard log output by level
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is the minimum severity written by a Filter.
+type Level int32
+
+// Levels accepted in LOG_LEVEL, least severe first.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("Level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses a LOG_LEVEL value, case-insensitively.
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(strings.TrimSpace(s), name) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q: use %s", s, strings.Join(levelNames, ", "))
+}
+
+// Filter is an io.Writer for the standard logger that drops lines below
+// its level. Gatify marks warnings with ⚠️ and errors with ❌, and
+// reports failures with lines starting "Failed"; everything else is
+// informational. The level can be changed while logging.
+type Filter struct {
+	w     io.Writer
+	level atomic.Int32
+}
+
+// NewFilter creates a Filter writing to w.
+func NewFilter(w io.Writer, level Level) *Filter {
+	f := &Filter{w: w}
+	f.SetLevel(level)
+	return f
+}
+
+// SetLevel changes the minimum level written.
+func (f *Filter) SetLevel(l Level) {
+	f.level.Store(int32(l))
+}
+
+// Level returns the minimum level written.
+func (f *Filter) Level() Level {
+	return Level(f.level.Load())
+}
+
+// Write implements io.Writer. The standard logger writes one line per
+// call, prefixed with the date and time.
+func (f *Filter) Write(p []byte) (int, error) {
+	if classify(p) < f.Level() {
+		return len(p), nil
+	}
+	return f.w.Write(p)
+}
+
+func classify(line []byte) Level {
+	switch {
+	case bytes.Contains(line, []byte("❌")):
+		return LevelError
+	case bytes.Contains(line, []byte("⚠️")):
+		return LevelWarn
+	case bytes.Contains(line, []byte(" Failed ")) || bytes.HasPrefix(line, []byte("Failed ")):
+		return LevelError
+	default:
+		return LevelInfo
+	}
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Level
+	}{{"debug", LevelDebug}, {"INFO", LevelInfo}, {" warn", LevelWarn}, {"error", LevelError}} {
+		if got, err := ParseLevel(tc.in); err != nil || got != tc.want {
+			t.Errorf("ParseLevel(%q) = %v, %v", tc.in, got, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Expected an unknown level to be rejected")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	var buf bytes.Buffer
+	f := NewFilter(&buf, LevelInfo)
+	logger := log.New(f, "", log.LstdFlags)
+
+	logger.Printf("✅ Gatify listening on :3000")
+	logger.Printf("⚠️  Redis unreachable")
+	logger.Printf("❌ Invalid configuration")
+	logger.Printf("Failed to write response: broken pipe")
+	if n := bytes.Count(buf.Bytes(), []byte("\n")); n != 4 {
+		t.Fatalf("Expected every line at info, got %d:\n%s", n, buf.String())
+	}
+
+	buf.Reset()
+	f.SetLevel(LevelWarn)
+	logger.Printf("✅ Gatify listening on :3000")
+	logger.Printf("⚠️  Redis unreachable")
+	if got := buf.String(); bytes.Contains(buf.Bytes(), []byte("listening")) || !bytes.Contains(buf.Bytes(), []byte("Redis")) {
+		t.Errorf("Expected only the warning at warn, got %q", got)
+	}
+
+	buf.Reset()
+	f.SetLevel(LevelError)
+	logger.Printf("⚠️  Redis unreachable")
+	logger.Printf("Failed to write response: broken pipe")
+	if got := buf.String(); bytes.Contains(buf.Bytes(), []byte("Redis")) || !bytes.Contains(buf.Bytes(), []byte("Failed")) {
+		t.Errorf("Expected only the error at error, got %q", got)
+	}
+}
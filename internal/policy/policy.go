@@ -0,0 +1,93 @@
+// Package policy manages named limit sets that many rules can share, so an
+// operator defines a tier such as "free-tier" (100 requests a minute and
+// 10k a day) once and attaches it to every path pattern it covers.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/quota"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// maxDescriptionLength bounds the free-form note kept with a policy.
+const maxDescriptionLength = 256
+
+// Policy is a named limit set. Rules reference it by name.
+type Policy struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Limit and WindowSeconds are the rate limit of attached rules.
+	Limit         int64 `json:"limit"`
+	WindowSeconds int64 `json:"window_seconds"`
+	// Quota and QuotaPeriod are the long-horizon quota of attached rules.
+	// Zero means no quota.
+	Quota       int64     `json:"quota,omitempty"`
+	QuotaPeriod string    `json:"quota_period,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Normalize canonicalizes the policy before storage.
+func (p *Policy) Normalize() {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Description = strings.TrimSpace(p.Description)
+	p.QuotaPeriod = strings.ToLower(strings.TrimSpace(p.QuotaPeriod))
+	if p.Quota > 0 && p.QuotaPeriod == "" {
+		p.QuotaPeriod = quota.PeriodMonth
+	}
+}
+
+// Validate reports whether the policy can be enforced.
+func (p *Policy) Validate() error {
+	if !rules.ValidPolicyName(p.Name) {
+		return fmt.Errorf("invalid name %q: use letters, digits, - and _", p.Name)
+	}
+	if p.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	if p.WindowSeconds <= 0 {
+		return errors.New("window_seconds must be positive")
+	}
+	if p.Quota < 0 {
+		return errors.New("quota must not be negative")
+	}
+	if p.Quota > 0 && !quota.Known(p.QuotaPeriod) {
+		return fmt.Errorf("quota_period must be %q or %q", quota.PeriodDay, quota.PeriodMonth)
+	}
+	if p.Quota == 0 && p.QuotaPeriod != "" {
+		return errors.New("quota_period requires quota")
+	}
+	if len(p.Description) > maxDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", maxDescriptionLength)
+	}
+	return nil
+}
+
+// Resolve returns list with the limits of each rule's policy filled in.
+// Rules naming a policy missing from policies are disabled, so they never
+// run with no limit at all; the enabled ones among them are returned as
+// they were stored.
+func Resolve(list []rules.Rule, policies []Policy) (resolved, disabled []rules.Rule) {
+	byName := make(map[string]Policy, len(policies))
+	for _, p := range policies {
+		byName[p.Name] = p
+	}
+	resolved = make([]rules.Rule, len(list))
+	for i, r := range list {
+		if r.Policy != "" {
+			if p, ok := byName[r.Policy]; ok {
+				r.Limit, r.WindowSeconds = p.Limit, p.WindowSeconds
+				r.Quota, r.QuotaPeriod = p.Quota, p.QuotaPeriod
+			} else if r.Enabled {
+				disabled = append(disabled, r)
+				r.Enabled = false
+			}
+		}
+		resolved[i] = r
+	}
+	return resolved, disabled
+}
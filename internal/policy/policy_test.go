@@ -0,0 +1,66 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	valid := func() Policy {
+		return Policy{Name: "free-tier", Limit: 100, WindowSeconds: 60, Quota: 10000, QuotaPeriod: "day"}
+	}
+	tests := []struct {
+		name   string
+		mutate func(*Policy)
+	}{
+		{"bad name", func(p *Policy) { p.Name = "free tier" }},
+		{"zero limit", func(p *Policy) { p.Limit = 0 }},
+		{"zero window", func(p *Policy) { p.WindowSeconds = 0 }},
+		{"negative quota", func(p *Policy) { p.Quota = -1 }},
+		{"unknown quota period", func(p *Policy) { p.QuotaPeriod = "week" }},
+		{"quota period without quota", func(p *Policy) { p.Quota = 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.mutate(&p)
+			if err := p.Validate(); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+	p := valid()
+	if err := p.Validate(); err != nil {
+		t.Errorf("Expected valid policy, got %v", err)
+	}
+
+	p = Policy{Name: " pro ", Limit: 1000, WindowSeconds: 60, Quota: 1000000}
+	p.Normalize()
+	if p.Name != "pro" || p.QuotaPeriod != "month" {
+		t.Errorf("Normalize() = %+v", p)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	policies := []Policy{{Name: "free-tier", Limit: 100, WindowSeconds: 60, Quota: 10000, QuotaPeriod: "day"}}
+	list := []rules.Rule{
+		{ID: "search", Pattern: "/search", Policy: "free-tier", Enabled: true},
+		{ID: "login", Pattern: "/login", Limit: 5, WindowSeconds: 60, Enabled: true},
+		{ID: "orphan", Pattern: "/orphan", Policy: "gone", Enabled: true},
+	}
+
+	resolved, disabled := Resolve(list, policies)
+	if r := resolved[0]; r.Limit != 100 || r.WindowSeconds != 60 || r.Quota != 10000 || r.QuotaPeriod != "day" {
+		t.Errorf("Expected the policy's limits, got %+v", r)
+	}
+	if r := resolved[1]; r.Limit != 5 || r.WindowSeconds != 60 {
+		t.Errorf("Expected the rule's own limits kept, got %+v", r)
+	}
+	if resolved[2].Enabled || len(disabled) != 1 || disabled[0].ID != "orphan" || !disabled[0].Enabled {
+		t.Errorf("Expected the rule with a missing policy disabled, got %+v and %+v", resolved[2], disabled)
+	}
+	if list[0].Limit != 0 {
+		t.Error("Resolve modified its input")
+	}
+}
@@ -0,0 +1,137 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a policy does not exist.
+	ErrNotFound = errors.New("policy not found")
+	// ErrExists is returned when creating a policy whose name is taken.
+	ErrExists = errors.New("a policy with this name already exists")
+)
+
+// Repository persists policies, keyed by name.
+type Repository interface {
+	List(ctx context.Context) ([]Policy, error)
+	Get(ctx context.Context, name string) (Policy, error)
+	Create(ctx context.Context, p Policy) (Policy, error)
+	Update(ctx context.Context, p Policy) (Policy, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// InMemoryRepository is a Repository backed by a map, persisted through
+// snapshots like the rules repository. It is safe for concurrent use.
+type InMemoryRepository struct {
+	mu       sync.RWMutex
+	policies map[string]Policy
+	// changes counts mutations so snapshots are only written when there
+	// is something new to save.
+	changes uint64
+	now     func() time.Time
+}
+
+// NewInMemoryRepository creates an empty in-memory repository.
+func NewInMemoryRepository() *InMemoryRepository {
+	return &InMemoryRepository{policies: make(map[string]Policy), now: time.Now}
+}
+
+// List returns all policies ordered by name.
+func (r *InMemoryRepository) List(_ context.Context) ([]Policy, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]Policy, 0, len(r.policies))
+	for _, p := range r.policies {
+		out = append(out, p)
+	}
+	sortPolicies(out)
+	return out, nil
+}
+
+// Get returns the policy with the given name.
+func (r *InMemoryRepository) Get(_ context.Context, name string) (Policy, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.policies[name]
+	if !ok {
+		return Policy{}, ErrNotFound
+	}
+	return p, nil
+}
+
+// Create stores a new policy, assigning its timestamps.
+func (r *InMemoryRepository) Create(_ context.Context, p Policy) (Policy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.policies[p.Name]; ok {
+		return Policy{}, ErrExists
+	}
+	now := r.now().UTC()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	r.policies[p.Name] = p
+	r.changes++
+	return p, nil
+}
+
+// Update replaces an existing policy, preserving its creation time.
+func (r *InMemoryRepository) Update(_ context.Context, p Policy) (Policy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.policies[p.Name]
+	if !ok {
+		return Policy{}, ErrNotFound
+	}
+	p.CreatedAt = existing.CreatedAt
+	p.UpdatedAt = r.now().UTC()
+	r.policies[p.Name] = p
+	r.changes++
+	return p, nil
+}
+
+// Delete removes the policy with the given name.
+func (r *InMemoryRepository) Delete(_ context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.policies[name]; !ok {
+		return ErrNotFound
+	}
+	delete(r.policies, name)
+	r.changes++
+	return nil
+}
+
+// Replace makes the repository hold exactly policies, keeping their
+// timestamps, as a standby mirroring its primary does. It reports whether
+// anything changed.
+func (r *InMemoryRepository) Replace(policies []Policy) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next := make(map[string]Policy, len(policies))
+	changed := len(policies) != len(r.policies)
+	for _, p := range policies {
+		next[p.Name] = p
+		if existing, ok := r.policies[p.Name]; !ok || !existing.UpdatedAt.Equal(p.UpdatedAt) {
+			changed = true
+		}
+	}
+	if changed {
+		r.policies = next
+		r.changes++
+	}
+	return changed
+}
+
+func sortPolicies(policies []Policy) {
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+}
@@ -0,0 +1,62 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepositoryCRUD(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryRepository()
+
+	created, err := repo.Create(ctx, Policy{Name: "free-tier", Limit: 100, WindowSeconds: 60})
+	if err != nil || created.CreatedAt.IsZero() {
+		t.Fatalf("Create() = %+v, %v", created, err)
+	}
+	if _, err := repo.Create(ctx, Policy{Name: "free-tier", Limit: 5, WindowSeconds: 1}); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected ErrExists, got %v", err)
+	}
+
+	created.Limit = 200
+	updated, err := repo.Update(ctx, created)
+	if err != nil || updated.Limit != 200 || !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("Update() = %+v, %v", updated, err)
+	}
+	if _, err := repo.Update(ctx, Policy{Name: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	if err := repo.Delete(ctx, "free-tier"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := repo.Get(ctx, "free-tier"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "policies.json")
+
+	repo := NewInMemoryRepository()
+	_, _ = repo.Create(ctx, Policy{Name: "pro", Description: "paying customers", Limit: 1000, WindowSeconds: 60})
+	if err := repo.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+
+	restored := NewInMemoryRepository()
+	if err := restored.LoadSnapshot(path); err != nil {
+		t.Fatalf("LoadSnapshot() error = %v", err)
+	}
+	got, err := restored.Get(ctx, "pro")
+	if err != nil || got.Limit != 1000 || got.Description != "paying customers" {
+		t.Errorf("Restored policy = %+v, %v", got, err)
+	}
+
+	if err := restored.LoadSnapshot(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", err)
+	}
+}
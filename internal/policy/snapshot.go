@@ -0,0 +1,89 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/snapshot"
+)
+
+// snapshotFile is the on-disk form of an InMemoryRepository.
+type snapshotFile struct {
+	SavedAt  time.Time `json:"saved_at"`
+	Policies []Policy  `json:"policies"`
+}
+
+// SaveSnapshot writes every policy to path as JSON. The file is replaced
+// atomically, so a crash mid-write leaves the previous snapshot intact.
+func (r *InMemoryRepository) SaveSnapshot(path string) error {
+	_, err := r.saveSnapshot(path)
+	return err
+}
+
+func (r *InMemoryRepository) saveSnapshot(path string) (uint64, error) {
+	r.mu.RLock()
+	snap := snapshotFile{SavedAt: r.now().UTC(), Policies: make([]Policy, 0, len(r.policies))}
+	for _, p := range r.policies {
+		snap.Policies = append(snap.Policies, p)
+	}
+	changes := r.changes
+	r.mu.RUnlock()
+
+	sortPolicies(snap.Policies)
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("encode policy snapshot: %w", err)
+	}
+
+	if err := snapshot.WriteFile(path, data); err != nil {
+		return 0, fmt.Errorf("write policy snapshot: %w", err)
+	}
+	return changes, nil
+}
+
+// LoadSnapshot replaces the repository's contents with the snapshot at
+// path. A missing file is reported as an error satisfying
+// errors.Is(err, fs.ErrNotExist).
+func (r *InMemoryRepository) LoadSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read policy snapshot: %w", err)
+	}
+	var snap snapshotFile
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode policy snapshot %s: %w", path, err)
+	}
+
+	policies := make(map[string]Policy, len(snap.Policies))
+	for _, p := range snap.Policies {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("decode policy snapshot %s: policy %q: %w", path, p.Name, err)
+		}
+		policies[p.Name] = p
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policies = policies
+	r.changes = 0
+	return nil
+}
+
+// RunSnapshots saves the repository to path every interval while it has
+// unsaved changes, until ctx is cancelled.
+func (r *InMemoryRepository) RunSnapshots(ctx context.Context, path string, interval time.Duration) {
+	snapshot.Run(ctx, "policies", interval, r.changeCount, func() (uint64, error) {
+		return r.saveSnapshot(path)
+	})
+}
+
+// changeCount returns the number of changes made to the repository since
+// it was created or last loaded.
+func (r *InMemoryRepository) changeCount() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.changes
+}
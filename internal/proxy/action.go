@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// BlockReasonRuleBlock marks requests rejected by a rule's block action.
+const BlockReasonRuleBlock = "rule_block"
+
+// answersItself reports whether the matched rule's action answers the
+// requests it admits, so they need no backend.
+func answersItself(d Decision) bool {
+	return d.Rule != nil && d.Rule.Action.Responds()
+}
+
+// writeAction answers a request with a rule's action and returns the
+// number of body bytes written.
+func writeAction(w http.ResponseWriter, a *rules.RuleAction) int64 {
+	if a.Type == rules.ActionRedirect {
+		w.Header().Set("Location", a.URL)
+		w.WriteHeader(a.Status)
+		return 0
+	}
+	if a.Body == "" {
+		if a.Type == rules.ActionBlock {
+			writeJSONError(w, a.Status, strings.ToLower(http.StatusText(a.Status)))
+			return 0
+		}
+		w.WriteHeader(a.Status)
+		return 0
+	}
+	w.Header().Set("Content-Type", a.ContentType)
+	w.WriteHeader(a.Status)
+	n, err := w.Write([]byte(a.Body))
+	if err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+	return int64(n)
+}
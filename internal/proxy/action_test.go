@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+func TestProxyRuleActions(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) { o.DefaultLimit = 100 })
+	var events []Event
+	p.opts.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	p.SetRules([]rules.Rule{
+		{ID: "block", Name: "block", Pattern: "/internal/*", Limit: 1, WindowSeconds: 60, Enabled: true,
+			Action: &rules.RuleAction{Type: rules.ActionBlock, Status: http.StatusForbidden}},
+		{ID: "moved", Name: "moved", Pattern: "/v1/*", Limit: 100, WindowSeconds: 60, Enabled: true,
+			Action: &rules.RuleAction{Type: rules.ActionRedirect, Status: http.StatusMovedPermanently, URL: "https://api.example.com/v2/"}},
+		{ID: "mock", Name: "mock", Pattern: "/status", Limit: 2, WindowSeconds: 60, Enabled: true,
+			Action: &rules.RuleAction{Type: rules.ActionMock, Status: http.StatusOK, Body: `{"status":"ok"}`, ContentType: "application/json"}},
+	})
+
+	// Blocks ignore the limit of 1: every request is rejected with 403.
+	for i := 0; i < 2; i++ {
+		if w := serve(p, "GET", "/internal/admin", nil); w.Code != http.StatusForbidden || w.Body.String() != `{"error":"forbidden"}` {
+			t.Fatalf("Expected block %d to answer 403, got %d %s", i, w.Code, w.Body)
+		}
+	}
+
+	w := serve(p, "GET", "/v1/users", nil)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "https://api.example.com/v2/" {
+		t.Fatalf("Expected a redirect, got %d %v", w.Code, w.Header())
+	}
+
+	w = serve(p, "GET", "/status", nil)
+	if w.Code != http.StatusOK || w.Body.String() != `{"status":"ok"}` || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected the mock response, got %d %v %s", w.Code, w.Header(), w.Body)
+	}
+	serve(p, "GET", "/status", nil)
+	if w := serve(p, "GET", "/status", nil); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected mocks to be rate limited, got %d", w.Code)
+	}
+
+	if len(events) != 6 || events[0].BlockReason != BlockReasonRuleBlock || events[0].Allowed ||
+		!events[2].Allowed || events[2].Status != http.StatusMovedPermanently || events[3].Bytes != 15 {
+		t.Errorf("Unexpected events %+v", events)
+	}
+}
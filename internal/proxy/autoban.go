@@ -0,0 +1,22 @@
+package proxy
+
+import (
+	"log"
+	"net/http"
+)
+
+// strike counts a rate limited request towards its client's automatic
+// ban. A failure to count it is logged and the request is only rate
+// limited.
+func (p *GatewayProxy) strike(r *http.Request, d Decision) {
+	if p.opts.Bans == nil || !p.opts.AutoBan.Enabled() {
+		return
+	}
+	client, ok := p.banClient(r, d)
+	if !ok {
+		return
+	}
+	if _, err := p.opts.Bans.Strike(r.Context(), client, p.opts.AutoBan); err != nil {
+		log.Printf("Failed to count rate limit strike for %s: %v", client, err)
+	}
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/ban"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestProxyBansRepeatedlyRateLimitedClients(t *testing.T) {
+	bans := ban.New(storage.NewMemoryStorage())
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.DefaultLimit = 1
+		o.Bans = bans
+		o.AutoBan = ban.Policy{Strikes: 2, Window: time.Minute, Duration: time.Hour}
+	})
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusForbidden} {
+		if w := serve(p, "GET", "/api/items", nil); w.Code != want {
+			t.Fatalf("request %d: expected %d, got %d", i, want, w.Code)
+		}
+	}
+	reason, banned, _ := bans.Banned(context.Background(), "ip:10.0.0.1")
+	if !banned || reason != ban.ReasonRateLimit {
+		t.Fatalf("Expected a rate limit ban, got %q %v", reason, banned)
+	}
+
+	if _, err := bans.Lift(context.Background(), "ip:10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	// The lift also forgets the strikes, so the next one does not ban.
+	if w := serve(p, "GET", "/api/items", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a lifted client to be rate limited again, got %d", w.Code)
+	}
+	if w := serve(p, "GET", "/api/items", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a lifted client to start over, got %d", w.Code)
+	}
+}
+
+func TestProxyBansRuleIdentitiesBehindOneAddress(t *testing.T) {
+	bans := ban.New(storage.NewMemoryStorage())
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.Bans = bans
+		o.AutoBan = ban.Policy{Strikes: 1, Window: time.Minute, Duration: time.Hour}
+	})
+	p.SetRules([]rules.Rule{{ID: "r1", Name: "keys", Pattern: "/api/*", Limit: 1, WindowSeconds: 60,
+		IdentifyBy: rules.IdentifyByHeader, HeaderName: "X-Api-Key", Enabled: true}})
+
+	// Both keys share the NAT address 10.0.0.1.
+	noisy := map[string]string{"X-Api-Key": "noisy"}
+	serve(p, "GET", "/api/items", noisy)
+	if w := serve(p, "GET", "/api/items", noisy); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the noisy key rate limited, got %d", w.Code)
+	}
+	if w := serve(p, "GET", "/api/items", noisy); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected the noisy key banned, got %d", w.Code)
+	}
+	if w := serve(p, "GET", "/api/items", map[string]string{"X-Api-Key": "quiet"}); w.Code != http.StatusOK {
+		t.Errorf("Expected another key behind the same address served, got %d", w.Code)
+	}
+	if _, banned, _ := bans.Banned(context.Background(), "header:noisy"); !banned {
+		t.Error("Expected the ban keyed on the header identity")
+	}
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBackendBackoff applies when the backend answers 429 without a
+// usable Retry-After header.
+const defaultBackendBackoff = time.Second
+
+// penaltyBox holds temporary, instance-local blocks on limiter keys that
+// the backend asked to back off. Entries expire on their own; expired ones
+// are swept lazily on insert.
+type penaltyBox struct {
+	mu      sync.Mutex
+	until   map[string]time.Time
+	nextGC  time.Time
+	maxWait time.Duration
+}
+
+func newPenaltyBox(maxWait time.Duration) *penaltyBox {
+	return &penaltyBox{until: make(map[string]time.Time), maxWait: maxWait}
+}
+
+// penalize blocks key for wait, capped at the box's maximum. An existing
+// longer penalty is kept.
+func (b *penaltyBox) penalize(key string, wait time.Duration, now time.Time) {
+	if wait <= 0 {
+		return
+	}
+	if b.maxWait > 0 && wait > b.maxWait {
+		wait = b.maxWait
+	}
+	until := now.Add(wait)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until.After(b.until[key]) {
+		b.until[key] = until
+	}
+	if now.After(b.nextGC) {
+		for k, t := range b.until {
+			if !t.After(now) {
+				delete(b.until, k)
+			}
+		}
+		b.nextGC = now.Add(time.Minute)
+	}
+}
+
+// blocked returns when the penalty on key lifts, if one is active.
+func (b *penaltyBox) blocked(key string, now time.Time) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	until, ok := b.until[key]
+	if !ok || !until.After(now) {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// backendBackoff reports how long the backend asked clients to wait, based
+// on a 429 status or a Retry-After header.
+func backendBackoff(resp *http.Response, now time.Time) (time.Duration, bool) {
+	wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	if ok {
+		return wait, true
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return defaultBackendBackoff, true
+	}
+	return 0, false
+}
+
+// parseRetryAfter accepts both Retry-After forms: delay-seconds and an
+// HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs <= 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil || !t.After(now) {
+		return 0, false
+	}
+	return t.Sub(now), true
+}
+
+// observeBackend records a penalty for the request's limiter key when the
+// backend signals it is overloaded. It runs as the reverse proxy's
+// ModifyResponse hook.
+func (p *GatewayProxy) observeBackend(resp *http.Response) error {
+	if p.penalties == nil || resp.Request == nil {
+		return nil
+	}
+	d, ok := DecisionFromContext(resp.Request.Context())
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	if wait, ok := backendBackoff(resp, now); ok {
+		p.penalties.penalize(d.Key, wait, now)
+	}
+	return nil
+}
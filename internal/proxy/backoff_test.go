@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"30", 30 * time.Second, true},
+		{" 5 ", 5 * time.Second, true},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{"", 0, false},
+		{"0", 0, false},
+		{"-3", 0, false},
+		{"soon", 0, false},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPenaltyBox(t *testing.T) {
+	now := time.Now()
+	b := newPenaltyBox(10 * time.Second)
+
+	b.penalize("k", time.Hour, now)
+	until, ok := b.blocked("k", now)
+	if !ok || until != now.Add(10*time.Second) {
+		t.Errorf("Expected penalty capped at 10s, got %v %v", until.Sub(now), ok)
+	}
+
+	b.penalize("k", time.Second, now)
+	if until, _ := b.blocked("k", now); until != now.Add(10*time.Second) {
+		t.Error("Expected shorter penalty not to shorten an existing one")
+	}
+
+	if _, ok := b.blocked("k", now.Add(11*time.Second)); ok {
+		t.Error("Expected penalty to expire")
+	}
+	if _, ok := b.blocked("other", now); ok {
+		t.Error("Expected unrelated key to be unaffected")
+	}
+}
+
+func TestProxyHonorsBackendLimits(t *testing.T) {
+	var hits int
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path == "/busy" {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	u, _ := url.Parse(backend.URL)
+	p := New(Options{
+		Backend:            u,
+		Limiter:            newCountingLimiter(),
+		DefaultLimit:       100,
+		DefaultWindow:      time.Minute,
+		HonorBackendLimits: true,
+	})
+
+	if w := serve(p, "GET", "/busy", nil); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected backend 429 to pass through, got %d", w.Code)
+	}
+
+	w := serve(p, "GET", "/other", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected gateway to hold back the client, got %d", w.Code)
+	}
+	if ra := w.Header().Get("Retry-After"); ra != "30" {
+		t.Errorf("Retry-After = %q, want 30", ra)
+	}
+	if hits != 1 {
+		t.Errorf("Expected penalized request not to reach backend, got %d hits", hits)
+	}
+
+	other := serve(p, "GET", "/other", map[string]string{"X-Forwarded-For": "1.2.3.4"})
+	if other.Code != http.StatusTooManyRequests {
+		// TrustProxy is off, so the forwarded address is ignored and the
+		// same client is still penalized.
+		t.Errorf("Expected same client to remain penalized, got %d", other.Code)
+	}
+}
+
+func TestProxyIgnoresBackendLimitsByDefault(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer backend.Close()
+
+	u, _ := url.Parse(backend.URL)
+	p := New(Options{Backend: u, Limiter: newCountingLimiter(), DefaultLimit: 100, DefaultWindow: time.Minute})
+
+	serve(p, "GET", "/", nil)
+	w := serve(p, "GET", "/", nil)
+	if w.Header().Get("X-RateLimit-Remaining") != "98" {
+		t.Errorf("Expected request to reach the limiter, got headers %v", w.Header())
+	}
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// Budget is a client's standing against one rule's limit.
+type Budget struct {
+	// RuleID is empty for the default limit.
+	RuleID        string `json:"rule_id"`
+	RuleName      string `json:"rule_name,omitempty"`
+	Key           string `json:"key"`
+	Algorithm     string `json:"algorithm"`
+	Limit         int64  `json:"limit"`
+	WindowSeconds int64  `json:"window_seconds"`
+	// Counter is nil for algorithms that cannot be read without counting
+	// a request.
+	Counter *Counter `json:"counter,omitempty"`
+}
+
+// Budgets reads, without counting anything, what is left of the client
+// identity's budget under each of ruleIDs, with "" naming the default
+// limit. Rules that are no longer enabled are skipped.
+func (p *GatewayProxy) Budgets(ctx context.Context, identity string, ruleIDs []string) ([]Budget, error) {
+	live := p.live.Load()
+	matcher := p.matcher.Load()
+	out := make([]Budget, 0, len(ruleIDs))
+	for _, id := range ruleIDs {
+		limit, window := live.DefaultLimit, live.DefaultWindow
+		b := Budget{RuleID: id}
+		var rule *rules.Rule
+		if id != "" {
+			r, ok := matcher.Rule(id)
+			if !ok {
+				continue
+			}
+			rule = &r
+			b.RuleName = r.Name
+			limit, window = r.Limit, r.Window()
+		}
+		b.Key = limiterKey(rule, identity)
+		b.Algorithm = p.limiterFor(rule).Algorithm()
+		b.Limit = p.opts.Emergency.ClampLimit(limit)
+		b.WindowSeconds = int64(window / time.Second)
+
+		counter, err := p.peekCounter(ctx, rule, b.Key, b.Limit, window)
+		if err != nil {
+			return nil, err
+		}
+		b.Counter = counter
+		out = append(out, b)
+	}
+	return out, nil
+}
@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/limiter"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestBudgets(t *testing.T) {
+	lim := limiter.NewSlidingWindow(storage.NewMemoryStorage())
+	p, _ := newTestProxy(t, lim, nil)
+	p.SetRules([]rules.Rule{
+		{ID: "search", Name: "search", Pattern: "/search", Limit: 5, WindowSeconds: 60, Enabled: true},
+	})
+
+	serve(p, "GET", "/search", nil)
+	serve(p, "GET", "/search", nil)
+	serve(p, "GET", "/other", nil)
+
+	got, err := p.Budgets(context.Background(), "ip:10.0.0.1", []string{"search", "", "deleted"})
+	if err != nil {
+		t.Fatalf("Budgets() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected budgets for search and the default limit, got %+v", got)
+	}
+	if got[0].RuleName != "search" || got[0].Key != "gatify:rl:{search}:ip:10.0.0.1" || got[0].Limit != 5 ||
+		got[0].Counter == nil || got[0].Counter.Remaining != 3 {
+		t.Errorf("Unexpected search budget %+v %+v", got[0], got[0].Counter)
+	}
+	if got[1].RuleID != "" || got[1].Limit != 2 || got[1].Counter == nil || got[1].Counter.Remaining != 1 {
+		t.Errorf("Unexpected default budget %+v %+v", got[1], got[1].Counter)
+	}
+
+	// Reading budgets counts nothing.
+	again, _ := p.Budgets(context.Background(), "ip:10.0.0.1", []string{"search"})
+	if again[0].Counter.Remaining != 3 {
+		t.Errorf("Budgets() counted a request: %+v", again[0].Counter)
+	}
+}
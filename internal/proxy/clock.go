@@ -0,0 +1,26 @@
+package proxy
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// monotonicClock hands out UTC wall-clock times that never go backwards,
+// even when the system clock is stepped back, so events from one instance
+// stay in order.
+type monotonicClock struct {
+	last atomic.Int64 // Unix nanoseconds of the latest time handed out
+}
+
+func (c *monotonicClock) now() time.Time {
+	for {
+		prev := c.last.Load()
+		next := time.Now().UnixNano()
+		if next <= prev {
+			next = prev + 1
+		}
+		if c.last.CompareAndSwap(prev, next) {
+			return time.Unix(0, next).UTC()
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonotonicClock(t *testing.T) {
+	var c monotonicClock
+	// Pretend an earlier reading came from a clock that was ahead.
+	ahead := time.Now().Add(time.Hour)
+	c.last.Store(ahead.UnixNano())
+
+	first := c.now()
+	second := c.now()
+	if !first.After(ahead) || !second.After(first) {
+		t.Errorf("Expected strictly increasing times after %v, got %v then %v", ahead, first, second)
+	}
+	if first.Location() != time.UTC {
+		t.Errorf("Expected UTC times, got %v", first.Location())
+	}
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// inflightTTL bounds how long an in-flight counter survives without any
+// request touching it, so slots held by a crashed instance are freed
+// eventually.
+const inflightTTL = 10 * time.Minute
+
+// acquireSlot counts a request against its rule's concurrency limit. It
+// returns a release function when the request may proceed, and false when
+// the client already has max_concurrency requests in flight. Like the
+// limiter it fails open when storage is unavailable.
+func (p *GatewayProxy) acquireSlot(ctx context.Context, d Decision) (func(), bool) {
+	if d.Rule == nil || d.Rule.MaxConcurrency <= 0 || p.opts.ConcurrencyStore == nil {
+		return func() {}, true
+	}
+	key := inflightKey(d.Rule, d.Identity)
+	n, err := p.opts.ConcurrencyStore.IncrBy(withScopeIndex(ctx, d.Rule), key, 1, inflightTTL)
+	if err != nil {
+		log.Printf("Concurrency limiter error for %s: %v", key, err)
+		return func() {}, true
+	}
+	if n > d.Rule.MaxConcurrency {
+		p.releaseSlot(key)
+		return nil, false
+	}
+	return func() { p.releaseSlot(key) }, true
+}
+
+// releaseSlot frees a slot even when the client has gone away. A counter
+// that went missing while the request ran, for example because it
+// expired, is removed rather than left negative.
+func (p *GatewayProxy) releaseSlot(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	n, err := p.opts.ConcurrencyStore.IncrBy(ctx, key, -1, inflightTTL)
+	if err != nil {
+		log.Printf("Failed to release concurrency slot %s: %v", key, err)
+		return
+	}
+	if n <= 0 {
+		_ = p.opts.ConcurrencyStore.Delete(ctx, key)
+	}
+}
+
+func inflightKey(rule *rules.Rule, identity string) string {
+	return InflightScopeKey(rule.Namespace, rule.ID) + identity
+}
+
+// InflightScopeKey returns the prefix shared by every in-flight counter of
+// a rule in namespace, which is empty for rules without one.
+func InflightScopeKey(namespace, ruleID string) string {
+	if namespace != "" {
+		return "gatify:inflight:ns:" + namespace + ":{" + ruleID + "}:"
+	}
+	return "gatify:inflight:{" + ruleID + "}:"
+}
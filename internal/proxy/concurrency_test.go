@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestProxyLimitsConcurrency(t *testing.T) {
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/export/slow" {
+			entered <- struct{}{}
+			<-unblock
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	store := storage.NewMemoryStorage()
+	u, _ := url.Parse(backend.URL)
+	p := New(Options{Backend: u, Limiter: newCountingLimiter(), DefaultLimit: 100, DefaultWindow: time.Minute, ConcurrencyStore: store})
+	p.SetRules([]rules.Rule{{ID: "r1", Pattern: "/export/*", Limit: 100, WindowSeconds: 60,
+		IdentifyBy: rules.IdentifyByIP, MaxConcurrency: 1, Enabled: true}})
+
+	done := make(chan int)
+	go func() { done <- serve(p, "GET", "/export/slow", nil).Code }()
+	<-entered
+
+	w := serve(p, "GET", "/export/fast", nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected 429 while a request is in flight, got %d", w.Code)
+	}
+	if w := serve(p, "GET", "/other", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected unrelated routes unaffected, got %d", w.Code)
+	}
+
+	close(unblock)
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("Expected the slow request to succeed, got %d", code)
+	}
+	if w := serve(p, "GET", "/export/fast", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected a freed slot to admit the next request, got %d", w.Code)
+	}
+	if _, err := store.Get(context.Background(), "gatify:inflight:{r1}:ip:10.0.0.1"); !errors.Is(err, storage.ErrKeyNotFound) {
+		t.Errorf("Expected the in-flight counter removed once idle, got %v", err)
+	}
+}
+
+func TestInflightKeyIncludesNamespace(t *testing.T) {
+	rule := &rules.Rule{ID: "r1", Namespace: "acme"}
+	if got, want := inflightKey(rule, "ip:10.0.0.1"), "gatify:inflight:ns:acme:{r1}:ip:10.0.0.1"; got != want {
+		t.Errorf("inflightKey() = %q, want %q", got, want)
+	}
+	rule.Namespace = ""
+	if got, want := inflightKey(rule, "ip:10.0.0.1"), "gatify:inflight:{r1}:ip:10.0.0.1"; got != want {
+		t.Errorf("inflightKey() = %q, want %q", got, want)
+	}
+}
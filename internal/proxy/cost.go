@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// CostEstimator prices requests for rate limiting, for example by the
+// complexity of a GraphQL query, so expensive requests use up more of the
+// client's budget than cheap ones.
+type CostEstimator interface {
+	// EstimateCost returns how many hits r counts as under rule, which is
+	// nil when the default limit applies. Values below one count as one.
+	// It runs before the request is forwarded, so an estimator reading the
+	// body must leave an unread copy in r.Body.
+	EstimateCost(r *http.Request, rule *rules.Rule) int64
+}
+
+// CostEstimatorFunc adapts a function to CostEstimator.
+type CostEstimatorFunc func(r *http.Request, rule *rules.Rule) int64
+
+// EstimateCost implements CostEstimator.
+func (f CostEstimatorFunc) EstimateCost(r *http.Request, rule *rules.Rule) int64 {
+	return f(r, rule)
+}
+
+// chargeCost prices the request with the configured estimator, returning
+// the context its rate limit check must use and the cost, which is 1
+// without an estimator.
+func (p *GatewayProxy) chargeCost(r *http.Request, rule *rules.Rule) (context.Context, int64) {
+	if p.opts.CostEstimator == nil {
+		return r.Context(), 1
+	}
+	cost := p.opts.CostEstimator.EstimateCost(r, rule)
+	if cost <= 1 {
+		return r.Context(), 1
+	}
+	return storage.WithCost(r.Context(), cost), cost
+}
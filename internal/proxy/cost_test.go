@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/limiter"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestProxyChargesEstimatedCost(t *testing.T) {
+	lim := limiter.NewSlidingWindow(storage.NewMemoryStorage())
+	p, _ := newTestProxy(t, lim, func(o *Options) {
+		o.CostEstimator = CostEstimatorFunc(func(r *http.Request, rule *rules.Rule) int64 {
+			if rule == nil || r.Header.Get("X-Query") != "deep" {
+				return 0
+			}
+			return 4
+		})
+	})
+	p.SetRules([]rules.Rule{{
+		ID: "graphql", Name: "graphql", Pattern: "/graphql", Limit: 10, WindowSeconds: 60, Enabled: true,
+	}})
+
+	deep := map[string]string{"X-Query": "deep"}
+	w := serve(p, "POST", "/graphql", deep)
+	if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Remaining") != "6" || w.Header().Get("X-RateLimit-Cost") != "4" {
+		t.Fatalf("Expected a deep query to cost 4, got %d %v", w.Code, w.Header())
+	}
+	serve(p, "POST", "/graphql", deep)
+	if w := serve(p, "POST", "/graphql", deep); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the third deep query to exceed the limit, got %d", w.Code)
+	}
+	w = serve(p, "POST", "/graphql", nil)
+	if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Cost") != "" {
+		t.Errorf("Expected a shallow query to cost 1, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestProxyBurstHeaders(t *testing.T) {
+	lim := limiter.NewSlidingWindow(storage.NewMemoryStorage())
+	p, _ := newTestProxy(t, lim, nil)
+	p.SetRules([]rules.Rule{{
+		ID: "api", Name: "api", Pattern: "/api/*", Limit: 2, WindowSeconds: 60, Burst: 1, Enabled: true,
+	}})
+
+	serve(p, "GET", "/api/users", nil)
+	w := serve(p, "GET", "/api/users", nil)
+	if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Burst") != "1" || w.Header().Get("X-RateLimit-Burst-Remaining") != "1" {
+		t.Fatalf("Expected the burst to be untouched within the limit, got %d %v", w.Code, w.Header())
+	}
+	w = serve(p, "GET", "/api/users", nil)
+	if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Burst-Remaining") != "0" {
+		t.Fatalf("Expected the burst to admit a third request, got %d %v", w.Code, w.Header())
+	}
+	if w := serve(p, "GET", "/api/users", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a fourth request to be rejected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// debugTokenHeader carries the token that opts a single request into
+// diagnostic response headers. It is never forwarded to the backend.
+const debugTokenHeader = "X-Gatify-Debug"
+
+// Diagnostic response headers explaining how a request was limited.
+const (
+	HeaderMatchedRule = "X-Gatify-Matched-Rule"
+	HeaderKey         = "X-Gatify-Key"
+	HeaderAlgorithm   = "X-Gatify-Algorithm"
+)
+
+// debugEnabled reports whether diagnostics should be exposed for r.
+func (p *GatewayProxy) debugEnabled(r *http.Request) bool {
+	if p.opts.DebugHeaders {
+		return true
+	}
+	if p.opts.DebugToken == "" {
+		return false
+	}
+	token := r.Header.Get(debugTokenHeader)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(p.opts.DebugToken)) == 1
+}
+
+// setDebugHeaders writes the decision's diagnostics. Requests that fell
+// through to the default limit report "global" as their rule.
+func setDebugHeaders(h http.Header, d Decision) {
+	rule := rules.DefaultLimitID
+	if d.Rule != nil {
+		rule = d.Rule.ID
+		if d.Rule.Name != "" {
+			rule += " (" + d.Rule.Name + ")"
+		}
+	}
+	h.Set(HeaderMatchedRule, rule)
+	h.Set(HeaderKey, d.Key)
+	h.Set(HeaderAlgorithm, d.Algorithm)
+}
+
+// redactedHeaders are replaced in rule debug logs since they carry
+// credentials.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", debugTokenHeader, dryRunHeader}
+
+// redact returns a copy of h with the credentials replaced.
+func redact(h http.Header) http.Header {
+	headers := h.Clone()
+	for _, name := range redactedHeaders {
+		if _, ok := headers[name]; ok {
+			headers[name] = []string{"[redacted]"}
+		}
+	}
+	return headers
+}
+
+// logRuleDebug writes the verbose record of a request matching a rule with
+// debug enabled: its headers and everything the limiter decided.
+func (p *GatewayProxy) logRuleDebug(r *http.Request, d Decision, allowed bool, status int, bytes int64) {
+	headers := redact(r.Header)
+
+	attrs := []slog.Attr{
+		slog.String("rule_id", d.Rule.ID),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("route", d.Route),
+		slog.String("remote_addr", r.RemoteAddr),
+		slog.Any("headers", headers),
+		slog.String("identity", d.Identity),
+		slog.String("key", d.Key),
+		slog.String("algorithm", d.Algorithm),
+		slog.String("upstream", d.Upstream),
+		slog.Bool("allowed", allowed),
+		slog.Int64("limit", d.Result.Limit),
+		slog.Int64("remaining", d.Result.Remaining),
+		slog.Time("reset_at", d.Result.ResetAt),
+		slog.Duration("delay", d.Result.Delay),
+		slog.Int("status", status),
+		slog.Int64("bytes", bytes),
+	}
+	if sh := d.Result.Shadow; sh != nil {
+		attrs = append(attrs, slog.Group("shadow",
+			slog.String("algorithm", sh.Algorithm),
+			slog.Bool("allowed", sh.Allowed),
+			slog.Int64("remaining", sh.Remaining)))
+	}
+	p.opts.RuleLogger.LogAttrs(r.Context(), slog.LevelDebug, "rule debug", attrs...)
+}
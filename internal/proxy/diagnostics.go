@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Diagnostic is the detailed record of one handled request, as kept by a
+// DebugRing.
+type Diagnostic struct {
+	Time       time.Time   `json:"time"`
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`
+	Route      string      `json:"route"`
+	RemoteAddr string      `json:"remote_addr"`
+	Headers    http.Header `json:"headers"`
+	RuleID     string      `json:"rule_id,omitempty"`
+	Identity   string      `json:"identity"`
+	Key        string      `json:"key"`
+	Algorithm  string      `json:"algorithm"`
+	Upstream   string      `json:"upstream"`
+	Allowed    bool        `json:"allowed"`
+	Limit      int64       `json:"limit"`
+	Remaining  int64       `json:"remaining"`
+	ResetAt    time.Time   `json:"reset_at"`
+	DelayMS    int64       `json:"delay_ms,omitempty"`
+	Cost       int64       `json:"cost,omitempty"`
+	Status     int         `json:"status"`
+	Bytes      int64       `json:"bytes"`
+	DurationMS int64       `json:"duration_ms"`
+	// BlockReason is set as on the request's Event.
+	BlockReason     string `json:"block_reason,omitempty"`
+	ShadowAlgorithm string `json:"shadow_algorithm,omitempty"`
+	ShadowAllowed   *bool  `json:"shadow_allowed,omitempty"`
+}
+
+// DebugRing keeps the diagnostics of the last requests an instance
+// handled, so recent behaviour can be inspected in detail without logging
+// every request at debug level. It is safe for concurrent use; a nil
+// *DebugRing keeps nothing.
+type DebugRing struct {
+	mu    sync.Mutex
+	items []Diagnostic
+	next  int
+	full  bool
+}
+
+// NewDebugRing creates a DebugRing holding the last size requests.
+func NewDebugRing(size int) *DebugRing {
+	return &DebugRing{items: make([]Diagnostic, size)}
+}
+
+// Add records d, replacing the oldest record once the ring is full.
+func (b *DebugRing) Add(d Diagnostic) {
+	if b == nil || len(b.items) == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.items[b.next] = d
+	b.next = (b.next + 1) % len(b.items)
+	if b.next == 0 {
+		b.full = true
+	}
+	b.mu.Unlock()
+}
+
+// Recent returns up to n records matching keep, which may be nil, newest
+// first. A non-positive n returns every match.
+func (b *DebugRing) Recent(n int, keep func(Diagnostic) bool) []Diagnostic {
+	out := []Diagnostic{}
+	if b == nil {
+		return out
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	count := b.next
+	if b.full {
+		count = len(b.items)
+	}
+	for i := 1; i <= count; i++ {
+		d := b.items[(b.next-i+len(b.items))%len(b.items)]
+		if keep != nil && !keep(d) {
+			continue
+		}
+		out = append(out, d)
+		if n > 0 && len(out) == n {
+			break
+		}
+	}
+	return out
+}
+
+// diagnose builds the diagnostic record of a request.
+func diagnose(r *http.Request, d Decision, allowed bool, status int, bytes int64) Diagnostic {
+	diag := Diagnostic{
+		Time:        d.Received,
+		Method:      r.Method,
+		Path:        r.URL.Path,
+		Route:       d.Route,
+		RemoteAddr:  r.RemoteAddr,
+		Headers:     redact(r.Header),
+		Identity:    d.Identity,
+		Key:         d.Key,
+		Algorithm:   d.Algorithm,
+		Upstream:    d.Upstream,
+		Allowed:     allowed,
+		Limit:       d.Result.Limit,
+		Remaining:   d.Result.Remaining,
+		ResetAt:     d.Result.ResetAt,
+		DelayMS:     d.Result.Delay.Milliseconds(),
+		Cost:        d.Cost,
+		Status:      status,
+		Bytes:       bytes,
+		BlockReason: d.BlockReason,
+	}
+	if !d.started.IsZero() {
+		diag.DurationMS = time.Since(d.started).Milliseconds()
+	}
+	if d.Rule != nil {
+		diag.RuleID = d.Rule.ID
+	}
+	if sh := d.Result.Shadow; sh != nil {
+		allowed := sh.Allowed
+		diag.ShadowAlgorithm = sh.Algorithm
+		diag.ShadowAllowed = &allowed
+	}
+	return diag
+}
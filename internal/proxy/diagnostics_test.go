@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDebugRingKeepsLastRequests(t *testing.T) {
+	ring := NewDebugRing(3)
+	if got := ring.Recent(0, nil); len(got) != 0 {
+		t.Fatalf("Expected an empty ring, got %+v", got)
+	}
+	for _, path := range []string{"/a", "/b", "/c", "/d"} {
+		ring.Add(Diagnostic{Path: path, Status: http.StatusOK})
+	}
+
+	got := ring.Recent(0, nil)
+	if len(got) != 3 || got[0].Path != "/d" || got[2].Path != "/b" {
+		t.Fatalf("Expected /d, /c, /b newest first, got %+v", got)
+	}
+	if got := ring.Recent(1, nil); len(got) != 1 || got[0].Path != "/d" {
+		t.Errorf("Expected only the newest record, got %+v", got)
+	}
+	got = ring.Recent(0, func(d Diagnostic) bool { return d.Path != "/c" })
+	if len(got) != 2 || got[1].Path != "/b" {
+		t.Errorf("Expected the filter applied, got %+v", got)
+	}
+
+	var nilRing *DebugRing
+	nilRing.Add(Diagnostic{})
+	if got := nilRing.Recent(0, nil); len(got) != 0 {
+		t.Errorf("Expected a nil ring to keep nothing, got %+v", got)
+	}
+}
+
+func TestProxyRecordsDiagnostics(t *testing.T) {
+	ring := NewDebugRing(10)
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.DefaultLimit = 1
+		o.DebugRing = ring
+	})
+
+	serve(p, "GET", "/api/items", map[string]string{"Authorization": "Bearer secret", "X-Trace": "1"})
+	serve(p, "GET", "/api/items", nil)
+
+	got := ring.Recent(0, nil)
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %d", len(got))
+	}
+	limited, first := got[0], got[1]
+	if limited.Status != http.StatusTooManyRequests || limited.Allowed || limited.Remaining != 0 {
+		t.Errorf("Unexpected diagnostic for the limited request %+v", limited)
+	}
+	if first.Status != http.StatusOK || !first.Allowed || first.Key == "" || first.Identity == "" || first.Algorithm != "counting" {
+		t.Errorf("Unexpected diagnostic %+v", first)
+	}
+	if first.Headers.Get("Authorization") != "[redacted]" || first.Headers.Get("X-Trace") != "1" {
+		t.Errorf("Expected credentials redacted, got %v", first.Headers)
+	}
+}
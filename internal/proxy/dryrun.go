@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// dryRunHeader carries an admin token that turns a request into a dry
+// run: the gateway answers with how it would limit the request instead of
+// counting and forwarding it.
+const dryRunHeader = "X-Gatify-Dry-Run"
+
+// serveDryRun answers r with its Explanation, without touching the
+// client's budget or the backend, so rules can be debugged with real
+// production requests. Requests without a valid admin token are refused.
+func (p *GatewayProxy) serveDryRun(w http.ResponseWriter, r *http.Request) {
+	authorize := p.opts.AuthorizeDryRun
+	if authorize == nil || !authorize(r.Context(), r.Header.Get(dryRunHeader)) {
+		writeJSONError(w, http.StatusForbidden, "dry run requires an admin token")
+		return
+	}
+
+	e, err := p.Explain(r)
+	if err != nil {
+		log.Printf("Failed to dry run %s %s: %v", r.Method, r.URL.Path, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to read counter state")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set(dryRunHeader, "true")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(e); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
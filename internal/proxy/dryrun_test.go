@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/limiter"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestDryRun(t *testing.T) {
+	forwarded := 0
+	lim := limiter.NewSlidingWindow(storage.NewMemoryStorage())
+	p, _ := newTestProxy(t, lim, func(o *Options) {
+		o.Next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			forwarded++
+		})
+		o.AuthorizeDryRun = func(_ context.Context, token string) bool { return token == "admin" }
+	})
+	p.SetRules([]rules.Rule{
+		{ID: "users", Pattern: "/api/users/:id", Limit: 3, WindowSeconds: 60, Priority: 10, Enabled: true},
+	})
+
+	serve(p, "GET", "/api/users/1", nil)
+	for i := 0; i < 2; i++ {
+		w := serve(p, "GET", "/api/users/1", map[string]string{dryRunHeader: "admin"})
+		if w.Code != http.StatusOK || w.Header().Get(dryRunHeader) != "true" || w.Header().Get("Cache-Control") != "no-store" {
+			t.Fatalf("dry run = %d %v", w.Code, w.Header())
+		}
+		var e Explanation
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+			t.Fatalf("decode dry run: %v", err)
+		}
+		if e.Rule == nil || e.Rule.ID != "users" || e.Key != "gatify:rl:{users}:ip:10.0.0.1" {
+			t.Errorf("Unexpected decision %+v", e)
+		}
+		if e.Counter == nil || e.Counter.Remaining != 2 || !e.Counter.Allowed {
+			t.Errorf("Dry run %d counter = %+v, want the one real request counted", i, e.Counter)
+		}
+	}
+	if forwarded != 1 {
+		t.Errorf("backend reached %d times, want only the real request", forwarded)
+	}
+}
+
+func TestDryRunRequiresAdminToken(t *testing.T) {
+	for name, authorize := range map[string]func(context.Context, string) bool{
+		"disabled":    nil,
+		"wrong token": func(_ context.Context, token string) bool { return token == "admin" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			forwarded := 0
+			p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+				o.Next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { forwarded++ })
+				o.AuthorizeDryRun = authorize
+			})
+			w := serve(p, "GET", "/", map[string]string{dryRunHeader: "guess"})
+			if w.Code != http.StatusForbidden || forwarded != 0 {
+				t.Errorf("dry run = %d, forwarded %d, want 403 and nothing forwarded", w.Code, forwarded)
+			}
+		})
+	}
+}
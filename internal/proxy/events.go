@@ -0,0 +1,240 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/tracing"
+)
+
+// Event describes a request the gateway handled.
+type Event struct {
+	// Timestamp is when the gateway received the request, in UTC. Within
+	// an instance timestamps never go backwards, even if the system clock
+	// does.
+	Timestamp time.Time `json:"timestamp"`
+	// Seq numbers events in the order this instance published them;
+	// long requests are published after shorter ones received later.
+	Seq      uint64 `json:"seq"`
+	ClientID string `json:"client_id"`
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	// Route is the path with rule parameters templated away, for
+	// grouping (e.g. /users/:id).
+	Route string `json:"route"`
+	// Agent is the client's user agent family, such as "bot" or
+	// "browser".
+	Agent     string `json:"agent"`
+	RuleID    string `json:"rule_id,omitempty"`
+	Allowed   bool   `json:"allowed"`
+	Limit     int64  `json:"limit"`
+	Remaining int64  `json:"remaining"`
+	Status    int    `json:"status"`
+	// Bytes is the size of the response body sent to the client.
+	Bytes int64 `json:"bytes"`
+	// Duration is how long the gateway took to answer the request, from
+	// receiving it to the last byte of the response.
+	Duration time.Duration `json:"duration"`
+	// BackendLatency is how long the backend took to send its response
+	// headers once the request was forwarded. It is zero for requests the
+	// gateway answered itself.
+	BackendLatency time.Duration `json:"backend_latency,omitempty"`
+	// ShadowAlgorithm and ShadowAllowed carry the dark-launched
+	// algorithm's hypothetical decision, when one is configured.
+	ShadowAlgorithm string `json:"shadow_algorithm,omitempty"`
+	ShadowAllowed   *bool  `json:"shadow_allowed,omitempty"`
+	// BlockReason classifies rejected requests that were not rate
+	// limited, such as BlockReasonHeaderViolation.
+	BlockReason string `json:"block_reason,omitempty"`
+	// IdentityError is why the client's bearer token was not accepted,
+	// such as "expired" or "bad_signature", when the rule identifies
+	// clients by JWT claim. The request was counted by IP instead.
+	IdentityError string `json:"identity_error,omitempty"`
+	// Dimensions are the backend response headers captured by the
+	// rule's capture_headers, keyed by canonical header name.
+	Dimensions map[string]string `json:"dimensions,omitempty"`
+}
+
+// EventSink receives an Event for every request the proxy handles.
+// Publish is called on the request path and must not block.
+type EventSink interface {
+	Publish(Event)
+}
+
+// EventSinkFunc adapts a function to an EventSink.
+type EventSinkFunc func(Event)
+
+// Publish implements EventSink.
+func (f EventSinkFunc) Publish(e Event) { f(e) }
+
+// MultiSink publishes every event to each of sinks in turn.
+func MultiSink(sinks ...EventSink) EventSink {
+	return EventSinkFunc(func(e Event) {
+		for _, s := range sinks {
+			s.Publish(e)
+		}
+	})
+}
+
+type syntheticKey struct{}
+
+// Synthetic marks a request's context as synthetic, such as a canary
+// check. The proxy handles synthetic requests like any other but does not
+// publish their events, so they stay out of real traffic's analytics.
+func Synthetic(ctx context.Context) context.Context {
+	return context.WithValue(ctx, syntheticKey{}, true)
+}
+
+func isSynthetic(ctx context.Context) bool {
+	synthetic, _ := ctx.Value(syntheticKey{}).(bool)
+	return synthetic
+}
+
+func (p *GatewayProxy) publish(r *http.Request, d Decision, allowed bool, status int) {
+	p.publishSized(r, d, allowed, status, 0)
+}
+
+// forward proxies an admitted request to the backend, or answers it with
+// its rule's action, and publishes the status and body size the client
+// actually received.
+func (p *GatewayProxy) forward(w http.ResponseWriter, r *http.Request, d Decision) {
+	if answersItself(d) {
+		bytes := writeAction(w, d.Rule.Action)
+		p.publishSized(r, d, true, d.Rule.Action.Status, bytes)
+		return
+	}
+	var ws *messageLimitWriter
+	if d.Rule != nil && d.Rule.WebSocket != nil && isWebSocketUpgrade(r) {
+		ws = &messageLimitWriter{ResponseWriter: w, allow: p.messageAllower(r.Context(), d)}
+		w = ws
+	}
+	rec := &responseRecorder{ResponseWriter: w}
+	defer p.opts.Shedder.Begin()()
+	if d.Rule != nil && d.Rule.Headers.UsesRequestID() {
+		d.RequestID = newRequestID()
+	}
+	if d.Rule != nil && len(d.Rule.CaptureHeaders) > 0 {
+		d.Dimensions = make(map[string]string, len(d.Rule.CaptureHeaders))
+	}
+	ctx, span := tracing.Start(r.Context(), "proxy "+d.Upstream, tracing.KindClient)
+	backend, _ := p.backend(d.Upstream)
+	d.inboundURL = r.URL
+	forwarded := time.Now()
+	backend.ServeHTTP(rec, r.WithContext(context.WithValue(ctx, decisionKey{}, d)))
+	if !rec.headersAt.IsZero() {
+		d.BackendLatency = rec.headersAt.Sub(forwarded)
+	}
+	span.SetAttr("http.response.status_code", rec.statusCode())
+	span.End()
+	if ws.exceeded() {
+		d.BlockReason = BlockReasonWebSocketMessages
+	}
+	p.publishSized(r, d, true, rec.statusCode(), rec.bytes)
+}
+
+func (p *GatewayProxy) publishSized(r *http.Request, d Decision, allowed bool, status int, bytes int64) {
+	if d.Rule != nil && d.Rule.Debug {
+		p.logRuleDebug(r, d, allowed, status, bytes)
+	}
+	annotateSpan(tracing.FromContext(r.Context()), d, allowed, status)
+	if isSynthetic(r.Context()) {
+		return
+	}
+	if p.opts.DebugRing != nil {
+		p.opts.DebugRing.Add(diagnose(r, d, allowed, status, bytes))
+	}
+	if p.opts.Events == nil {
+		return
+	}
+	e := Event{
+		Timestamp:      d.Received,
+		Seq:            p.seq.Add(1),
+		ClientID:       d.Identity,
+		Method:         r.Method,
+		Path:           r.URL.Path,
+		Route:          d.Route,
+		Agent:          d.Agent,
+		Allowed:        allowed,
+		Limit:          d.Result.Limit,
+		Remaining:      d.Result.Remaining,
+		Status:         status,
+		Bytes:          bytes,
+		BlockReason:    d.BlockReason,
+		IdentityError:  d.IdentityError,
+		BackendLatency: d.BackendLatency,
+	}
+	if !d.started.IsZero() {
+		e.Duration = time.Since(d.started)
+	}
+	if len(d.Dimensions) > 0 {
+		e.Dimensions = d.Dimensions
+	}
+	if d.Rule != nil {
+		e.RuleID = d.Rule.ID
+	}
+	if sh := d.Result.Shadow; sh != nil {
+		allowed := sh.Allowed
+		e.ShadowAlgorithm = sh.Algorithm
+		e.ShadowAllowed = &allowed
+	}
+	p.opts.Events.Publish(e)
+}
+
+// annotateSpan records the gateway's decision on the request's server span.
+func annotateSpan(span *tracing.Span, d Decision, allowed bool, status int) {
+	if span == nil {
+		return
+	}
+	span.SetAttr("http.route", d.Route)
+	span.SetAttr("http.response.status_code", status)
+	span.SetAttr("gatify.upstream", d.Upstream)
+	span.SetAttr("gatify.allowed", allowed)
+	if d.Rule != nil {
+		span.SetAttr("gatify.rule_id", d.Rule.ID)
+	}
+	if status >= http.StatusInternalServerError {
+		span.SetError(fmt.Errorf("status %d", status))
+	}
+}
+
+// responseRecorder counts the response bytes written through it. Unwrap
+// keeps flushing and hijacking available to the reverse proxy.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	// headersAt is when the final response headers were written.
+	headersAt time.Time
+}
+
+// WriteHeader records the final status. Informational responses such as
+// 103 Early Hints precede it and are passed through without recording,
+// except 101 Switching Protocols, which is final.
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.status == 0 && (code >= 200 || code == http.StatusSwitchingProtocols) {
+		r.status = code
+		r.headersAt = time.Now()
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+		r.headersAt = time.Now()
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+func (r *responseRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/limiter"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+	"github.com/Siruyy/gatify/internal/upstream"
+	"github.com/Siruyy/gatify/internal/useragent"
+)
+
+// Explanation describes how the gateway would limit a request, for
+// debugging rules before traffic depends on them.
+type Explanation struct {
+	// Rule is the rule the request matches, or nil when the default
+	// limit applies.
+	Rule     *rules.Rule       `json:"rule,omitempty"`
+	Params   map[string]string `json:"params,omitempty"`
+	Route    string            `json:"route"`
+	Upstream string            `json:"upstream"`
+	Agent    string            `json:"agent"`
+	Identity string            `json:"identity"`
+	// IdentityError is why the request's bearer token could not identify
+	// the client under a JWT claim rule.
+	IdentityError string `json:"identity_error,omitempty"`
+	Key           string `json:"key"`
+	// Algorithm, Limit and WindowSeconds are the limit the request
+	// counts against.
+	Algorithm     string `json:"algorithm"`
+	Limit         int64  `json:"limit"`
+	WindowSeconds int64  `json:"window_seconds"`
+	// Counter is the key's current state. It is nil for algorithms
+	// that cannot be read without counting a request.
+	Counter *Counter `json:"counter,omitempty"`
+	// Outranked lists the other enabled rules matching the request, in
+	// priority order, which Rule takes precedence over.
+	Outranked []rules.Rule `json:"outranked,omitempty"`
+}
+
+// Counter is a limiter key's state as read by Explain.
+type Counter struct {
+	// Allowed reports whether the next request would be admitted.
+	Allowed        bool      `json:"allowed"`
+	Remaining      int64     `json:"remaining"`
+	ResetAt        time.Time `json:"reset_at"`
+	BurstRemaining int64     `json:"burst_remaining,omitempty"`
+}
+
+// Explain reports which rule r matches, the identity and limiter key it
+// would be counted against, and that key's current state, without
+// counting it or forwarding it. Checks other than rule matching and rate
+// limits, such as the ACL, are not evaluated.
+func (p *GatewayProxy) Explain(r *http.Request) (Explanation, error) {
+	e := Explanation{
+		Route:    r.URL.Path,
+		Upstream: upstream.DefaultTarget,
+		Agent:    useragent.Classify(r.UserAgent()),
+	}
+	live := p.live.Load()
+	limit, window := live.DefaultLimit, live.DefaultWindow
+
+	matches := p.matcher.Load().MatchAll(r.Method, r.URL.Path, e.Agent)
+	if len(matches) > 0 {
+		m := matches[0]
+		e.Rule, e.Params, e.Route = &m.Rule, m.Params, m.Route
+		if m.Rule.Upstream != "" {
+			e.Upstream = m.Rule.Upstream
+		}
+		limit, window = m.Rule.Limit, m.Rule.Window()
+		for _, other := range matches[1:] {
+			e.Outranked = append(e.Outranked, other.Rule)
+		}
+	}
+	rl := p.limiterFor(e.Rule)
+	e.Algorithm = rl.Algorithm()
+	e.Identity, e.IdentityError = p.identifyChecked(r, e.Rule)
+	e.Key = limiterKey(e.Rule, e.Identity)
+	e.Limit = p.opts.Emergency.ClampLimit(limit)
+	e.WindowSeconds = int64(window / time.Second)
+
+	counter, err := p.peekCounter(r.Context(), e.Rule, e.Key, e.Limit, window)
+	if err != nil {
+		return Explanation{}, err
+	}
+	e.Counter = counter
+	return e, nil
+}
+
+// peekCounter reads the state of a rule's limiter key without counting a
+// request. It returns nil when the rule's algorithm cannot be read.
+func (p *GatewayProxy) peekCounter(ctx context.Context, rule *rules.Rule, key string, limit int64, window time.Duration) (*Counter, error) {
+	var progressive *rules.Progressive
+	if rule != nil {
+		progressive = rule.Progressive
+		if rule.Burst > 0 {
+			ctx = storage.WithBurst(ctx, rule.Burst)
+		}
+	}
+	res, ok, err := limiter.Peek(ctx, p.limiterFor(rule), key, progressive.CountingLimit(limit), window)
+	if err != nil {
+		return nil, fmt.Errorf("read counter %s: %w", key, err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &Counter{
+		Allowed:        res.Allowed,
+		Remaining:      res.Remaining,
+		ResetAt:        res.ResetAt,
+		BurstRemaining: res.BurstRemaining,
+	}, nil
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/limiter"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestExplain(t *testing.T) {
+	lim := limiter.NewSlidingWindow(storage.NewMemoryStorage())
+	p, _ := newTestProxy(t, lim, nil)
+	p.SetRules([]rules.Rule{
+		{ID: "users", Pattern: "/api/users/:id", Limit: 3, WindowSeconds: 60, IdentifyBy: rules.IdentifyByHeader, HeaderName: "X-API-Key", Priority: 10, Enabled: true},
+		{ID: "api", Pattern: "/api/*", Limit: 100, WindowSeconds: 60, Priority: 1, Enabled: true},
+	})
+
+	serve(p, "GET", "/api/users/42", map[string]string{"X-API-Key": "k1"})
+
+	r := httptest.NewRequest("GET", "/api/users/7", nil)
+	r.Header.Set("X-API-Key", "k1")
+	e, err := p.Explain(r)
+	if err != nil {
+		t.Fatalf("Explain() error = %v", err)
+	}
+	if e.Rule == nil || e.Rule.ID != "users" || e.Params["id"] != "7" || e.Route != "/api/users/:id" {
+		t.Fatalf("Unexpected match %+v", e)
+	}
+	if e.Identity != "header:k1" || e.Key != "gatify:rl:{users}:header:k1" || e.Limit != 3 || e.WindowSeconds != 60 {
+		t.Errorf("Unexpected limit %+v", e)
+	}
+	if len(e.Outranked) != 1 || e.Outranked[0].ID != "api" {
+		t.Errorf("Expected api to be outranked, got %+v", e.Outranked)
+	}
+	if e.Counter == nil || e.Counter.Remaining != 2 || !e.Counter.Allowed {
+		t.Errorf("Expected one request counted, got %+v", e.Counter)
+	}
+
+	// Explaining counts nothing.
+	again, _ := p.Explain(r)
+	if again.Counter == nil || again.Counter.Remaining != 2 {
+		t.Errorf("Explain() counted the request: %+v", again.Counter)
+	}
+}
+
+func TestExplainDefaultLimit(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), nil)
+	r := httptest.NewRequest("GET", "/other", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+
+	e, err := p.Explain(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Rule != nil || e.Key != "gatify:rl:{global}:ip:10.0.0.1" || e.Limit != 2 || e.WindowSeconds != int64(time.Minute/time.Second) {
+		t.Errorf("Unexpected explanation %+v", e)
+	}
+	if e.Counter != nil {
+		t.Errorf("Expected no counter for an unreadable limiter, got %+v", e.Counter)
+	}
+}
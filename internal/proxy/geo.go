@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"net/http"
+	"net/netip"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// BlockReasonCountry marks events for requests rejected by a rule's
+// country allow or deny list.
+const BlockReasonCountry = "country"
+
+// CountryLookup resolves client IPs to ISO 3166-1 alpha-2 country codes.
+// *geoip.DB implements it.
+type CountryLookup interface {
+	Country(ip netip.Addr) (string, bool)
+}
+
+// countrySource wraps a CountryLookup for atomic replacement.
+type countrySource struct {
+	CountryLookup
+}
+
+// SetCountries atomically replaces the database client countries are
+// looked up in. Until one is set, rules identifying clients by country
+// count them by IP and country lists are not enforced.
+func (p *GatewayProxy) SetCountries(db CountryLookup) {
+	p.countries.Store(&countrySource{db})
+}
+
+// country returns the client's country code, or "" when it is unknown.
+func (p *GatewayProxy) country(r *http.Request) string {
+	src := p.countries.Load()
+	if src == nil {
+		return ""
+	}
+	code, _ := src.Country(p.clientAddr(r))
+	return code
+}
+
+// countryBlocked reports whether rule's country lists reject the client.
+func (p *GatewayProxy) countryBlocked(r *http.Request, rule *rules.Rule) bool {
+	if rule == nil || len(rule.AllowCountries) == 0 && len(rule.DenyCountries) == 0 || p.countries.Load() == nil {
+		return false
+	}
+	return !rule.CountryAllowed(p.country(r))
+}
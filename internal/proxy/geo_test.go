@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// fakeCountries maps client IPs to countries.
+type fakeCountries map[string]string
+
+func (f fakeCountries) Country(ip netip.Addr) (string, bool) {
+	c, ok := f[ip.String()]
+	return c, ok
+}
+
+func TestProxyIdentifiesByCountry(t *testing.T) {
+	lim := newCountingLimiter()
+	p, _ := newTestProxy(t, lim, func(o *Options) { o.TrustProxy = true })
+	p.SetRules([]rules.Rule{{
+		ID: "geo", Name: "geo", Pattern: "/*", Limit: 5, WindowSeconds: 60,
+		IdentifyBy: rules.IdentifyByCountry, Enabled: true,
+	}})
+
+	// Without a database clients are counted by IP.
+	serve(p, "GET", "/a", map[string]string{"X-Forwarded-For": "81.2.69.1"})
+
+	p.SetCountries(fakeCountries{"81.2.69.1": "GB", "81.2.69.2": "GB"})
+	serve(p, "GET", "/a", map[string]string{"X-Forwarded-For": "81.2.69.1"})
+	serve(p, "GET", "/a", map[string]string{"X-Forwarded-For": "81.2.69.2"})
+	serve(p, "GET", "/a", map[string]string{"X-Forwarded-For": "10.0.0.9"})
+
+	want := []string{
+		"gatify:rl:{geo}:ip:81.2.69.1",
+		"gatify:rl:{geo}:country:GB",
+		"gatify:rl:{geo}:country:GB",
+		"gatify:rl:{geo}:ip:10.0.0.9",
+	}
+	for i, k := range want {
+		if lim.keys[i] != k {
+			t.Errorf("Key %d = %s, want %s", i, lim.keys[i], k)
+		}
+	}
+}
+
+func TestProxyCountryLists(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.TrustProxy = true
+		o.DefaultLimit = 100
+	})
+	var events []Event
+	p.opts.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	p.SetRules([]rules.Rule{
+		{ID: "eu", Name: "eu", Pattern: "/eu/*", Limit: 100, WindowSeconds: 60, AllowCountries: []string{"DE", "FR"}, Enabled: true},
+		{ID: "no-gb", Name: "no-gb", Pattern: "/world/*", Limit: 100, WindowSeconds: 60, DenyCountries: []string{"GB"}, Enabled: true},
+	})
+
+	get := func(path, ip string) int {
+		return serve(p, "GET", path, map[string]string{"X-Forwarded-For": ip}).Code
+	}
+
+	// Lists are not enforced until a database is loaded.
+	if code := get("/eu/x", "81.2.69.1"); code != http.StatusOK {
+		t.Fatalf("Expected 200 without a database, got %d", code)
+	}
+
+	p.SetCountries(fakeCountries{"81.2.69.1": "GB", "2.125.160.1": "DE"})
+	for _, tc := range []struct {
+		path, ip string
+		want     int
+	}{
+		{"/eu/x", "2.125.160.1", http.StatusOK},
+		{"/eu/x", "81.2.69.1", http.StatusForbidden},
+		{"/eu/x", "10.0.0.1", http.StatusForbidden},
+		{"/world/x", "81.2.69.1", http.StatusForbidden},
+		{"/world/x", "2.125.160.1", http.StatusOK},
+		{"/world/x", "10.0.0.1", http.StatusOK},
+	} {
+		if code := get(tc.path, tc.ip); code != tc.want {
+			t.Errorf("%s from %s: expected %d, got %d", tc.path, tc.ip, tc.want, code)
+		}
+	}
+
+	last := events[len(events)-3]
+	if last.Allowed || last.BlockReason != BlockReasonCountry {
+		t.Errorf("Expected a country block event, got %+v", last)
+	}
+}
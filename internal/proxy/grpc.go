@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gRPC status codes the gateway's own rejections map to.
+const (
+	grpcUnknown           = 2
+	grpcNotFound          = 5
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+	grpcUnauthenticated   = 16
+)
+
+// isGRPC reports whether r is a gRPC or gRPC-Web call.
+func isGRPC(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// grpcStatus maps the HTTP status of a rejection to the gRPC code a
+// client should see. Rate limits are RESOURCE_EXHAUSTED, so clients can
+// tell them from a backend that is down.
+func grpcStatus(status int) int {
+	switch status {
+	case http.StatusBadRequest:
+		return grpcInternal
+	case http.StatusUnauthorized:
+		return grpcUnauthenticated
+	case http.StatusForbidden:
+		return grpcPermissionDenied
+	case http.StatusNotFound:
+		return grpcNotFound
+	case http.StatusMethodNotAllowed:
+		return grpcUnimplemented
+	case http.StatusTooManyRequests, http.StatusRequestEntityTooLarge:
+		return grpcResourceExhausted
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return grpcUnavailable
+	}
+	return grpcUnknown
+}
+
+// grpcResponseWriter answers gRPC calls the gateway rejects the way gRPC
+// clients understand: HTTP 200 with the status in the headers and no
+// body, a "trailers-only" response. Responses already in gRPC form, such
+// as the backend's, pass through untouched, as do the rejection's
+// Retry-After and rate limit headers, which clients see as metadata.
+type grpcResponseWriter struct {
+	http.ResponseWriter
+	contentType string
+	rejected    bool
+}
+
+func newGRPCResponseWriter(w http.ResponseWriter, r *http.Request) *grpcResponseWriter {
+	contentType := "application/grpc"
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc-web") {
+		contentType = "application/grpc-web+proto"
+	}
+	return &grpcResponseWriter{ResponseWriter: w, contentType: contentType}
+}
+
+func (g *grpcResponseWriter) WriteHeader(status int) {
+	h := g.Header()
+	if status < http.StatusOK || status == http.StatusOK || strings.HasPrefix(h.Get("Content-Type"), "application/grpc") {
+		g.ResponseWriter.WriteHeader(status)
+		return
+	}
+	g.rejected = true
+	h.Del("Content-Length")
+	h.Set("Content-Type", g.contentType)
+	h.Set("Grpc-Status", strconv.Itoa(grpcStatus(status)))
+	h.Set("Grpc-Message", strings.ToLower(http.StatusText(status)))
+	g.ResponseWriter.WriteHeader(http.StatusOK)
+}
+
+// Write discards the body of a rejection, which gRPC clients would try to
+// parse as a message.
+func (g *grpcResponseWriter) Write(b []byte) (int, error) {
+	if g.rejected {
+		return len(b), nil
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+func (g *grpcResponseWriter) Unwrap() http.ResponseWriter { return g.ResponseWriter }
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// newH2CBackend starts a backend answering gRPC calls over cleartext
+// HTTP/2 only.
+func newH2CBackend(t *testing.T) *url.URL {
+	t.Helper()
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("Expected HTTP/2 to the backend, got %s", r.Proto)
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	backend.Config.Protocols = new(http.Protocols)
+	backend.Config.Protocols.SetUnencryptedHTTP2(true)
+	backend.Start()
+	t.Cleanup(backend.Close)
+	u, _ := url.Parse(backend.URL)
+	u.Scheme = "h2c"
+	return u
+}
+
+func TestProxyForwardsGRPCOverH2C(t *testing.T) {
+	var events []Event
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.Backend = newH2CBackend(t)
+		o.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	})
+	p.SetRules([]rules.Rule{{
+		ID: "orders", Name: "orders", Pattern: "/orders.v1.Orders/*", Limit: 1, WindowSeconds: 60, Enabled: true,
+	}})
+	grpc := map[string]string{"Content-Type": "application/grpc", "TE": "trailers"}
+
+	w := serve(p, "POST", "/orders.v1.Orders/GetOrder", grpc)
+	if w.Code != http.StatusOK || w.Result().Trailer.Get("Grpc-Status") != "0" {
+		t.Fatalf("Expected the backend's gRPC response, got %d %v %v", w.Code, w.Header(), w.Result().Trailer)
+	}
+
+	w = serve(p, "POST", "/orders.v1.Orders/GetOrder", grpc)
+	if w.Code != http.StatusOK || w.Header().Get("Grpc-Status") != "8" || w.Body.Len() != 0 {
+		t.Fatalf("Expected a trailers-only RESOURCE_EXHAUSTED, got %d %v %q", w.Code, w.Header(), w.Body)
+	}
+	if w.Header().Get("Content-Type") != "application/grpc" || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Unexpected rejection headers %v", w.Header())
+	}
+	if len(events) != 2 || events[0].RuleID != "orders" || events[1].Allowed || events[1].Status != http.StatusTooManyRequests {
+		t.Errorf("Unexpected events %+v", events)
+	}
+}
+
+func TestGRPCResponseWriterLeavesOtherRequestsAlone(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) { o.DefaultLimit = 0 })
+	w := serve(p, "GET", "/plain", nil)
+	if w.Header().Get("Grpc-Status") != "" {
+		t.Errorf("Expected no gRPC status on a plain request, got %v", w.Header())
+	}
+
+	w = serve(p, "POST", "/svc/Method", map[string]string{"Content-Type": "application/grpc-web+proto"})
+	if w.Header().Get("Grpc-Status") != "8" || w.Header().Get("Content-Type") != "application/grpc-web+proto" {
+		t.Errorf("Expected a gRPC-Web rejection, got %v", w.Header())
+	}
+}
+
+func TestGRPCStatus(t *testing.T) {
+	for status, want := range map[int]int{
+		http.StatusTooManyRequests:    grpcResourceExhausted,
+		http.StatusForbidden:          grpcPermissionDenied,
+		http.StatusServiceUnavailable: grpcUnavailable,
+		http.StatusBadGateway:         grpcUnavailable,
+		http.StatusTeapot:             grpcUnknown,
+	} {
+		if got := grpcStatus(status); got != want {
+			t.Errorf("grpcStatus(%d) = %d, want %d", status, got, want)
+		}
+	}
+}
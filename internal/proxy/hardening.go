@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// BlockReasonHeaderViolation marks events for requests rejected by the
+// header hardening checks, as opposed to rate limits or access rules.
+const BlockReasonHeaderViolation = "header_violation"
+
+// singletonHeaders may appear once per request. Backends disagreeing on
+// which copy wins is how smuggled requests and spoofed credentials get
+// past the gateway.
+var singletonHeaders = []string{"Content-Length", "Content-Type", "Authorization"}
+
+// headerError is a request rejected by the header hardening checks.
+type headerError struct {
+	status int
+	msg    string
+}
+
+// checkHeaders rejects requests whose framing is ambiguous or whose header
+// count exceeds MaxRequestHeaders. net/http already refuses most
+// conflicting framing while parsing; these checks hold regardless of the
+// server in front of the proxy.
+func (p *GatewayProxy) checkHeaders(r *http.Request) *headerError {
+	if max := p.opts.MaxRequestHeaders; max > 0 {
+		count := 0
+		for _, values := range r.Header {
+			count += len(values)
+		}
+		if count > max {
+			return &headerError{http.StatusRequestHeaderFieldsTooLarge, fmt.Sprintf("too many headers (limit %d)", max)}
+		}
+	}
+
+	for _, name := range singletonHeaders {
+		values := r.Header.Values(name)
+		if len(values) > 1 || (name == "Content-Length" && len(values) == 1 && strings.Contains(values[0], ",")) {
+			return &headerError{http.StatusBadRequest, "duplicate " + name + " header"}
+		}
+	}
+
+	te := r.TransferEncoding
+	if len(te) == 0 {
+		te = r.Header.Values("Transfer-Encoding")
+	}
+	if len(te) == 0 {
+		return nil
+	}
+	if len(te) > 1 || !strings.EqualFold(strings.TrimSpace(te[0]), "chunked") {
+		return &headerError{http.StatusBadRequest, "unsupported Transfer-Encoding"}
+	}
+	if r.Header.Get("Content-Length") != "" {
+		return &headerError{http.StatusBadRequest, "conflicting Transfer-Encoding and Content-Length"}
+	}
+	return nil
+}
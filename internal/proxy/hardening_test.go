@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestProxyRejectsAmbiguousHeaders(t *testing.T) {
+	var events []Event
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.DefaultLimit = 100
+		o.MaxRequestHeaders = 10
+		o.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	})
+
+	tests := []struct {
+		name    string
+		prepare func(r *http.Request)
+		want    int
+	}{
+		{"plain", func(r *http.Request) {}, http.StatusOK},
+		{"chunked", func(r *http.Request) { r.TransferEncoding = []string{"chunked"} }, http.StatusOK},
+		{"duplicate Content-Length", func(r *http.Request) {
+			r.Header["Content-Length"] = []string{"3", "3"}
+		}, http.StatusBadRequest},
+		{"comma-joined Content-Length", func(r *http.Request) { r.Header.Set("Content-Length", "3, 3") }, http.StatusBadRequest},
+		{"duplicate Authorization", func(r *http.Request) {
+			r.Header["Authorization"] = []string{"Bearer a", "Bearer b"}
+		}, http.StatusBadRequest},
+		{"Transfer-Encoding with Content-Length", func(r *http.Request) {
+			r.TransferEncoding = []string{"chunked"}
+			r.Header.Set("Content-Length", "3")
+		}, http.StatusBadRequest},
+		{"unsupported Transfer-Encoding", func(r *http.Request) {
+			r.Header["Transfer-Encoding"] = []string{"gzip", "chunked"}
+		}, http.StatusBadRequest},
+		{"too many headers", func(r *http.Request) {
+			for i := 0; i < 11; i++ {
+				r.Header.Add("X-Filler-"+strconv.Itoa(i), "x")
+			}
+		}, http.StatusRequestHeaderFieldsTooLarge},
+	}
+	for _, tt := range tests {
+		events = nil
+		req := httptest.NewRequest("POST", "/upload", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		tt.prepare(req)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, w.Code, w.Body.String())
+			continue
+		}
+		if len(events) != 1 {
+			t.Fatalf("%s: expected 1 event, got %d", tt.name, len(events))
+		}
+		wantReason := ""
+		if tt.want != http.StatusOK {
+			wantReason = BlockReasonHeaderViolation
+		}
+		if events[0].BlockReason != wantReason {
+			t.Errorf("%s: expected block reason %q, got %q", tt.name, wantReason, events[0].BlockReason)
+		}
+	}
+}
+
+func TestProxyHeaderLimitDisabled(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) { o.DefaultLimit = 100 })
+	headers := make(map[string]string)
+	for i := 0; i < 200; i++ {
+		headers["X-Filler-"+strconv.Itoa(i)] = "x"
+	}
+	if w := serve(p, "GET", "/", headers); w.Code != http.StatusOK {
+		t.Errorf("Expected no header limit by default, got %d", w.Code)
+	}
+}
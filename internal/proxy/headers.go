@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// rewriteRequest applies the matched rule's request header edits to a
+// request about to be forwarded.
+func rewriteRequest(r *http.Request) {
+	d, ok := DecisionFromContext(r.Context())
+	if !ok || d.Rule == nil || d.Rule.Headers == nil {
+		return
+	}
+	applyHeaderEdits(r.Header, d.Rule.Headers.Request, d)
+}
+
+// rewriteResponse applies the matched rule's response header edits to a
+// backend response.
+func rewriteResponse(resp *http.Response) {
+	if resp.Request == nil {
+		return
+	}
+	d, ok := DecisionFromContext(resp.Request.Context())
+	if !ok || d.Rule == nil || d.Rule.Headers == nil {
+		return
+	}
+	applyHeaderEdits(resp.Header, d.Rule.Headers.Response, d)
+}
+
+func applyHeaderEdits(h http.Header, e *rules.HeaderEdits, d Decision) {
+	if e == nil {
+		return
+	}
+	for _, name := range e.Remove {
+		prefix, ok := strings.CutSuffix(name, "*")
+		if !ok {
+			h.Del(name)
+			continue
+		}
+		for key := range h {
+			if strings.HasPrefix(http.CanonicalHeaderKey(key), prefix) {
+				delete(h, key)
+			}
+		}
+	}
+
+	expand := placeholderReplacer(d)
+	for name, value := range e.Set {
+		h.Set(name, expand.Replace(value))
+	}
+	for name, value := range e.Default {
+		if h.Get(name) == "" {
+			h.Set(name, expand.Replace(value))
+		}
+	}
+	for name, value := range e.Add {
+		h.Add(name, expand.Replace(value))
+	}
+}
+
+func placeholderReplacer(d Decision) *strings.Replacer {
+	return strings.NewReplacer(
+		rules.PlaceholderRequestID, d.RequestID,
+		rules.PlaceholderClientID, d.Identity,
+		rules.PlaceholderRuleID, d.Rule.ID,
+		rules.PlaceholderRoute, d.Route,
+	)
+}
+
+// newRequestID returns a random 128-bit hex ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
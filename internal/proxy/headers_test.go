@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+func TestProxyRewritesHeaders(t *testing.T) {
+	var got http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("X-Internal-Host", "db-3")
+		w.Header().Set("X-Internal-Version", "42")
+		w.Header().Set("Server", "legacy")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+	p := New(Options{Backend: u, Limiter: newCountingLimiter(), DefaultLimit: 10, DefaultWindow: time.Minute})
+	rule := rules.Rule{ID: "r1", Name: "api", Pattern: "/api/*", Limit: 10, WindowSeconds: 60, Enabled: true,
+		Headers: &rules.HeaderRewrite{
+			Request: &rules.HeaderEdits{
+				Remove:  []string{"Cookie"},
+				Set:     map[string]string{"X-Gateway-Client": "{client_id}"},
+				Default: map[string]string{"X-Request-Id": "{request_id}"},
+			},
+			Response: &rules.HeaderEdits{
+				Remove: []string{"X-Internal-*", "Server"},
+				Set:    map[string]string{"X-Request-Id": "{request_id}"},
+				Add:    map[string]string{"Vary": "X-Api-Key"},
+			},
+		}}
+	rule.Normalize()
+	p.SetRules([]rules.Rule{rule})
+
+	w := serve(p, "GET", "/api/items", map[string]string{"Cookie": "session=1"})
+
+	if got.Get("Cookie") != "" || got.Get("X-Gateway-Client") != "ip:10.0.0.1" {
+		t.Errorf("Unexpected backend headers %v", got)
+	}
+	id := got.Get("X-Request-Id")
+	if len(id) != 32 || w.Header().Get("X-Request-Id") != id {
+		t.Errorf("Expected the same generated request ID both ways, got %q and %q", id, w.Header().Get("X-Request-Id"))
+	}
+	if w.Header().Get("X-Internal-Host") != "" || w.Header().Get("X-Internal-Version") != "" || w.Header().Get("Server") != "" {
+		t.Errorf("Expected internal headers stripped, got %v", w.Header())
+	}
+	if w.Header().Get("Vary") != "X-Api-Key" {
+		t.Errorf("Expected added Vary header, got %v", w.Header())
+	}
+
+	// A client-supplied request ID is kept.
+	serve(p, "GET", "/api/items", map[string]string{"X-Request-Id": "abc"})
+	if got.Get("X-Request-Id") != "abc" {
+		t.Errorf("Expected the client's request ID kept, got %q", got.Get("X-Request-Id"))
+	}
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/upstream"
+)
+
+// hedgingTransport is the reverse proxies' RoundTripper. Requests whose
+// rule enables hedging may be sent twice; everything else goes straight
+// to base.
+type hedgingTransport struct {
+	base http.RoundTripper
+	p    *GatewayProxy
+}
+
+// CloseIdleConnections closes base's idle connections.
+func (t *hedgingTransport) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+type hedgeAttempt struct {
+	index int
+	resp  *http.Response
+	err   error
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *hedgingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	d, ok := DecisionFromContext(req.Context())
+	if !ok || d.Rule == nil || d.Rule.Hedge == nil || !hedgeable(req) {
+		return t.base.RoundTrip(req)
+	}
+	name, target, ok := t.p.hedgeTarget(d)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	return t.hedge(req, time.Duration(d.Rule.Hedge.AfterMS)*time.Millisecond, func() (*http.Request, bool) {
+		return t.p.hedgeRequest(req, d, name, target)
+	})
+}
+
+// hedgeable reports whether req can safely be sent twice: only bodiless
+// GET and HEAD requests that do not upgrade the connection.
+func hedgeable(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		return false
+	}
+	return req.Header.Get("Upgrade") == ""
+}
+
+// hedgeTarget returns the upstream for the second attempt and its URL, or
+// a nil URL for the request's own upstream. It reports false when the rule
+// names an unknown upstream.
+func (p *GatewayProxy) hedgeTarget(d Decision) (string, *url.URL, bool) {
+	name := d.Rule.Hedge.Upstream
+	switch name {
+	case "", d.Upstream:
+		return d.Upstream, nil, true
+	case upstream.DefaultTarget:
+		return name, p.live.Load().Backend, true
+	}
+	u, ok := p.opts.Upstreams[name]
+	return name, u, ok
+}
+
+// hedge sends req and, if no response arrived after the delay, the
+// request next builds, unless it declines. The first response wins and
+// the other attempt is cancelled. An error only ends the exchange once no
+// attempt is left pending, and a first attempt failing before the delay
+// is not hedged: hedging cuts tail latency, it does not retry failures.
+func (t *hedgingTransport) hedge(req *http.Request, after time.Duration, next func() (*http.Request, bool)) (*http.Response, error) {
+	results := make(chan hedgeAttempt, 2)
+	var cancels []context.CancelFunc
+	send := func(r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := t.base.RoundTrip(r.WithContext(ctx))
+			results <- hedgeAttempt{index: index, resp: resp, err: err}
+		}()
+	}
+
+	send(req)
+	timer := time.NewTimer(after)
+	defer timer.Stop()
+	pending := 1
+	var firstErr error
+
+	for {
+		select {
+		case <-timer.C:
+			if firstErr == nil && len(cancels) == 1 {
+				if r, ok := next(); ok {
+					send(r)
+					pending++
+				}
+			}
+		case a := <-results:
+			pending--
+			if a.err != nil {
+				cancels[a.index]()
+				if firstErr == nil {
+					firstErr = a.err
+				}
+				if pending == 0 {
+					return nil, firstErr
+				}
+				continue
+			}
+			for i, cancel := range cancels {
+				if i != a.index {
+					cancel()
+				}
+			}
+			if pending > 0 {
+				go discardAttempts(results, pending)
+			}
+			a.resp.Body = &cancelOnClose{ReadCloser: a.resp.Body, cancel: cancels[a.index]}
+			return a.resp, nil
+		}
+	}
+}
+
+// hedgeRequest copies the outbound req for upstream name at target, or
+// for req's own upstream when target is nil. The copy keeps the headers
+// the director set, and its URL is rewritten from the inbound one the way
+// name's own reverse proxy would, so a target's base path is kept. Its
+// context names the upstream, so the response is charged to name's
+// circuit breaker rather than the request's own upstream. It reports
+// false when name is unhealthy or its circuit is not closed: a hedge is
+// optional traffic and never probes a failing upstream.
+func (p *GatewayProxy) hedgeRequest(req *http.Request, d Decision, name string, target *url.URL) (*http.Request, bool) {
+	if !p.opts.Health.Healthy(name) || !p.opts.Breaker.Closed(name) {
+		return nil, false
+	}
+	r := req.Clone(context.WithValue(req.Context(), hedgeUpstreamKey{}, name))
+	if target != nil && d.inboundURL != nil {
+		u := *d.inboundURL
+		r.URL = &u
+		(&httputil.ProxyRequest{Out: r}).SetURL(target)
+		r.Host = req.Host
+	}
+	return r, true
+}
+
+type hedgeUpstreamKey struct{}
+
+// hedgeUpstream returns the upstream a hedged attempt was sent to, or
+// false for the first attempt and requests that were not hedged.
+func hedgeUpstream(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(hedgeUpstreamKey{}).(string)
+	return name, ok
+}
+
+// discardAttempts closes the responses of losing attempts.
+func discardAttempts(results <-chan hedgeAttempt, n int) {
+	for ; n > 0; n-- {
+		if a := <-results; a.resp != nil {
+			a.resp.Body.Close()
+		}
+	}
+}
+
+// cancelOnClose releases the winning attempt's context once its body has
+// been consumed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
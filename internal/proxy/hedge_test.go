@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/upstream"
+)
+
+func TestProxyHedgesSlowGets(t *testing.T) {
+	cancelled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/items/slow" {
+			<-r.Context().Done()
+			close(cancelled)
+			return
+		}
+		io.WriteString(w, "primary")
+	}))
+	defer slow.Close()
+	var replicaHits atomic.Int32
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		replicaHits.Add(1)
+		io.WriteString(w, "replica")
+	}))
+	defer replica.Close()
+
+	backend, _ := url.Parse(slow.URL)
+	replicaURL, _ := url.Parse(replica.URL)
+	p := New(Options{Backend: backend, Upstreams: map[string]*url.URL{"replica": replicaURL},
+		Limiter: newCountingLimiter(), DefaultLimit: 100, DefaultWindow: time.Minute})
+	p.SetRules([]rules.Rule{{ID: "r1", Pattern: "/items/*", Limit: 100, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP,
+		Enabled: true, Hedge: &rules.Hedge{AfterMS: 20, Upstream: "replica"}}})
+
+	w := serve(p, "GET", "/items/slow", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "replica" {
+		t.Fatalf("Expected the hedged replica response, got %d %q", w.Code, w.Body.String())
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("Expected the slow attempt to be cancelled")
+	}
+
+	if w := serve(p, "GET", "/items/fast", nil); w.Body.String() != "primary" || replicaHits.Load() != 1 {
+		t.Errorf("Expected a fast response not to be hedged, got %q with %d replica hits", w.Body.String(), replicaHits.Load())
+	}
+	if w := serve(p, "POST", "/items/slow-write", nil); w.Body.String() != "primary" || replicaHits.Load() != 1 {
+		t.Errorf("Expected POST never hedged, got %q with %d replica hits", w.Body.String(), replicaHits.Load())
+	}
+}
+
+func TestProxyHedgeKeepsTargetBasePath(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	var gotPath, gotQuery string
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+		io.WriteString(w, "replica")
+	}))
+	defer replica.Close()
+
+	backend, _ := url.Parse(slow.URL)
+	replicaURL, _ := url.Parse(replica.URL + "/api")
+	p := New(Options{Backend: backend, Upstreams: map[string]*url.URL{"replica": replicaURL},
+		Limiter: newCountingLimiter(), DefaultLimit: 100, DefaultWindow: time.Minute})
+	p.SetRules([]rules.Rule{{ID: "r1", Pattern: "/items/*", Limit: 100, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP,
+		Enabled: true, Hedge: &rules.Hedge{AfterMS: 20, Upstream: "replica"}}})
+
+	w := serve(p, "GET", "/items/slow?page=2", nil)
+	if w.Body.String() != "replica" {
+		t.Fatalf("Expected the hedged replica response, got %d %q", w.Code, w.Body.String())
+	}
+	if gotPath != "/api/items/slow" || gotQuery != "page=2" {
+		t.Errorf("Expected the hedge at /api/items/slow?page=2, got %s?%s", gotPath, gotQuery)
+	}
+}
+
+func TestProxyHedgeSkipsFailingTargets(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(60 * time.Millisecond)
+		io.WriteString(w, "primary")
+	}))
+	defer slow.Close()
+	var replicaHits atomic.Int32
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		replicaHits.Add(1)
+		io.WriteString(w, "replica")
+	}))
+	defer replica.Close()
+	backend, _ := url.Parse(slow.URL)
+	replicaURL, _ := url.Parse(replica.URL)
+
+	unhealthy := upstream.NewChecker([]upstream.Target{{
+		Name:  "replica",
+		URL:   &url.URL{Scheme: "http", Host: "127.0.0.1:1"},
+		Check: upstream.HealthCheck{Path: "/healthz", Interval: time.Hour},
+	}}, nil)
+	// With a cancelled context Run probes once, fails and returns.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	unhealthy.Run(ctx)
+
+	open := upstream.NewBreaker(upstream.BreakerConfig{MinRequests: 1, OpenDuration: time.Hour})
+	open.Record("replica", true)
+
+	tests := []struct {
+		name string
+		opts func(*Options)
+	}{
+		{"unhealthy", func(o *Options) { o.Health = unhealthy }},
+		{"open circuit", func(o *Options) { o.Breaker = open }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{Backend: backend, Upstreams: map[string]*url.URL{"replica": replicaURL},
+				Limiter: newCountingLimiter(), DefaultLimit: 100, DefaultWindow: time.Minute}
+			tt.opts(&opts)
+			p := New(opts)
+			p.SetRules([]rules.Rule{{ID: "r1", Pattern: "/items/*", Limit: 100, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP,
+				Enabled: true, Hedge: &rules.Hedge{AfterMS: 10, Upstream: "replica"}}})
+
+			w := serve(p, "GET", "/items/slow", nil)
+			if w.Body.String() != "primary" || replicaHits.Load() != 0 {
+				t.Errorf("Expected no hedge to a failing target, got %q with %d replica hits", w.Body.String(), replicaHits.Load())
+			}
+		})
+	}
+}
+
+func TestProxyHedgeChargesOutcomeToTarget(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer replica.Close()
+	backend, _ := url.Parse(slow.URL)
+	replicaURL, _ := url.Parse(replica.URL)
+
+	breaker := upstream.NewBreaker(upstream.BreakerConfig{MinRequests: 1, OpenDuration: time.Hour})
+	p := New(Options{Backend: backend, Upstreams: map[string]*url.URL{"replica": replicaURL}, Breaker: breaker,
+		Limiter: newCountingLimiter(), DefaultLimit: 100, DefaultWindow: time.Minute})
+	p.SetRules([]rules.Rule{{ID: "r1", Pattern: "/items/*", Limit: 100, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP,
+		Enabled: true, Hedge: &rules.Hedge{AfterMS: 20, Upstream: "replica"}}})
+
+	if w := serve(p, "GET", "/items/slow", nil); w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected the hedged replica's 500, got %d", w.Code)
+	}
+	if breaker.Closed("replica") {
+		t.Error("Expected the replica's failure charged to its own circuit")
+	}
+	if !breaker.Closed(upstream.DefaultTarget) {
+		t.Error("Expected the request's own upstream left untouched")
+	}
+}
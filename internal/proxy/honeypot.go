@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// Block reasons of honeypot traps and the bans they set.
+const (
+	// BlockReasonHoneypot marks requests to a honeypot rule's paths.
+	BlockReasonHoneypot = "honeypot"
+	// BlockReasonBanned marks requests from banned clients.
+	BlockReasonBanned = "banned"
+)
+
+// hasHoneypot reports whether any enabled rule is a honeypot.
+func hasHoneypot(list []rules.Rule) bool {
+	return slices.ContainsFunc(list, func(r rules.Rule) bool {
+		return r.Enabled && r.Honeypot != nil
+	})
+}
+
+// banClient returns the identity a ban of the request's client applies
+// to: the one its rule counts it by, so clients that a rule tells apart by
+// header, cookie or token are not banned together behind a shared NAT. It
+// reports false for an IP identity whose address cannot be parsed, since
+// banning it would lump every such client together.
+func (p *GatewayProxy) banClient(r *http.Request, d Decision) (string, bool) {
+	if strings.HasPrefix(d.Identity, "ip:") && !p.clientAddr(r).IsValid() {
+		return "", false
+	}
+	return d.Identity, true
+}
+
+// banned reports whether the client is banned, either under its rule
+// identity or by its IP address, which honeypot bans of IP identified
+// clients cover every route with. Bans are only looked up while a honeypot
+// rule is loaded or AutoBan is enabled, since those are what ban clients,
+// so other deployments pay nothing for them.
+func (p *GatewayProxy) banned(r *http.Request, d Decision) bool {
+	if !p.honeypots.Load() && !p.opts.AutoBan.Enabled() {
+		return false
+	}
+	var clients []string
+	if client, ok := p.banClient(r, d); ok {
+		clients = append(clients, client)
+	}
+	if addr := p.clientAddr(r); addr.IsValid() && !slices.Contains(clients, "ip:"+addr.String()) {
+		clients = append(clients, "ip:"+addr.String())
+	}
+	for _, client := range clients {
+		_, banned, err := p.opts.Bans.Banned(r.Context(), client)
+		if err != nil {
+			// Fail open, like rate limits do.
+			log.Printf("Ban lookup failed for %s: %v", client, err)
+			return false
+		}
+		if banned {
+			return true
+		}
+	}
+	return false
+}
+
+// springTrap bans the client that requested a honeypot path and logs the
+// hit as a security event.
+func (p *GatewayProxy) springTrap(r *http.Request, d Decision) {
+	client, ok := p.banClient(r, d)
+	if !ok {
+		log.Printf("🍯 Honeypot %q hit by an unparsable address: %s %s (agent %s); not banned",
+			d.Rule.Name, r.Method, r.URL.Path, d.Agent)
+		return
+	}
+	if p.opts.Bans == nil {
+		log.Printf("🍯 Honeypot %q hit by %s: %s %s (agent %s); bans are disabled",
+			d.Rule.Name, client, r.Method, r.URL.Path, d.Agent)
+		return
+	}
+	ban := d.Rule.Honeypot.BanDuration()
+	if err := p.opts.Bans.Ban(r.Context(), client, BlockReasonHoneypot, ban); err != nil {
+		log.Printf("Failed to ban %s after honeypot %q hit: %v", client, d.Rule.Name, err)
+		return
+	}
+	log.Printf("🍯 Honeypot %q hit by %s: %s %s (agent %s); banned for %s",
+		d.Rule.Name, client, r.Method, r.URL.Path, d.Agent, ban)
+}
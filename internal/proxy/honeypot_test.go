@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/acl"
+	"github.com/Siruyy/gatify/internal/ban"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestProxyHoneypotBansClient(t *testing.T) {
+	bans := ban.New(storage.NewMemoryStorage())
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.TrustProxy = true
+		o.DefaultLimit = 100
+		o.Bans = bans
+	})
+	var events []Event
+	p.opts.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	trap := rules.Rule{
+		ID: "trap", Name: "wp-admin", Pattern: "/wp-admin/*", Limit: 100, WindowSeconds: 60,
+		Honeypot: &rules.Honeypot{BanSeconds: 600}, Enabled: true,
+	}
+	p.SetRules([]rules.Rule{trap})
+
+	get := func(path, ip string) int {
+		return serve(p, "GET", path, map[string]string{"X-Forwarded-For": ip}).Code
+	}
+	if code := get("/api/items", "203.0.113.7"); code != http.StatusOK {
+		t.Fatalf("Expected 200 before the trap, got %d", code)
+	}
+	if code := get("/wp-admin/setup.php", "203.0.113.7"); code != http.StatusNotFound {
+		t.Fatalf("Expected the honeypot to answer 404, got %d", code)
+	}
+	if code := get("/api/items", "203.0.113.7"); code != http.StatusForbidden {
+		t.Fatalf("Expected the banned client to get 403, got %d", code)
+	}
+	if code := get("/api/items", "203.0.113.8"); code != http.StatusOK {
+		t.Fatalf("Expected other clients to be served, got %d", code)
+	}
+
+	if len(events) != 4 || events[1].BlockReason != BlockReasonHoneypot || events[2].BlockReason != BlockReasonBanned {
+		t.Errorf("Unexpected events %+v", events)
+	}
+
+	// Unparsable addresses are not banned, or they would all share a ban.
+	get("/wp-admin/", "unknown")
+	if code := get("/api/items", "bogus"); code != http.StatusOK {
+		t.Errorf("Expected a client with another unparsable address served, got %d", code)
+	}
+
+	// Allowlisted clients are not banned by the trap.
+	p.SetACL([]acl.Entry{{CIDR: "198.51.100.1/32", Action: acl.ActionAllow}})
+	get("/wp-admin/", "198.51.100.1")
+	if code := get("/api/items", "198.51.100.1"); code != http.StatusOK {
+		t.Errorf("Expected the allowlisted client to be served, got %d", code)
+	}
+}
@@ -0,0 +1,251 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// keyPrefix namespaces every limiter key the gateway writes.
+const keyPrefix = "gatify:rl:"
+
+// maxIdentityValue is the longest header, cookie or JWT claim value used
+// as an identity; longer ones count as absent, so a client cannot force
+// an arbitrarily large limiter key.
+const maxIdentityValue = 512
+
+// identify returns the client identity the limit is counted against.
+// Header identities come from the first of the rule's headers present and
+// fall back to the client IP when all are absent so that omitting them
+// cannot bypass the limit; country identities fall back to the IP when
+// the country is unknown, and cookie identities when the cookie is
+// missing. JWT claim identities fall back to the IP when the request has
+// no usable token. The rule's key transforms apply to header, cookie,
+// claim and IP values.
+func (p *GatewayProxy) identify(r *http.Request, rule *rules.Rule) string {
+	id, _ := p.identifyChecked(r, rule)
+	return id
+}
+
+// identifyChecked is identify that also reports why a presented token
+// could not identify the client, for the request's event.
+func (p *GatewayProxy) identifyChecked(r *http.Request, rule *rules.Rule) (id, tokenError string) {
+	if rule == nil {
+		return "ip:" + p.clientIP(r), ""
+	}
+	if rule.Composite() {
+		if id, ok := p.compositeIdentity(r, rule); ok {
+			return id, ""
+		}
+	}
+	switch rule.IdentifyBy {
+	case rules.IdentifyByHeader:
+		if v := headerIdentity(r, rule, rule.IdentityHeaders()); v != "" {
+			return "header:" + v, ""
+		}
+	case rules.IdentifyByCountry:
+		if c := p.country(r); c != "" {
+			return "country:" + c, ""
+		}
+	case rules.IdentifyByCookie:
+		// Request.Cookie drops malformed values; oversized ones are not
+		// worth a key of their own.
+		if c, err := r.Cookie(rule.CookieName); err == nil && len(c.Value) <= maxIdentityValue {
+			if v := rule.NormalizeIdentity(c.Value); v != "" {
+				return "cookie:" + v, ""
+			}
+		}
+	case rules.IdentifyByJWTClaim:
+		v, reason := p.jwtIdentity(r, rule)
+		if v != "" {
+			return "jwt:" + v, ""
+		}
+		tokenError = reason
+	}
+	return "ip:" + rule.NormalizeIdentity(p.clientIP(r)), tokenError
+}
+
+// compositeIdentity renders the rule's composite identity. Values are
+// escaped so they cannot contain a separator or pass for another part, and
+// missing ones are rendered as "-", which escaping never produces; when
+// none of the parts has a value the request is identified by IP like any
+// other. Template identities are prefixed with "key:" so they cannot pass
+// for a single-source identity.
+func (p *GatewayProxy) compositeIdentity(r *http.Request, rule *rules.Rule) (string, bool) {
+	parts, err := rule.IdentityParts()
+	if err != nil {
+		return "", false
+	}
+	var b strings.Builder
+	if strings.Contains(rule.IdentifyBy, "{") {
+		b.WriteString("key:")
+	}
+	found := false
+	for _, part := range parts {
+		if part.Source == "" {
+			b.WriteString(part.Text)
+			continue
+		}
+		v := p.identityValue(r, rule, part)
+		if v == "" {
+			b.WriteString(missingIdentity)
+			continue
+		}
+		found = true
+		escapeIdentity(&b, v)
+	}
+	return b.String(), found
+}
+
+// missingIdentity stands in for a composite identity part without a value.
+const missingIdentity = "-"
+
+// escapeIdentity writes v to b, percent-encoding every byte other than
+// letters, digits, '.', '_' and '~'.
+func escapeIdentity(b *strings.Builder, v string) {
+	const hex = "0123456789ABCDEF"
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xF])
+		}
+	}
+}
+
+// identityValue reads one part of a composite identity from the request,
+// returning "" when it is absent.
+func (p *GatewayProxy) identityValue(r *http.Request, rule *rules.Rule, part rules.IdentityPart) string {
+	switch part.Source {
+	case rules.IdentifyByIP:
+		return rule.NormalizeIdentity(p.clientIP(r))
+	case rules.IdentifyByCountry:
+		return p.country(r)
+	case rules.IdentifyByHeader:
+		names := rule.IdentityHeaders()
+		if part.Name != "" {
+			names = []string{part.Name}
+		}
+		return headerIdentity(r, rule, names)
+	case rules.IdentifyByCookie:
+		name := rule.CookieName
+		if part.Name != "" {
+			name = part.Name
+		}
+		if c, err := r.Cookie(name); err == nil && len(c.Value) <= maxIdentityValue {
+			return rule.NormalizeIdentity(c.Value)
+		}
+	}
+	return ""
+}
+
+// headerIdentity returns the first of the named headers present on r,
+// normalized by the rule, or "" when none is.
+func headerIdentity(r *http.Request, rule *rules.Rule, names []string) string {
+	for _, name := range names {
+		v := strings.TrimSpace(r.Header.Get(name))
+		if len(v) > maxIdentityValue {
+			continue
+		}
+		if v = rule.NormalizeIdentity(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// clientIP returns the originating client address. Forwarding headers are
+// only honored when the gateway is configured to trust them, and then only
+// as far as they were written by trusted proxies: X-Forwarded-For is read
+// from the right, skipping the hops in TrustedProxies, because everything
+// left of the last trusted hop is whatever the client chose to send. With
+// no TrustedProxies the connection's peer is the only trusted proxy.
+func (p *GatewayProxy) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	live := p.live.Load()
+	if !live.TrustProxy {
+		return host
+	}
+	if len(live.TrustedProxies) > 0 && !trustedHop(live.TrustedProxies, host) {
+		return host
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if i == 0 || !trustedHop(live.TrustedProxies, hops[i]) {
+			return hops[i]
+		}
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	return host
+}
+
+// trustedHop reports whether ip is one of the trusted proxies.
+func trustedHop(trusted []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr parses clientIP for ACL lookups. It returns the zero Addr,
+// which matches nothing, when the address is not an IP.
+func (p *GatewayProxy) clientAddr(r *http.Request) netip.Addr {
+	addr, _ := netip.ParseAddr(p.clientIP(r))
+	return addr
+}
+
+// limiterKey wraps the rule ID in a hash tag so storage can track, and
+// reset, all of a rule's counters together.
+func limiterKey(rule *rules.Rule, identity string) string {
+	if rule == nil {
+		return ScopeKey("", rules.DefaultLimitID) + identity
+	}
+	return ScopeKey(rule.Namespace, rule.ID) + identity
+}
+
+// withScopeIndex returns ctx for writing rule's counters that live outside
+// its limiter keys, such as in-flight and quota counters. They are tracked
+// in the rule's scope index, so resetting the rule deletes them with its
+// limiter counters.
+func withScopeIndex(ctx context.Context, rule *rules.Rule) context.Context {
+	index, _ := storage.IndexKey(ScopeKey(rule.Namespace, rule.ID))
+	return storage.WithIndex(ctx, index)
+}
+
+// ScopeKey returns the prefix shared by every limiter key of a rule in
+// namespace, which is empty for rules without one. Pass it to
+// limiter.Reset to clear the rule's counters.
+func ScopeKey(namespace, ruleID string) string {
+	if namespace != "" {
+		return keyPrefix + "ns:" + namespace + ":{" + ruleID + "}:"
+	}
+	return keyPrefix + "{" + ruleID + "}:"
+}
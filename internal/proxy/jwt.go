@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Siruyy/gatify/internal/jwtauth"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// IdentityErrorUnverified marks events for tokens presented to a rule
+// identifying clients by JWT claim while no verifier is configured.
+const IdentityErrorUnverified = "unverified"
+
+// IdentityErrorClaimTooLong marks events for tokens whose claim exceeds
+// maxIdentityValue, which are counted by IP like unusable tokens.
+const IdentityErrorClaimTooLong = "claim_too_long"
+
+// maxTokenBytes is the longest bearer token verified; longer ones are
+// rejected as malformed without parsing.
+const maxTokenBytes = 8 << 10
+
+// jwtIdentity returns the value of the rule's claim in the request's
+// verified bearer token. When there is a token but it cannot be used,
+// the value is empty and reason says why, such as "expired"; requests
+// without a token are not a failure.
+func (p *GatewayProxy) jwtIdentity(r *http.Request, rule *rules.Rule) (value, reason string) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", ""
+	}
+	token = strings.TrimSpace(token)
+	if p.opts.JWT == nil {
+		return "", IdentityErrorUnverified
+	}
+	if len(token) > maxTokenBytes {
+		return "", jwtauth.ErrMalformed.Reason
+	}
+	claims, err := p.opts.JWT.Verify(token)
+	if err != nil {
+		var jerr *jwtauth.Error
+		if errors.As(err, &jerr) {
+			return "", jerr.Reason
+		}
+		return "", jwtauth.ErrMalformed.Reason
+	}
+	v, ok := claims.String(rule.JWTClaim)
+	if !ok {
+		return "", jwtauth.ErrMissingClaim.Reason
+	}
+	if len(v) > maxIdentityValue {
+		return "", IdentityErrorClaimTooLong
+	}
+	return rule.NormalizeIdentity(v), ""
+}
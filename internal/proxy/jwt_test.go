@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/jwtauth"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// hs256Token signs claims, a JSON object, with secret.
+func hs256Token(secret, claims string) string {
+	input := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestProxyIdentifiesByJWTClaim(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	lim := newCountingLimiter()
+	var events []Event
+	p, _ := newTestProxy(t, lim, func(o *Options) {
+		o.JWT = jwtauth.NewVerifier(jwtauth.Config{Secret: []byte(secret)})
+		o.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	})
+	p.SetRules([]rules.Rule{{
+		ID: "r1", Pattern: "/api/*", Limit: 5, WindowSeconds: 60,
+		IdentifyBy: rules.IdentifyByJWTClaim, JWTClaim: "org.id", Enabled: true,
+	}})
+
+	expired := time.Now().Add(-time.Hour).Unix()
+	for _, tc := range []struct {
+		auth, key, tokenError string
+	}{
+		{"Bearer " + hs256Token(secret, `{"sub":"u1","org":{"id":42}}`), "gatify:rl:{r1}:jwt:42", ""},
+		{"bearer " + hs256Token(secret, `{"sub":"u1","org":{"id":"acme"}}`), "gatify:rl:{r1}:jwt:acme", ""},
+		{"Bearer " + hs256Token("forged-secret-forged-secret-forg", `{"org":{"id":"acme"}}`), "gatify:rl:{r1}:ip:10.0.0.1", "bad_signature"},
+		{"Bearer " + hs256Token(secret, `{"org":{"id":"acme"},"exp":`+strconv.FormatInt(expired, 10)+`}`), "gatify:rl:{r1}:ip:10.0.0.1", "expired"},
+		{"Bearer " + hs256Token(secret, `{"sub":"u1"}`), "gatify:rl:{r1}:ip:10.0.0.1", "missing_claim"},
+		{"Bearer " + hs256Token(secret, `{"org":{"id":"`+strings.Repeat("a", maxIdentityValue+1)+`"}}`), "gatify:rl:{r1}:ip:10.0.0.1", "claim_too_long"},
+		{"Basic dXNlcjpwYXNz", "gatify:rl:{r1}:ip:10.0.0.1", ""},
+	} {
+		events = nil
+		serve(p, "GET", "/api/orders", map[string]string{"Authorization": tc.auth})
+		if got := lim.keys[len(lim.keys)-1]; got != tc.key {
+			t.Errorf("%q: key = %s, want %s", tc.auth, got, tc.key)
+		}
+		if len(events) != 1 || events[0].IdentityError != tc.tokenError {
+			t.Errorf("%q: events = %+v, want identity error %q", tc.auth, events, tc.tokenError)
+		}
+	}
+}
+
+func TestProxyJWTClaimWithoutVerifier(t *testing.T) {
+	var events []Event
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	})
+	p.SetRules([]rules.Rule{{
+		ID: "r1", Pattern: "/*", Limit: 5, WindowSeconds: 60,
+		IdentifyBy: rules.IdentifyByJWTClaim, JWTClaim: "sub", Enabled: true,
+	}})
+
+	serve(p, "GET", "/", map[string]string{"Authorization": "Bearer " + hs256Token("s", `{"sub":"u1"}`)})
+	if len(events) != 1 || events[0].ClientID != "ip:10.0.0.1" || events[0].IdentityError != IdentityErrorUnverified {
+		t.Errorf("events = %+v, want the request counted by IP as unverified", events)
+	}
+}
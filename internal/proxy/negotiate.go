@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// acceptRange is one media range of an Accept header.
+type acceptRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// parseAccept parses an Accept header, skipping malformed ranges.
+func parseAccept(header string) []acceptRange {
+	var out []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		typ, subtype, ok := strings.Cut(mediaType, "/")
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil && parsed >= 0 && parsed <= 1 {
+				q = parsed
+			}
+		}
+		out = append(out, acceptRange{typ: typ, subtype: subtype, q: q})
+	}
+	return out
+}
+
+// negotiate returns the index of the offered content type the Accept
+// header prefers, taking each from the most specific range matching it.
+// Ties go to the earlier offer. It returns 0 when the header is absent or
+// accepts none of the offers: a rejection is still better sent in the
+// default type than replaced with a 406.
+func negotiate(accept string, offered []string) int {
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 {
+		return 0
+	}
+	best, bestQ := 0, 0.0
+	for i, contentType := range offered {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			continue
+		}
+		typ, subtype, _ := strings.Cut(mediaType, "/")
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			s := -1
+			switch {
+			case r.typ == typ && r.subtype == subtype:
+				s = 2
+			case r.typ == typ && r.subtype == "*":
+				s = 1
+			case r.typ == "*" && r.subtype == "*":
+				s = 0
+			}
+			if s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	return best
+}
+
+// tooManyFormats are the content types of the gateway's own 429 bodies,
+// JSON first as the default.
+var tooManyFormats = []struct {
+	contentType string
+	render      func(msg string, retry int64) string
+}{
+	{"application/json", func(msg string, _ int64) string {
+		return `{"error":"` + msg + `"}`
+	}},
+	{"application/xml; charset=utf-8", renderXMLError},
+	{"text/xml; charset=utf-8", renderXMLError},
+	{"text/plain; charset=utf-8", func(msg string, retry int64) string {
+		return fmt.Sprintf("%s, retry in %d seconds\n", msg, retry)
+	}},
+	{"text/html; charset=utf-8", func(msg string, retry int64) string {
+		msg = html.EscapeString(msg)
+		return fmt.Sprintf("<!DOCTYPE html>\n<html><head><title>429 Too Many Requests</title></head>"+
+			"<body><h1>Too Many Requests</h1><p>%s, retry in %d seconds.</p></body></html>\n", msg, retry)
+	}},
+}
+
+// tooManyOffered lists the content types of tooManyFormats for negotiate.
+var tooManyOffered = func() []string {
+	out := make([]string, len(tooManyFormats))
+	for i, f := range tooManyFormats {
+		out[i] = f.contentType
+	}
+	return out
+}()
+
+func renderXMLError(msg string, retry int64) string {
+	return fmt.Sprintf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"+
+		"<error><message>%s</message><retry_after>%d</retry_after></error>\n", html.EscapeString(msg), retry)
+}
+
+// writeTooManyRequests answers with a 429 carrying msg in the format r's
+// Accept header prefers and a Retry-After of retry seconds.
+func writeTooManyRequests(w http.ResponseWriter, r *http.Request, msg string, retry int64) {
+	f := tooManyFormats[negotiate(r.Header.Get("Accept"), tooManyOffered)]
+
+	h := w.Header()
+	h.Set("Retry-After", strconv.FormatInt(retry, 10))
+	h.Set("Content-Type", f.contentType)
+	h.Add("Vary", "Accept")
+	w.WriteHeader(http.StatusTooManyRequests)
+	if _, err := w.Write([]byte(f.render(msg, retry))); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// PolicyPath is where the public rate limit policy is served.
+const PolicyPath = "/.well-known/rate-limit-policy"
+
+// Policy is the machine-readable description of the gateway's public
+// limits.
+type Policy struct {
+	Limits []PolicyLimit `json:"limits"`
+}
+
+// PolicyLimit describes one public rule.
+type PolicyLimit struct {
+	Name          string   `json:"name"`
+	Pattern       string   `json:"pattern"`
+	Methods       []string `json:"methods,omitempty"`
+	Limit         int64    `json:"limit"`
+	WindowSeconds int64    `json:"window_seconds"`
+	// Identity is what requests are counted against: "ip",
+	// "header:<name>" or "country".
+	Identity string `json:"identity"`
+	// Policy is the limit in RateLimit-Policy header syntax, e.g. "100;w=60".
+	Policy string `json:"policy"`
+}
+
+// buildPolicy lists the enabled public rules in matching order.
+func buildPolicy(list []rules.Rule) *Policy {
+	public := make([]rules.Rule, 0, len(list))
+	for _, r := range list {
+		if r.Enabled && r.Public {
+			public = append(public, r)
+		}
+	}
+	rules.SortByPriority(public)
+
+	policy := &Policy{Limits: make([]PolicyLimit, 0, len(public))}
+	for _, r := range public {
+		identity := rules.IdentifyByIP
+		switch r.IdentifyBy {
+		case rules.IdentifyByHeader:
+			identity = rules.IdentifyByHeader + ":" + strings.Join(r.IdentityHeaders(), ",")
+		case rules.IdentifyByCountry:
+			identity = rules.IdentifyByCountry
+		case rules.IdentifyByCookie:
+			identity = rules.IdentifyByCookie + ":" + r.CookieName
+		case rules.IdentifyByJWTClaim:
+			identity = rules.IdentifyByJWTClaim + ":" + r.JWTClaim
+		default:
+			if r.Composite() {
+				identity = r.IdentifyBy
+			}
+		}
+		policy.Limits = append(policy.Limits, PolicyLimit{
+			Name:          r.Name,
+			Pattern:       r.Pattern,
+			Methods:       r.Methods,
+			Limit:         r.Limit,
+			WindowSeconds: r.WindowSeconds,
+			Identity:      identity,
+			Policy:        strconv.FormatInt(r.Limit, 10) + ";w=" + strconv.FormatInt(r.WindowSeconds, 10),
+		})
+	}
+	return policy
+}
+
+// PolicyHandler serves the public policy for the rules currently loaded.
+func (p *GatewayProxy) PolicyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		if err := json.NewEncoder(w).Encode(p.policy.Load()); err != nil {
+			log.Printf("Failed to write rate limit policy: %v", err)
+		}
+	})
+}
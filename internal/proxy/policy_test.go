@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+func TestPolicyListsPublicRules(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), nil)
+	p.SetRules([]rules.Rule{
+		{ID: "a", Name: "search", Pattern: "/search", Limit: 10, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Public: true, Enabled: true},
+		{ID: "b", Name: "keys", Pattern: "/api/*", Priority: 5, Limit: 1000, WindowSeconds: 3600, IdentifyBy: rules.IdentifyByHeader, HeaderName: "X-Api-Key", Public: true, Enabled: true},
+		{ID: "c", Name: "internal", Pattern: "/admin/*", Limit: 5, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Enabled: true},
+		{ID: "d", Name: "disabled", Pattern: "/old", Limit: 5, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Public: true},
+	})
+
+	w := serve(p.PolicyHandler(), "GET", PolicyPath, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Unexpected response %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var got Policy
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode policy: %v", err)
+	}
+	if len(got.Limits) != 2 {
+		t.Fatalf("Expected 2 public limits, got %+v", got.Limits)
+	}
+	first := got.Limits[0]
+	if first.Name != "keys" || first.Identity != "header:X-Api-Key" || first.Policy != "1000;w=3600" {
+		t.Errorf("Expected highest priority rule first, got %+v", first)
+	}
+	if got.Limits[1].Identity != "ip" || got.Limits[1].Policy != "10;w=60" {
+		t.Errorf("Unexpected limit %+v", got.Limits[1])
+	}
+
+	if w := serve(p.PolicyHandler(), "POST", PolicyPath, nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", w.Code)
+	}
+}
+
+func TestPolicyEmptyWithoutRules(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), nil)
+	if w := serve(p.PolicyHandler(), "GET", PolicyPath, nil); w.Body.String() != "{\"limits\":[]}\n" {
+		t.Errorf("Expected empty limit list, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/limiter"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// tier is the degradation a progressive rule applies to a request.
+type tier int
+
+const (
+	tierNone tier = iota
+	tierDelay
+	tierReject
+	tierTarpit
+)
+
+// progressiveTier maps a limiter result, counted against cfg's counting
+// limit, onto the rule's tiers. The returned result is expressed in terms
+// of the rule's real limit so clients see consistent headers.
+func progressiveTier(cfg *rules.Progressive, limit int64, res limiter.Result) (limiter.Result, tier) {
+	if cfg == nil {
+		if !res.Allowed {
+			return res, tierReject
+		}
+		return res, tierNone
+	}
+
+	counting := cfg.CountingLimit(limit)
+	used := counting - res.Remaining
+	if !res.Allowed {
+		used = counting + 1
+	}
+	res.Limit = limit
+	res.Remaining = max(0, limit-used)
+
+	switch {
+	case !res.Allowed && counting > limit:
+		return res, tierTarpit
+	case used > limit:
+		res.Allowed = false
+		return res, tierReject
+	case cfg.DelayMS > 0 && float64(used) > cfg.DelayAbove*float64(limit):
+		return res, tierDelay
+	}
+	return res, tierNone
+}
+
+// pause holds the request for d, returning early if the client goes away.
+func pause(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/limiter"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+func TestProgressiveTier(t *testing.T) {
+	cfg := &rules.Progressive{DelayAbove: 0.8, DelayMS: 100, TarpitAbove: 1.5, TarpitMS: 1000}
+	tests := []struct {
+		name      string
+		remaining int64
+		allowed   bool
+		want      tier
+		wantLeft  int64
+	}{
+		{"well under", 10, true, tierNone, 5},
+		{"at 80%", 7, true, tierNone, 2},
+		{"past 80%", 6, true, tierDelay, 1},
+		{"at limit", 5, true, tierDelay, 0},
+		{"past limit", 4, true, tierReject, 0},
+		{"past 150%", 0, false, tierTarpit, 0},
+	}
+	for _, tt := range tests {
+		res, got := progressiveTier(cfg, 10, limiter.Result{Allowed: tt.allowed, Limit: 15, Remaining: tt.remaining})
+		if got != tt.want || res.Remaining != tt.wantLeft || res.Limit != 10 {
+			t.Errorf("%s: got tier %d remaining %d limit %d, want tier %d remaining %d", tt.name, got, res.Remaining, res.Limit, tt.want, tt.wantLeft)
+		}
+		if res.Allowed != (got == tierNone || got == tierDelay) {
+			t.Errorf("%s: Allowed = %v for tier %d", tt.name, res.Allowed, got)
+		}
+	}
+}
+
+func TestProxyProgressiveResponses(t *testing.T) {
+	lim := newCountingLimiter()
+	p, _ := newTestProxy(t, lim, nil)
+	p.SetRules([]rules.Rule{{
+		ID: "r1", Pattern: "/v1/*", Limit: 4, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Enabled: true,
+		Progressive: &rules.Progressive{DelayAbove: 0.5, DelayMS: 30, TarpitAbove: 1.5, TarpitMS: 30},
+	}})
+
+	want := []struct {
+		code    int
+		delayed bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusOK, false},
+		{http.StatusOK, true},
+		{http.StatusOK, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusTooManyRequests, true},
+	}
+	for i, tt := range want {
+		start := time.Now()
+		w := serve(p, "GET", "/v1/items", nil)
+		elapsed := time.Since(start)
+		if w.Code != tt.code {
+			t.Fatalf("Request %d: expected %d, got %d", i, tt.code, w.Code)
+		}
+		if tt.delayed != (elapsed >= 30*time.Millisecond) {
+			t.Errorf("Request %d: delayed = %v after %v", i, !tt.delayed, elapsed)
+		}
+		if w.Header().Get("X-RateLimit-Limit") != "4" {
+			t.Errorf("Request %d: expected the rule's limit in headers, got %v", i, w.Header())
+		}
+	}
+}
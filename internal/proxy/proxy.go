@@ -1,4 +1,574 @@
 // Package proxy provides HTTP reverse proxy functionality
 package proxy
 
-// TODO: Implement reverse proxy with rate limiting
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/acl"
+	"github.com/Siruyy/gatify/internal/ban"
+	"github.com/Siruyy/gatify/internal/emergency"
+	"github.com/Siruyy/gatify/internal/jwtauth"
+	"github.com/Siruyy/gatify/internal/limiter"
+	"github.com/Siruyy/gatify/internal/quota"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/shed"
+	"github.com/Siruyy/gatify/internal/storage"
+	"github.com/Siruyy/gatify/internal/tracing"
+	"github.com/Siruyy/gatify/internal/upstream"
+	"github.com/Siruyy/gatify/internal/useragent"
+)
+
+// Options configures a GatewayProxy.
+type Options struct {
+	// Backend is the upstream allowed requests are forwarded to unless
+	// their rule names another.
+	Backend *url.URL
+	// Upstreams are additional backends, by name, that rules can route
+	// to with their upstream field.
+	Upstreams map[string]*url.URL
+	// Next, when set, handles allowed requests in place of Backend and
+	// Upstreams, so the gateway can run as middleware in front of an
+	// in-process handler. Features that act on backend responses, such
+	// as response header rewrites and hedging, apply only when proxying.
+	Next http.Handler
+	// Transport carries requests to Backend and Upstreams, for example
+	// with client certificates or tuned connection pools;
+	// http.DefaultTransport when nil.
+	Transport http.RoundTripper
+	// Limiter enforces rule and default limits.
+	Limiter limiter.Limiter
+	// Limiters are additional algorithms, by name, that rules can select
+	// with their algorithm field. Rules naming an algorithm missing here
+	// fall back to Limiter.
+	Limiters map[string]limiter.Limiter
+	// DefaultLimit and DefaultWindow apply to requests no rule matches.
+	DefaultLimit  int64
+	DefaultWindow time.Duration
+	// TrustProxy makes client IPs come from X-Forwarded-For / X-Real-IP
+	// instead of the connection's remote address.
+	TrustProxy bool
+	// TrustedProxies are the proxies allowed to append to
+	// X-Forwarded-For. The client IP is the rightmost address not among
+	// them; when empty, only the connection's peer is trusted and the
+	// rightmost address is used.
+	TrustedProxies []netip.Prefix
+	// DebugHeaders exposes X-Gatify-* diagnostics on every response.
+	DebugHeaders bool
+	// DebugToken, when set, exposes diagnostics on requests that present it
+	// in the X-Gatify-Debug header.
+	DebugToken string
+	// RuleLogger receives the verbose log of requests matching rules with
+	// debug enabled. It defaults to a text logger on stderr.
+	RuleLogger *slog.Logger
+	// Emergency, when set, applies the cluster-wide emergency throttle.
+	Emergency *emergency.Switch
+	// Health, when set, short-circuits requests with 503 while their
+	// upstream is failing its health checks, so clients do not spend their
+	// rate limit budget on requests that cannot succeed.
+	Health *upstream.Checker
+	// Breaker, when set, short-circuits requests with 503 while their
+	// upstream's recent responses are mostly failures, for the same reason.
+	Breaker *upstream.Breaker
+	// Shedder, when set, sheds requests with 503 while too many are in
+	// flight to the backends, lowest shed_priority first.
+	Shedder *shed.Shedder
+	// Bans, when set, records the clients honeypot rules and AutoBan ban
+	// and rejects their requests with 403.
+	Bans *ban.Store
+	// AutoBan bans clients whose requests keep being rate limited.
+	AutoBan ban.Policy
+	// DebugRing, when set, keeps the diagnostics of the last requests for
+	// inspection through the management API.
+	DebugRing *DebugRing
+	// CostEstimator, when set, prices each request so that it uses up
+	// that many hits of its limit instead of one.
+	CostEstimator CostEstimator
+	// Events, when set, receives an Event for every handled request.
+	Events EventSink
+	// HonorBackendLimits makes a backend 429 or Retry-After block the
+	// same client and rule at the gateway until the backoff elapses.
+	// Penalties are local to this instance.
+	HonorBackendLimits bool
+	// MaxBackendBackoff caps penalties derived from backend responses.
+	// Zero means no cap.
+	MaxBackendBackoff time.Duration
+	// NonceStore records the nonces of rules with replay protection.
+	// Without it replay protection is not enforced.
+	NonceStore storage.Storage
+	// ConcurrencyStore counts the in-flight requests of rules with
+	// max_concurrency. Without it concurrency limits are not enforced.
+	ConcurrencyStore storage.Storage
+	// Quotas counts requests against the daily and monthly quotas of
+	// rules. Without it quotas are not enforced.
+	Quotas *quota.Tracker
+	// WaitForRules makes the proxy answer 503 until MarkReady is called,
+	// so requests arriving while rules load at startup are not held to
+	// the default limit alone.
+	WaitForRules bool
+	// MaxRequestHeaders rejects requests carrying more header values with
+	// 431. Zero means no limit.
+	MaxRequestHeaders int
+	// Tracer records a span per request and propagates its trace context
+	// to the backend. Nil disables tracing.
+	Tracer *tracing.Tracer
+	// AuthorizeDryRun reports whether token, presented in the
+	// X-Gatify-Dry-Run header, may dry run requests. Nil disables dry
+	// runs.
+	AuthorizeDryRun func(ctx context.Context, token string) bool
+	// JWT verifies the bearer tokens of requests to rules identifying
+	// clients by JWT claim. Without it such requests are counted by IP.
+	JWT *jwtauth.Verifier
+}
+
+// GatewayProxy rate limits requests and forwards the allowed ones to the
+// backend.
+type GatewayProxy struct {
+	opts Options
+	// live holds the Settings Reconfigure can change, and backends the
+	// handler of each upstream by name, replaced when the default
+	// backend's URL changes.
+	live     atomic.Pointer[Settings]
+	backends atomic.Pointer[map[string]http.Handler]
+	matcher  atomic.Pointer[rules.Matcher]
+	policy   atomic.Pointer[Policy]
+	// rejections holds the parsed custom 429 bodies by rule ID.
+	rejections atomic.Pointer[map[string]rejectionBodies]
+	acl        atomic.Pointer[acl.List]
+	countries  atomic.Pointer[countrySource]
+	honeypots  atomic.Bool
+	ready      atomic.Bool
+	penalties  *penaltyBox
+	clock      monotonicClock
+	seq        atomic.Uint64
+}
+
+// Decision records how the gateway handled a request.
+type Decision struct {
+	// Received is when the request reached the gateway.
+	Received time.Time
+	// started is Received with a monotonic reading, for measuring how
+	// long the request took.
+	started time.Time
+	// Rule is the matched rule, or nil when the default limit applied.
+	Rule *rules.Rule
+	// Route is the matched path with parameters templated away, or the
+	// raw path when no rule matched.
+	Route string
+	// Upstream names the backend the request is routed to.
+	Upstream string
+	// Agent is the user agent family of the client, such as "bot".
+	Agent string
+	// Identity is the client identity the request was counted against.
+	Identity string
+	// IdentityError is why the request's bearer token could not identify
+	// the client, such as "expired", under a JWT claim rule.
+	IdentityError string
+	Key           string
+	Algorithm     string
+	// BackendLatency is how long the backend took to send its response
+	// headers, set once the request has been forwarded.
+	BackendLatency time.Duration
+	// Cost is how many hits the request counted as; see CostEstimator.
+	Cost   int64
+	Result limiter.Result
+	// RequestID is generated for requests whose rule rewrites headers
+	// with {request_id}.
+	RequestID string
+	// BlockReason classifies some rejections, such as
+	// BlockReasonHeaderViolation, for analytics.
+	BlockReason string
+	// Dimensions holds the backend response headers the rule captures.
+	// forward allocates it, so the response hook can fill it in through
+	// the copy of the Decision in the request context.
+	Dimensions map[string]string
+	// inboundURL is the request URL before the director rewrote it, from
+	// which a hedged attempt is routed to its own upstream.
+	inboundURL *url.URL
+}
+
+type decisionKey struct{}
+
+// DecisionFromContext returns the limiter decision attached to a proxied
+// request's context.
+func DecisionFromContext(ctx context.Context) (Decision, bool) {
+	d, ok := ctx.Value(decisionKey{}).(Decision)
+	return d, ok
+}
+
+// New creates a GatewayProxy with no rules loaded.
+func New(opts Options) *GatewayProxy {
+	p := &GatewayProxy{opts: opts}
+	backends := make(map[string]http.Handler, len(opts.Upstreams)+1)
+	if opts.Next != nil {
+		backends[upstream.DefaultTarget] = opts.Next
+	} else {
+		backends[upstream.DefaultTarget] = p.newReverseProxy(opts.Backend)
+		for name, u := range opts.Upstreams {
+			backends[name] = p.newReverseProxy(u)
+		}
+	}
+	p.backends.Store(&backends)
+	p.live.Store(&Settings{
+		Backend:        opts.Backend,
+		DefaultLimit:   opts.DefaultLimit,
+		DefaultWindow:  opts.DefaultWindow,
+		TrustProxy:     opts.TrustProxy,
+		TrustedProxies: opts.TrustedProxies,
+	})
+	if opts.RuleLogger == nil {
+		p.opts.RuleLogger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	if opts.HonorBackendLimits {
+		p.penalties = newPenaltyBox(opts.MaxBackendBackoff)
+	}
+
+	p.ready.Store(!opts.WaitForRules)
+	p.SetRules(nil)
+	return p
+}
+
+func (p *GatewayProxy) newReverseProxy(target *url.URL) *httputil.ReverseProxy {
+	rp := httputil.NewSingleHostReverseProxy(target)
+	direct := rp.Director
+	rp.Director = func(r *http.Request) {
+		direct(r)
+		r.Header.Del(debugTokenHeader)
+		if span := tracing.FromContext(r.Context()); span != nil {
+			r.Header.Set(tracing.TraceparentHeader, span.Context().Traceparent())
+		}
+		rewriteRequest(r)
+	}
+	rp.ModifyResponse = p.modifyResponse
+	base := p.opts.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	rp.Transport = &hedgingTransport{base: upstream.NewTransport(base), p: p}
+	rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("Proxy error for %s %s: %v", r.Method, r.URL.Path, err)
+		if errors.Is(err, errResponseTooLarge) {
+			writeJSONError(w, http.StatusBadGateway, "backend response too large")
+			return
+		}
+		// A client hanging up says nothing about the backend.
+		if !errors.Is(err, context.Canceled) {
+			p.recordOutcome(r, true)
+		}
+		writeJSONError(w, http.StatusBadGateway, "backend unavailable")
+	}
+	return rp
+}
+
+// SetRules atomically replaces the rules the proxy enforces.
+func (p *GatewayProxy) SetRules(list []rules.Rule) {
+	p.matcher.Store(rules.NewMatcher(list))
+	p.policy.Store(buildPolicy(list))
+	rejections := buildRejections(list)
+	p.rejections.Store(&rejections)
+	p.honeypots.Store(hasHoneypot(list))
+}
+
+// MarkReady starts serving traffic held back by WaitForRules.
+func (p *GatewayProxy) MarkReady() {
+	p.ready.Store(true)
+}
+
+// Ready reports whether the proxy serves traffic.
+func (p *GatewayProxy) Ready() bool {
+	return p.ready.Load()
+}
+
+// SetACL atomically replaces the IP allowlist and denylist.
+func (p *GatewayProxy) SetACL(entries []acl.Entry) {
+	p.acl.Store(acl.Compile(entries))
+}
+
+// ServeHTTP implements http.Handler.
+func (p *GatewayProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if isGRPC(r) {
+		// Streaming calls outlive the server's timeouts; gRPC clients
+		// bound them with their own deadlines.
+		rc := http.NewResponseController(w)
+		_ = rc.SetReadDeadline(time.Time{})
+		_ = rc.SetWriteDeadline(time.Time{})
+		w = newGRPCResponseWriter(w, r)
+	}
+	if p.opts.Tracer != nil {
+		remote, _ := tracing.ParseTraceparent(r.Header.Get(tracing.TraceparentHeader))
+		ctx, span := p.opts.Tracer.StartServer(r.Context(), r.Method, remote)
+		defer span.End()
+		r = r.WithContext(ctx)
+	}
+
+	decision := Decision{
+		Received: p.clock.now(),
+		started:  time.Now(),
+		Route:    r.URL.Path,
+		Upstream: upstream.DefaultTarget,
+		Agent:    useragent.Classify(r.UserAgent()),
+	}
+	live := p.live.Load()
+	limit, window := live.DefaultLimit, live.DefaultWindow
+
+	if m, ok := p.matcher.Load().MatchAgent(r.Method, r.URL.Path, decision.Agent); ok {
+		decision.Rule = &m.Rule
+		decision.Route = m.Route
+		if m.Rule.Upstream != "" {
+			decision.Upstream = m.Rule.Upstream
+		}
+		limit, window = m.Rule.Limit, m.Rule.Window()
+	}
+	rl := p.limiterFor(decision.Rule)
+	decision.Algorithm = rl.Algorithm()
+	decision.Identity, decision.IdentityError = p.identifyChecked(r, decision.Rule)
+	decision.Key = limiterKey(decision.Rule, decision.Identity)
+
+	if p.debugEnabled(r) {
+		setDebugHeaders(w.Header(), decision)
+	}
+
+	if !p.ready.Load() {
+		w.Header().Set("Retry-After", "1")
+		writeJSONError(w, http.StatusServiceUnavailable, "gateway starting")
+		p.publish(r, decision, false, http.StatusServiceUnavailable)
+		return
+	}
+
+	if r.Header.Get(dryRunHeader) != "" {
+		p.serveDryRun(w, r)
+		return
+	}
+
+	if herr := p.checkHeaders(r); herr != nil {
+		decision.BlockReason = BlockReasonHeaderViolation
+		writeJSONError(w, herr.status, herr.msg)
+		p.publish(r, decision, false, herr.status)
+		return
+	}
+
+	listed, onList := p.acl.Load().Lookup(p.clientAddr(r))
+	if onList && listed.Action == acl.ActionDeny {
+		writeJSONError(w, http.StatusForbidden, "forbidden")
+		p.publish(r, decision, false, http.StatusForbidden)
+		return
+	}
+
+	allowlisted := onList && listed.Action == acl.ActionAllow
+	if !allowlisted && p.banned(r, decision) {
+		decision.BlockReason = BlockReasonBanned
+		writeJSONError(w, http.StatusForbidden, "forbidden")
+		p.publish(r, decision, false, http.StatusForbidden)
+		return
+	}
+	if decision.Rule != nil && decision.Rule.Honeypot != nil {
+		// Allowlisted clients, such as internal scanners, are not banned,
+		// but the trap is never forwarded.
+		if !allowlisted {
+			p.springTrap(r, decision)
+		}
+		decision.BlockReason = BlockReasonHoneypot
+		writeJSONError(w, http.StatusNotFound, "not found")
+		p.publish(r, decision, false, http.StatusNotFound)
+		return
+	}
+	if decision.Rule != nil && decision.Rule.Action.Blocks() {
+		decision.BlockReason = BlockReasonRuleBlock
+		writeAction(w, decision.Rule.Action)
+		p.publish(r, decision, false, decision.Rule.Action.Status)
+		return
+	}
+
+	if p.opts.Emergency.Blocks(r.Method, r.URL.Path) {
+		writeJSONError(w, http.StatusServiceUnavailable, "temporarily unavailable")
+		p.publish(r, decision, false, http.StatusServiceUnavailable)
+		return
+	}
+	limit = p.opts.Emergency.ClampLimit(limit)
+
+	// Rules answering requests themselves do not depend on a backend.
+	local := answersItself(decision)
+	if _, ok := p.backend(decision.Upstream); !ok && !local {
+		log.Printf("Rule %s routes to unknown upstream %q", decision.Rule.ID, decision.Upstream)
+		writeJSONError(w, http.StatusBadGateway, "backend unavailable")
+		p.publish(r, decision, false, http.StatusBadGateway)
+		return
+	}
+	if !local && (!p.opts.Health.Healthy(decision.Upstream) || !p.opts.Breaker.Allow(decision.Upstream)) {
+		writeJSONError(w, http.StatusServiceUnavailable, "backend unavailable")
+		p.publish(r, decision, false, http.StatusServiceUnavailable)
+		return
+	}
+	if !local && !p.admit(decision) {
+		decision.BlockReason = BlockReasonShed
+		w.Header().Set("Retry-After", "1")
+		writeJSONError(w, http.StatusServiceUnavailable, "overloaded")
+		p.publish(r, decision, false, http.StatusServiceUnavailable)
+		return
+	}
+
+	// Allowlisted clients skip rate and concurrency limits, but not
+	// replay protection.
+	if allowlisted {
+		if rerr := p.checkReplay(r.Context(), r, decision.Rule); rerr != nil {
+			writeJSONError(w, rerr.status, rerr.msg)
+			p.publish(r, decision, false, rerr.status)
+			return
+		}
+		p.forward(w, r, decision)
+		return
+	}
+
+	if p.countryBlocked(r, decision.Rule) {
+		decision.BlockReason = BlockReasonCountry
+		writeJSONError(w, http.StatusForbidden, "forbidden")
+		p.publish(r, decision, false, http.StatusForbidden)
+		return
+	}
+
+	if p.penalties != nil {
+		if until, ok := p.penalties.blocked(decision.Key, time.Now()); ok && !shadowed(&decision) {
+			p.writeRateLimited(w, r, decision, until)
+			p.publish(r, decision, false, http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	var progressive *rules.Progressive
+	var burst int64
+	if decision.Rule != nil {
+		progressive = decision.Rule.Progressive
+		burst = decision.Rule.Burst
+	}
+	costCtx, cost := p.chargeCost(r, decision.Rule)
+	if burst > 0 {
+		costCtx = storage.WithBurst(costCtx, burst)
+	}
+	decision.Cost = cost
+	res, err := rl.Allow(costCtx, decision.Key, progressive.CountingLimit(limit), window)
+	if err != nil {
+		// Fail open on the rate limit only: an unavailable limiter must
+		// not take the API down, nor switch off the other protections.
+		log.Printf("Rate limiter error for %s: %v", decision.Key, err)
+		p.serveAdmitted(w, r, decision)
+		return
+	}
+	res, degrade := progressiveTier(progressive, limit, res)
+	decision.Result = res
+
+	// A shadow rule leaves no trace on the response: no headers, no
+	// pauses and no 429, only the would-be block in its event.
+	if isShadow(decision.Rule) {
+		if degrade == tierReject || degrade == tierTarpit {
+			shadowed(&decision)
+		}
+		degrade, res.Delay = tierNone, 0
+	} else {
+		h := w.Header()
+		h.Set("X-RateLimit-Limit", strconv.FormatInt(res.Limit, 10))
+		h.Set("X-RateLimit-Remaining", strconv.FormatInt(res.Remaining, 10))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(res.ResetAt.Unix(), 10))
+		h.Set("RateLimit-Policy", strconv.FormatInt(res.Limit, 10)+";w="+strconv.FormatInt(int64(window/time.Second), 10))
+		if cost > 1 {
+			h.Set("X-RateLimit-Cost", strconv.FormatInt(cost, 10))
+		}
+		if burst > 0 {
+			h.Set("X-RateLimit-Burst", strconv.FormatInt(burst, 10))
+			h.Set("X-RateLimit-Burst-Remaining", strconv.FormatInt(res.BurstRemaining, 10))
+		}
+	}
+
+	switch degrade {
+	case tierTarpit:
+		pause(r.Context(), time.Duration(progressive.TarpitMS)*time.Millisecond)
+		fallthrough
+	case tierReject:
+		if !allowlisted {
+			p.strike(r, decision)
+		}
+		p.writeRateLimited(w, r, decision, res.ResetAt)
+		p.publish(r, decision, false, http.StatusTooManyRequests)
+		return
+	case tierDelay:
+		pause(r.Context(), time.Duration(progressive.DelayMS)*time.Millisecond)
+	}
+
+	// A smoothing limiter spaces admitted requests out by holding them
+	// until their slot comes up.
+	pause(r.Context(), res.Delay)
+
+	p.serveAdmitted(w, r, decision)
+}
+
+// serveAdmitted forwards a request the rate limit admitted, after replay
+// protection, the quota and the concurrency limit.
+func (p *GatewayProxy) serveAdmitted(w http.ResponseWriter, r *http.Request, decision Decision) {
+	// Nonces are recorded only once the limiter admitted the request, so
+	// a sender retrying after a 429 is not mistaken for a replay.
+	if rerr := p.checkReplay(r.Context(), r, decision.Rule); rerr != nil {
+		writeJSONError(w, rerr.status, rerr.msg)
+		p.publish(r, decision, false, rerr.status)
+		return
+	}
+
+	// The quota is long-horizon, so it is only spent on requests the rate
+	// limit and replay protection let through.
+	if !p.checkQuota(w, r, decision) && !shadowed(&decision) {
+		p.publish(r, decision, false, http.StatusTooManyRequests)
+		return
+	}
+
+	release, ok := p.acquireSlot(r.Context(), decision)
+	if !ok {
+		if !shadowed(&decision) {
+			writeTooManyRequests(w, r, "too many concurrent requests", 1)
+			p.publish(r, decision, false, http.StatusTooManyRequests)
+			return
+		}
+		release = func() {}
+	}
+	defer release()
+
+	p.forward(w, r, decision)
+}
+
+// BlockReasonShed marks requests shed because the backends were
+// saturated.
+const BlockReasonShed = "shed"
+
+// admit asks the shedder whether the request may go to the backend.
+func (p *GatewayProxy) admit(d Decision) bool {
+	if d.Rule == nil {
+		return p.opts.Shedder.Admit("", 0)
+	}
+	return p.opts.Shedder.Admit(d.Rule.ID, d.Rule.ShedPriority)
+}
+
+// limiterFor returns the limiter enforcing rule, honouring the rule's
+// algorithm when one is configured.
+func (p *GatewayProxy) limiterFor(rule *rules.Rule) limiter.Limiter {
+	if rule != nil && rule.Algorithm != "" {
+		if l, ok := p.opts.Limiters[rule.Algorithm]; ok {
+			return l
+		}
+	}
+	return p.opts.Limiter
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write([]byte(`{"error":"` + msg + `"}`)); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,881 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/acl"
+	"github.com/Siruyy/gatify/internal/emergency"
+	"github.com/Siruyy/gatify/internal/limiter"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/shed"
+	"github.com/Siruyy/gatify/internal/storage"
+	"github.com/Siruyy/gatify/internal/tracing"
+	"github.com/Siruyy/gatify/internal/upstream"
+)
+
+// countingLimiter allows limit hits per key.
+type countingLimiter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	keys   []string
+	err    error
+}
+
+func newCountingLimiter() *countingLimiter {
+	return &countingLimiter{counts: make(map[string]int64)}
+}
+
+func (l *countingLimiter) Allow(_ context.Context, key string, limit int64, window time.Duration) (limiter.Result, error) {
+	if l.err != nil {
+		return limiter.Result{}, l.err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.keys = append(l.keys, key)
+	if l.counts[key] >= limit {
+		return limiter.Result{Limit: limit, ResetAt: time.Now().Add(window)}, nil
+	}
+	l.counts[key]++
+	return limiter.Result{
+		Allowed:   true,
+		Limit:     limit,
+		Remaining: limit - l.counts[key],
+		ResetAt:   time.Now().Add(window),
+	}, nil
+}
+
+func (l *countingLimiter) Algorithm() string { return "counting" }
+
+func newTestProxy(t *testing.T, lim limiter.Limiter, mutate func(*Options)) (*GatewayProxy, *httptest.Server) {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(debugTokenHeader) != "" {
+			t.Errorf("Debug token leaked to backend")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(backend.Close)
+
+	u, _ := url.Parse(backend.URL)
+	opts := Options{
+		Backend:       u,
+		Limiter:       lim,
+		DefaultLimit:  2,
+		DefaultWindow: time.Minute,
+	}
+	if mutate != nil {
+		mutate(&opts)
+	}
+	return New(opts), backend
+}
+
+func serve(p http.Handler, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	return w
+}
+
+func TestProxyEnforcesDefaultLimit(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), nil)
+
+	for i := 0; i < 2; i++ {
+		if w := serve(p, "GET", "/anything", nil); w.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+
+	w := serve(p, "GET", "/anything", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", w.Code)
+	}
+	if w.Header().Get("X-RateLimit-Limit") != "2" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("Unexpected rate limit headers %v", w.Header())
+	}
+}
+
+func TestProxyServesNextHandler(t *testing.T) {
+	var decision Decision
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision, _ = DecisionFromContext(r.Context())
+		w.WriteHeader(http.StatusAccepted)
+	})
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) { o.Next = next })
+
+	if w := serve(p, "GET", "/anything", nil); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected the next handler's 202, got %d", w.Code)
+	}
+	if decision.Identity != "ip:10.0.0.1" || decision.Result.Remaining != 1 {
+		t.Errorf("Expected the decision in the next handler's context, got %+v", decision)
+	}
+	serve(p, "GET", "/anything", nil)
+	if w := serve(p, "GET", "/anything", nil); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 without calling the next handler, got %d", w.Code)
+	}
+}
+
+func TestProxyUsesMatchedRule(t *testing.T) {
+	lim := newCountingLimiter()
+	p, _ := newTestProxy(t, lim, nil)
+	p.SetRules([]rules.Rule{{
+		ID: "r1", Name: "keys", Pattern: "/v1/*", Limit: 5, WindowSeconds: 60,
+		IdentifyBy: rules.IdentifyByHeader, HeaderName: "X-Api-Key", Enabled: true,
+	}})
+
+	w := serve(p, "GET", "/v1/items", map[string]string{"X-Api-Key": "abc"})
+	if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "5" {
+		t.Fatalf("Expected rule limit 5, got %d %v", w.Code, w.Header())
+	}
+	serve(p, "GET", "/v1/items", nil)
+
+	want := []string{"gatify:rl:{r1}:header:abc", "gatify:rl:{r1}:ip:10.0.0.1"}
+	for i, k := range want {
+		if lim.keys[i] != k {
+			t.Errorf("Key %d = %s, want %s", i, lim.keys[i], k)
+		}
+	}
+}
+
+func TestProxyNamespacesLimiterKeys(t *testing.T) {
+	lim := newCountingLimiter()
+	p, _ := newTestProxy(t, lim, nil)
+	p.SetRules([]rules.Rule{{
+		ID: "r1", Name: "acme", Pattern: "/acme/*", Limit: 5, WindowSeconds: 60, Namespace: "acme", Enabled: true,
+	}})
+
+	serve(p, "GET", "/acme/items", nil)
+	if want := "gatify:rl:ns:acme:{r1}:ip:10.0.0.1"; len(lim.keys) != 1 || lim.keys[0] != want {
+		t.Errorf("Keys = %v, want [%s]", lim.keys, want)
+	}
+	if index, _ := storage.IndexKey(lim.keys[0]); index != "gatify:rl:ns:acme:{r1}:index" {
+		t.Errorf("Expected the key tracked in the namespaced rule index, got %s", index)
+	}
+}
+
+func TestProxyIdentifiesByCookie(t *testing.T) {
+	lim := newCountingLimiter()
+	p, _ := newTestProxy(t, lim, nil)
+	p.SetRules([]rules.Rule{{
+		ID: "r1", Name: "sessions", Pattern: "/*", Limit: 5, WindowSeconds: 60,
+		IdentifyBy: rules.IdentifyByCookie, CookieName: "sid", KeyTransforms: []string{"sha256"}, Enabled: true,
+	}})
+
+	serve(p, "GET", "/cart", map[string]string{"Cookie": "theme=dark; sid=session-1"})
+	serve(p, "GET", "/cart", map[string]string{"Cookie": "theme=dark"})
+	serve(p, "GET", "/cart", map[string]string{"Cookie": "sid=" + strings.Repeat("a", maxIdentityValue+1)})
+
+	want := []string{
+		"gatify:rl:{r1}:cookie:84097828fc31a8c8d29210df48901a85",
+		// The transforms apply to the IP fallback as well.
+		"gatify:rl:{r1}:ip:f5047344122f0dee9974ba6761e61c6b",
+		"gatify:rl:{r1}:ip:f5047344122f0dee9974ba6761e61c6b",
+	}
+	for i, k := range want {
+		if lim.keys[i] != k {
+			t.Errorf("Key %d = %s, want %s", i, lim.keys[i], k)
+		}
+	}
+}
+
+func TestProxyMatchesRulesByAgentFamily(t *testing.T) {
+	lim := newCountingLimiter()
+	var events []Event
+	p, _ := newTestProxy(t, lim, func(o *Options) {
+		o.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	})
+	p.SetRules([]rules.Rule{{
+		ID: "crawlers", Name: "crawlers", Pattern: "/*", Limit: 1, WindowSeconds: 60,
+		Agents: []string{"bot"}, Enabled: true,
+	}})
+
+	bot := map[string]string{"User-Agent": "Mozilla/5.0 (compatible; Googlebot/2.1)"}
+	serve(p, "GET", "/products", bot)
+	if w := serve(p, "GET", "/products", bot); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the crawler rule to limit bots, got %d", w.Code)
+	}
+	browser := map[string]string{"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0"}
+	if w := serve(p, "GET", "/products", browser); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "2" {
+		t.Fatalf("Expected browsers to get the default limit, got %d %v", w.Code, w.Header())
+	}
+	if events[0].Agent != "bot" || events[2].Agent != "browser" || events[2].RuleID != "" {
+		t.Errorf("Unexpected events %+v", events)
+	}
+}
+
+func TestProxyShedsLowPriorityUnderLoad(t *testing.T) {
+	shedder := shed.New(1, 2)
+	var events []Event
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.DefaultLimit = 100
+		o.Shedder = shedder
+		o.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	})
+	p.SetRules([]rules.Rule{{
+		ID: "checkout", Name: "checkout", Pattern: "/checkout", Limit: 100, WindowSeconds: 60,
+		ShedPriority: shed.MaxPriority, Enabled: true,
+	}})
+
+	if w := serve(p, "GET", "/search", nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 below the threshold, got %d", w.Code)
+	}
+
+	done := shedder.Begin() // a request still in flight
+	defer done()
+	w := serve(p, "GET", "/search", nil)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("Expected default traffic to be shed, got %d %v", w.Code, w.Header())
+	}
+	if w := serve(p, "GET", "/checkout", nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected the high-priority rule to keep flowing, got %d", w.Code)
+	}
+	if events[1].BlockReason != BlockReasonShed || events[1].Allowed {
+		t.Errorf("Expected the shed request's event to say so, got %+v", events[1])
+	}
+	if st := shedder.Stats(); st.Shed != 1 || st.ByRule[""] != 1 || st.InFlight != 1 {
+		t.Errorf("Unexpected shedding stats %+v", st)
+	}
+}
+
+func TestProxyNormalizesIdentity(t *testing.T) {
+	lim := newCountingLimiter()
+	p, _ := newTestProxy(t, lim, func(o *Options) { o.TrustProxy = true })
+	p.SetRules([]rules.Rule{
+		{ID: "keys", Pattern: "/v1/*", Limit: 5, WindowSeconds: 60, IdentifyBy: rules.IdentifyByHeader,
+			HeaderName: "X-Api-Key", KeyTransforms: []string{"trim", "lowercase"}, Enabled: true},
+		{ID: "nets", Pattern: "/v2/*", Limit: 5, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP,
+			KeyTransforms: []string{"ipv4_prefix:24"}, Enabled: true},
+	})
+
+	serve(p, "GET", "/v1/a", map[string]string{"X-Api-Key": "ABC"})
+	serve(p, "GET", "/v1/a", map[string]string{"X-Api-Key": "abc "})
+	serve(p, "GET", "/v2/a", map[string]string{"X-Forwarded-For": "198.51.100.7"})
+	serve(p, "GET", "/v2/a", map[string]string{"X-Forwarded-For": "198.51.100.200"})
+
+	want := []string{
+		"gatify:rl:{keys}:header:abc",
+		"gatify:rl:{keys}:header:abc",
+		"gatify:rl:{nets}:ip:198.51.100.0/24",
+		"gatify:rl:{nets}:ip:198.51.100.0/24",
+	}
+	for i, k := range want {
+		if lim.keys[i] != k {
+			t.Errorf("Key %d = %s, want %s", i, lim.keys[i], k)
+		}
+	}
+}
+
+func TestProxyFailsOpen(t *testing.T) {
+	lim := newCountingLimiter()
+	lim.err = errors.New("redis down")
+	p, _ := newTestProxy(t, lim, nil)
+
+	if w := serve(p, "GET", "/", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected request to pass when limiter fails, got %d", w.Code)
+	}
+}
+
+func TestProxyIdentifiesByFirstPresentHeader(t *testing.T) {
+	lim := newCountingLimiter()
+	p, _ := newTestProxy(t, lim, nil)
+	p.SetRules([]rules.Rule{{
+		ID: "r1", Pattern: "/v1/*", Limit: 5, WindowSeconds: 60, IdentifyBy: rules.IdentifyByHeader,
+		HeaderNames: []string{"X-Api-Key", "Authorization", "Cf-Connecting-Ip"}, Enabled: true,
+	}})
+
+	serve(p, "GET", "/v1/a", map[string]string{"X-Api-Key": "key", "Authorization": "Bearer t"})
+	serve(p, "GET", "/v1/a", map[string]string{"Authorization": "Bearer t", "CF-Connecting-IP": "192.0.2.1"})
+	serve(p, "GET", "/v1/a", map[string]string{"CF-Connecting-IP": "192.0.2.1"})
+	serve(p, "GET", "/v1/a", nil)
+	// Oversized values count as absent.
+	serve(p, "GET", "/v1/a", map[string]string{"X-Api-Key": strings.Repeat("k", maxIdentityValue+1), "CF-Connecting-IP": "192.0.2.1"})
+	serve(p, "GET", "/v1/a", map[string]string{"X-Api-Key": strings.Repeat("k", maxIdentityValue+1)})
+
+	want := []string{
+		"gatify:rl:{r1}:header:key",
+		"gatify:rl:{r1}:header:Bearer t",
+		"gatify:rl:{r1}:header:192.0.2.1",
+		"gatify:rl:{r1}:ip:10.0.0.1",
+		"gatify:rl:{r1}:header:192.0.2.1",
+		"gatify:rl:{r1}:ip:10.0.0.1",
+	}
+	for i, k := range want {
+		if lim.keys[i] != k {
+			t.Errorf("Key %d = %s, want %s", i, lim.keys[i], k)
+		}
+	}
+}
+
+func TestProxyIdentifiesByCompositeKey(t *testing.T) {
+	lim := newCountingLimiter()
+	p, _ := newTestProxy(t, lim, nil)
+	p.SetRules([]rules.Rule{
+		{ID: "r1", Pattern: "/v1/*", Limit: 5, WindowSeconds: 60, IdentifyBy: "ip+header",
+			HeaderName: "X-Api-Key", KeyTransforms: []string{"lowercase"}, Enabled: true},
+		{ID: "r2", Pattern: "/v2/*", Limit: 5, WindowSeconds: 60, IdentifyBy: "{ip}:{header:X-Tenant}", Enabled: true},
+		{ID: "r3", Pattern: "/v3/*", Limit: 5, WindowSeconds: 60, IdentifyBy: "{header:X-Tenant}/{cookie:sid}", Enabled: true},
+	})
+
+	serve(p, "GET", "/v1/a", map[string]string{"X-Api-Key": "KEY"})
+	serve(p, "GET", "/v1/a", nil)
+	serve(p, "GET", "/v2/a", map[string]string{"X-Tenant": "acme"})
+	serve(p, "GET", "/v3/a", map[string]string{"Cookie": "sid=s1"})
+	serve(p, "GET", "/v3/a", nil)
+	// Values that look like a missing part or a separator are escaped.
+	serve(p, "GET", "/v1/a", map[string]string{"X-Api-Key": "-"})
+	serve(p, "GET", "/v3/a", map[string]string{"X-Tenant": "a/b", "Cookie": "sid=c"})
+	serve(p, "GET", "/v3/a", map[string]string{"X-Tenant": "a", "Cookie": "sid=b/c"})
+
+	want := []string{
+		"gatify:rl:{r1}:ip:10.0.0.1+header:key",
+		"gatify:rl:{r1}:ip:10.0.0.1+header:-",
+		"gatify:rl:{r2}:key:10.0.0.1:acme",
+		"gatify:rl:{r3}:key:-/s1",
+		// Nothing to combine: counted by IP like other rules.
+		"gatify:rl:{r3}:ip:10.0.0.1",
+		"gatify:rl:{r1}:ip:10.0.0.1+header:%2D",
+		"gatify:rl:{r3}:key:a%2Fb/c",
+		"gatify:rl:{r3}:key:a/b%2Fc",
+	}
+	if len(lim.keys) != len(want) {
+		t.Fatalf("Expected %d keys, got %v", len(want), lim.keys)
+	}
+	for i, k := range want {
+		if lim.keys[i] != k {
+			t.Errorf("Key %d = %s, want %s", i, lim.keys[i], k)
+		}
+	}
+}
+
+func TestProxyTrustProxy(t *testing.T) {
+	lim := newCountingLimiter()
+	p, _ := newTestProxy(t, lim, func(o *Options) {
+		o.TrustProxy = true
+		o.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	})
+
+	serve(p, "GET", "/", map[string]string{"X-Forwarded-For": "203.0.113.9, 10.0.0.2"})
+	if lim.keys[0] != "gatify:rl:{global}:ip:203.0.113.9" {
+		t.Errorf("Expected forwarded client IP, got %s", lim.keys[0])
+	}
+
+	untrusted, _ := newTestProxy(t, lim, nil)
+	serve(untrusted, "GET", "/", map[string]string{"X-Forwarded-For": "203.0.113.9"})
+	if lim.keys[1] != "gatify:rl:{global}:ip:10.0.0.1" {
+		t.Errorf("Expected remote address when proxy untrusted, got %s", lim.keys[1])
+	}
+
+	// Without a trusted list only the peer is trusted, so the entry it
+	// appended is the client.
+	peerOnly, _ := newTestProxy(t, lim, func(o *Options) { o.TrustProxy = true })
+	serve(peerOnly, "GET", "/", map[string]string{"X-Forwarded-For": "203.0.113.9, 198.51.100.4"})
+	if lim.keys[2] != "gatify:rl:{global}:ip:198.51.100.4" {
+		t.Errorf("Expected the rightmost forwarded IP, got %s", lim.keys[2])
+	}
+
+	// A peer outside the trusted list cannot forward for anyone.
+	stranger := httptest.NewRequest("GET", "/", nil)
+	stranger.RemoteAddr = "192.0.2.1:1234"
+	stranger.Header.Set("X-Forwarded-For", "203.0.113.9")
+	p.ServeHTTP(httptest.NewRecorder(), stranger)
+	if lim.keys[3] != "gatify:rl:{global}:ip:192.0.2.1" {
+		t.Errorf("Expected an untrusted peer's address, got %s", lim.keys[3])
+	}
+}
+
+func TestProxySpoofedForwardedForDoesNotBypassLimits(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.TrustProxy = true
+		o.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	})
+	p.SetACL([]acl.Entry{{ID: "monitor", CIDR: "198.51.100.7/32", Action: acl.ActionAllow}})
+
+	// The load balancer appends the real client after whatever the
+	// client sent; claiming the allowlisted address and rotating fake
+	// ones must not escape the default limit of 2.
+	for i := 0; i < 3; i++ {
+		spoofed := fmt.Sprintf("198.51.100.7, 192.0.2.%d, 203.0.113.9", i)
+		w := serve(p, "GET", "/api/items", map[string]string{"X-Forwarded-For": spoofed})
+		if i < 2 && w.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d", i, w.Code)
+		}
+		if i == 2 && w.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected the spoofed request to be limited, got %d", w.Code)
+		}
+	}
+}
+
+func TestProxyPublishesEvents(t *testing.T) {
+	var events []Event
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.DefaultLimit = 1
+		o.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	})
+	p.SetRules([]rules.Rule{{ID: "r1", Pattern: "/limited", Limit: 1, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Enabled: true}})
+
+	serve(p, "GET", "/limited", nil)
+	serve(p, "GET", "/limited", nil)
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if !events[0].Allowed || events[0].Status != http.StatusOK || events[0].RuleID != "r1" {
+		t.Errorf("Unexpected allowed event %+v", events[0])
+	}
+	if events[1].Allowed || events[1].Status != http.StatusTooManyRequests {
+		t.Errorf("Unexpected blocked event %+v", events[1])
+	}
+	if events[1].ClientID != "ip:10.0.0.1" || events[1].Path != "/limited" || events[1].Route != "/limited" || events[1].Limit != 1 {
+		t.Errorf("Unexpected event details %+v", events[1])
+	}
+	if events[0].Seq != 1 || events[1].Seq != 2 || !events[1].Timestamp.After(events[0].Timestamp) {
+		t.Errorf("Expected ordered events, got seq %d@%v then %d@%v",
+			events[0].Seq, events[0].Timestamp, events[1].Seq, events[1].Timestamp)
+	}
+}
+
+func TestProxySkipsEventsOfSyntheticRequests(t *testing.T) {
+	var events []Event
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	})
+
+	req := httptest.NewRequest("GET", "/canary", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req.WithContext(Synthetic(req.Context())))
+	if w.Code != http.StatusOK || len(events) != 0 {
+		t.Errorf("Expected the synthetic request proxied without an event, got %d and %d events", w.Code, len(events))
+	}
+}
+
+func TestProxyShortCircuitsUnhealthyBackend(t *testing.T) {
+	lim := newCountingLimiter()
+	u, _ := url.Parse("http://backend")
+	health := upstream.NewChecker([]upstream.Target{{
+		Name:  upstream.DefaultTarget,
+		URL:   u,
+		Check: upstream.HealthCheck{Path: "/healthz", Interval: time.Hour},
+	}}, nil)
+	p, _ := newTestProxy(t, lim, func(o *Options) { o.Health = health })
+
+	// With a cancelled context Run probes once, fails and returns.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	health.Run(ctx)
+
+	if w := serve(p, "GET", "/", nil); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 for unhealthy backend, got %d", w.Code)
+	}
+	if len(lim.keys) != 0 {
+		t.Error("Expected unhealthy backend not to consume rate limit budget")
+	}
+}
+
+func TestProxyEventRecordsBackendResponse(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello world"))
+	}))
+	defer backend.Close()
+
+	var events []Event
+	u, _ := url.Parse(backend.URL)
+	p := New(Options{
+		Backend:       u,
+		Limiter:       newCountingLimiter(),
+		DefaultLimit:  10,
+		DefaultWindow: time.Minute,
+		Events:        EventSinkFunc(func(e Event) { events = append(events, e) }),
+	})
+
+	serve(p, "POST", "/items", nil)
+	if len(events) != 1 || events[0].Status != http.StatusCreated || events[0].Bytes != 11 {
+		t.Fatalf("Expected status 201 and 11 bytes, got %+v", events)
+	}
+	if events[0].Duration < 20*time.Millisecond {
+		t.Errorf("Expected the backend's delay in the duration, got %v", events[0].Duration)
+	}
+	if events[0].BackendLatency < 20*time.Millisecond || events[0].BackendLatency > events[0].Duration {
+		t.Errorf("Expected the backend latency within the duration, got %v of %v", events[0].BackendLatency, events[0].Duration)
+	}
+}
+
+func TestProxyEventSkipsInformationalStatus(t *testing.T) {
+	var events []Event
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.Next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Link", "</style.css>; rel=preload")
+			w.WriteHeader(http.StatusEarlyHints)
+			w.WriteHeader(http.StatusAccepted)
+		})
+		o.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	})
+
+	serve(p, "GET", "/", nil)
+	if len(events) != 1 || events[0].Status != http.StatusAccepted {
+		t.Fatalf("Expected 202 recorded after early hints, got %+v", events)
+	}
+	if events[0].BackendLatency <= 0 {
+		t.Errorf("Expected a backend latency for a forwarded request, got %v", events[0].BackendLatency)
+	}
+
+	events = nil
+	serve(p, "GET", "/", nil)
+	if w := serve(p, "GET", "/", nil); w.Code != http.StatusTooManyRequests || events[len(events)-1].BackendLatency != 0 {
+		t.Errorf("Expected no backend latency for a rejected request, got %+v", events[len(events)-1])
+	}
+}
+
+func TestMultiSink(t *testing.T) {
+	var a, b []Event
+	sink := MultiSink(
+		EventSinkFunc(func(e Event) { a = append(a, e) }),
+		EventSinkFunc(func(e Event) { b = append(b, e) }),
+	)
+	sink.Publish(Event{Path: "/x"})
+	if len(a) != 1 || len(b) != 1 || b[0].Path != "/x" {
+		t.Errorf("Expected the event in both sinks, got %v and %v", a, b)
+	}
+}
+
+func TestProxyPublishesShadowDecision(t *testing.T) {
+	var events []Event
+	primary := newCountingLimiter()
+	candidate := newCountingLimiter()
+	shadow := limiter.NewShadow(primary, candidate)
+	p, _ := newTestProxy(t, shadow, func(o *Options) {
+		o.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	})
+
+	serve(p, "GET", "/", nil)
+	if len(events) != 1 || events[0].ShadowAllowed == nil || !*events[0].ShadowAllowed {
+		t.Fatalf("Expected shadow decision on event, got %+v", events)
+	}
+	if events[0].ShadowAlgorithm != "counting" {
+		t.Errorf("ShadowAlgorithm = %q", events[0].ShadowAlgorithm)
+	}
+}
+
+// memStore backs the emergency switch and nonce tracking in tests.
+type memStore struct {
+	storage.Storage
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func (m *memStore) Set(_ context.Context, key, value string, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = value
+	return nil
+}
+
+func (m *memStore) SetNX(_ context.Context, key, value string, _ time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.data[key]; ok {
+		return false, nil
+	}
+	m.data[key] = value
+	return true, nil
+}
+
+func TestProxyEmergencyThrottle(t *testing.T) {
+	sw := emergency.NewSwitch(&memStore{data: make(map[string]string)}, time.Second)
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.DefaultLimit = 10
+		o.Emergency = sw
+	})
+
+	if _, err := sw.Activate(context.Background(), emergency.State{
+		LimitFactor: 0.2,
+		BlockPaths:  []string{"/export/*"},
+	}, 0); err != nil {
+		t.Fatalf("Activate() error = %v", err)
+	}
+
+	if w := serve(p, "GET", "/export/all", nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected blocked path to return 503, got %d", w.Code)
+	}
+
+	w := serve(p, "GET", "/items", nil)
+	if w.Header().Get("X-RateLimit-Limit") != "2" {
+		t.Errorf("Expected limit clamped to 2, got %s", w.Header().Get("X-RateLimit-Limit"))
+	}
+	serve(p, "GET", "/items", nil)
+	if w := serve(p, "GET", "/items", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected clamped limit to reject third request, got %d", w.Code)
+	}
+}
+
+func TestDebugHeaders(t *testing.T) {
+	rule := rules.Rule{ID: "r1", Name: "login", Pattern: "/login", Limit: 1, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Enabled: true}
+
+	t.Run("hidden by default", func(t *testing.T) {
+		p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) { o.DebugToken = "dbg" })
+		w := serve(p, "GET", "/login", nil)
+		if w.Header().Get(HeaderMatchedRule) != "" {
+			t.Error("Expected no debug headers without token")
+		}
+		w = serve(p, "GET", "/login", map[string]string{debugTokenHeader: "wrong"})
+		if w.Header().Get(HeaderMatchedRule) != "" {
+			t.Error("Expected no debug headers with wrong token")
+		}
+	})
+
+	t.Run("per request token", func(t *testing.T) {
+		p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) { o.DebugToken = "dbg" })
+		p.SetRules([]rules.Rule{rule})
+
+		serve(p, "GET", "/login", nil)
+		w := serve(p, "GET", "/login", map[string]string{debugTokenHeader: "dbg"})
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expected 429, got %d", w.Code)
+		}
+		if got := w.Header().Get(HeaderMatchedRule); got != "r1 (login)" {
+			t.Errorf("Matched rule header = %q", got)
+		}
+		if got := w.Header().Get(HeaderKey); got != "gatify:rl:{r1}:ip:10.0.0.1" {
+			t.Errorf("Key header = %q", got)
+		}
+		if got := w.Header().Get(HeaderAlgorithm); got != "counting" {
+			t.Errorf("Algorithm header = %q", got)
+		}
+	})
+
+	t.Run("global dev mode", func(t *testing.T) {
+		p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) { o.DebugHeaders = true })
+		w := serve(p, "GET", "/other", nil)
+		if got := w.Header().Get(HeaderMatchedRule); got != "global" {
+			t.Errorf("Matched rule header = %q, want global", got)
+		}
+	})
+}
+
+func TestProxyRoutesRulesToUpstreams(t *testing.T) {
+	users := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "users")
+	}))
+	t.Cleanup(users.Close)
+	usersURL, _ := url.Parse(users.URL)
+
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.DefaultLimit = 100
+		o.Upstreams = map[string]*url.URL{"users": usersURL}
+	})
+	p.SetRules([]rules.Rule{
+		{ID: "users", Pattern: "/users/*", Limit: 100, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Upstream: "users", Enabled: true},
+		{ID: "typo", Pattern: "/billing/*", Limit: 100, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Upstream: "biling", Enabled: true},
+	})
+
+	if w := serve(p, "GET", "/users/42", nil); w.Code != http.StatusOK || w.Header().Get("X-Served-By") != "users" {
+		t.Errorf("Expected /users to reach the users upstream, got %d %v", w.Code, w.Header())
+	}
+	if w := serve(p, "GET", "/other", nil); w.Code != http.StatusOK || w.Header().Get("X-Served-By") != "" {
+		t.Errorf("Expected unrouted paths to reach the default backend, got %d %v", w.Code, w.Header())
+	}
+	if w := serve(p, "GET", "/billing/1", nil); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 for an unknown upstream, got %d", w.Code)
+	}
+}
+
+// delayingLimiter admits every request but asks for it to be held.
+type delayingLimiter struct {
+	delay time.Duration
+}
+
+func (l delayingLimiter) Allow(_ context.Context, _ string, limit int64, window time.Duration) (limiter.Result, error) {
+	return limiter.Result{Allowed: true, Limit: limit, Remaining: limit - 1, ResetAt: time.Now().Add(window), Delay: l.delay}, nil
+}
+
+func (l delayingLimiter) Algorithm() string { return limiter.AlgorithmLeakyBucket }
+
+func TestProxyUsesRuleAlgorithm(t *testing.T) {
+	lim := newCountingLimiter()
+	p, _ := newTestProxy(t, lim, func(o *Options) {
+		o.DebugHeaders = true
+		o.Limiters = map[string]limiter.Limiter{limiter.AlgorithmLeakyBucket: delayingLimiter{delay: 50 * time.Millisecond}}
+	})
+	p.SetRules([]rules.Rule{
+		{ID: "smooth", Pattern: "/search", Limit: 5, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP,
+			Algorithm: limiter.AlgorithmLeakyBucket, Enabled: true},
+		{ID: "gcra", Pattern: "/other", Limit: 5, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP,
+			Algorithm: limiter.AlgorithmGCRA, Enabled: true},
+	})
+
+	start := time.Now()
+	w := serve(p, "GET", "/search", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected request to be held for its slot, took %v", elapsed)
+	}
+	if got := w.Header().Get("X-Gatify-Algorithm"); got != limiter.AlgorithmLeakyBucket {
+		t.Errorf("X-Gatify-Algorithm = %q, want %s", got, limiter.AlgorithmLeakyBucket)
+	}
+	if len(lim.keys) != 0 {
+		t.Errorf("Expected default limiter to be bypassed, counted %v", lim.keys)
+	}
+
+	// An algorithm the proxy has no limiter for falls back to the default.
+	w = serve(p, "GET", "/other", nil)
+	if got := w.Header().Get("X-Gatify-Algorithm"); got != "counting" || len(lim.keys) != 1 {
+		t.Errorf("Expected fallback to default limiter, got %q with keys %v", got, lim.keys)
+	}
+}
+
+func TestProxyLogsDebugRules(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) { o.RuleLogger = logger })
+	p.SetRules([]rules.Rule{
+		{ID: "loud", Pattern: "/loud", Limit: 5, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Debug: true, Enabled: true},
+		{ID: "quiet", Pattern: "/quiet", Limit: 5, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Enabled: true},
+	})
+
+	serve(p, "GET", "/quiet", nil)
+	serve(p, "GET", "/", nil)
+	if buf.Len() != 0 {
+		t.Fatalf("Expected no debug output for other traffic, got %s", buf.String())
+	}
+
+	serve(p, "GET", "/loud", map[string]string{"Authorization": "Bearer secret", "X-Trace": "t1"})
+	var entry struct {
+		RuleID    string              `json:"rule_id"`
+		Headers   map[string][]string `json:"headers"`
+		Allowed   bool                `json:"allowed"`
+		Remaining int64               `json:"remaining"`
+		Status    int                 `json:"status"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Decode log entry %q: %v", buf.String(), err)
+	}
+	if entry.RuleID != "loud" || !entry.Allowed || entry.Remaining != 4 || entry.Status != http.StatusOK {
+		t.Errorf("Unexpected log entry %+v", entry)
+	}
+	if entry.Headers["X-Trace"][0] != "t1" || entry.Headers["Authorization"][0] != "[redacted]" {
+		t.Errorf("Unexpected logged headers %v", entry.Headers)
+	}
+}
+
+func TestProxyCircuitBreaker(t *testing.T) {
+	lim := newCountingLimiter()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+	breaker := upstream.NewBreaker(upstream.BreakerConfig{MinRequests: 2, OpenDuration: time.Hour})
+	p := New(Options{Backend: u, Limiter: lim, DefaultLimit: 100, DefaultWindow: time.Minute, Breaker: breaker})
+
+	for i := 0; i < 2; i++ {
+		if w := serve(p, "GET", "/", nil); w.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected backend 500 to pass through, got %d", w.Code)
+		}
+	}
+	if w := serve(p, "GET", "/", nil); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 once the circuit opened, got %d", w.Code)
+	}
+	if len(lim.keys) != 2 {
+		t.Errorf("Expected short-circuited request not to consume budget, limiter saw %d", len(lim.keys))
+	}
+	if st := breaker.Statuses(); len(st) != 1 || st[0].State != upstream.CircuitOpen || st[0].ShortCircuited != 1 {
+		t.Errorf("Unexpected breaker status %+v", st)
+	}
+}
+
+func TestProxyPropagatesTraceContext(t *testing.T) {
+	var got string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Traceparent")
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+	tracer := tracing.NewTracer(tracing.NewExporter("http://collector:4318", "gatify", nil), 1)
+	p := New(Options{Backend: u, Limiter: newCountingLimiter(), DefaultLimit: 10, DefaultWindow: time.Minute, Tracer: tracer})
+
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	serve(p, "GET", "/api/items", map[string]string{"Traceparent": incoming})
+	sc, ok := tracing.ParseTraceparent(got)
+	want, _ := tracing.ParseTraceparent(incoming)
+	if !ok || sc.TraceID != want.TraceID || sc.SpanID == want.SpanID || !sc.Sampled {
+		t.Errorf("Expected the backend to join the caller's trace, got traceparent %q", got)
+	}
+
+	// Without one, the gateway starts the trace.
+	serve(p, "GET", "/api/items", nil)
+	if sc, ok := tracing.ParseTraceparent(got); !ok || sc.TraceID == want.TraceID {
+		t.Errorf("Expected a new trace, got traceparent %q", got)
+	}
+}
+
+func TestProxyACL(t *testing.T) {
+	var events []Event
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.TrustProxy = true
+		o.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	})
+	p.SetACL([]acl.Entry{
+		{ID: "scanners", CIDR: "203.0.113.0/24", Action: acl.ActionDeny},
+		{ID: "monitor", CIDR: "198.51.100.7/32", Action: acl.ActionAllow},
+	})
+
+	w := serve(p, "GET", "/api/items", map[string]string{"X-Forwarded-For": "203.0.113.9"})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a denied client, got %d", w.Code)
+	}
+	if len(events) != 1 || events[0].Allowed || events[0].Status != http.StatusForbidden {
+		t.Errorf("Expected a rejected event, got %+v", events)
+	}
+
+	// The default limit is 2, but allowlisted clients are never limited.
+	for i := 0; i < 5; i++ {
+		w := serve(p, "GET", "/api/items", map[string]string{"X-Forwarded-For": "198.51.100.7"})
+		if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "" {
+			t.Fatalf("Request %d: expected an unlimited 200, got %d %v", i, w.Code, w.Header())
+		}
+	}
+
+	// Everyone else is limited as usual, and the list can be replaced.
+	serve(p, "GET", "/api/items", nil)
+	serve(p, "GET", "/api/items", nil)
+	if w := serve(p, "GET", "/api/items", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 for an unlisted client, got %d", w.Code)
+	}
+	p.SetACL(nil)
+	if w := serve(p, "GET", "/api/items", map[string]string{"X-Forwarded-For": "203.0.113.9"}); w.Code != http.StatusOK {
+		t.Errorf("Expected a cleared list to stop blocking, got %d", w.Code)
+	}
+}
+
+func TestProxyWaitsForRules(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) { o.WaitForRules = true })
+
+	w := serve(p, "GET", "/api", nil)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected 503 before rules load, got %d", w.Code)
+	}
+	p.MarkReady()
+	if w := serve(p, "GET", "/api", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected traffic once ready, got %d", w.Code)
+	}
+}
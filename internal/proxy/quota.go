@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// checkQuota counts an admitted request against its rule's quota and sets
+// the X-Quota-* headers. It returns false when the quota is used up. Like
+// the limiter it fails open when storage is unavailable.
+func (p *GatewayProxy) checkQuota(w http.ResponseWriter, r *http.Request, d Decision) bool {
+	if d.Rule == nil || d.Rule.Quota <= 0 || p.opts.Quotas == nil {
+		return true
+	}
+	res, err := p.opts.Quotas.Check(withScopeIndex(r.Context(), d.Rule), d.Rule.Namespace, d.Rule.ID, d.Identity, d.Rule.Quota, d.Rule.QuotaPeriod)
+	if err != nil {
+		log.Printf("Quota error for %s: %v", d.Key, err)
+		return true
+	}
+	if isShadow(d.Rule) {
+		return res.Allowed
+	}
+
+	h := w.Header()
+	h.Set("X-Quota-Limit", strconv.FormatInt(res.Limit, 10))
+	h.Set("X-Quota-Remaining", strconv.FormatInt(res.Remaining, 10))
+	h.Set("X-Quota-Reset", strconv.FormatInt(res.ResetAt.Unix(), 10))
+	if !res.Allowed {
+		writeTooManyRequests(w, r, "quota exceeded", int64(time.Until(res.ResetAt).Seconds()+1))
+	}
+	return res.Allowed
+}
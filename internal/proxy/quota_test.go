@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/quota"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestProxyEnforcesQuota(t *testing.T) {
+	lim := newCountingLimiter()
+	p, _ := newTestProxy(t, lim, func(o *Options) {
+		o.Quotas = quota.NewTracker(storage.NewMemoryStorage(), nil)
+	})
+	p.SetRules([]rules.Rule{{ID: "r1", Pattern: "/api/*", Limit: 100, WindowSeconds: 60,
+		IdentifyBy: rules.IdentifyByIP, Quota: 2, QuotaPeriod: quota.PeriodDay, Enabled: true}})
+
+	for i, remaining := range []string{"1", "0"} {
+		w := serve(p, "GET", "/api/items", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: got %d", i, w.Code)
+		}
+		if w.Header().Get("X-Quota-Limit") != "2" || w.Header().Get("X-Quota-Remaining") != remaining || w.Header().Get("X-Quota-Reset") == "" {
+			t.Errorf("request %d: quota headers %v", i, w.Header())
+		}
+	}
+
+	w := serve(p, "GET", "/api/items", nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected 429 once the quota is used up, got %d", w.Code)
+	}
+	if w := serve(p, "GET", "/other", nil); w.Code != http.StatusOK || w.Header().Get("X-Quota-Limit") != "" {
+		t.Errorf("Expected routes without a quota unaffected, got %d %v", w.Code, w.Header())
+	}
+}
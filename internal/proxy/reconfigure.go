@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/upstream"
+)
+
+// Settings are the Options a running GatewayProxy can change through
+// Reconfigure.
+type Settings struct {
+	Backend       *url.URL
+	DefaultLimit  int64
+	DefaultWindow time.Duration
+	TrustProxy    bool
+	// TrustedProxies replaces Options.TrustedProxies.
+	TrustedProxies []netip.Prefix
+}
+
+// Settings returns the settings requests are currently handled with.
+func (p *GatewayProxy) Settings() Settings {
+	return *p.live.Load()
+}
+
+// Reconfigure applies s to requests arriving from now on; requests in
+// flight finish with the settings they started with, so no connection is
+// dropped. A nil Backend keeps the current one, and a gateway created
+// with Next keeps handing requests to it.
+func (p *GatewayProxy) Reconfigure(s Settings) {
+	cur := p.live.Load()
+	if s.Backend == nil {
+		s.Backend = cur.Backend
+	}
+	if p.opts.Next == nil && s.Backend.String() != cur.Backend.String() {
+		backends := maps.Clone(*p.backends.Load())
+		backends[upstream.DefaultTarget] = p.newReverseProxy(s.Backend)
+		p.backends.Store(&backends)
+	}
+	p.live.Store(&s)
+}
+
+// CloseIdleConnections closes the idle connections of every backend's
+// transport, for example once their addresses have changed.
+func (p *GatewayProxy) CloseIdleConnections() {
+	for _, h := range *p.backends.Load() {
+		if rp, ok := h.(*httputil.ReverseProxy); ok {
+			if c, ok := rp.Transport.(interface{ CloseIdleConnections() }); ok {
+				c.CloseIdleConnections()
+			}
+		}
+	}
+}
+
+// backend returns the handler forwarding to the named upstream.
+func (p *GatewayProxy) backend(name string) (http.Handler, bool) {
+	h, ok := (*p.backends.Load())[name]
+	return h, ok
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestReconfigureSwitchesBackend(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) { o.DefaultLimit = 100 })
+
+	replacement := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer replacement.Close()
+	u, _ := url.Parse(replacement.URL)
+
+	if w := serve(p, "GET", "/a", nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected original backend, got %d", w.Code)
+	}
+	s := p.Settings()
+	s.Backend = u
+	p.Reconfigure(s)
+	if w := serve(p, "GET", "/a", nil); w.Code != http.StatusTeapot {
+		t.Errorf("Expected replacement backend, got %d", w.Code)
+	}
+
+	s.Backend = nil
+	p.Reconfigure(s)
+	if got := p.Settings().Backend; got.String() != u.String() {
+		t.Errorf("Expected nil backend to keep %s, got %s", u, got)
+	}
+}
+
+func TestReconfigureDefaultsAndTrustProxy(t *testing.T) {
+	lim := newCountingLimiter()
+	p, _ := newTestProxy(t, lim, nil)
+
+	p.Reconfigure(Settings{DefaultLimit: 1, DefaultWindow: time.Minute, TrustProxy: true})
+	xff := map[string]string{"X-Forwarded-For": "1.2.3.4"}
+	if w := serve(p, "GET", "/a", xff); w.Code != http.StatusOK {
+		t.Fatalf("Expected first request allowed, got %d", w.Code)
+	}
+	if w := serve(p, "GET", "/a", xff); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the lowered default limit to apply, got %d", w.Code)
+	}
+	if w := serve(p, "GET", "/a", map[string]string{"X-Forwarded-For": "5.6.7.8"}); w.Code != http.StatusOK {
+		t.Errorf("Expected forwarded address to be trusted, got %d", w.Code)
+	}
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// rejectionBodies are a rule's parsed rejection templates, the primary
+// body first, with their content types for negotiation.
+type rejectionBodies struct {
+	contentTypes []string
+	templates    []rules.RejectionTemplate
+}
+
+// buildRejections parses the custom rejection bodies of list by rule ID.
+// Rules are validated before they are stored, so parse failures are only
+// logged.
+func buildRejections(list []rules.Rule) map[string]rejectionBodies {
+	out := make(map[string]rejectionBodies)
+	for _, r := range list {
+		if r.Rejection == nil {
+			continue
+		}
+		var bodies rejectionBodies
+		for _, variant := range append([]rules.Rejection{*r.Rejection}, r.Rejection.Alternatives...) {
+			tmpl, err := variant.Template()
+			if err != nil {
+				log.Printf("Rule %s has an invalid rejection body: %v", r.ID, err)
+				continue
+			}
+			bodies.contentTypes = append(bodies.contentTypes, variant.ContentType)
+			bodies.templates = append(bodies.templates, tmpl)
+		}
+		if len(bodies.templates) > 0 {
+			out[r.ID] = bodies
+		}
+	}
+	return out
+}
+
+// retryAfterSeconds rounds the wait until resetAt up to whole seconds, as
+// Retry-After requires, and never advertises less than one second.
+func retryAfterSeconds(resetAt, now time.Time) int64 {
+	wait := resetAt.Sub(now)
+	secs := int64(wait / time.Second)
+	if wait%time.Second > 0 {
+		secs++
+	}
+	return max(secs, 1)
+}
+
+// setRejectionCaching tells caches in front of the gateway how to treat a
+// 429: by default not to store it, since it only concerns one client, or,
+// when the rule has a RejectionMaxAge, to serve it for up to that long or
+// retry seconds, varying on the headers identifying the client. Clients
+// identified by IP, because the rule's headers were missing, are never
+// shared, since the cache cannot tell them apart. Clients themselves are
+// told not to reuse it.
+func setRejectionCaching(h http.Header, rule *rules.Rule, identity string, retry int64) {
+	h.Set("Cache-Status", `Gatify; detail="rate-limited"`)
+	if rule == nil || rule.RejectionMaxAge == 0 || strings.HasPrefix(identity, "ip:") {
+		h.Set("Cache-Control", "private, no-store")
+		return
+	}
+	h.Set("Cache-Control", "public, max-age=0, s-maxage="+strconv.FormatInt(min(rule.RejectionMaxAge, retry), 10))
+	switch rule.IdentifyBy {
+	case rules.IdentifyByHeader:
+		for _, name := range rule.IdentityHeaders() {
+			h.Add("Vary", name)
+		}
+	case rules.IdentifyByCookie:
+		h.Add("Vary", "Cookie")
+	case rules.IdentifyByJWTClaim:
+		h.Add("Vary", "Authorization")
+	default:
+		parts, _ := rule.IdentityParts()
+		for _, part := range parts {
+			switch {
+			case part.Source == rules.IdentifyByHeader && part.Name != "":
+				h.Add("Vary", part.Name)
+			case part.Source == rules.IdentifyByHeader:
+				for _, name := range rule.IdentityHeaders() {
+					h.Add("Vary", name)
+				}
+			case part.Source == rules.IdentifyByCookie:
+				h.Add("Vary", "Cookie")
+			}
+		}
+	}
+}
+
+// writeRateLimited sends the 429 for a request that must wait until
+// resetAt, using the matched rule's rejection body when it has one. Both
+// the rule's bodies and the default one are chosen by the request's
+// Accept header.
+func (p *GatewayProxy) writeRateLimited(w http.ResponseWriter, r *http.Request, d Decision, resetAt time.Time) {
+	retry := retryAfterSeconds(resetAt, time.Now())
+	setRejectionCaching(w.Header(), d.Rule, d.Identity, retry)
+
+	if d.Rule != nil {
+		if bodies, ok := (*p.rejections.Load())[d.Rule.ID]; ok {
+			i := negotiate(r.Header.Get("Accept"), bodies.contentTypes)
+			var buf bytes.Buffer
+			err := bodies.templates[i].Execute(&buf, rules.RejectionData{
+				Rule:       d.Rule.Name,
+				Limit:      d.Rule.Limit,
+				RetryAfter: retry,
+				ResetAt:    resetAt,
+			})
+			if err == nil {
+				h := w.Header()
+				h.Set("Retry-After", strconv.FormatInt(retry, 10))
+				h.Set("Content-Type", bodies.contentTypes[i])
+				if len(bodies.contentTypes) > 1 {
+					h.Add("Vary", "Accept")
+				}
+				w.WriteHeader(http.StatusTooManyRequests)
+				if _, err := buf.WriteTo(w); err != nil {
+					log.Printf("Failed to write response: %v", err)
+				}
+				return
+			}
+			log.Printf("Rule %s rejection body failed to render: %v", d.Rule.ID, err)
+		}
+	}
+	writeTooManyRequests(w, r, "rate limit exceeded", retry)
+}
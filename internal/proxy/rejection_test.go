@@ -0,0 +1,224 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/limiter"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestRetryAfterSeconds(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		reset time.Time
+		want  int64
+	}{
+		{now.Add(30 * time.Second), 30},
+		{now.Add(1500 * time.Millisecond), 2},
+		{now.Add(10 * time.Millisecond), 1},
+		{now.Add(-time.Second), 1},
+	}
+	for _, tt := range tests {
+		if got := retryAfterSeconds(tt.reset, now); got != tt.want {
+			t.Errorf("retryAfterSeconds(%v) = %d, want %d", tt.reset.Sub(now), got, tt.want)
+		}
+	}
+}
+
+func TestProxyGCRARetryAfterIsOneInterval(t *testing.T) {
+	lim := limiter.NewGCRA(storage.NewMemoryStorage())
+	p, _ := newTestProxy(t, lim, func(o *Options) { o.DefaultLimit = 3 })
+
+	for i := 0; i < 3; i++ {
+		serve(p, "GET", "/", nil)
+	}
+	// One request drains every 20s, so the client can retry then rather
+	// than when the whole bucket has drained a minute from now.
+	w := serve(p, "GET", "/", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", w.Code)
+	}
+	if ra := w.Header().Get("Retry-After"); ra != "20" {
+		t.Errorf("Retry-After = %q, want 20", ra)
+	}
+}
+
+func TestProxyRejectionSetsRetryAfter(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) { o.DefaultLimit = 1 })
+
+	serve(p, "GET", "/", nil)
+	w := serve(p, "GET", "/", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", w.Code)
+	}
+	// The counting limiter resets a minute from now.
+	if ra := w.Header().Get("Retry-After"); ra != "60" {
+		t.Errorf("Retry-After = %q, want 60", ra)
+	}
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected the default JSON body, got %q", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestProxyRejectionCaching(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) { o.DefaultLimit = 1 })
+	p.SetRules([]rules.Rule{{
+		ID: "r1", Name: "search", Pattern: "/search", Limit: 1, WindowSeconds: 60,
+		IdentifyBy: rules.IdentifyByHeader, HeaderNames: []string{"X-Api-Key", "Authorization"},
+		RejectionMaxAge: 10, Enabled: true,
+	}})
+
+	w := serve(p, "GET", "/", nil)
+	if got := w.Header().Get("RateLimit-Policy"); got != "1;w=60" {
+		t.Errorf("RateLimit-Policy = %q, want 1;w=60", got)
+	}
+	if w.Header().Get("Cache-Status") != "" {
+		t.Errorf("Cache-Status set on an admitted request")
+	}
+	w = serve(p, "GET", "/", nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Cache-Control") != "private, no-store" {
+		t.Errorf("Default 429 = %d with Cache-Control %q, want private, no-store", w.Code, w.Header().Get("Cache-Control"))
+	}
+	if got := w.Header().Get("Cache-Status"); got != `Gatify; detail="rate-limited"` {
+		t.Errorf("Cache-Status = %q", got)
+	}
+
+	key := map[string]string{"X-Api-Key": "k1"}
+	serve(p, "GET", "/search", key)
+	w = serve(p, "GET", "/search", key)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Cache-Control") != "public, max-age=0, s-maxage=10" {
+		t.Errorf("Cacheable 429 = %d with Cache-Control %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+	if vary := w.Header().Values("Vary"); !slices.Contains(vary, "X-Api-Key") || !slices.Contains(vary, "Authorization") {
+		t.Errorf("Vary = %v, want the identity headers", vary)
+	}
+
+	// Without the headers the client is identified by IP, which a cache
+	// cannot see, so its 429 must not be shared.
+	serve(p, "GET", "/search", nil)
+	w = serve(p, "GET", "/search", nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Cache-Control") != "private, no-store" {
+		t.Errorf("IP fallback 429 = %d with Cache-Control %q, want private, no-store", w.Code, w.Header().Get("Cache-Control"))
+	}
+}
+
+func TestSetRejectionCachingStopsAtRetryAfter(t *testing.T) {
+	h := http.Header{}
+	setRejectionCaching(h, &rules.Rule{IdentifyBy: rules.IdentifyByCookie, RejectionMaxAge: 30}, "cookie:abc", 4)
+	if h.Get("Cache-Control") != "public, max-age=0, s-maxage=4" || h.Get("Vary") != "Cookie" {
+		t.Errorf("headers = %v, want s-maxage=4 varying on Cookie", h)
+	}
+}
+
+func TestSetRejectionCachingVariesOnCompositeIdentity(t *testing.T) {
+	h := http.Header{}
+	setRejectionCaching(h, &rules.Rule{IdentifyBy: "{header:X-Tenant}:{cookie:sid}", RejectionMaxAge: 30}, "key:acme:s1", 10)
+	if vary := h.Values("Vary"); !slices.Equal(vary, []string{"X-Tenant", "Cookie"}) {
+		t.Errorf("Vary = %v, want the tenant header and Cookie", vary)
+	}
+}
+
+func TestProxyCustomRejectionBody(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), nil)
+	p.SetRules([]rules.Rule{{
+		ID: "r1", Name: "<search>", Pattern: "/search", Limit: 1, WindowSeconds: 60,
+		IdentifyBy: rules.IdentifyByIP, Enabled: true,
+		Rejection: &rules.Rejection{
+			ContentType: "text/html; charset=utf-8",
+			Body:        "<h1>Slow down</h1><p>{{.Rule}}: {{.Limit}} per minute, retry in {{.RetryAfter}}s</p>",
+		},
+	}})
+
+	serve(p, "GET", "/search", nil)
+	w := serve(p, "GET", "/search", nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatalf("Expected HTML 429, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	want := "<h1>Slow down</h1><p>&lt;search&gt;: 1 per minute, retry in 60s</p>"
+	if body := w.Body.String(); body != want {
+		t.Errorf("Body = %q, want %q", body, want)
+	}
+	if w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Retry-After = %q", w.Header().Get("Retry-After"))
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	offered := []string{"application/json", "application/xml; charset=utf-8", "text/plain", "text/html; charset=utf-8"}
+	tests := []struct {
+		accept string
+		want   int
+	}{
+		{"", 0},
+		{"*/*", 0},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", 3},
+		{"application/xml", 1},
+		{"text/*", 2},
+		{"text/*;q=0.5, text/html;q=0.4", 2},
+		{"text/plain;q=0, */*;q=0.1", 0},
+		{"image/png", 0},
+		{"garbage", 0},
+	}
+	for _, tt := range tests {
+		if got := negotiate(tt.accept, offered); got != tt.want {
+			t.Errorf("negotiate(%q) = %d, want %d", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestProxyRejectionFollowsAccept(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) { o.DefaultLimit = 1 })
+	serve(p, "GET", "/", nil)
+
+	tests := []struct {
+		accept, contentType, body string
+	}{
+		{"application/xml", "application/xml; charset=utf-8", "<retry_after>60</retry_after>"},
+		{"text/plain", "text/plain; charset=utf-8", "rate limit exceeded, retry in 60 seconds"},
+		{"text/html", "text/html; charset=utf-8", "<h1>Too Many Requests</h1>"},
+		{"application/json", "application/json", `{"error":"rate limit exceeded"}`},
+	}
+	for _, tt := range tests {
+		w := serve(p, "GET", "/", map[string]string{"Accept": tt.accept})
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("Accept %s: got %d %q", tt.accept, w.Code, w.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("Accept %s: body %q lacks %q", tt.accept, w.Body.String(), tt.body)
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("Accept %s: Vary = %q", tt.accept, w.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestProxyCustomRejectionAlternatives(t *testing.T) {
+	p, _ := newTestProxy(t, newCountingLimiter(), nil)
+	p.SetRules([]rules.Rule{{
+		ID: "r1", Name: "search", Pattern: "/search", Limit: 1, WindowSeconds: 60,
+		IdentifyBy: rules.IdentifyByIP, Enabled: true,
+		Rejection: &rules.Rejection{
+			ContentType: "application/json",
+			Body:        `{"error":"slow down","retry_after":{{.RetryAfter}}}`,
+			Alternatives: []rules.Rejection{
+				{ContentType: "text/plain", Body: "slow down, retry in {{.RetryAfter}}s"},
+			},
+		},
+	}})
+	serve(p, "GET", "/search", nil)
+
+	w := serve(p, "GET", "/search", map[string]string{"Accept": "text/plain"})
+	if w.Header().Get("Content-Type") != "text/plain" || w.Body.String() != "slow down, retry in 60s" {
+		t.Errorf("Expected the plain text alternative, got %q %q", w.Header().Get("Content-Type"), w.Body.String())
+	}
+	// Types the rule does not offer fall back to its primary body.
+	w = serve(p, "GET", "/search", map[string]string{"Accept": "text/html"})
+	if w.Header().Get("Content-Type") != "application/json" || w.Body.String() != `{"error":"slow down","retry_after":60}` {
+		t.Errorf("Expected the primary body, got %q %q", w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
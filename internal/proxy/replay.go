@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// maxNonceLength bounds nonces so they cannot bloat storage keys.
+const maxNonceLength = 256
+
+// replayError is a request rejected by replay protection.
+type replayError struct {
+	status int
+	msg    string
+}
+
+// checkReplay enforces the rule's replay protection by recording the
+// request's nonce. It returns nil for requests that may proceed, including
+// when nonce storage is unavailable: like the limiter, replay protection
+// fails open.
+func (p *GatewayProxy) checkReplay(ctx context.Context, r *http.Request, rule *rules.Rule) *replayError {
+	if rule == nil || rule.Replay == nil || p.opts.NonceStore == nil {
+		return nil
+	}
+	cfg := rule.Replay
+	ttl := time.Duration(cfg.TTLSeconds) * time.Second
+
+	nonce := strings.TrimSpace(r.Header.Get(cfg.NonceHeader))
+	if nonce == "" {
+		return &replayError{http.StatusBadRequest, "missing " + cfg.NonceHeader + " header"}
+	}
+	if len(nonce) > maxNonceLength {
+		return &replayError{http.StatusBadRequest, cfg.NonceHeader + " header too long"}
+	}
+
+	if cfg.TimestampHeader != "" {
+		sent, err := strconv.ParseInt(strings.TrimSpace(r.Header.Get(cfg.TimestampHeader)), 10, 64)
+		if err != nil {
+			return &replayError{http.StatusBadRequest, "missing or invalid " + cfg.TimestampHeader + " header"}
+		}
+		if skew := time.Since(time.Unix(sent, 0)); skew > ttl || skew < -ttl {
+			return &replayError{http.StatusBadRequest, "request timestamp outside the accepted window"}
+		}
+	}
+
+	fresh, err := p.opts.NonceStore.SetNX(ctx, nonceKey(rule.ID, nonce), "1", ttl)
+	if err != nil {
+		log.Printf("Replay protection error for rule %s: %v", rule.ID, err)
+		return nil
+	}
+	if !fresh {
+		return &replayError{http.StatusConflict, "request replayed"}
+	}
+	return nil
+}
+
+func nonceKey(ruleID, nonce string) string {
+	return fmt.Sprintf("gatify:nonce:{%s}:%s", ruleID, nonce)
+}
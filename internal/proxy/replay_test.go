@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+func TestProxyReplayProtection(t *testing.T) {
+	store := &memStore{data: make(map[string]string)}
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.DefaultLimit = 100
+		o.NonceStore = store
+	})
+	p.SetRules([]rules.Rule{{
+		ID: "hooks", Pattern: "/webhooks/*", Limit: 100, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Enabled: true,
+		Replay: &rules.ReplayProtection{NonceHeader: "X-Webhook-Id", TimestampHeader: "X-Webhook-Timestamp", TTLSeconds: 300},
+	}})
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"first delivery", map[string]string{"X-Webhook-Id": "evt_1", "X-Webhook-Timestamp": now}, http.StatusOK},
+		{"replayed", map[string]string{"X-Webhook-Id": "evt_1", "X-Webhook-Timestamp": now}, http.StatusConflict},
+		{"new nonce", map[string]string{"X-Webhook-Id": "evt_2", "X-Webhook-Timestamp": now}, http.StatusOK},
+		{"missing nonce", map[string]string{"X-Webhook-Timestamp": now}, http.StatusBadRequest},
+		{"missing timestamp", map[string]string{"X-Webhook-Id": "evt_3"}, http.StatusBadRequest},
+		{"stale timestamp", map[string]string{"X-Webhook-Id": "evt_4", "X-Webhook-Timestamp": stale}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := serve(p, "POST", "/webhooks/stripe", tt.headers); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, w.Code, w.Body.String())
+		}
+	}
+
+	if _, ok := store.data["gatify:nonce:{hooks}:evt_4"]; ok {
+		t.Error("Expected a rejected timestamp not to record its nonce")
+	}
+	if w := serve(p, "POST", "/other", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected routes without replay protection to pass, got %d", w.Code)
+	}
+}
+
+func TestProxyReplayNonceNotSpentOnRateLimit(t *testing.T) {
+	store := &memStore{data: make(map[string]string)}
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) { o.NonceStore = store })
+	p.SetRules([]rules.Rule{{
+		ID: "hooks", Pattern: "/webhooks/*", Limit: 1, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Enabled: true,
+		Replay: &rules.ReplayProtection{NonceHeader: "X-Webhook-Id", TTLSeconds: 300},
+	}})
+
+	serve(p, "POST", "/webhooks/a", map[string]string{"X-Webhook-Id": "evt_1"})
+	if w := serve(p, "POST", "/webhooks/a", map[string]string{"X-Webhook-Id": "evt_2"}); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", w.Code)
+	}
+	if _, ok := store.data["gatify:nonce:{hooks}:evt_2"]; ok {
+		t.Error("Expected a rate limited request not to record its nonce")
+	}
+}
+
+func TestProxyReplayProtectionWhenLimiterFails(t *testing.T) {
+	lim := newCountingLimiter()
+	lim.err = errors.New("redis down")
+	store := &memStore{data: make(map[string]string)}
+	p, _ := newTestProxy(t, lim, func(o *Options) { o.NonceStore = store })
+	p.SetRules([]rules.Rule{{
+		ID: "hooks", Pattern: "/webhooks/*", Limit: 1, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Enabled: true,
+		Replay: &rules.ReplayProtection{NonceHeader: "X-Webhook-Id", TTLSeconds: 300},
+	}})
+
+	headers := map[string]string{"X-Webhook-Id": "evt_1"}
+	if w := serve(p, "POST", "/webhooks/a", headers); w.Code != http.StatusOK {
+		t.Fatalf("Expected the limiter to fail open, got %d", w.Code)
+	}
+	if w := serve(p, "POST", "/webhooks/a", headers); w.Code != http.StatusConflict {
+		t.Errorf("Expected a replay to be rejected while the limiter fails, got %d", w.Code)
+	}
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+)
+
+// errResponseTooLarge aborts a backend response that exceeds its rule's
+// MaxResponseBytes before anything is written to the client.
+var errResponseTooLarge = errors.New("backend response too large")
+
+// modifyResponse is the reverse proxy's ModifyResponse hook.
+func (p *GatewayProxy) modifyResponse(resp *http.Response) error {
+	if resp.Request != nil {
+		p.recordOutcome(resp.Request, resp.StatusCode >= http.StatusInternalServerError)
+	}
+	if err := p.observeBackend(resp); err != nil {
+		return err
+	}
+	captureHeaders(resp)
+	setCacheHeaders(resp)
+	rewriteResponse(resp)
+	return limitResponse(resp)
+}
+
+// recordOutcome feeds the result of a forwarded request to the circuit
+// breaker of its upstream, or of the hedge target that answered it.
+func (p *GatewayProxy) recordOutcome(r *http.Request, failed bool) {
+	if name, ok := hedgeUpstream(r.Context()); ok {
+		p.opts.Breaker.Record(name, failed)
+		return
+	}
+	if d, ok := DecisionFromContext(r.Context()); ok {
+		p.opts.Breaker.Record(d.Upstream, failed)
+	}
+}
+
+// maxDimensionBytes caps a captured header value, so a backend cannot
+// bloat events with large headers.
+const maxDimensionBytes = 128
+
+// captureHeaders records the backend response headers the matched rule
+// captures as event dimensions, before any rewrite removes them.
+func captureHeaders(resp *http.Response) {
+	if resp.Request == nil {
+		return
+	}
+	d, ok := DecisionFromContext(resp.Request.Context())
+	if !ok || d.Dimensions == nil {
+		return
+	}
+	for _, name := range d.Rule.CaptureHeaders {
+		if v := resp.Header.Get(name); v != "" {
+			d.Dimensions[name] = truncate(v, maxDimensionBytes)
+		}
+	}
+}
+
+// setCacheHeaders applies the matched rule's cache headers, replacing
+// whatever the backend sent so CDN behavior is governed centrally.
+func setCacheHeaders(resp *http.Response) {
+	if resp.Request == nil {
+		return
+	}
+	d, ok := DecisionFromContext(resp.Request.Context())
+	if !ok || d.Rule == nil {
+		return
+	}
+	for name, value := range d.Rule.CacheHeaders {
+		resp.Header.Set(name, value)
+	}
+}
+
+// limitResponse enforces the matched rule's response size cap. Responses
+// with a declared length are checked up front; others are buffered up to
+// the cap so an oversized body still ends in a clean 502 rather than a
+// truncated 200.
+func limitResponse(resp *http.Response) error {
+	if resp.Request == nil {
+		return nil
+	}
+	d, ok := DecisionFromContext(resp.Request.Context())
+	if !ok || d.Rule == nil || d.Rule.MaxResponseBytes <= 0 {
+		return nil
+	}
+	max := d.Rule.MaxResponseBytes
+
+	if resp.ContentLength > max {
+		resp.Body.Close()
+		return fmt.Errorf("%w: %d bytes declared, rule %s allows %d", errResponseTooLarge, resp.ContentLength, d.Rule.ID, max)
+	}
+	if resp.ContentLength >= 0 {
+		resp.Body = &cappedBody{ReadCloser: resp.Body, remaining: max}
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > max {
+		return fmt.Errorf("%w: more than %d bytes streamed, rule %s", errResponseTooLarge, max, d.Rule.ID)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.TransferEncoding = nil
+	return nil
+}
+
+// cappedBody guards against a backend sending more than the Content-Length
+// it declared.
+type cappedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *cappedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Probe for excess data instead of reporting a clean EOF.
+		var one [1]byte
+		if n, _ := b.ReadCloser.Read(one[:]); n > 0 {
+			return 0, errResponseTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8
+// sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+func TestProxyResponseSizeLimit(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := strings.Repeat("x", 10)
+		if strings.HasSuffix(r.URL.Path, "/big") {
+			body = strings.Repeat("x", 100)
+		}
+		if strings.HasPrefix(r.URL.Path, "/stream") {
+			// Flushing forces chunked encoding with no Content-Length.
+			w.(http.Flusher).Flush()
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer backend.Close()
+
+	u, _ := url.Parse(backend.URL)
+	p := New(Options{Backend: u, Limiter: newCountingLimiter(), DefaultLimit: 100, DefaultWindow: time.Minute})
+	p.SetRules([]rules.Rule{
+		{ID: "capped", Pattern: "/*", Limit: 100, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, MaxResponseBytes: 50, Enabled: true},
+		{ID: "open", Pattern: "/open/*", Priority: 1, Limit: 100, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Enabled: true},
+	})
+
+	tests := []struct {
+		path     string
+		wantCode int
+		wantLen  int
+	}{
+		{"/fixed/small", http.StatusOK, 10},
+		{"/fixed/big", http.StatusBadGateway, -1},
+		{"/stream/small", http.StatusOK, 10},
+		{"/stream/big", http.StatusBadGateway, -1},
+		{"/open/big", http.StatusOK, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := serve(p, "GET", tt.path, nil)
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantLen >= 0 && w.Body.Len() != tt.wantLen {
+				t.Errorf("Expected %d body bytes, got %d", tt.wantLen, w.Body.Len())
+			}
+			if tt.wantCode == http.StatusBadGateway && !strings.Contains(w.Body.String(), "too large") {
+				t.Errorf("Unexpected error body %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestProxyRuleCacheHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("ETag", `"v1"`)
+	}))
+	defer backend.Close()
+
+	u, _ := url.Parse(backend.URL)
+	p := New(Options{Backend: u, Limiter: newCountingLimiter(), DefaultLimit: 100, DefaultWindow: time.Minute})
+	p.SetRules([]rules.Rule{{
+		ID: "assets", Pattern: "/assets/*", Limit: 100, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Enabled: true,
+		CacheHeaders: map[string]string{
+			rules.HeaderCacheControl:    "public, max-age=300",
+			rules.HeaderCDNCacheControl: "max-age=3600",
+			rules.HeaderSurrogateKey:    "assets",
+		},
+	}})
+
+	w := serve(p, "GET", "/assets/app.js", nil)
+	h := w.Header()
+	if h.Get("Cache-Control") != "public, max-age=300" || h.Get("CDN-Cache-Control") != "max-age=3600" || h.Get("Surrogate-Key") != "assets" {
+		t.Errorf("Expected rule cache headers, got %v", h)
+	}
+	if h.Get("ETag") != `"v1"` {
+		t.Error("Expected other backend headers to pass through")
+	}
+
+	if got := serve(p, "GET", "/other", nil).Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Expected backend Cache-Control outside the rule, got %q", got)
+	}
+}
+
+func TestProxyCapturesResponseHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Tenant", "acme")
+		w.Header().Set("X-Cache", strings.Repeat("h", 200))
+	}))
+	defer backend.Close()
+
+	var events []Event
+	u, _ := url.Parse(backend.URL)
+	p := New(Options{
+		Backend: u, Limiter: newCountingLimiter(), DefaultLimit: 100, DefaultWindow: time.Minute,
+		Events: EventSinkFunc(func(e Event) { events = append(events, e) }),
+	})
+	p.SetRules([]rules.Rule{{
+		ID: "api", Pattern: "/api/*", Limit: 100, WindowSeconds: 60, IdentifyBy: rules.IdentifyByIP, Enabled: true,
+		CaptureHeaders: []string{"X-Tenant", "X-Cache", "X-Missing"},
+		Headers:        &rules.HeaderRewrite{Response: &rules.HeaderEdits{Remove: []string{"X-Tenant"}}},
+	}})
+
+	w := serve(p, "GET", "/api/items", nil)
+	if w.Header().Get("X-Tenant") != "" {
+		t.Error("Expected the response rewrite to still remove the captured header")
+	}
+	serve(p, "GET", "/other", nil)
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	dims := events[0].Dimensions
+	if len(dims) != 2 || dims["X-Tenant"] != "acme" || len(dims["X-Cache"]) != maxDimensionBytes {
+		t.Errorf("Unexpected dimensions %v", dims)
+	}
+	if events[1].Dimensions != nil {
+		t.Errorf("Expected no dimensions outside the rule, got %v", events[1].Dimensions)
+	}
+}
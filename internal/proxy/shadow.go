@@ -0,0 +1,23 @@
+package proxy
+
+import "github.com/Siruyy/gatify/internal/rules"
+
+// BlockReasonShadow marks forwarded requests that a shadow rule would
+// have rejected with 429.
+const BlockReasonShadow = "shadow"
+
+// isShadow reports whether rule is evaluated without being enforced.
+func isShadow(rule *rules.Rule) bool {
+	return rule != nil && rule.Shadow
+}
+
+// shadowed reports whether d's rule is in shadow mode, in which case a
+// rejection is waived and d is marked so its event records the block the
+// rule would have made.
+func shadowed(d *Decision) bool {
+	if !isShadow(d.Rule) {
+		return false
+	}
+	d.BlockReason = BlockReasonShadow
+	return true
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Siruyy/gatify/internal/quota"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestProxyShadowRuleNeverRejects(t *testing.T) {
+	var events []Event
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	})
+	p.SetRules([]rules.Rule{{ID: "r1", Pattern: "/api/*", Limit: 1, WindowSeconds: 60,
+		IdentifyBy: rules.IdentifyByIP, Shadow: true, Enabled: true}})
+
+	for i := 0; i < 3; i++ {
+		w := serve(p, "GET", "/api/items", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200 from a shadow rule, got %d", i, w.Code)
+		}
+		if w.Header().Get("X-RateLimit-Limit") != "" {
+			t.Errorf("request %d: shadow rule leaked rate limit headers %v", i, w.Header())
+		}
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	for i, e := range events {
+		wantReason := ""
+		if i > 0 {
+			wantReason = BlockReasonShadow
+		}
+		if !e.Allowed || e.Status != http.StatusOK || e.BlockReason != wantReason {
+			t.Errorf("event %d: allowed=%v status=%d reason=%q, want reason %q", i, e.Allowed, e.Status, e.BlockReason, wantReason)
+		}
+	}
+}
+
+func TestProxyShadowRuleWaivesQuota(t *testing.T) {
+	var events []Event
+	p, _ := newTestProxy(t, newCountingLimiter(), func(o *Options) {
+		o.Quotas = quota.NewTracker(storage.NewMemoryStorage(), nil)
+		o.Events = EventSinkFunc(func(e Event) { events = append(events, e) })
+	})
+	p.SetRules([]rules.Rule{{ID: "r1", Pattern: "/api/*", Limit: 100, WindowSeconds: 60,
+		IdentifyBy: rules.IdentifyByIP, Quota: 1, QuotaPeriod: quota.PeriodDay, Shadow: true, Enabled: true}})
+
+	for i := 0; i < 2; i++ {
+		w := serve(p, "GET", "/api/items", nil)
+		if w.Code != http.StatusOK || w.Header().Get("X-Quota-Limit") != "" {
+			t.Fatalf("request %d: got %d %v", i, w.Code, w.Header())
+		}
+	}
+	if events[0].BlockReason != "" || events[1].BlockReason != BlockReasonShadow {
+		t.Errorf("Expected only the request over quota marked, got %q and %q", events[0].BlockReason, events[1].BlockReason)
+	}
+}
@@ -0,0 +1,259 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// BlockReasonWebSocketMessages marks WebSocket connections the gateway
+// closed because the client sent messages faster than its rule allows.
+const BlockReasonWebSocketMessages = "websocket_messages"
+
+// closePolicyViolation is the WebSocket close status for messages that
+// violate the endpoint's policy (RFC 6455, section 7.4.1).
+const closePolicyViolation = 1008
+
+// closeGrace bounds how long a connection over its message limit waits
+// for the backend to finish the frame it is sending before closing.
+const closeGrace = time.Second
+
+// isWebSocketUpgrade reports whether r asks to upgrade to WebSocket.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("Upgrade")), "websocket")
+}
+
+// messageAllower returns the function deciding whether the client may
+// send one more message.
+func (p *GatewayProxy) messageAllower(ctx context.Context, d Decision) func() bool {
+	ws := d.Rule.WebSocket
+	if ws.Per == rules.WebSocketPerClient {
+		rl := p.limiterFor(d.Rule)
+		key := limiterKey(d.Rule, "ws:"+d.Identity)
+		return func() bool {
+			res, err := rl.Allow(ctx, key, ws.MessagesPerSecond, time.Second)
+			if err != nil {
+				// Fail open, like request limits do.
+				log.Printf("Rate limiter error for %s: %v", key, err)
+				return true
+			}
+			return res.Allowed
+		}
+	}
+	b := &tokenBucket{rate: float64(ws.MessagesPerSecond), tokens: float64(ws.MessagesPerSecond), last: time.Now()}
+	return b.take
+}
+
+// tokenBucket is a connection's own message budget. It is only used from
+// the goroutine reading the connection.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) take() bool {
+	now := time.Now()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// messageLimitWriter hands the reverse proxy a limitedConn when it
+// hijacks the connection. Unwrap keeps flushing available.
+type messageLimitWriter struct {
+	http.ResponseWriter
+	allow func() bool
+	conn  *limitedConn
+}
+
+// Hijack implements http.Hijacker.
+func (w *messageLimitWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.conn = newLimitedConn(conn, w.allow)
+	return w.conn, brw, nil
+}
+
+func (w *messageLimitWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// exceeded reports whether the connection was closed for sending too
+// many messages.
+func (w *messageLimitWriter) exceeded() bool {
+	return w != nil && w.conn != nil && w.conn.exceeded.Load()
+}
+
+// limitedConn is the client side of an upgraded connection. Reads parse
+// the client's frames and stop at the first message over the limit; the
+// gateway then sends the client a close frame, between two of the
+// backend's frames, and ends the connection.
+type limitedConn struct {
+	net.Conn
+	allow    func() bool
+	in       frameScanner
+	exceeded atomic.Bool
+
+	mu      sync.Mutex
+	out     frameScanner
+	closing bool
+	sent    chan struct{}
+}
+
+func newLimitedConn(conn net.Conn, allow func() bool) *limitedConn {
+	return &limitedConn{Conn: conn, allow: allow, sent: make(chan struct{})}
+}
+
+// Read returns the client's frames up to, not including, the first
+// message over the limit, and io.EOF after it.
+func (c *limitedConn) Read(b []byte) (int, error) {
+	if c.exceeded.Load() {
+		select {
+		case <-c.sent:
+		case <-time.After(closeGrace):
+		}
+		return 0, io.EOF
+	}
+	n, err := c.Conn.Read(b)
+	kept := c.in.scan(b[:n], func(first byte) bool {
+		// Each message starts with one text or binary frame; continuation
+		// and control frames are not counted.
+		if op := first & 0x0F; op != 0x1 && op != 0x2 {
+			return true
+		}
+		return c.allow()
+	})
+	if kept < n {
+		c.exceeded.Store(true)
+		c.startClose()
+		return kept, nil
+	}
+	return n, err
+}
+
+// Write passes the backend's frames to the client. Once the connection
+// is closing, it writes up to the end of the current frame, then the
+// close frame.
+func (c *limitedConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closing {
+		n, err := c.Conn.Write(b)
+		c.out.scan(b[:n], func(byte) bool { return true })
+		return n, err
+	}
+	if c.out.atBoundary() {
+		c.sendClose()
+		return 0, net.ErrClosed
+	}
+	end := c.out.scan(b, func(byte) bool { return false })
+	n, err := c.Conn.Write(b[:end])
+	if err != nil || n < end || !c.out.atBoundary() {
+		return n, err
+	}
+	c.sendClose()
+	return n, net.ErrClosed
+}
+
+func (c *limitedConn) startClose() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closing = true
+	if c.out.atBoundary() {
+		c.sendClose()
+	}
+}
+
+// sendClose writes the close frame once. c.mu must be held.
+func (c *limitedConn) sendClose() {
+	select {
+	case <-c.sent:
+		return
+	default:
+	}
+	reason := "message rate exceeded"
+	frame := []byte{0x88, byte(2 + len(reason))}
+	frame = binary.BigEndian.AppendUint16(frame, closePolicyViolation)
+	frame = append(frame, reason...)
+	if _, err := c.Conn.Write(frame); err != nil {
+		log.Printf("Failed to send WebSocket close: %v", err)
+	}
+	close(c.sent)
+}
+
+// frameScanner follows WebSocket frame boundaries in a byte stream.
+type frameScanner struct {
+	header    [14]byte
+	have      int    // header bytes seen of the current frame
+	need      int    // header length, once the second byte is seen
+	remaining uint64 // payload bytes left of the current frame
+}
+
+// scan advances over b, calling start with the first byte of every frame
+// that begins in it. It stops before a frame start returns false for and
+// returns how many bytes it consumed.
+func (s *frameScanner) scan(b []byte, start func(first byte) bool) int {
+	i := 0
+	for i < len(b) {
+		if s.remaining > 0 {
+			skip := min(uint64(len(b)-i), s.remaining)
+			i += int(skip)
+			s.remaining -= skip
+			continue
+		}
+		if s.have == 0 && !start(b[i]) {
+			return i
+		}
+		s.header[s.have] = b[i]
+		s.have++
+		i++
+		if s.have == 2 {
+			s.need = 2
+			if s.header[1]&0x80 != 0 {
+				s.need += 4 // masking key
+			}
+			switch s.header[1] & 0x7F {
+			case 126:
+				s.need += 2
+			case 127:
+				s.need += 8
+			}
+		}
+		if s.have >= 2 && s.have == s.need {
+			s.remaining = s.payloadLength()
+			s.have = 0
+		}
+	}
+	return i
+}
+
+func (s *frameScanner) payloadLength() uint64 {
+	switch n := s.header[1] & 0x7F; n {
+	case 126:
+		return uint64(binary.BigEndian.Uint16(s.header[2:4]))
+	case 127:
+		return binary.BigEndian.Uint64(s.header[2:10])
+	default:
+		return uint64(n)
+	}
+}
+
+// atBoundary reports whether the stream is between two frames.
+func (s *frameScanner) atBoundary() bool {
+	return s.have == 0 && s.remaining == 0
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// wsFrame encodes a single-frame message, masked as clients must.
+func wsFrame(opcode byte, payload []byte, masked bool) []byte {
+	frame := []byte{0x80 | opcode}
+	var maskBit byte
+	if masked {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	if !masked {
+		return append(frame, payload...)
+	}
+	key := []byte{1, 2, 3, 4}
+	frame = append(frame, key...)
+	for i, c := range payload {
+		frame = append(frame, c^key[i%4])
+	}
+	return frame
+}
+
+func TestFrameScanner(t *testing.T) {
+	var stream []byte
+	stream = append(stream, wsFrame(0x1, []byte("hello"), true)...)
+	stream = append(stream, wsFrame(0x9, nil, true)...)
+	stream = append(stream, wsFrame(0x2, make([]byte, 300), true)...)
+	stream = append(stream, wsFrame(0x1, make([]byte, 70000), false)...)
+
+	// Feed the stream in awkward chunks so headers straddle reads.
+	for _, chunk := range []int{1, 3, 7, 4096} {
+		var s frameScanner
+		var firsts []byte
+		for i := 0; i < len(stream); i += chunk {
+			end := min(i+chunk, len(stream))
+			if n := s.scan(stream[i:end], func(b byte) bool { firsts = append(firsts, b); return true }); n != end-i {
+				t.Fatalf("chunk %d: consumed %d of %d bytes", chunk, n, end-i)
+			}
+		}
+		if string(firsts) != "\x81\x89\x82\x81" || !s.atBoundary() {
+			t.Errorf("chunk %d: frame starts %x, at boundary %v", chunk, firsts, s.atBoundary())
+		}
+	}
+
+	var s frameScanner
+	if n := s.scan(stream, func(b byte) bool { return b != 0x82 }); n != len(wsFrame(0x1, []byte("hello"), true))+6 {
+		t.Errorf("Expected to stop before the binary frame, stopped at %d", n)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := &tokenBucket{rate: 2, tokens: 2, last: time.Now()}
+	if !b.take() || !b.take() || b.take() {
+		t.Fatal("Expected a burst of exactly the rate")
+	}
+	b.last = b.last.Add(-time.Second)
+	if !b.take() {
+		t.Fatal("Expected tokens to refill over time")
+	}
+}
+
+func TestProxyLimitsWebSocketMessages(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("Hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Write(wsFrame(0x1, []byte("welcome"), false))
+		brw.Flush()
+		io.Copy(io.Discard, brw)
+	}))
+	defer backend.Close()
+
+	var mu sync.Mutex
+	var events []Event
+	u, _ := url.Parse(backend.URL)
+	p := New(Options{
+		Backend:       u,
+		Limiter:       newCountingLimiter(),
+		DefaultLimit:  100,
+		DefaultWindow: time.Minute,
+		Events: EventSinkFunc(func(e Event) {
+			mu.Lock()
+			events = append(events, e)
+			mu.Unlock()
+		}),
+	})
+	p.SetRules([]rules.Rule{{
+		ID: "ws", Name: "ws", Pattern: "/ws", Limit: 100, WindowSeconds: 60, Enabled: true,
+		WebSocket: &rules.WebSocketLimit{MessagesPerSecond: 3, Per: rules.WebSocketPerConnection},
+	}})
+	gateway := httptest.NewServer(p)
+	defer gateway.Close()
+
+	conn, err := net.Dial("tcp", gateway.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: gateway\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %v %v", resp, err)
+	}
+
+	for i := 0; i < 5; i++ {
+		conn.Write(wsFrame(0x1, []byte("msg"), true))
+	}
+
+	var code uint16
+	for {
+		head := make([]byte, 2)
+		if _, err := io.ReadFull(br, head); err != nil {
+			t.Fatalf("Expected a close frame, got %v", err)
+		}
+		payload := make([]byte, head[1]&0x7F)
+		io.ReadFull(br, payload)
+		if head[0]&0x0F == 0x8 {
+			code = binary.BigEndian.Uint16(payload)
+			break
+		}
+	}
+	if code != closePolicyViolation {
+		t.Fatalf("Expected close status %d, got %d", closePolicyViolation, code)
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Errorf("Expected the gateway to end the connection, got %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(events)
+		mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 || events[0].BlockReason != BlockReasonWebSocketMessages {
+		t.Errorf("Expected the connection's event to record the limit, got %+v", events)
+	}
+}
+
+func TestProxyLimitsWebSocketMessagesPerClient(t *testing.T) {
+	lim := newCountingLimiter()
+	allow := (&GatewayProxy{opts: Options{Limiter: lim}}).messageAllower(context.Background(), Decision{
+		Rule:     &rules.Rule{ID: "ws", WebSocket: &rules.WebSocketLimit{MessagesPerSecond: 2, Per: rules.WebSocketPerClient}},
+		Identity: "ip:10.0.0.1",
+	})
+	if !allow() || !allow() || allow() {
+		t.Fatal("Expected the client's shared budget to run out after 2 messages")
+	}
+	if lim.keys[0] != "gatify:rl:{ws}:ws:ip:10.0.0.1" {
+		t.Errorf("Unexpected limiter key %q", lim.keys[0])
+	}
+}
@@ -0,0 +1,89 @@
+package quota
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// schema creates the usage table. It is idempotent.
+const schema = `CREATE TABLE IF NOT EXISTS client_quota_usage (
+	rule_id      TEXT        NOT NULL,
+	client_id    TEXT        NOT NULL,
+	period_start DATE        NOT NULL,
+	used         BIGINT      NOT NULL,
+	updated_at   TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (rule_id, client_id, period_start)
+)`
+
+// PostgresStore is a Store backed by PostgreSQL.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a PostgresStore using db.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Migrate creates the usage table.
+func (s *PostgresStore) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, schema); err != nil {
+		return fmt.Errorf("quota migration: %w", err)
+	}
+	return nil
+}
+
+// Load implements Store.
+func (s *PostgresStore) Load(ctx context.Context, ruleID, identity string, periodStart time.Time) (int64, error) {
+	var used int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT used FROM client_quota_usage
+		WHERE rule_id = $1 AND client_id = $2 AND period_start = $3::date`,
+		ruleID, identity, periodStart.UTC().Format(time.DateOnly)).Scan(&used)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("quota load: %w", err)
+	}
+	return used, nil
+}
+
+// Save implements Store. Counts only grow within a period, so the higher
+// of the stored and new count wins and out-of-order saves are harmless.
+func (s *PostgresStore) Save(ctx context.Context, usage []Usage) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("quota save: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for _, u := range usage {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO client_quota_usage (rule_id, client_id, period_start, used, updated_at)
+			VALUES ($1, $2, $3::date, $4, $5)
+			ON CONFLICT (rule_id, client_id, period_start) DO UPDATE
+			SET used       = GREATEST(client_quota_usage.used, EXCLUDED.used),
+			    updated_at = EXCLUDED.updated_at`,
+			u.RuleID, u.Identity, u.PeriodStart.UTC().Format(time.DateOnly), u.Used, now)
+		if err != nil {
+			return fmt.Errorf("quota save: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("quota save: %w", err)
+	}
+	return nil
+}
+
+// Reset implements Store.
+func (s *PostgresStore) Reset(ctx context.Context, ruleID string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM client_quota_usage WHERE rule_id = $1`, ruleID); err != nil {
+		return fmt.Errorf("quota reset: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+// Package quota enforces long-horizon request quotas, such as 100k requests
+// a month per API key, on top of the short-window rate limits. Counters
+// live in shared storage and are periodically persisted to a Store, so a
+// Redis restart does not hand every client a fresh quota.
+package quota
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// Quota periods. Periods are calendar days and months in UTC.
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+const (
+	// DefaultFlushInterval is how often usage is persisted to the Store.
+	DefaultFlushInterval = time.Minute
+
+	// counterGrace keeps a counter around after its period ends, so
+	// instances with slightly late clocks still find it.
+	counterGrace = 24 * time.Hour
+)
+
+// Known reports whether period is a supported quota period.
+func Known(period string) bool {
+	return period == PeriodDay || period == PeriodMonth
+}
+
+// Bounds returns the start and end of the period containing now.
+func Bounds(period string, now time.Time) (start, end time.Time) {
+	now = now.UTC()
+	if period == PeriodDay {
+		start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	}
+	start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// Result is the outcome of counting a request against a quota.
+type Result struct {
+	Allowed   bool
+	Limit     int64
+	Used      int64
+	Remaining int64
+	// ResetAt is when the period ends and the quota starts over.
+	ResetAt time.Time
+}
+
+// Usage is a client's consumption of a rule's quota in one period.
+type Usage struct {
+	RuleID      string
+	Identity    string
+	PeriodStart time.Time
+	Used        int64
+}
+
+// Store persists usage outside of shared storage.
+type Store interface {
+	// Load returns the persisted usage, or 0 when there is none.
+	Load(ctx context.Context, ruleID, identity string, periodStart time.Time) (int64, error)
+	// Save records usage, keeping the higher count when a row exists.
+	Save(ctx context.Context, usage []Usage) error
+	// Reset forgets every client's usage of a rule.
+	Reset(ctx context.Context, ruleID string) error
+}
+
+// Tracker counts requests against quotas. It is safe for concurrent use.
+type Tracker struct {
+	counters storage.Storage
+	store    Store
+	now      func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]Usage
+}
+
+// NewTracker creates a Tracker keeping its counters in counters. store may
+// be nil, in which case usage is not persisted.
+func NewTracker(counters storage.Storage, store Store) *Tracker {
+	return &Tracker{counters: counters, store: store, now: time.Now, pending: make(map[string]Usage)}
+}
+
+// Check counts a request by identity against the quota of a rule in
+// namespace, which is empty for rules without one. A rejected request is
+// not counted. Pass a ctx made with storage.WithIndex to track the counter
+// in the rule's scope index, where a reset finds it.
+func (t *Tracker) Check(ctx context.Context, namespace, ruleID, identity string, quota int64, period string) (Result, error) {
+	start, end := Bounds(period, t.now())
+	key := counterKey(namespace, ruleID, identity, period, start)
+	ttl := end.Sub(t.now()) + counterGrace
+	res := Result{Limit: quota, ResetAt: end}
+
+	used, err := t.counters.IncrBy(ctx, key, 1, ttl)
+	if err != nil {
+		return res, err
+	}
+	if used == 1 && t.store != nil {
+		// A fresh counter may mean shared storage lost it; resume from
+		// the persisted usage.
+		persisted, err := t.store.Load(ctx, ruleID, identity, start)
+		if err != nil {
+			log.Printf("Failed to load quota usage for %s: %v", key, err)
+		} else if persisted > 0 {
+			if used, err = t.counters.IncrBy(ctx, key, persisted, ttl); err != nil {
+				return res, err
+			}
+		}
+	}
+
+	if used > quota {
+		if _, err := t.counters.IncrBy(ctx, key, -1, ttl); err != nil {
+			log.Printf("Failed to uncount rejected request for %s: %v", key, err)
+		}
+		res.Used = used - 1
+		return res, nil
+	}
+	res.Allowed = true
+	res.Used = used
+	res.Remaining = quota - used
+	if t.store != nil {
+		t.mu.Lock()
+		t.pending[key] = Usage{RuleID: ruleID, Identity: identity, PeriodStart: start, Used: used}
+		t.mu.Unlock()
+	}
+	return res, nil
+}
+
+// Run persists usage every interval until ctx is cancelled, then once
+// more.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.Flush(ctx); err != nil {
+				log.Printf("Failed to persist quota usage: %v", err)
+			}
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := t.Flush(shutdownCtx); err != nil {
+				log.Printf("Failed to persist quota usage: %v", err)
+			}
+			cancel()
+			return
+		}
+	}
+}
+
+// Flush persists the usage counted since the last flush. Usage that fails
+// to be saved is kept for the next attempt unless newer usage replaced it.
+func (t *Tracker) Flush(ctx context.Context) error {
+	if t.store == nil {
+		return nil
+	}
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = make(map[string]Usage, len(pending))
+	t.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	usage := make([]Usage, 0, len(pending))
+	for _, u := range pending {
+		usage = append(usage, u)
+	}
+	if err := t.store.Save(ctx, usage); err != nil {
+		t.mu.Lock()
+		for key, u := range pending {
+			if _, newer := t.pending[key]; !newer {
+				t.pending[key] = u
+			}
+		}
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Reset forgets the usage of a rule in namespace that is waiting to be
+// persisted or already is. The counters in shared storage are deleted with
+// the rule's scope index afterwards, so a request arriving in between
+// cannot reload the persisted usage into a fresh counter.
+func (t *Tracker) Reset(ctx context.Context, namespace, ruleID string) error {
+	scope := ScopeKey(namespace, ruleID)
+	t.mu.Lock()
+	for key := range t.pending {
+		if strings.HasPrefix(key, scope) {
+			delete(t.pending, key)
+		}
+	}
+	t.mu.Unlock()
+	if t.store == nil {
+		return nil
+	}
+	return t.store.Reset(ctx, ruleID)
+}
+
+// ScopeKey returns the prefix shared by every quota counter of a rule in
+// namespace, which is empty for rules without one.
+func ScopeKey(namespace, ruleID string) string {
+	if namespace != "" {
+		return "gatify:quota:ns:" + namespace + ":{" + ruleID + "}:"
+	}
+	return "gatify:quota:{" + ruleID + "}:"
+}
+
+func counterKey(namespace, ruleID, identity, period string, start time.Time) string {
+	layout := "2006-01"
+	if period == PeriodDay {
+		layout = "2006-01-02"
+	}
+	return ScopeKey(namespace, ruleID) + identity + ":" + start.Format(layout)
+}
@@ -0,0 +1,187 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+type memStore struct {
+	mu    sync.Mutex
+	usage map[string]int64
+	err   error
+	saves int
+}
+
+func newMemStore() *memStore {
+	return &memStore{usage: make(map[string]int64)}
+}
+
+func usageKey(ruleID, identity string, start time.Time) string {
+	return ruleID + "|" + identity + "|" + start.Format(time.DateOnly)
+}
+
+func (s *memStore) Load(_ context.Context, ruleID, identity string, start time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage[usageKey(ruleID, identity, start)], nil
+}
+
+func (s *memStore) Save(_ context.Context, usage []Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.saves++
+	for _, u := range usage {
+		k := usageKey(u.RuleID, u.Identity, u.PeriodStart)
+		if u.Used > s.usage[k] {
+			s.usage[k] = u.Used
+		}
+	}
+	return nil
+}
+
+func (s *memStore) Reset(_ context.Context, ruleID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k := range s.usage {
+		if strings.HasPrefix(k, ruleID+"|") {
+			delete(s.usage, k)
+		}
+	}
+	return nil
+}
+
+func TestBounds(t *testing.T) {
+	now := time.Date(2026, 2, 14, 15, 4, 5, 0, time.UTC)
+
+	start, end := Bounds(PeriodDay, now)
+	if !start.Equal(time.Date(2026, 2, 14, 0, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2026, 2, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("day bounds = %v, %v", start, end)
+	}
+	start, end = Bounds(PeriodMonth, now)
+	if !start.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("month bounds = %v, %v", start, end)
+	}
+}
+
+func TestTrackerEnforcesQuota(t *testing.T) {
+	ctx := context.Background()
+	tr := NewTracker(storage.NewMemoryStorage(), nil)
+
+	for i := int64(1); i <= 3; i++ {
+		res, err := tr.Check(ctx, "", "rule-1", "key-a", 3, PeriodMonth)
+		if err != nil || !res.Allowed || res.Used != i || res.Remaining != 3-i {
+			t.Fatalf("request %d: %+v, %v", i, res, err)
+		}
+	}
+	res, err := tr.Check(ctx, "", "rule-1", "key-a", 3, PeriodMonth)
+	if err != nil || res.Allowed || res.Used != 3 || res.Remaining != 0 {
+		t.Fatalf("over quota: %+v, %v", res, err)
+	}
+	// Rejections are not counted, so raising the quota frees one slot.
+	if res, _ := tr.Check(ctx, "", "rule-1", "key-a", 4, PeriodMonth); !res.Allowed || res.Used != 4 {
+		t.Errorf("after raising the quota: %+v", res)
+	}
+	if res, _ := tr.Check(ctx, "", "rule-1", "key-b", 3, PeriodMonth); !res.Allowed || res.Used != 1 {
+		t.Errorf("other client: %+v", res)
+	}
+}
+
+func TestTrackerResumesFromStore(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	tr := NewTracker(storage.NewMemoryStorage(), store)
+	for i := 0; i < 5; i++ {
+		if _, err := tr.Check(ctx, "", "rule-1", "key-a", 10, PeriodDay); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Shared storage was wiped: a new tracker picks up the saved usage.
+	tr = NewTracker(storage.NewMemoryStorage(), store)
+	res, err := tr.Check(ctx, "", "rule-1", "key-a", 10, PeriodDay)
+	if err != nil || res.Used != 6 || res.Remaining != 4 {
+		t.Errorf("resumed: %+v, %v", res, err)
+	}
+}
+
+func TestTrackerRetriesFailedFlush(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	store.err = errors.New("database down")
+	tr := NewTracker(storage.NewMemoryStorage(), store)
+	if _, err := tr.Check(ctx, "", "rule-1", "key-a", 10, PeriodDay); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Flush(ctx); err == nil {
+		t.Fatal("expected flush to fail")
+	}
+
+	store.err = nil
+	if err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	start, _ := Bounds(PeriodDay, time.Now())
+	if used, _ := store.Load(ctx, "rule-1", "key-a", start); used != 1 {
+		t.Errorf("persisted usage = %d, want 1", used)
+	}
+}
+
+func TestTrackerSeparatesNamespaces(t *testing.T) {
+	ctx := context.Background()
+	tr := NewTracker(storage.NewMemoryStorage(), nil)
+	if res, _ := tr.Check(ctx, "acme", "rule-1", "key-a", 1, PeriodDay); !res.Allowed {
+		t.Fatalf("acme: %+v", res)
+	}
+	if res, _ := tr.Check(ctx, "globex", "rule-1", "key-a", 1, PeriodDay); !res.Allowed {
+		t.Errorf("Expected globex to have its own quota, got %+v", res)
+	}
+}
+
+func TestTrackerReset(t *testing.T) {
+	ctx := context.Background()
+	counters := storage.NewMemoryStorage()
+	store := newMemStore()
+	tr := NewTracker(counters, store)
+	index := "gatify:rl:ns:acme:{rule-1}:index"
+	for _, id := range []string{"key-a", "tenant/key-b"} {
+		if _, err := tr.Check(storage.WithIndex(ctx, index), "acme", "rule-1", id, 1, PeriodDay); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.Check(ctx, "acme", "rule-2", "key-a", 1, PeriodDay); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.Reset(ctx, "acme", "rule-1"); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	// The caller deletes the counters tracked in the rule's scope index.
+	if n, err := counters.DeleteIndexed(ctx, index); err != nil || n != 2 {
+		t.Fatalf("DeleteIndexed() = %d, %v, want 2 counters", n, err)
+	}
+	start, _ := Bounds(PeriodDay, time.Now())
+	if used, _ := store.Load(ctx, "rule-1", "key-a", start); used != 0 {
+		t.Errorf("persisted usage = %d after reset, want 0", used)
+	}
+	if res, _ := tr.Check(ctx, "acme", "rule-1", "tenant/key-b", 1, PeriodDay); !res.Allowed || res.Used != 1 {
+		t.Errorf("after reset: %+v", res)
+	}
+	if res, _ := tr.Check(ctx, "acme", "rule-2", "key-a", 1, PeriodDay); res.Allowed {
+		t.Errorf("Expected other rules untouched by the reset, got %+v", res)
+	}
+}
@@ -0,0 +1,124 @@
+// Package recovery keeps a panicking request handler from crashing the
+// gateway: the panic is logged with its stack, answered with a 500
+// problem+json response and passed to an error reporter.
+package recovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// Panic is a panic recovered while serving a request.
+type Panic struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	// Value is what the handler panicked with, and Err the same as an
+	// error, wrapping Value when it is one.
+	Value any    `json:"-"`
+	Err   error  `json:"-"`
+	Error string `json:"error"`
+	Stack string `json:"stack"`
+}
+
+// Reporter receives recovered panics, for example to forward them to an
+// error tracker. Report is called on the request's goroutine and must not
+// block. The interface mirrors the Recover hooks of Sentry's SDK, so a
+// Sentry hub adapts in one line:
+//
+//	recovery.ReporterFunc(func(ctx context.Context, p recovery.Panic) {
+//		hub.RecoverWithContext(ctx, p.Value)
+//	})
+type Reporter interface {
+	Report(ctx context.Context, p Panic)
+}
+
+// ReporterFunc adapts a function to a Reporter.
+type ReporterFunc func(ctx context.Context, p Panic)
+
+// Report implements Reporter.
+func (f ReporterFunc) Report(ctx context.Context, p Panic) { f(ctx, p) }
+
+// problem is the RFC 9457 body of the 500 response.
+const problem = `{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"the gateway failed to handle the request"}`
+
+// Handler wraps next so that a panic while serving a request is answered
+// with 500 and reported to reporter, which may be nil, instead of
+// crashing the process. When the response had already started, the
+// connection is aborted instead, since the client cannot be told about
+// the failure. http.ErrAbortHandler, the deliberate way to abort a
+// response, is passed through unreported.
+func Handler(next http.Handler, reporter Reporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &trackingWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			p := Panic{
+				Time:   time.Now().UTC(),
+				Method: r.Method,
+				Path:   r.URL.Path,
+				Value:  v,
+				Err:    asError(v),
+				Stack:  string(debug.Stack()),
+			}
+			p.Error = p.Err.Error()
+			log.Printf("❌ Panic serving %s %s: %v\n%s", p.Method, p.Path, p.Error, p.Stack)
+			if reporter != nil {
+				reporter.Report(r.Context(), p)
+			}
+			if tw.wrote {
+				// Let the server drop the connection without logging the
+				// panic a second time.
+				panic(http.ErrAbortHandler)
+			}
+			h := w.Header()
+			for k := range h {
+				delete(h, k)
+			}
+			h.Set("Content-Type", "application/problem+json")
+			h.Set("Connection", "close")
+			w.WriteHeader(http.StatusInternalServerError)
+			if _, err := w.Write([]byte(problem)); err != nil {
+				log.Printf("Failed to write response: %v", err)
+			}
+		}()
+		next.ServeHTTP(tw, r)
+	})
+}
+
+func asError(v any) error {
+	if err, ok := v.(error); ok {
+		return fmt.Errorf("panic: %w", err)
+	}
+	return errors.New("panic: " + fmt.Sprint(v))
+}
+
+// trackingWriter records whether the response has started. Unwrap keeps
+// flushing and hijacking available to the wrapped handler.
+type trackingWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *trackingWriter) WriteHeader(code int) {
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *trackingWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *trackingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,83 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerRecoversPanics(t *testing.T) {
+	var reported []Panic
+	reporter := ReporterFunc(func(_ context.Context, p Panic) { reported = append(reported, p) })
+	boom := errors.New("boom")
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "10")
+		panic(boom)
+	}), reporter)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/items", nil))
+
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("Expected a 500 problem, got %d %v", w.Code, w.Header())
+	}
+	if !strings.Contains(w.Body.String(), `"status":500`) || strings.Contains(w.Body.String(), "boom") {
+		t.Errorf("Unexpected body %s", w.Body.String())
+	}
+	if w.Header().Get("X-RateLimit-Limit") != "" {
+		t.Error("Expected headers set before the panic to be dropped")
+	}
+	if len(reported) != 1 {
+		t.Fatalf("Expected one report, got %d", len(reported))
+	}
+	p := reported[0]
+	if !errors.Is(p.Err, boom) || p.Value != boom || p.Path != "/api/items" || p.Method != http.MethodGet {
+		t.Errorf("Unexpected report %+v", p)
+	}
+	if !strings.Contains(p.Stack, "recovery_test.go") {
+		t.Errorf("Expected the stack to show the panicking handler, got %s", p.Stack)
+	}
+}
+
+func TestHandlerAbortsStartedResponses(t *testing.T) {
+	var reports int
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("half way")
+	}), ReporterFunc(func(context.Context, Panic) { reports++ }))
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("Expected the response to be aborted, got %v", v)
+		}
+		if reports != 1 {
+			t.Errorf("Expected the panic reported once, got %d", reports)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestHandlerPassesAbortsThrough(t *testing.T) {
+	h := Handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}), ReporterFunc(func(context.Context, Panic) { t.Error("Expected aborts not to be reported") }))
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("Expected ErrAbortHandler to propagate, got %v", v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestHandlerWithoutReporter(t *testing.T) {
+	h := Handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic("nil map") }), nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", w.Code)
+	}
+}
@@ -0,0 +1,59 @@
+package report
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronMatches(t *testing.T) {
+	// Friday 8 March 2024.
+	fri := time.Date(2024, 3, 8, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		at   time.Time
+		want bool
+	}{
+		{"* * * * *", fri, true},
+		{"0 9 * * *", fri, true},
+		{"0 9 * * *", fri.Add(time.Minute), false},
+		{"*/15 * * * *", fri.Add(45 * time.Minute), true},
+		{"*/15 * * * *", fri.Add(50 * time.Minute), false},
+		{"0 9 * * 1-5", fri, true},
+		{"0 9 * * 1", fri, false},
+		{"0 9 1 * *", fri, false},
+		// Day of month and day of week are ORed when both are set.
+		{"0 9 1 * 5", fri, true},
+		{"0 8,9 * 3 *", fri, true},
+		{"0 9 * 4 *", fri, false},
+		{"30 10-18/2 * * *", fri.Add(3*time.Hour + 30*time.Minute), true},
+		{"0 9 * * *", fri.In(time.FixedZone("CET", 3600)), true},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) error = %v", tt.expr, err)
+		}
+		if got := c.Matches(tt.at); got != tt.want {
+			t.Errorf("%q at %v = %v, want %v", tt.expr, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronRejectsInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 7",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("Expected error for %q", expr)
+		}
+	}
+}
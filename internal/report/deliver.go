@@ -0,0 +1,218 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// webhookTimeout bounds a single webhook delivery.
+const webhookTimeout = 10 * time.Second
+
+// ErrEmailDisabled is returned for email schedules when no mailer is
+// configured.
+var ErrEmailDisabled = errors.New("email delivery is not configured")
+
+// Mailer sends HTML email.
+type Mailer interface {
+	Send(ctx context.Context, to []string, subject, html string) error
+}
+
+// SMTPMailer sends mail through an SMTP relay.
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer creates a mailer for the relay at addr (host:port). PLAIN
+// authentication is used when username is set.
+func NewSMTPMailer(addr, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := strings.Cut(addr, ":")
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+// Send implements Mailer.
+func (m *SMTPMailer) Send(_ context.Context, to []string, subject, html string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", strings.NewReplacer("\r", " ", "\n", " ").Replace(subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=utf-8\r\n\r\n")
+	msg.WriteString(html)
+	return smtp.SendMail(m.addr, m.auth, m.from, to, msg.Bytes())
+}
+
+// webhookPayload is POSTed to a schedule's webhook URL.
+type webhookPayload struct {
+	ScheduleID   string `json:"schedule_id"`
+	ScheduleName string `json:"schedule_name"`
+	Report       Report `json:"report"`
+	HTML         string `json:"html"`
+}
+
+// Scheduler manages report schedules and delivers the reports that are
+// due. Tick is meant to run on a single instance, such as the elected
+// leader.
+type Scheduler struct {
+	schedules *ScheduleStore
+	source    Source
+	mailer    Mailer
+	client    *http.Client
+	now       func() time.Time
+}
+
+// NewScheduler creates a Scheduler. mailer may be nil, in which case only
+// webhook delivery is available.
+func NewScheduler(schedules *ScheduleStore, source Source, mailer Mailer) *Scheduler {
+	return &Scheduler{
+		schedules: schedules,
+		source:    source,
+		mailer:    mailer,
+		client:    &http.Client{Timeout: webhookTimeout},
+		now:       time.Now,
+	}
+}
+
+// List returns every schedule.
+func (s *Scheduler) List(ctx context.Context) ([]Schedule, error) { return s.schedules.List(ctx) }
+
+// Get returns the schedule with the given ID.
+func (s *Scheduler) Get(ctx context.Context, id string) (Schedule, error) {
+	return s.schedules.Get(ctx, id)
+}
+
+// Create validates and stores a new schedule.
+func (s *Scheduler) Create(ctx context.Context, sch Schedule) (Schedule, error) {
+	if err := s.check(sch); err != nil {
+		return Schedule{}, err
+	}
+	return s.schedules.Create(ctx, sch)
+}
+
+// Update validates and replaces an existing schedule.
+func (s *Scheduler) Update(ctx context.Context, sch Schedule) (Schedule, error) {
+	if err := s.check(sch); err != nil {
+		return Schedule{}, err
+	}
+	return s.schedules.Update(ctx, sch)
+}
+
+// Delete removes a schedule.
+func (s *Scheduler) Delete(ctx context.Context, id string) error { return s.schedules.Delete(ctx, id) }
+
+// Send delivers a schedule's report immediately, regardless of its cron
+// expression.
+func (s *Scheduler) Send(ctx context.Context, id string) error {
+	sch, err := s.schedules.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.deliver(ctx, sch, s.now().UTC())
+}
+
+// Tick delivers every enabled schedule due in the current minute that has
+// not already run for it. Delivery failures are recorded on the schedule
+// rather than returned.
+func (s *Scheduler) Tick(ctx context.Context) error {
+	minute := s.now().UTC().Truncate(time.Minute)
+	list, err := s.schedules.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, sch := range list {
+		if !sch.Enabled || !sch.LastRunAt.Before(minute) {
+			continue
+		}
+		c, err := ParseCron(sch.Cron)
+		if err != nil || !c.Matches(minute) {
+			continue
+		}
+
+		runErr := s.deliver(ctx, sch, minute)
+		if runErr != nil {
+			log.Printf("Report schedule %s failed: %v", sch.ID, runErr)
+		} else {
+			log.Printf("📧 Delivered %s report for schedule %s", sch.Period, sch.ID)
+		}
+		if err := s.schedules.recordRun(ctx, sch.ID, minute, runErr); err != nil {
+			log.Printf("Failed to record report run for %s: %v", sch.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) check(sch Schedule) error {
+	if err := sch.Validate(); err != nil {
+		return err
+	}
+	if len(sch.EmailTo) > 0 && s.mailer == nil {
+		return ErrEmailDisabled
+	}
+	return nil
+}
+
+// deliver generates the report ending at now and sends it to every
+// target, returning the combined delivery errors.
+func (s *Scheduler) deliver(ctx context.Context, sch Schedule, now time.Time) error {
+	rep, err := Generate(ctx, s.source, sch.Period, now)
+	if err != nil {
+		return err
+	}
+	var html bytes.Buffer
+	if err := rep.WriteHTML(&html); err != nil {
+		return err
+	}
+
+	var errs []error
+	if len(sch.EmailTo) > 0 {
+		if s.mailer == nil {
+			errs = append(errs, ErrEmailDisabled)
+		} else if err := s.mailer.Send(ctx, sch.EmailTo, subject(sch, rep), html.String()); err != nil {
+			errs = append(errs, fmt.Errorf("email: %w", err))
+		}
+	}
+	if sch.WebhookURL != "" {
+		if err := s.postWebhook(ctx, sch, rep, html.String()); err != nil {
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Scheduler) postWebhook(ctx context.Context, sch Schedule, rep Report, html string) error {
+	body, err := json.Marshal(webhookPayload{ScheduleID: sch.ID, ScheduleName: sch.Name, Report: rep, HTML: html})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sch.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func subject(sch Schedule, rep Report) string {
+	return fmt.Sprintf("Gatify %s report: %s (%s)", rep.Period, sch.Name, rep.GeneratedAt.Format("2006-01-02"))
+}
@@ -0,0 +1,84 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+)
+
+// page is a self-contained document with inline styles only, so it renders
+// the same when attached to an email.
+var page = template.Must(template.New("report").Funcs(template.FuncMap{
+	"title":   func(s string) string { return strings.ToUpper(s[:1]) + s[1:] },
+	"percent": func(rate float64) string { return fmt.Sprintf("%.1f%%", rate*100) },
+	"share":   share,
+	"stamp":   func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 UTC") },
+	"peak":    peak,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Gatify {{.Period}} report</title>
+</head>
+<body style="font-family:sans-serif;color:#222;max-width:720px;margin:24px auto">
+<h1>{{title .Period}} traffic report</h1>
+<p>{{stamp .From}} to {{stamp .GeneratedAt}}</p>
+
+<table style="border-collapse:collapse;margin-bottom:24px">
+<tr><th style="text-align:left;padding:4px 12px 4px 0">Requests</th><td>{{.Overview.TotalRequests}}</td></tr>
+<tr><th style="text-align:left;padding:4px 12px 4px 0">Blocked</th><td>{{.Overview.BlockedRequests}} ({{percent .Overview.BlockRate}})</td></tr>
+<tr><th style="text-align:left;padding:4px 12px 4px 0">Unique clients</th><td>{{.Overview.UniqueClients}}</td></tr>
+</table>
+
+<h2>Trend</h2>
+{{if .Timeline}}{{$peak := peak .Timeline}}
+<table style="border-collapse:collapse;width:100%">
+<tr><th style="text-align:left">Period</th><th style="text-align:right">Requests</th><th style="text-align:right">Blocked</th><th></th></tr>
+{{range .Timeline}}<tr>
+<td>{{stamp .Bucket}}</td><td style="text-align:right">{{.Total}}</td><td style="text-align:right">{{.Blocked}}</td>
+<td style="width:40%"><div style="background:#4a90d9;height:10px;width:{{share .Total $peak}}%"></div></td>
+</tr>
+{{end}}</table>
+{{else}}<p>No traffic recorded.</p>{{end}}
+
+<h2>Top clients</h2>
+{{if .TopClients}}<table style="border-collapse:collapse;width:100%">
+<tr><th style="text-align:left">Client</th><th style="text-align:right">Requests</th><th style="text-align:right">Blocked</th></tr>
+{{range .TopClients}}<tr><td>{{.ClientID}}</td><td style="text-align:right">{{.Total}}</td><td style="text-align:right">{{.Blocked}}</td></tr>
+{{end}}</table>
+{{else}}<p>No clients recorded.</p>{{end}}
+
+<h2>Top rules</h2>
+{{if .TopRules}}<table style="border-collapse:collapse;width:100%">
+<tr><th style="text-align:left">Rule</th><th style="text-align:right">Requests</th><th style="text-align:right">Blocked</th></tr>
+{{range .TopRules}}<tr><td>{{.RuleID}}</td><td style="text-align:right">{{.Total}}</td><td style="text-align:right">{{.Blocked}}</td></tr>
+{{end}}</table>
+{{else}}<p>No rule matched any request.</p>{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML renders the report as a standalone HTML page.
+func (r Report) WriteHTML(w io.Writer) error {
+	return page.Execute(w, r)
+}
+
+func peak(points []analytics.TimelinePoint) int64 {
+	var top int64
+	for _, p := range points {
+		top = max(top, p.Total)
+	}
+	return top
+}
+
+// share returns n as a whole percentage of peak, for bar widths.
+func share(n, peak int64) int64 {
+	if peak == 0 {
+		return 0
+	}
+	return n * 100 / peak
+}
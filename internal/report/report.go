@@ -0,0 +1,84 @@
+// Package report builds traffic and blocking summaries for stakeholders
+package report
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+)
+
+// Report periods.
+const (
+	PeriodDaily  = "daily"
+	PeriodWeekly = "weekly"
+)
+
+// topN is how many clients and rules a report lists.
+const topN = 10
+
+// ErrUnknownPeriod is returned for periods other than daily and weekly.
+var ErrUnknownPeriod = errors.New("period must be daily or weekly")
+
+// Source answers the analytics queries a report is built from.
+type Source interface {
+	Overview(ctx context.Context, since time.Time) (analytics.Overview, error)
+	Timeline(ctx context.Context, since time.Time, bucket time.Duration) ([]analytics.TimelinePoint, error)
+	TopClients(ctx context.Context, since time.Time, limit int) ([]analytics.ClientTraffic, error)
+	TopRules(ctx context.Context, since time.Time, limit int) ([]analytics.RuleTraffic, error)
+}
+
+// Report summarizes traffic over the day or week before GeneratedAt.
+type Report struct {
+	Period      string                    `json:"period"`
+	From        time.Time                 `json:"from"`
+	GeneratedAt time.Time                 `json:"generated_at"`
+	Overview    analytics.Overview        `json:"overview"`
+	Timeline    []analytics.TimelinePoint `json:"timeline"`
+	TopClients  []analytics.ClientTraffic `json:"top_clients"`
+	TopRules    []analytics.RuleTraffic   `json:"top_rules"`
+}
+
+// span returns the length of a period and the timeline bucket size used
+// to show its trend.
+func span(period string) (length, bucket time.Duration, err error) {
+	switch period {
+	case PeriodDaily:
+		return 24 * time.Hour, time.Hour, nil
+	case PeriodWeekly:
+		return 7 * 24 * time.Hour, 24 * time.Hour, nil
+	}
+	return 0, 0, ErrUnknownPeriod
+}
+
+// ValidPeriod reports whether period names a supported report period.
+func ValidPeriod(period string) bool {
+	_, _, err := span(period)
+	return err == nil
+}
+
+// Generate builds the report for the period ending at now.
+func Generate(ctx context.Context, src Source, period string, now time.Time) (Report, error) {
+	length, bucket, err := span(period)
+	if err != nil {
+		return Report{}, err
+	}
+	r := Report{Period: period, From: now.Add(-length), GeneratedAt: now}
+	ctx = analytics.AsOf(ctx, now)
+
+	if r.Overview, err = src.Overview(ctx, r.From); err != nil {
+		return Report{}, fmt.Errorf("report overview: %w", err)
+	}
+	if r.Timeline, err = src.Timeline(ctx, r.From, bucket); err != nil {
+		return Report{}, fmt.Errorf("report timeline: %w", err)
+	}
+	if r.TopClients, err = src.TopClients(ctx, r.From, topN); err != nil {
+		return Report{}, fmt.Errorf("report top clients: %w", err)
+	}
+	if r.TopRules, err = src.TopRules(ctx, r.From, topN); err != nil {
+		return Report{}, fmt.Errorf("report top rules: %w", err)
+	}
+	return r, nil
+}
@@ -0,0 +1,88 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+)
+
+// fakeSource records the windows it was queried with.
+type fakeSource struct {
+	since  time.Time
+	bucket time.Duration
+	err    error
+}
+
+func (f *fakeSource) Overview(_ context.Context, since time.Time) (analytics.Overview, error) {
+	f.since = since
+	return analytics.Overview{Since: since, TotalRequests: 200, BlockedRequests: 50, UniqueClients: 3, BlockRate: 0.25}, f.err
+}
+
+func (f *fakeSource) Timeline(_ context.Context, since time.Time, bucket time.Duration) ([]analytics.TimelinePoint, error) {
+	f.bucket = bucket
+	return []analytics.TimelinePoint{{Bucket: since, Total: 150, Blocked: 40}, {Bucket: since.Add(bucket), Total: 50, Blocked: 10}}, nil
+}
+
+func (f *fakeSource) TopClients(context.Context, time.Time, int) ([]analytics.ClientTraffic, error) {
+	return []analytics.ClientTraffic{{ClientID: "ip:<script>", Total: 120, Blocked: 45}}, nil
+}
+
+func (f *fakeSource) TopRules(context.Context, time.Time, int) ([]analytics.RuleTraffic, error) {
+	return []analytics.RuleTraffic{{RuleID: "login", Total: 80, Blocked: 50}}, nil
+}
+
+func TestGenerate(t *testing.T) {
+	now := time.Date(2024, 3, 8, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		period string
+		from   time.Time
+		bucket time.Duration
+	}{
+		{PeriodDaily, now.Add(-24 * time.Hour), time.Hour},
+		{PeriodWeekly, now.AddDate(0, 0, -7), 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		src := &fakeSource{}
+		r, err := Generate(context.Background(), src, tt.period, now)
+		if err != nil {
+			t.Fatalf("%s: Generate() error = %v", tt.period, err)
+		}
+		if !r.From.Equal(tt.from) || !src.since.Equal(tt.from) || src.bucket != tt.bucket {
+			t.Errorf("%s: queried from %v by %v, want %v by %v", tt.period, src.since, src.bucket, tt.from, tt.bucket)
+		}
+		if len(r.TopClients) != 1 || len(r.TopRules) != 1 || len(r.Timeline) != 2 {
+			t.Errorf("%s: incomplete report %+v", tt.period, r)
+		}
+	}
+
+	if _, err := Generate(context.Background(), &fakeSource{}, "monthly", now); !errors.Is(err, ErrUnknownPeriod) {
+		t.Errorf("Expected ErrUnknownPeriod, got %v", err)
+	}
+	if _, err := Generate(context.Background(), &fakeSource{err: errors.New("db down")}, PeriodDaily, now); err == nil {
+		t.Error("Expected query errors to be returned")
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	r, err := Generate(context.Background(), &fakeSource{}, PeriodDaily, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	if err := r.WriteHTML(&sb); err != nil {
+		t.Fatalf("WriteHTML() error = %v", err)
+	}
+	out := sb.String()
+	for _, want := range []string{"Daily traffic report", "25.0%", "login", "width:100%", "width:33%"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected report to contain %q", want)
+		}
+	}
+	if strings.Contains(out, "<script>") {
+		t.Error("Expected client IDs to be escaped")
+	}
+}
@@ -0,0 +1,227 @@
+package report
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// schedulesKey holds every report schedule as one JSON document, so all
+// instances see the same schedules.
+const schedulesKey = "gatify:reports:schedules"
+
+// ErrScheduleNotFound is returned when a schedule does not exist.
+var ErrScheduleNotFound = errors.New("report schedule not found")
+
+// Schedule delivers a report whenever its cron expression matches.
+type Schedule struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Cron   string `json:"cron"`
+	Period string `json:"period"`
+	// EmailTo and WebhookURL are the delivery targets; at least one is
+	// required.
+	EmailTo    []string  `json:"email_to,omitempty"`
+	WebhookURL string    `json:"webhook_url,omitempty"`
+	Enabled    bool      `json:"enabled"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	// LastRunAt is the scheduled minute of the last delivery attempt.
+	LastRunAt time.Time `json:"last_run_at,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Validate checks that the schedule is complete and its targets are
+// well formed.
+func (s Schedule) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return errors.New("name is required")
+	}
+	if _, err := ParseCron(s.Cron); err != nil {
+		return err
+	}
+	if !ValidPeriod(s.Period) {
+		return ErrUnknownPeriod
+	}
+	if len(s.EmailTo) == 0 && s.WebhookURL == "" {
+		return errors.New("email_to or webhook_url is required")
+	}
+	for _, addr := range s.EmailTo {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("invalid email address %q", addr)
+		}
+	}
+	if s.WebhookURL != "" {
+		u, err := url.Parse(s.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("webhook_url must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+// Normalize fills in defaults before storage.
+func (s *Schedule) Normalize() {
+	if s.Period == "" {
+		s.Period = PeriodDaily
+	}
+	if c, err := ParseCron(s.Cron); err == nil {
+		s.Cron = c.String()
+	}
+	for i, addr := range s.EmailTo {
+		if parsed, err := mail.ParseAddress(addr); err == nil {
+			s.EmailTo[i] = parsed.Address
+		}
+	}
+	s.WebhookURL = strings.TrimSpace(s.WebhookURL)
+}
+
+// ScheduleStore keeps report schedules in shared storage.
+type ScheduleStore struct {
+	store storage.Storage
+	now   func() time.Time
+	// mu serializes this instance's read-modify-write cycles. Concurrent
+	// edits from different instances are last-write-wins.
+	mu sync.Mutex
+}
+
+// NewScheduleStore creates a ScheduleStore backed by store.
+func NewScheduleStore(store storage.Storage) *ScheduleStore {
+	return &ScheduleStore{store: store, now: time.Now}
+}
+
+// List returns every schedule in creation order.
+func (s *ScheduleStore) List(ctx context.Context) ([]Schedule, error) {
+	raw, err := s.store.Get(ctx, schedulesKey)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return []Schedule{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load report schedules: %w", err)
+	}
+	var list []Schedule
+	if err := json.Unmarshal([]byte(raw), &list); err != nil {
+		return nil, fmt.Errorf("decode report schedules: %w", err)
+	}
+	return list, nil
+}
+
+// Get returns the schedule with the given ID.
+func (s *ScheduleStore) Get(ctx context.Context, id string) (Schedule, error) {
+	list, err := s.List(ctx)
+	if err != nil {
+		return Schedule{}, err
+	}
+	for _, sch := range list {
+		if sch.ID == id {
+			return sch, nil
+		}
+	}
+	return Schedule{}, ErrScheduleNotFound
+}
+
+// Create stores a new schedule, assigning it an ID and timestamps.
+func (s *ScheduleStore) Create(ctx context.Context, sch Schedule) (Schedule, error) {
+	id, err := newID()
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.List(ctx)
+	if err != nil {
+		return Schedule{}, err
+	}
+	now := s.now().UTC()
+	sch.ID = id
+	sch.CreatedAt, sch.UpdatedAt = now, now
+	sch.LastRunAt, sch.LastError = time.Time{}, ""
+	return sch, s.save(ctx, append(list, sch))
+}
+
+// Update replaces an existing schedule's settings, preserving its
+// creation time and delivery history.
+func (s *ScheduleStore) Update(ctx context.Context, sch Schedule) (Schedule, error) {
+	var updated Schedule
+	err := s.modify(ctx, sch.ID, func(existing *Schedule) {
+		sch.CreatedAt = existing.CreatedAt
+		sch.UpdatedAt = s.now().UTC()
+		sch.LastRunAt, sch.LastError = existing.LastRunAt, existing.LastError
+		*existing = sch
+		updated = sch
+	})
+	return updated, err
+}
+
+// Delete removes the schedule with the given ID.
+func (s *ScheduleStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	for i, sch := range list {
+		if sch.ID == id {
+			return s.save(ctx, append(list[:i], list[i+1:]...))
+		}
+	}
+	return ErrScheduleNotFound
+}
+
+// recordRun notes a delivery attempt for the scheduled minute at.
+func (s *ScheduleStore) recordRun(ctx context.Context, id string, at time.Time, runErr error) error {
+	return s.modify(ctx, id, func(sch *Schedule) {
+		sch.LastRunAt = at
+		sch.LastError = ""
+		if runErr != nil {
+			sch.LastError = runErr.Error()
+		}
+	})
+}
+
+func (s *ScheduleStore) modify(ctx context.Context, id string, fn func(*Schedule)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		if list[i].ID == id {
+			fn(&list[i])
+			return s.save(ctx, list)
+		}
+	}
+	return ErrScheduleNotFound
+}
+
+func (s *ScheduleStore) save(ctx context.Context, list []Schedule) error {
+	raw, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Set(ctx, schedulesKey, string(raw), 0); err != nil {
+		return fmt.Errorf("store report schedules: %w", err)
+	}
+	return nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
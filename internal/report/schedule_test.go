@@ -0,0 +1,182 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// mapStorage is a minimal key/value store standing in for Redis.
+type mapStorage struct {
+	storage.Storage
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func (m *mapStorage) Get(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.data[key]
+	if !ok {
+		return "", storage.ErrKeyNotFound
+	}
+	return v, nil
+}
+
+func (m *mapStorage) Set(_ context.Context, key, value string, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = value
+	return nil
+}
+
+type fakeMailer struct {
+	to      []string
+	subject string
+	html    string
+	err     error
+}
+
+func (f *fakeMailer) Send(_ context.Context, to []string, subject, html string) error {
+	f.to, f.subject, f.html = to, subject, html
+	return f.err
+}
+
+func newTestScheduler(mailer Mailer) (*Scheduler, *ScheduleStore) {
+	store := NewScheduleStore(&mapStorage{data: make(map[string]string)})
+	return NewScheduler(store, &fakeSource{}, mailer), store
+}
+
+func TestScheduleValidate(t *testing.T) {
+	valid := Schedule{Name: "ops", Cron: "0 9 * * 1", Period: PeriodWeekly, EmailTo: []string{"ops@example.com"}}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*Schedule)
+	}{
+		{"missing name", func(s *Schedule) { s.Name = "" }},
+		{"bad cron", func(s *Schedule) { s.Cron = "every monday" }},
+		{"bad period", func(s *Schedule) { s.Period = "monthly" }},
+		{"no targets", func(s *Schedule) { s.EmailTo = nil }},
+		{"bad email", func(s *Schedule) { s.EmailTo = []string{"ops"} }},
+		{"bad webhook", func(s *Schedule) { s.WebhookURL = "ftp://example.com" }},
+	}
+	for _, tt := range tests {
+		s := valid
+		s.EmailTo = append([]string(nil), valid.EmailTo...)
+		tt.mutate(&s)
+		if err := s.Validate(); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestScheduleStoreCRUD(t *testing.T) {
+	ctx := context.Background()
+	sch, store := newTestScheduler(&fakeMailer{})
+
+	created, err := sch.Create(ctx, Schedule{Name: "ops", Cron: "0 9 * * *", Period: PeriodDaily, EmailTo: []string{"ops@example.com"}, Enabled: true})
+	if err != nil || created.ID == "" || created.CreatedAt.IsZero() {
+		t.Fatalf("Create() = %+v, %v", created, err)
+	}
+
+	created.Cron = "30 9 * * *"
+	updated, err := sch.Update(ctx, created)
+	if err != nil || updated.Cron != "30 9 * * *" || !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("Update() = %+v, %v", updated, err)
+	}
+
+	list, _ := store.List(ctx)
+	if len(list) != 1 || list[0].Cron != "30 9 * * *" {
+		t.Errorf("Unexpected schedules %+v", list)
+	}
+	if err := sch.Delete(ctx, created.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := sch.Get(ctx, created.ID); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("Expected ErrScheduleNotFound, got %v", err)
+	}
+	if _, err := sch.Update(ctx, created); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("Expected updating a deleted schedule to fail, got %v", err)
+	}
+}
+
+func TestSchedulerRejectsEmailWithoutMailer(t *testing.T) {
+	sch, _ := newTestScheduler(nil)
+	_, err := sch.Create(context.Background(), Schedule{Name: "ops", Cron: "0 9 * * *", Period: PeriodDaily, EmailTo: []string{"ops@example.com"}})
+	if !errors.Is(err, ErrEmailDisabled) {
+		t.Errorf("Expected ErrEmailDisabled, got %v", err)
+	}
+}
+
+func TestSchedulerTickDeliversDueReports(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	var payloads []webhookPayload
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p webhookPayload
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		mu.Lock()
+		payloads = append(payloads, p)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+
+	mailer := &fakeMailer{}
+	sch, store := newTestScheduler(mailer)
+	now := time.Date(2024, 3, 8, 9, 0, 20, 0, time.UTC)
+	sch.now = func() time.Time { return now }
+
+	due, _ := sch.Create(ctx, Schedule{Name: "daily", Cron: "0 9 * * *", Period: PeriodDaily,
+		EmailTo: []string{"ops@example.com"}, WebhookURL: hook.URL, Enabled: true})
+	_, _ = sch.Create(ctx, Schedule{Name: "later", Cron: "0 10 * * *", Period: PeriodDaily, WebhookURL: hook.URL, Enabled: true})
+	_, _ = sch.Create(ctx, Schedule{Name: "off", Cron: "* * * * *", Period: PeriodDaily, WebhookURL: hook.URL})
+
+	if err := sch.Tick(ctx); err != nil {
+		t.Fatalf("Tick() error = %v", err)
+	}
+	// A second tick in the same minute must not deliver again.
+	now = now.Add(30 * time.Second)
+	if err := sch.Tick(ctx); err != nil {
+		t.Fatalf("Tick() error = %v", err)
+	}
+
+	if len(payloads) != 1 || payloads[0].ScheduleID != due.ID || !strings.Contains(payloads[0].HTML, "Daily traffic report") {
+		t.Fatalf("Expected one webhook delivery for the due schedule, got %+v", payloads)
+	}
+	if len(mailer.to) != 1 || !strings.Contains(mailer.subject, "daily") {
+		t.Errorf("Unexpected email to %v with subject %q", mailer.to, mailer.subject)
+	}
+	got, _ := store.Get(ctx, due.ID)
+	if !got.LastRunAt.Equal(time.Date(2024, 3, 8, 9, 0, 0, 0, time.UTC)) || got.LastError != "" {
+		t.Errorf("Expected the run to be recorded, got %+v", got)
+	}
+}
+
+func TestSchedulerRecordsDeliveryErrors(t *testing.T) {
+	ctx := context.Background()
+	sch, store := newTestScheduler(&fakeMailer{err: errors.New("relay refused")})
+	created, _ := sch.Create(ctx, Schedule{Name: "ops", Cron: "* * * * *", Period: PeriodDaily, EmailTo: []string{"ops@example.com"}, Enabled: true})
+
+	if err := sch.Tick(ctx); err != nil {
+		t.Fatalf("Tick() error = %v", err)
+	}
+	got, _ := store.Get(ctx, created.ID)
+	if !strings.Contains(got.LastError, "relay refused") {
+		t.Errorf("Expected the delivery error to be recorded, got %q", got.LastError)
+	}
+	if err := sch.Send(ctx, created.ID); err == nil {
+		t.Error("Expected Send to return the delivery error")
+	}
+}
@@ -0,0 +1,63 @@
+// Package restart lets a new gatify process take over the listening socket
+// of a running one, for zero-downtime binary upgrades
+package restart
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// Environment variables through which a parent process passes the
+// inherited listener and the readiness pipe to its replacement.
+const (
+	listenFDEnv = "GATIFY_LISTEN_FD"
+	readyFDEnv  = "GATIFY_READY_FD"
+)
+
+// ErrReusePortUnsupported is returned when SO_REUSEPORT is requested on a
+// platform without it.
+var ErrReusePortUnsupported = errors.New("SO_REUSEPORT is not supported on this platform")
+
+// Listen returns the listener inherited from a parent process when there
+// is one, and otherwise binds addr. With reusePort, several processes can
+// bind the same address and the kernel spreads connections between them.
+func Listen(addr string, reusePort bool) (ln net.Listener, inherited bool, err error) {
+	if fd, ok := envFD(listenFDEnv); ok {
+		os.Unsetenv(listenFDEnv)
+		f := os.NewFile(fd, "gatify-listener")
+		defer f.Close()
+		ln, err := net.FileListener(f)
+		if err != nil {
+			return nil, false, fmt.Errorf("inherit listener: %w", err)
+		}
+		return ln, true, nil
+	}
+	ln, err = listen(addr, reusePort)
+	return ln, false, err
+}
+
+// Ready tells the parent process, if any, that this process is serving
+// so the parent can start draining. It is a no-op for processes that were
+// not started by Handover.
+func Ready() error {
+	fd, ok := envFD(readyFDEnv)
+	if !ok {
+		return nil
+	}
+	os.Unsetenv(readyFDEnv)
+	f := os.NewFile(fd, "gatify-ready")
+	defer f.Close()
+	_, err := f.Write([]byte{1})
+	return err
+}
+
+func envFD(key string) (uintptr, bool) {
+	n, err := strconv.ParseUint(os.Getenv(key), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uintptr(n), true
+}
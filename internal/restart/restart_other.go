@@ -0,0 +1,27 @@
+//go:build !unix
+
+package restart
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+// UpgradeSignal is nil where listener handover is unsupported.
+var UpgradeSignal os.Signal
+
+func listen(addr string, reusePort bool) (net.Listener, error) {
+	if reusePort {
+		return nil, ErrReusePortUnsupported
+	}
+	var lc net.ListenConfig
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// Handover is not supported on this platform.
+func Handover(net.Listener, time.Duration) (int, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,93 @@
+//go:build unix
+
+package restart
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestListenReusePort(t *testing.T) {
+	first, inherited, err := Listen("127.0.0.1:0", true)
+	if err != nil {
+		t.Skipf("SO_REUSEPORT unavailable: %v", err)
+	}
+	defer first.Close()
+	if inherited {
+		t.Error("Expected a fresh listener")
+	}
+
+	second, _, err := Listen(first.Addr().String(), true)
+	if err != nil {
+		t.Fatalf("Expected a second listener on the same port, got %v", err)
+	}
+	second.Close()
+}
+
+func TestListenInheritsListener(t *testing.T) {
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parent.Close()
+	f, err := parent.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	t.Setenv(listenFDEnv, strconv.Itoa(dup(t, f)))
+	ln, inherited, err := Listen("127.0.0.1:1", false)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+	if !inherited || ln.Addr().String() != parent.Addr().String() {
+		t.Errorf("Expected the inherited listener on %s, got %s (inherited %v)", parent.Addr(), ln.Addr(), inherited)
+	}
+	if os.Getenv(listenFDEnv) != "" {
+		t.Error("Expected the descriptor variable to be cleared for grandchildren")
+	}
+}
+
+func TestReadyNotifiesParent(t *testing.T) {
+	if err := Ready(); err != nil {
+		t.Fatalf("Ready() without a parent error = %v", err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	t.Setenv(readyFDEnv, strconv.Itoa(dup(t, w)))
+	w.Close()
+	if err := Ready(); err != nil {
+		t.Fatalf("Ready() error = %v", err)
+	}
+	if err := waitReady(r, time.Second); err != nil {
+		t.Fatalf("Expected the parent to be notified, got %v", err)
+	}
+}
+
+// dup returns a copy of f's descriptor, standing in for one inherited
+// from a parent process, which the code under test takes ownership of.
+func dup(t *testing.T, f *os.File) int {
+	t.Helper()
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd
+}
+
+func TestWithoutHandoverEnv(t *testing.T) {
+	got := withoutHandoverEnv([]string{"A=1", listenFDEnv + "=3", "B=2", readyFDEnv + "=4"})
+	if len(got) != 2 || got[0] != "A=1" || got[1] != "B=2" {
+		t.Errorf("Unexpected environment %v", got)
+	}
+}
@@ -0,0 +1,107 @@
+//go:build unix
+
+package restart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// UpgradeSignal asks a running process to hand its listener over to a
+// freshly started copy of its binary.
+var UpgradeSignal os.Signal = syscall.SIGUSR2
+
+func listen(addr string, reusePort bool) (net.Listener, error) {
+	lc := net.ListenConfig{}
+	if reusePort {
+		if soReusePort < 0 {
+			return nil, ErrReusePortUnsupported
+		}
+		lc.Control = func(_, _ string, c syscall.RawConn) error {
+			var sockErr error
+			if err := c.Control(func(fd uintptr) {
+				sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+			}); err != nil {
+				return err
+			}
+			return sockErr
+		}
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// Handover starts a new instance of the running binary with the same
+// arguments, passing it ln, and waits up to timeout for it to report
+// Ready. On success the caller should stop accepting and drain; the new
+// process keeps serving on the shared socket, so no connection is refused
+// in between. If the new process fails to start or become ready it is
+// killed and the caller keeps serving.
+func Handover(ln net.Listener, timeout time.Duration) (int, error) {
+	filer, ok := ln.(interface{ File() (*os.File, error) })
+	if !ok {
+		return 0, errors.New("listener cannot be handed over")
+	}
+	lnFile, err := filer.File()
+	if err != nil {
+		return 0, fmt.Errorf("duplicate listener: %w", err)
+	}
+	defer lnFile.Close()
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer readyR.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		readyW.Close()
+		return 0, err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// ExtraFiles start at descriptor 3 in the child.
+	cmd.ExtraFiles = []*os.File{lnFile, readyW}
+	cmd.Env = append(withoutHandoverEnv(os.Environ()), listenFDEnv+"=3", readyFDEnv+"=4")
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return 0, fmt.Errorf("start new process: %w", err)
+	}
+
+	if err := waitReady(readyR, timeout); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return 0, fmt.Errorf("new process did not become ready: %w", err)
+	}
+	pid := cmd.Process.Pid
+	_ = cmd.Process.Release()
+	return pid, nil
+}
+
+func waitReady(r *os.File, timeout time.Duration) error {
+	if err := r.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	buf := make([]byte, 1)
+	_, err := r.Read(buf)
+	return err
+}
+
+func withoutHandoverEnv(env []string) []string {
+	out := make([]string, 0, len(env))
+	for _, kv := range env {
+		if strings.HasPrefix(kv, listenFDEnv+"=") || strings.HasPrefix(kv, readyFDEnv+"=") {
+			continue
+		}
+		out = append(out, kv)
+	}
+	return out
+}
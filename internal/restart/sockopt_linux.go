@@ -0,0 +1,7 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+
+package restart
+
+// soReusePort is SO_REUSEPORT, which the syscall package does not define
+// for Linux.
+const soReusePort = 0xf
@@ -0,0 +1,6 @@
+//go:build unix && !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package restart
+
+// soReusePort marks SO_REUSEPORT as unavailable.
+const soReusePort = -1
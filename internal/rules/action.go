@@ -0,0 +1,117 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Rule actions, which answer matching requests at the gateway instead of
+// forwarding them to the backend.
+const (
+	// ActionBlock rejects every matching request, by default with 403.
+	ActionBlock = "block"
+	// ActionRedirect redirects matching requests, by default with 302.
+	ActionRedirect = "redirect"
+	// ActionMock answers matching requests with a static response.
+	ActionMock = "mock"
+)
+
+// maxActionBody bounds the size of an action's response body.
+const maxActionBody = 64 << 10
+
+// RuleAction makes a rule answer requests itself, turning it from a rate
+// limit into a request policy. Blocked requests are rejected before
+// they are counted; redirects and mocks are rate limited like forwarded
+// requests.
+type RuleAction struct {
+	Type string `json:"type"`
+	// Status overrides the response status: 403 for block, 302 for
+	// redirect and 200 for mock by default.
+	Status int `json:"status,omitempty"`
+	// URL is where a redirect sends the client, absolute or a path.
+	URL string `json:"url,omitempty"`
+	// Body and ContentType are the response of a block or mock.
+	Body        string `json:"body,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// Blocks reports whether the action rejects requests.
+func (a *RuleAction) Blocks() bool {
+	return a != nil && a.Type == ActionBlock
+}
+
+// Responds reports whether the action answers requests the limit admits,
+// in place of the backend.
+func (a *RuleAction) Responds() bool {
+	return a != nil && (a.Type == ActionRedirect || a.Type == ActionMock)
+}
+
+func (a *RuleAction) validate() error {
+	if a == nil {
+		return nil
+	}
+	switch a.Type {
+	case ActionBlock:
+		if a.Status < 400 || a.Status > 599 {
+			return errors.New("action.status of a block must be between 400 and 599")
+		}
+	case ActionRedirect:
+		switch a.Status {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+			http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return errors.New("action.status of a redirect must be 301, 302, 303, 307 or 308")
+		}
+		u, err := url.Parse(a.URL)
+		if a.URL == "" || err != nil || (!u.IsAbs() && !strings.HasPrefix(a.URL, "/")) {
+			return errors.New("action.url must be an absolute URL or a path")
+		}
+		if a.Body != "" {
+			return errors.New("action.body is not sent with a redirect")
+		}
+	case ActionMock:
+		if a.Status < 200 || a.Status > 599 {
+			return errors.New("action.status of a mock must be between 200 and 599")
+		}
+	default:
+		return fmt.Errorf("action.type must be %q, %q or %q", ActionBlock, ActionRedirect, ActionMock)
+	}
+	if a.Type != ActionRedirect && a.URL != "" {
+		return errors.New("action.url is only used by redirects")
+	}
+	if len(a.Body) > maxActionBody {
+		return fmt.Errorf("action.body must be at most %d bytes", maxActionBody)
+	}
+	if a.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(a.ContentType); err != nil {
+			return fmt.Errorf("invalid action.content_type %q", a.ContentType)
+		}
+	}
+	return nil
+}
+
+func (a *RuleAction) normalize() {
+	if a == nil {
+		return
+	}
+	a.Type = strings.ToLower(strings.TrimSpace(a.Type))
+	a.URL = strings.TrimSpace(a.URL)
+	a.ContentType = strings.TrimSpace(a.ContentType)
+	if a.Status == 0 {
+		switch a.Type {
+		case ActionBlock:
+			a.Status = http.StatusForbidden
+		case ActionRedirect:
+			a.Status = http.StatusFound
+		case ActionMock:
+			a.Status = http.StatusOK
+		}
+	}
+	if a.Body != "" && a.ContentType == "" {
+		a.ContentType = "application/json"
+	}
+}
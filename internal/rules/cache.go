@@ -0,0 +1,42 @@
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Response headers a rule may set to govern downstream caches and CDNs.
+const (
+	HeaderCacheControl    = "Cache-Control"
+	HeaderCDNCacheControl = "Cdn-Cache-Control"
+	HeaderSurrogateKey    = "Surrogate-Key"
+)
+
+func validateCacheHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		switch name {
+		case HeaderCacheControl, HeaderCDNCacheControl, HeaderSurrogateKey:
+		default:
+			return fmt.Errorf("unsupported cache header %q: use Cache-Control, CDN-Cache-Control or Surrogate-Key", name)
+		}
+		if strings.TrimSpace(value) == "" {
+			return fmt.Errorf("cache header %s needs a value", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("cache header %s must not contain line breaks", name)
+		}
+	}
+	return nil
+}
+
+func normalizeCacheHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return headers
+	}
+	out := make(map[string]string, len(headers))
+	for name, value := range headers {
+		out[http.CanonicalHeaderKey(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// MaxCaptureHeaders bounds how many response headers a rule records per
+// event, since each becomes a stored dimension.
+const MaxCaptureHeaders = 5
+
+// uncapturableHeaders carry secrets or are unique per response and make
+// no useful dimension.
+var uncapturableHeaders = map[string]bool{
+	"Set-Cookie":       true,
+	"Www-Authenticate": true,
+	"Date":             true,
+}
+
+func validateCaptureHeaders(names []string) error {
+	if len(names) > MaxCaptureHeaders {
+		return fmt.Errorf("capture_headers allows at most %d headers", MaxCaptureHeaders)
+	}
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if err := validateHeaderName("captured", name); err != nil {
+			return err
+		}
+		canonical := http.CanonicalHeaderKey(name)
+		if uncapturableHeaders[canonical] {
+			return fmt.Errorf("header %s cannot be captured", canonical)
+		}
+		for _, other := range names[:i] {
+			if http.CanonicalHeaderKey(strings.TrimSpace(other)) == canonical {
+				return fmt.Errorf("header %s is captured twice", canonical)
+			}
+		}
+	}
+	return nil
+}
+
+func normalizeCaptureHeaders(names []string) []string {
+	for i, name := range names {
+		names[i] = http.CanonicalHeaderKey(strings.TrimSpace(name))
+	}
+	return slices.Clip(names)
+}
@@ -0,0 +1,159 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fileDocument is the layout of a rules file:
+//
+//	{"schema_version": 2, "rules": [{"id": "search", "name": "search", "pattern": "/search", ...}]}
+type fileDocument struct {
+	SchemaVersion int               `json:"schema_version"`
+	Rules         []json.RawMessage `json:"rules"`
+}
+
+// LoadFile reads declarative rules from a JSON file. Every rule needs a
+// stable id of letters, digits, - and _, since limiter counters are keyed
+// by it, and rules are enabled unless they say otherwise. Unknown fields
+// are rejected so typos do not silently drop settings, unless the file
+// declares a newer schema_version than this build's: those are logged
+// and skipped. YAML is not supported, and .yaml and .yml files are
+// refused by name rather than failing as malformed JSON.
+func LoadFile(path string) ([]Rule, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return nil, fmt.Errorf("%s: YAML not supported, use JSON", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc fileDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	list := make([]Rule, 0, len(doc.Rules))
+	seen := make(map[string]bool, len(doc.Rules))
+	for i, raw := range doc.Rules {
+		rule := Rule{Enabled: true}
+		ignored, err := DecodeRule(raw, doc.SchemaVersion, &rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		if len(ignored) > 0 {
+			log.Printf("⚠️  Rule %q in %s: ignoring fields from schema version %d: %s", rule.ID, path, doc.SchemaVersion, strings.Join(ignored, ", "))
+		}
+		if rule.ID == "" {
+			return nil, fmt.Errorf("rule %d: id is required", i)
+		}
+		// The id becomes a hash tag in limiter keys, which braces and
+		// colons would break.
+		if !validName(rule.ID) {
+			return nil, fmt.Errorf("rule %d: invalid id %q: use letters, digits, - and _", i, rule.ID)
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("rule %q: duplicate id", rule.ID)
+		}
+		seen[rule.ID] = true
+
+		rule.Normalize()
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.ID, err)
+		}
+		list = append(list, rule)
+	}
+	return list, nil
+}
+
+// FileWatcher reloads a rules file whenever it changes. Changes are
+// detected by polling the file's modification time and size, which also
+// works for config maps and other files that are replaced by renaming.
+type FileWatcher struct {
+	path     string
+	interval time.Duration
+	onLoad   func([]Rule)
+	// algorithm is the gateway's LIMITER_ALGORITHM, if set.
+	algorithm string
+
+	modTime time.Time
+	size    int64
+}
+
+// NewFileWatcher creates a watcher that passes the rules in path to
+// onLoad, checking for changes every interval.
+func NewFileWatcher(path string, interval time.Duration, onLoad func([]Rule)) *FileWatcher {
+	return &FileWatcher{path: path, interval: interval, onLoad: onLoad}
+}
+
+// SetDefaultAlgorithm has Load reject rules relying on settings that
+// name, the gateway's LIMITER_ALGORITHM, ignores.
+func (w *FileWatcher) SetDefaultAlgorithm(name string) {
+	w.algorithm = name
+}
+
+// Load reads the file and hands its rules to onLoad. A file that fails to
+// load is reported without calling onLoad, so the previous rules stay in
+// effect.
+func (w *FileWatcher) Load() error {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return err
+	}
+	w.modTime, w.size = info.ModTime(), info.Size()
+
+	list, err := LoadFile(w.path)
+	if err != nil {
+		return err
+	}
+	for _, rule := range list {
+		if err := rule.CheckAlgorithm(w.algorithm); err != nil {
+			return fmt.Errorf("rule %q: %w", rule.ID, err)
+		}
+	}
+	w.onLoad(list)
+	return nil
+}
+
+// Run polls the file until ctx is cancelled, reloading it after each
+// change.
+func (w *FileWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := w.changed()
+		if err != nil {
+			log.Printf("Failed to check rules file %s: %v", w.path, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := w.Load(); err != nil {
+			log.Printf("⚠️  Keeping previous rules, %s is invalid: %v", w.path, err)
+			continue
+		}
+		log.Printf("🔄 Reloaded rules from %s", w.path)
+	}
+}
+
+func (w *FileWatcher) changed() (bool, error) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return false, err
+	}
+	return !info.ModTime().Equal(w.modTime) || info.Size() != w.size, nil
+}
@@ -0,0 +1,142 @@
+package rules
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeRulesFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRulesFile(t, path, `{"rules":[
+		{"id":"search","name":"search","pattern":"/search","limit":10,"window_seconds":60},
+		{"id":"off","name":"off","pattern":"/off","limit":1,"window_seconds":1,"enabled":false}
+	]}`)
+
+	list, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if len(list) != 2 || !list[0].Enabled || list[1].Enabled {
+		t.Fatalf("Unexpected rules %+v", list)
+	}
+	if list[0].IdentifyBy != IdentifyByIP {
+		t.Errorf("Expected rules to be normalized, got identify_by %q", list[0].IdentifyBy)
+	}
+}
+
+func TestLoadFileRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"missing id", `{"rules":[{"name":"a","pattern":"/a","limit":1,"window_seconds":1}]}`, "id is required"},
+		{"id with braces", `{"rules":[{"id":"a}b","name":"a","pattern":"/a","limit":1,"window_seconds":1}]}`, "invalid id"},
+		{"id with colon", `{"rules":[{"id":"a:b","name":"a","pattern":"/a","limit":1,"window_seconds":1}]}`, "invalid id"},
+		{"duplicate id", `{"rules":[{"id":"a","name":"a","pattern":"/a","limit":1,"window_seconds":1},{"id":"a","name":"b","pattern":"/b","limit":1,"window_seconds":1}]}`, "duplicate id"},
+		{"unknown field", `{"rules":[{"id":"a","name":"a","pattern":"/a","limit":1,"window_secs":1}]}`, "unknown field"},
+		{"invalid rule", `{"rules":[{"id":"a","name":"a","pattern":"a","limit":1,"window_seconds":1}]}`, "pattern must start with /"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "rules.json")
+		writeRulesFile(t, path, tt.content)
+		if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestLoadFileRejectsYAML(t *testing.T) {
+	for _, name := range []string{"rules.yaml", "rules.YML"} {
+		path := filepath.Join(t.TempDir(), name)
+		writeRulesFile(t, path, "rules:\n  - id: search\n")
+		if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), "YAML not supported, use JSON") {
+			t.Errorf("%s: error = %v, want YAML to be refused", name, err)
+		}
+	}
+}
+
+func TestLoadFileFromNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRulesFile(t, path, `{"schema_version":99,"rules":[
+		{"id":"search","name":"search","pattern":"/search","limit":10,"window_seconds":60,"labels":["public"]}
+	]}`)
+
+	list, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if len(list) != 1 || list[0].Limit != 10 || !list[0].Enabled {
+		t.Errorf("Unexpected rules %+v", list)
+	}
+}
+
+func TestFileWatcherChecksDefaultAlgorithm(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRulesFile(t, path, `{"rules":[{"id":"a","name":"a","pattern":"/a","limit":1,"window_seconds":1,"burst":5}]}`)
+
+	loaded := false
+	w := NewFileWatcher(path, time.Minute, func([]Rule) { loaded = true })
+	w.SetDefaultAlgorithm("gcra")
+	if err := w.Load(); err == nil || loaded {
+		t.Errorf("Expected burst under a gcra gateway to be rejected, got %v", err)
+	}
+	w.SetDefaultAlgorithm("sliding_window")
+	if err := w.Load(); err != nil || !loaded {
+		t.Errorf("Load() error = %v", err)
+	}
+}
+
+func TestFileWatcherReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRulesFile(t, path, `{"rules":[{"id":"a","name":"a","pattern":"/a","limit":1,"window_seconds":1}]}`)
+
+	var mu sync.Mutex
+	var loaded [][]Rule
+	w := NewFileWatcher(path, 10*time.Millisecond, func(list []Rule) {
+		mu.Lock()
+		defer mu.Unlock()
+		loaded = append(loaded, list)
+	})
+	if err := w.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	// An invalid edit keeps the previous rules; the fix is picked up.
+	writeRulesFile(t, path, `{"rules":[{"id":"a"}]}`)
+	time.Sleep(50 * time.Millisecond)
+	writeRulesFile(t, path, `{"rules":[{"id":"a","name":"a","pattern":"/a","limit":1,"window_seconds":1},{"id":"b","name":"b","pattern":"/b","limit":2,"window_seconds":1}]}`)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := len(loaded)
+		mu.Unlock()
+		if n >= 2 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(loaded) != 2 || len(loaded[1]) != 2 {
+		t.Fatalf("Expected the initial and fixed rules to be loaded, got %+v", loaded)
+	}
+}
@@ -0,0 +1,205 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Placeholders a header rewrite value may contain. They are expanded per
+// request; {request_id} is a random ID shared by the request and its
+// response.
+const (
+	PlaceholderRequestID = "{request_id}"
+	PlaceholderClientID  = "{client_id}"
+	PlaceholderRuleID    = "{rule_id}"
+	PlaceholderRoute     = "{route}"
+)
+
+var placeholders = []string{PlaceholderRequestID, PlaceholderClientID, PlaceholderRuleID, PlaceholderRoute}
+
+// protectedHeaders frame the message or the connection and are managed by
+// the gateway itself.
+var protectedHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Upgrade":           true,
+	"Te":                true,
+	"Trailer":           true,
+}
+
+// HeaderRewrite changes headers on requests matching a rule before they
+// are forwarded, and on the backend's responses before they reach the
+// client. Responses generated by the gateway itself, such as 429s, are
+// not rewritten.
+type HeaderRewrite struct {
+	Request  *HeaderEdits `json:"request,omitempty"`
+	Response *HeaderEdits `json:"response,omitempty"`
+}
+
+// HeaderEdits are applied in field order: Remove, then Set, then Default,
+// then Add.
+type HeaderEdits struct {
+	// Remove deletes headers. A trailing * removes every header with the
+	// prefix, e.g. "X-Internal-*".
+	Remove []string `json:"remove,omitempty"`
+	// Set replaces headers.
+	Set map[string]string `json:"set,omitempty"`
+	// Default sets headers that are not already present, e.g. an
+	// X-Request-Id the client did not send.
+	Default map[string]string `json:"default,omitempty"`
+	// Add appends values to headers.
+	Add map[string]string `json:"add,omitempty"`
+}
+
+func (h *HeaderRewrite) validate() error {
+	if h == nil {
+		return nil
+	}
+	if h.Request == nil && h.Response == nil {
+		return errors.New("headers needs request or response edits")
+	}
+	if err := h.Request.validate("request"); err != nil {
+		return err
+	}
+	return h.Response.validate("response")
+}
+
+func (e *HeaderEdits) validate(side string) error {
+	if e == nil {
+		return nil
+	}
+	for _, name := range e.Remove {
+		if err := validateHeaderName(side, strings.TrimSuffix(strings.TrimSpace(name), "*")); err != nil {
+			return err
+		}
+	}
+	for _, values := range []map[string]string{e.Set, e.Default, e.Add} {
+		for name, value := range values {
+			if err := validateHeaderName(side, strings.TrimSpace(name)); err != nil {
+				return err
+			}
+			if err := validateHeaderValue(side, name, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateHeaderName(side, name string) error {
+	if name == "" {
+		return fmt.Errorf("%s header names must not be empty", side)
+	}
+	if strings.ContainsAny(name, " \t\r\n:") {
+		return fmt.Errorf("invalid %s header name %q", side, name)
+	}
+	if protectedHeaders[http.CanonicalHeaderKey(name)] {
+		return fmt.Errorf("%s header %s cannot be rewritten", side, http.CanonicalHeaderKey(name))
+	}
+	return nil
+}
+
+func validateHeaderValue(side, name, value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("%s header %s must not contain line breaks", side, name)
+	}
+	// Strip known placeholders; any brace left over is a typo.
+	rest := value
+	for _, p := range placeholders {
+		rest = strings.ReplaceAll(rest, p, "")
+	}
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("%s header %s has an unknown placeholder: use %s", side, name, strings.Join(placeholders, ", "))
+	}
+	return nil
+}
+
+func (h *HeaderRewrite) normalize() {
+	if h == nil {
+		return
+	}
+	h.Request.normalize()
+	h.Response.normalize()
+}
+
+func (e *HeaderEdits) normalize() {
+	if e == nil {
+		return
+	}
+	for i, name := range e.Remove {
+		name = strings.TrimSpace(name)
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			e.Remove[i] = http.CanonicalHeaderKey(prefix) + "*"
+			continue
+		}
+		e.Remove[i] = http.CanonicalHeaderKey(name)
+	}
+	e.Set = canonicalHeaders(e.Set)
+	e.Default = canonicalHeaders(e.Default)
+	e.Add = canonicalHeaders(e.Add)
+}
+
+func canonicalHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return headers
+	}
+	out := make(map[string]string, len(headers))
+	for name, value := range headers {
+		out[http.CanonicalHeaderKey(strings.TrimSpace(name))] = value
+	}
+	return out
+}
+
+// UsesRequestID reports whether any edit expands {request_id}.
+func (h *HeaderRewrite) UsesRequestID() bool {
+	if h == nil {
+		return false
+	}
+	for _, e := range []*HeaderEdits{h.Request, h.Response} {
+		if e == nil {
+			continue
+		}
+		for _, values := range []map[string]string{e.Set, e.Default, e.Add} {
+			for _, v := range values {
+				if strings.Contains(v, PlaceholderRequestID) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (h *HeaderRewrite) clone() *HeaderRewrite {
+	if h == nil {
+		return nil
+	}
+	return &HeaderRewrite{Request: h.Request.clone(), Response: h.Response.clone()}
+}
+
+func (e *HeaderEdits) clone() *HeaderEdits {
+	if e == nil {
+		return nil
+	}
+	return &HeaderEdits{
+		Remove:  append([]string(nil), e.Remove...),
+		Set:     cloneStrings(e.Set),
+		Default: cloneStrings(e.Default),
+		Add:     cloneStrings(e.Add),
+	}
+}
+
+func cloneStrings(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
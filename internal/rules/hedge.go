@@ -0,0 +1,44 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxHedgeAfterMS bounds how long a hedged request waits before the
+// second attempt.
+const MaxHedgeAfterMS = 10000
+
+// Hedge sends a second attempt of a slow GET or HEAD request and serves
+// whichever response arrives first, trading backend load for tail
+// latency. Other methods are never hedged as they may not be idempotent.
+type Hedge struct {
+	// AfterMS is how long the first attempt may take before the second
+	// one is sent, typically around the backend's p95 latency.
+	AfterMS int `json:"after_ms"`
+	// Upstream names a replica serving the same paths for the second
+	// attempt. Empty means the rule's own upstream, which helps when it
+	// load balances across replicas.
+	Upstream string `json:"upstream,omitempty"`
+}
+
+func (h *Hedge) validate() error {
+	if h == nil {
+		return nil
+	}
+	if h.AfterMS <= 0 || h.AfterMS > MaxHedgeAfterMS {
+		return fmt.Errorf("hedge.after_ms must be between 1 and %d", MaxHedgeAfterMS)
+	}
+	if h.Upstream != "" && !ValidUpstreamName(h.Upstream) {
+		return errors.New("hedge.upstream must use letters, digits, - and _")
+	}
+	return nil
+}
+
+func (h *Hedge) normalize() {
+	if h == nil {
+		return
+	}
+	h.Upstream = strings.TrimSpace(h.Upstream)
+}
@@ -0,0 +1,43 @@
+package rules
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultHoneypotBanSeconds is how long a honeypot bans clients when the
+// rule does not say.
+const DefaultHoneypotBanSeconds = 3600
+
+// maxHoneypotBanSeconds bounds a honeypot ban to 30 days.
+const maxHoneypotBanSeconds = 30 * 24 * 3600
+
+// Honeypot turns a rule into a trap for scanners. Its pattern names paths
+// no legitimate client requests, such as /wp-admin/* or /.env, and any
+// request matching it bans the client's IP address from the gateway.
+type Honeypot struct {
+	// BanSeconds is how long the client stays banned. It defaults to an
+	// hour.
+	BanSeconds int64 `json:"ban_seconds,omitempty"`
+}
+
+// BanDuration returns how long a client hitting the honeypot is banned.
+func (h *Honeypot) BanDuration() time.Duration {
+	return time.Duration(h.BanSeconds) * time.Second
+}
+
+func (h *Honeypot) validate() error {
+	if h == nil {
+		return nil
+	}
+	if h.BanSeconds < 0 || h.BanSeconds > maxHoneypotBanSeconds {
+		return fmt.Errorf("honeypot.ban_seconds must be between 0 and %d", maxHoneypotBanSeconds)
+	}
+	return nil
+}
+
+func (h *Honeypot) normalize() {
+	if h != nil && h.BanSeconds == 0 {
+		h.BanSeconds = DefaultHoneypotBanSeconds
+	}
+}
@@ -0,0 +1,175 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// maxIdentityTemplate bounds the length of a composite identify_by.
+const maxIdentityTemplate = 128
+
+// IdentityPart is one piece of a composite identity: literal Text, or a
+// value read from the request.
+type IdentityPart struct {
+	// Source is IdentifyByIP, IdentifyByHeader, IdentifyByCountry or
+	// IdentifyByCookie, and empty for literal text.
+	Source string
+	// Name is the header or cookie to read. When empty, header parts use
+	// the rule's header_name or header_names and cookie parts its
+	// cookie_name.
+	Name string
+	Text string
+}
+
+// Composite reports whether the rule identifies clients by a combination
+// of sources: a "+" list such as "ip+header", or a template such as
+// "{ip}:{header:X-Tenant}", for clients that share an address but not a
+// tenant.
+func (r Rule) Composite() bool {
+	return strings.ContainsAny(r.IdentifyBy, "+{")
+}
+
+// IdentityParts parses a composite IdentifyBy. A "+" list becomes the
+// template "ip:{ip}+header:{header}", so its keys name their sources.
+func (r Rule) IdentityParts() ([]IdentityPart, error) {
+	if len(r.IdentifyBy) > maxIdentityTemplate {
+		return nil, fmt.Errorf("identify_by must be at most %d characters", maxIdentityTemplate)
+	}
+	if !strings.Contains(r.IdentifyBy, "{") {
+		return parseIdentityList(r.IdentifyBy)
+	}
+	return parseIdentityTemplate(r.IdentifyBy)
+}
+
+func parseIdentityList(list string) ([]IdentityPart, error) {
+	var parts []IdentityPart
+	var seen []string
+	for i, source := range strings.Split(list, "+") {
+		source = strings.TrimSpace(source)
+		if !identitySource(source) {
+			return nil, fmt.Errorf("unsupported identity %q in identify_by", source)
+		}
+		if slices.Contains(seen, source) {
+			return nil, fmt.Errorf("identity %q appears twice in identify_by", source)
+		}
+		seen = append(seen, source)
+		text := source + ":"
+		if i > 0 {
+			text = "+" + text
+		}
+		parts = append(parts, IdentityPart{Text: text}, IdentityPart{Source: source})
+	}
+	return parts, nil
+}
+
+func parseIdentityTemplate(tmpl string) ([]IdentityPart, error) {
+	var parts []IdentityPart
+	placeholders := 0
+	for rest := tmpl; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if end := strings.IndexByte(rest, '}'); end >= 0 && (open < 0 || end < open) {
+			return nil, errors.New("unbalanced braces in identify_by")
+		}
+		if open < 0 {
+			parts = append(parts, IdentityPart{Text: rest})
+			break
+		}
+		if open > 0 {
+			parts = append(parts, IdentityPart{Text: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, errors.New("unbalanced braces in identify_by")
+		}
+		source, name, _ := strings.Cut(rest[open+1:open+end], ":")
+		if !identitySource(source) {
+			return nil, fmt.Errorf("unknown placeholder {%s} in identify_by", rest[open+1:open+end])
+		}
+		if name != "" && source != IdentifyByHeader && source != IdentifyByCookie {
+			return nil, fmt.Errorf("placeholder {%s} does not take a name", source)
+		}
+		parts = append(parts, IdentityPart{Source: source, Name: name})
+		placeholders++
+		rest = rest[open+end+1:]
+	}
+	if placeholders == 0 {
+		return nil, errors.New("identify_by template needs a placeholder such as {ip}")
+	}
+	return parts, nil
+}
+
+func identitySource(s string) bool {
+	switch s {
+	case IdentifyByIP, IdentifyByHeader, IdentifyByCountry, IdentifyByCookie:
+		return true
+	}
+	return false
+}
+
+// validateCompositeIdentity checks that every part of a composite identity
+// names a header or cookie to read.
+func (r Rule) validateCompositeIdentity() error {
+	parts, err := r.IdentityParts()
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		switch p.Source {
+		case IdentifyByHeader:
+			if p.Name != "" {
+				if strings.ContainsAny(p.Name, " \t\r\n") {
+					return fmt.Errorf("invalid header %q in identify_by", p.Name)
+				}
+			} else if err := r.validateIdentityHeaders(); err != nil {
+				return err
+			}
+		case IdentifyByCookie:
+			name := p.Name
+			if name == "" {
+				if r.CookieName == "" {
+					return errors.New("cookie_name is required when identify_by reads a cookie")
+				}
+				name = r.CookieName
+			}
+			if err := (&http.Cookie{Name: name}).Valid(); err != nil {
+				return fmt.Errorf("invalid cookie name %q", name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateJWTClaim checks the claim name of a rule identifying clients by
+// JWT claim.
+func validateJWTClaim(claim string) error {
+	if claim == "" {
+		return errors.New("jwt_claim is required when identify_by is jwt_claim")
+	}
+	if len(claim) > maxIdentityTemplate || strings.ContainsAny(claim, " \t\r\n") || slices.Contains(strings.Split(claim, "."), "") {
+		return fmt.Errorf("invalid jwt_claim %q", claim)
+	}
+	return nil
+}
+
+// validateIdentityHeaders checks the header_name or header_names of a rule
+// identifying clients by header.
+func (r Rule) validateIdentityHeaders() error {
+	if len(r.HeaderNames) > 0 {
+		if r.HeaderName != "" {
+			return errors.New("set header_name or header_names, not both")
+		}
+		for _, h := range r.HeaderNames {
+			if strings.TrimSpace(h) == "" {
+				return errors.New("header_names must not contain empty names")
+			}
+		}
+		return nil
+	}
+	if strings.TrimSpace(r.HeaderName) == "" {
+		return errors.New("header_name is required when identify_by is header")
+	}
+	return nil
+}
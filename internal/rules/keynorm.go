@@ -0,0 +1,104 @@
+package rules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Key transforms a rule can apply to identity values before they become
+// part of the limiter key. They run in the order listed.
+const (
+	// TransformLowercase folds case, e.g. for case-insensitive API keys.
+	TransformLowercase = "lowercase"
+	// TransformTrim removes surrounding whitespace and a "Bearer " prefix.
+	TransformTrim = "trim"
+	// TransformIPv4Prefix ("ipv4_prefix:24") collapses IPv4 addresses to
+	// their network so a client cannot rotate through a range.
+	TransformIPv4Prefix = "ipv4_prefix"
+	// TransformIPv6Prefix ("ipv6_prefix:64") does the same for IPv6.
+	TransformIPv6Prefix = "ipv6_prefix"
+	// TransformSHA256 replaces the value with a digest of it, so secrets
+	// such as session IDs are not stored in limiter keys or analytics.
+	TransformSHA256 = "sha256"
+)
+
+// keyTransform is a parsed transform spec.
+type keyTransform struct {
+	name string
+	bits int
+}
+
+func parseKeyTransform(spec string) (keyTransform, error) {
+	name, arg, hasArg := strings.Cut(strings.TrimSpace(spec), ":")
+	switch name {
+	case TransformLowercase, TransformTrim, TransformSHA256:
+		if hasArg {
+			return keyTransform{}, fmt.Errorf("key transform %q takes no argument", name)
+		}
+		return keyTransform{name: name}, nil
+	case TransformIPv4Prefix, TransformIPv6Prefix:
+		max := 32
+		if name == TransformIPv6Prefix {
+			max = 128
+		}
+		bits, err := strconv.Atoi(arg)
+		if err != nil || bits < 1 || bits > max {
+			return keyTransform{}, fmt.Errorf("key transform %s needs a prefix length between 1 and %d", name, max)
+		}
+		return keyTransform{name: name, bits: bits}, nil
+	default:
+		return keyTransform{}, fmt.Errorf("unsupported key transform %q", spec)
+	}
+}
+
+func (t keyTransform) apply(v string) string {
+	switch t.name {
+	case TransformLowercase:
+		return strings.ToLower(v)
+	case TransformTrim:
+		v = strings.TrimSpace(v)
+		if len(v) > 7 && strings.EqualFold(v[:7], "bearer ") {
+			v = strings.TrimSpace(v[7:])
+		}
+		return v
+	case TransformSHA256:
+		if v == "" {
+			return v
+		}
+		sum := sha256.Sum256([]byte(v))
+		return hex.EncodeToString(sum[:16])
+	case TransformIPv4Prefix, TransformIPv6Prefix:
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			return v
+		}
+		addr = addr.Unmap()
+		if addr.Is4() != (t.name == TransformIPv4Prefix) {
+			return v
+		}
+		prefix, err := addr.Prefix(t.bits)
+		if err != nil {
+			return v
+		}
+		return prefix.String()
+	}
+	return v
+}
+
+// NormalizeIdentity applies the rule's key transforms to an identity value.
+// Values a transform does not apply to, such as a non-IP header value for
+// an IP prefix transform, pass through unchanged.
+func (r Rule) NormalizeIdentity(v string) string {
+	for _, spec := range r.KeyTransforms {
+		t, err := parseKeyTransform(spec)
+		if err != nil {
+			continue
+		}
+		v = t.apply(v)
+	}
+	return v
+}
@@ -0,0 +1,40 @@
+package rules
+
+import "testing"
+
+func TestNormalizeIdentity(t *testing.T) {
+	tests := []struct {
+		transforms []string
+		in, want   string
+	}{
+		{[]string{"lowercase"}, "AbC-123", "abc-123"},
+		{[]string{"trim", "lowercase"}, "  Bearer KEY1 ", "key1"},
+		{[]string{"ipv4_prefix:24"}, "203.0.113.77", "203.0.113.0/24"},
+		{[]string{"ipv4_prefix:24"}, "::ffff:203.0.113.77", "203.0.113.0/24"},
+		{[]string{"ipv4_prefix:24"}, "2001:db8::1", "2001:db8::1"},
+		{[]string{"ipv6_prefix:64"}, "2001:db8:0:0:abcd::1", "2001:db8::/64"},
+		{[]string{"ipv6_prefix:64"}, "not-an-ip", "not-an-ip"},
+		{[]string{"sha256"}, "session-1", "84097828fc31a8c8d29210df48901a85"},
+		{[]string{"sha256"}, "", ""},
+		{nil, "Unchanged", "Unchanged"},
+	}
+	for _, tt := range tests {
+		r := Rule{KeyTransforms: tt.transforms}
+		if got := r.NormalizeIdentity(tt.in); got != tt.want {
+			t.Errorf("%v(%q) = %q, want %q", tt.transforms, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseKeyTransform(t *testing.T) {
+	for _, spec := range []string{"lowercase", "trim", "ipv4_prefix:8", "ipv6_prefix:128", "sha256"} {
+		if _, err := parseKeyTransform(spec); err != nil {
+			t.Errorf("parseKeyTransform(%q) error = %v", spec, err)
+		}
+	}
+	for _, spec := range []string{"uppercase", "lowercase:1", "ipv4_prefix", "ipv4_prefix:33", "ipv6_prefix:0", "sha256:8"} {
+		if _, err := parseKeyTransform(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package rules
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Match is a rule selected for a request along with the path parameters
+// captured by its pattern.
+type Match struct {
+	Rule   Rule
+	Params map[string]string
+	// Route is the request path with captured parameters templated back
+	// to their names, e.g. /users/:id for /users/42, so events can be
+	// grouped by route without one entry per ID.
+	Route string
+}
+
+// Matcher selects the highest priority enabled rule for a request. A
+// Matcher is immutable once built and safe for concurrent use.
+//
+// Patterns are matched segment by segment: ":name" captures exactly one
+// segment and a trailing "*" matches any remainder, including nothing.
+// Rules with a schedule are skipped outside it.
+type Matcher struct {
+	entries []compiledRule
+	now     func() time.Time
+}
+
+type compiledRule struct {
+	rule Rule
+	// loc is the time zone of the rule's schedule; nil without one.
+	loc      *time.Location
+	segments []string
+	wildcard bool
+	methods  map[string]bool
+}
+
+// NewMatcher compiles the enabled rules in list into a Matcher.
+func NewMatcher(list []Rule) *Matcher {
+	sorted := make([]Rule, 0, len(list))
+	for _, r := range list {
+		if r.Enabled {
+			sorted = append(sorted, r)
+		}
+	}
+	SortByPriority(sorted)
+
+	m := &Matcher{entries: make([]compiledRule, 0, len(sorted)), now: time.Now}
+	for _, r := range sorted {
+		segments := splitPath(r.Pattern)
+		c := compiledRule{rule: r}
+		if r.Schedule != nil {
+			// Rules are validated before they are stored, so the zone
+			// loads; should it not, the rule never applies.
+			loc, err := r.Schedule.location()
+			if err != nil {
+				continue
+			}
+			c.loc = loc
+		}
+		if n := len(segments); n > 0 && segments[n-1] == "*" {
+			c.wildcard = true
+			segments = segments[:n-1]
+		}
+		c.segments = segments
+		if len(r.Methods) > 0 {
+			c.methods = make(map[string]bool, len(r.Methods))
+			for _, method := range r.Methods {
+				c.methods[method] = true
+			}
+		}
+		m.entries = append(m.entries, c)
+	}
+	return m
+}
+
+// Match returns the first rule, in priority order, whose method list and
+// pattern accept the request, ignoring the rules' agent families.
+func (m *Matcher) Match(method, path string) (Match, bool) {
+	return m.MatchAgent(method, path, "")
+}
+
+// MatchAgent is like Match for a request from the user agent family,
+// skipping rules that do not apply to it.
+func (m *Matcher) MatchAgent(method, path, family string) (Match, bool) {
+	var first Match
+	found := false
+	m.each(method, path, family, func(match Match) bool {
+		first, found = match, true
+		return false
+	})
+	return first, found
+}
+
+// MatchAll returns every rule accepting the request from the user agent
+// family, in priority order. The first is the one MatchAgent selects; the
+// rest are outranked by it.
+func (m *Matcher) MatchAll(method, path, family string) []Match {
+	var out []Match
+	m.each(method, path, family, func(match Match) bool {
+		out = append(out, match)
+		return true
+	})
+	return out
+}
+
+// each calls fn with the rules accepting the request, in priority order,
+// until it returns false.
+func (m *Matcher) each(method, path, family string, fn func(Match) bool) {
+	if m == nil {
+		return
+	}
+
+	parts := splitPath(path)
+	now := m.now()
+	for _, c := range m.entries {
+		if c.methods != nil && !c.methods[method] {
+			continue
+		}
+		if c.loc != nil && !c.rule.Schedule.activeIn(now, c.loc) {
+			continue
+		}
+		if family != "" && !c.rule.MatchesAgent(family) {
+			continue
+		}
+		if params, ok := c.match(parts); ok {
+			if !fn(Match{Rule: c.rule, Params: params, Route: c.route(parts)}) {
+				return
+			}
+		}
+	}
+}
+
+// Rule returns the enabled rule with the given ID.
+func (m *Matcher) Rule(id string) (Rule, bool) {
+	if m == nil {
+		return Rule{}, false
+	}
+	for _, c := range m.entries {
+		if c.rule.ID == id {
+			return c.rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Len returns the number of rules the matcher evaluates.
+func (m *Matcher) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.entries)
+}
+
+func (c compiledRule) match(parts []string) (map[string]string, bool) {
+	if len(parts) < len(c.segments) || (!c.wildcard && len(parts) != len(c.segments)) {
+		return nil, false
+	}
+
+	var params map[string]string
+	for i, seg := range c.segments {
+		if name, ok := strings.CutPrefix(seg, ":"); ok {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[name] = parts[i]
+			continue
+		}
+		if seg != parts[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// route rebuilds the path from parts, replacing parameter segments with
+// their pattern names. Segments matched by a trailing "*" are kept.
+func (c compiledRule) route(parts []string) string {
+	var sb strings.Builder
+	for i, part := range parts {
+		sb.WriteByte('/')
+		if i < len(c.segments) && strings.HasPrefix(c.segments[i], ":") {
+			sb.WriteString(c.segments[i])
+			continue
+		}
+		sb.WriteString(part)
+	}
+	if sb.Len() == 0 {
+		return "/"
+	}
+	return sb.String()
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// ValidatePattern checks pattern syntax: it must be absolute, "*" may only
+// appear as the final segment, and parameters must be named.
+func ValidatePattern(pattern string) error {
+	if !strings.HasPrefix(pattern, "/") {
+		return errors.New("pattern must start with /")
+	}
+
+	segments := splitPath(pattern)
+	for i, seg := range segments {
+		switch {
+		case seg == "":
+			return errors.New("pattern must not contain empty segments")
+		case seg == "*" && i != len(segments)-1:
+			return errors.New("* is only allowed as the last pattern segment")
+		case seg == ":":
+			return errors.New("pattern parameters must be named")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package rules
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatcherMatch(t *testing.T) {
+	m := NewMatcher([]Rule{
+		{ID: "users", Pattern: "/api/users/:id", Priority: 10, Enabled: true},
+		{ID: "api", Pattern: "/api/*", Priority: 1, Enabled: true},
+		{ID: "login", Pattern: "/login", Methods: []string{"POST"}, Priority: 5, Enabled: true},
+		{ID: "off", Pattern: "/off", Priority: 100, Enabled: false},
+	})
+
+	tests := []struct {
+		method, path string
+		wantID       string
+		wantMatch    bool
+	}{
+		{"GET", "/api/users/42", "users", true},
+		{"GET", "/api/users/42/", "users", true},
+		{"GET", "/api/users/42/posts", "api", true},
+		{"GET", "/api", "api", true},
+		{"POST", "/login", "login", true},
+		{"GET", "/login", "", false},
+		{"GET", "/off", "", false},
+		{"GET", "/", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := m.Match(tt.method, tt.path)
+		if ok != tt.wantMatch {
+			t.Errorf("Match(%s %s) matched = %v, want %v", tt.method, tt.path, ok, tt.wantMatch)
+			continue
+		}
+		if ok && got.Rule.ID != tt.wantID {
+			t.Errorf("Match(%s %s) = %s, want %s", tt.method, tt.path, got.Rule.ID, tt.wantID)
+		}
+	}
+
+	if m.Len() != 3 {
+		t.Errorf("Expected 3 compiled rules, got %d", m.Len())
+	}
+}
+
+func TestMatcherMatchAll(t *testing.T) {
+	m := NewMatcher([]Rule{
+		{ID: "api", Pattern: "/api/*", Priority: 1, Enabled: true},
+		{ID: "users", Pattern: "/api/users/:id", Priority: 10, Enabled: true},
+		{ID: "posts", Pattern: "/api/posts/:id", Priority: 20, Enabled: true},
+	})
+
+	got := m.MatchAll("GET", "/api/users/42", "")
+	if len(got) != 2 || got[0].Rule.ID != "users" || got[1].Rule.ID != "api" {
+		t.Fatalf("MatchAll() = %+v, want users then api", got)
+	}
+	if got[0].Params["id"] != "42" {
+		t.Errorf("Expected params of the winning rule, got %v", got[0].Params)
+	}
+	if first, _ := m.Match("GET", "/api/users/42"); first.Rule.ID != got[0].Rule.ID {
+		t.Errorf("Match() = %s, want the first of MatchAll", first.Rule.ID)
+	}
+	if got := m.MatchAll("GET", "/other", ""); len(got) != 0 {
+		t.Errorf("MatchAll() = %+v, want none", got)
+	}
+}
+
+func TestMatcherParams(t *testing.T) {
+	m := NewMatcher([]Rule{
+		{ID: "repo", Pattern: "/orgs/:org/repos/:repo", Enabled: true},
+	})
+
+	got, ok := m.Match("GET", "/orgs/acme/repos/gatify")
+	if !ok {
+		t.Fatal("Expected match")
+	}
+	if got.Params["org"] != "acme" || got.Params["repo"] != "gatify" {
+		t.Errorf("Unexpected params %v", got.Params)
+	}
+	if got.Route != "/orgs/:org/repos/:repo" {
+		t.Errorf("Route = %q, want parameters templated away", got.Route)
+	}
+}
+
+func TestMatcherRouteKeepsWildcardSegments(t *testing.T) {
+	m := NewMatcher([]Rule{{ID: "users", Pattern: "/users/:id/*", Enabled: true}})
+
+	got, _ := m.Match("GET", "/users/42/orders")
+	if got.Route != "/users/:id/orders" {
+		t.Errorf("Route = %q, want /users/:id/orders", got.Route)
+	}
+}
+
+func TestMatcherAgentFamilies(t *testing.T) {
+	m := NewMatcher([]Rule{
+		{ID: "crawlers", Pattern: "/*", Priority: 2, Agents: []string{"bot"}, Enabled: true},
+		{ID: "people", Pattern: "/*", Priority: 1, ExemptAgents: []string{"bot", "tool"}, Enabled: true},
+	})
+
+	for family, want := range map[string]string{"bot": "crawlers", "browser": "people", "mobile": "people", "tool": ""} {
+		got, ok := m.MatchAgent("GET", "/search", family)
+		if got.Rule.ID != want || ok != (want != "") {
+			t.Errorf("MatchAgent(%s) = %q, %v; want %q", family, got.Rule.ID, ok, want)
+		}
+	}
+	if got, _ := m.Match("GET", "/search"); got.Rule.ID != "crawlers" {
+		t.Errorf("Expected Match to ignore agent families, got %q", got.Rule.ID)
+	}
+}
+
+func TestMatcherSchedules(t *testing.T) {
+	m := NewMatcher([]Rule{
+		{ID: "office", Pattern: "/*", Priority: 2, Enabled: true,
+			Schedule: &Schedule{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"}},
+		{ID: "always", Pattern: "/*", Priority: 1, Enabled: true},
+	})
+
+	for at, want := range map[string]string{
+		"2026-03-02T10:00:00Z": "office", // a Monday
+		"2026-03-02T18:00:00Z": "always",
+		"2026-03-07T10:00:00Z": "always", // a Saturday
+	} {
+		now, _ := time.Parse(time.RFC3339, at)
+		m.now = func() time.Time { return now }
+		if got, _ := m.Match("GET", "/search"); got.Rule.ID != want {
+			t.Errorf("Match at %s = %q, want %q", at, got.Rule.ID, want)
+		}
+	}
+}
+
+func TestNilMatcher(t *testing.T) {
+	var m *Matcher
+	if _, ok := m.Match("GET", "/"); ok {
+		t.Error("Expected nil matcher to match nothing")
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	valid := []string{"/", "/api", "/api/:id", "/static/*", "/*"}
+	for _, p := range valid {
+		if err := ValidatePattern(p); err != nil {
+			t.Errorf("ValidatePattern(%q) error = %v", p, err)
+		}
+	}
+
+	invalid := []string{"api", "/api//x", "/*/x", "/users/:"}
+	for _, p := range invalid {
+		if err := ValidatePattern(p); err == nil {
+			t.Errorf("ValidatePattern(%q) expected error", p)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package rules
+
+import (
+	"errors"
+	"math"
+)
+
+// Progressive tier defaults, as fractions of the rule's limit.
+const (
+	DefaultDelayAbove  = 0.8
+	DefaultTarpitAbove = 1.5
+	// maxProgressiveDelayMS bounds delays so held requests stay within the
+	// server's write timeout.
+	maxProgressiveDelayMS = 10000
+)
+
+// Progressive degrades service gradually instead of cutting clients off
+// at the limit: past DelayAbove of the limit requests are slowed down,
+// past the limit they get 429, and past TarpitAbove the 429 is itself
+// held back for TarpitMS.
+type Progressive struct {
+	DelayAbove  float64 `json:"delay_above"`
+	DelayMS     int64   `json:"delay_ms"`
+	TarpitAbove float64 `json:"tarpit_above"`
+	TarpitMS    int64   `json:"tarpit_ms"`
+}
+
+// CountingLimit is the limit the limiter must enforce so that usage
+// between the rule's limit and the tarpit threshold is still counted.
+func (p *Progressive) CountingLimit(limit int64) int64 {
+	if p == nil || p.TarpitMS <= 0 {
+		return limit
+	}
+	return int64(math.Ceil(float64(limit) * p.TarpitAbove))
+}
+
+func (p *Progressive) validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.DelayMS < 0 || p.DelayMS > maxProgressiveDelayMS || p.TarpitMS < 0 || p.TarpitMS > maxProgressiveDelayMS {
+		return errors.New("progressive delay_ms and tarpit_ms must be between 0 and 10000")
+	}
+	if p.DelayAbove <= 0 || p.DelayAbove >= 1 {
+		return errors.New("progressive delay_above must be between 0 and 1")
+	}
+	if p.TarpitAbove <= 1 {
+		return errors.New("progressive tarpit_above must be greater than 1")
+	}
+	return nil
+}
+
+func (p *Progressive) normalize() {
+	if p == nil {
+		return
+	}
+	if p.DelayAbove == 0 {
+		p.DelayAbove = DefaultDelayAbove
+	}
+	if p.TarpitAbove == 0 {
+		p.TarpitAbove = DefaultTarpitAbove
+	}
+}
@@ -0,0 +1,142 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// DefaultRejectionContentType is used when a rejection body does not name
+// its content type.
+const DefaultRejectionContentType = "application/json"
+
+// maxRejectionBody bounds the size of a rejection body template.
+const maxRejectionBody = 64 << 10
+
+// maxRejectionAlternatives bounds the content types a rejection offers.
+const maxRejectionAlternatives = 8
+
+// MaxRejectionMaxAge bounds how many seconds a rule lets CDNs cache its
+// 429 responses; longer would outlast most windows.
+const MaxRejectionMaxAge = 60
+
+// cacheableIdentity reports whether every part of the rule's identity is
+// read from a request header, so that shared caches keeping its 429s can
+// tell clients apart with Vary. They cannot see IP or country identities.
+func (r Rule) cacheableIdentity() bool {
+	switch r.IdentifyBy {
+	case IdentifyByHeader, IdentifyByCookie, IdentifyByJWTClaim:
+		return true
+	}
+	if !r.Composite() {
+		return false
+	}
+	parts, err := r.IdentityParts()
+	if err != nil {
+		return false
+	}
+	for _, part := range parts {
+		if part.Source == IdentifyByIP || part.Source == IdentifyByCountry {
+			return false
+		}
+	}
+	return true
+}
+
+// Rejection replaces the gateway's default 429 body for a rule, for
+// example with a branded error page. Body is a Go template; HTML bodies
+// are rendered with html/template so values are escaped.
+type Rejection struct {
+	ContentType string `json:"content_type"`
+	Body        string `json:"body"`
+	// Alternatives are the same rejection in other content types, sent
+	// instead when the client's Accept header prefers one of them. They
+	// cannot have alternatives of their own.
+	Alternatives []Rejection `json:"alternatives,omitempty"`
+}
+
+// RejectionData is what a rejection body template is rendered with.
+type RejectionData struct {
+	// Rule is the name of the rule that rejected the request.
+	Rule  string
+	Limit int64
+	// RetryAfter is the number of seconds the client should wait.
+	RetryAfter int64
+	ResetAt    time.Time
+}
+
+// RejectionTemplate renders a rejection body.
+type RejectionTemplate interface {
+	Execute(w io.Writer, data any) error
+}
+
+// Template parses the body template.
+func (r *Rejection) Template() (RejectionTemplate, error) {
+	if r.isHTML() {
+		return htmltemplate.New("rejection").Parse(r.Body)
+	}
+	return texttemplate.New("rejection").Parse(r.Body)
+}
+
+func (r *Rejection) isHTML() bool {
+	return r.mediaType() == "text/html"
+}
+
+func (r *Rejection) validate() error {
+	if r == nil {
+		return nil
+	}
+	if strings.TrimSpace(r.Body) == "" {
+		return errors.New("rejection.body is required")
+	}
+	if len(r.Body) > maxRejectionBody {
+		return fmt.Errorf("rejection.body must not exceed %d bytes", maxRejectionBody)
+	}
+	if _, _, err := mime.ParseMediaType(r.ContentType); err != nil {
+		return fmt.Errorf("invalid rejection.content_type %q", r.ContentType)
+	}
+	if _, err := r.Template(); err != nil {
+		return fmt.Errorf("invalid rejection.body template: %w", err)
+	}
+	if len(r.Alternatives) > maxRejectionAlternatives {
+		return fmt.Errorf("rejection.alternatives must not exceed %d entries", maxRejectionAlternatives)
+	}
+	seen := map[string]bool{r.mediaType(): true}
+	for i := range r.Alternatives {
+		alt := &r.Alternatives[i]
+		if len(alt.Alternatives) > 0 {
+			return errors.New("rejection.alternatives cannot be nested")
+		}
+		if err := alt.validate(); err != nil {
+			return fmt.Errorf("rejection.alternatives[%d]: %w", i, err)
+		}
+		if seen[alt.mediaType()] {
+			return fmt.Errorf("rejection.alternatives[%d]: content type %s is already covered", i, alt.mediaType())
+		}
+		seen[alt.mediaType()] = true
+	}
+	return nil
+}
+
+func (r *Rejection) mediaType() string {
+	mediaType, _, _ := mime.ParseMediaType(r.ContentType)
+	return mediaType
+}
+
+func (r *Rejection) normalize() {
+	if r == nil {
+		return
+	}
+	r.ContentType = strings.TrimSpace(r.ContentType)
+	if r.ContentType == "" {
+		r.ContentType = DefaultRejectionContentType
+	}
+	for i := range r.Alternatives {
+		r.Alternatives[i].normalize()
+	}
+}
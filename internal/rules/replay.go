@@ -0,0 +1,48 @@
+package rules
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// DefaultReplayTTLSeconds is how long nonces are remembered when a rule's
+// replay protection does not say.
+const DefaultReplayTTLSeconds = 300
+
+// ReplayProtection rejects requests that reuse a nonce, as webhook
+// receivers need when an attacker can capture and resend deliveries.
+type ReplayProtection struct {
+	// NonceHeader carries a value the sender never reuses.
+	NonceHeader string `json:"nonce_header"`
+	// TimestampHeader, when set, carries the send time in Unix seconds.
+	// Requests further than TTLSeconds from now are rejected, which keeps
+	// a nonce from being replayed once it has been forgotten.
+	TimestampHeader string `json:"timestamp_header,omitempty"`
+	// TTLSeconds is how long nonces are remembered.
+	TTLSeconds int64 `json:"ttl_seconds"`
+}
+
+func (p *ReplayProtection) validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.NonceHeader == "" {
+		return errors.New("replay.nonce_header is required")
+	}
+	if p.TTLSeconds <= 0 {
+		return errors.New("replay.ttl_seconds must be positive")
+	}
+	return nil
+}
+
+func (p *ReplayProtection) normalize() {
+	if p == nil {
+		return
+	}
+	p.NonceHeader = http.CanonicalHeaderKey(strings.TrimSpace(p.NonceHeader))
+	p.TimestampHeader = http.CanonicalHeaderKey(strings.TrimSpace(p.TimestampHeader))
+	if p.TTLSeconds == 0 {
+		p.TTLSeconds = DefaultReplayTTLSeconds
+	}
+}
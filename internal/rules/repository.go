@@ -0,0 +1,325 @@
+package rules
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when a rule does not exist.
+var ErrNotFound = errors.New("rule not found")
+
+// ErrRevisionNotFound is returned when a rule has no such revision.
+var ErrRevisionNotFound = errors.New("rule revision not found")
+
+// ErrRevisionConflict is returned when an update expected a revision other
+// than the rule's current one.
+var ErrRevisionConflict = errors.New("rule was modified by another update")
+
+// maxRevisions bounds the history kept per rule; the oldest revisions are
+// dropped first.
+const maxRevisions = 100
+
+// Revision actions recorded in a rule's history.
+const (
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionRollback = "rollback"
+)
+
+// Revision is a stored version of a rule.
+type Revision struct {
+	Revision  int64     `json:"revision"`
+	Action    string    `json:"action"`
+	Rule      Rule      `json:"rule"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Repository persists rules.
+type Repository interface {
+	List(ctx context.Context) ([]Rule, error)
+	Get(ctx context.Context, id string) (Rule, error)
+	Create(ctx context.Context, rule Rule) (Rule, error)
+	// Update replaces a rule. When rule.Revision is non-zero it must match
+	// the stored revision, or Update fails with ErrRevisionConflict.
+	Update(ctx context.Context, rule Rule) (Rule, error)
+	Delete(ctx context.Context, id string) error
+	// Revisions returns a rule's history, newest first.
+	Revisions(ctx context.Context, id string) ([]Revision, error)
+	// Rollback restores the content of an earlier revision as a new
+	// revision, so the rollback itself can be undone.
+	Rollback(ctx context.Context, id string, revision int64) (Rule, error)
+}
+
+// InMemoryRepository is a Repository backed by a map. It is safe for
+// concurrent use and is the default store when no database is configured.
+type InMemoryRepository struct {
+	mu      sync.RWMutex
+	rules   map[string]Rule
+	history map[string][]Revision
+	// changes counts mutations so snapshots are only written when there
+	// is something new to save.
+	changes uint64
+	now     func() time.Time
+}
+
+// NewInMemoryRepository creates an empty in-memory repository.
+func NewInMemoryRepository() *InMemoryRepository {
+	return &InMemoryRepository{
+		rules:   make(map[string]Rule),
+		history: make(map[string][]Revision),
+		now:     time.Now,
+	}
+}
+
+// List returns all rules ordered by descending priority, then by ID.
+func (r *InMemoryRepository) List(_ context.Context) ([]Rule, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]Rule, 0, len(r.rules))
+	for _, rule := range r.rules {
+		out = append(out, cloneRule(rule))
+	}
+	SortByPriority(out)
+	return out, nil
+}
+
+// Get returns the rule with the given ID.
+func (r *InMemoryRepository) Get(_ context.Context, id string) (Rule, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rule, ok := r.rules[id]
+	if !ok {
+		return Rule{}, ErrNotFound
+	}
+	return cloneRule(rule), nil
+}
+
+// Create stores a new rule, assigning it an ID and timestamps.
+func (r *InMemoryRepository) Create(_ context.Context, rule Rule) (Rule, error) {
+	id, err := newID()
+	if err != nil {
+		return Rule{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now().UTC()
+	rule.ID = id
+	rule.Revision = 1
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+	r.store(rule, ActionCreate)
+	return rule, nil
+}
+
+// Update replaces an existing rule, preserving its creation time.
+func (r *InMemoryRepository) Update(_ context.Context, rule Rule) (Rule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.rules[rule.ID]
+	if !ok {
+		return Rule{}, ErrNotFound
+	}
+	if rule.Revision != 0 && rule.Revision != existing.Revision {
+		return Rule{}, ErrRevisionConflict
+	}
+
+	rule.CreatedAt = existing.CreatedAt
+	rule.UpdatedAt = r.now().UTC()
+	rule.Revision = existing.Revision + 1
+	r.store(rule, ActionUpdate)
+	return rule, nil
+}
+
+// Delete removes the rule with the given ID.
+func (r *InMemoryRepository) Delete(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.rules[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.rules, id)
+	delete(r.history, id)
+	r.changes++
+	return nil
+}
+
+// Revisions returns the rule's stored revisions, newest first.
+func (r *InMemoryRepository) Revisions(_ context.Context, id string) ([]Revision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	history, ok := r.history[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	out := make([]Revision, len(history))
+	for i, rev := range history {
+		rev.Rule = cloneRule(rev.Rule)
+		out[len(history)-1-i] = rev
+	}
+	return out, nil
+}
+
+// Rollback restores the given revision's content as a new revision.
+func (r *InMemoryRepository) Rollback(_ context.Context, id string, revision int64) (Rule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.rules[id]
+	if !ok {
+		return Rule{}, ErrNotFound
+	}
+	var target *Revision
+	for i := range r.history[id] {
+		if r.history[id][i].Revision == revision {
+			target = &r.history[id][i]
+			break
+		}
+	}
+	if target == nil {
+		return Rule{}, ErrRevisionNotFound
+	}
+
+	rule := cloneRule(target.Rule)
+	rule.CreatedAt = existing.CreatedAt
+	rule.UpdatedAt = r.now().UTC()
+	rule.Revision = existing.Revision + 1
+	r.store(rule, ActionRollback)
+	return rule, nil
+}
+
+// Replace makes the repository hold exactly list, keeping each rule's ID,
+// revision and timestamps, as a standby mirroring its primary does. Rules
+// at a revision not seen before are added to their history. It reports
+// whether anything changed.
+func (r *InMemoryRepository) Replace(list []Rule) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keep := make(map[string]bool, len(list))
+	changed := false
+	for _, rule := range list {
+		keep[rule.ID] = true
+		if existing, ok := r.rules[rule.ID]; ok && existing.Revision == rule.Revision {
+			continue
+		}
+		action := ActionUpdate
+		if rule.Revision <= 1 {
+			action = ActionCreate
+		}
+		r.store(rule, action)
+		changed = true
+	}
+	for id := range r.rules {
+		if !keep[id] {
+			delete(r.rules, id)
+			delete(r.history, id)
+			r.changes++
+			changed = true
+		}
+	}
+	return changed
+}
+
+// store saves rule as the current version and appends it to the history.
+// The caller must hold the write lock.
+func (r *InMemoryRepository) store(rule Rule, action string) {
+	r.rules[rule.ID] = cloneRule(rule)
+	history := append(r.history[rule.ID], Revision{
+		Revision:  rule.Revision,
+		Action:    action,
+		Rule:      cloneRule(rule),
+		CreatedAt: rule.UpdatedAt,
+	})
+	if len(history) > maxRevisions {
+		history = history[len(history)-maxRevisions:]
+	}
+	r.history[rule.ID] = history
+	r.changes++
+}
+
+// SortByPriority orders rules by descending priority with ID as a stable
+// tie-breaker, which is the order the matcher evaluates them in.
+func SortByPriority(rules []Rule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority > rules[j].Priority
+		}
+		return rules[i].ID < rules[j].ID
+	})
+}
+
+func cloneRule(rule Rule) Rule {
+	if rule.Methods != nil {
+		rule.Methods = append([]string(nil), rule.Methods...)
+	}
+	if rule.HeaderNames != nil {
+		rule.HeaderNames = append([]string(nil), rule.HeaderNames...)
+	}
+	if rule.KeyTransforms != nil {
+		rule.KeyTransforms = append([]string(nil), rule.KeyTransforms...)
+	}
+	rule.AllowCountries = slices.Clone(rule.AllowCountries)
+	rule.DenyCountries = slices.Clone(rule.DenyCountries)
+	rule.Agents = slices.Clone(rule.Agents)
+	rule.ExemptAgents = slices.Clone(rule.ExemptAgents)
+	rule.CaptureHeaders = slices.Clone(rule.CaptureHeaders)
+	if rule.CacheHeaders != nil {
+		headers := make(map[string]string, len(rule.CacheHeaders))
+		for k, v := range rule.CacheHeaders {
+			headers[k] = v
+		}
+		rule.CacheHeaders = headers
+	}
+	rule.Headers = rule.Headers.clone()
+	if rule.Replay != nil {
+		replay := *rule.Replay
+		rule.Replay = &replay
+	}
+	if rule.Progressive != nil {
+		progressive := *rule.Progressive
+		rule.Progressive = &progressive
+	}
+	if rule.Rejection != nil {
+		rejection := *rule.Rejection
+		rejection.Alternatives = append([]Rejection(nil), rejection.Alternatives...)
+		rule.Rejection = &rejection
+	}
+	if rule.Hedge != nil {
+		hedge := *rule.Hedge
+		rule.Hedge = &hedge
+	}
+	if rule.WebSocket != nil {
+		ws := *rule.WebSocket
+		rule.WebSocket = &ws
+	}
+	if rule.Honeypot != nil {
+		honeypot := *rule.Honeypot
+		rule.Honeypot = &honeypot
+	}
+	if rule.Action != nil {
+		action := *rule.Action
+		rule.Action = &action
+	}
+	return rule
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
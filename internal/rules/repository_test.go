@@ -0,0 +1,201 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func validRule() Rule {
+	return Rule{
+		Name:          "users",
+		Pattern:       "/api/users/*",
+		Limit:         10,
+		WindowSeconds: 60,
+		IdentifyBy:    IdentifyByIP,
+		Enabled:       true,
+	}
+}
+
+func TestInMemoryRepositoryCRUD(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryRepository()
+
+	created, err := repo.Create(ctx, validRule())
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if created.ID == "" {
+		t.Fatal("Expected Create to assign an ID")
+	}
+	if created.CreatedAt.IsZero() || !created.CreatedAt.Equal(created.UpdatedAt) {
+		t.Errorf("Expected matching timestamps, got %v / %v", created.CreatedAt, created.UpdatedAt)
+	}
+
+	got, err := repo.Get(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Name != "users" {
+		t.Errorf("Expected name users, got %s", got.Name)
+	}
+
+	got.Limit = 20
+	updated, err := repo.Update(ctx, got)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if updated.Limit != 20 {
+		t.Errorf("Expected limit 20, got %d", updated.Limit)
+	}
+	if !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Error("Expected Update to preserve CreatedAt")
+	}
+
+	if err := repo.Delete(ctx, created.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := repo.Get(ctx, created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestInMemoryRepositoryNotFound(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryRepository()
+
+	if _, err := repo.Update(ctx, Rule{ID: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from Update, got %v", err)
+	}
+	if err := repo.Delete(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from Delete, got %v", err)
+	}
+}
+
+func TestInMemoryRepositoryListOrder(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryRepository()
+
+	for _, p := range []int{1, 10, 5} {
+		r := validRule()
+		r.Priority = p
+		if _, err := repo.Create(ctx, r); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	list, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("Expected 3 rules, got %d", len(list))
+	}
+	if list[0].Priority != 10 || list[1].Priority != 5 || list[2].Priority != 1 {
+		t.Errorf("Expected descending priority, got %d, %d, %d", list[0].Priority, list[1].Priority, list[2].Priority)
+	}
+}
+
+func TestInMemoryRepositoryRevisions(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryRepository()
+
+	created, _ := repo.Create(ctx, validRule())
+	if created.Revision != 1 {
+		t.Fatalf("Expected revision 1, got %d", created.Revision)
+	}
+	created.Limit = 99
+	if _, err := repo.Update(ctx, created); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	rolled, err := repo.Rollback(ctx, created.ID, 1)
+	if err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if rolled.Limit != 10 || rolled.Revision != 3 || !rolled.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("Unexpected rolled back rule %+v", rolled)
+	}
+
+	revs, _ := repo.Revisions(ctx, created.ID)
+	actions := []string{ActionRollback, ActionUpdate, ActionCreate}
+	if len(revs) != len(actions) {
+		t.Fatalf("Expected %d revisions, got %d", len(actions), len(revs))
+	}
+	for i, a := range actions {
+		if revs[i].Action != a {
+			t.Errorf("Revision %d action = %s, want %s", revs[i].Revision, revs[i].Action, a)
+		}
+	}
+
+	if _, err := repo.Rollback(ctx, created.ID, 42); !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("Expected ErrRevisionNotFound, got %v", err)
+	}
+	_ = repo.Delete(ctx, created.ID)
+	if _, err := repo.Revisions(ctx, created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected history removed with the rule, got %v", err)
+	}
+}
+
+func TestInMemoryRepositoryRevisionCap(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryRepository()
+	rule, _ := repo.Create(ctx, validRule())
+	for i := 0; i < maxRevisions+5; i++ {
+		rule, _ = repo.Update(ctx, rule)
+	}
+
+	revs, _ := repo.Revisions(ctx, rule.ID)
+	if len(revs) != maxRevisions || revs[0].Revision != rule.Revision {
+		t.Errorf("Expected %d newest revisions, got %d starting at %d", maxRevisions, len(revs), revs[0].Revision)
+	}
+}
+
+func TestInMemoryRepositoryUpdateConflict(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryRepository()
+	created, _ := repo.Create(ctx, validRule())
+
+	first, second := created, created
+	first.Limit = 20
+	if _, err := repo.Update(ctx, first); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	second.Limit = 30
+	if _, err := repo.Update(ctx, second); !errors.Is(err, ErrRevisionConflict) {
+		t.Errorf("Expected ErrRevisionConflict for a stale revision, got %v", err)
+	}
+
+	second.Revision = 0
+	if updated, err := repo.Update(ctx, second); err != nil || updated.Limit != 30 {
+		t.Errorf("Expected unconditional update without a revision, got %+v, %v", updated, err)
+	}
+}
+
+func TestInMemoryRepositoryReplace(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryRepository()
+	stale, _ := repo.Create(ctx, validRule())
+
+	mirrored := validRule()
+	mirrored.ID, mirrored.Revision = "primary-1", 3
+	if !repo.Replace([]Rule{mirrored}) {
+		t.Fatal("Expected Replace to report a change")
+	}
+	if _, err := repo.Get(ctx, stale.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected rules missing from the list to be removed, got %v", err)
+	}
+	got, err := repo.Get(ctx, "primary-1")
+	if err != nil || got.Revision != 3 {
+		t.Fatalf("Expected the rule to keep its ID and revision, got %+v, %v", got, err)
+	}
+	if repo.Replace([]Rule{mirrored}) {
+		t.Error("Expected replacing with the same revisions to change nothing")
+	}
+
+	mirrored.Revision, mirrored.Limit = 4, 50
+	repo.Replace([]Rule{mirrored})
+	if revs, _ := repo.Revisions(ctx, "primary-1"); len(revs) != 2 || revs[0].Rule.Limit != 50 {
+		t.Errorf("Expected the new revision in the history, got %+v", revs)
+	}
+}
@@ -0,0 +1,477 @@
+// Package rules provides rate limit rule definitions and persistence
+package rules
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/limiter"
+	"github.com/Siruyy/gatify/internal/quota"
+	"github.com/Siruyy/gatify/internal/shed"
+	"github.com/Siruyy/gatify/internal/useragent"
+)
+
+// Identity sources a rule can use to tell clients apart.
+const (
+	IdentifyByIP     = "ip"
+	IdentifyByHeader = "header"
+	// IdentifyByCountry counts every client in a country together, by
+	// the GeoIP database configured with GEOIP_DB_PATH.
+	IdentifyByCountry = "country"
+	// IdentifyByCookie counts each value of the rule's cookie, such as a
+	// session ID, separately.
+	IdentifyByCookie = "cookie"
+	// IdentifyByJWTClaim counts each value of a claim, such as sub, of
+	// the verified bearer token on the request.
+	IdentifyByJWTClaim = "jwt_claim"
+)
+
+// DefaultLimitID is the rule ID the default limit counts under. No rule
+// may use it, or it would share the default limit's counters.
+const DefaultLimitID = "global"
+
+// Rule describes a rate limit applied to requests matching a path pattern.
+type Rule struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	Pattern       string   `json:"pattern"`
+	Methods       []string `json:"methods,omitempty"`
+	Priority      int      `json:"priority"`
+	Limit         int64    `json:"limit"`
+	WindowSeconds int64    `json:"window_seconds"`
+	IdentifyBy    string   `json:"identify_by"`
+	HeaderName    string   `json:"header_name,omitempty"`
+	// HeaderNames identify clients by the first of these headers present
+	// on the request, e.g. ["X-Api-Key", "Authorization"], for client
+	// populations that authenticate differently. It replaces HeaderName.
+	HeaderNames []string `json:"header_names,omitempty"`
+	// CookieName is the cookie identifying clients when IdentifyBy is
+	// "cookie". Requests without it are identified by IP.
+	CookieName string `json:"cookie_name,omitempty"`
+	// JWTClaim is the claim identifying clients when IdentifyBy is
+	// "jwt_claim", with dots reaching into nested objects ("org.id").
+	// Requests without a valid token are identified by IP.
+	JWTClaim string `json:"jwt_claim,omitempty"`
+	// KeyTransforms normalize identity values, e.g. ["trim", "lowercase"]
+	// or ["ipv4_prefix:24"], so near-duplicate identities share a bucket.
+	KeyTransforms []string `json:"key_transforms,omitempty"`
+	// MaxConcurrency caps how many requests each client may have in
+	// flight at once, for long-running endpoints. Zero means unlimited.
+	MaxConcurrency int64 `json:"max_concurrency,omitempty"`
+	// Quota caps each client's requests over a calendar QuotaPeriod, e.g.
+	// 100000 a month, on top of the rate limit. Zero means no quota.
+	Quota int64 `json:"quota,omitempty"`
+	// QuotaPeriod is "day" or "month" in UTC. It defaults to "month".
+	QuotaPeriod string `json:"quota_period,omitempty"`
+	// Policy names a shared limit set that supplies the rule's limit,
+	// window and quota, which the rule must then leave unset.
+	Policy string `json:"policy,omitempty"`
+	// MaxResponseBytes caps the backend response body size for matching
+	// requests. Zero means unlimited.
+	MaxResponseBytes int64 `json:"max_response_bytes,omitempty"`
+	// CacheHeaders set or override Cache-Control, CDN-Cache-Control and
+	// Surrogate-Key on responses to matching requests.
+	CacheHeaders map[string]string `json:"cache_headers,omitempty"`
+	// Headers adds, removes and rewrites headers on forwarded requests
+	// and on the backend's responses.
+	Headers *HeaderRewrite `json:"headers,omitempty"`
+	// Progressive replaces the hard cut-off at the limit with tiers of
+	// delays, 429s and tarpitting.
+	Progressive *Progressive `json:"progressive,omitempty"`
+	// Rejection customizes the body of the 429 sent when the limit is
+	// exceeded.
+	Rejection *Rejection `json:"rejection,omitempty"`
+	// RejectionMaxAge lets shared caches such as CDNs keep the rule's 429
+	// responses for up to this many seconds, and never past the client's
+	// Retry-After, so retries from blocked clients are answered at the
+	// edge. The CDN's cache key must tell clients apart, or one client's
+	// 429 is served to every client of the URL.
+	RejectionMaxAge int64 `json:"rejection_max_age,omitempty"`
+	// Replay enables nonce-based replay protection.
+	Replay *ReplayProtection `json:"replay,omitempty"`
+	// Upstream names the backend matching requests are forwarded to, as
+	// configured in UPSTREAMS. Empty means the default BACKEND_URL.
+	Upstream string `json:"upstream,omitempty"`
+	// Hedge re-sends slow GET and HEAD requests and serves the first
+	// response.
+	Hedge *Hedge `json:"hedge,omitempty"`
+	// WebSocket limits the messages clients send over upgraded
+	// connections.
+	WebSocket *WebSocketLimit `json:"websocket,omitempty"`
+	// Honeypot bans every client that sends a matching request.
+	Honeypot *Honeypot `json:"honeypot,omitempty"`
+	// Action answers matching requests at the gateway, blocking,
+	// redirecting or mocking them, instead of forwarding them.
+	Action *RuleAction `json:"action,omitempty"`
+	// CaptureHeaders records these backend response headers, such as
+	// X-Tenant or X-Cache, on each request's analytics event, so stats
+	// can be segmented by them. Headers are read before response
+	// rewrites, so a header can be captured and then removed.
+	CaptureHeaders []string `json:"capture_headers,omitempty"`
+	// Algorithm selects the rate limiting algorithm for matching requests,
+	// e.g. "leaky_bucket" to smooth traffic to a latency-sensitive backend
+	// or "sliding_log" to count requests exactly.
+	// Empty means the gateway's LIMITER_ALGORITHM.
+	Algorithm string `json:"algorithm,omitempty"`
+	// Burst lets clients exceed the limit by up to this many requests in
+	// short spikes. Only requests over the limit draw on it, and it
+	// refills once the client stays within the limit for a whole window.
+	// Only the sliding_window algorithm honors it.
+	Burst int64 `json:"burst,omitempty"`
+	// Namespace isolates the rule's limiter keys under their own prefix,
+	// e.g. one per tenant, so they can be purged together with
+	// POST /api/namespaces/{name}/reset.
+	Namespace string `json:"namespace,omitempty"`
+	// Shadow evaluates the rule's limits without enforcing them: requests
+	// it would reject with 429 are forwarded and recorded as would-be
+	// blocks, to validate a new limit against real traffic.
+	Shadow bool `json:"shadow,omitempty"`
+	// Debug logs every matching request in detail, with its headers and
+	// the limiter's decision, for targeted debugging in production.
+	Debug bool `json:"debug,omitempty"`
+	// AllowCountries, when set, rejects requests from clients outside
+	// these countries with 403; DenyCountries rejects requests from
+	// clients inside them. Both take ISO 3166-1 alpha-2 codes and need a
+	// GeoIP database.
+	AllowCountries []string `json:"allow_countries,omitempty"`
+	DenyCountries  []string `json:"deny_countries,omitempty"`
+	// Agents restricts the rule to requests from these user agent
+	// families, e.g. ["bot", "tool"], and ExemptAgents excludes them.
+	// Excluded requests fall through to the next matching rule.
+	Agents       []string `json:"agents,omitempty"`
+	ExemptAgents []string `json:"exempt_agents,omitempty"`
+	// ShedPriority, from 0 to 10, orders rules for load shedding: when the
+	// backends are saturated, requests with the lowest priority are shed
+	// first.
+	ShedPriority int `json:"shed_priority,omitempty"`
+	// Tags label the rule, e.g. "team:billing", for organizing and
+	// filtering rules. They do not affect enforcement.
+	Tags []string `json:"tags,omitempty"`
+	// Schedule, when set, applies the rule only at the times it covers.
+	Schedule *Schedule `json:"schedule,omitempty"`
+	// Public lists the rule in the policy served at
+	// /.well-known/rate-limit-policy.
+	Public  bool `json:"public,omitempty"`
+	Enabled bool `json:"enabled"`
+	// Revision counts the stored versions of the rule. It is assigned by
+	// the repository.
+	Revision  int64     `json:"revision"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Window returns the rule's window as a duration.
+func (r Rule) Window() time.Duration {
+	return time.Duration(r.WindowSeconds) * time.Second
+}
+
+// IdentityHeaders returns the headers a header-identified rule reads the
+// client identity from, in order of preference.
+func (r Rule) IdentityHeaders() []string {
+	if len(r.HeaderNames) > 0 {
+		return r.HeaderNames
+	}
+	return []string{r.HeaderName}
+}
+
+// Validate checks that the rule is complete and internally consistent.
+func (r Rule) Validate() error {
+	if r.ID == DefaultLimitID {
+		return fmt.Errorf("id %q is reserved for the default limit", DefaultLimitID)
+	}
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("name is required")
+	}
+	if err := ValidatePattern(r.Pattern); err != nil {
+		return err
+	}
+	if err := r.validateLimits(); err != nil {
+		return err
+	}
+	if r.MaxConcurrency < 0 {
+		return errors.New("max_concurrency must not be negative")
+	}
+	if r.MaxResponseBytes < 0 {
+		return errors.New("max_response_bytes must not be negative")
+	}
+	if r.RejectionMaxAge < 0 || r.RejectionMaxAge > MaxRejectionMaxAge {
+		return fmt.Errorf("rejection_max_age must be between 0 and %d", MaxRejectionMaxAge)
+	}
+	if r.RejectionMaxAge > 0 && !r.cacheableIdentity() {
+		return errors.New("rejection_max_age requires a header, cookie or jwt_claim identity; caches cannot tell IP or country identified clients apart")
+	}
+	if r.ShedPriority < 0 || r.ShedPriority > shed.MaxPriority {
+		return fmt.Errorf("shed_priority must be between 0 and %d", shed.MaxPriority)
+	}
+
+	for _, m := range r.Methods {
+		if !isHTTPMethod(m) {
+			return fmt.Errorf("unsupported method %q", m)
+		}
+	}
+
+	for _, spec := range r.KeyTransforms {
+		if _, err := parseKeyTransform(spec); err != nil {
+			return err
+		}
+	}
+
+	if err := validateCacheHeaders(r.CacheHeaders); err != nil {
+		return err
+	}
+	if err := validateCaptureHeaders(r.CaptureHeaders); err != nil {
+		return err
+	}
+	if err := r.Headers.validate(); err != nil {
+		return err
+	}
+	if err := r.Replay.validate(); err != nil {
+		return err
+	}
+	if err := r.Progressive.validate(); err != nil {
+		return err
+	}
+	if err := r.Rejection.validate(); err != nil {
+		return err
+	}
+	if err := r.Hedge.validate(); err != nil {
+		return err
+	}
+	if err := r.WebSocket.validate(); err != nil {
+		return err
+	}
+	if err := r.Honeypot.validate(); err != nil {
+		return err
+	}
+	if err := r.Action.validate(); err != nil {
+		return err
+	}
+	if err := r.Schedule.validate(); err != nil {
+		return err
+	}
+	if err := validateTags(r.Tags); err != nil {
+		return err
+	}
+	if r.Upstream != "" && !ValidUpstreamName(r.Upstream) {
+		return fmt.Errorf("invalid upstream %q: use letters, digits, - and _", r.Upstream)
+	}
+	if r.Namespace != "" && !ValidNamespace(r.Namespace) {
+		return fmt.Errorf("invalid namespace %q: use up to %d letters, digits, - and _", r.Namespace, maxNamespaceLen)
+	}
+	if r.Algorithm != "" && !limiter.Known(r.Algorithm) {
+		return fmt.Errorf("unsupported algorithm %q", r.Algorithm)
+	}
+	if r.Burst < 0 {
+		return errors.New("burst must not be negative")
+	}
+	if err := r.CheckAlgorithm(""); err != nil {
+		return err
+	}
+
+	if len(r.Agents) > 0 && len(r.ExemptAgents) > 0 {
+		return errors.New("set agents or exempt_agents, not both")
+	}
+	for _, a := range slices.Concat(r.Agents, r.ExemptAgents) {
+		if !useragent.Known(a) {
+			return fmt.Errorf("unknown agent family %q: use one of %s", a, strings.Join(useragent.Families(), ", "))
+		}
+	}
+	if len(r.AllowCountries) > 0 && len(r.DenyCountries) > 0 {
+		return errors.New("set allow_countries or deny_countries, not both")
+	}
+	for _, c := range slices.Concat(r.AllowCountries, r.DenyCountries) {
+		if !validCountry(c) {
+			return fmt.Errorf("invalid country %q: use ISO 3166-1 alpha-2 codes such as DE", c)
+		}
+	}
+
+	switch r.IdentifyBy {
+	case IdentifyByIP, IdentifyByCountry:
+	case IdentifyByCookie:
+		if r.CookieName == "" {
+			return errors.New("cookie_name is required when identify_by is cookie")
+		}
+		if err := (&http.Cookie{Name: r.CookieName}).Valid(); err != nil {
+			return fmt.Errorf("invalid cookie_name %q", r.CookieName)
+		}
+	case IdentifyByHeader:
+		return r.validateIdentityHeaders()
+	case IdentifyByJWTClaim:
+		return validateJWTClaim(r.JWTClaim)
+	default:
+		if !r.Composite() {
+			return fmt.Errorf("unsupported identify_by %q", r.IdentifyBy)
+		}
+		return r.validateCompositeIdentity()
+	}
+
+	return nil
+}
+
+func validCountry(code string) bool {
+	return len(code) == 2 && code[0] >= 'A' && code[0] <= 'Z' && code[1] >= 'A' && code[1] <= 'Z'
+}
+
+// CountryAllowed reports whether the rule's country lists admit clients
+// from country, which is empty when it is unknown. Unknown countries are
+// only admitted by rules without an allow list.
+func (r Rule) CountryAllowed(country string) bool {
+	if len(r.AllowCountries) > 0 {
+		return slices.Contains(r.AllowCountries, country)
+	}
+	return country == "" || !slices.Contains(r.DenyCountries, country)
+}
+
+// MatchesAgent reports whether the rule applies to requests from the
+// user agent family.
+func (r Rule) MatchesAgent(family string) bool {
+	if len(r.Agents) > 0 {
+		return slices.Contains(r.Agents, family)
+	}
+	return !slices.Contains(r.ExemptAgents, family)
+}
+
+// validateLimits checks the rate limit and quota, which a rule either
+// sets itself or takes from its policy.
+func (r Rule) validateLimits() error {
+	if r.Policy != "" {
+		if !ValidPolicyName(r.Policy) {
+			return fmt.Errorf("invalid policy %q: use letters, digits, - and _", r.Policy)
+		}
+		if r.Limit != 0 || r.WindowSeconds != 0 || r.Quota != 0 || r.QuotaPeriod != "" {
+			return errors.New("limit, window_seconds and quota come from the policy and must not be set")
+		}
+		return nil
+	}
+	if r.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	if r.WindowSeconds <= 0 {
+		return errors.New("window_seconds must be positive")
+	}
+	if r.Quota < 0 {
+		return errors.New("quota must not be negative")
+	}
+	if r.Quota > 0 && !quota.Known(r.QuotaPeriod) {
+		return fmt.Errorf("quota_period must be %q or %q", quota.PeriodDay, quota.PeriodMonth)
+	}
+	if r.Quota == 0 && r.QuotaPeriod != "" {
+		return errors.New("quota_period requires quota")
+	}
+	return nil
+}
+
+// CheckAlgorithm rejects settings the rule's algorithm ignores. def is
+// the gateway's LIMITER_ALGORITHM, which rules without an algorithm run
+// under; when it is empty only an explicit algorithm is checked.
+func (r *Rule) CheckAlgorithm(def string) error {
+	algorithm := cmp.Or(r.Algorithm, def)
+	if r.Burst <= 0 || algorithm == "" || algorithm == limiter.AlgorithmSlidingWindow {
+		return nil
+	}
+	if r.Algorithm == "" {
+		return fmt.Errorf("burst requires the %s algorithm, and LIMITER_ALGORITHM is %s: set algorithm to %[1]s",
+			limiter.AlgorithmSlidingWindow, def)
+	}
+	return fmt.Errorf("burst requires the %s algorithm", limiter.AlgorithmSlidingWindow)
+}
+
+// Normalize fills in defaults and canonicalizes fields before storage.
+func (r *Rule) Normalize() {
+	if r.IdentifyBy == "" {
+		r.IdentifyBy = IdentifyByIP
+	}
+	for i, m := range r.Methods {
+		r.Methods[i] = strings.ToUpper(strings.TrimSpace(m))
+	}
+	r.HeaderName = http.CanonicalHeaderKey(strings.TrimSpace(r.HeaderName))
+	r.CookieName = strings.TrimSpace(r.CookieName)
+	r.JWTClaim = strings.TrimSpace(r.JWTClaim)
+	for i, h := range r.HeaderNames {
+		r.HeaderNames[i] = http.CanonicalHeaderKey(strings.TrimSpace(h))
+	}
+	r.Upstream = strings.TrimSpace(r.Upstream)
+	r.Namespace = strings.TrimSpace(r.Namespace)
+	r.Policy = strings.TrimSpace(r.Policy)
+	r.Algorithm = strings.ToLower(strings.TrimSpace(r.Algorithm))
+	r.QuotaPeriod = strings.ToLower(strings.TrimSpace(r.QuotaPeriod))
+	if r.Quota > 0 && r.QuotaPeriod == "" {
+		r.QuotaPeriod = quota.PeriodMonth
+	}
+	for i, t := range r.KeyTransforms {
+		r.KeyTransforms[i] = strings.ToLower(strings.TrimSpace(t))
+	}
+	for i, c := range r.AllowCountries {
+		r.AllowCountries[i] = strings.ToUpper(strings.TrimSpace(c))
+	}
+	for i, c := range r.DenyCountries {
+		r.DenyCountries[i] = strings.ToUpper(strings.TrimSpace(c))
+	}
+	for i, a := range r.Agents {
+		r.Agents[i] = strings.ToLower(strings.TrimSpace(a))
+	}
+	for i, a := range r.ExemptAgents {
+		r.ExemptAgents[i] = strings.ToLower(strings.TrimSpace(a))
+	}
+	r.CacheHeaders = normalizeCacheHeaders(r.CacheHeaders)
+	r.CaptureHeaders = normalizeCaptureHeaders(r.CaptureHeaders)
+	r.Headers.normalize()
+	r.Replay.normalize()
+	r.Progressive.normalize()
+	r.Rejection.normalize()
+	r.Hedge.normalize()
+	r.WebSocket.normalize()
+	r.Honeypot.normalize()
+	r.Action.normalize()
+	r.Schedule.normalize()
+	for i, t := range r.Tags {
+		r.Tags[i] = strings.TrimSpace(t)
+	}
+}
+
+// ValidUpstreamName reports whether name can identify an upstream.
+func ValidUpstreamName(name string) bool {
+	return validName(name)
+}
+
+// maxNamespaceLen bounds namespaces, which are part of every limiter key
+// of their rules.
+const maxNamespaceLen = 64
+
+// ValidNamespace reports whether name can be a rule's namespace.
+func ValidNamespace(name string) bool {
+	return len(name) <= maxNamespaceLen && validName(name)
+}
+
+// ValidPolicyName reports whether name can identify a policy.
+func ValidPolicyName(name string) bool {
+	return validName(name)
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isHTTPMethod(m string) bool {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,309 @@
+package rules
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRuleValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*Rule)
+	}{
+		{"missing name", func(r *Rule) { r.Name = "" }},
+		{"reserved id", func(r *Rule) { r.ID = DefaultLimitID }},
+		{"relative pattern", func(r *Rule) { r.Pattern = "api" }},
+		{"zero limit", func(r *Rule) { r.Limit = 0 }},
+		{"zero window", func(r *Rule) { r.WindowSeconds = 0 }},
+		{"negative concurrency", func(r *Rule) { r.MaxConcurrency = -1 }},
+		{"negative response cap", func(r *Rule) { r.MaxResponseBytes = -1 }},
+		{"negative quota", func(r *Rule) { r.Quota = -1 }},
+		{"unknown quota period", func(r *Rule) { r.Quota = 1000; r.QuotaPeriod = "week" }},
+		{"quota period without quota", func(r *Rule) { r.QuotaPeriod = "day" }},
+		{"bad policy name", func(r *Rule) { r.Policy = "free tier"; r.Limit = 0; r.WindowSeconds = 0 }},
+		{"policy with own limit", func(r *Rule) { r.Policy = "free-tier" }},
+		{"bad key transform", func(r *Rule) { r.KeyTransforms = []string{"reverse"} }},
+		{"unsupported cache header", func(r *Rule) { r.CacheHeaders = map[string]string{"Set-Cookie": "a=b"} }},
+		{"empty cache header", func(r *Rule) { r.CacheHeaders = map[string]string{HeaderCacheControl: " "} }},
+		{"cache header injection", func(r *Rule) { r.CacheHeaders = map[string]string{HeaderSurrogateKey: "a\r\nX-Evil: 1"} }},
+		{"empty header rewrite", func(r *Rule) { r.Headers = &HeaderRewrite{} }},
+		{"rewrite protected header", func(r *Rule) {
+			r.Headers = &HeaderRewrite{Request: &HeaderEdits{Set: map[string]string{"host": "evil"}}}
+		}},
+		{"rewrite header injection", func(r *Rule) {
+			r.Headers = &HeaderRewrite{Response: &HeaderEdits{Add: map[string]string{"X-A": "1\r\nX-B: 2"}}}
+		}},
+		{"unknown placeholder", func(r *Rule) {
+			r.Headers = &HeaderRewrite{Request: &HeaderEdits{Set: map[string]string{"X-Trace": "{trace_id}"}}}
+		}},
+		{"empty removed header", func(r *Rule) { r.Headers = &HeaderRewrite{Response: &HeaderEdits{Remove: []string{"*"}}} }},
+		{"replay without nonce header", func(r *Rule) { r.Replay = &ReplayProtection{TTLSeconds: 60} }},
+		{"replay negative ttl", func(r *Rule) { r.Replay = &ReplayProtection{NonceHeader: "X-Nonce", TTLSeconds: -1} }},
+		{"progressive delay too long", func(r *Rule) { r.Progressive = &Progressive{DelayAbove: 0.8, DelayMS: 60000, TarpitAbove: 1.5} }},
+		{"progressive tarpit below limit", func(r *Rule) { r.Progressive = &Progressive{DelayAbove: 0.8, TarpitAbove: 0.9} }},
+		{"empty rejection body", func(r *Rule) { r.Rejection = &Rejection{ContentType: "text/html"} }},
+		{"bad rejection template", func(r *Rule) { r.Rejection = &Rejection{ContentType: "text/html", Body: "{{.Limit"} }},
+		{"bad rejection content type", func(r *Rule) { r.Rejection = &Rejection{ContentType: "text/", Body: "slow down"} }},
+		{"duplicate rejection alternative", func(r *Rule) {
+			r.Rejection = &Rejection{ContentType: "text/plain", Body: "slow down",
+				Alternatives: []Rejection{{ContentType: "text/plain; charset=utf-8", Body: "wait"}}}
+		}},
+		{"nested rejection alternative", func(r *Rule) {
+			r.Rejection = &Rejection{Body: "{}", Alternatives: []Rejection{{ContentType: "text/plain", Body: "wait",
+				Alternatives: []Rejection{{ContentType: "text/html", Body: "<p>wait</p>"}}}}}
+		}},
+		{"bad rejection alternative template", func(r *Rule) {
+			r.Rejection = &Rejection{Body: "{}", Alternatives: []Rejection{{ContentType: "text/plain", Body: "{{.Limit"}}}
+		}},
+		{"hedge without delay", func(r *Rule) { r.Hedge = &Hedge{} }},
+		{"hedge bad upstream", func(r *Rule) { r.Hedge = &Hedge{AfterMS: 100, Upstream: "a b"} }},
+		{"shed priority too high", func(r *Rule) { r.ShedPriority = 11 }},
+		{"rejection max age too long", func(r *Rule) { r.RejectionMaxAge = 61 }},
+		{"negative rejection max age", func(r *Rule) { r.RejectionMaxAge = -1 }},
+		{"rejection max age by ip", func(r *Rule) { r.IdentifyBy, r.RejectionMaxAge = IdentifyByIP, 10 }},
+		{"rejection max age by country", func(r *Rule) { r.IdentifyBy, r.RejectionMaxAge = IdentifyByCountry, 10 }},
+		{"rejection max age by composite ip", func(r *Rule) { r.IdentifyBy, r.RejectionMaxAge = "{ip}:{header:X-Tenant}", 10 }},
+		{"unknown agent family", func(r *Rule) { r.Agents = []string{"robot"} }},
+		{"agents and exempt agents", func(r *Rule) { r.Agents, r.ExemptAgents = []string{"bot"}, []string{"tool"} }},
+		{"websocket without rate", func(r *Rule) { r.WebSocket = &WebSocketLimit{} }},
+		{"websocket bad scope", func(r *Rule) { r.WebSocket = &WebSocketLimit{MessagesPerSecond: 10, Per: "ip"} }},
+		{"honeypot negative ban", func(r *Rule) { r.Honeypot = &Honeypot{BanSeconds: -1} }},
+		{"unknown action", func(r *Rule) { r.Action = &RuleAction{Type: "drop"} }},
+		{"redirect without url", func(r *Rule) { r.Action = &RuleAction{Type: ActionRedirect, Status: 302} }},
+		{"redirect with bad status", func(r *Rule) { r.Action = &RuleAction{Type: ActionRedirect, Status: 200, URL: "/new"} }},
+		{"block with success status", func(r *Rule) { r.Action = &RuleAction{Type: ActionBlock, Status: 200} }},
+		{"mock with url", func(r *Rule) { r.Action = &RuleAction{Type: ActionMock, Status: 200, URL: "/x"} }},
+		{"too many captured headers", func(r *Rule) { r.CaptureHeaders = []string{"A", "B", "C", "D", "E", "F"} }},
+		{"capture secret header", func(r *Rule) { r.CaptureHeaders = []string{"set-cookie"} }},
+		{"capture header twice", func(r *Rule) { r.CaptureHeaders = []string{"X-Tenant", "x-tenant "} }},
+		{"capture bad header", func(r *Rule) { r.CaptureHeaders = []string{"X Tenant"} }},
+		{"bad upstream", func(r *Rule) { r.Upstream = "users api" }},
+		{"unknown algorithm", func(r *Rule) { r.Algorithm = "token_bucket" }},
+		{"negative burst", func(r *Rule) { r.Burst = -1 }},
+		{"bad namespace", func(r *Rule) { r.Namespace = "acme:prod" }},
+		{"burst with gcra", func(r *Rule) { r.Algorithm, r.Burst = "gcra", 10 }},
+		{"bad method", func(r *Rule) { r.Methods = []string{"FETCH"} }},
+		{"header without name", func(r *Rule) { r.IdentifyBy = IdentifyByHeader }},
+		{"header name and names", func(r *Rule) {
+			r.IdentifyBy, r.HeaderName, r.HeaderNames = IdentifyByHeader, "X-Api-Key", []string{"Authorization"}
+		}},
+		{"empty header in names", func(r *Rule) { r.IdentifyBy, r.HeaderNames = IdentifyByHeader, []string{"X-Api-Key", " "} }},
+		{"unknown identity", func(r *Rule) { r.IdentifyBy = "fingerprint" }},
+		{"cookie without name", func(r *Rule) { r.IdentifyBy = IdentifyByCookie }},
+		{"bad cookie name", func(r *Rule) { r.IdentifyBy, r.CookieName = IdentifyByCookie, "session id" }},
+		{"composite with unknown source", func(r *Rule) { r.IdentifyBy = "ip+fingerprint" }},
+		{"composite with repeated source", func(r *Rule) { r.IdentifyBy = "ip+ip" }},
+		{"composite header without name", func(r *Rule) { r.IdentifyBy = "ip+header" }},
+		{"composite cookie without name", func(r *Rule) { r.IdentifyBy = "{ip}:{cookie}" }},
+		{"template without placeholder", func(r *Rule) { r.IdentifyBy = "{}" }},
+		{"template unknown placeholder", func(r *Rule) { r.IdentifyBy = "{ip}:{tenant}" }},
+		{"template unbalanced braces", func(r *Rule) { r.IdentifyBy = "{ip}:{header:X-Tenant" }},
+		{"template named ip", func(r *Rule) { r.IdentifyBy = "{ip:v4}" }},
+		{"template bad cookie", func(r *Rule) { r.IdentifyBy = "{cookie:session id}" }},
+		{"jwt without claim", func(r *Rule) { r.IdentifyBy = IdentifyByJWTClaim }},
+		{"jwt empty claim segment", func(r *Rule) { r.IdentifyBy, r.JWTClaim = IdentifyByJWTClaim, "org..id" }},
+		{"bad country", func(r *Rule) { r.DenyCountries = []string{"Germany"} }},
+		{"bad tag", func(r *Rule) { r.Tags = []string{"team billing"} }},
+		{"duplicate tag", func(r *Rule) { r.Tags = []string{"a", "a"} }},
+		{"schedule bad day", func(r *Rule) { r.Schedule = &Schedule{Days: []string{"monday"}} }},
+		{"schedule start without end", func(r *Rule) { r.Schedule = &Schedule{Start: "09:00"} }},
+		{"schedule bad time", func(r *Rule) { r.Schedule = &Schedule{Start: "9am", End: "17:00"} }},
+		{"schedule empty window", func(r *Rule) { r.Schedule = &Schedule{Start: "09:00", End: "09:00"} }},
+		{"schedule bad timezone", func(r *Rule) { r.Schedule = &Schedule{Days: []string{"mon"}, Timezone: "Mars/Olympus"} }},
+		{"allow and deny countries", func(r *Rule) { r.AllowCountries, r.DenyCountries = []string{"DE"}, []string{"FR"} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := validRule()
+			tt.mutate(&r)
+			if err := r.Validate(); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+
+	if err := validRule().Validate(); err != nil {
+		t.Errorf("Expected valid rule, got %v", err)
+	}
+	withPolicy := validRule()
+	withPolicy.Limit, withPolicy.WindowSeconds, withPolicy.Policy = 0, 0, "free-tier"
+	if err := withPolicy.Validate(); err != nil {
+		t.Errorf("Expected a rule taking its limits from a policy to be valid, got %v", err)
+	}
+	cached := validRule()
+	cached.IdentifyBy, cached.HeaderName, cached.RejectionMaxAge = IdentifyByHeader, "X-Api-Key", 10
+	if err := cached.Validate(); err != nil {
+		t.Errorf("Expected a header identified rule to allow rejection_max_age, got %v", err)
+	}
+}
+
+func TestRuleCheckAlgorithm(t *testing.T) {
+	r := validRule()
+	r.Burst = 10
+	for def, ok := range map[string]bool{"": true, "sliding_window": true, "gcra": false, "leaky_bucket": false, "sliding_log": false} {
+		if err := r.CheckAlgorithm(def); (err == nil) != ok {
+			t.Errorf("CheckAlgorithm(%q) = %v, want ok %v", def, err, ok)
+		}
+	}
+	r.Algorithm = "sliding_window"
+	if err := r.CheckAlgorithm("gcra"); err != nil {
+		t.Errorf("Expected an explicit sliding_window algorithm to keep burst, got %v", err)
+	}
+}
+
+func TestRuleCountryAllowed(t *testing.T) {
+	allow := Rule{AllowCountries: []string{"DE", "FR"}}
+	deny := Rule{DenyCountries: []string{"GB"}}
+	for _, tc := range []struct {
+		rule    Rule
+		country string
+		want    bool
+	}{
+		{allow, "DE", true},
+		{allow, "GB", false},
+		{allow, "", false},
+		{deny, "GB", false},
+		{deny, "DE", true},
+		{deny, "", true},
+		{Rule{}, "GB", true},
+	} {
+		if got := tc.rule.CountryAllowed(tc.country); got != tc.want {
+			t.Errorf("%+v CountryAllowed(%q) = %v, want %v", tc.rule, tc.country, got, tc.want)
+		}
+	}
+
+	r := validRule()
+	r.IdentifyBy, r.AllowCountries = IdentifyByCountry, []string{" de "}
+	r.Normalize()
+	if err := r.Validate(); err != nil || r.AllowCountries[0] != "DE" {
+		t.Errorf("Expected a normalized valid country rule, got %v %v", r.AllowCountries, err)
+	}
+}
+
+func TestRuleNormalize(t *testing.T) {
+	r := Rule{
+		Methods:        []string{" get", "post"},
+		HeaderName:     "x-api-key",
+		CacheHeaders:   map[string]string{"cdn-cache-control": " max-age=60 "},
+		Replay:         &ReplayProtection{NonceHeader: "x-webhook-id"},
+		Quota:          1000,
+		CaptureHeaders: []string{" x-cache"},
+	}
+	r.Normalize()
+
+	if r.IdentifyBy != IdentifyByIP {
+		t.Errorf("Expected default identify_by ip, got %s", r.IdentifyBy)
+	}
+	if r.Methods[0] != "GET" || r.Methods[1] != "POST" {
+		t.Errorf("Expected upper-cased methods, got %v", r.Methods)
+	}
+	if r.HeaderName != "X-Api-Key" {
+		t.Errorf("Expected canonical header name, got %s", r.HeaderName)
+	}
+	if r.CacheHeaders[HeaderCDNCacheControl] != "max-age=60" {
+		t.Errorf("Expected canonical cache headers, got %v", r.CacheHeaders)
+	}
+	if r.Replay.NonceHeader != "X-Webhook-Id" || r.Replay.TTLSeconds != DefaultReplayTTLSeconds {
+		t.Errorf("Expected normalized replay protection, got %+v", r.Replay)
+	}
+	if r.CaptureHeaders[0] != "X-Cache" {
+		t.Errorf("Expected canonical captured headers, got %v", r.CaptureHeaders)
+	}
+	if r.QuotaPeriod != "month" {
+		t.Errorf("Expected default quota period month, got %q", r.QuotaPeriod)
+	}
+	if err := validateCacheHeaders(r.CacheHeaders); err != nil {
+		t.Errorf("Expected normalized cache headers to validate, got %v", err)
+	}
+}
+
+func TestRuleActionNormalize(t *testing.T) {
+	for _, tc := range []struct {
+		action RuleAction
+		status int
+	}{
+		{RuleAction{Type: " Block "}, 403},
+		{RuleAction{Type: "redirect", URL: " https://example.com/new "}, 302},
+		{RuleAction{Type: "mock", Body: `{"ok":true}`}, 200},
+	} {
+		r := validRule()
+		r.Action = &tc.action
+		r.Normalize()
+		if err := r.Validate(); err != nil {
+			t.Fatalf("%+v: Validate() error = %v", tc.action, err)
+		}
+		if r.Action.Status != tc.status {
+			t.Errorf("%s: expected default status %d, got %d", r.Action.Type, tc.status, r.Action.Status)
+		}
+	}
+
+	r := validRule()
+	r.Action = &RuleAction{Type: ActionMock, Body: "{}"}
+	r.Normalize()
+	if r.Action.ContentType != "application/json" {
+		t.Errorf("Expected a mock body to default to JSON, got %q", r.Action.ContentType)
+	}
+}
+
+func TestHeaderRewriteNormalize(t *testing.T) {
+	r := validRule()
+	r.Headers = &HeaderRewrite{Response: &HeaderEdits{
+		Remove:  []string{" x-internal-*", "server"},
+		Default: map[string]string{"x-request-id": PlaceholderRequestID},
+	}}
+	r.Normalize()
+	if err := r.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if r.Headers.Response.Remove[0] != "X-Internal-*" || r.Headers.Response.Remove[1] != "Server" {
+		t.Errorf("Expected canonical removals, got %v", r.Headers.Response.Remove)
+	}
+	if r.Headers.Response.Default["X-Request-Id"] != PlaceholderRequestID || !r.Headers.UsesRequestID() {
+		t.Errorf("Expected canonical defaults, got %v", r.Headers.Response.Default)
+	}
+}
+
+func TestProgressiveDefaults(t *testing.T) {
+	r := validRule()
+	r.Progressive = &Progressive{DelayMS: 200, TarpitMS: 2000}
+	r.Normalize()
+	if err := r.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if r.Progressive.DelayAbove != DefaultDelayAbove || r.Progressive.TarpitAbove != DefaultTarpitAbove {
+		t.Errorf("Expected default tiers, got %+v", r.Progressive)
+	}
+	if got := r.Progressive.CountingLimit(10); got != 15 {
+		t.Errorf("CountingLimit(10) = %d, want 15", got)
+	}
+	if got := (&Progressive{DelayAbove: 0.8, TarpitAbove: 1.5}).CountingLimit(10); got != 10 {
+		t.Errorf("Expected no extra counting without a tarpit, got %d", got)
+	}
+}
+
+func TestRuleIdentityParts(t *testing.T) {
+	list := Rule{IdentifyBy: "ip+header", HeaderName: "X-Api-Key"}
+	parts, err := list.IdentityParts()
+	want := []IdentityPart{{Text: "ip:"}, {Source: IdentifyByIP}, {Text: "+header:"}, {Source: IdentifyByHeader}}
+	if err != nil || !slices.Equal(parts, want) {
+		t.Errorf("IdentityParts() = %+v, %v, want %+v", parts, err, want)
+	}
+
+	tmpl := Rule{IdentifyBy: "{ip}:{header:X-Tenant}"}
+	parts, err = tmpl.IdentityParts()
+	want = []IdentityPart{{Source: IdentifyByIP}, {Text: ":"}, {Source: IdentifyByHeader, Name: "X-Tenant"}}
+	if err != nil || !slices.Equal(parts, want) {
+		t.Errorf("IdentityParts() = %+v, %v, want %+v", parts, err, want)
+	}
+	if !list.Composite() || !tmpl.Composite() || (Rule{IdentifyBy: IdentifyByHeader}).Composite() {
+		t.Error("Expected only combined identities to be composite")
+	}
+
+	for _, r := range []Rule{list, tmpl} {
+		r.Name, r.Pattern, r.Limit, r.WindowSeconds = "tenants", "/*", 10, 60
+		if err := r.Validate(); err != nil {
+			t.Errorf("Validate(%q) = %v", r.IdentifyBy, err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxTags bounds how many tags a rule carries.
+const maxTags = 16
+
+// tagPattern is what a tag may look like, e.g. "team:billing".
+var tagPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.:-]{0,63}$`)
+
+// weekdays are the names Schedule.Days takes, indexed by time.Weekday.
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Schedule restricts when a rule applies, for example to business hours.
+// Outside it, requests fall through to the next matching rule.
+type Schedule struct {
+	// Days are the days of the week the rule applies on, as "mon" to
+	// "sun"; every day when empty.
+	Days []string `json:"days,omitempty"`
+	// Start and End bound the time of day the rule applies, as HH:MM;
+	// all day when both are empty. An End before Start spans midnight,
+	// and the late part counts as the day it started on.
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	// Timezone is the IANA time zone of Days, Start and End; UTC when
+	// empty.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// Active reports whether the schedule applies at t. A nil schedule
+// always applies.
+func (s *Schedule) Active(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	loc, err := s.location()
+	if err != nil {
+		return false
+	}
+	return s.activeIn(t, loc)
+}
+
+// activeIn is Active with the schedule's location already loaded.
+func (s *Schedule) activeIn(t time.Time, loc *time.Location) bool {
+	t = t.In(loc)
+	day := t.Weekday()
+	if s.Start != s.End {
+		start, _ := parseClock(s.Start)
+		end, _ := parseClock(s.End)
+		now := t.Hour()*60 + t.Minute()
+		switch {
+		case start < end:
+			if now < start || now >= end {
+				return false
+			}
+		case now >= end && now < start:
+			return false
+		case now < end:
+			// The early morning part of a window started yesterday.
+			day = (day + 6) % 7
+		}
+	}
+	return len(s.Days) == 0 || slices.Contains(s.Days, weekdays[day])
+}
+
+func (s *Schedule) location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(s.Timezone)
+}
+
+func (s *Schedule) validate() error {
+	if s == nil {
+		return nil
+	}
+	for _, d := range s.Days {
+		if !slices.Contains(weekdays, d) {
+			return fmt.Errorf("invalid schedule day %q: use mon, tue, wed, thu, fri, sat or sun", d)
+		}
+	}
+	if (s.Start == "") != (s.End == "") {
+		return errors.New("schedule needs both start and end, or neither")
+	}
+	if s.Start != "" {
+		if _, err := parseClock(s.Start); err != nil {
+			return fmt.Errorf("invalid schedule start %q: use HH:MM", s.Start)
+		}
+		if _, err := parseClock(s.End); err != nil {
+			return fmt.Errorf("invalid schedule end %q: use HH:MM", s.End)
+		}
+		if s.Start == s.End {
+			return errors.New("schedule start and end must differ")
+		}
+	}
+	if _, err := s.location(); err != nil {
+		return fmt.Errorf("invalid schedule timezone %q", s.Timezone)
+	}
+	return nil
+}
+
+func (s *Schedule) normalize() {
+	if s == nil {
+		return
+	}
+	for i, d := range s.Days {
+		s.Days[i] = strings.ToLower(strings.TrimSpace(d))
+	}
+	s.Start = strings.TrimSpace(s.Start)
+	s.End = strings.TrimSpace(s.End)
+	s.Timezone = strings.TrimSpace(s.Timezone)
+}
+
+// parseClock parses an HH:MM time of day into minutes after midnight.
+func parseClock(v string) (int, error) {
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func validateTags(tags []string) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("at most %d tags are allowed", maxTags)
+	}
+	for i, tag := range tags {
+		if !tagPattern.MatchString(tag) {
+			return fmt.Errorf("invalid tag %q: use up to 64 letters, digits, _, ., : and -", tag)
+		}
+		if slices.Contains(tags[:i], tag) {
+			return fmt.Errorf("tag %q appears twice", tag)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package rules
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleActive(t *testing.T) {
+	berlin := &Schedule{Days: []string{"mon"}, Start: "09:00", End: "17:00", Timezone: "Europe/Berlin"}
+	night := &Schedule{Days: []string{"fri"}, Start: "22:00", End: "06:00"}
+
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		at       string
+		want     bool
+	}{
+		{"nil schedule", nil, "2026-03-07T03:00:00Z", true},
+		{"inside local hours", berlin, "2026-03-02T08:30:00Z", true},
+		{"before local opening", berlin, "2026-03-02T07:30:00Z", false},
+		{"end is exclusive", berlin, "2026-03-02T16:00:00Z", false},
+		{"other day", berlin, "2026-03-03T10:00:00Z", false},
+		{"overnight start", night, "2026-03-06T23:00:00Z", true},
+		{"overnight after midnight", night, "2026-03-07T05:59:00Z", true},
+		{"overnight from the wrong day", night, "2026-03-06T05:00:00Z", false},
+		{"overnight gap", night, "2026-03-07T12:00:00Z", false},
+		{"days only", &Schedule{Days: []string{"sat", "sun"}}, "2026-03-08T12:00:00Z", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, _ := time.Parse(time.RFC3339, tt.at)
+			if got := tt.schedule.Active(at); got != tt.want {
+				t.Errorf("Active(%s) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
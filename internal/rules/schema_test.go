@@ -0,0 +1,79 @@
+package rules
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDecodeRuleSchemaVersions(t *testing.T) {
+	data := []byte(`{"id":"r1","name":"a","pattern":"/a","limit":1,"window_seconds":1,"owner":"search-team","labels":["x"]}`)
+
+	for _, version := range []int{0, 1, SchemaVersion} {
+		rule := Rule{Enabled: true}
+		if _, err := DecodeRule(data, version, &rule); err == nil || !strings.Contains(err.Error(), "unknown field") {
+			t.Errorf("Version %d: expected unknown fields to be rejected, got %v", version, err)
+		}
+	}
+
+	rule := Rule{Enabled: true}
+	ignored, err := DecodeRule(data, SchemaVersion+1, &rule)
+	if err != nil {
+		t.Fatalf("DecodeRule() error = %v", err)
+	}
+	if !slices.Equal(ignored, []string{"labels", "owner"}) {
+		t.Errorf("ignored = %v, want [labels owner]", ignored)
+	}
+	if rule.ID != "r1" || rule.Limit != 1 || !rule.Enabled {
+		t.Errorf("Expected the known fields over the defaults, got %+v", rule)
+	}
+
+	rule = Rule{}
+	if _, err := DecodeRule([]byte(`{"ID":"r2","Window_Seconds":5}`), SchemaVersion+1, &rule); err != nil || rule.WindowSeconds != 5 {
+		t.Errorf("Expected field names to match case-insensitively as encoding/json does, got %+v, %v", rule, err)
+	}
+
+	if _, err := DecodeRule([]byte(`{"id":`), SchemaVersion+1, &rule); err == nil {
+		t.Error("Expected malformed JSON to be rejected from newer writers too")
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	plain := Rule{ID: "plain", IdentifyBy: IdentifyByIP}
+	claim := Rule{ID: "claim", IdentifyBy: IdentifyByJWTClaim, JWTClaim: "sub"}
+	tagged := Rule{ID: "tagged", IdentifyBy: IdentifyByIP, Tags: []string{"team:billing"}}
+
+	if v := plain.MinSchemaVersion(); v != 1 {
+		t.Errorf("MinSchemaVersion() = %d, want 1", v)
+	}
+	if v := claim.MinSchemaVersion(); v != 2 {
+		t.Errorf("MinSchemaVersion() = %d, want 2", v)
+	}
+	if err := CheckSchema([]Rule{plain, claim}, 2); err != nil {
+		t.Errorf("CheckSchema(2) error = %v", err)
+	}
+	err := CheckSchema([]Rule{plain, claim}, 1)
+	if err == nil || !strings.Contains(err.Error(), `rule "claim" uses jwt_claim`) {
+		t.Errorf("CheckSchema(1) error = %v, want the jwt_claim rule named", err)
+	}
+	if v := tagged.MinSchemaVersion(); v != 3 {
+		t.Errorf("MinSchemaVersion() = %d, want 3 for tags", v)
+	}
+	if err := CheckSchema([]Rule{tagged}, 2); err == nil || !strings.Contains(err.Error(), "uses tags") {
+		t.Errorf("CheckSchema(2) error = %v, want the tags rule named", err)
+	}
+}
+
+func TestParseSchemaVersion(t *testing.T) {
+	if v, err := ParseSchemaVersion(""); err != nil || v != SchemaVersion {
+		t.Errorf("ParseSchemaVersion(\"\") = %d, %v", v, err)
+	}
+	if v, err := ParseSchemaVersion("7"); err != nil || v != 7 {
+		t.Errorf("ParseSchemaVersion(7) = %d, %v", v, err)
+	}
+	for _, bad := range []string{"0", "-1", "v2"} {
+		if _, err := ParseSchemaVersion(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
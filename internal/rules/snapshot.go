@@ -0,0 +1,117 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/snapshot"
+)
+
+// snapshotFile is the on-disk form of an InMemoryRepository. Snapshots are
+// decoded leniently, so one saved by a newer build still restores.
+type snapshotFile struct {
+	SchemaVersion int                   `json:"schema_version"`
+	SavedAt       time.Time             `json:"saved_at"`
+	Rules         []Rule                `json:"rules"`
+	History       map[string][]Revision `json:"history"`
+}
+
+// SaveSnapshot writes every rule and its history to path as JSON. The file
+// is replaced atomically, so a crash mid-write leaves the previous
+// snapshot intact.
+func (r *InMemoryRepository) SaveSnapshot(path string) error {
+	_, err := r.saveSnapshot(path)
+	return err
+}
+
+func (r *InMemoryRepository) saveSnapshot(path string) (uint64, error) {
+	r.mu.RLock()
+	snap := snapshotFile{
+		SchemaVersion: SchemaVersion,
+		SavedAt:       r.now().UTC(),
+		Rules:         make([]Rule, 0, len(r.rules)),
+		History:       make(map[string][]Revision, len(r.history)),
+	}
+	for _, rule := range r.rules {
+		snap.Rules = append(snap.Rules, cloneRule(rule))
+	}
+	for id, history := range r.history {
+		revs := make([]Revision, len(history))
+		for i, rev := range history {
+			rev.Rule = cloneRule(rev.Rule)
+			revs[i] = rev
+		}
+		snap.History[id] = revs
+	}
+	changes := r.changes
+	r.mu.RUnlock()
+
+	SortByPriority(snap.Rules)
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("encode rules snapshot: %w", err)
+	}
+
+	if err := snapshot.WriteFile(path, data); err != nil {
+		return 0, fmt.Errorf("write rules snapshot: %w", err)
+	}
+	return changes, nil
+}
+
+// LoadSnapshot replaces the repository's contents with the snapshot at
+// path. A missing file is reported as an error satisfying
+// errors.Is(err, fs.ErrNotExist).
+func (r *InMemoryRepository) LoadSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read rules snapshot: %w", err)
+	}
+	var snap snapshotFile
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode rules snapshot %s: %w", path, err)
+	}
+	if snap.SchemaVersion > SchemaVersion {
+		log.Printf("⚠️  Rules snapshot %s is from schema version %d; fields added after version %d are dropped", path, snap.SchemaVersion, SchemaVersion)
+	}
+
+	list := make(map[string]Rule, len(snap.Rules))
+	for _, rule := range snap.Rules {
+		if rule.ID == "" {
+			return fmt.Errorf("decode rules snapshot %s: rule without id", path)
+		}
+		list[rule.ID] = rule
+	}
+	history := make(map[string][]Revision, len(list))
+	for id, revs := range snap.History {
+		if _, ok := list[id]; ok {
+			history[id] = revs
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = list
+	r.history = history
+	r.changes = 0
+	return nil
+}
+
+// RunSnapshots saves the repository to path every interval while it has
+// unsaved changes, until ctx is cancelled.
+func (r *InMemoryRepository) RunSnapshots(ctx context.Context, path string, interval time.Duration) {
+	snapshot.Run(ctx, "rules", interval, r.changeCount, func() (uint64, error) {
+		return r.saveSnapshot(path)
+	})
+}
+
+// changeCount returns the number of changes made to the repository since
+// it was created or last loaded.
+func (r *InMemoryRepository) changeCount() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.changes
+}
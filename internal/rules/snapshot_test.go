@@ -0,0 +1,95 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "rules.json")
+
+	repo := NewInMemoryRepository()
+	created, err := repo.Create(ctx, validRule())
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	created.Limit = 20
+	if _, err := repo.Update(ctx, created); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := repo.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot() error = %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), `"schema_version": `+strconv.Itoa(SchemaVersion)) {
+		t.Errorf("Expected the snapshot to record its schema version, got %s, %v", data, err)
+	}
+
+	restored := NewInMemoryRepository()
+	if err := restored.LoadSnapshot(path); err != nil {
+		t.Fatalf("LoadSnapshot() error = %v", err)
+	}
+	got, err := restored.Get(ctx, created.ID)
+	if err != nil || got.Limit != 20 || got.Revision != 2 {
+		t.Fatalf("Restored rule = %+v, %v", got, err)
+	}
+	revs, err := restored.Revisions(ctx, created.ID)
+	if err != nil || len(revs) != 2 || revs[1].Action != ActionCreate {
+		t.Errorf("Restored history = %+v, %v", revs, err)
+	}
+}
+
+func TestLoadSnapshotFromNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	data := `{"schema_version":99,"saved_at":"2026-01-01T00:00:00Z","rules":[
+		{"id":"r1","name":"a","pattern":"/a","limit":5,"window_seconds":60,"identify_by":"ip","enabled":true,"revision":1,"labels":["x"]}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewInMemoryRepository()
+	if err := repo.LoadSnapshot(path); err != nil {
+		t.Fatalf("LoadSnapshot() error = %v", err)
+	}
+	if got, err := repo.Get(context.Background(), "r1"); err != nil || got.Limit != 5 {
+		t.Errorf("Restored rule = %+v, %v", got, err)
+	}
+}
+
+func TestLoadSnapshotMissing(t *testing.T) {
+	err := NewInMemoryRepository().LoadSnapshot(filepath.Join(t.TempDir(), "none.json"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected a not-exist error, got %v", err)
+	}
+}
+
+func TestRunSnapshotsSavesChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "rules.json")
+
+	repo := NewInMemoryRepository()
+	go repo.RunSnapshots(ctx, path, 10*time.Millisecond)
+	if _, err := repo.Create(ctx, validRule()); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a snapshot to be written after a change")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,51 @@
+package rules
+
+import (
+	"errors"
+	"strings"
+)
+
+// Scopes a WebSocket message limit can be counted in.
+const (
+	WebSocketPerConnection = "connection"
+	WebSocketPerClient     = "client"
+)
+
+// WebSocketLimit caps the messages a client sends over proxied WebSocket
+// connections, which the request rate limit only sees once, when the
+// connection is opened. Connections exceeding it are closed with status
+// 1008 (policy violation).
+type WebSocketLimit struct {
+	// MessagesPerSecond is the sustained message rate allowed; as many
+	// messages may arrive in a single burst.
+	MessagesPerSecond int64 `json:"messages_per_second"`
+	// Per is "connection" to give every connection its own budget, or
+	// "client" to share one across all of a client's connections. It
+	// defaults to "connection".
+	Per string `json:"per,omitempty"`
+}
+
+func (l *WebSocketLimit) validate() error {
+	if l == nil {
+		return nil
+	}
+	if l.MessagesPerSecond <= 0 {
+		return errors.New("websocket.messages_per_second must be positive")
+	}
+	switch l.Per {
+	case "", WebSocketPerConnection, WebSocketPerClient:
+	default:
+		return errors.New(`websocket.per must be "connection" or "client"`)
+	}
+	return nil
+}
+
+func (l *WebSocketLimit) normalize() {
+	if l == nil {
+		return
+	}
+	l.Per = strings.ToLower(strings.TrimSpace(l.Per))
+	if l.Per == "" {
+		l.Per = WebSocketPerConnection
+	}
+}
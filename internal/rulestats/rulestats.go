@@ -0,0 +1,181 @@
+// Package rulestats keeps live per-rule enforcement counters in shared storage
+package rulestats
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+const (
+	// DefaultFlushInterval is how often locally counted requests are
+	// added to the shared counters.
+	DefaultFlushInterval = 10 * time.Second
+
+	keyPrefix = "gatify:rulestats:"
+	bucket    = time.Hour
+	// bucketTTL keeps the previous hour around for the sliding estimate.
+	bucketTTL = 3 * time.Hour
+	// lastMatchedTTL lets the timestamps of deleted rules expire.
+	lastMatchedTTL = 30 * 24 * time.Hour
+)
+
+// Stats summarizes a rule's recent enforcement across every gateway
+// instance.
+type Stats struct {
+	// MatchedLastHour and BlockedLastHour estimate requests over the last
+	// hour with the same sliding window weighting the limiter uses.
+	MatchedLastHour int64      `json:"matched_last_hour"`
+	BlockedLastHour int64      `json:"blocked_last_hour"`
+	LastMatchedAt   *time.Time `json:"last_matched_at,omitempty"`
+}
+
+type tally struct {
+	matched int64
+	blocked int64
+	last    time.Time
+}
+
+// Recorder counts requests per rule in memory and periodically adds the
+// counts to storage, so the request path never waits on Redis. Counts
+// not yet flushed are missing from Stats.
+type Recorder struct {
+	store storage.Storage
+	now   func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]*tally
+}
+
+// NewRecorder creates a Recorder keeping its counters in store.
+func NewRecorder(store storage.Storage) *Recorder {
+	return &Recorder{store: store, now: time.Now, pending: make(map[string]*tally)}
+}
+
+// Record counts a request matched by ruleID, blocked unless allowed.
+func (r *Recorder) Record(ruleID string, allowed bool, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.pending[ruleID]
+	if t == nil {
+		t = &tally{}
+		r.pending[ruleID] = t
+	}
+	t.matched++
+	if !allowed {
+		t.blocked++
+	}
+	if at.After(t.last) {
+		t.last = at
+	}
+}
+
+// Run flushes counts every interval until ctx is cancelled, then flushes
+// once more.
+func (r *Recorder) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Flush(ctx); err != nil {
+				log.Printf("Failed to flush rule stats: %v", err)
+			}
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			if err := r.Flush(shutdownCtx); err != nil {
+				log.Printf("Failed to flush rule stats: %v", err)
+			}
+			cancel()
+			return
+		}
+	}
+}
+
+// Flush adds the counts recorded since the last flush to the current
+// hour's shared counters. Counts that fail to be written are lost rather
+// than retried, as they are only indicative.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[string]*tally, len(pending))
+	r.mu.Unlock()
+
+	hour := r.now().Truncate(bucket)
+	var errs []error
+	for ruleID, t := range pending {
+		if _, err := r.store.IncrBy(ctx, counterKey(ruleID, "matched", hour), t.matched, bucketTTL); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if t.blocked > 0 {
+			if _, err := r.store.IncrBy(ctx, counterKey(ruleID, "blocked", hour), t.blocked, bucketTTL); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		// Instances flushing at the same time may briefly overwrite a
+		// newer timestamp with one a flush interval older.
+		last := strconv.FormatInt(t.last.UnixMilli(), 10)
+		if err := r.store.Set(ctx, keyPrefix+ruleID+":last", last, lastMatchedTTL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stats returns the shared counters of each rule in ruleIDs.
+func (r *Recorder) Stats(ctx context.Context, ruleIDs []string) (map[string]Stats, error) {
+	now := r.now()
+	hour := now.Truncate(bucket)
+	weight := float64(bucket-now.Sub(hour)) / float64(bucket)
+
+	out := make(map[string]Stats, len(ruleIDs))
+	for _, id := range ruleIDs {
+		var s Stats
+		for _, c := range []struct {
+			name string
+			dst  *int64
+		}{{"matched", &s.MatchedLastHour}, {"blocked", &s.BlockedLastHour}} {
+			cur, err := r.counter(ctx, counterKey(id, c.name, hour))
+			if err != nil {
+				return nil, err
+			}
+			prev, err := r.counter(ctx, counterKey(id, c.name, hour.Add(-bucket)))
+			if err != nil {
+				return nil, err
+			}
+			*c.dst = cur + int64(float64(prev)*weight)
+		}
+		last, err := r.counter(ctx, keyPrefix+id+":last")
+		if err != nil {
+			return nil, err
+		}
+		if last > 0 {
+			at := time.UnixMilli(last).UTC()
+			s.LastMatchedAt = &at
+		}
+		out[id] = s
+	}
+	return out, nil
+}
+
+func (r *Recorder) counter(ctx context.Context, key string) (int64, error) {
+	v, err := r.store.Get(ctx, key)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, _ := strconv.ParseInt(v, 10, 64)
+	return n, nil
+}
+
+func counterKey(ruleID, name string, hour time.Time) string {
+	return keyPrefix + ruleID + ":" + name + ":" + strconv.FormatInt(hour.Unix(), 10)
+}
@@ -0,0 +1,45 @@
+package rulestats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func TestRecorderStats(t *testing.T) {
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	r := NewRecorder(storage.NewMemoryStorage())
+	r.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		r.Record("r1", i < 6, now.Add(time.Duration(i)*time.Second))
+	}
+	if err := r.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	// Half way into the next hour, half of the previous hour still counts.
+	now = now.Add(90 * time.Minute)
+	r.Record("r1", true, now)
+	if err := r.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	stats, err := r.Stats(ctx, []string{"r1", "idle"})
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	got := stats["r1"]
+	if got.MatchedLastHour != 6 || got.BlockedLastHour != 2 {
+		t.Errorf("Expected 6 matched and 2 blocked, got %+v", got)
+	}
+	if got.LastMatchedAt == nil || !got.LastMatchedAt.Equal(now) {
+		t.Errorf("Expected last match at %v, got %v", now, got.LastMatchedAt)
+	}
+	if idle := stats["idle"]; idle.MatchedLastHour != 0 || idle.LastMatchedAt != nil {
+		t.Errorf("Expected empty stats for an idle rule, got %+v", idle)
+	}
+}
@@ -0,0 +1,109 @@
+// Package shed sheds low-priority traffic when a gateway instance has
+// more requests in flight to its backends than they can handle, so that
+// high-priority routes keep flowing during an overload.
+package shed
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MaxPriority is the highest shedding priority a rule can have.
+const MaxPriority = 10
+
+// Shedder tracks the requests in flight to the backends and decides which
+// new ones to shed. Requests of priority 0 are shed once Threshold are in
+// flight and those of MaxPriority only at Max, with the levels between
+// spaced evenly. A nil Shedder sheds nothing.
+type Shedder struct {
+	threshold int64
+	max       int64
+	inFlight  atomic.Int64
+
+	mu         sync.Mutex
+	total      int64
+	byPriority [MaxPriority + 1]int64
+	byRule     map[string]int64
+	last       time.Time
+}
+
+// Stats are an instance's shedding counters since it started.
+type Stats struct {
+	InFlight  int64 `json:"in_flight"`
+	Threshold int64 `json:"threshold"`
+	Max       int64 `json:"max"`
+	Shed      int64 `json:"shed"`
+	// ByPriority counts shed requests per shedding priority, and ByRule
+	// per rule ID, with "" for requests no rule matched.
+	ByPriority map[int]int64    `json:"by_priority"`
+	ByRule     map[string]int64 `json:"by_rule"`
+	LastShedAt *time.Time       `json:"last_shed_at,omitempty"`
+}
+
+// New creates a Shedder that starts shedding at threshold in-flight
+// requests, up to maxInFlight for the highest priority. maxInFlight is
+// raised to threshold if it is lower.
+func New(threshold, maxInFlight int64) *Shedder {
+	return &Shedder{threshold: threshold, max: max(threshold, maxInFlight), byRule: make(map[string]int64)}
+}
+
+// limit returns the in-flight count at which requests of priority are
+// shed.
+func (s *Shedder) limit(priority int) int64 {
+	priority = min(max(priority, 0), MaxPriority)
+	return s.threshold + (s.max-s.threshold)*int64(priority)/MaxPriority
+}
+
+// Admit reports whether a request of priority, matched by ruleID, may be
+// forwarded, counting it as shed when not.
+func (s *Shedder) Admit(ruleID string, priority int) bool {
+	if s == nil || s.inFlight.Load() < s.limit(priority) {
+		return true
+	}
+	priority = min(max(priority, 0), MaxPriority)
+	s.mu.Lock()
+	s.total++
+	s.byPriority[priority]++
+	s.byRule[ruleID]++
+	s.last = time.Now()
+	s.mu.Unlock()
+	return false
+}
+
+// Begin counts a request as in flight until the returned function is
+// called.
+func (s *Shedder) Begin() (done func()) {
+	if s == nil {
+		return func() {}
+	}
+	s.inFlight.Add(1)
+	return func() { s.inFlight.Add(-1) }
+}
+
+// Stats returns the current counters.
+func (s *Shedder) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := Stats{
+		InFlight:   s.inFlight.Load(),
+		Threshold:  s.threshold,
+		Max:        s.max,
+		Shed:       s.total,
+		ByPriority: make(map[int]int64),
+		ByRule:     make(map[string]int64, len(s.byRule)),
+	}
+	for p, n := range s.byPriority {
+		if n > 0 {
+			st.ByPriority[p] = n
+		}
+	}
+	for id, n := range s.byRule {
+		st.ByRule[id] = n
+	}
+	if !s.last.IsZero() {
+		last := s.last
+		st.LastShedAt = &last
+	}
+	return st
+}
@@ -0,0 +1,55 @@
+package shed
+
+import "testing"
+
+func TestShedderShedsLowPriorityFirst(t *testing.T) {
+	s := New(10, 20)
+	var done []func()
+	for i := 0; i < 10; i++ {
+		done = append(done, s.Begin())
+	}
+
+	if s.Admit("search", 0) {
+		t.Error("Expected priority 0 to be shed at the threshold")
+	}
+	if !s.Admit("checkout", 5) || !s.Admit("checkout", MaxPriority) {
+		t.Error("Expected higher priorities to keep flowing at the threshold")
+	}
+
+	for i := 0; i < 5; i++ {
+		done = append(done, s.Begin())
+	}
+	if s.Admit("checkout", 5) {
+		t.Error("Expected priority 5 to be shed halfway to the maximum")
+	}
+	if !s.Admit("login", MaxPriority) {
+		t.Error("Expected the top priority to flow until the maximum")
+	}
+
+	for _, d := range done {
+		d()
+	}
+	if !s.Admit("search", 0) {
+		t.Error("Expected shedding to stop once requests complete")
+	}
+
+	st := s.Stats()
+	if st.InFlight != 0 || st.Shed != 2 || st.ByPriority[0] != 1 || st.ByPriority[5] != 1 || st.ByRule["checkout"] != 1 || st.LastShedAt == nil {
+		t.Errorf("Unexpected stats %+v", st)
+	}
+}
+
+func TestNilShedder(t *testing.T) {
+	var s *Shedder
+	s.Begin()()
+	if !s.Admit("", 0) {
+		t.Error("Expected a nil shedder to admit everything")
+	}
+}
+
+func TestNewRaisesMax(t *testing.T) {
+	s := New(10, 5)
+	if s.limit(MaxPriority) != 10 || s.limit(-1) != 10 || s.limit(99) != 10 {
+		t.Errorf("Expected every limit to be the threshold, got %d", s.limit(MaxPriority))
+	}
+}
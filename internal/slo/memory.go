@@ -0,0 +1,57 @@
+package slo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store for a single instance, keeping counts in memory
+// for one window.
+type MemoryStore struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]map[time.Time]tally
+}
+
+// NewMemoryStore creates a MemoryStore keeping window of counts.
+func NewMemoryStore(window time.Duration) *MemoryStore {
+	return &MemoryStore{window: window, buckets: make(map[string]map[time.Time]tally)}
+}
+
+// AddSLO implements Store, dropping buckets older than the window.
+func (m *MemoryStore) AddSLO(_ context.Context, name string, at time.Time, total, slow int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.buckets[name]
+	if b == nil {
+		b = make(map[time.Time]tally)
+		m.buckets[name] = b
+	}
+	c := b[at]
+	c.total += total
+	c.slow += slow
+	b[at] = c
+
+	cutoff := at.Add(-m.window)
+	for start := range b {
+		if start.Before(cutoff) {
+			delete(b, start)
+		}
+	}
+	return nil
+}
+
+// SLOTotals implements Store.
+func (m *MemoryStore) SLOTotals(_ context.Context, name string, since time.Time) (total, slow int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for start, c := range m.buckets[name] {
+		if !start.Before(since.Truncate(bucket)) {
+			total += c.total
+			slow += c.slow
+		}
+	}
+	return total, slow, nil
+}
@@ -0,0 +1,356 @@
+// Package slo tracks latency objectives, such as 99% of /api/* answered
+// under 300ms, against the gateway's measured request durations, and
+// reports when an objective's error budget runs out.
+package slo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+const (
+	// DefaultWindow is the rolling period error budgets are measured over.
+	DefaultWindow = 30 * 24 * time.Hour
+	// DefaultInterval is how often counts are flushed and budgets
+	// evaluated.
+	DefaultInterval = time.Minute
+
+	// burnWindow is the recent period the burn rate is measured over.
+	burnWindow = time.Hour
+	bucket     = time.Minute
+	maxName    = 64
+)
+
+// Alert events, sent to webhooks prefixed with "slo.".
+const (
+	EventBudgetExhausted = "budget_exhausted"
+	EventBudgetRestored  = "budget_restored"
+)
+
+// SLO is a latency objective: Objective of the requests matching Pattern
+// must be answered within Threshold.
+type SLO struct {
+	Name string `json:"name"`
+	// Pattern selects requests by path, with the same syntax as rule
+	// patterns.
+	Pattern   string        `json:"pattern"`
+	Threshold time.Duration `json:"-"`
+	// Objective is the share of requests that must be fast enough, such
+	// as 0.99.
+	Objective float64 `json:"objective"`
+}
+
+// Validate reports the first problem with s.
+func (s SLO) Validate() error {
+	switch {
+	case s.Name == "" || len(s.Name) > maxName:
+		return fmt.Errorf("name must be 1 to %d characters", maxName)
+	case !strings.HasPrefix(s.Pattern, "/"):
+		return fmt.Errorf("slo %q: pattern must start with /", s.Name)
+	case s.Threshold <= 0:
+		return fmt.Errorf("slo %q: threshold must be positive", s.Name)
+	case s.Objective <= 0 || s.Objective >= 1:
+		return fmt.Errorf("slo %q: objective must be between 0%% and 100%%, exclusive", s.Name)
+	}
+	return nil
+}
+
+// Parse reads a comma-separated list of objectives, each written as
+// "name=pattern threshold objective", e.g. "api=/api/* 300ms 99%". The
+// objective is a percentage; the % sign is optional.
+func Parse(spec string) ([]SLO, error) {
+	var out []SLO
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rest, ok := strings.Cut(entry, "=")
+		fields := strings.Fields(rest)
+		if !ok || len(fields) != 3 {
+			return nil, fmt.Errorf("entries must look like name=pattern threshold objective, got %q", entry)
+		}
+		threshold, err := time.ParseDuration(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("slo %q: threshold: %w", name, err)
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(fields[2], "%"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("slo %q: objective: %w", name, err)
+		}
+		s := SLO{Name: strings.TrimSpace(name), Pattern: fields[0], Threshold: threshold, Objective: percent / 100}
+		if err := s.Validate(); err != nil {
+			return nil, err
+		}
+		if seen[s.Name] {
+			return nil, fmt.Errorf("slo %q is defined twice", s.Name)
+		}
+		seen[s.Name] = true
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// Store keeps per-minute request counts for each objective. The analytics
+// database implements it, so every instance's traffic counts towards
+// the same budget.
+type Store interface {
+	// AddSLO adds total requests, slow of which missed the threshold,
+	// to the minute starting at bucket.
+	AddSLO(ctx context.Context, name string, bucket time.Time, total, slow int64) error
+	// SLOTotals sums the counts from since onwards.
+	SLOTotals(ctx context.Context, name string, since time.Time) (total, slow int64, err error)
+}
+
+// Status is an objective's standing over the window.
+type Status struct {
+	Name        string  `json:"name"`
+	Pattern     string  `json:"pattern"`
+	ThresholdMS int64   `json:"threshold_ms"`
+	Objective   float64 `json:"objective"`
+	Window      string  `json:"window"`
+	Total       int64   `json:"total"`
+	Slow        int64   `json:"slow"`
+	// Attainment is the share of requests answered within the
+	// threshold; it is 1 without traffic.
+	Attainment float64 `json:"attainment"`
+	// BudgetRemaining is the share of the error budget left, negative
+	// once it is overspent.
+	BudgetRemaining float64 `json:"budget_remaining"`
+	// BurnRate is how fast the budget burned over the last hour, where
+	// 1 spends exactly the budget over the window.
+	BurnRate  float64 `json:"burn_rate"`
+	Exhausted bool    `json:"exhausted"`
+}
+
+// Alert reports an objective whose budget ran out or recovered.
+type Alert struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Status Status    `json:"status"`
+}
+
+// Options configures a Tracker.
+type Options struct {
+	Window time.Duration
+	// Store shares counts between instances; without one each instance
+	// tracks only its own traffic, in memory.
+	Store Store
+	// Alert is called when an evaluation finds a budget exhausted or
+	// restored.
+	Alert func(Alert)
+}
+
+type objective struct {
+	SLO
+	matcher *rules.Matcher
+}
+
+type tally struct {
+	total int64
+	slow  int64
+}
+
+type pendingKey struct {
+	name   string
+	bucket time.Time
+}
+
+// Tracker counts requests against each objective in memory and
+// periodically adds the counts to its Store, so the request path never
+// waits on the database.
+type Tracker struct {
+	objectives []objective
+	opts       Options
+	// local is set when counts are kept in memory, so each instance
+	// evaluates its own budgets.
+	local bool
+	now   func() time.Time
+
+	mu        sync.Mutex
+	pending   map[pendingKey]*tally
+	exhausted map[string]bool
+}
+
+// New creates a Tracker for slos.
+func New(slos []SLO, opts Options) *Tracker {
+	if opts.Window <= 0 {
+		opts.Window = DefaultWindow
+	}
+	local := opts.Store == nil
+	if local {
+		opts.Store = NewMemoryStore(opts.Window)
+	}
+	if opts.Alert == nil {
+		opts.Alert = func(Alert) {}
+	}
+	t := &Tracker{
+		opts:      opts,
+		local:     local,
+		now:       time.Now,
+		pending:   make(map[pendingKey]*tally),
+		exhausted: make(map[string]bool),
+	}
+	for _, s := range slos {
+		m := rules.NewMatcher([]rules.Rule{{ID: s.Name, Pattern: s.Pattern, Enabled: true}})
+		t.objectives = append(t.objectives, objective{SLO: s, matcher: m})
+	}
+	return t
+}
+
+// Record counts a request to path that took d, received at.
+func (t *Tracker) Record(path string, d time.Duration, at time.Time) {
+	if t == nil {
+		return
+	}
+	for _, o := range t.objectives {
+		if _, ok := o.matcher.Match("", path); !ok {
+			continue
+		}
+		key := pendingKey{name: o.Name, bucket: at.UTC().Truncate(bucket)}
+		t.mu.Lock()
+		c := t.pending[key]
+		if c == nil {
+			c = &tally{}
+			t.pending[key] = c
+		}
+		c.total++
+		if d > o.Threshold {
+			c.slow++
+		}
+		t.mu.Unlock()
+	}
+}
+
+// Run flushes counts every interval until ctx is cancelled, then flushes
+// once more. Without a shared store it evaluates budgets as well; with
+// one, Evaluate should be scheduled on a single instance.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if t.local {
+				if err := t.Evaluate(ctx); err != nil {
+					log.Printf("⚠️  Failed to evaluate SLOs: %v", err)
+				}
+			} else if err := t.Flush(ctx); err != nil {
+				log.Printf("⚠️  Failed to flush SLO counts: %v", err)
+			}
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			if err := t.Flush(shutdownCtx); err != nil {
+				log.Printf("⚠️  Failed to flush SLO counts: %v", err)
+			}
+			cancel()
+			return
+		}
+	}
+}
+
+// Flush adds the counts recorded since the last flush to the store.
+// Counts that fail to be written are lost rather than retried.
+func (t *Tracker) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = make(map[pendingKey]*tally, len(pending))
+	t.mu.Unlock()
+
+	var errs []error
+	for key, c := range pending {
+		if err := t.opts.Store.AddSLO(ctx, key.name, key.bucket, c.total, c.slow); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Statuses returns every objective's standing from the flushed counts.
+func (t *Tracker) Statuses(ctx context.Context) ([]Status, error) {
+	now := t.now()
+	out := make([]Status, 0, len(t.objectives))
+	for _, o := range t.objectives {
+		total, slow, err := t.opts.Store.SLOTotals(ctx, o.Name, now.Add(-t.opts.Window))
+		if err != nil {
+			return nil, fmt.Errorf("slo %q: %w", o.Name, err)
+		}
+		recentTotal, recentSlow, err := t.opts.Store.SLOTotals(ctx, o.Name, now.Add(-burnWindow))
+		if err != nil {
+			return nil, fmt.Errorf("slo %q: %w", o.Name, err)
+		}
+		out = append(out, status(o.SLO, t.opts.Window, total, slow, recentTotal, recentSlow))
+	}
+	return out, nil
+}
+
+func status(s SLO, window time.Duration, total, slow, recentTotal, recentSlow int64) Status {
+	st := Status{
+		Name:            s.Name,
+		Pattern:         s.Pattern,
+		ThresholdMS:     s.Threshold.Milliseconds(),
+		Objective:       s.Objective,
+		Window:          window.String(),
+		Total:           total,
+		Slow:            slow,
+		Attainment:      1,
+		BudgetRemaining: 1,
+	}
+	allowed := 1 - s.Objective
+	if total > 0 {
+		st.Attainment = float64(total-slow) / float64(total)
+		st.BudgetRemaining = 1 - float64(slow)/(allowed*float64(total))
+	}
+	if recentTotal > 0 {
+		st.BurnRate = float64(recentSlow) / float64(recentTotal) / allowed
+	}
+	st.Attainment = round(st.Attainment)
+	st.BudgetRemaining = round(st.BudgetRemaining)
+	st.BurnRate = round(st.BurnRate)
+	st.Exhausted = total > 0 && st.BudgetRemaining <= 0
+	return st
+}
+
+// round keeps four decimals, enough for a percentage with two.
+func round(f float64) float64 {
+	return math.Round(f*1e4) / 1e4
+}
+
+// Evaluate flushes pending counts, computes every objective's standing,
+// and alerts for budgets that ran out or recovered since the last
+// evaluation. Behind a shared store only one instance should evaluate,
+// so each change is reported once.
+func (t *Tracker) Evaluate(ctx context.Context) error {
+	if err := t.Flush(ctx); err != nil {
+		log.Printf("⚠️  Failed to flush SLO counts: %v", err)
+	}
+	statuses, err := t.Statuses(ctx)
+	if err != nil {
+		return err
+	}
+	now := t.now().UTC()
+	for _, st := range statuses {
+		t.mu.Lock()
+		was := t.exhausted[st.Name]
+		t.exhausted[st.Name] = st.Exhausted
+		t.mu.Unlock()
+		switch {
+		case st.Exhausted && !was:
+			log.Printf("⚠️  SLO %s exhausted its error budget: %.2f%% of requests under %dms", st.Name, st.Attainment*100, st.ThresholdMS)
+			t.opts.Alert(Alert{Time: now, Event: EventBudgetExhausted, Status: st})
+		case !st.Exhausted && was:
+			t.opts.Alert(Alert{Time: now, Event: EventBudgetRestored, Status: st})
+		}
+	}
+	return nil
+}
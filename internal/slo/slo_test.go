@@ -0,0 +1,100 @@
+package slo
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	got, err := Parse("api=/api/* 300ms 99%, login=/login 1s 99.9")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Parse() = %+v", got)
+	}
+	if got[0] != (SLO{Name: "api", Pattern: "/api/*", Threshold: 300 * time.Millisecond, Objective: 0.99}) {
+		t.Errorf("first SLO = %+v", got[0])
+	}
+	if got[1].Name != "login" || got[1].Threshold != time.Second {
+		t.Errorf("second SLO = %+v", got[1])
+	}
+
+	for _, spec := range []string{
+		"api=/api/* 300ms",
+		"api /api/* 300ms 99",
+		"api=/api/* fast 99",
+		"api=/api/* 300ms 100",
+		"api=api/* 300ms 99",
+		"api=/a 1s 99, api=/b 1s 99",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) accepted", spec)
+		}
+	}
+}
+
+func TestTrackerBudget(t *testing.T) {
+	var alerts []Alert
+	tr := New([]SLO{{Name: "api", Pattern: "/api/*", Threshold: 300 * time.Millisecond, Objective: 0.9}},
+		Options{Window: time.Hour, Alert: func(a Alert) { alerts = append(alerts, a) }})
+	now := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	tr.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 19; i++ {
+		tr.Record("/api/users", 100*time.Millisecond, now)
+	}
+	tr.Record("/api/users", time.Second, now)
+	tr.Record("/health", time.Second, now)
+	if err := tr.Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	st, err := tr.Statuses(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st[0].Total != 20 || st[0].Slow != 1 || st[0].Attainment != 0.95 || st[0].BudgetRemaining != 0.5 || st[0].BurnRate != 0.5 {
+		t.Errorf("status = %+v", st[0])
+	}
+	if len(alerts) != 0 {
+		t.Fatalf("alerted with budget left: %+v", alerts)
+	}
+
+	for i := 0; i < 2; i++ {
+		tr.Record("/api/users", time.Second, now)
+	}
+	if err := tr.Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].Event != EventBudgetExhausted || !alerts[0].Status.Exhausted {
+		t.Fatalf("alerts = %+v, want one exhaustion", alerts)
+	}
+
+	// Once the slow minute leaves the window the budget is restored.
+	now = now.Add(2 * time.Hour)
+	for i := 0; i < 10; i++ {
+		tr.Record("/api/users", 100*time.Millisecond, now)
+	}
+	if err := tr.Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 2 || alerts[1].Event != EventBudgetRestored {
+		t.Fatalf("alerts = %+v, want a restore", alerts)
+	}
+}
+
+func TestTrackerWithoutTraffic(t *testing.T) {
+	tr := New([]SLO{{Name: "api", Pattern: "/api/*", Threshold: time.Second, Objective: 0.99}}, Options{})
+	st, err := tr.Statuses(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st[0].Exhausted || st[0].Attainment != 1 || st[0].BudgetRemaining != 1 || st[0].Window != DefaultWindow.String() {
+		t.Errorf("status = %+v", st[0])
+	}
+}
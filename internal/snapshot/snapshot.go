@@ -0,0 +1,80 @@
+// Package snapshot keeps in-memory repositories, such as rules, ACL
+// entries and policies, in local files across restarts.
+package snapshot
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WriteFile replaces the file at path with data atomically: data is
+// written and synced to a temporary file in the same directory, which is
+// then renamed over path and the directory synced, so a crash at any
+// point leaves either the previous file or the new one.
+func WriteFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes the directory's entries, making a file created or
+// renamed in it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Run saves a repository every interval while it has unsaved changes,
+// until ctx is cancelled. changes returns the repository's change
+// counter, and save writes the snapshot and returns the counter value it
+// captured. Failures are logged under name and retried on the next tick.
+func Run(ctx context.Context, name string, interval time.Duration, changes func() uint64, save func() (uint64, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var saved uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if changes() == saved {
+				continue
+			}
+			n, err := save()
+			if err != nil {
+				log.Printf("Failed to snapshot %s: %v", name, err)
+				continue
+			}
+			saved = n
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWriteFileReplacesAtomically(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.json")
+
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFile(path, []byte(content)); err != nil {
+			t.Fatalf("WriteFile(%s) error = %v", content, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != content {
+			t.Errorf("Read back %q, %v; want %q", data, err, content)
+		}
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files left behind, got %v", entries)
+	}
+}
+
+func TestWriteFileMissingDirectory(t *testing.T) {
+	if err := WriteFile(filepath.Join(t.TempDir(), "missing", "rules.json"), []byte("x")); err == nil {
+		t.Error("Expected an error writing into a missing directory")
+	}
+}
+
+func TestRunSavesOnlyPendingChanges(t *testing.T) {
+	var changes, saves atomic.Uint64
+	var fail atomic.Bool
+	fail.Store(true)
+	save := func() (uint64, error) {
+		saves.Add(1)
+		if fail.Load() {
+			return 0, errors.New("disk full")
+		}
+		return changes.Load(), nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, "rules", time.Millisecond, changes.Load, save)
+		close(done)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if saves.Load() != 0 {
+		t.Errorf("Expected no saves without changes, got %d", saves.Load())
+	}
+
+	// Failed saves are retried until one succeeds, then nothing is
+	// pending.
+	changes.Store(1)
+	waitFor(t, func() bool { return saves.Load() >= 2 })
+	fail.Store(false)
+	waitFor(t, func() bool { return saves.Load() >= 3 })
+	time.Sleep(20 * time.Millisecond)
+	settled := saves.Load()
+	time.Sleep(20 * time.Millisecond)
+	if saves.Load() != settled {
+		t.Errorf("Expected saving to stop once changes are saved, got %d then %d saves", settled, saves.Load())
+	}
+
+	cancel()
+	<-done
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
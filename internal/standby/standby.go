@@ -0,0 +1,303 @@
+// Package standby runs an instance as a warm standby of a primary
+// gateway: it mirrors the primary's configuration through the management
+// API and holds back proxy traffic until it is promoted.
+package standby
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/acl"
+	"github.com/Siruyy/gatify/internal/ban"
+	"github.com/Siruyy/gatify/internal/policy"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// DefaultInterval is how often a standby syncs from its primary.
+const DefaultInterval = 15 * time.Second
+
+// maxResponseBytes caps each response read from the primary.
+const maxResponseBytes = 16 << 20
+
+// Options configures a Syncer.
+type Options struct {
+	// Primary is the primary gateway's base URL, e.g.
+	// "http://gatify-a:8080".
+	Primary string
+	// Token is a bearer token the primary's management API accepts; a
+	// read-only one is enough.
+	Token    string
+	Interval time.Duration
+	Client   *http.Client
+
+	Rules    *rules.InMemoryRepository
+	ACL      *acl.InMemoryRepository
+	Policies *policy.InMemoryRepository
+	// Bans, when set, mirrors the primary's bans, for a standby that does
+	// not share the primary's storage.
+	Bans *ban.Store
+	// Applied runs after a sync changed the rules or policies, and
+	// ACLChanged after it changed the ACL, to reload the proxy.
+	Applied    func(ctx context.Context)
+	ACLChanged func(ctx context.Context)
+}
+
+// Status is a standby's state as reported by the admin API.
+type Status struct {
+	Standby    bool      `json:"standby"`
+	Primary    string    `json:"primary"`
+	LastSync   time.Time `json:"last_sync,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+	Rules      int       `json:"rules"`
+	ACLEntries int       `json:"acl_entries"`
+	Policies   int       `json:"policies"`
+	Bans       int       `json:"bans"`
+	PromotedAt time.Time `json:"promoted_at,omitempty"`
+}
+
+// Syncer mirrors a primary's rules, ACL, policies and bans into the local
+// repositories until it is promoted. The emergency throttle lives in
+// shared storage and needs no syncing.
+type Syncer struct {
+	opts     Options
+	standby  atomic.Bool
+	promoted chan struct{}
+	once     sync.Once
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New creates a Syncer in standby.
+func New(opts Options) *Syncer {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.Applied == nil {
+		opts.Applied = func(context.Context) {}
+	}
+	if opts.ACLChanged == nil {
+		opts.ACLChanged = func(context.Context) {}
+	}
+	opts.Primary = strings.TrimSuffix(opts.Primary, "/")
+	s := &Syncer{
+		opts:     opts,
+		promoted: make(chan struct{}),
+		status:   Status{Standby: true, Primary: opts.Primary},
+	}
+	s.standby.Store(true)
+	return s
+}
+
+// Standby reports whether the instance is still a standby. A nil
+// *Syncer is never one.
+func (s *Syncer) Standby() bool {
+	return s != nil && s.standby.Load()
+}
+
+// Promote makes the instance serve traffic and stops syncing. It reports
+// false when the instance was already promoted.
+func (s *Syncer) Promote() bool {
+	promoted := false
+	s.once.Do(func() {
+		s.standby.Store(false)
+		s.mu.Lock()
+		s.status.Standby = false
+		s.status.PromotedAt = time.Now().UTC()
+		s.mu.Unlock()
+		close(s.promoted)
+		promoted = true
+	})
+	return promoted
+}
+
+// Status returns the standby's state.
+func (s *Syncer) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Run syncs from the primary every interval until the instance is
+// promoted or ctx is cancelled.
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Sync(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("⚠️  Failed to sync from primary %s: %v", s.opts.Primary, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.promoted:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync copies the primary's current rules, ACL, policies and bans.
+// Nothing is applied unless all of them were read, so a partial failure
+// never leaves rules pointing at policies that were not synced, or a
+// client banned on the primary let in by the standby.
+func (s *Syncer) Sync(ctx context.Context) error {
+	var (
+		entries    []acl.Entry
+		policyList []policy.Policy
+		bans       []ban.Ban
+	)
+	ruleList, err := s.fetchRules(ctx)
+	if err == nil {
+		err = s.fetch(ctx, "/api/acl", &entries)
+	}
+	if err == nil {
+		err = s.fetch(ctx, "/api/policies", &policyList)
+	}
+	if err == nil && s.opts.Bans != nil {
+		err = s.fetch(ctx, "/api/bans", &bans)
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.status.LastError = err.Error()
+		s.mu.Unlock()
+		return err
+	}
+	if !s.Standby() {
+		// Promoted while fetching: the instance owns its configuration now.
+		return nil
+	}
+
+	// Bans go first: they are the only step that can fail, and the rest
+	// is then left untouched.
+	if _, err := s.opts.Bans.Replace(ctx, bans); err != nil {
+		err = fmt.Errorf("apply bans: %w", err)
+		s.mu.Lock()
+		s.status.LastError = err.Error()
+		s.mu.Unlock()
+		return err
+	}
+	policiesChanged := s.opts.Policies.Replace(policyList)
+	rulesChanged := s.opts.Rules.Replace(ruleList)
+	if policiesChanged || rulesChanged {
+		s.opts.Applied(ctx)
+	}
+	if s.opts.ACL.Replace(entries) {
+		s.opts.ACLChanged(ctx)
+	}
+
+	s.mu.Lock()
+	s.status.LastSync = time.Now().UTC()
+	s.status.LastError = ""
+	s.status.Rules = len(ruleList)
+	s.status.ACLEntries = len(entries)
+	s.status.Policies = len(policyList)
+	s.status.Bans = len(bans)
+	s.mu.Unlock()
+	return nil
+}
+
+// fetchRules reads the primary's rules. The request declares this
+// build's rule schema, so a primary using fields it does not know refuses
+// rather than have the standby enforce its rules without them. Fields a
+// newer primary adds but no rule uses are skipped.
+func (s *Syncer) fetchRules(ctx context.Context) ([]rules.Rule, error) {
+	body, header, err := s.get(ctx, "/api/rules")
+	if err != nil {
+		return nil, err
+	}
+	version, err := rules.ParseSchemaVersion(header.Get(rules.SchemaHeader))
+	if err != nil {
+		return nil, fmt.Errorf("GET /api/rules: %w", err)
+	}
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("GET /api/rules: %w", err)
+	}
+	list := make([]rules.Rule, len(raw))
+	for i, fields := range raw {
+		// The live counters listed with each rule are not part of it.
+		delete(fields, "stats")
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return nil, fmt.Errorf("GET /api/rules: %w", err)
+		}
+		ignored, err := rules.DecodeRule(data, version, &list[i])
+		if err != nil {
+			return nil, fmt.Errorf("GET /api/rules: rule %d: %w", i, err)
+		}
+		if len(ignored) > 0 {
+			log.Printf("⚠️  Rule %q from primary: ignoring fields from schema version %d: %s", list[i].ID, version, strings.Join(ignored, ", "))
+		}
+	}
+	return list, nil
+}
+
+func (s *Syncer) fetch(ctx context.Context, path string, v any) error {
+	body, _, err := s.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("GET %s: %w", path, err)
+	}
+	return nil
+}
+
+func (s *Syncer) get(ctx context.Context, path string) ([]byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.opts.Primary+path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.opts.Token)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(rules.SchemaHeader, strconv.Itoa(rules.SchemaVersion))
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, nil, fmt.Errorf("GET %s: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return nil, nil, fmt.Errorf("GET %s: primary answered %s: %s", path, resp.Status, apiErr.Error)
+		}
+		return nil, nil, fmt.Errorf("GET %s: primary answered %s", path, resp.Status)
+	}
+	return body, resp.Header, nil
+}
+
+// Gate answers requests with 503 while the instance is a standby and
+// passes them to next once it is promoted.
+func (s *Syncer) Gate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Standby() {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":"standby instance, not serving traffic"}` + "\n"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,216 @@
+package standby
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/acl"
+	"github.com/Siruyy/gatify/internal/ban"
+	"github.com/Siruyy/gatify/internal/policy"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+func newPrimary(t *testing.T, rulesJSON string) *httptest.Server {
+	t.Helper()
+	responses := map[string]string{
+		"/api/rules":    rulesJSON,
+		"/api/acl":      `[{"id":"a1","cidr":"10.0.0.0/8","action":"deny","updated_at":"2026-01-01T00:00:00Z"}]`,
+		"/api/policies": `[{"name":"standard","limit":100,"window_seconds":60,"updated_at":"2026-01-01T00:00:00Z"}]`,
+		"/api/bans":     `[{"client":"10.0.0.7","reason":"honeypot","banned_at":"2026-01-01T00:00:00Z","expires_at":"2099-01-01T00:00:00Z"}]`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestSyncer(primary, token string, applied *atomic.Int32) (*Syncer, *rules.InMemoryRepository, *acl.InMemoryRepository) {
+	ruleRepo, aclRepo := rules.NewInMemoryRepository(), acl.NewInMemoryRepository()
+	s := New(Options{
+		Primary:  primary + "/",
+		Token:    token,
+		Rules:    ruleRepo,
+		ACL:      aclRepo,
+		Policies: policy.NewInMemoryRepository(),
+		Bans:     ban.New(storage.NewMemoryStorage()),
+		Applied:  func(context.Context) { applied.Add(1) },
+	})
+	return s, ruleRepo, aclRepo
+}
+
+func TestSyncMirrorsPrimary(t *testing.T) {
+	primary := newPrimary(t, `[{"id":"r1","name":"users","pattern":"/api/*","limit":10,"window_seconds":60,"revision":2,"enabled":true,"stats":{"matched":5}}]`)
+	var applied atomic.Int32
+	s, ruleRepo, aclRepo := newTestSyncer(primary.URL, "secret", &applied)
+	ctx := context.Background()
+
+	if err := s.Sync(ctx); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if rule, err := ruleRepo.Get(ctx, "r1"); err != nil || rule.Revision != 2 {
+		t.Errorf("Expected the primary's rule, got %+v, %v", rule, err)
+	}
+	if entries, _ := aclRepo.List(ctx); len(entries) != 1 || entries[0].ID != "a1" {
+		t.Errorf("Expected the primary's ACL, got %+v", entries)
+	}
+	if reason, banned, err := s.opts.Bans.Banned(ctx, "10.0.0.7"); err != nil || !banned || reason != "honeypot" {
+		t.Errorf("Expected the primary's ban, got %q, %v, %v", reason, banned, err)
+	}
+	status := s.Status()
+	if status.Rules != 1 || status.ACLEntries != 1 || status.Policies != 1 || status.Bans != 1 || status.LastSync.IsZero() {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	s.Sync(ctx)
+	if applied.Load() != 1 {
+		t.Errorf("Expected only the first sync to reload rules, got %d reloads", applied.Load())
+	}
+}
+
+func TestSyncBansAppliedWithTheRest(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/rules":
+			w.Write([]byte(`[{"id":"r1","name":"users","pattern":"/api/*","limit":10,"window_seconds":60,"enabled":true}]`))
+		case "/api/bans":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`[]`))
+		}
+	}))
+	t.Cleanup(primary.Close)
+	var applied atomic.Int32
+	s, ruleRepo, _ := newTestSyncer(primary.URL, "secret", &applied)
+	ctx := context.Background()
+	if err := s.opts.Bans.Ban(ctx, "10.0.0.8", "honeypot", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Sync(ctx); err == nil {
+		t.Fatal("Expected the sync to fail when the bans cannot be read")
+	}
+	if list, _ := ruleRepo.List(ctx); len(list) != 0 || applied.Load() != 0 {
+		t.Errorf("Expected no rules applied without the bans, got %+v", list)
+	}
+	if _, banned, _ := s.opts.Bans.Banned(ctx, "10.0.0.8"); !banned {
+		t.Error("Expected the standby's bans to be kept")
+	}
+}
+
+func TestSyncLiftsBansLiftedOnPrimary(t *testing.T) {
+	primary := newPrimary(t, `[]`)
+	var applied atomic.Int32
+	s, _, _ := newTestSyncer(primary.URL, "secret", &applied)
+	ctx := context.Background()
+	if err := s.opts.Bans.Ban(ctx, "10.0.0.8", "honeypot", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Sync(ctx); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if _, banned, _ := s.opts.Bans.Banned(ctx, "10.0.0.8"); banned {
+		t.Error("Expected a ban the primary does not have to be lifted")
+	}
+	if _, banned, _ := s.opts.Bans.Banned(ctx, "10.0.0.7"); !banned {
+		t.Error("Expected the primary's ban")
+	}
+}
+
+func TestSyncFromNewerPrimary(t *testing.T) {
+	var declared string
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/rules":
+			declared = r.Header.Get(rules.SchemaHeader)
+			w.Header().Set(rules.SchemaHeader, "99")
+			w.Write([]byte(`[{"id":"r1","name":"users","pattern":"/api/*","limit":10,"window_seconds":60,"enabled":true,"labels":["x"],"stats":{"matched":5}}]`))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	}))
+	t.Cleanup(primary.Close)
+	var applied atomic.Int32
+	s, ruleRepo, _ := newTestSyncer(primary.URL, "secret", &applied)
+	ctx := context.Background()
+
+	if err := s.Sync(ctx); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if declared != strconv.Itoa(rules.SchemaVersion) {
+		t.Errorf("Expected the standby to declare schema version %d, got %q", rules.SchemaVersion, declared)
+	}
+	if rule, err := ruleRepo.Get(ctx, "r1"); err != nil || rule.Limit != 10 {
+		t.Errorf("Expected the primary's rule, got %+v, %v", rule, err)
+	}
+}
+
+func TestSyncRejectsUnknownFieldsFromSameSchema(t *testing.T) {
+	primary := newPrimary(t, `[{"id":"r1","name":"users","pattern":"/api/*","limit":10,"window_seconds":60,"enabled":true,"labels":["x"]}]`)
+	var applied atomic.Int32
+	s, ruleRepo, _ := newTestSyncer(primary.URL, "secret", &applied)
+
+	if err := s.Sync(context.Background()); err == nil {
+		t.Fatal("Expected an unknown field from a primary at the same schema version to fail the sync")
+	}
+	if list, _ := ruleRepo.List(context.Background()); len(list) != 0 {
+		t.Errorf("Expected no rules to be applied, got %+v", list)
+	}
+}
+
+func TestSyncFailureKeepsConfiguration(t *testing.T) {
+	primary := newPrimary(t, `[]`)
+	var applied atomic.Int32
+	s, ruleRepo, _ := newTestSyncer(primary.URL, "wrong", &applied)
+	ctx := context.Background()
+	ruleRepo.Create(ctx, rules.Rule{Name: "local", Pattern: "/", Limit: 1, WindowSeconds: 1})
+
+	if err := s.Sync(ctx); err == nil {
+		t.Fatal("Expected an unauthorized sync to fail")
+	}
+	if list, _ := ruleRepo.List(ctx); len(list) != 1 || applied.Load() != 0 {
+		t.Errorf("Expected the rules to be left alone, got %d rules and %d reloads", len(list), applied.Load())
+	}
+	if s.Status().LastError == "" {
+		t.Error("Expected the status to report the error")
+	}
+}
+
+func TestGateHoldsTrafficUntilPromoted(t *testing.T) {
+	var applied atomic.Int32
+	s, _, _ := newTestSyncer("http://primary", "secret", &applied)
+	h := s.Gate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected a standby to answer 503, got %d", w.Code)
+	}
+
+	if !s.Promote() || s.Promote() {
+		t.Fatal("Expected only the first promotion to report true")
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected a promoted instance to serve traffic, got %d", w.Code)
+	}
+}
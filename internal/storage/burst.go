@@ -0,0 +1,29 @@
+package storage
+
+import "context"
+
+type burstKey struct{}
+
+// WithBurst returns a context whose SlidingWindow calls tolerate up to
+// burst hits above the limit. The allowance is only spent by hits over
+// the limit and refills once a key has stayed within its limit for a
+// whole window, so it absorbs short spikes without raising the sustained
+// rate.
+func WithBurst(ctx context.Context, burst int64) context.Context {
+	return context.WithValue(ctx, burstKey{}, burst)
+}
+
+// BurstFrom returns the burst allowance of rate limiting calls made with
+// ctx, zero when there is none.
+func BurstFrom(ctx context.Context) int64 {
+	if burst, ok := ctx.Value(burstKey{}).(int64); ok && burst > 0 {
+		return burst
+	}
+	return 0
+}
+
+// burstPoolKey holds the part of key's burst allowance in use. It shares
+// key's hash tag, so Redis keeps both in the same slot.
+func burstPoolKey(key string) string {
+	return key + ":burst"
+}
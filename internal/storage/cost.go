@@ -0,0 +1,20 @@
+package storage
+
+import "context"
+
+type costKey struct{}
+
+// WithCost returns a context whose rate limiting calls charge cost hits
+// instead of one, so an expensive request uses up more of the client's
+// budget. Costs below one count as one.
+func WithCost(ctx context.Context, cost int64) context.Context {
+	return context.WithValue(ctx, costKey{}, cost)
+}
+
+// CostFrom returns the hits a rate limiting call made with ctx charges.
+func CostFrom(ctx context.Context) int64 {
+	if cost, ok := ctx.Value(costKey{}).(int64); ok && cost > 1 {
+		return cost
+	}
+	return 1
+}
@@ -0,0 +1,21 @@
+package storage
+
+import "context"
+
+type indexCtxKey struct{}
+
+// WithIndex returns a context whose IncrBy and Set calls with a positive
+// ttl track the key in index, the way limiter counters are tracked in their
+// scope index. It lets counters outside a scope's key prefix, such as a rule's
+// in-flight and quota counters, be cleared by the same DeleteIndexed. The
+// counter must share index's hash tag so Redis keeps both in one slot.
+func WithIndex(ctx context.Context, index string) context.Context {
+	return context.WithValue(ctx, indexCtxKey{}, index)
+}
+
+// IndexFrom returns the index that counters written with ctx are tracked
+// in, or "" when there is none.
+func IndexFrom(ctx context.Context) string {
+	index, _ := ctx.Value(indexCtxKey{}).(string)
+	return index
+}
@@ -0,0 +1,486 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval is how often writes purge expired keys, so
+// identities that never come back do not accumulate.
+const memorySweepInterval = time.Minute
+
+type memoryEntry struct {
+	value   string
+	expires time.Time // zero means no expiry
+}
+
+func (e memoryEntry) live(now time.Time) bool {
+	return e.expires.IsZero() || now.Before(e.expires)
+}
+
+// MemoryStorage is a Storage held in process memory. It implements the same
+// algorithms as RedisStorage but its state is neither shared between
+// instances nor kept across restarts, so it suits development and
+// single-node deployments only.
+type MemoryStorage struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	indexes   map[string]map[string]time.Time // index -> member -> expiry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStorage creates an empty in-memory storage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		entries: make(map[string]memoryEntry),
+		indexes: make(map[string]map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// SlidingWindow implements Storage.
+func (s *MemoryStorage) SlidingWindow(ctx context.Context, key string, limit int64, window time.Duration) (WindowResult, error) {
+	cost := float64(CostFrom(ctx))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	start, weight := windowBounds(now, window)
+	current := key + ":" + strconv.FormatInt(start.UnixMilli(), 10)
+	previous := key + ":" + strconv.FormatInt(start.Add(-window).UnixMilli(), 10)
+	cur := s.number(current, now)
+	prev := s.number(previous, now)
+
+	burst := float64(BurstFrom(ctx))
+	pool := burstPoolKey(key)
+	var used float64
+	if burst > 0 {
+		used = s.number(pool, now)
+	}
+
+	estimated := prev*weight + cur
+	if estimated+cost > float64(limit) {
+		if used+cost > burst {
+			return WindowResult{Count: int64(estimated), ResetAt: start.Add(window), BurstRemaining: int64(burst - used)}, nil
+		}
+		// Hits over the limit are charged to the burst pool only, which
+		// expires a window after it was last drawn on.
+		used += cost
+		s.write(key, pool, strconv.FormatInt(int64(used), 10), now, window)
+		return WindowResult{Allowed: true, Count: limit, ResetAt: start.Add(window), BurstRemaining: int64(burst - used)}, nil
+	}
+
+	ttl := 2 * window
+	s.write(key, current, strconv.FormatInt(int64(cur+cost), 10), now, ttl)
+	return WindowResult{
+		Allowed:        true,
+		Count:          int64(prev*weight + cur + cost),
+		ResetAt:        start.Add(window),
+		BurstRemaining: int64(burst - used),
+	}, nil
+}
+
+// GCRA implements Storage.
+func (s *MemoryStorage) GCRA(ctx context.Context, key string, limit int64, window time.Duration) (WindowResult, error) {
+	cost := float64(CostFrom(ctx))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	nowMS := float64(now.UnixMilli())
+	interval := float64(window.Milliseconds()) / float64(limit)
+
+	tat := math.Max(s.number(key, now), nowMS)
+	newTAT := tat + interval*cost
+	allowAt := newTAT - interval*float64(limit)
+	if nowMS < allowAt {
+		// The request fits once enough of the bucket has drained, well
+		// before it is empty.
+		return WindowResult{
+			Count:   limit,
+			ResetAt: now.Add(msDuration(allowAt - nowMS)),
+		}, nil
+	}
+
+	ttl := msDuration(newTAT - nowMS)
+	s.write(key, key, strconv.FormatFloat(newTAT, 'f', 3, 64), now, ttl)
+	return WindowResult{
+		Allowed: true,
+		Count:   limit - int64(math.Floor((nowMS-allowAt)/interval)),
+		ResetAt: now.Add(ttl),
+	}, nil
+}
+
+// LeakyBucket implements Storage.
+func (s *MemoryStorage) LeakyBucket(ctx context.Context, key string, limit int64, window, maxDelay time.Duration) (WindowResult, error) {
+	cost := float64(CostFrom(ctx))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	nowMS := float64(now.UnixMilli())
+	interval := float64(window.Milliseconds()) / float64(limit)
+	maxWait := float64(maxDelay.Milliseconds())
+	slotKey := key + ":leaky"
+
+	slot := math.Max(s.number(slotKey, now), nowMS)
+	wait := slot - nowMS
+	if wait > maxWait {
+		return WindowResult{
+			Count:   limit,
+			ResetAt: now.Add(msDuration(wait - maxWait)),
+		}, nil
+	}
+
+	ttl := msDuration(slot + interval*cost - nowMS)
+	s.write(key, slotKey, strconv.FormatFloat(slot+interval*cost, 'f', 3, 64), now, ttl)
+	count := limit - int64(math.Floor((maxWait-wait)/interval))
+	if count < 0 {
+		count = 0
+	}
+	return WindowResult{
+		Allowed: true,
+		Count:   count,
+		ResetAt: now.Add(ttl),
+		Wait:    msDuration(wait),
+	}, nil
+}
+
+// SlidingLog implements Storage. The log is kept at key+":log" as the
+// hit times in milliseconds, oldest first.
+func (s *MemoryStorage) SlidingLog(ctx context.Context, key string, limit int64, window time.Duration) (WindowResult, error) {
+	cost := CostFrom(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	nowMS := now.UnixMilli()
+	logKey := key + ":log"
+	var hits []int64
+	if e, ok := s.entries[logKey]; ok && e.live(now) {
+		for _, f := range strings.Fields(e.value) {
+			ms, _ := strconv.ParseInt(f, 10, 64)
+			if ms > nowMS-window.Milliseconds() {
+				hits = append(hits, ms)
+			}
+		}
+	}
+
+	if int64(len(hits))+cost > limit {
+		reset := now.Add(window)
+		if len(hits) > 0 {
+			reset = time.UnixMilli(hits[0]).Add(window)
+		}
+		return WindowResult{Count: int64(len(hits)), ResetAt: reset}, nil
+	}
+
+	for i := int64(0); i < cost; i++ {
+		hits = append(hits, nowMS)
+	}
+	fields := make([]string, len(hits))
+	for i, ms := range hits {
+		fields[i] = strconv.FormatInt(ms, 10)
+	}
+	s.write(key, logKey, strings.Join(fields, " "), now, window)
+	return WindowResult{
+		Allowed: true,
+		Count:   int64(len(hits)),
+		ResetAt: time.UnixMilli(hits[0]).Add(window),
+	}, nil
+}
+
+// Get implements Storage.
+func (s *MemoryStorage) Get(_ context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || !e.live(s.now()) {
+		return "", ErrKeyNotFound
+	}
+	return e.value, nil
+}
+
+// Set implements Storage.
+func (s *MemoryStorage) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.set(key, value, now, ttl)
+	if index := IndexFrom(ctx); index != "" && ttl > 0 {
+		s.track(index, key, now.Add(ttl))
+	}
+	return nil
+}
+
+// IncrBy implements Storage.
+func (s *MemoryStorage) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	e, ok := s.entries[key]
+	if !ok || !e.live(now) {
+		e = memoryEntry{}
+	}
+	n, _ := strconv.ParseInt(e.value, 10, 64)
+	n += delta
+	e.value = strconv.FormatInt(n, 10)
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+	s.entries[key] = e
+	if index := IndexFrom(ctx); index != "" && ttl > 0 {
+		s.track(index, key, e.expires)
+	}
+	s.sweep(now)
+	return n, nil
+}
+
+// Delete implements Storage.
+func (s *MemoryStorage) Delete(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.entries, key)
+		delete(s.indexes, key)
+	}
+	return nil
+}
+
+// DeleteIndexed implements Storage.
+func (s *MemoryStorage) DeleteIndexed(_ context.Context, index string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := s.indexes[index]
+	for key := range members {
+		delete(s.entries, key)
+	}
+	delete(s.indexes, index)
+	return int64(len(members)), nil
+}
+
+// GetIndexed implements Storage.
+func (s *MemoryStorage) GetIndexed(_ context.Context, index string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	out := make(map[string]string)
+	for key := range s.indexes[index] {
+		if e, ok := s.entries[key]; ok && e.live(now) {
+			out[key] = e.value
+		} else {
+			delete(s.indexes[index], key)
+		}
+	}
+	return out, nil
+}
+
+// SetNX implements Storage.
+func (s *MemoryStorage) SetNX(_ context.Context, key, value string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if e, ok := s.entries[key]; ok && e.live(now) {
+		return false, nil
+	}
+	s.set(key, value, now, ttl)
+	return true, nil
+}
+
+// CompareAndExpire implements Storage.
+func (s *MemoryStorage) CompareAndExpire(_ context.Context, key, value string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	e, ok := s.entries[key]
+	if !ok || !e.live(now) || e.value != value {
+		return false, nil
+	}
+	s.set(key, value, now, ttl)
+	return true, nil
+}
+
+// CompareAndDelete implements Storage.
+func (s *MemoryStorage) CompareAndDelete(_ context.Context, key, value string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || !e.live(s.now()) || e.value != value {
+		return false, nil
+	}
+	delete(s.entries, key)
+	return true, nil
+}
+
+// ScanKeys implements Mover.
+func (s *MemoryStorage) ScanKeys(_ context.Context, pattern string, fn func(key string) error) error {
+	match, err := globRegexp(pattern)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	now := s.now()
+	var keys []string
+	for key, e := range s.entries {
+		if match.MatchString(key) && e.live(now) {
+			keys = append(keys, key)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, key := range keys {
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// globRegexp translates a Redis glob into a regular expression. Unlike
+// path.Match, * and ? match any character, including "/".
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString(`^(?s:`)
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			b.WriteString("[" + pattern[i+1:i+1+end] + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString(`)$`)
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// RenameKey implements Mover.
+func (s *MemoryStorage) RenameKey(_ context.Context, from, to string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	e, ok := s.entries[from]
+	if !ok || !e.live(now) {
+		return false, nil
+	}
+	if existing, ok := s.entries[to]; ok && existing.live(now) {
+		return false, nil
+	}
+	delete(s.entries, from)
+	if e.expires.IsZero() {
+		s.set(to, e.value, now, 0)
+	} else {
+		s.write(to, to, e.value, now, e.expires.Sub(now))
+	}
+	return true, nil
+}
+
+// Ping implements Storage. Memory is always reachable.
+func (s *MemoryStorage) Ping(context.Context) error {
+	return nil
+}
+
+// Close implements Storage.
+func (s *MemoryStorage) Close() error {
+	return nil
+}
+
+// number returns the live numeric value at key, or 0.
+func (s *MemoryStorage) number(key string, now time.Time) float64 {
+	e, ok := s.entries[key]
+	if !ok || !e.live(now) {
+		return 0
+	}
+	n, _ := strconv.ParseFloat(e.value, 64)
+	return n
+}
+
+// write stores a counter for scopeKey's limiter state at key and tracks it
+// in the scope index, like trackKey does in Redis.
+func (s *MemoryStorage) write(scopeKey, key, value string, now time.Time, ttl time.Duration) {
+	s.set(key, value, now, ttl)
+	if index, ok := IndexKey(scopeKey); ok {
+		s.track(index, key, now.Add(ttl))
+	}
+}
+
+// track records key in index until it expires.
+func (s *MemoryStorage) track(index, key string, expires time.Time) {
+	members := s.indexes[index]
+	if members == nil {
+		members = make(map[string]time.Time)
+		s.indexes[index] = members
+	}
+	members[key] = expires
+}
+
+func (s *MemoryStorage) set(key, value string, now time.Time, ttl time.Duration) {
+	e := memoryEntry{value: value}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+	s.entries[key] = e
+	s.sweep(now)
+}
+
+// sweep drops expired keys and index members at most once per
+// memorySweepInterval.
+func (s *MemoryStorage) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memorySweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if !e.live(now) {
+			delete(s.entries, key)
+		}
+	}
+	for index, members := range s.indexes {
+		for key, expires := range members {
+			if !now.Before(expires) {
+				delete(members, key)
+			}
+		}
+		if len(members) == 0 {
+			delete(s.indexes, index)
+		}
+	}
+}
+
+func msDuration(ms float64) time.Duration {
+	return time.Duration(math.Ceil(ms)) * time.Millisecond
+}
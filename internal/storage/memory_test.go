@@ -0,0 +1,341 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestMemory(now *time.Time) *MemoryStorage {
+	s := NewMemoryStorage()
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func TestMemorySlidingWindow(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestMemory(&now)
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		res, err := s.SlidingWindow(ctx, "k", 3, time.Minute)
+		if err != nil || !res.Allowed || res.Count != int64(i) {
+			t.Fatalf("Request %d: got %+v, %v", i, res, err)
+		}
+	}
+	if res, _ := s.SlidingWindow(ctx, "k", 3, time.Minute); res.Allowed {
+		t.Fatal("Expected fourth request to be rejected")
+	}
+
+	// Half way into the next window, half of the previous window's hits
+	// still count.
+	now = now.Add(90 * time.Second)
+	res, _ := s.SlidingWindow(ctx, "k", 3, time.Minute)
+	if !res.Allowed || res.Count != 2 {
+		t.Errorf("Expected weighted count 2 after sliding, got %+v", res)
+	}
+}
+
+func TestMemorySlidingWindowBurst(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestMemory(&now)
+	ctx := WithBurst(context.Background(), 2)
+
+	for i, want := range []int64{2, 2, 2, 1, 0} {
+		res, err := s.SlidingWindow(ctx, "k", 3, time.Minute)
+		if err != nil || !res.Allowed || res.BurstRemaining != want {
+			t.Fatalf("Request %d: expected allowed with %d burst left, got %+v, %v", i+1, want, res, err)
+		}
+	}
+	if res, _ := s.SlidingWindow(ctx, "k", 3, time.Minute); res.Allowed || res.BurstRemaining != 0 {
+		t.Fatalf("Expected the burst to be spent, got %+v", res)
+	}
+
+	// Burst hits are not counted against the limit, and the allowance
+	// comes back once the client has kept within it for a window.
+	now = now.Add(2 * time.Minute)
+	res, _ := s.SlidingWindow(ctx, "k", 3, time.Minute)
+	if !res.Allowed || res.Count != 1 || res.BurstRemaining != 2 {
+		t.Errorf("Expected a fresh window and burst, got %+v", res)
+	}
+}
+
+func TestMemoryGCRA(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestMemory(&now)
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		res, err := s.GCRA(ctx, "k", 3, time.Minute)
+		if err != nil || !res.Allowed || res.Count != int64(i) {
+			t.Fatalf("Request %d: got %+v, %v", i, res, err)
+		}
+	}
+	res, _ := s.GCRA(ctx, "k", 3, time.Minute)
+	if res.Allowed {
+		t.Fatal("Expected burst beyond the limit to be rejected")
+	}
+	if wait := res.ResetAt.Sub(now); wait != 20*time.Second {
+		t.Errorf("Expected a retry after one emission interval, got %v", wait)
+	}
+
+	now = now.Add(20 * time.Second)
+	if res, _ := s.GCRA(ctx, "k", 3, time.Minute); !res.Allowed {
+		t.Error("Expected one emission interval to free a slot")
+	}
+}
+
+func TestMemoryLeakyBucket(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestMemory(&now)
+	ctx := context.Background()
+
+	first, _ := s.LeakyBucket(ctx, "k", 60, time.Minute, 1500*time.Millisecond)
+	second, _ := s.LeakyBucket(ctx, "k", 60, time.Minute, 1500*time.Millisecond)
+	third, _ := s.LeakyBucket(ctx, "k", 60, time.Minute, 1500*time.Millisecond)
+
+	if !first.Allowed || first.Wait != 0 {
+		t.Errorf("Expected first request served at once, got %+v", first)
+	}
+	if !second.Allowed || second.Wait != time.Second {
+		t.Errorf("Expected second request queued for 1s, got %+v", second)
+	}
+	if third.Allowed {
+		t.Errorf("Expected request beyond the queue rejected, got %+v", third)
+	}
+}
+
+func TestMemorySlidingLog(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestMemory(&now)
+	ctx := context.Background()
+
+	// A burst at the end of one minute...
+	now = now.Add(50 * time.Second)
+	for i := 1; i <= 3; i++ {
+		res, err := s.SlidingLog(ctx, "k", 3, time.Minute)
+		if err != nil || !res.Allowed || res.Count != int64(i) {
+			t.Fatalf("Request %d: got %+v, %v", i, res, err)
+		}
+	}
+	// ...still counts in full at the start of the next, where the
+	// weighted counter would let more through.
+	now = now.Add(20 * time.Second)
+	res, _ := s.SlidingLog(ctx, "k", 3, time.Minute)
+	if res.Allowed || res.Count != 3 || !res.ResetAt.Equal(now.Add(40*time.Second)) {
+		t.Fatalf("Expected rejection until the burst leaves the window, got %+v", res)
+	}
+
+	now = now.Add(40 * time.Second)
+	if res, _ := s.SlidingLog(ctx, "k", 3, time.Minute); !res.Allowed || res.Count != 1 {
+		t.Errorf("Expected the log to empty once the window passed, got %+v", res)
+	}
+}
+
+func TestMemoryChargesCost(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestMemory(&now)
+	ctx := WithCost(context.Background(), 4)
+
+	res, err := s.SlidingWindow(ctx, "sw", 10, time.Minute)
+	if err != nil || !res.Allowed || res.Count != 4 {
+		t.Fatalf("Expected a cost of 4 to count 4 hits, got %+v, %v", res, err)
+	}
+	s.SlidingWindow(ctx, "sw", 10, time.Minute)
+	if res, _ := s.SlidingWindow(ctx, "sw", 10, time.Minute); res.Allowed {
+		t.Error("Expected a third request of cost 4 to exceed a limit of 10")
+	}
+	if res, _ := s.SlidingWindow(context.Background(), "sw", 10, time.Minute); !res.Allowed || res.Count != 9 {
+		t.Errorf("Expected a cheap request to still fit, got %+v", res)
+	}
+
+	for i, want := range []bool{true, true, false} {
+		if res, _ := s.GCRA(ctx, "gcra", 10, time.Minute); res.Allowed != want {
+			t.Errorf("GCRA request %d: allowed %v, want %v", i+1, res.Allowed, want)
+		}
+	}
+
+	if res, _ := s.SlidingLog(ctx, "log", 10, time.Minute); !res.Allowed || res.Count != 4 {
+		t.Errorf("Expected the sliding log to record 4 hits, got %+v", res)
+	}
+
+	// The leaky bucket queues a costly request's hits behind it.
+	s.LeakyBucket(ctx, "leaky", 10, time.Minute, time.Minute)
+	if res, _ := s.LeakyBucket(context.Background(), "leaky", 10, time.Minute, time.Minute); res.Wait != 24*time.Second {
+		t.Errorf("Expected to wait out 4 slots of 6s, got %v", res.Wait)
+	}
+}
+
+func TestMemoryKeyValue(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestMemory(&now)
+	ctx := context.Background()
+
+	if err := s.Set(ctx, "a", "1", time.Second); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if v, err := s.Get(ctx, "a"); err != nil || v != "1" {
+		t.Fatalf("Get() = %q, %v", v, err)
+	}
+	now = now.Add(time.Second)
+	if _, err := s.Get(ctx, "a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected expired key to be gone, got %v", err)
+	}
+
+	if ok, _ := s.SetNX(ctx, "lease", "me", time.Minute); !ok {
+		t.Fatal("Expected SetNX on a free key to succeed")
+	}
+	if ok, _ := s.SetNX(ctx, "lease", "you", time.Minute); ok {
+		t.Error("Expected SetNX on a held key to fail")
+	}
+	if ok, _ := s.CompareAndExpire(ctx, "lease", "you", time.Minute); ok {
+		t.Error("Expected CompareAndExpire by another holder to fail")
+	}
+	if ok, _ := s.CompareAndDelete(ctx, "lease", "me"); !ok {
+		t.Error("Expected CompareAndDelete by the holder to succeed")
+	}
+	if _, err := s.Get(ctx, "lease"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected released lease to be gone, got %v", err)
+	}
+}
+
+func TestMemoryIncrBy(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestMemory(&now)
+	ctx := context.Background()
+
+	if n, err := s.IncrBy(ctx, "c", 2, time.Minute); err != nil || n != 2 {
+		t.Fatalf("IncrBy() = %d, %v", n, err)
+	}
+	if n, _ := s.IncrBy(ctx, "c", -1, 0); n != 1 {
+		t.Errorf("Expected 1 after decrementing, got %d", n)
+	}
+	now = now.Add(time.Minute)
+	if n, _ := s.IncrBy(ctx, "c", 1, time.Minute); n != 1 {
+		t.Errorf("Expected an expired counter to restart, got %d", n)
+	}
+}
+
+func TestMemoryDeleteIndexed(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestMemory(&now)
+	ctx := context.Background()
+
+	scope := "gatify:rl:{r1}"
+	if _, err := s.GCRA(ctx, scope+":a", 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SlidingWindow(ctx, scope+":b", 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	index, _ := IndexKey(scope + ":a")
+	n, err := s.DeleteIndexed(ctx, index)
+	if err != nil || n != 2 {
+		t.Fatalf("DeleteIndexed() = %d, %v", n, err)
+	}
+	if res, _ := s.GCRA(ctx, scope+":a", 1, time.Minute); !res.Allowed {
+		t.Error("Expected counters to be cleared")
+	}
+}
+
+func TestMemoryScanAndRename(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestMemory(&now)
+	ctx := context.Background()
+	_ = s.Set(ctx, "gatify:rl:r1:ip:a", "5", time.Minute)
+	_ = s.Set(ctx, "gatify:rl:r1:ip:b", "6", time.Minute)
+	_ = s.Set(ctx, "gatify:leader", "x", 0)
+
+	var keys []string
+	_ = s.ScanKeys(ctx, "gatify:rl:*", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if len(keys) != 2 {
+		t.Fatalf("Expected 2 scanned keys, got %v", keys)
+	}
+
+	if ok, err := s.RenameKey(ctx, "gatify:rl:r1:ip:a", "gatify:rl:{r1}:ip:a"); !ok || err != nil {
+		t.Fatalf("RenameKey() = %v, %v", ok, err)
+	}
+	if v, _ := s.Get(ctx, "gatify:rl:{r1}:ip:a"); v != "5" {
+		t.Errorf("Expected the value moved, got %q", v)
+	}
+	if ok, _ := s.RenameKey(ctx, "gatify:rl:r1:ip:a", "gatify:rl:{r1}:ip:c"); ok {
+		t.Error("Expected renaming a missing key to do nothing")
+	}
+	_ = s.Set(ctx, "gatify:rl:{r1}:ip:b", "1", time.Minute)
+	if ok, _ := s.RenameKey(ctx, "gatify:rl:r1:ip:b", "gatify:rl:{r1}:ip:b"); ok {
+		t.Error("Expected an existing target to be kept")
+	}
+
+	// The moved key keeps its expiry.
+	now = now.Add(time.Minute)
+	if _, err := s.Get(ctx, "gatify:rl:{r1}:ip:a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected the moved key to expire, got %v", err)
+	}
+}
+
+func TestMemoryScanKeysMatchesAcrossSlashes(t *testing.T) {
+	s := NewMemoryStorage()
+	ctx := context.Background()
+	_ = s.Set(ctx, "gatify:quota:{r[1]}:key:a/b:2026-01", "5", time.Minute)
+	_ = s.Set(ctx, "gatify:quota:{r[1]}:ip:10.0.0.1:2026-01", "1", time.Minute)
+	_ = s.Set(ctx, "gatify:quota:{r1}:ip:10.0.0.1:2026-01", "1", time.Minute)
+
+	var keys []string
+	err := s.ScanKeys(ctx, `gatify:quota:{r\[1\]}:*`, func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil || len(keys) != 2 {
+		t.Errorf("ScanKeys() = %v, %v, want 2 keys including one with a /", keys, err)
+	}
+}
+
+func TestMemoryIncrByTracksIndex(t *testing.T) {
+	s := NewMemoryStorage()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	ctx := WithIndex(context.Background(), "gatify:rl:{r1}:index")
+
+	_, _ = s.GCRA(context.Background(), "gatify:rl:{r1}:ip:a", 10, time.Minute)
+	_, _ = s.IncrBy(ctx, "gatify:inflight:{r1}:ip:a", 1, time.Minute)
+	_, _ = s.IncrBy(ctx, "gatify:quota:{r1}:ip:a:2026-01", 1, time.Hour)
+	_, _ = s.IncrBy(context.Background(), "gatify:quota:{r2}:ip:a:2026-01", 1, time.Hour)
+
+	n, err := s.DeleteIndexed(context.Background(), "gatify:rl:{r1}:index")
+	if err != nil || n != 3 {
+		t.Fatalf("DeleteIndexed() = %d, %v, want the limiter, in-flight and quota counters", n, err)
+	}
+	if _, err := s.Get(context.Background(), "gatify:quota:{r1}:ip:a:2026-01"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected the quota counter deleted, got %v", err)
+	}
+	if _, err := s.Get(context.Background(), "gatify:quota:{r2}:ip:a:2026-01"); err != nil {
+		t.Errorf("Expected untracked counters kept, got %v", err)
+	}
+}
+
+func TestMemoryGetIndexed(t *testing.T) {
+	s := NewMemoryStorage()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	ctx := WithIndex(context.Background(), "gatify:ban:{bans}:index")
+
+	_ = s.Set(ctx, "gatify:ban:{bans}:a", "1", time.Hour)
+	_ = s.Set(ctx, "gatify:ban:{bans}:b", "2", time.Minute)
+	_ = s.Set(ctx, "gatify:ban:{bans}:c", "3", time.Hour)
+	_ = s.Set(context.Background(), "gatify:ban:{bans}:d", "4", time.Hour)
+	_ = s.Delete(ctx, "gatify:ban:{bans}:c")
+
+	now = now.Add(2 * time.Minute)
+	got, err := s.GetIndexed(context.Background(), "gatify:ban:{bans}:index")
+	if err != nil {
+		t.Fatalf("GetIndexed() error = %v", err)
+	}
+	if len(got) != 1 || got["gatify:ban:{bans}:a"] != "1" {
+		t.Errorf("GetIndexed() = %v, want only the live tracked key", got)
+	}
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// PeekSlidingWindow reads key's sliding window as SlidingWindow would
+// see it at now, without recording a hit. Allowed reports whether a hit
+// of the context's cost would fit, and BurstRemaining is read when the
+// context was made WithBurst. It works with every backend, as the
+// counters are plain integers.
+func PeekSlidingWindow(ctx context.Context, s Storage, key string, limit int64, window time.Duration, now time.Time) (WindowResult, error) {
+	start, weight := windowBounds(now, window)
+	cur, err := peekNumber(ctx, s, key+":"+strconv.FormatInt(start.UnixMilli(), 10))
+	if err != nil {
+		return WindowResult{}, err
+	}
+	prev, err := peekNumber(ctx, s, key+":"+strconv.FormatInt(start.Add(-window).UnixMilli(), 10))
+	if err != nil {
+		return WindowResult{}, err
+	}
+	res := WindowResult{Count: int64(prev*weight + cur), ResetAt: start.Add(window)}
+	if burst := BurstFrom(ctx); burst > 0 {
+		used, err := peekNumber(ctx, s, burstPoolKey(key))
+		if err != nil {
+			return WindowResult{}, err
+		}
+		res.BurstRemaining = burst - int64(used)
+	}
+	cost := CostFrom(ctx)
+	res.Allowed = res.Count+cost <= limit || res.BurstRemaining >= cost
+	return res, nil
+}
+
+// PeekGCRA reads key's GCRA state at now without recording a hit. Count
+// is how many hits the bucket holds and ResetAt when it will be empty.
+func PeekGCRA(ctx context.Context, s Storage, key string, limit int64, window time.Duration, now time.Time) (WindowResult, error) {
+	tat, err := peekNumber(ctx, s, key)
+	if err != nil {
+		return WindowResult{}, err
+	}
+	nowMS := float64(now.UnixMilli())
+	interval := float64(window.Milliseconds()) / float64(limit)
+	tat = math.Max(tat, nowMS)
+	held := int64(math.Ceil((tat - nowMS) / interval))
+	res := WindowResult{
+		Allowed: held+CostFrom(ctx) <= limit,
+		Count:   held,
+		ResetAt: now.Add(msDuration(tat - nowMS)),
+	}
+	if !res.Allowed {
+		// As in GCRA, a rejected request can retry once it fits.
+		allowAt := tat + interval*float64(CostFrom(ctx)-limit)
+		res.ResetAt = now.Add(msDuration(allowAt - nowMS))
+	}
+	return res, nil
+}
+
+// peekNumber reads a numeric key, treating a missing one as zero.
+func peekNumber(ctx context.Context, s Storage, key string) (float64, error) {
+	v, err := s.Get(ctx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(v, 64)
+}
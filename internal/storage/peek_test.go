@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPeekSlidingWindow(t *testing.T) {
+	s := NewMemoryStorage()
+	now := time.Date(2024, 3, 5, 10, 0, 30, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.SlidingWindow(ctx, "k", 3, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		res, err := PeekSlidingWindow(ctx, s, "k", 3, time.Minute, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Count != 3 || res.Allowed || !res.ResetAt.Equal(now.Truncate(time.Minute).Add(time.Minute)) {
+			t.Fatalf("peek %d = %+v, want a full window", i, res)
+		}
+	}
+
+	res, err := PeekSlidingWindow(WithBurst(ctx, 2), s, "k", 3, time.Minute, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Allowed || res.BurstRemaining != 2 {
+		t.Errorf("peek with burst = %+v, want the burst available", res)
+	}
+}
+
+func TestPeekGCRA(t *testing.T) {
+	s := NewMemoryStorage()
+	now := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	res, err := PeekGCRA(ctx, s, "k", 10, time.Minute, now)
+	if err != nil || res.Count != 0 || !res.Allowed {
+		t.Fatalf("empty peek = %+v, %v", res, err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := s.GCRA(ctx, "k", 10, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err = PeekGCRA(ctx, s, "k", 10, time.Minute, now)
+	if err != nil || res.Count != 4 || !res.Allowed || !res.ResetAt.Equal(now.Add(24*time.Second)) {
+		t.Errorf("peek = %+v, %v, want 4 held for 24s", res, err)
+	}
+	for i := 0; i < 6; i++ {
+		if _, err := s.GCRA(ctx, "k", 10, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err = PeekGCRA(ctx, s, "k", 10, time.Minute, now)
+	if err != nil || res.Allowed || !res.ResetAt.Equal(now.Add(6*time.Second)) {
+		t.Errorf("full peek = %+v, %v, want a retry in one 6s interval", res, err)
+	}
+}
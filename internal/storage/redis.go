@@ -1,4 +1,589 @@
-// Package storage provides data storage interfaces
 package storage
 
-// TODO: Implement Redis storage backend
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// slidingWindowScript atomically estimates the weighted count across the
+// previous and current fixed windows and increments the current window
+// when the hit fits. Hits over the limit are charged to the burst pool
+// instead while it has room.
+//
+// KEYS[1] current window counter, KEYS[2] previous window counter,
+// KEYS[3] burst pool, optional KEYS[4] scope index
+// ARGV[1] limit, ARGV[2] previous window weight, ARGV[3] counter TTL in ms,
+// ARGV[4] now in ms, ARGV[5] hits to charge, ARGV[6] burst allowance,
+// ARGV[7] window in ms
+// Returns {allowed, weighted count, burst remaining}.
+var slidingWindowScript = newScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local previous = tonumber(redis.call('GET', KEYS[2]) or '0')
+local limit = tonumber(ARGV[1])
+local weight = tonumber(ARGV[2])
+local cost = tonumber(ARGV[5])
+local burst = tonumber(ARGV[6])
+local used = 0
+if burst > 0 then
+  used = tonumber(redis.call('GET', KEYS[3]) or '0')
+end
+
+local estimated = previous * weight + current
+if estimated + cost > limit then
+  if used + cost > burst then
+    return {0, math.floor(estimated), burst - used}
+  end
+  used = redis.call('INCRBY', KEYS[3], cost)
+  redis.call('PEXPIRE', KEYS[3], ARGV[7])
+` + trackKey("KEYS[4]", "KEYS[3]", "ARGV[4]", "ARGV[7]") + `
+  return {1, limit, burst - used}
+end
+
+current = redis.call('INCRBY', KEYS[1], cost)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+` + trackKey("KEYS[4]", "KEYS[1]", "ARGV[4]", "ARGV[3]") + `
+return {1, math.floor(previous * weight + current), burst - used}
+`)
+
+// gcraScript implements the generic cell rate algorithm over a stored
+// theoretical arrival time (TAT) in milliseconds.
+//
+// KEYS[1] TAT key, optional KEYS[2] scope index
+// ARGV[1] now in ms, ARGV[2] emission interval in ms, ARGV[3] limit,
+// ARGV[4] hits to charge
+// Returns {allowed, remaining, ms until the bucket is empty again}, or on
+// rejection {0, 0, ms until the hits would be allowed}.
+var gcraScript = newScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+
+local tat = tonumber(redis.call('GET', KEYS[1]) or '0')
+if tat < now then
+  tat = now
+end
+local new_tat = tat + interval * cost
+local allow_at = new_tat - interval * limit
+if now < allow_at then
+  return {0, 0, math.ceil(allow_at - now)}
+end
+
+local ttl = math.ceil(new_tat - now)
+redis.call('SET', KEYS[1], string.format('%.3f', new_tat), 'PX', ttl)
+` + trackKey("KEYS[2]", "KEYS[1]", "ARGV[1]", "ttl") + `
+return {1, math.floor((now - allow_at) / interval), math.ceil(new_tat - now)}
+`)
+
+// leakyBucketScript queues hits behind a stored next free slot in
+// milliseconds, draining one hit per interval.
+//
+// KEYS[1] slot key, optional KEYS[2] scope index
+// ARGV[1] now in ms, ARGV[2] drain interval in ms, ARGV[3] max wait in ms,
+// ARGV[4] hits to charge
+// Returns {allowed, free queue slots, ms to wait, ms until the queue drains}.
+var leakyBucketScript = newScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local max_wait = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+
+local slot = tonumber(redis.call('GET', KEYS[1]) or '0')
+if slot < now then
+  slot = now
+end
+local wait = slot - now
+if wait > max_wait then
+  return {0, 0, 0, math.ceil(wait - max_wait)}
+end
+
+local next_slot = slot + interval * cost
+local ttl = math.ceil(next_slot - now)
+redis.call('SET', KEYS[1], string.format('%.3f', next_slot), 'PX', ttl)
+` + trackKey("KEYS[2]", "KEYS[1]", "ARGV[1]", "ttl") + `
+return {1, math.floor((max_wait - wait) / interval), math.ceil(wait), ttl}
+`)
+
+// slidingLogScript keeps every hit in a sorted set scored by its time in
+// milliseconds, dropping hits older than the window before counting.
+//
+// KEYS[1] log key, optional KEYS[2] scope index
+// ARGV[1] now in ms, ARGV[2] window in ms, ARGV[3] limit, ARGV[4] hits to
+// charge, ARGV[5] unique member prefix
+// Returns {allowed, hits in the window, time of the oldest hit in ms}.
+var slidingLogScript = newScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+if count + cost > limit then
+  local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+  return {0, count, tonumber(oldest[2] or now)}
+end
+
+for i = 1, cost do
+  redis.call('ZADD', KEYS[1], now, ARGV[5] .. ':' .. i)
+end
+redis.call('PEXPIRE', KEYS[1], window)
+` + trackKey("KEYS[2]", "KEYS[1]", "ARGV[1]", "ARGV[2]") + `
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return {1, count + cost, tonumber(oldest[2])}
+`)
+
+// trackKey returns Lua that records key in the scope index, when one was
+// passed, scored by when key expires. Expired members are pruned on every
+// write so the index only holds live counters, and the index itself
+// expires with its last member.
+func trackKey(index, key, nowMS, ttlMS string) string {
+	return `
+if ` + index + ` then
+  local now = tonumber(` + nowMS + `)
+  redis.call('ZADD', ` + index + `, now + tonumber(` + ttlMS + `), ` + key + `)
+  redis.call('ZREMRANGEBYSCORE', ` + index + `, '-inf', now)
+  local last = redis.call('ZRANGE', ` + index + `, -1, -1, 'WITHSCORES')
+  redis.call('PEXPIREAT', ` + index + `, last[2])
+end`
+}
+
+// deleteIndexedScript deletes up to ARGV[1] keys tracked in the index
+// KEYS[1] and returns how many it removed from the index. Callers repeat
+// it until it returns 0 so a large scope never blocks Redis for long.
+var deleteIndexedScript = newScript(`
+local batch = redis.call('ZRANGE', KEYS[1], 0, tonumber(ARGV[1]) - 1)
+if #batch == 0 then
+  return 0
+end
+redis.call('DEL', unpack(batch))
+redis.call('ZREM', KEYS[1], unpack(batch))
+return #batch
+`)
+
+// getIndexedScript prunes the expired members of the index KEYS[1] and
+// returns the live ones with their values, as a flat key, value list.
+// Members whose key was deleted are dropped from the index as well.
+//
+// ARGV[1] now in ms
+var getIndexedScript = newScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+local keys = redis.call('ZRANGE', KEYS[1], 0, -1)
+local out = {}
+for i = 1, #keys, 500 do
+  local batch = {unpack(keys, i, math.min(i + 499, #keys))}
+  local values = redis.call('MGET', unpack(batch))
+  for j, key in ipairs(batch) do
+    if values[j] then
+      table.insert(out, key)
+      table.insert(out, values[j])
+    else
+      redis.call('ZREM', KEYS[1], key)
+    end
+  end
+end
+return out
+`)
+
+// setScript stores a value with an expiry and tracks it in a scope index.
+//
+// KEYS[1] key, KEYS[2] scope index
+// ARGV[1] value, ARGV[2] ttl in ms, ARGV[3] now in ms
+var setScript = newScript(`
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+local index = KEYS[2]
+` + trackKey("index", "KEYS[1]", "ARGV[3]", "ARGV[2]") + `
+return 1
+`)
+
+// incrByScript increments a counter and refreshes its expiry in one round
+// trip.
+//
+// KEYS[1] counter, optional KEYS[2] scope index
+// ARGV[1] delta, ARGV[2] ttl in ms, ARGV[3] now in ms
+var incrByScript = newScript(`
+local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+if tonumber(ARGV[2]) > 0 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+` + trackKey("KEYS[2]", "KEYS[1]", "ARGV[3]", "ARGV[2]") + `
+end
+return v
+`)
+
+// compareAndExpireScript refreshes a lease only for its current holder.
+var compareAndExpireScript = newScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// compareAndDeleteScript releases a lease only for its current holder.
+var compareAndDeleteScript = newScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// renameKeyScript moves KEYS[1] to KEYS[2] unless KEYS[2] exists, and
+// records it in the scope index KEYS[3], when one was passed, like
+// trackKey does.
+//
+// ARGV[1] now in ms
+var renameKeyScript = newScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 or redis.call('RENAMENX', KEYS[1], KEYS[2]) == 0 then
+  return 0
+end
+local ttl = redis.call('PTTL', KEYS[2])
+if ttl > 0 then
+  local index = KEYS[3]
+` + trackKey("index", "KEYS[2]", "ARGV[1]", "ttl") + `
+end
+return 1
+`)
+
+// scanBatchSize is the COUNT hint for each SCAN call.
+const scanBatchSize = 500
+
+// RedisOptions configures the Redis connection.
+type RedisOptions struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
+// RedisStorage is a Storage backed by Redis.
+type RedisStorage struct {
+	client *redisClient
+	now    func() time.Time
+}
+
+// NewRedisStorage creates a Redis-backed storage. Connections are opened
+// lazily; call Ping to verify connectivity.
+func NewRedisStorage(opts RedisOptions) *RedisStorage {
+	return &RedisStorage{
+		client: newRedisClient(opts.Addr, opts.Password, opts.DB),
+		now:    time.Now,
+	}
+}
+
+// SlidingWindow implements Storage.
+func (s *RedisStorage) SlidingWindow(ctx context.Context, key string, limit int64, window time.Duration) (WindowResult, error) {
+	start, weight := windowBounds(s.now(), window)
+	current := key + ":" + strconv.FormatInt(start.UnixMilli(), 10)
+	previous := key + ":" + strconv.FormatInt(start.Add(-window).UnixMilli(), 10)
+
+	keys := []string{current, previous, burstPoolKey(key)}
+	if index, ok := IndexKey(key); ok {
+		keys = append(keys, index)
+	}
+
+	reply, err := slidingWindowScript.run(ctx, s.client, keys,
+		limit, weight, (2 * window).Milliseconds(), s.now().UnixMilli(), CostFrom(ctx),
+		BurstFrom(ctx), window.Milliseconds())
+	if err != nil {
+		return WindowResult{}, fmt.Errorf("sliding window %s: %w", key, err)
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 3 {
+		return WindowResult{}, fmt.Errorf("sliding window %s: unexpected reply %v", key, reply)
+	}
+	allowed, _ := values[0].(int64)
+	count, _ := values[1].(int64)
+	burstRemaining, _ := values[2].(int64)
+
+	return WindowResult{
+		Allowed:        allowed == 1,
+		Count:          count,
+		ResetAt:        start.Add(window),
+		BurstRemaining: burstRemaining,
+	}, nil
+}
+
+// GCRA implements Storage.
+func (s *RedisStorage) GCRA(ctx context.Context, key string, limit int64, window time.Duration) (WindowResult, error) {
+	now := s.now()
+	interval := float64(window.Milliseconds()) / float64(limit)
+
+	keys := []string{key}
+	if index, ok := IndexKey(key); ok {
+		keys = append(keys, index)
+	}
+
+	reply, err := gcraScript.run(ctx, s.client, keys, now.UnixMilli(), interval, limit, CostFrom(ctx))
+	if err != nil {
+		return WindowResult{}, fmt.Errorf("gcra %s: %w", key, err)
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 3 {
+		return WindowResult{}, fmt.Errorf("gcra %s: unexpected reply %v", key, reply)
+	}
+	allowed, _ := values[0].(int64)
+	remaining, _ := values[1].(int64)
+	resetMS, _ := values[2].(int64)
+
+	return WindowResult{
+		Allowed: allowed == 1,
+		Count:   limit - remaining,
+		ResetAt: now.Add(time.Duration(resetMS) * time.Millisecond),
+	}, nil
+}
+
+// LeakyBucket implements Storage. Its state lives at key+":leaky" so a
+// rule switching algorithms does not misread another algorithm's counter.
+func (s *RedisStorage) LeakyBucket(ctx context.Context, key string, limit int64, window, maxDelay time.Duration) (WindowResult, error) {
+	now := s.now()
+	interval := float64(window.Milliseconds()) / float64(limit)
+
+	keys := []string{key + ":leaky"}
+	if index, ok := IndexKey(key); ok {
+		keys = append(keys, index)
+	}
+
+	reply, err := leakyBucketScript.run(ctx, s.client, keys, now.UnixMilli(), interval, maxDelay.Milliseconds(), CostFrom(ctx))
+	if err != nil {
+		return WindowResult{}, fmt.Errorf("leaky bucket %s: %w", key, err)
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 4 {
+		return WindowResult{}, fmt.Errorf("leaky bucket %s: unexpected reply %v", key, reply)
+	}
+	allowed, _ := values[0].(int64)
+	free, _ := values[1].(int64)
+	waitMS, _ := values[2].(int64)
+	resetMS, _ := values[3].(int64)
+
+	count := limit - free
+	if count < 0 {
+		count = 0
+	}
+	return WindowResult{
+		Allowed: allowed == 1,
+		Count:   count,
+		ResetAt: now.Add(time.Duration(resetMS) * time.Millisecond),
+		Wait:    time.Duration(waitMS) * time.Millisecond,
+	}, nil
+}
+
+// SlidingLog implements Storage. Its log lives at key+":log".
+func (s *RedisStorage) SlidingLog(ctx context.Context, key string, limit int64, window time.Duration) (WindowResult, error) {
+	now := s.now()
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return WindowResult{}, fmt.Errorf("sliding log %s: %w", key, err)
+	}
+
+	keys := []string{key + ":log"}
+	if index, ok := IndexKey(key); ok {
+		keys = append(keys, index)
+	}
+
+	reply, err := slidingLogScript.run(ctx, s.client, keys,
+		now.UnixMilli(), window.Milliseconds(), limit, CostFrom(ctx), hex.EncodeToString(b))
+	if err != nil {
+		return WindowResult{}, fmt.Errorf("sliding log %s: %w", key, err)
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 3 {
+		return WindowResult{}, fmt.Errorf("sliding log %s: unexpected reply %v", key, reply)
+	}
+	allowed, _ := values[0].(int64)
+	count, _ := values[1].(int64)
+	oldestMS, _ := values[2].(int64)
+
+	return WindowResult{
+		Allowed: allowed == 1,
+		Count:   count,
+		ResetAt: time.UnixMilli(oldestMS).Add(window),
+	}, nil
+}
+
+// Get implements Storage.
+func (s *RedisStorage) Get(ctx context.Context, key string) (string, error) {
+	reply, err := s.client.Do(ctx, "GET", key)
+	if errors.Is(err, ErrNil) {
+		return "", ErrKeyNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	v, _ := reply.(string)
+	return v, nil
+}
+
+// Set implements Storage.
+func (s *RedisStorage) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	if index := IndexFrom(ctx); index != "" && ttl > 0 {
+		if _, err := setScript.run(ctx, s.client, []string{key, index}, value, ttl.Milliseconds(), s.now().UnixMilli()); err != nil {
+			return fmt.Errorf("set %s: %w", key, err)
+		}
+		return nil
+	}
+	args := []any{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", ttl.Milliseconds())
+	}
+	_, err := s.client.Do(ctx, args...)
+	return err
+}
+
+// IncrBy implements Storage.
+func (s *RedisStorage) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	keys := []string{key}
+	if index := IndexFrom(ctx); index != "" {
+		keys = append(keys, index)
+	}
+	reply, err := incrByScript.run(ctx, s.client, keys, delta, ttl.Milliseconds(), s.now().UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("incrby %s: %w", key, err)
+	}
+	n, _ := reply.(int64)
+	return n, nil
+}
+
+// Delete implements Storage.
+func (s *RedisStorage) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(keys)+1)
+	args = append(args, "DEL")
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	_, err := s.client.Do(ctx, args...)
+	return err
+}
+
+// deleteBatchSize bounds the keys removed per DeleteIndexed round trip.
+const deleteBatchSize = 500
+
+// DeleteIndexed implements Storage.
+func (s *RedisStorage) DeleteIndexed(ctx context.Context, index string) (int64, error) {
+	var total int64
+	for {
+		reply, err := deleteIndexedScript.run(ctx, s.client, []string{index}, deleteBatchSize)
+		if err != nil {
+			return total, fmt.Errorf("delete indexed %s: %w", index, err)
+		}
+		n, _ := reply.(int64)
+		if n == 0 {
+			return total, nil
+		}
+		total += n
+	}
+}
+
+// GetIndexed implements Storage.
+func (s *RedisStorage) GetIndexed(ctx context.Context, index string) (map[string]string, error) {
+	reply, err := getIndexedScript.run(ctx, s.client, []string{index}, s.now().UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("get indexed %s: %w", index, err)
+	}
+	values, _ := reply.([]any)
+	out := make(map[string]string, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		key, _ := values[i].(string)
+		value, _ := values[i+1].(string)
+		out[key] = value
+	}
+	return out, nil
+}
+
+// SetNX implements Storage.
+func (s *RedisStorage) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	args := []any{"SET", key, value, "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", ttl.Milliseconds())
+	}
+	_, err := s.client.Do(ctx, args...)
+	if errors.Is(err, ErrNil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CompareAndExpire implements Storage.
+func (s *RedisStorage) CompareAndExpire(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	reply, err := compareAndExpireScript.run(ctx, s.client, []string{key}, value, ttl.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n == 1, nil
+}
+
+// CompareAndDelete implements Storage.
+func (s *RedisStorage) CompareAndDelete(ctx context.Context, key, value string) (bool, error) {
+	reply, err := compareAndDeleteScript.run(ctx, s.client, []string{key}, value)
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n == 1, nil
+}
+
+// ScanKeys implements Mover.
+func (s *RedisStorage) ScanKeys(ctx context.Context, pattern string, fn func(key string) error) error {
+	cursor := "0"
+	for {
+		reply, err := s.client.Do(ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", scanBatchSize)
+		if err != nil {
+			return fmt.Errorf("scan %s: %w", pattern, err)
+		}
+		values, ok := reply.([]any)
+		if !ok || len(values) != 2 {
+			return fmt.Errorf("scan %s: unexpected reply %v", pattern, reply)
+		}
+		cursor, _ = values[0].(string)
+		keys, _ := values[1].([]any)
+		for _, k := range keys {
+			if key, ok := k.(string); ok {
+				if err := fn(key); err != nil {
+					return err
+				}
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+// RenameKey implements Mover. Both keys must live on the same node.
+func (s *RedisStorage) RenameKey(ctx context.Context, from, to string) (bool, error) {
+	keys := []string{from, to}
+	if index, ok := IndexKey(to); ok {
+		keys = append(keys, index)
+	}
+	reply, err := renameKeyScript.run(ctx, s.client, keys, s.now().UnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("rename %s: %w", from, err)
+	}
+	n, _ := reply.(int64)
+	return n == 1, nil
+}
+
+// Ping implements Storage.
+func (s *RedisStorage) Ping(ctx context.Context) error {
+	_, err := s.client.Do(ctx, "PING")
+	return err
+}
+
+// Close implements Storage.
+func (s *RedisStorage) Close() error {
+	return s.client.Close()
+}
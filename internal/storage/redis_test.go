@@ -0,0 +1,347 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWindowBounds(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 45, 0, time.UTC)
+
+	start, weight := windowBounds(now, time.Minute)
+	if !start.Equal(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected window start %v", start)
+	}
+	if weight != 0.25 {
+		t.Errorf("Expected previous window weight 0.25, got %v", weight)
+	}
+}
+
+func TestIndexKey(t *testing.T) {
+	tests := map[string]string{
+		"gatify:rl:{r1}:ip:10.0.0.1":             "gatify:rl:{r1}:index",
+		"gatify:rl:{r1}:ip:10.0.0.1:shadow:gcra": "gatify:rl:{r1}:index",
+		"gatify:rl:global:ip:10.0.0.1":           "",
+		"gatify:rl:{}:ip:10.0.0.1":               "",
+		"gatify:rl:{r1":                          "",
+	}
+	for key, want := range tests {
+		got, ok := IndexKey(key)
+		if got != want || ok != (want != "") {
+			t.Errorf("IndexKey(%q) = %q, %v; want %q", key, got, ok, want)
+		}
+	}
+}
+
+// newTestRedis returns a RedisStorage for the server in REDIS_ADDR, skipping
+// the test when none is configured.
+func newTestRedis(t *testing.T) *RedisStorage {
+	t.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+
+	s := NewRedisStorage(RedisOptions{Addr: addr})
+	t.Cleanup(func() { s.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	return s
+}
+
+func testKey(t *testing.T) string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return "gatify:test:" + t.Name() + ":" + hex.EncodeToString(b)
+}
+
+func TestRedisSlidingWindow(t *testing.T) {
+	s := newTestRedis(t)
+	ctx := context.Background()
+	key := testKey(t)
+
+	for i := 1; i <= 3; i++ {
+		res, err := s.SlidingWindow(ctx, key, 3, time.Minute)
+		if err != nil {
+			t.Fatalf("SlidingWindow() error = %v", err)
+		}
+		if !res.Allowed {
+			t.Fatalf("Request %d: expected allowed", i)
+		}
+	}
+
+	res, err := s.SlidingWindow(ctx, key, 3, time.Minute)
+	if err != nil {
+		t.Fatalf("SlidingWindow() error = %v", err)
+	}
+	if res.Allowed {
+		t.Error("Expected fourth request to be rejected")
+	}
+	if res.ResetAt.Before(time.Now()) {
+		t.Errorf("Expected ResetAt in the future, got %v", res.ResetAt)
+	}
+}
+
+func TestRedisSlidingWindowBurst(t *testing.T) {
+	s := newTestRedis(t)
+	ctx := WithBurst(context.Background(), 2)
+	key := testKey(t)
+
+	for i, want := range []int64{2, 2, 2, 1, 0} {
+		res, err := s.SlidingWindow(ctx, key, 3, time.Minute)
+		if err != nil {
+			t.Fatalf("SlidingWindow() error = %v", err)
+		}
+		if !res.Allowed || res.BurstRemaining != want {
+			t.Fatalf("Request %d: expected allowed with %d burst left, got %+v", i+1, want, res)
+		}
+	}
+	res, err := s.SlidingWindow(ctx, key, 3, time.Minute)
+	if err != nil {
+		t.Fatalf("SlidingWindow() error = %v", err)
+	}
+	if res.Allowed {
+		t.Error("Expected the request after the burst to be rejected")
+	}
+}
+
+func TestRedisGCRA(t *testing.T) {
+	s := newTestRedis(t)
+	ctx := context.Background()
+	key := testKey(t)
+
+	for i := 1; i <= 3; i++ {
+		res, err := s.GCRA(ctx, key, 3, time.Minute)
+		if err != nil {
+			t.Fatalf("GCRA() error = %v", err)
+		}
+		if !res.Allowed || res.Count != int64(i) {
+			t.Fatalf("Request %d: expected allowed with count %d, got %+v", i, i, res)
+		}
+	}
+
+	res, err := s.GCRA(ctx, key, 3, time.Minute)
+	if err != nil {
+		t.Fatalf("GCRA() error = %v", err)
+	}
+	if res.Allowed {
+		t.Error("Expected burst beyond the limit to be rejected")
+	}
+}
+
+func TestRedisSlidingLog(t *testing.T) {
+	s := newTestRedis(t)
+	ctx := context.Background()
+	key := testKey(t)
+
+	for i := 1; i <= 3; i++ {
+		res, err := s.SlidingLog(ctx, key, 3, time.Minute)
+		if err != nil {
+			t.Fatalf("SlidingLog() error = %v", err)
+		}
+		if !res.Allowed || res.Count != int64(i) {
+			t.Fatalf("Request %d: got %+v", i, res)
+		}
+	}
+	res, err := s.SlidingLog(ctx, key, 3, time.Minute)
+	if err != nil {
+		t.Fatalf("SlidingLog() error = %v", err)
+	}
+	if res.Allowed || res.Count != 3 || time.Until(res.ResetAt) < 59*time.Second {
+		t.Errorf("Expected fourth request rejected for about a minute, got %+v", res)
+	}
+}
+
+func TestRedisLeakyBucket(t *testing.T) {
+	s := newTestRedis(t)
+	ctx := context.Background()
+	key := testKey(t)
+
+	// 60 per minute drains one request per second, so with a 1.5s queue
+	// the first request goes straight through, the second waits its
+	// turn and the third is turned away.
+	first, err := s.LeakyBucket(ctx, key, 60, time.Minute, 1500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("LeakyBucket() error = %v", err)
+	}
+	if !first.Allowed || first.Wait != 0 {
+		t.Fatalf("Expected first request allowed without waiting, got %+v", first)
+	}
+
+	second, err := s.LeakyBucket(ctx, key, 60, time.Minute, 1500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("LeakyBucket() error = %v", err)
+	}
+	if !second.Allowed || second.Wait < 900*time.Millisecond || second.Wait > time.Second {
+		t.Fatalf("Expected second request queued for about 1s, got %+v", second)
+	}
+
+	third, err := s.LeakyBucket(ctx, key, 60, time.Minute, 1500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("LeakyBucket() error = %v", err)
+	}
+	if third.Allowed {
+		t.Errorf("Expected request beyond the queue to be rejected, got %+v", third)
+	}
+}
+
+func TestRedisDeleteIndexed(t *testing.T) {
+	s := newTestRedis(t)
+	ctx := context.Background()
+	scope := testKey(t) + ":{scope}"
+	index, _ := IndexKey(scope)
+
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := s.SlidingWindow(ctx, scope+":"+id, 1, time.Minute); err != nil {
+			t.Fatalf("SlidingWindow() error = %v", err)
+		}
+	}
+	if _, err := s.GCRA(ctx, scope+":d", 1, time.Minute); err != nil {
+		t.Fatalf("GCRA() error = %v", err)
+	}
+	// Counters outside the scope's prefix are tracked on request.
+	inflight := testKey(t) + ":{scope}:inflight"
+	if _, err := s.IncrBy(WithIndex(ctx, index), inflight, 1, time.Minute); err != nil {
+		t.Fatalf("IncrBy() error = %v", err)
+	}
+
+	n, err := s.DeleteIndexed(ctx, index)
+	if err != nil || n != 5 {
+		t.Fatalf("DeleteIndexed() = %d, %v; want 5", n, err)
+	}
+	if _, err := s.Get(ctx, inflight); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected the tracked IncrBy counter deleted, got %v", err)
+	}
+	if res, _ := s.SlidingWindow(ctx, scope+":a", 1, time.Minute); !res.Allowed {
+		t.Error("Expected counters to be reset")
+	}
+	_, _ = s.DeleteIndexed(ctx, index)
+}
+
+func TestRedisGetIndexed(t *testing.T) {
+	s := newTestRedis(t)
+	ctx := context.Background()
+	scope := testKey(t) + ":{bans}"
+	index, _ := IndexKey(scope)
+	tracked := WithIndex(ctx, index)
+
+	_ = s.Set(tracked, scope+":a", "1", time.Minute)
+	_ = s.Set(tracked, scope+":b", "2", time.Minute)
+	_ = s.Set(ctx, scope+":c", "3", time.Minute)
+	_ = s.Delete(ctx, scope+":b")
+
+	got, err := s.GetIndexed(ctx, index)
+	if err != nil {
+		t.Fatalf("GetIndexed() error = %v", err)
+	}
+	if len(got) != 1 || got[scope+":a"] != "1" {
+		t.Errorf("GetIndexed() = %v, want only the live tracked key", got)
+	}
+	_ = s.Delete(ctx, scope+":c")
+	_, _ = s.DeleteIndexed(ctx, index)
+}
+
+func TestRedisGetSetDelete(t *testing.T) {
+	s := newTestRedis(t)
+	ctx := context.Background()
+	key := testKey(t)
+
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if err := s.Set(ctx, key, "v", time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if v, err := s.Get(ctx, key); err != nil || v != "v" {
+		t.Fatalf("Get() = %q, %v", v, err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected key to be deleted, got %v", err)
+	}
+}
+
+func TestRedisIncrBy(t *testing.T) {
+	s := newTestRedis(t)
+	ctx := context.Background()
+	key := testKey(t)
+	defer s.Delete(ctx, key)
+
+	if n, err := s.IncrBy(ctx, key, 3, time.Minute); err != nil || n != 3 {
+		t.Fatalf("IncrBy() = %d, %v", n, err)
+	}
+	if n, err := s.IncrBy(ctx, key, -1, 0); err != nil || n != 2 {
+		t.Fatalf("IncrBy() = %d, %v", n, err)
+	}
+	if v, _ := s.Get(ctx, key); v != "2" {
+		t.Errorf("Expected counter readable with Get, got %q", v)
+	}
+}
+
+func TestRedisLeasePrimitives(t *testing.T) {
+	s := newTestRedis(t)
+	ctx := context.Background()
+	key := testKey(t)
+	defer s.Delete(ctx, key)
+
+	if ok, err := s.SetNX(ctx, key, "a", time.Minute); err != nil || !ok {
+		t.Fatalf("SetNX() = %v, %v; want true", ok, err)
+	}
+	if ok, _ := s.SetNX(ctx, key, "b", time.Minute); ok {
+		t.Error("Expected SetNX to fail on an existing key")
+	}
+	if ok, _ := s.CompareAndExpire(ctx, key, "b", time.Minute); ok {
+		t.Error("Expected CompareAndExpire to fail for another holder")
+	}
+	if ok, err := s.CompareAndExpire(ctx, key, "a", time.Minute); err != nil || !ok {
+		t.Errorf("CompareAndExpire() = %v, %v; want true", ok, err)
+	}
+	if ok, _ := s.CompareAndDelete(ctx, key, "b"); ok {
+		t.Error("Expected CompareAndDelete to fail for another holder")
+	}
+	if ok, err := s.CompareAndDelete(ctx, key, "a"); err != nil || !ok {
+		t.Errorf("CompareAndDelete() = %v, %v; want true", ok, err)
+	}
+}
+
+func TestRedisScanAndRename(t *testing.T) {
+	s := newTestRedis(t)
+	ctx := context.Background()
+	from := testKey(t)
+	to := "gatify:test:{" + t.Name() + "}:" + from
+	index, _ := IndexKey(to)
+	defer s.Delete(ctx, from, to, index)
+
+	_ = s.Set(ctx, from, "5", time.Minute)
+	found := false
+	if err := s.ScanKeys(ctx, from, func(key string) error {
+		found = found || key == from
+		return nil
+	}); err != nil || !found {
+		t.Fatalf("ScanKeys() found %v, error %v", found, err)
+	}
+
+	if ok, err := s.RenameKey(ctx, from, to); !ok || err != nil {
+		t.Fatalf("RenameKey() = %v, %v", ok, err)
+	}
+	if v, _ := s.Get(ctx, to); v != "5" {
+		t.Errorf("Expected the value moved, got %q", v)
+	}
+	if ok, _ := s.RenameKey(ctx, from, to); ok {
+		t.Error("Expected renaming a missing key to do nothing")
+	}
+	if n, _ := s.DeleteIndexed(ctx, index); n != 1 {
+		t.Errorf("Expected the moved key indexed, got %d", n)
+	}
+}
@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/tracing"
+)
+
+// ErrNil is returned when Redis replies with a nil bulk string or array.
+var ErrNil = errors.New("redis: nil reply")
+
+// RedisError is an error reply sent by the Redis server.
+type RedisError string
+
+func (e RedisError) Error() string { return "redis: " + string(e) }
+
+// redisClient is a minimal RESP2 client with a small connection pool. It
+// covers the commands the gateway needs and nothing more.
+type redisClient struct {
+	addr        string
+	password    string
+	db          int
+	dialTimeout time.Duration
+
+	mu     sync.Mutex
+	idle   []*respConn
+	closed bool
+}
+
+const maxIdleConns = 16
+
+type respConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+	wr   *bufio.Writer
+}
+
+func newRedisClient(addr, password string, db int) *redisClient {
+	return &redisClient{
+		addr:        addr,
+		password:    password,
+		db:          db,
+		dialTimeout: 5 * time.Second,
+	}
+}
+
+// Do sends a command and returns its decoded reply. Replies decode to
+// string, int64, []any, or nil; error replies are returned as RedisError.
+func (c *redisClient) Do(ctx context.Context, args ...any) (any, error) {
+	var span *tracing.Span
+	if tracing.FromContext(ctx) != nil {
+		ctx, span = tracing.Start(ctx, fmt.Sprint("redis ", args[0]), tracing.KindClient)
+		defer span.End()
+		span.SetAttr("db.system", "redis")
+	}
+
+	cn, err := c.get(ctx)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	reply, err := cn.roundTrip(ctx, args)
+	c.put(cn, err)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrNil
+	}
+	return reply, nil
+}
+
+func (c *redisClient) get(ctx context.Context) (*respConn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, errors.New("redis: client closed")
+	}
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+
+	return c.dial(ctx)
+}
+
+// put returns a connection to the pool unless the round trip failed in a
+// way that may have left unread data on the wire.
+func (c *redisClient) put(cn *respConn, err error) {
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		_ = cn.conn.Close()
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || len(c.idle) >= maxIdleConns {
+		_ = cn.conn.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+func (c *redisClient) dial(ctx context.Context) (*respConn, error) {
+	d := net.Dialer{Timeout: c.dialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("redis: dial %s: %w", c.addr, err)
+	}
+
+	cn := &respConn{conn: conn, rd: bufio.NewReader(conn), wr: bufio.NewWriter(conn)}
+	if c.password != "" {
+		if _, err := cn.roundTrip(ctx, []any{"AUTH", c.password}); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := cn.roundTrip(ctx, []any{"SELECT", c.db}); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// Close closes all idle connections and rejects further commands.
+func (c *redisClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	var firstErr error
+	for _, cn := range c.idle {
+		if err := cn.conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	c.idle = nil
+	return firstErr
+}
+
+func (cn *respConn) roundTrip(ctx context.Context, args []any) (any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Time{}
+	}
+	if err := cn.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if err := writeCommand(cn.wr, args); err != nil {
+		return nil, err
+	}
+	if err := cn.wr.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(cn.rd)
+}
+
+func writeCommand(w *bufio.Writer, args []any) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		s, err := argString(arg)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+	}
+	return nil
+}
+
+func argString(arg any) (string, error) {
+	switch v := arg.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("redis: unsupported argument type %T", arg)
+	}
+}
+
+func readReply(rd *bufio.Reader) (any, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply line")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		out := make([]any, n)
+		for i := range out {
+			if out[i], err = readReply(rd); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply prefix %q", line[0])
+	}
+}
+
+// script is a Lua script invoked with EVALSHA, falling back to EVAL the
+// first time a server has not cached it.
+type script struct {
+	src  string
+	hash string
+}
+
+func newScript(src string) *script {
+	sum := sha1.Sum([]byte(src))
+	return &script{src: src, hash: hex.EncodeToString(sum[:])}
+}
+
+func (s *script) run(ctx context.Context, c *redisClient, keys []string, args ...any) (any, error) {
+	cmd := make([]any, 0, 3+len(keys)+len(args))
+	cmd = append(cmd, "EVALSHA", s.hash, len(keys))
+	for _, k := range keys {
+		cmd = append(cmd, k)
+	}
+	cmd = append(cmd, args...)
+
+	reply, err := c.Do(ctx, cmd...)
+	var redisErr RedisError
+	if errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "NOSCRIPT") {
+		cmd[0], cmd[1] = "EVAL", s.src
+		return c.Do(ctx, cmd...)
+	}
+	return reply, err
+}
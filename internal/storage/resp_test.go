@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  any
+	}{
+		{"simple string", "+OK\r\n", "OK"},
+		{"integer", ":42\r\n", int64(42)},
+		{"bulk string", "$5\r\nhello\r\n", "hello"},
+		{"nil bulk", "$-1\r\n", nil},
+		{"array", "*2\r\n:1\r\n$3\r\nfoo\r\n", []any{int64(1), "foo"}},
+		{"nil array", "*-1\r\n", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readReply(bufio.NewReader(strings.NewReader(tt.input)))
+			if err != nil {
+				t.Fatalf("readReply() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readReply() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadReplyError(t *testing.T) {
+	_, err := readReply(bufio.NewReader(strings.NewReader("-ERR boom\r\n")))
+
+	var redisErr RedisError
+	if !errors.As(err, &redisErr) || string(redisErr) != "ERR boom" {
+		t.Errorf("Expected RedisError, got %v", err)
+	}
+}
+
+func TestWriteCommand(t *testing.T) {
+	var sb strings.Builder
+	w := bufio.NewWriter(&sb)
+	if err := writeCommand(w, []any{"SET", "k", 10, 1.5}); err != nil {
+		t.Fatalf("writeCommand() error = %v", err)
+	}
+	w.Flush()
+
+	want := "*4\r\n$3\r\nSET\r\n$1\r\nk\r\n$2\r\n10\r\n$3\r\n1.5\r\n"
+	if sb.String() != want {
+		t.Errorf("writeCommand() = %q, want %q", sb.String(), want)
+	}
+}
+
+// fakeRedis answers every command with the reply produced by respond.
+func fakeRedis(t *testing.T, respond func(cmd []any) string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				for {
+					cmd, err := readReply(rd)
+					if err != nil {
+						return
+					}
+					if _, err := conn.Write([]byte(respond(cmd.([]any)))); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestRedisClientDoAndAuth(t *testing.T) {
+	var authed bool
+	addr := fakeRedis(t, func(cmd []any) string {
+		switch cmd[0] {
+		case "AUTH":
+			authed = cmd[1] == "pw"
+			return "+OK\r\n"
+		case "PING":
+			return "+PONG\r\n"
+		default:
+			return "-ERR unknown command\r\n"
+		}
+	})
+
+	c := newRedisClient(addr, "pw", 0)
+	defer c.Close()
+
+	reply, err := c.Do(context.Background(), "PING")
+	if err != nil || reply != "PONG" {
+		t.Fatalf("Do(PING) = %v, %v", reply, err)
+	}
+	if !authed {
+		t.Error("Expected client to authenticate on dial")
+	}
+
+	if _, err := c.Do(context.Background(), "BOGUS"); err == nil {
+		t.Error("Expected error reply for unknown command")
+	}
+	if len(c.idle) != 1 {
+		t.Errorf("Expected connection to be pooled after error reply, got %d idle", len(c.idle))
+	}
+}
+
+func TestScriptFallsBackToEval(t *testing.T) {
+	var evals int
+	addr := fakeRedis(t, func(cmd []any) string {
+		switch cmd[0] {
+		case "EVALSHA":
+			return "-NOSCRIPT No matching script\r\n"
+		case "EVAL":
+			evals++
+			return ":7\r\n"
+		}
+		return "-ERR\r\n"
+	})
+
+	c := newRedisClient(addr, "", 0)
+	defer c.Close()
+
+	reply, err := newScript("return 7").run(context.Background(), c, []string{"k"})
+	if err != nil || reply != int64(7) {
+		t.Fatalf("run() = %v, %v", reply, err)
+	}
+	if evals != 1 {
+		t.Errorf("Expected one EVAL fallback, got %d", evals)
+	}
+}
@@ -0,0 +1,118 @@
+// Package storage provides data storage interfaces
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrKeyNotFound is returned by Get when the key does not exist.
+var ErrKeyNotFound = errors.New("storage: key not found")
+
+// WindowResult is the outcome of recording a hit in a sliding window.
+type WindowResult struct {
+	// Allowed reports whether the hit fit within the limit.
+	Allowed bool
+	// Count is the weighted number of hits in the window, including this
+	// one when it was allowed.
+	Count int64
+	// ResetAt is when the current fixed window ends.
+	ResetAt time.Time
+	// Wait is how long an allowed hit must be held before it is served to
+	// keep its place in a smoothing queue. Only LeakyBucket sets it.
+	Wait time.Duration
+	// BurstRemaining is how much of the burst allowance is left. Only
+	// SlidingWindow called WithBurst sets it.
+	BurstRemaining int64
+}
+
+// Storage holds rate limiting state shared by gateway instances.
+type Storage interface {
+	// SlidingWindow records a hit for key using the sliding window counter
+	// algorithm and reports whether it fits within limit per window, or
+	// within the burst allowance of a context made WithBurst. A rejected
+	// hit is not counted.
+	SlidingWindow(ctx context.Context, key string, limit int64, window time.Duration) (WindowResult, error)
+	// GCRA records a hit for key using the generic cell rate algorithm,
+	// which spaces requests evenly at limit per window while tolerating a
+	// burst of up to limit. A rejected hit is not counted.
+	GCRA(ctx context.Context, key string, limit int64, window time.Duration) (WindowResult, error)
+	// LeakyBucket records a hit for key in a leaky bucket that drains at
+	// limit per window. Rather than admitting bursts, each hit is given the
+	// next free slot and told to Wait for it; a hit whose slot is further
+	// than maxDelay away is rejected and not counted.
+	LeakyBucket(ctx context.Context, key string, limit int64, window, maxDelay time.Duration) (WindowResult, error)
+	// SlidingLog records a hit for key in an exact log of hit times and
+	// reports whether it fits within limit in the window ending now. Unlike
+	// SlidingWindow it does not estimate the previous window's share, at
+	// the cost of storing every hit. A rejected hit is not counted.
+	SlidingLog(ctx context.Context, key string, limit int64, window time.Duration) (WindowResult, error)
+	// Get returns the value stored at key, or ErrKeyNotFound.
+	Get(ctx context.Context, key string) (string, error)
+	// Set stores value at key. A zero ttl keeps the key until deleted.
+	// With a positive ttl and a ctx made WithIndex, the key is tracked in
+	// that index.
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// IncrBy adds delta to the integer at key, starting from 0, and
+	// returns the new value. A positive ttl (re)sets the key's expiry.
+	IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// Delete removes the given keys, ignoring any that do not exist.
+	Delete(ctx context.Context, keys ...string) error
+	// DeleteIndexed removes every counter tracked in a scope index (see
+	// IndexKey) and reports how many were deleted.
+	DeleteIndexed(ctx context.Context, index string) (int64, error)
+	// GetIndexed returns the value of every live key tracked in a scope
+	// index, by key. It reads the whole index at once, so it suits small
+	// scopes, such as the current bans, rather than limiter counters.
+	GetIndexed(ctx context.Context, index string) (map[string]string, error)
+	// SetNX stores value at key only if the key does not exist, reporting
+	// whether it was stored. It is the building block for leases and locks.
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	// CompareAndExpire resets key's ttl if it still holds value.
+	CompareAndExpire(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	// CompareAndDelete removes key if it still holds value.
+	CompareAndDelete(ctx context.Context, key, value string) (bool, error)
+	// Ping checks that the backend is reachable.
+	Ping(ctx context.Context) error
+	// Close releases any resources held by the backend.
+	Close() error
+}
+
+// Mover is implemented by backends whose keys can be listed and renamed in
+// place, which key schema migrations need.
+type Mover interface {
+	// ScanKeys calls fn with every key matching the glob pattern, a batch
+	// at a time. Keys written during the scan may or may not be seen.
+	ScanKeys(ctx context.Context, pattern string, fn func(key string) error) error
+	// RenameKey moves from to to, keeping its value and expiry and tracking
+	// it in to's scope index. It reports false, changing nothing, when from
+	// no longer exists or to already does.
+	RenameKey(ctx context.Context, from, to string) (bool, error)
+}
+
+// IndexKey returns the key of the index tracking every counter in key's
+// scope. A scope is marked with a Redis hash tag, as in
+// "gatify:rl:{rule-1}:ip:10.0.0.1", which also keeps a scope's counters and
+// its index on one cluster slot. Keys without a hash tag are not tracked.
+func IndexKey(key string) (string, bool) {
+	open := strings.IndexByte(key, '{')
+	if open < 0 {
+		return "", false
+	}
+	end := strings.IndexByte(key[open+1:], '}')
+	if end <= 0 {
+		return "", false
+	}
+	return key[:open+end+2] + ":index", true
+}
+
+// windowBounds returns the start of the fixed window containing now and the
+// fraction of the previous window still overlapping the sliding window.
+func windowBounds(now time.Time, window time.Duration) (start time.Time, prevWeight float64) {
+	start = now.Truncate(window)
+	elapsed := now.Sub(start)
+	prevWeight = float64(window-elapsed) / float64(window)
+	return start, prevWeight
+}
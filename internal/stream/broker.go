@@ -0,0 +1,205 @@
+// Package stream fans live gateway events out to subscribers
+package stream
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is a request the gateway handled, or a rule change, as delivered
+// to live subscribers.
+type Event struct {
+	Time time.Time `json:"time"`
+	// Seq orders the events of one gateway instance.
+	Seq      uint64 `json:"seq"`
+	ClientID string `json:"client_id"`
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	RuleID   string `json:"rule_id,omitempty"`
+	Allowed  bool   `json:"allowed"`
+	Status   int    `json:"status"`
+	Bytes    int64  `json:"bytes"`
+	// ResponseMS is how long the client waited for the response, and
+	// BackendMS how long of that the backend took to start answering.
+	ResponseMS int64 `json:"response_ms"`
+	BackendMS  int64 `json:"backend_ms,omitempty"`
+	// BlockReason classifies rejections that were not rate limits.
+	BlockReason string `json:"block_reason,omitempty"`
+	// Type is empty for request events. TypeRuleChange and TypeHealth
+	// events carry the rule change or upstream health transition as JSON
+	// in Change.
+	Type   string          `json:"type,omitempty"`
+	Change json.RawMessage `json:"change,omitempty"`
+	// Dropped is, on TypeMeta events, how many events the subscriber has
+	// lost since it subscribed because it fell behind.
+	Dropped int64 `json:"dropped,omitempty"`
+}
+
+const (
+	// TypeRuleChange marks events reporting a rule change rather than a
+	// request.
+	TypeRuleChange = "rule_change"
+	// TypeHealth marks events reporting an upstream turning healthy or
+	// unhealthy.
+	TypeHealth = "health"
+	// TypeMeta marks events reporting on the stream itself, sent to a
+	// subscriber that lost events so it knows its view is incomplete.
+	TypeMeta = "meta"
+)
+
+// MetaInterval is how often a subscriber that lost events since the last
+// meta-event is sent a new one.
+const MetaInterval = 10 * time.Second
+
+// Broker delivers every published event to all current subscribers.
+// Publishing never blocks: a subscriber that falls behind loses events
+// rather than slowing down the proxy.
+type Broker struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+	nextID atomic.Uint64
+}
+
+// NewBroker creates a Broker with no subscribers.
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[*Subscription]struct{})}
+}
+
+// Publish sends e to every subscriber with room in its buffer.
+func (b *Broker) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		select {
+		case s.events <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe registers a subscriber buffering up to buffer events.
+func (b *Broker) Subscribe(buffer int) *Subscription {
+	return b.SubscribeAs(buffer, SubscriberInfo{})
+}
+
+// SubscribeAs is Subscribe for a subscriber described by info in
+// SubscriberStats.
+func (b *Broker) SubscribeAs(buffer int, info SubscriberInfo) *Subscription {
+	s := &Subscription{
+		broker: b,
+		events: make(chan Event, buffer),
+		id:     b.nextID.Add(1),
+		info:   info,
+		since:  time.Now().UTC(),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(s.events)
+		return s
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Subscribers returns the number of active subscribers.
+func (b *Broker) Subscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
+
+// SubscriberStats describes an active subscriber.
+type SubscriberStats struct {
+	ID uint64 `json:"id"`
+	SubscriberInfo
+	ConnectedAt time.Time `json:"connected_at"`
+	Dropped     int64     `json:"dropped"`
+}
+
+// SubscriberStats returns the active subscribers, oldest first.
+func (b *Broker) SubscriberStats() []SubscriberStats {
+	b.mu.RLock()
+	out := make([]SubscriberStats, 0, len(b.subs))
+	for s := range b.subs {
+		out = append(out, SubscriberStats{
+			ID:             s.id,
+			SubscriberInfo: s.info,
+			ConnectedAt:    s.since,
+			Dropped:        s.Dropped(),
+		})
+	}
+	b.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Close ends every subscription, for example on shutdown. Later
+// subscriptions are closed immediately.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subs {
+		delete(b.subs, s)
+		close(s.events)
+	}
+}
+
+func (b *Broker) remove(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.events)
+	}
+}
+
+// SubscriberInfo describes a subscriber for SubscriberStats.
+type SubscriberInfo struct {
+	// Transport is how events are delivered, such as "websocket".
+	Transport string `json:"transport,omitempty"`
+	Remote    string `json:"remote,omitempty"`
+}
+
+// Subscription is one consumer's view of the event stream.
+type Subscription struct {
+	broker  *Broker
+	events  chan Event
+	dropped atomic.Int64
+	id      uint64
+	info    SubscriberInfo
+	since   time.Time
+	// reported is the drop count of the last meta-event. Only the
+	// consumer touches it.
+	reported int64
+}
+
+// Events returns the channel events arrive on. It is closed when the
+// subscription or the broker is closed.
+func (s *Subscription) Events() <-chan Event { return s.events }
+
+// Dropped returns how many events were discarded because the subscriber's
+// buffer was full.
+func (s *Subscription) Dropped() int64 { return s.dropped.Load() }
+
+// Meta returns a TypeMeta event reporting the subscriber's drops, when it
+// lost events since the last one Meta returned. Consumers call it every
+// MetaInterval and write the event directly, since the buffer it would
+// otherwise wait in is the one that is full.
+func (s *Subscription) Meta() (Event, bool) {
+	dropped := s.Dropped()
+	if dropped == s.reported {
+		return Event{}, false
+	}
+	s.reported = dropped
+	return Event{Time: time.Now().UTC(), Type: TypeMeta, Dropped: dropped}, true
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *Subscription) Close() { s.broker.remove(s) }
@@ -0,0 +1,75 @@
+package stream
+
+import "testing"
+
+func TestBrokerFanOut(t *testing.T) {
+	b := NewBroker()
+	a, c := b.Subscribe(4), b.Subscribe(4)
+
+	b.Publish(Event{Path: "/a"})
+	for _, s := range []*Subscription{a, c} {
+		if e := <-s.Events(); e.Path != "/a" {
+			t.Errorf("Unexpected event %+v", e)
+		}
+	}
+
+	a.Close()
+	a.Close()
+	if b.Subscribers() != 1 {
+		t.Errorf("Expected one subscriber after close, got %d", b.Subscribers())
+	}
+	if _, ok := <-a.Events(); ok {
+		t.Error("Expected closed subscription channel")
+	}
+}
+
+func TestBrokerDropsForSlowSubscribers(t *testing.T) {
+	b := NewBroker()
+	s := b.Subscribe(1)
+
+	b.Publish(Event{Path: "/1"})
+	b.Publish(Event{Path: "/2"})
+	if s.Dropped() != 1 {
+		t.Errorf("Expected one dropped event, got %d", s.Dropped())
+	}
+	if e := <-s.Events(); e.Path != "/1" {
+		t.Errorf("Expected the buffered event, got %+v", e)
+	}
+}
+
+func TestSubscriptionMeta(t *testing.T) {
+	b := NewBroker()
+	s := b.SubscribeAs(1, SubscriberInfo{Transport: "sse"})
+
+	if _, ok := s.Meta(); ok {
+		t.Error("Expected no meta-event before any drop")
+	}
+	for range 3 {
+		b.Publish(Event{Path: "/"})
+	}
+	if e, ok := s.Meta(); !ok || e.Type != TypeMeta || e.Dropped != 2 {
+		t.Errorf("Expected a meta-event reporting 2 drops, got %+v, %v", e, ok)
+	}
+	if _, ok := s.Meta(); ok {
+		t.Error("Expected no meta-event without new drops")
+	}
+
+	stats := b.SubscriberStats()
+	if len(stats) != 1 || stats[0].Transport != "sse" || stats[0].Dropped != 2 || stats[0].ConnectedAt.IsZero() {
+		t.Errorf("Unexpected subscriber stats %+v", stats)
+	}
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := NewBroker()
+	s := b.Subscribe(1)
+	b.Close()
+
+	if _, ok := <-s.Events(); ok {
+		t.Error("Expected subscriptions closed with the broker")
+	}
+	if _, ok := <-b.Subscribe(1).Events(); ok {
+		t.Error("Expected subscriptions after close to be closed")
+	}
+	b.Publish(Event{})
+}
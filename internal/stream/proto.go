@@ -0,0 +1,75 @@
+package stream
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Field numbers of the Event message in events.proto.
+const (
+	fieldTime     = 1
+	fieldClientID = 2
+	fieldMethod   = 3
+	fieldPath     = 4
+	fieldRuleID   = 5
+	fieldAllowed  = 6
+	fieldStatus   = 7
+	fieldBytes    = 8
+	fieldSeq      = 9
+	fieldType     = 10
+	fieldChange   = 11
+	fieldBlock    = 12
+	fieldDropped  = 13
+)
+
+// Protobuf wire types.
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// MarshalProto encodes e in the protobuf wire format described by
+// events.proto. Zero values are omitted, as in proto3.
+func (e Event) MarshalProto() []byte {
+	buf := make([]byte, 0, 64+len(e.ClientID)+len(e.Path))
+	if !e.Time.IsZero() {
+		buf = appendVarintField(buf, fieldTime, uint64(e.Time.UnixNano()))
+	}
+	buf = appendStringField(buf, fieldClientID, e.ClientID)
+	buf = appendStringField(buf, fieldMethod, e.Method)
+	buf = appendStringField(buf, fieldPath, e.Path)
+	buf = appendStringField(buf, fieldRuleID, e.RuleID)
+	if e.Allowed {
+		buf = appendVarintField(buf, fieldAllowed, 1)
+	}
+	if e.Status > 0 && e.Status <= math.MaxInt32 {
+		buf = appendVarintField(buf, fieldStatus, uint64(e.Status))
+	}
+	if e.Bytes > 0 {
+		buf = appendVarintField(buf, fieldBytes, uint64(e.Bytes))
+	}
+	if e.Seq > 0 {
+		buf = appendVarintField(buf, fieldSeq, e.Seq)
+	}
+	buf = appendStringField(buf, fieldType, e.Type)
+	buf = appendStringField(buf, fieldChange, string(e.Change))
+	buf = appendStringField(buf, fieldBlock, e.BlockReason)
+	if e.Dropped > 0 {
+		buf = appendVarintField(buf, fieldDropped, uint64(e.Dropped))
+	}
+	return buf
+}
+
+func appendVarintField(buf []byte, field int, v uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field)<<3|wireVarint)
+	return binary.AppendUvarint(buf, v)
+}
+
+func appendStringField(buf []byte, field int, s string) []byte {
+	if s == "" {
+		return buf
+	}
+	buf = binary.AppendUvarint(buf, uint64(field)<<3|wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
@@ -0,0 +1,80 @@
+package stream
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// decodeProto is a minimal protobuf decoder for the Event fields.
+func decodeProto(t *testing.T, buf []byte) map[int]any {
+	t.Helper()
+	fields := map[int]any{}
+	for len(buf) > 0 {
+		tag, n := binary.Uvarint(buf)
+		buf = buf[n:]
+		field, wire := int(tag>>3), tag&7
+		v, n := binary.Uvarint(buf)
+		buf = buf[n:]
+		switch wire {
+		case wireVarint:
+			fields[field] = v
+		case wireBytes:
+			fields[field] = string(buf[:v])
+			buf = buf[v:]
+		default:
+			t.Fatalf("Unexpected wire type %d", wire)
+		}
+	}
+	return fields
+}
+
+func TestEventMarshalProto(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 42, time.UTC)
+	e := Event{Time: ts, ClientID: "ip:10.0.0.1", Method: "GET", Path: "/users", Allowed: true, Status: 200, Bytes: 300, Seq: 7}
+
+	got := decodeProto(t, e.MarshalProto())
+	if got[fieldTime] != uint64(ts.UnixNano()) || got[fieldClientID] != "ip:10.0.0.1" || got[fieldPath] != "/users" {
+		t.Errorf("Unexpected fields %v", got)
+	}
+	if got[fieldAllowed] != uint64(1) || got[fieldStatus] != uint64(200) || got[fieldBytes] != uint64(300) || got[fieldSeq] != uint64(7) {
+		t.Errorf("Unexpected fields %v", got)
+	}
+	if _, ok := got[fieldRuleID]; ok {
+		t.Error("Expected empty rule_id to be omitted")
+	}
+}
+
+func TestEventMarshalProtoBlockReason(t *testing.T) {
+	e := Event{Method: "POST", Path: "/upload", Status: 400, BlockReason: "header_violation"}
+
+	if got := decodeProto(t, e.MarshalProto()); got[fieldBlock] != "header_violation" {
+		t.Errorf("Unexpected fields %v", got)
+	}
+}
+
+func TestEventMarshalProtoRuleChange(t *testing.T) {
+	e := Event{Seq: 3, RuleID: "r1", Type: TypeRuleChange, Change: []byte(`{"action":"created"}`)}
+
+	got := decodeProto(t, e.MarshalProto())
+	if got[fieldType] != TypeRuleChange || got[fieldChange] != `{"action":"created"}` || got[fieldRuleID] != "r1" {
+		t.Errorf("Unexpected fields %v", got)
+	}
+}
+
+func TestEventMarshalProtoMeta(t *testing.T) {
+	e := Event{Type: TypeMeta, Dropped: 12}
+
+	got := decodeProto(t, e.MarshalProto())
+	if got[fieldType] != TypeMeta || got[fieldDropped] != uint64(12) {
+		t.Errorf("Unexpected fields %v", got)
+	}
+}
+
+func TestEventMarshalProtoSmallerThanJSON(t *testing.T) {
+	e := Event{Time: time.Now(), ClientID: "ip:10.0.0.1", Method: "GET", Path: "/users", Status: 429}
+	_, payload := encode(e, ProtocolJSON)
+	if len(e.MarshalProto()) >= len(payload) {
+		t.Errorf("Expected protobuf (%d bytes) to be smaller than JSON (%d bytes)", len(e.MarshalProto()), len(payload))
+	}
+}
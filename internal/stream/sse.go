@@ -0,0 +1,85 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// sseHeartbeat is how often an idle Server-Sent Events stream sends a
+// comment so that proxies do not time the connection out.
+const sseHeartbeat = 15 * time.Second
+
+// ServeSSE streams events as Server-Sent Events, for clients and proxies
+// that cannot use WebSockets. Each event is a JSON message of the default
+// type, so EventSource.onmessage receives it.
+func (b *Broker) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// The server's write timeout would otherwise cut the long-lived
+	// stream short; each write sets its own deadline instead.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := b.SubscribeAs(subscriberBuffer, SubscriberInfo{Transport: "sse", Remote: r.RemoteAddr})
+	defer sub.Close()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Tell EventSource how long to wait before reconnecting.
+	if sseWrite(w, rc, []byte("retry: 3000\n\n")) != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	meta := time.NewTicker(MetaInterval)
+	defer meta.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if sseWrite(w, rc, []byte(": keepalive\n\n")) != nil {
+				return
+			}
+		case <-meta.C:
+			if e, ok := sub.Meta(); ok && sseWrite(w, rc, sseMessage(e)) != nil {
+				return
+			}
+		case e, ok := <-sub.Events():
+			if !ok {
+				_ = sseWrite(w, rc, []byte("event: close\ndata: server shutting down\n\n"))
+				return
+			}
+			if sseWrite(w, rc, sseMessage(e)) != nil {
+				return
+			}
+		}
+	}
+}
+
+// sseMessage formats e as a message of the default type.
+func sseMessage(e Event) []byte {
+	payload, _ := json.Marshal(e)
+	msg := make([]byte, 0, len(payload)+8)
+	msg = append(msg, "data: "...)
+	msg = append(msg, payload...)
+	return append(msg, "\n\n"...)
+}
+
+// sseWrite writes and flushes one message, giving up on subscribers that
+// stop reading.
+func sseWrite(w http.ResponseWriter, rc *http.ResponseController, msg []byte) error {
+	_ = rc.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
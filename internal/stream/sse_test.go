@@ -0,0 +1,66 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeSSE(t *testing.T) {
+	b := NewBroker()
+	srv := httptest.NewServer(http.HandlerFunc(b.ServeSSE))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	waitForSubscribers(t, b, 1)
+	b.Publish(Event{Path: "/users", Status: 200, Allowed: true})
+
+	lines := make(chan string)
+	go func() {
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+		close(lines)
+	}()
+
+	var data string
+	timeout := time.After(2 * time.Second)
+	for data == "" {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("Stream ended before the event")
+			}
+			if d, ok := strings.CutPrefix(line, "data: "); ok {
+				data = d
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for the event")
+		}
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(data), &e); err != nil || e.Path != "/users" || e.Status != 200 {
+		t.Errorf("Unexpected event %q: %v", data, err)
+	}
+
+	b.Close()
+	for line := range lines {
+		if line == "event: close" {
+			return
+		}
+	}
+	t.Error("Expected a close event when the broker shuts down")
+}
@@ -0,0 +1,271 @@
+package stream
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket subprotocols a subscriber can negotiate. JSON is used when the
+// client asks for none.
+const (
+	ProtocolJSON     = "gatify.stats.v1.json"
+	ProtocolProtobuf = "gatify.stats.v1.proto"
+)
+
+const (
+	// websocketGUID is the fixed key suffix from RFC 6455.
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// subscriberBuffer is how many events a slow subscriber may lag by
+	// before events are dropped.
+	subscriberBuffer = 1024
+	// writeTimeout disconnects subscribers that stop reading.
+	writeTimeout = 10 * time.Second
+	// maxClientFrame bounds the frames accepted from subscribers, who are
+	// only expected to send control frames.
+	maxClientFrame = 4096
+)
+
+// WebSocket opcodes.
+const (
+	opText   = 0x1
+	opBinary = 0x2
+	opClose  = 0x8
+	opPing   = 0x9
+	opPong   = 0xA
+)
+
+// ServeHTTP upgrades the request to a WebSocket and streams events until
+// the client disconnects or the broker is closed.
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	protocol, err := negotiateProtocol(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	conn, err := upgrade(w, r, protocol)
+	if err != nil {
+		log.Printf("Stats stream upgrade failed: %v", err)
+		return
+	}
+	defer conn.close()
+
+	sub := b.SubscribeAs(subscriberBuffer, SubscriberInfo{Transport: "websocket", Remote: r.RemoteAddr})
+	defer sub.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn.readLoop()
+	}()
+
+	meta := time.NewTicker(MetaInterval)
+	defer meta.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-meta.C:
+			if e, ok := sub.Meta(); ok {
+				if err := conn.write(encode(e, protocol)); err != nil {
+					return
+				}
+			}
+		case e, ok := <-sub.Events():
+			if !ok {
+				_ = conn.write(opClose, closePayload(1001, "server shutting down"))
+				return
+			}
+			if err := conn.write(encode(e, protocol)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func encode(e Event, protocol string) (byte, []byte) {
+	if protocol == ProtocolProtobuf {
+		return opBinary, e.MarshalProto()
+	}
+	payload, _ := json.Marshal(e)
+	return opText, payload
+}
+
+// negotiateProtocol picks the first subprotocol the client offered that
+// the server supports.
+func negotiateProtocol(r *http.Request) (string, error) {
+	offered := r.Header.Values("Sec-WebSocket-Protocol")
+	if len(offered) == 0 {
+		return ProtocolJSON, nil
+	}
+	for _, line := range offered {
+		for _, p := range strings.Split(line, ",") {
+			switch p = strings.TrimSpace(p); p {
+			case ProtocolJSON, ProtocolProtobuf:
+				return p, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unsupported subprotocol: use %s or %s", ProtocolJSON, ProtocolProtobuf)
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgrade performs the RFC 6455 opening handshake on a hijacked
+// connection.
+func upgrade(w http.ResponseWriter, r *http.Request, protocol string) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet ||
+		!headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return nil, errors.New("not a websocket handshake")
+	}
+
+	netConn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, err
+	}
+	// The server's read and write timeouts would otherwise cut the
+	// long-lived stream short.
+	_ = netConn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n", base64.StdEncoding.EncodeToString(sum[:]))
+	if r.Header.Get("Sec-WebSocket-Protocol") != "" {
+		fmt.Fprintf(rw, "Sec-WebSocket-Protocol: %s\r\n", protocol)
+	}
+	rw.WriteString("\r\n")
+	if err := rw.Flush(); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: netConn, br: rw.Reader}, nil
+}
+
+// wsConn is the server side of a WebSocket connection.
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	mu   sync.Mutex
+}
+
+func (c *wsConn) close() { c.conn.Close() }
+
+// write sends one unfragmented, unmasked frame.
+func (c *wsConn) write(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header := make([]byte, 0, 10)
+	header = append(header, 0x80|opcode)
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readLoop answers pings and returns when the client closes the
+// connection or sends something invalid.
+func (c *wsConn) readLoop() {
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case opPing:
+			if err := c.write(opPong, payload); err != nil {
+				return
+			}
+		case opClose:
+			_ = c.write(opClose, payload)
+			return
+		}
+	}
+}
+
+// readFrame reads one masked client frame.
+func (c *wsConn) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := head[0] & 0x0F
+	if head[1]&0x80 == 0 {
+		return 0, nil, errors.New("client frame not masked")
+	}
+
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxClientFrame {
+		return 0, nil, errors.New("client frame too large")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+func closePayload(code uint16, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, code), reason...)
+}
@@ -0,0 +1,158 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dial performs a client handshake against srv and returns the connection
+// and the handshake response.
+func dial(t *testing.T, srv *httptest.Server, protocol string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Dial error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	req := "GET / HTTP/1.1\r\nHost: gatify\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"
+	if protocol != "" {
+		req += "Sec-WebSocket-Protocol: " + protocol + "\r\n"
+	}
+	if _, err := conn.Write([]byte(req + "\r\n")); err != nil {
+		t.Fatalf("Write error = %v", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("ReadResponse error = %v", err)
+	}
+	return conn, br, resp
+}
+
+func readServerFrame(t *testing.T, conn net.Conn, br *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var head [2]byte
+	if _, err := io.ReadFull(br, head[:]); err != nil {
+		t.Fatalf("Read frame error = %v", err)
+	}
+	n := int(head[1] & 0x7F)
+	if n == 126 {
+		var ext [2]byte
+		_, _ = io.ReadFull(br, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatalf("Read payload error = %v", err)
+	}
+	return head[0] & 0x0F, payload
+}
+
+func writeClientFrame(t *testing.T, conn net.Conn, opcode byte, payload []byte) {
+	t.Helper()
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Write frame error = %v", err)
+	}
+}
+
+func waitForSubscribers(t *testing.T, b *Broker, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for b.Subscribers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d subscribers, got %d", n, b.Subscribers())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebSocketJSON(t *testing.T) {
+	b := NewBroker()
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	conn, br, resp := dial(t, srv, "")
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Unexpected accept key %q", got)
+	}
+	waitForSubscribers(t, b, 1)
+
+	b.Publish(Event{Path: "/users", Status: 200})
+	opcode, payload := readServerFrame(t, conn, br)
+	var e Event
+	if opcode != opText || json.Unmarshal(payload, &e) != nil || e.Path != "/users" {
+		t.Errorf("Unexpected JSON frame %d %s", opcode, payload)
+	}
+
+	writeClientFrame(t, conn, opPing, []byte("hi"))
+	if opcode, payload := readServerFrame(t, conn, br); opcode != opPong || string(payload) != "hi" {
+		t.Errorf("Expected pong, got %d %q", opcode, payload)
+	}
+
+	writeClientFrame(t, conn, opClose, nil)
+	waitForSubscribers(t, b, 0)
+}
+
+func TestWebSocketProtobuf(t *testing.T) {
+	b := NewBroker()
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	conn, br, resp := dial(t, srv, "mqtt, "+ProtocolProtobuf)
+	if resp.Header.Get("Sec-WebSocket-Protocol") != ProtocolProtobuf {
+		t.Fatalf("Expected protobuf subprotocol, got %q", resp.Header.Get("Sec-WebSocket-Protocol"))
+	}
+	waitForSubscribers(t, b, 1)
+
+	b.Publish(Event{Path: "/users", Status: 429})
+	opcode, payload := readServerFrame(t, conn, br)
+	if opcode != opBinary || decodeProto(t, payload)[fieldPath] != "/users" {
+		t.Errorf("Unexpected protobuf frame %d %x", opcode, payload)
+	}
+
+	b.Close()
+	if opcode, _ := readServerFrame(t, conn, br); opcode != opClose {
+		t.Errorf("Expected close frame on shutdown, got %d", opcode)
+	}
+}
+
+func TestWebSocketRejectsBadHandshake(t *testing.T) {
+	b := NewBroker()
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	_, _, resp := dial(t, srv, "mqtt")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unsupported subprotocol, got %d", resp.StatusCode)
+	}
+
+	plain, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	plain.Body.Close()
+	if plain.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("Expected 426 without upgrade headers, got %d", plain.StatusCode)
+	}
+}
@@ -0,0 +1,146 @@
+// Package suggest proposes rate limit rules from recent traffic
+package suggest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+// Suggestion kinds.
+const (
+	// KindUnprotectedRoute flags a busy route no rule covers.
+	KindUnprotectedRoute = "unprotected_route"
+	// KindHeavyClient flags a route on which some client exceeded a
+	// reasonable request rate.
+	KindHeavyClient = "heavy_client"
+)
+
+// Defaults for Options left zero.
+const (
+	DefaultMinRequests   = 100
+	DefaultReasonableRPM = 120
+	// headroom multiplies a route's typical per-client rate so that the
+	// suggested limit only bites well above normal use.
+	headroom = 2
+	// maxRoutes and maxClients bound the traffic examined.
+	maxRoutes  = 20
+	maxClients = 50
+)
+
+// Source answers the analytics queries suggestions are built from.
+type Source interface {
+	UnprotectedRoutes(ctx context.Context, since time.Time, minRequests int64, limit int) ([]analytics.RouteTraffic, error)
+	HeavyClients(ctx context.Context, since time.Time, minRPM int64, limit int) ([]analytics.ClientRate, error)
+}
+
+// Options tunes what counts as worth a suggestion.
+type Options struct {
+	// MinRequests is the traffic an unprotected route needs to be
+	// suggested on its own.
+	MinRequests int64
+	// ReasonableRPM is the per-client requests per minute above which a
+	// client is flagged.
+	ReasonableRPM int64
+}
+
+// Suggestion is a candidate rule with the traffic that motivated it. The
+// rule is not saved; it can be reviewed and posted to /api/rules as is.
+type Suggestion struct {
+	Kind   string     `json:"kind"`
+	Reason string     `json:"reason"`
+	Rule   rules.Rule `json:"rule"`
+	// Total and PeakClientRPM describe the route's unprotected traffic.
+	Total         int64 `json:"total"`
+	PeakClientRPM int64 `json:"peak_client_rpm"`
+	// HeavyClients lists clients that exceeded ReasonableRPM on the route.
+	HeavyClients []string `json:"heavy_clients,omitempty"`
+}
+
+// Analyze examines traffic since the given time and returns suggestions,
+// busiest route first.
+func Analyze(ctx context.Context, src Source, since time.Time, opts Options) ([]Suggestion, error) {
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = DefaultMinRequests
+	}
+	if opts.ReasonableRPM <= 0 {
+		opts.ReasonableRPM = DefaultReasonableRPM
+	}
+
+	routes, err := src.UnprotectedRoutes(ctx, since, opts.MinRequests, maxRoutes)
+	if err != nil {
+		return nil, fmt.Errorf("suggest routes: %w", err)
+	}
+	clients, err := src.HeavyClients(ctx, since, opts.ReasonableRPM, maxClients)
+	if err != nil {
+		return nil, fmt.Errorf("suggest clients: %w", err)
+	}
+
+	byRoute := make(map[string]*Suggestion)
+	var out []*Suggestion
+	for _, rt := range routes {
+		rule := candidate(rt.Method, rt.Route, max(int64(math.Ceil(rt.P95ClientRPM*headroom)), 1))
+		if rule.Validate() != nil {
+			continue
+		}
+		s := &Suggestion{
+			Kind: KindUnprotectedRoute,
+			Reason: fmt.Sprintf("%d requests from %d clients matched no rule; clients typically sent up to %.0f per minute",
+				rt.Total, rt.Clients, rt.P95ClientRPM),
+			Rule:          rule,
+			Total:         rt.Total,
+			PeakClientRPM: rt.PeakClientRPM,
+		}
+		byRoute[rt.Method+" "+rt.Route] = s
+		out = append(out, s)
+	}
+
+	for _, c := range clients {
+		key := c.Method + " " + c.Route
+		s, ok := byRoute[key]
+		if !ok {
+			rule := candidate(c.Method, c.Route, opts.ReasonableRPM)
+			if rule.Validate() != nil {
+				continue
+			}
+			s = &Suggestion{
+				Kind: KindHeavyClient,
+				Reason: fmt.Sprintf("clients sent more than %d requests per minute to a route no rule matches",
+					opts.ReasonableRPM),
+				Rule: rule,
+			}
+			byRoute[key] = s
+			out = append(out, s)
+		}
+		s.Total = max(s.Total, c.Total)
+		s.PeakClientRPM = max(s.PeakClientRPM, c.PeakRPM)
+		s.HeavyClients = append(s.HeavyClients, c.ClientID)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Total > out[j].Total })
+	list := make([]Suggestion, len(out))
+	for i, s := range out {
+		list[i] = *s
+	}
+	return list, nil
+}
+
+// candidate returns a per-IP rule limiting method requests to route.
+// Unmatched traffic is always identified by IP, so that is the only
+// identity the analytics can vouch for.
+func candidate(method, route string, perMinute int64) rules.Rule {
+	return rules.Rule{
+		Name:          "suggested " + method + " " + route,
+		Pattern:       route,
+		Methods:       []string{method},
+		Limit:         perMinute,
+		WindowSeconds: 60,
+		IdentifyBy:    rules.IdentifyByIP,
+		Enabled:       true,
+	}
+}
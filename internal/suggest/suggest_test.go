@@ -0,0 +1,72 @@
+package suggest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/analytics"
+)
+
+type fakeSource struct {
+	routes  []analytics.RouteTraffic
+	clients []analytics.ClientRate
+	err     error
+	minRPM  int64
+}
+
+func (f *fakeSource) UnprotectedRoutes(_ context.Context, _ time.Time, _ int64, _ int) ([]analytics.RouteTraffic, error) {
+	return f.routes, f.err
+}
+
+func (f *fakeSource) HeavyClients(_ context.Context, _ time.Time, minRPM int64, _ int) ([]analytics.ClientRate, error) {
+	f.minRPM = minRPM
+	return f.clients, nil
+}
+
+func TestAnalyze(t *testing.T) {
+	src := &fakeSource{
+		routes: []analytics.RouteTraffic{
+			{Method: "GET", Route: "/search", Total: 900, Clients: 30, P95ClientRPM: 12.2, PeakClientRPM: 200},
+			{Method: "GET", Route: "relative", Total: 800},
+		},
+		clients: []analytics.ClientRate{
+			{ClientID: "ip:1.1.1.1", Method: "GET", Route: "/search", PeakRPM: 200, Total: 400},
+			{ClientID: "ip:2.2.2.2", Method: "POST", Route: "/login", PeakRPM: 150, Total: 2000},
+		},
+	}
+
+	got, err := Analyze(context.Background(), src, time.Now().Add(-time.Hour), Options{})
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+	if src.minRPM != DefaultReasonableRPM {
+		t.Errorf("Expected default reasonable rate, got %d", src.minRPM)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 suggestions, got %+v", got)
+	}
+
+	login, search := got[0], got[1]
+	if login.Kind != KindHeavyClient || login.Rule.Pattern != "/login" || login.Rule.Limit != DefaultReasonableRPM ||
+		login.Rule.Methods[0] != "POST" || login.HeavyClients[0] != "ip:2.2.2.2" {
+		t.Errorf("Unexpected heavy client suggestion %+v", login)
+	}
+	if search.Kind != KindUnprotectedRoute || search.Rule.Limit != 25 || search.Rule.WindowSeconds != 60 ||
+		len(search.HeavyClients) != 1 || search.PeakClientRPM != 200 {
+		t.Errorf("Unexpected route suggestion %+v", search)
+	}
+	for _, s := range got {
+		if err := s.Rule.Validate(); err != nil {
+			t.Errorf("Suggested rule %s is invalid: %v", s.Rule.Name, err)
+		}
+	}
+}
+
+func TestAnalyzeError(t *testing.T) {
+	src := &fakeSource{err: errors.New("db down")}
+	if _, err := Analyze(context.Background(), src, time.Now(), Options{}); err == nil {
+		t.Error("Expected source error to propagate")
+	}
+}
@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExporterPostsOTLPJSON(t *testing.T) {
+	received := make(chan otlpRequest, 1)
+	var auth string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("Unexpected export path %s", r.URL.Path)
+		}
+		auth = r.Header.Get("Authorization")
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Decode export: %v", err)
+		}
+		received <- req
+	}))
+	defer collector.Close()
+
+	exporter := NewExporter(collector.URL+"/", "edge", map[string]string{"Authorization": "Bearer abc"})
+	tracer := NewTracer(exporter, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		exporter.Run(ctx, time.Hour)
+		close(done)
+	}()
+
+	spanCtx, server := tracer.StartServer(context.Background(), "GET", SpanContext{})
+	_, child := Start(spanCtx, "redis EVALSHA", KindClient)
+	child.SetAttr("db.system", "redis")
+	child.SetError(errors.New("connection refused"))
+	child.End()
+	server.SetAttr("http.response.status_code", 200)
+	server.End()
+
+	// Shutdown flushes what is queued.
+	cancel()
+	<-done
+
+	var req otlpRequest
+	select {
+	case req = <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an export on shutdown")
+	}
+	if auth != "Bearer abc" {
+		t.Errorf("Expected configured headers, got Authorization %q", auth)
+	}
+	rs := req.ResourceSpans[0]
+	if v := rs.Resource.Attributes[0]; v.Key != "service.name" || *v.Value.StringValue != "edge" {
+		t.Errorf("Unexpected resource %+v", rs.Resource)
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	redis, root := spans[0], spans[1]
+	if redis.TraceID != root.TraceID || redis.ParentSpanID != root.SpanID || root.ParentSpanID != "" {
+		t.Errorf("Unexpected span linkage: %+v, %+v", redis, root)
+	}
+	if redis.Kind != KindClient || redis.Status == nil || redis.Status.Code != statusError || redis.Status.Message != "connection refused" {
+		t.Errorf("Unexpected client span %+v", redis)
+	}
+	if root.Attributes[0].Key != "http.response.status_code" || *root.Attributes[0].Value.IntValue != "200" {
+		t.Errorf("Unexpected attributes %+v", root.Attributes)
+	}
+	if root.StartTimeUnixNano == "" || root.EndTimeUnixNano < root.StartTimeUnixNano {
+		t.Errorf("Unexpected timestamps %s..%s", root.StartTimeUnixNano, root.EndTimeUnixNano)
+	}
+}
+
+func TestExporterDropsWhenQueueFull(t *testing.T) {
+	exporter := NewExporter("http://collector", "gatify", nil)
+	tracer := NewTracer(exporter, 1)
+	for i := 0; i < exportQueueSize+5; i++ {
+		_, span := tracer.StartRoot(context.Background(), "job")
+		span.End()
+	}
+	if got := exporter.Dropped(); got != 5 {
+		t.Errorf("Dropped() = %d, want 5", got)
+	}
+}
@@ -0,0 +1,229 @@
+// Package tracing records OpenTelemetry-compatible spans and propagates W3C trace
+// context, with no dependency on the OpenTelemetry SDK.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader carries W3C trace context.
+const TraceparentHeader = "Traceparent"
+
+// Span kinds, numbered as in OTLP.
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// SpanContext identifies a span within a trace.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// Valid reports whether sc has non-zero trace and span IDs.
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats sc as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent parses a W3C traceparent header value.
+func ParseTraceparent(v string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	// Version 00 has exactly four fields; later versions may append more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	var flags [1]byte
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.Valid()
+}
+
+// Tracer creates spans and hands finished ones to its exporter. A nil
+// Tracer creates no spans.
+type Tracer struct {
+	sampleRatio float64
+	exporter    *Exporter
+}
+
+// NewTracer creates a Tracer that samples the given ratio of new traces
+// and exports finished spans through exporter. Traces started elsewhere
+// keep the sampling decision of their traceparent.
+func NewTracer(exporter *Exporter, sampleRatio float64) *Tracer {
+	return &Tracer{sampleRatio: math.Max(0, math.Min(1, sampleRatio)), exporter: exporter}
+}
+
+// Span is an operation within a trace. Methods on a nil Span do nothing,
+// so callers never need to check whether tracing is enabled.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent [8]byte
+	name   string
+	kind   int
+	start  time.Time
+
+	mu     sync.Mutex
+	end    time.Time
+	attrs  []attribute
+	errMsg string
+	failed bool
+	ended  bool
+}
+
+type attribute struct {
+	key   string
+	value any
+}
+
+type spanKey struct{}
+
+// FromContext returns the span carried by ctx, if any.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// StartServer starts the root span of an incoming request, continuing the
+// trace of remote when it is valid.
+func (t *Tracer) StartServer(ctx context.Context, name string, remote SpanContext) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	sc := SpanContext{SpanID: newSpanID()}
+	var parent [8]byte
+	if remote.Valid() {
+		sc.TraceID, sc.Sampled, parent = remote.TraceID, remote.Sampled, remote.SpanID
+	} else {
+		sc.TraceID = newTraceID()
+		sc.Sampled = t.sample(sc.TraceID)
+	}
+	return t.start(ctx, name, KindServer, sc, parent)
+}
+
+// StartRoot starts a span beginning a new trace, for background work.
+func (t *Tracer) StartRoot(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	sc := SpanContext{TraceID: newTraceID(), SpanID: newSpanID()}
+	sc.Sampled = t.sample(sc.TraceID)
+	return t.start(ctx, name, KindInternal, sc, [8]byte{})
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind int, sc SpanContext, parent [8]byte) (context.Context, *Span) {
+	s := &Span{tracer: t, sc: sc, parent: parent, name: name, kind: kind, start: time.Now()}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Start starts a child of the span in ctx. Without one, for example when
+// tracing is disabled, it returns ctx unchanged and a nil Span.
+func Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	sc := SpanContext{TraceID: parent.sc.TraceID, SpanID: newSpanID(), Sampled: parent.sc.Sampled}
+	return parent.tracer.start(ctx, name, kind, sc, parent.sc.SpanID)
+}
+
+// Context returns the span's identity, for propagation.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttr records an attribute. Values are exported as strings, integers,
+// floats or booleans.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attribute{key: key, value: value})
+}
+
+// SetError marks the span as failed with err. A nil err is ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+	s.errMsg = err.Error()
+}
+
+// End finishes the span and queues it for export if it is sampled.
+// Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+	if s.sc.Sampled {
+		s.tracer.exporter.enqueue(s)
+	}
+}
+
+// sample decides from the trace ID, so every instance seeing the same
+// trace agrees.
+func (t *Tracer) sample(id [16]byte) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	return float64(binary.BigEndian.Uint64(id[8:])) < t.sampleRatio*math.MaxUint64
+}
+
+func newTraceID() [16]byte {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+func newSpanID() [8]byte {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	return id
+}
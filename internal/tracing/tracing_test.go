@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	const header = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(header)
+	if !ok || !sc.Sampled {
+		t.Fatalf("ParseTraceparent(%q) = %+v, %v", header, sc, ok)
+	}
+	if got := sc.Traceparent(); got != header {
+		t.Errorf("Traceparent() = %q, want %q", got, header)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01",
+	} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+
+	// Future versions may append fields.
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); !ok {
+		t.Error("Expected a future version with extra fields to parse")
+	}
+}
+
+func TestSpansFollowTheirParent(t *testing.T) {
+	tracer := NewTracer(NewExporter("http://collector", "gatify", nil), 1)
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, server := tracer.StartServer(context.Background(), "GET", remote)
+	_, child := Start(ctx, "limiter gcra", KindInternal)
+	if server.Context().TraceID != remote.TraceID || child.Context().TraceID != remote.TraceID {
+		t.Error("Expected spans to continue the remote trace")
+	}
+	if server.parent != remote.SpanID || child.parent != server.Context().SpanID {
+		t.Error("Expected each span to point at its parent")
+	}
+	child.End()
+	server.End()
+	server.End()
+	if n := len(tracer.exporter.queue); n != 2 {
+		t.Errorf("Expected 2 queued spans, got %d", n)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	never := NewTracer(NewExporter("http://collector", "gatify", nil), 0)
+	_, span := never.StartRoot(context.Background(), "job")
+	span.SetAttr("ignored", true)
+	span.End()
+	if span.Context().Sampled || len(never.exporter.queue) != 0 {
+		t.Error("Expected a zero ratio to record nothing")
+	}
+
+	// A sampled caller overrides the local ratio.
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if _, span := never.StartServer(context.Background(), "GET", remote); !span.Context().Sampled {
+		t.Error("Expected the caller's sampling decision to be kept")
+	}
+}
+
+func TestDisabledTracing(t *testing.T) {
+	var tracer *Tracer
+	ctx, span := tracer.StartServer(context.Background(), "GET", SpanContext{})
+	if span != nil || FromContext(ctx) != nil {
+		t.Fatal("Expected a nil tracer to create no span")
+	}
+	ctx, span = Start(ctx, "redis GET", KindClient)
+	span.SetAttr("db.system", "redis")
+	span.SetError(context.Canceled)
+	span.End()
+	if span != nil || FromContext(ctx) != nil {
+		t.Error("Expected no child span without a parent")
+	}
+}
@@ -0,0 +1,218 @@
+package upstream
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Circuit states.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// Breaker defaults applied to zero-valued BreakerConfig fields.
+const (
+	DefaultFailureRatio  = 0.5
+	DefaultMinRequests   = 20
+	DefaultBreakerWindow = 30 * time.Second
+	DefaultOpenDuration  = 30 * time.Second
+)
+
+// BreakerConfig configures when a circuit opens and how long it stays open.
+type BreakerConfig struct {
+	// FailureRatio is the share of failed requests in a window that opens
+	// the circuit, once the window has seen MinRequests.
+	FailureRatio float64
+	MinRequests  int
+	// Window is how long failures are counted before the tally restarts.
+	Window time.Duration
+	// OpenDuration is how long an open circuit rejects requests before a
+	// single probe is let through.
+	OpenDuration time.Duration
+}
+
+func (c BreakerConfig) withDefaults() BreakerConfig {
+	if c.FailureRatio <= 0 {
+		c.FailureRatio = DefaultFailureRatio
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = DefaultMinRequests
+	}
+	if c.Window <= 0 {
+		c.Window = DefaultBreakerWindow
+	}
+	if c.OpenDuration <= 0 {
+		c.OpenDuration = DefaultOpenDuration
+	}
+	return c
+}
+
+// BreakerStatus is a target's circuit as seen by this instance, with
+// counters since startup.
+type BreakerStatus struct {
+	Target   string    `json:"target"`
+	State    string    `json:"state"`
+	OpenedAt time.Time `json:"opened_at,omitempty"`
+	// Requests and Failures cover the current window.
+	Requests int `json:"requests"`
+	Failures int `json:"failures"`
+	// Opens counts how often the circuit opened; ShortCircuited counts
+	// requests rejected while it was open.
+	Opens          uint64 `json:"opens"`
+	ShortCircuited uint64 `json:"short_circuited"`
+}
+
+type circuit struct {
+	status      BreakerStatus
+	windowStart time.Time
+	probeAt     time.Time // when the half-open probe was let through
+}
+
+// Breaker passively tracks the outcome of proxied requests per target and
+// opens a target's circuit when too many of them fail. Unlike Checker it
+// needs no health endpoint: it reacts to real traffic. A nil Breaker lets
+// every request through.
+type Breaker struct {
+	cfg BreakerConfig
+	now func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// NewBreaker creates a Breaker with every circuit closed.
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	return &Breaker{cfg: cfg.withDefaults(), now: time.Now, circuits: make(map[string]*circuit)}
+}
+
+// Allow reports whether a request may be sent to name. Once an open
+// circuit's OpenDuration has passed, one probe request is allowed through
+// and the circuit is half-open until its outcome is recorded. A probe
+// whose outcome never arrives is replaced after another OpenDuration.
+func (b *Breaker) Allow(name string) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[name]
+	if !ok {
+		return true
+	}
+	now := b.now()
+	switch c.status.State {
+	case CircuitOpen:
+		if now.Sub(c.status.OpenedAt) < b.cfg.OpenDuration {
+			c.status.ShortCircuited++
+			return false
+		}
+		c.status.State = CircuitHalfOpen
+		c.probeAt = now
+		return true
+	case CircuitHalfOpen:
+		if now.Sub(c.probeAt) < b.cfg.OpenDuration {
+			c.status.ShortCircuited++
+			return false
+		}
+		c.probeAt = now
+		return true
+	}
+	return true
+}
+
+// Closed reports whether name's circuit is closed. Unlike Allow it
+// neither counts a short-circuit nor claims a half-open probe, so optional
+// traffic such as hedged requests can check it without side effects.
+func (b *Breaker) Closed(name string) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.circuits[name]
+	return !ok || c.status.State == CircuitClosed
+}
+
+// Record reports the outcome of a request sent to name. A failure is a
+// 5xx response, a timeout or a failed connection.
+func (b *Breaker) Record(name string, failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	c, ok := b.circuits[name]
+	if !ok {
+		c = &circuit{status: BreakerStatus{Target: name, State: CircuitClosed}}
+		b.circuits[name] = c
+	}
+	now := b.now()
+	transition := ""
+
+	switch c.status.State {
+	case CircuitHalfOpen:
+		if failed {
+			b.open(c, now)
+			transition = "reopened"
+		} else {
+			c.status.State = CircuitClosed
+			c.status.OpenedAt = time.Time{}
+			c.status.Requests, c.status.Failures = 0, 0
+			c.windowStart = now
+			transition = CircuitClosed
+		}
+	case CircuitClosed:
+		if now.Sub(c.windowStart) >= b.cfg.Window {
+			c.windowStart = now
+			c.status.Requests, c.status.Failures = 0, 0
+		}
+		c.status.Requests++
+		if failed {
+			c.status.Failures++
+		}
+		if c.status.Requests >= b.cfg.MinRequests &&
+			float64(c.status.Failures) >= b.cfg.FailureRatio*float64(c.status.Requests) {
+			b.open(c, now)
+			transition = CircuitOpen
+		}
+	case CircuitOpen:
+		// Stragglers admitted before the circuit opened are ignored.
+	}
+	status := c.status
+	b.mu.Unlock()
+
+	switch transition {
+	case CircuitOpen:
+		log.Printf("🔌 Circuit for upstream %s opened: %d of %d requests failed", name, status.Failures, status.Requests)
+	case "reopened":
+		log.Printf("🔌 Circuit for upstream %s stays open: probe failed", name)
+	case CircuitClosed:
+		log.Printf("✅ Circuit for upstream %s closed after a successful probe", name)
+	}
+}
+
+func (b *Breaker) open(c *circuit, now time.Time) {
+	c.status.State = CircuitOpen
+	c.status.OpenedAt = now
+	c.status.Opens++
+}
+
+// Statuses returns the circuit of every target that has seen traffic,
+// ordered by target name.
+func (b *Breaker) Statuses() []BreakerStatus {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]BreakerStatus, 0, len(b.circuits))
+	for _, c := range b.circuits {
+		out = append(out, c.status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Target < out[j].Target })
+	return out
+}
@@ -0,0 +1,95 @@
+package upstream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAndProbes(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(BreakerConfig{FailureRatio: 0.5, MinRequests: 4, OpenDuration: 10 * time.Second})
+	b.now = func() time.Time { return now }
+
+	b.Record("a", false)
+	b.Record("a", true)
+	b.Record("a", true)
+	if !b.Allow("a") {
+		t.Fatal("Expected circuit closed below MinRequests")
+	}
+	b.Record("a", false)
+	if b.Allow("a") || b.Allow("a") {
+		t.Fatal("Expected circuit open after half the requests failed")
+	}
+	if !b.Allow("b") {
+		t.Error("Expected other targets unaffected")
+	}
+
+	now = now.Add(10 * time.Second)
+	if !b.Allow("a") {
+		t.Fatal("Expected a probe after OpenDuration")
+	}
+	if b.Allow("a") {
+		t.Error("Expected only one probe while half-open")
+	}
+	b.Record("a", true)
+	if b.Allow("a") {
+		t.Fatal("Expected a failed probe to reopen the circuit")
+	}
+
+	now = now.Add(10 * time.Second)
+	b.Allow("a")
+	b.Record("a", false)
+	if !b.Allow("a") {
+		t.Fatal("Expected a successful probe to close the circuit")
+	}
+
+	st := b.Statuses()
+	if len(st) != 1 || st[0].State != CircuitClosed || st[0].Opens != 2 || st[0].ShortCircuited != 4 {
+		t.Errorf("Unexpected statuses %+v", st)
+	}
+}
+
+func TestBreakerWindowResets(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(BreakerConfig{MinRequests: 2, Window: time.Minute})
+	b.now = func() time.Time { return now }
+
+	b.Record("a", true)
+	now = now.Add(time.Minute)
+	b.Record("a", true)
+	if !b.Allow("a") {
+		t.Error("Expected failures in different windows not to add up")
+	}
+}
+
+func TestBreakerClosedHasNoSideEffects(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(BreakerConfig{MinRequests: 1, OpenDuration: 10 * time.Second})
+	b.now = func() time.Time { return now }
+
+	if !b.Closed("a") {
+		t.Fatal("Expected an unseen target closed")
+	}
+	b.Record("a", true)
+	now = now.Add(10 * time.Second)
+	if b.Closed("a") {
+		t.Fatal("Expected an open circuit not closed")
+	}
+	if !b.Allow("a") {
+		t.Error("Expected Closed not to claim the half-open probe")
+	}
+	if b.Closed("a") {
+		t.Error("Expected a half-open circuit not closed")
+	}
+	if st := b.Statuses(); st[0].ShortCircuited != 0 {
+		t.Errorf("Expected Closed not to count short-circuits, got %d", st[0].ShortCircuited)
+	}
+}
+
+func TestNilBreaker(t *testing.T) {
+	var b *Breaker
+	b.Record("a", true)
+	if !b.Allow("a") || !b.Closed("a") || b.Statuses() != nil {
+		t.Error("Expected a nil breaker to allow everything")
+	}
+}
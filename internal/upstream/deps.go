@@ -0,0 +1,186 @@
+package upstream
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Dependency is a service the gateway needs besides its backends, such as
+// the rate limit storage or the analytics database.
+type Dependency struct {
+	Name string
+	Ping func(ctx context.Context) error
+	// Critical dependencies take the gateway out of rotation while they
+	// are unreachable; the others are only reported.
+	Critical bool
+}
+
+// DependencyStatus is a dependency's current health as seen by this
+// instance.
+type DependencyStatus struct {
+	Name      string    `json:"name"`
+	Critical  bool      `json:"critical"`
+	Healthy   bool      `json:"healthy"`
+	Probed    bool      `json:"probed"`
+	LastCheck time.Time `json:"last_check,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	LatencyMS int64     `json:"latency_ms"`
+}
+
+type dependencyState struct {
+	dep    Dependency
+	status DependencyStatus
+	streak int
+}
+
+// Dependencies pings dependencies on an interval and answers readiness
+// from memory. Dependencies start unprobed, so a gateway is not ready
+// until each critical one has answered once; a nil Dependencies is always
+// ready.
+type Dependencies struct {
+	check HealthCheck
+
+	mu   sync.RWMutex
+	deps []*dependencyState
+}
+
+// NewDependencies creates a checker pinging deps every check.Interval,
+// each ping bounded by check.Timeout. Like backends, a dependency flips
+// state after check.Threshold consecutive disagreeing results.
+func NewDependencies(check HealthCheck, deps ...Dependency) *Dependencies {
+	d := &Dependencies{check: check.withDefaults()}
+	for _, dep := range deps {
+		d.deps = append(d.deps, &dependencyState{
+			dep:    dep,
+			status: DependencyStatus{Name: dep.Name, Critical: dep.Critical},
+		})
+	}
+	return d
+}
+
+// Ready reports whether every critical dependency is reachable.
+func (d *Dependencies) Ready() bool {
+	if d == nil {
+		return true
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, ds := range d.deps {
+		if ds.dep.Critical && !ds.status.Healthy {
+			return false
+		}
+	}
+	return true
+}
+
+// Statuses returns every dependency's status in registration order.
+func (d *Dependencies) Statuses() []DependencyStatus {
+	if d == nil {
+		return nil
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	out := make([]DependencyStatus, 0, len(d.deps))
+	for _, ds := range d.deps {
+		out = append(out, ds.status)
+	}
+	return out
+}
+
+// Run pings every dependency on the interval until ctx is cancelled.
+func (d *Dependencies) Run(ctx context.Context) {
+	if d == nil {
+		return
+	}
+	ticker := time.NewTicker(d.check.Interval)
+	defer ticker.Stop()
+	for {
+		d.probe(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dependencies) probe(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range d.deps {
+		wg.Add(1)
+		go func(ds *dependencyState) {
+			defer wg.Done()
+			pingCtx, cancel := context.WithTimeout(ctx, d.check.Timeout)
+			defer cancel()
+			start := time.Now()
+			err := ds.dep.Ping(pingCtx)
+			d.record(ds, err, start, time.Since(start))
+		}(d.deps[i])
+	}
+	wg.Wait()
+}
+
+// record applies a ping result the way Checker.record applies a probe.
+func (d *Dependencies) record(ds *dependencyState, pingErr error, now time.Time, latency time.Duration) {
+	d.mu.Lock()
+	healthy := pingErr == nil
+	ds.status.LastCheck = now
+	ds.status.LatencyMS = latency.Milliseconds()
+	ds.status.LastError = ""
+	if pingErr != nil {
+		ds.status.LastError = pingErr.Error()
+	}
+
+	flip := false
+	switch {
+	case !ds.status.Probed:
+		ds.status.Probed = true
+		ds.status.Healthy = healthy
+		flip = !healthy
+	case healthy == ds.status.Healthy:
+		ds.streak = 0
+	default:
+		ds.streak++
+		flip = ds.streak >= d.check.Threshold
+	}
+	if flip {
+		ds.status.Healthy = healthy
+		ds.streak = 0
+	}
+	lastError := ds.status.LastError
+	d.mu.Unlock()
+
+	switch {
+	case !flip:
+	case healthy:
+		log.Printf("✅ %s is reachable again", ds.dep.Name)
+	default:
+		log.Printf("⚠️  %s is unreachable: %s", ds.dep.Name, lastError)
+	}
+}
+
+// Gateway readiness states reported in Report.Status.
+const (
+	StatusReady       = "ready"
+	StatusStarting    = "starting"
+	StatusUnavailable = "unavailable"
+	// StatusStandby is a warm standby's state until it is promoted.
+	StatusStandby = "standby"
+)
+
+// Report is the gateway's health as served at /ready and
+// /api/stats/health.
+type Report struct {
+	Status       string             `json:"status"`
+	RulesLoaded  bool               `json:"rules_loaded"`
+	Upstreams    []Status           `json:"upstreams"`
+	Breakers     []BreakerStatus    `json:"breakers"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// Ready reports whether the gateway should receive traffic.
+func (r Report) Ready() bool {
+	return r.Status == StatusReady
+}
@@ -0,0 +1,72 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDependenciesReadiness(t *testing.T) {
+	var redisDown, dbDown atomic.Bool
+	ping := func(down *atomic.Bool) func(context.Context) error {
+		return func(context.Context) error {
+			if down.Load() {
+				return errors.New("connection refused")
+			}
+			return nil
+		}
+	}
+	d := NewDependencies(HealthCheck{Threshold: 2},
+		Dependency{Name: "redis", Ping: ping(&redisDown), Critical: true},
+		Dependency{Name: "postgres", Ping: ping(&dbDown)},
+	)
+	if d.Ready() {
+		t.Fatal("Expected not ready before the first ping")
+	}
+
+	dbDown.Store(true)
+	d.probe(context.Background())
+	if !d.Ready() {
+		t.Error("Expected a non-critical outage to leave the gateway ready")
+	}
+	statuses := d.Statuses()
+	if len(statuses) != 2 || !statuses[0].Healthy || statuses[1].Healthy || statuses[1].LastError != "connection refused" {
+		t.Errorf("Unexpected statuses %+v", statuses)
+	}
+
+	redisDown.Store(true)
+	d.probe(context.Background())
+	if !d.Ready() {
+		t.Error("Expected a single failed ping to be tolerated")
+	}
+	d.probe(context.Background())
+	if d.Ready() {
+		t.Error("Expected not ready once the critical dependency is down")
+	}
+
+	redisDown.Store(false)
+	d.probe(context.Background())
+	d.probe(context.Background())
+	if !d.Ready() {
+		t.Error("Expected ready again after recovery")
+	}
+}
+
+func TestDependenciesPingTimeout(t *testing.T) {
+	d := NewDependencies(HealthCheck{Timeout: 10 * time.Millisecond},
+		Dependency{Name: "redis", Critical: true, Ping: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}})
+	d.probe(context.Background())
+	if d.Ready() || d.Statuses()[0].LastError == "" {
+		t.Errorf("Expected a hanging ping to fail, got %+v", d.Statuses())
+	}
+
+	var nilDeps *Dependencies
+	if !nilDeps.Ready() || nilDeps.Statuses() != nil {
+		t.Error("Expected a nil Dependencies to be ready")
+	}
+}
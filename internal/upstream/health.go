@@ -0,0 +1,302 @@
+// Package upstream tracks the health of the backends the gateway proxies to
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultTarget names the backend configured through BACKEND_URL.
+const DefaultTarget = "default"
+
+// Health check defaults applied to zero-valued HealthCheck fields.
+const (
+	DefaultCheckInterval  = 10 * time.Second
+	DefaultCheckTimeout   = 2 * time.Second
+	DefaultExpectedStatus = http.StatusOK
+	// DefaultThreshold is how many consecutive results flip a target's
+	// state, so a single slow probe does not take a backend out.
+	DefaultThreshold = 2
+)
+
+// HealthCheck configures active probing of one target.
+type HealthCheck struct {
+	// Path is requested on the target; an empty path disables probing.
+	Path           string
+	Interval       time.Duration
+	Timeout        time.Duration
+	ExpectedStatus int
+	Threshold      int
+}
+
+func (h HealthCheck) withDefaults() HealthCheck {
+	if h.Interval <= 0 {
+		h.Interval = DefaultCheckInterval
+	}
+	if h.Timeout <= 0 {
+		h.Timeout = DefaultCheckTimeout
+	}
+	if h.ExpectedStatus == 0 {
+		h.ExpectedStatus = DefaultExpectedStatus
+	}
+	if h.Threshold <= 0 {
+		h.Threshold = DefaultThreshold
+	}
+	return h
+}
+
+// Target is a backend the gateway can route to.
+type Target struct {
+	Name  string
+	URL   *url.URL
+	Check HealthCheck
+}
+
+// Status is a target's current health as seen by this instance.
+type Status struct {
+	Target    string    `json:"target"`
+	URL       string    `json:"url"`
+	Healthy   bool      `json:"healthy"`
+	Probed    bool      `json:"probed"`
+	LastCheck time.Time `json:"last_check,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Transition reports a target changing between healthy and unhealthy.
+type Transition struct {
+	Target  string    `json:"target"`
+	Healthy bool      `json:"healthy"`
+	At      time.Time `json:"at"`
+	Error   string    `json:"error,omitempty"`
+}
+
+type targetState struct {
+	target  Target
+	status  Status
+	streak  int // consecutive results disagreeing with status.Healthy
+	enabled bool
+}
+
+// Checker actively probes targets and answers health lookups from memory,
+// so the proxy never waits on a probe. Targets start healthy until probes
+// prove otherwise; a nil Checker reports every target healthy.
+type Checker struct {
+	client       *http.Client
+	onTransition func(Transition)
+
+	mu      sync.RWMutex
+	targets map[string]*targetState
+	order   []string
+}
+
+// NewChecker creates a Checker for targets. onTransition, if non-nil, is
+// called whenever a target changes state.
+func NewChecker(targets []Target, onTransition func(Transition)) *Checker {
+	c := &Checker{
+		client: &http.Client{
+			Transport:     NewTransport(http.DefaultTransport),
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		onTransition: onTransition,
+		targets:      make(map[string]*targetState, len(targets)),
+	}
+	for _, t := range targets {
+		t.Check = t.Check.withDefaults()
+		c.targets[t.Name] = &targetState{
+			target:  t,
+			status:  Status{Target: t.Name, URL: t.URL.String(), Healthy: true},
+			enabled: t.Check.Path != "",
+		}
+		c.order = append(c.order, t.Name)
+	}
+	return c
+}
+
+// SetTransport makes probes use base, so they reach backends the way
+// proxied requests do. It must be called before Run.
+func (c *Checker) SetTransport(base http.RoundTripper) {
+	c.client.Transport = NewTransport(base)
+}
+
+// CloseIdleConnections closes the probes' idle connections.
+func (c *Checker) CloseIdleConnections() {
+	c.client.CloseIdleConnections()
+}
+
+// Healthy reports whether name may receive traffic. Unknown targets are
+// considered healthy.
+func (c *Checker) Healthy(name string) bool {
+	if c == nil {
+		return true
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ts, ok := c.targets[name]
+	return !ok || ts.status.Healthy
+}
+
+// Ready reports whether at least one target is healthy and every probed
+// target has completed its first check.
+func (c *Checker) Ready() bool {
+	if c == nil {
+		return true
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	healthy := false
+	for _, ts := range c.targets {
+		if ts.enabled && !ts.status.Probed {
+			return false
+		}
+		if ts.status.Healthy {
+			healthy = true
+		}
+	}
+	return healthy || len(c.targets) == 0
+}
+
+// Statuses returns every target's status in configuration order.
+func (c *Checker) Statuses() []Status {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]Status, 0, len(c.order))
+	for _, name := range c.order {
+		out = append(out, c.targets[name].status)
+	}
+	return out
+}
+
+// Run probes every target with a health check path on its interval until
+// ctx is cancelled.
+func (c *Checker) Run(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, name := range c.order {
+		ts := c.targets[name]
+		if !ts.enabled {
+			continue
+		}
+		wg.Add(1)
+		go func(t Target) {
+			defer wg.Done()
+			c.loop(ctx, t)
+		}(ts.target)
+	}
+	wg.Wait()
+}
+
+// SetURL points the named target's probes at u from its next check on.
+// Unknown targets are ignored.
+func (c *Checker) SetURL(name string, u *url.URL) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ts, ok := c.targets[name]; ok {
+		ts.target.URL = u
+		ts.status.URL = u.String()
+	}
+}
+
+func (c *Checker) loop(ctx context.Context, t Target) {
+	ticker := time.NewTicker(t.Check.Interval)
+	defer ticker.Stop()
+	for {
+		c.mu.RLock()
+		t.URL = c.targets[t.Name].target.URL
+		c.mu.RUnlock()
+		c.record(t.Name, c.probe(ctx, t), time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe issues one health check request. A nil error means healthy.
+func (c *Checker) probe(ctx context.Context, t Target) error {
+	ctx, cancel := context.WithTimeout(ctx, t.Check.Timeout)
+	defer cancel()
+
+	u := *t.URL
+	u.Path = t.Check.Path
+	u.RawQuery = ""
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "gatify-health-check")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != t.Check.ExpectedStatus {
+		return fmt.Errorf("status %d, want %d", resp.StatusCode, t.Check.ExpectedStatus)
+	}
+	return nil
+}
+
+// record applies a probe result. The first probe settles the state
+// immediately; afterwards Threshold consecutive disagreeing results are
+// needed to flip it.
+func (c *Checker) record(name string, probeErr error, now time.Time) {
+	c.mu.Lock()
+	ts, ok := c.targets[name]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+
+	healthy := probeErr == nil
+	ts.status.LastCheck = now
+	ts.status.LastError = ""
+	if probeErr != nil {
+		ts.status.LastError = probeErr.Error()
+	}
+
+	flip := false
+	switch {
+	case !ts.status.Probed:
+		ts.status.Probed = true
+		flip = healthy != ts.status.Healthy
+	case healthy == ts.status.Healthy:
+		ts.streak = 0
+	default:
+		ts.streak++
+		flip = ts.streak >= ts.target.Check.Threshold
+	}
+
+	var tr *Transition
+	if flip {
+		ts.status.Healthy = healthy
+		ts.streak = 0
+		tr = &Transition{Target: name, Healthy: healthy, At: now, Error: ts.status.LastError}
+	}
+	c.mu.Unlock()
+
+	if tr == nil {
+		return
+	}
+	if tr.Healthy {
+		log.Printf("✅ Upstream %s is healthy again", name)
+	} else {
+		log.Printf("⚠️  Upstream %s is unhealthy: %s", name, tr.Error)
+	}
+	if c.onTransition != nil {
+		c.onTransition(*tr)
+	}
+}
@@ -0,0 +1,137 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckerThreshold(t *testing.T) {
+	u, _ := url.Parse("http://backend")
+	var transitions []Transition
+	c := NewChecker([]Target{{Name: "a", URL: u, Check: HealthCheck{Path: "/healthz", Threshold: 2}}},
+		func(tr Transition) { transitions = append(transitions, tr) })
+
+	if !c.Healthy("a") || c.Ready() {
+		t.Fatal("Expected target healthy but not ready before the first probe")
+	}
+
+	now := time.Now()
+	c.record("a", nil, now)
+	if !c.Ready() || len(transitions) != 0 {
+		t.Fatalf("Expected ready with no transition, got %v", transitions)
+	}
+
+	down := errors.New("connection refused")
+	c.record("a", down, now)
+	if !c.Healthy("a") {
+		t.Error("Expected a single failure to be tolerated")
+	}
+	c.record("a", down, now)
+	if c.Healthy("a") || c.Ready() {
+		t.Error("Expected target unhealthy after two failures")
+	}
+	if len(transitions) != 1 || transitions[0].Healthy || transitions[0].Error != "connection refused" {
+		t.Errorf("Unexpected transitions %+v", transitions)
+	}
+
+	c.record("a", nil, now)
+	c.record("a", down, now)
+	c.record("a", nil, now)
+	if c.Healthy("a") {
+		t.Error("Expected interrupted streak not to flip state")
+	}
+	c.record("a", nil, now)
+	if !c.Healthy("a") || len(transitions) != 2 {
+		t.Errorf("Expected recovery transition, got %+v", transitions)
+	}
+}
+
+func TestCheckerProbesTargets(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			t.Errorf("Unexpected probe path %s", r.URL.Path)
+		}
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+
+	u, _ := url.Parse(backend.URL + "/api?x=1")
+	changed := make(chan Transition, 1)
+	c := NewChecker([]Target{{
+		Name:  DefaultTarget,
+		URL:   u,
+		Check: HealthCheck{Path: "/healthz", Interval: 5 * time.Millisecond, Threshold: 1},
+	}}, func(tr Transition) { changed <- tr })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	healthy.Store(false)
+	select {
+	case tr := <-changed:
+		if tr.Healthy || tr.Target != DefaultTarget {
+			t.Errorf("Unexpected transition %+v", tr)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for unhealthy transition")
+	}
+
+	st := c.Statuses()
+	if len(st) != 1 || st[0].Healthy || st[0].LastError == "" {
+		t.Errorf("Unexpected statuses %+v", st)
+	}
+}
+
+func TestNilChecker(t *testing.T) {
+	var c *Checker
+	if !c.Healthy("x") || !c.Ready() || c.Statuses() != nil {
+		t.Error("Expected nil checker to report healthy and ready")
+	}
+}
+
+func TestCheckerWithoutProbesIsReady(t *testing.T) {
+	u, _ := url.Parse("http://backend")
+	c := NewChecker([]Target{{Name: "a", URL: u}}, nil)
+	if !c.Ready() || !c.Healthy("a") {
+		t.Error("Expected unprobed target to be ready and healthy")
+	}
+}
+
+func TestCheckerSetURL(t *testing.T) {
+	var hits atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer backend.Close()
+
+	old, _ := url.Parse("http://127.0.0.1:1")
+	c := NewChecker([]Target{{Name: "a", URL: old, Check: HealthCheck{Path: "/healthz", Interval: 10 * time.Millisecond}}}, nil)
+	u, _ := url.Parse(backend.URL)
+	c.SetURL("a", u)
+	c.SetURL("missing", u)
+
+	if got := c.Statuses()[0].URL; got != backend.URL {
+		t.Errorf("Expected status URL %s, got %s", backend.URL, got)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	go c.Run(ctx)
+	deadline := time.Now().Add(time.Second)
+	for hits.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if hits.Load() == 0 {
+		t.Error("Expected probes to reach the new URL")
+	}
+}
@@ -0,0 +1,203 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DialFunc dials a network address, as net.Dialer.DialContext does.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Resolver keeps the addresses of backend hosts and re-resolves them on an
+// interval, so backends whose addresses change, such as Kubernetes
+// services or blue/green deployments, are followed without a restart.
+//
+// Connections are dialed to the cached addresses in turn, moving on to the
+// next one when a dial fails. When a lookup fails the last known addresses
+// stay in use. Once a host's addresses change, connections still open to
+// an address it no longer has are stale: every OnStale function is called
+// after each refresh until they are all closed, so transports can close
+// them as soon as they are idle.
+type Resolver struct {
+	lookup func(ctx context.Context, host string) ([]string, error)
+
+	mu      sync.Mutex
+	hosts   map[string]*hostAddrs
+	conns   map[*trackedConn]struct{}
+	onStale []func()
+}
+
+type hostAddrs struct {
+	addrs []string
+	next  int
+}
+
+// NewResolver creates a Resolver using the system resolver.
+func NewResolver() *Resolver {
+	return &Resolver{
+		lookup: net.DefaultResolver.LookupHost,
+		hosts:  make(map[string]*hostAddrs),
+		conns:  make(map[*trackedConn]struct{}),
+	}
+}
+
+// OnStale registers fn, typically a transport's CloseIdleConnections, to
+// be called while connections to stale addresses remain. It must be
+// called before Run.
+func (r *Resolver) OnStale(fn func()) {
+	r.onStale = append(r.onStale, fn)
+}
+
+// Dial wraps dial to connect to the host's cached addresses. Addresses
+// that are IP literals are dialed as they are.
+func (r *Resolver) Dial(dial DialFunc) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+		addrs, err := r.addresses(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var errs []error
+		for _, ip := range addrs {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return r.track(conn, host, ip), nil
+			}
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, errors.Join(errs...)
+	}
+}
+
+// addresses returns host's addresses, rotated so successive dials spread
+// over them, resolving the host on first use.
+func (r *Resolver) addresses(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	h, ok := r.hosts[host]
+	r.mu.Unlock()
+	if !ok {
+		addrs, err := r.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		if h, ok = r.hosts[host]; !ok {
+			h = &hostAddrs{addrs: addrs}
+			r.hosts[host] = h
+		}
+		r.mu.Unlock()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	start := h.next % len(h.addrs)
+	h.next++
+	return append(slices.Clone(h.addrs[start:]), h.addrs[:start]...), nil
+}
+
+func (r *Resolver) resolve(ctx context.Context, host string) ([]string, error) {
+	addrs, err := r.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+	slices.Sort(addrs)
+	return addrs, nil
+}
+
+// Run refreshes the addresses every interval until ctx is cancelled.
+func (r *Resolver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Refresh(ctx)
+		}
+	}
+}
+
+// Refresh resolves every host dialed so far again, then calls the OnStale
+// functions if connections to addresses no longer current remain.
+func (r *Resolver) Refresh(ctx context.Context) {
+	r.mu.Lock()
+	hosts := make([]string, 0, len(r.hosts))
+	for host := range r.hosts {
+		hosts = append(hosts, host)
+	}
+	r.mu.Unlock()
+
+	for _, host := range hosts {
+		addrs, err := r.resolve(ctx, host)
+		if err != nil {
+			log.Printf("⚠️  Failed to re-resolve backend host %s, keeping its last addresses: %v", host, err)
+			continue
+		}
+		r.mu.Lock()
+		h := r.hosts[host]
+		if !slices.Equal(h.addrs, addrs) {
+			log.Printf("🔁 Backend host %s now resolves to %v (was %v)", host, addrs, h.addrs)
+			h.addrs = addrs
+		}
+		r.mu.Unlock()
+	}
+
+	if r.stale() {
+		for _, fn := range r.onStale {
+			fn()
+		}
+	}
+}
+
+// stale reports whether a connection is open to an address its host no
+// longer resolves to.
+func (r *Resolver) stale() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for c := range r.conns {
+		if !slices.Contains(r.hosts[c.host].addrs, c.ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Resolver) track(conn net.Conn, host, ip string) net.Conn {
+	c := &trackedConn{Conn: conn, r: r, host: host, ip: ip}
+	r.mu.Lock()
+	r.conns[c] = struct{}{}
+	r.mu.Unlock()
+	return c
+}
+
+// trackedConn is a connection the Resolver dialed, forgotten once closed.
+type trackedConn struct {
+	net.Conn
+	r        *Resolver
+	host, ip string
+	once     sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.r.mu.Lock()
+		delete(c.r.conns, c)
+		c.r.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
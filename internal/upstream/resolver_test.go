@@ -0,0 +1,223 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDNS answers lookups from a map that tests change between refreshes.
+type fakeDNS struct {
+	mu    sync.Mutex
+	hosts map[string][]string
+	err   error
+}
+
+func (d *fakeDNS) set(host string, addrs ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hosts[host] = addrs
+}
+
+func (d *fakeDNS) fail(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.err = err
+}
+
+func (d *fakeDNS) lookup(_ context.Context, host string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+	return append([]string(nil), d.hosts[host]...), nil
+}
+
+func newFakeResolver() (*Resolver, *fakeDNS) {
+	dns := &fakeDNS{hosts: make(map[string][]string)}
+	r := NewResolver()
+	r.lookup = dns.lookup
+	return r, dns
+}
+
+// pipeDialer dials in-memory connections, failing for the addresses in
+// down, and records every address dialed.
+type pipeDialer struct {
+	down   map[string]bool
+	dialed []string
+}
+
+func (d *pipeDialer) dial(_ context.Context, _, addr string) (net.Conn, error) {
+	d.dialed = append(d.dialed, addr)
+	if d.down[addr] {
+		return nil, errors.New("connection refused")
+	}
+	client, server := net.Pipe()
+	server.Close()
+	return client, nil
+}
+
+func TestResolverFailsOverToNextAddress(t *testing.T) {
+	r, dns := newFakeResolver()
+	dns.set("api.internal", "10.0.0.2", "10.0.0.1")
+	d := &pipeDialer{down: map[string]bool{"10.0.0.1:8080": true}}
+	dial := r.Dial(d.dial)
+
+	conn, err := dial(context.Background(), "tcp", "api.internal:8080")
+	if err != nil {
+		t.Fatalf("dial error = %v", err)
+	}
+	conn.Close()
+	if len(d.dialed) != 2 || d.dialed[0] != "10.0.0.1:8080" || d.dialed[1] != "10.0.0.2:8080" {
+		t.Errorf("dialed %v, want 10.0.0.1 then 10.0.0.2", d.dialed)
+	}
+
+	// The next dial starts from the second address.
+	d.dialed = nil
+	conn, err = dial(context.Background(), "tcp", "api.internal:8080")
+	if err != nil {
+		t.Fatalf("dial error = %v", err)
+	}
+	conn.Close()
+	if len(d.dialed) != 1 || d.dialed[0] != "10.0.0.2:8080" {
+		t.Errorf("dialed %v, want 10.0.0.2 first", d.dialed)
+	}
+
+	d.down["10.0.0.2:8080"] = true
+	if _, err := dial(context.Background(), "tcp", "api.internal:8080"); err == nil {
+		t.Error("Expected an error when every address is down")
+	}
+}
+
+func TestResolverDialsIPLiteralsDirectly(t *testing.T) {
+	r, _ := newFakeResolver()
+	d := &pipeDialer{}
+	conn, err := r.Dial(d.dial)(context.Background(), "tcp", "192.0.2.1:80")
+	if err != nil {
+		t.Fatalf("dial error = %v", err)
+	}
+	conn.Close()
+	if len(d.dialed) != 1 || d.dialed[0] != "192.0.2.1:80" {
+		t.Errorf("dialed %v", d.dialed)
+	}
+}
+
+func TestResolverRefreshReportsStaleConnections(t *testing.T) {
+	r, dns := newFakeResolver()
+	dns.set("api.internal", "10.0.0.1")
+	stale := 0
+	r.OnStale(func() { stale++ })
+	d := &pipeDialer{}
+	dial := r.Dial(d.dial)
+
+	conn, err := dial(context.Background(), "tcp", "api.internal:8080")
+	if err != nil {
+		t.Fatalf("dial error = %v", err)
+	}
+	r.Refresh(context.Background())
+	if stale != 0 {
+		t.Fatalf("OnStale called %d times before any change", stale)
+	}
+
+	dns.set("api.internal", "10.0.0.9")
+	r.Refresh(context.Background())
+	r.Refresh(context.Background())
+	if stale != 2 {
+		t.Errorf("OnStale called %d times, want once per refresh while the connection is open", stale)
+	}
+
+	d.dialed = nil
+	if c, err := dial(context.Background(), "tcp", "api.internal:8080"); err != nil {
+		t.Fatalf("dial error = %v", err)
+	} else {
+		defer c.Close()
+	}
+	if len(d.dialed) != 1 || d.dialed[0] != "10.0.0.9:8080" {
+		t.Errorf("dialed %v after the change, want 10.0.0.9", d.dialed)
+	}
+
+	conn.Close()
+	r.Refresh(context.Background())
+	if stale != 2 {
+		t.Errorf("OnStale called after the stale connection closed")
+	}
+}
+
+func TestResolverKeepsAddressesWhenLookupFails(t *testing.T) {
+	r, dns := newFakeResolver()
+	dns.set("api.internal", "10.0.0.1")
+	stale := 0
+	r.OnStale(func() { stale++ })
+	d := &pipeDialer{}
+	dial := r.Dial(d.dial)
+
+	conn, err := dial(context.Background(), "tcp", "api.internal:8080")
+	if err != nil {
+		t.Fatalf("dial error = %v", err)
+	}
+	defer conn.Close()
+
+	dns.fail(errors.New("server misbehaving"))
+	r.Refresh(context.Background())
+	if stale != 0 {
+		t.Errorf("OnStale called after a failed lookup")
+	}
+	d.dialed = nil
+	if c, err := dial(context.Background(), "tcp", "api.internal:8080"); err != nil {
+		t.Fatalf("dial error = %v", err)
+	} else {
+		c.Close()
+	}
+	if len(d.dialed) != 1 || d.dialed[0] != "10.0.0.1:8080" {
+		t.Errorf("dialed %v, want the last known address", d.dialed)
+	}
+
+	dns.fail(nil)
+	dns.set("api.internal")
+	r.Refresh(context.Background())
+	if stale != 0 {
+		t.Errorf("OnStale called after a lookup without addresses")
+	}
+}
+
+func TestResolverClosesStaleIdleConnections(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	r, dns := newFakeResolver()
+	dns.set("backend.test", "127.0.0.1")
+	transport, err := TransportConfig{Resolver: r}.HTTPTransport()
+	if err != nil {
+		t.Fatalf("HTTPTransport() error = %v", err)
+	}
+	r.OnStale(transport.CloseIdleConnections)
+
+	resp, err := (&http.Client{Transport: transport}).Get("http://backend.test:" + u.Port() + "/")
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	resp.Body.Close()
+
+	dns.set("backend.test", "127.0.0.2")
+	r.Refresh(context.Background())
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the idle connection to the old address to close")
+	}
+}
@@ -0,0 +1,145 @@
+package upstream
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// SchemeH2C is the URL scheme of backends spoken to in cleartext HTTP/2,
+// such as gRPC servers without TLS. HTTP/2 over TLS needs no scheme of
+// its own: https backends negotiate it.
+const SchemeH2C = "h2c"
+
+// Transport sends requests for h2c URLs in cleartext HTTP/2 with prior
+// knowledge, and every other request through base.
+type Transport struct {
+	base http.RoundTripper
+	h2c  *http.Transport
+}
+
+// NewTransport creates a Transport falling back to base. When base is an
+// *http.Transport, h2c connections share its dial and pool settings.
+func NewTransport(base http.RoundTripper) *Transport {
+	template, ok := base.(*http.Transport)
+	if !ok {
+		template = http.DefaultTransport.(*http.Transport)
+	}
+	h2c := template.Clone()
+	h2c.Protocols = new(http.Protocols)
+	h2c.Protocols.SetUnencryptedHTTP2(true)
+	return &Transport{base: base, h2c: h2c}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != SchemeH2C {
+		return t.base.RoundTrip(req)
+	}
+	r := *req
+	u := *req.URL
+	u.Scheme = "http"
+	r.URL = &u
+	return t.h2c.RoundTrip(&r)
+}
+
+// CloseIdleConnections closes the idle connections of base, when it can,
+// and of the h2c transport.
+func (t *Transport) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+	t.h2c.CloseIdleConnections()
+}
+
+// TransportConfig tunes the connections to backends. Zero fields keep the
+// defaults of http.DefaultTransport.
+type TransportConfig struct {
+	// ClientCertFile and ClientKeyFile hold the certificate presented to
+	// backends requiring mutual TLS.
+	ClientCertFile string
+	ClientKeyFile  string
+	// CAFile is a PEM bundle of the CAs trusted to sign backend
+	// certificates, instead of the system roots.
+	CAFile string
+
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps connections to each backend, idle or not;
+	// requests beyond it wait for one to free up.
+	MaxConnsPerHost int
+
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	// KeepAlive is the interval of TCP keep-alive probes; a negative
+	// value disables them.
+	KeepAlive time.Duration
+	// DisableKeepAlives opens a new connection for every request.
+	DisableKeepAlives bool
+	// Resolver, when set, resolves backend hosts for every dial instead of
+	// the dialer, so their addresses are followed as they change.
+	Resolver *Resolver
+}
+
+// HTTPTransport builds the *http.Transport described by c, reading the
+// certificate files it names.
+func (c TransportConfig) HTTPTransport() (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if c.DialTimeout > 0 {
+		dialer.Timeout = c.DialTimeout
+	}
+	if c.KeepAlive != 0 {
+		dialer.KeepAlive = c.KeepAlive
+	}
+	t.DialContext = dialer.DialContext
+	if c.Resolver != nil {
+		t.DialContext = c.Resolver.Dial(dialer.DialContext)
+	}
+	if c.MaxIdleConns > 0 {
+		t.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	t.MaxConnsPerHost = c.MaxConnsPerHost
+	if c.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = c.TLSHandshakeTimeout
+	}
+	t.ResponseHeaderTimeout = c.ResponseHeaderTimeout
+	if c.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = c.IdleConnTimeout
+	}
+	t.DisableKeepAlives = c.DisableKeepAlives
+
+	if c.ClientCertFile == "" && c.CAFile == "" {
+		return t, nil
+	}
+	t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCertFile, c.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load backend client certificate: %w", err)
+		}
+		t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		data, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read backend CA bundle: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return nil, errors.New("backend CA bundle " + c.CAFile + " holds no PEM certificates")
+		}
+		t.TLSClientConfig.RootCAs = roots
+	}
+	return t, nil
+}
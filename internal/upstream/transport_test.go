@@ -0,0 +1,218 @@
+package upstream
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTransportSpeaksH2C(t *testing.T) {
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proto", r.Proto)
+	}))
+	backend.Config.Protocols = new(http.Protocols)
+	backend.Config.Protocols.SetHTTP1(true)
+	backend.Config.Protocols.SetUnencryptedHTTP2(true)
+	backend.Start()
+	defer backend.Close()
+
+	client := &http.Client{Transport: NewTransport(http.DefaultTransport)}
+	u, _ := url.Parse(backend.URL)
+	for scheme, want := range map[string]string{"http": "HTTP/1.1", SchemeH2C: "HTTP/2.0"} {
+		u.Scheme = scheme
+		resp, err := client.Get(u.String())
+		if err != nil {
+			t.Fatalf("%s: %v", scheme, err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("X-Proto"); got != want {
+			t.Errorf("%s: backend saw %s, want %s", scheme, got, want)
+		}
+	}
+}
+
+// testCA issues certificates for mutual TLS tests.
+type testCA struct {
+	t    *testing.T
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{t: t, key: key, cert: cert}
+}
+
+// issue returns a certificate for usage and its key, PEM encoded.
+func (ca *testCA) issue(serial int64, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	ca.t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "gatify"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTransportConfigMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(2, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(3, x509.ExtKeyUsageClientAuth)
+	pair, err := tls.X509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Client", r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	backend.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	backend.StartTLS()
+	defer backend.Close()
+
+	dir := t.TempDir()
+	caFile := writeFile(t, dir, "ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}))
+	cfg := TransportConfig{CAFile: caFile}
+
+	// Trusting the CA is not enough for a backend requiring a client
+	// certificate.
+	transport, err := cfg.HTTPTransport()
+	if err != nil {
+		t.Fatalf("HTTPTransport() error = %v", err)
+	}
+	client := &http.Client{Transport: NewTransport(transport)}
+	if resp, err := client.Get(backend.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("request without a client certificate succeeded")
+	}
+
+	cfg.ClientCertFile = writeFile(t, dir, "client.pem", clientCert)
+	cfg.ClientKeyFile = writeFile(t, dir, "client.key", clientKey)
+	if transport, err = cfg.HTTPTransport(); err != nil {
+		t.Fatalf("HTTPTransport() error = %v", err)
+	}
+	client = &http.Client{Transport: NewTransport(transport)}
+	resp, err := client.Get(backend.URL)
+	if err != nil {
+		t.Fatalf("request with a client certificate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Client") != "gatify" {
+		t.Errorf("backend saw client %q", resp.Header.Get("X-Client"))
+	}
+}
+
+func TestTransportConfigTuning(t *testing.T) {
+	transport, err := TransportConfig{
+		MaxIdleConns:          10,
+		MaxIdleConnsPerHost:   5,
+		MaxConnsPerHost:       20,
+		TLSHandshakeTimeout:   time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+		IdleConnTimeout:       time.Minute,
+		DisableKeepAlives:     true,
+	}.HTTPTransport()
+	if err != nil {
+		t.Fatalf("HTTPTransport() error = %v", err)
+	}
+	if transport.MaxIdleConns != 10 || transport.MaxIdleConnsPerHost != 5 || transport.MaxConnsPerHost != 20 {
+		t.Errorf("pool = %d/%d/%d", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost)
+	}
+	if transport.TLSHandshakeTimeout != time.Second || transport.ResponseHeaderTimeout != 15*time.Second ||
+		transport.IdleConnTimeout != time.Minute || !transport.DisableKeepAlives {
+		t.Errorf("timeouts = %v/%v/%v keep-alives disabled %v", transport.TLSHandshakeTimeout,
+			transport.ResponseHeaderTimeout, transport.IdleConnTimeout, transport.DisableKeepAlives)
+	}
+	if tc := transport.TLSClientConfig; tc != nil && (len(tc.Certificates) > 0 || tc.RootCAs != nil) {
+		t.Error("TLS settings changed without certificate files")
+	}
+
+	defaults, err := TransportConfig{}.HTTPTransport()
+	if err != nil {
+		t.Fatalf("HTTPTransport() error = %v", err)
+	}
+	base := http.DefaultTransport.(*http.Transport)
+	if defaults.MaxIdleConns != base.MaxIdleConns || defaults.IdleConnTimeout != base.IdleConnTimeout {
+		t.Errorf("zero config changed defaults: %d %v", defaults.MaxIdleConns, defaults.IdleConnTimeout)
+	}
+}
+
+func TestTransportConfigBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := writeFile(t, dir, "ca.pem", []byte("not a certificate"))
+	for name, cfg := range map[string]TransportConfig{
+		"missing CA":          {CAFile: filepath.Join(dir, "missing.pem")},
+		"CA without PEM":      {CAFile: notPEM},
+		"missing client cert": {ClientCertFile: filepath.Join(dir, "client.pem"), ClientKeyFile: filepath.Join(dir, "client.key")},
+	} {
+		if _, err := cfg.HTTPTransport(); err == nil {
+			t.Errorf("%s: HTTPTransport() succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Package useragent sorts User-Agent headers into coarse families, such
+// as crawlers versus people using a browser, for rules and analytics. It
+// looks for well-known tokens rather than parsing every product version,
+// so it is cheap enough to run on every request.
+package useragent
+
+import "strings"
+
+// Agent families.
+const (
+	// Bot is a crawler, preview fetcher or monitoring robot.
+	Bot = "bot"
+	// Tool is an HTTP library or command-line client, usually a script.
+	Tool = "tool"
+	// Mobile is a browser or app on a phone or tablet.
+	Mobile = "mobile"
+	// Browser is a desktop browser.
+	Browser = "browser"
+	// Other is anything unrecognized, including a missing User-Agent.
+	Other = "other"
+)
+
+// Families returns every family Classify can return.
+func Families() []string {
+	return []string{Bot, Tool, Mobile, Browser, Other}
+}
+
+// Known reports whether family is one of Families.
+func Known(family string) bool {
+	switch family {
+	case Bot, Tool, Mobile, Browser, Other:
+		return true
+	}
+	return false
+}
+
+// botTokens appear in crawler user agents, which often also claim to be
+// a (mobile) browser, so they are checked first.
+var botTokens = []string{
+	"bot", "crawl", "spider", "slurp", "facebookexternalhit", "mediapartners-google",
+	"bingpreview", "headlesschrome", "lighthouse", "pingdom", "uptime", "archiver",
+}
+
+// toolTokens start the user agents of HTTP libraries and CLI clients.
+var toolTokens = []string{
+	"curl/", "wget/", "python-requests/", "python-urllib/", "python-httpx/", "aiohttp/",
+	"go-http-client/", "java/", "okhttp/", "apache-httpclient/", "libwww-perl/",
+	"axios/", "node-fetch/", "undici", "postmanruntime/", "insomnia/", "httpie/", "ruby",
+}
+
+var mobileTokens = []string{"mobile", "android", "iphone", "ipad", "ipod", "windows phone", "cfnetwork"}
+
+// Classify returns the family of the user agent ua.
+func Classify(ua string) string {
+	ua = strings.ToLower(strings.TrimSpace(ua))
+	switch {
+	case ua == "":
+		return Other
+	case containsAny(ua, botTokens):
+		return Bot
+	case hasAnyPrefix(ua, toolTokens):
+		return Tool
+	case containsAny(ua, mobileTokens):
+		return Mobile
+	case strings.HasPrefix(ua, "mozilla/") || strings.HasPrefix(ua, "opera/"):
+		return Browser
+	}
+	return Other
+}
+
+func containsAny(s string, tokens []string) bool {
+	for _, t := range tokens {
+		if strings.Contains(s, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
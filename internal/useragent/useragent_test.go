@@ -0,0 +1,39 @@
+package useragent
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)":                                                                         Bot,
+		"Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/41.0 Mobile Safari/537.36 (compatible; Googlebot/2.1)": Bot,
+		"facebookexternalhit/1.1": Bot,
+		"Mozilla/5.0 (X11; Linux x86_64) HeadlessChrome/120.0.0.0 Safari/537.36": Bot,
+		"curl/8.4.0":             Tool,
+		"python-requests/2.31.0": Tool,
+		"Go-http-client/1.1":     Tool,
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1": Mobile,
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36":                       Mobile,
+		"ShopApp/4.2 CFNetwork/1474 Darwin/23.0.0": Mobile,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36": Browser,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.1; rv:121.0) Gecko/20100101 Firefox/121.0":                             Browser,
+		"":               Other,
+		"   ":            Other,
+		"internal-batch": Other,
+	}
+	for ua, want := range tests {
+		if got := Classify(ua); got != want {
+			t.Errorf("Classify(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
+
+func TestKnown(t *testing.T) {
+	for _, f := range Families() {
+		if !Known(f) {
+			t.Errorf("Known(%q) = false", f)
+		}
+	}
+	if Known("robot") {
+		t.Error("Expected unknown family to be rejected")
+	}
+}
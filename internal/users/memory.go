@@ -0,0 +1,98 @@
+package users
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxMemoryAudit bounds the audit log kept in memory.
+const maxMemoryAudit = 1000
+
+// InMemoryStore is a Store for gateways without a database. Tokens and
+// the audit log are lost on restart. It is safe for concurrent use.
+type InMemoryStore struct {
+	mu     sync.RWMutex
+	tokens map[string]Token
+	audit  []AuditEntry
+}
+
+// NewInMemoryStore creates an empty InMemoryStore.
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{tokens: make(map[string]Token)}
+}
+
+// CreateToken implements Store.
+func (s *InMemoryStore) CreateToken(_ context.Context, t Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[t.ID] = t
+	return nil
+}
+
+// ListTokens implements Store.
+func (s *InMemoryStore) ListTokens(context.Context) ([]Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Token, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+// RevokeToken implements Store.
+func (s *InMemoryStore) RevokeToken(_ context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if t.RevokedAt == nil {
+		t.RevokedAt = &at
+		s.tokens[id] = t
+	}
+	return nil
+}
+
+// TokenByHash implements Store.
+func (s *InMemoryStore) TokenByHash(_ context.Context, hash string) (Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.tokens {
+		if t.Hash == hash {
+			return t, nil
+		}
+	}
+	return Token{}, ErrNotFound
+}
+
+// RecordAudit implements Store. Only the newest entries are kept.
+func (s *InMemoryStore) RecordAudit(_ context.Context, e AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = append(s.audit, e)
+	if len(s.audit) > maxMemoryAudit {
+		s.audit = append([]AuditEntry(nil), s.audit[len(s.audit)-maxMemoryAudit:]...)
+	}
+	return nil
+}
+
+// ListAudit implements Store.
+func (s *InMemoryStore) ListAudit(_ context.Context, limit int) ([]AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]AuditEntry, 0, min(limit, len(s.audit)))
+	for i := len(s.audit) - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, s.audit[i])
+	}
+	return out, nil
+}
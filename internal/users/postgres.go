@@ -0,0 +1,155 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// schema creates the token and audit tables. It is idempotent.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS api_tokens (
+		id         TEXT        PRIMARY KEY,
+		name       TEXT        NOT NULL,
+		role       TEXT        NOT NULL,
+		prefix     TEXT        NOT NULL,
+		hash       TEXT        NOT NULL UNIQUE,
+		created_at TIMESTAMPTZ NOT NULL,
+		created_by TEXT        NOT NULL DEFAULT '',
+		revoked_at TIMESTAMPTZ
+	)`,
+	`CREATE TABLE IF NOT EXISTS api_audit_log (
+		time       TIMESTAMPTZ NOT NULL,
+		token_id   TEXT        NOT NULL,
+		token_name TEXT        NOT NULL,
+		method     TEXT        NOT NULL,
+		path       TEXT        NOT NULL,
+		status     INTEGER     NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS api_audit_log_time_idx ON api_audit_log (time DESC)`,
+}
+
+// PostgresStore is a Store backed by PostgreSQL.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a PostgresStore using db.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Migrate creates the token and audit tables.
+func (s *PostgresStore) Migrate(ctx context.Context) error {
+	for _, stmt := range schema {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("users migration: %w", err)
+		}
+	}
+	return nil
+}
+
+const tokenColumns = `id, name, role, prefix, hash, created_at, created_by, revoked_at`
+
+// CreateToken implements Store.
+func (s *PostgresStore) CreateToken(ctx context.Context, t Token) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO api_tokens (`+tokenColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		t.ID, t.Name, t.Role, t.Prefix, t.Hash, t.CreatedAt, t.CreatedBy, t.RevokedAt)
+	if err != nil {
+		return fmt.Errorf("create token: %w", err)
+	}
+	return nil
+}
+
+// ListTokens implements Store.
+func (s *PostgresStore) ListTokens(ctx context.Context) ([]Token, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+tokenColumns+` FROM api_tokens ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("list tokens: %w", err)
+	}
+	defer rows.Close()
+	var out []Token
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("list tokens: %w", err)
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// RevokeToken implements Store.
+func (s *PostgresStore) RevokeToken(ctx context.Context, id string, at time.Time) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE api_tokens SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`, id, at)
+	if err != nil {
+		return fmt.Errorf("revoke token: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// TokenByHash implements Store.
+func (s *PostgresStore) TokenByHash(ctx context.Context, hash string) (Token, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+tokenColumns+` FROM api_tokens WHERE hash = $1`, hash)
+	t, err := scanToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Token{}, ErrNotFound
+	}
+	if err != nil {
+		return Token{}, fmt.Errorf("look up token: %w", err)
+	}
+	return t, nil
+}
+
+// RecordAudit implements Store.
+func (s *PostgresStore) RecordAudit(ctx context.Context, e AuditEntry) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO api_audit_log (time, token_id, token_name, method, path, status)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		e.Time, e.TokenID, e.TokenName, e.Method, e.Path, e.Status)
+	if err != nil {
+		return fmt.Errorf("record audit: %w", err)
+	}
+	return nil
+}
+
+// ListAudit implements Store.
+func (s *PostgresStore) ListAudit(ctx context.Context, limit int) ([]AuditEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT time, token_id, token_name, method, path, status
+		FROM api_audit_log ORDER BY time DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list audit: %w", err)
+	}
+	defer rows.Close()
+	var out []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.Time, &e.TokenID, &e.TokenName, &e.Method, &e.Path, &e.Status); err != nil {
+			return nil, fmt.Errorf("list audit: %w", err)
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func scanToken(row interface{ Scan(...any) error }) (Token, error) {
+	var t Token
+	var revoked sql.NullTime
+	if err := row.Scan(&t.ID, &t.Name, &t.Role, &t.Prefix, &t.Hash, &t.CreatedAt, &t.CreatedBy, &revoked); err != nil {
+		return Token{}, err
+	}
+	if revoked.Valid {
+		at := revoked.Time
+		t.RevokedAt = &at
+	}
+	return t, nil
+}
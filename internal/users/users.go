@@ -0,0 +1,217 @@
+// Package users authenticates management API callers. Each caller holds
+// its own bearer token with a role, tokens can be issued and revoked at
+// runtime, and every mutation is recorded against the token that made it.
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Roles. Read-only tokens may query rules and stats; admin tokens may also
+// change them and manage tokens.
+const (
+	RoleAdmin    = "admin"
+	RoleReadOnly = "read_only"
+)
+
+// BootstrapID identifies the ADMIN_API_TOKEN, which always authenticates
+// as an admin so the first tokens can be issued.
+const BootstrapID = "bootstrap"
+
+// tokenPrefix starts every issued token, so leaked tokens are easy to
+// recognize in logs and secret scanners.
+const tokenPrefix = "gat_"
+
+// maxNameLength bounds token names.
+const maxNameLength = 100
+
+var (
+	// ErrNotFound is returned when a token does not exist.
+	ErrNotFound = errors.New("token not found")
+	// ErrUnauthenticated is returned for unknown or revoked tokens.
+	ErrUnauthenticated = errors.New("missing or invalid token")
+	// ErrInvalid wraps problems with a token's name or role.
+	ErrInvalid = errors.New("invalid token")
+)
+
+// ValidRole reports whether role is a known role.
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleReadOnly
+}
+
+// Token is an API token. The secret itself is never stored, only its hash.
+type Token struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+	// Prefix is the start of the secret, to tell tokens apart.
+	Prefix    string     `json:"prefix"`
+	Hash      string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Principal is an authenticated caller.
+type Principal struct {
+	TokenID string `json:"token_id"`
+	Name    string `json:"name"`
+	Role    string `json:"role"`
+}
+
+// CanWrite reports whether p may change configuration.
+func (p Principal) CanWrite() bool {
+	return p.Role == RoleAdmin
+}
+
+// AuditEntry records one mutation made through the API.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	TokenID   string    `json:"token_id"`
+	TokenName string    `json:"token_name"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+}
+
+// Store persists tokens and the audit log.
+type Store interface {
+	CreateToken(ctx context.Context, t Token) error
+	// ListTokens returns every token, revoked ones included, oldest first.
+	ListTokens(ctx context.Context) ([]Token, error)
+	// RevokeToken marks a token revoked. Revoking it again is a no-op.
+	RevokeToken(ctx context.Context, id string, at time.Time) error
+	// TokenByHash returns the token with the given secret hash, or
+	// ErrNotFound.
+	TokenByHash(ctx context.Context, hash string) (Token, error)
+	RecordAudit(ctx context.Context, e AuditEntry) error
+	// ListAudit returns the newest limit entries, newest first.
+	ListAudit(ctx context.Context, limit int) ([]AuditEntry, error)
+}
+
+// Authenticator resolves bearer tokens to principals.
+type Authenticator struct {
+	store     Store
+	bootstrap string
+	now       func() time.Time
+}
+
+// NewAuthenticator creates an Authenticator checking tokens in store.
+// bootstrap, when set, is accepted as an admin token in addition.
+func NewAuthenticator(store Store, bootstrap string) *Authenticator {
+	return &Authenticator{store: store, bootstrap: bootstrap, now: time.Now}
+}
+
+// Store returns the token store.
+func (a *Authenticator) Store() Store {
+	return a.store
+}
+
+// Authenticate returns the principal holding secret.
+func (a *Authenticator) Authenticate(ctx context.Context, secret string) (Principal, error) {
+	if secret == "" {
+		return Principal{}, ErrUnauthenticated
+	}
+	if a.bootstrap != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(a.bootstrap)) == 1 {
+		return Principal{TokenID: BootstrapID, Name: "ADMIN_API_TOKEN", Role: RoleAdmin}, nil
+	}
+	if !strings.HasPrefix(secret, tokenPrefix) {
+		return Principal{}, ErrUnauthenticated
+	}
+	t, err := a.store.TokenByHash(ctx, hashSecret(secret))
+	if errors.Is(err, ErrNotFound) {
+		return Principal{}, ErrUnauthenticated
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	if t.RevokedAt != nil {
+		return Principal{}, ErrUnauthenticated
+	}
+	return Principal{TokenID: t.ID, Name: t.Name, Role: t.Role}, nil
+}
+
+// Issue creates a token and returns it with its secret, which is not
+// kept and cannot be shown again.
+func (a *Authenticator) Issue(ctx context.Context, name, role string, by Principal) (Token, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxNameLength {
+		return Token{}, "", fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalid, maxNameLength)
+	}
+	if !ValidRole(role) {
+		return Token{}, "", fmt.Errorf("%w: role must be %s or %s", ErrInvalid, RoleAdmin, RoleReadOnly)
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return Token{}, "", err
+	}
+	raw, err := randomHex(24)
+	if err != nil {
+		return Token{}, "", err
+	}
+	secret := tokenPrefix + raw
+	t := Token{
+		ID:        id,
+		Name:      name,
+		Role:      role,
+		Prefix:    secret[:len(tokenPrefix)+6],
+		Hash:      hashSecret(secret),
+		CreatedAt: a.now().UTC(),
+		CreatedBy: by.Name,
+	}
+	if err := a.store.CreateToken(ctx, t); err != nil {
+		return Token{}, "", err
+	}
+	return t, secret, nil
+}
+
+// Revoke revokes the token with the given ID.
+func (a *Authenticator) Revoke(ctx context.Context, id string) error {
+	return a.store.RevokeToken(ctx, id, a.now().UTC())
+}
+
+// Audit records a mutation by p.
+func (a *Authenticator) Audit(ctx context.Context, p Principal, method, path string, status int) error {
+	return a.store.RecordAudit(ctx, AuditEntry{
+		Time:      a.now().UTC(),
+		TokenID:   p.TokenID,
+		TokenName: p.Name,
+		Method:    method,
+		Path:      path,
+		Status:    status,
+	})
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal attached to ctx.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
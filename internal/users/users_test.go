@@ -0,0 +1,81 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAuthenticatorIssueAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	a := NewAuthenticator(NewInMemoryStore(), "")
+	admin := Principal{TokenID: BootstrapID, Name: "ADMIN_API_TOKEN", Role: RoleAdmin}
+
+	tok, secret, err := a.Issue(ctx, " ci ", RoleReadOnly, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Name != "ci" || tok.CreatedBy != "ADMIN_API_TOKEN" || !strings.HasPrefix(secret, tok.Prefix) || tok.Hash == secret {
+		t.Errorf("issued %+v with secret %q", tok, secret)
+	}
+
+	p, err := a.Authenticate(ctx, secret)
+	if err != nil || p.TokenID != tok.ID || p.Role != RoleReadOnly || p.CanWrite() {
+		t.Fatalf("authenticated %+v, %v", p, err)
+	}
+
+	if err := a.Revoke(ctx, tok.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate(ctx, secret); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("revoked token: %v", err)
+	}
+	if err := a.Revoke(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("revoking a missing token: %v", err)
+	}
+}
+
+func TestAuthenticatorRejectsUnknownTokens(t *testing.T) {
+	ctx := context.Background()
+	a := NewAuthenticator(NewInMemoryStore(), "bootstrap-secret")
+
+	for _, secret := range []string{"", "wrong", "gat_0123456789"} {
+		if _, err := a.Authenticate(ctx, secret); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("Authenticate(%q) = %v", secret, err)
+		}
+	}
+	p, err := a.Authenticate(ctx, "bootstrap-secret")
+	if err != nil || p.TokenID != BootstrapID || !p.CanWrite() {
+		t.Errorf("bootstrap token: %+v, %v", p, err)
+	}
+}
+
+func TestAuthenticatorValidatesTokens(t *testing.T) {
+	a := NewAuthenticator(NewInMemoryStore(), "")
+	if _, _, err := a.Issue(context.Background(), "", RoleAdmin, Principal{}); !errors.Is(err, ErrInvalid) {
+		t.Error("expected an empty name to be rejected")
+	}
+	if _, _, err := a.Issue(context.Background(), "ops", "superuser", Principal{}); !errors.Is(err, ErrInvalid) {
+		t.Error("expected an unknown role to be rejected")
+	}
+}
+
+func TestInMemoryStoreAudit(t *testing.T) {
+	ctx := context.Background()
+	a := NewAuthenticator(NewInMemoryStore(), "")
+	p := Principal{TokenID: "t1", Name: "ops", Role: RoleAdmin}
+	for _, path := range []string{"/api/rules", "/api/acl", "/api/policies"} {
+		if err := a.Audit(ctx, p, "POST", path, 201); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := a.Store().ListAudit(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Path != "/api/policies" || entries[1].TokenName != "ops" {
+		t.Errorf("audit = %+v", entries)
+	}
+}
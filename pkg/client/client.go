@@ -0,0 +1,145 @@
+// Package client is a Go client for the Gatify management API and for the
+// rate limit headers the gateway adds to proxied responses. Services use
+// it to manage rules, read traffic stats and discover the limits that
+// apply to them.
+//
+//	c, err := client.New("http://gatify:3000", client.WithToken(token))
+//	list, err := c.Rules.List(ctx)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxErrorBody bounds how much of an error response is read.
+const maxErrorBody = 64 << 10
+
+// Client talks to one Gatify gateway.
+type Client struct {
+	base  *url.URL
+	token string
+	http  *http.Client
+
+	// Rules manages rate limit rules. It needs a token.
+	Rules *RulesClient
+	// Stats reads traffic stats. It needs a token and a gateway with a
+	// database.
+	Stats *StatsClient
+	// Limits reads the public rate limit policy. It needs no token.
+	Limits *LimitsClient
+}
+
+// Option customizes a Client.
+type Option func(*Client)
+
+// WithToken authenticates management API calls with an API token.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient sends requests with hc instead of http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// New creates a Client for the gateway at baseURL, such as
+// "http://gatify:3000".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" || base.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q: must be an absolute http or https URL", baseURL)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+
+	c := &Client{base: base, http: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.Rules = &RulesClient{c: c}
+	c.Stats = &StatsClient{c: c}
+	c.Limits = &LimitsClient{c: c}
+	return c, nil
+}
+
+// APIError is a non-2xx response from the gateway.
+type APIError struct {
+	StatusCode int
+	// Message is the gateway's error message, or the status text when the
+	// response had none.
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gatify: %d %s", e.StatusCode, e.Message)
+}
+
+// do sends a request and decodes a JSON response into out, unless out is
+// nil. header may be nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, header http.Header, in, out any) (http.Header, error) {
+	u := *c.base
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.Header, readError(resp)
+	}
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp.Header, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.Header, fmt.Errorf("gatify: decoding response: %w", err)
+	}
+	return resp.Header, nil
+}
+
+func readError(resp *http.Response) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	var body struct {
+		Error string `json:"error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if json.Unmarshal(data, &body) == nil && body.Error != "" {
+		apiErr.Message = body.Error
+	}
+	return apiErr
+}
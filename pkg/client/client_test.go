@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/api"
+	"github.com/Siruyy/gatify/internal/rules"
+)
+
+const testToken = "test-token"
+
+func newTestClient(t *testing.T, h http.Handler, opts ...Option) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c, err := New(srv.URL, opts...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return c
+}
+
+func TestNewRejectsInvalidURL(t *testing.T) {
+	for _, raw := range []string{"", "gatify:3000", "ftp://gatify", "http://"} {
+		if _, err := New(raw); err == nil {
+			t.Errorf("New(%q): expected error", raw)
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, api.NewHandler(rules.NewInMemoryRepository(), testToken), WithToken(testToken))
+
+	created, err := c.Rules.Create(ctx, Rule{
+		Name:          "login",
+		Pattern:       "/login",
+		Limit:         5,
+		WindowSeconds: 60,
+		Enabled:       true,
+		Rejection:     []byte(`{"content_type":"text/plain","body":"slow down"}`),
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.ID == "" || created.Revision != 1 {
+		t.Fatalf("expected a stored rule, got %+v", created)
+	}
+
+	got, err := c.Rules.Get(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got.Limit = 10
+	updated, err := c.Rules.Update(ctx, got)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated.Limit != 10 || updated.Revision != 2 || len(updated.Rejection) == 0 {
+		t.Fatalf("unexpected updated rule %+v", updated)
+	}
+
+	// got still holds revision 1, so a second update is stale.
+	var apiErr *APIError
+	if _, err := c.Rules.Update(ctx, got); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for a stale revision, got %v", err)
+	}
+
+	list, err := c.Rules.List(ctx)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("List: %v, %d rules", err, len(list))
+	}
+
+	if err := c.Rules.Delete(ctx, created.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	_, err = c.Rules.Get(ctx, created.ID)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "rule not found" {
+		t.Fatalf("expected 404 rule not found, got %v", err)
+	}
+}
+
+func TestRulesApply(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, api.NewHandler(rules.NewInMemoryRepository(), testToken), WithToken(testToken))
+	if _, err := c.Rules.Create(ctx, Rule{Name: "legacy", Pattern: "/v1/*", Limit: 5, WindowSeconds: 60}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	desired := []Rule{{Name: "login", Pattern: "/login", Limit: 5, WindowSeconds: 60, Enabled: true}}
+
+	plan, err := c.Rules.Apply(ctx, desired, true)
+	if err != nil || !plan.DryRun || len(plan.Changes) != 2 {
+		t.Fatalf("dry run: %+v, %v", plan, err)
+	}
+	res, err := c.Rules.Apply(ctx, desired, false)
+	if err != nil || res.DryRun || len(res.Changes) != 2 {
+		t.Fatalf("apply: %+v, %v", res, err)
+	}
+	list, _ := c.Rules.List(ctx)
+	if len(list) != 1 || list[0].Name != "login" {
+		t.Fatalf("unexpected rules after apply: %+v", list)
+	}
+}
+
+func TestRulesRequireToken(t *testing.T) {
+	c := newTestClient(t, api.NewHandler(rules.NewInMemoryRepository(), testToken))
+
+	var apiErr *APIError
+	if _, err := c.Rules.List(context.Background()); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %v", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/stats/overview", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("window"); got != "1h0m0s" {
+			t.Errorf("expected window 1h0m0s, got %q", got)
+		}
+		_, _ = w.Write([]byte(`{"total_requests":10,"blocked_requests":2,"block_rate":0.2}`))
+	})
+	mux.HandleFunc("GET /api/stats/rules/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("window") {
+			t.Errorf("expected the default window, got %q", r.URL.Query().Get("window"))
+		}
+		_, _ = w.Write([]byte(`{"rule_id":"` + r.PathValue("id") + `","total_requests":4}`))
+	})
+	c := newTestClient(t, mux, WithToken(testToken))
+
+	o, err := c.Stats.Overview(context.Background(), time.Hour)
+	if err != nil || o.TotalRequests != 10 || o.BlockRate != 0.2 {
+		t.Fatalf("Overview: %+v, %v", o, err)
+	}
+	st, err := c.Stats.Rule(context.Background(), "r1", 0)
+	if err != nil || st.RuleID != "r1" || st.TotalRequests != 4 {
+		t.Fatalf("Rule: %+v, %v", st, err)
+	}
+}
+
+func TestLimitsPolicy(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/rate-limit-policy", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Error("expected no Authorization header without a token")
+		}
+		_, _ = w.Write([]byte(`{"limits":[{"name":"search","pattern":"/search","limit":10,"window_seconds":60,"identity":"ip","policy":"10;w=60"}]}`))
+	})
+	c := newTestClient(t, mux)
+
+	p, err := c.Limits.Policy(context.Background())
+	if err != nil {
+		t.Fatalf("Policy: %v", err)
+	}
+	if len(p.Limits) != 1 || p.Limits[0].Name != "search" || p.Limits[0].Policy != "10;w=60" {
+		t.Fatalf("unexpected policy %+v", p)
+	}
+}
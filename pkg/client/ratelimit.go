@@ -0,0 +1,71 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimit is the rate limit state the gateway reported on a proxied
+// response.
+type RateLimit struct {
+	Limit     int64
+	Remaining int64
+	// Reset is when the current window ends.
+	Reset time.Time
+	// RetryAfter is how long to wait before retrying a rejected request,
+	// or zero when the response did not say.
+	RetryAfter time.Duration
+
+	// Quota is the calendar quota state, when the matched rule has one.
+	Quota *Quota
+}
+
+// Quota is a rule's calendar quota state.
+type Quota struct {
+	Limit     int64
+	Remaining int64
+	Reset     time.Time
+}
+
+// ParseRateLimit reads the X-RateLimit-* headers, along with Retry-After
+// and the X-Quota-* headers, from a proxied response. ok is false when
+// the response carries no rate limit headers, such as when no rule
+// matched the request.
+func ParseRateLimit(h http.Header) (rl RateLimit, ok bool) {
+	var limitOK, remainingOK bool
+	rl.Limit, limitOK = headerInt(h, "X-RateLimit-Limit")
+	rl.Remaining, remainingOK = headerInt(h, "X-RateLimit-Remaining")
+	if reset, ok := headerInt(h, "X-RateLimit-Reset"); ok {
+		rl.Reset = time.Unix(reset, 0)
+	}
+	if secs, ok := headerInt(h, "Retry-After"); ok && secs > 0 {
+		rl.RetryAfter = time.Duration(secs) * time.Second
+	}
+
+	quotaLimit, quotaOK := headerInt(h, "X-Quota-Limit")
+	if quotaOK {
+		q := &Quota{Limit: quotaLimit}
+		q.Remaining, _ = headerInt(h, "X-Quota-Remaining")
+		if reset, ok := headerInt(h, "X-Quota-Reset"); ok {
+			q.Reset = time.Unix(reset, 0)
+		}
+		rl.Quota = q
+	}
+	return rl, (limitOK && remainingOK) || quotaOK
+}
+
+// Exhausted reports whether no requests remain in the current window or
+// quota period.
+func (rl RateLimit) Exhausted() bool {
+	return rl.Limit > 0 && rl.Remaining <= 0 || rl.Quota != nil && rl.Quota.Remaining <= 0
+}
+
+func headerInt(h http.Header, name string) (int64, bool) {
+	v := h.Get(name)
+	if v == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	return n, err == nil
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-RateLimit-Limit", "100")
+	h.Set("X-RateLimit-Remaining", "0")
+	h.Set("X-RateLimit-Reset", "1767268800")
+	h.Set("Retry-After", "12")
+
+	rl, ok := ParseRateLimit(h)
+	if !ok {
+		t.Fatal("expected rate limit headers to be found")
+	}
+	if rl.Limit != 100 || rl.Remaining != 0 || !rl.Reset.Equal(time.Unix(1767268800, 0)) || rl.RetryAfter != 12*time.Second {
+		t.Fatalf("unexpected rate limit %+v", rl)
+	}
+	if rl.Quota != nil {
+		t.Fatalf("expected no quota, got %+v", rl.Quota)
+	}
+	if !rl.Exhausted() {
+		t.Fatal("expected the limit to be exhausted")
+	}
+}
+
+func TestParseRateLimitQuota(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-RateLimit-Limit", "100")
+	h.Set("X-RateLimit-Remaining", "99")
+	h.Set("X-Quota-Limit", "1000")
+	h.Set("X-Quota-Remaining", "250")
+	h.Set("X-Quota-Reset", "1767268800")
+
+	rl, ok := ParseRateLimit(h)
+	if !ok || rl.Quota == nil {
+		t.Fatalf("expected rate limit with quota, got %+v %v", rl, ok)
+	}
+	if rl.Quota.Limit != 1000 || rl.Quota.Remaining != 250 || rl.Exhausted() {
+		t.Fatalf("unexpected quota %+v", rl.Quota)
+	}
+}
+
+func TestParseRateLimitAbsent(t *testing.T) {
+	if _, ok := ParseRateLimit(http.Header{"X-RateLimit-Limit": {"abc"}}); ok {
+		t.Fatal("expected malformed headers to be ignored")
+	}
+	if _, ok := ParseRateLimit(http.Header{}); ok {
+		t.Fatal("expected no rate limit without headers")
+	}
+}
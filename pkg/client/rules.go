@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Rule is a rate limit rule. See the gateway's README for the meaning of
+// each field. The nested options are kept as raw JSON so rules read and
+// written back by this client lose nothing.
+type Rule struct {
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	Pattern          string            `json:"pattern"`
+	Methods          []string          `json:"methods,omitempty"`
+	Priority         int               `json:"priority,omitempty"`
+	Limit            int64             `json:"limit,omitempty"`
+	WindowSeconds    int64             `json:"window_seconds,omitempty"`
+	IdentifyBy       string            `json:"identify_by,omitempty"`
+	HeaderName       string            `json:"header_name,omitempty"`
+	HeaderNames      []string          `json:"header_names,omitempty"`
+	CookieName       string            `json:"cookie_name,omitempty"`
+	JWTClaim         string            `json:"jwt_claim,omitempty"`
+	KeyTransforms    []string          `json:"key_transforms,omitempty"`
+	MaxConcurrency   int64             `json:"max_concurrency,omitempty"`
+	Quota            int64             `json:"quota,omitempty"`
+	QuotaPeriod      string            `json:"quota_period,omitempty"`
+	Policy           string            `json:"policy,omitempty"`
+	MaxResponseBytes int64             `json:"max_response_bytes,omitempty"`
+	CacheHeaders     map[string]string `json:"cache_headers,omitempty"`
+	Headers          json.RawMessage   `json:"headers,omitempty"`
+	Progressive      json.RawMessage   `json:"progressive,omitempty"`
+	Rejection        json.RawMessage   `json:"rejection,omitempty"`
+	RejectionMaxAge  int64             `json:"rejection_max_age,omitempty"`
+	Replay           json.RawMessage   `json:"replay,omitempty"`
+	Upstream         string            `json:"upstream,omitempty"`
+	Hedge            json.RawMessage   `json:"hedge,omitempty"`
+	WebSocket        json.RawMessage   `json:"websocket,omitempty"`
+	Honeypot         json.RawMessage   `json:"honeypot,omitempty"`
+	Action           json.RawMessage   `json:"action,omitempty"`
+	CaptureHeaders   []string          `json:"capture_headers,omitempty"`
+	Algorithm        string            `json:"algorithm,omitempty"`
+	Burst            int64             `json:"burst,omitempty"`
+	Namespace        string            `json:"namespace,omitempty"`
+	Shadow           bool              `json:"shadow,omitempty"`
+	AllowCountries   []string          `json:"allow_countries,omitempty"`
+	DenyCountries    []string          `json:"deny_countries,omitempty"`
+	Agents           []string          `json:"agents,omitempty"`
+	ExemptAgents     []string          `json:"exempt_agents,omitempty"`
+	ShedPriority     int               `json:"shed_priority,omitempty"`
+	Tags             []string          `json:"tags,omitempty"`
+	Schedule         json.RawMessage   `json:"schedule,omitempty"`
+	Debug            bool              `json:"debug,omitempty"`
+	Public           bool              `json:"public,omitempty"`
+	Enabled          bool              `json:"enabled"`
+	// Revision, CreatedAt and UpdatedAt are assigned by the gateway.
+	Revision  int64     `json:"revision"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RulesClient manages rules through /api/rules.
+type RulesClient struct {
+	c *Client
+}
+
+// List returns every rule in matching order.
+func (r *RulesClient) List(ctx context.Context) ([]Rule, error) {
+	var list []Rule
+	_, err := r.c.do(ctx, http.MethodGet, "/api/rules", nil, nil, nil, &list)
+	return list, err
+}
+
+// Get returns the rule with the given ID.
+func (r *RulesClient) Get(ctx context.Context, id string) (Rule, error) {
+	var rule Rule
+	_, err := r.c.do(ctx, http.MethodGet, "/api/rules/"+url.PathEscape(id), nil, nil, nil, &rule)
+	return rule, err
+}
+
+// Create stores a new rule and returns it with its ID and revision.
+func (r *RulesClient) Create(ctx context.Context, rule Rule) (Rule, error) {
+	var created Rule
+	_, err := r.c.do(ctx, http.MethodPost, "/api/rules", nil, nil, rule, &created)
+	return created, err
+}
+
+// Update replaces the rule with rule.ID. It fails with a 412 APIError if
+// the rule changed since rule.Revision was read; a zero Revision updates
+// whatever is stored.
+func (r *RulesClient) Update(ctx context.Context, rule Rule) (Rule, error) {
+	match := "*"
+	if rule.Revision != 0 {
+		match = `"` + strconv.FormatInt(rule.Revision, 10) + `"`
+	}
+	var updated Rule
+	_, err := r.c.do(ctx, http.MethodPut, "/api/rules/"+url.PathEscape(rule.ID), nil, http.Header{"If-Match": {match}}, rule, &updated)
+	return updated, err
+}
+
+// Delete removes the rule with the given ID.
+func (r *RulesClient) Delete(ctx context.Context, id string) error {
+	_, err := r.c.do(ctx, http.MethodDelete, "/api/rules/"+url.PathEscape(id), nil, nil, nil, nil)
+	return err
+}
+
+// Change is one rule created, updated or deleted by an apply.
+type Change struct {
+	Action   string `json:"action"`
+	RuleID   string `json:"rule_id"`
+	RuleName string `json:"rule_name,omitempty"`
+	Revision int64  `json:"revision,omitempty"`
+	Diff     []struct {
+		Field string `json:"field"`
+		Old   any    `json:"old,omitempty"`
+		New   any    `json:"new,omitempty"`
+	} `json:"diff,omitempty"`
+}
+
+// ApplyResult is the plan of an apply.
+type ApplyResult struct {
+	DryRun    bool     `json:"dry_run"`
+	Changes   []Change `json:"changes"`
+	Unchanged int      `json:"unchanged"`
+}
+
+// Apply makes the stored rules match desired, matching rules by name.
+// With dryRun it only returns the changes it would make.
+func (r *RulesClient) Apply(ctx context.Context, desired []Rule, dryRun bool) (ApplyResult, error) {
+	if desired == nil {
+		desired = []Rule{}
+	}
+	var query url.Values
+	if dryRun {
+		query = url.Values{"dry_run": {"true"}}
+	}
+	var res ApplyResult
+	_, err := r.c.do(ctx, http.MethodPut, "/api/rules:apply", query, nil, map[string][]Rule{"rules": desired}, &res)
+	return res, err
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Overview summarizes all traffic since a point in time.
+type Overview struct {
+	Since           time.Time `json:"since"`
+	TotalRequests   int64     `json:"total_requests"`
+	BlockedRequests int64     `json:"blocked_requests"`
+	UniqueClients   int64     `json:"unique_clients"`
+	BlockRate       float64   `json:"block_rate"`
+}
+
+// RuleStats summarizes the traffic a single rule matched.
+type RuleStats struct {
+	RuleID          string    `json:"rule_id"`
+	Since           time.Time `json:"since"`
+	TotalRequests   int64     `json:"total_requests"`
+	BlockedRequests int64     `json:"blocked_requests"`
+	UniqueClients   int64     `json:"unique_clients"`
+	BlockRate       float64   `json:"block_rate"`
+	ShadowBlocked   int64     `json:"shadow_blocked"`
+}
+
+// StatsClient reads traffic stats through /api/stats.
+type StatsClient struct {
+	c *Client
+}
+
+// Overview summarizes the last window of traffic. A zero window uses the
+// gateway's default of 24 hours.
+func (s *StatsClient) Overview(ctx context.Context, window time.Duration) (Overview, error) {
+	var o Overview
+	_, err := s.c.do(ctx, http.MethodGet, "/api/stats/overview", windowQuery(window), nil, nil, &o)
+	return o, err
+}
+
+// Rule summarizes the last window of traffic matched by a rule.
+func (s *StatsClient) Rule(ctx context.Context, ruleID string, window time.Duration) (RuleStats, error) {
+	var st RuleStats
+	_, err := s.c.do(ctx, http.MethodGet, "/api/stats/rules/"+url.PathEscape(ruleID), windowQuery(window), nil, nil, &st)
+	return st, err
+}
+
+func windowQuery(window time.Duration) url.Values {
+	if window <= 0 {
+		return nil
+	}
+	return url.Values{"window": {window.String()}}
+}
+
+// Policy is the gateway's published list of public limits.
+type Policy struct {
+	Limits []PolicyLimit `json:"limits"`
+}
+
+// PolicyLimit describes one public rule.
+type PolicyLimit struct {
+	Name          string   `json:"name"`
+	Pattern       string   `json:"pattern"`
+	Methods       []string `json:"methods,omitempty"`
+	Limit         int64    `json:"limit"`
+	WindowSeconds int64    `json:"window_seconds"`
+	// Identity is what requests are counted against: "ip" or
+	// "header:<name>".
+	Identity string `json:"identity"`
+	// Policy is the limit in RateLimit-Policy header syntax, e.g. "100;w=60".
+	Policy string `json:"policy"`
+}
+
+// LimitsClient reads the limits the gateway publishes to API consumers.
+type LimitsClient struct {
+	c *Client
+}
+
+// Policy returns the public rate limit policy served at
+// /.well-known/rate-limit-policy.
+func (l *LimitsClient) Policy(ctx context.Context) (Policy, error) {
+	var p Policy
+	_, err := l.c.do(ctx, http.MethodGet, "/.well-known/rate-limit-policy", nil, nil, nil, &p)
+	return p, err
+}
@@ -0,0 +1,257 @@
+// Package gatify embeds Gatify's rate limiting in a Go service as
+// http.Handler middleware, without running the standalone gateway. It
+// uses the gateway's rule matching, limiter algorithms and rejection
+// responses, and keeps counters in process memory or, to share limits
+// between instances and with gateways, in Redis.
+//
+//	lim, err := gatify.New(gatify.Config{Rules: []gatify.Rule{
+//		{Name: "login", Pattern: "/login", Methods: []string{"POST"}, Limit: 5, WindowSeconds: 60},
+//	}})
+//	http.ListenAndServe(":8080", lim.Middleware(mux))
+package gatify
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/Siruyy/gatify/internal/limiter"
+	"github.com/Siruyy/gatify/internal/proxy"
+	"github.com/Siruyy/gatify/internal/rules"
+	"github.com/Siruyy/gatify/internal/storage"
+)
+
+// Defaults for requests no rule matches, the same as the gateway's.
+const (
+	DefaultLimit  = 100
+	DefaultWindow = time.Minute
+)
+
+// Algorithm names for Config.Algorithm and Rule.Algorithm.
+const (
+	AlgorithmSlidingWindow = limiter.AlgorithmSlidingWindow
+	AlgorithmGCRA          = limiter.AlgorithmGCRA
+	AlgorithmLeakyBucket   = limiter.AlgorithmLeakyBucket
+	AlgorithmSlidingLog    = limiter.AlgorithmSlidingLog
+)
+
+// Rule limits requests matching a path pattern. Fields and JSON names are
+// those of the gateway's rules, so the same rules file can be loaded.
+// Patterns match segment by segment: ":name" captures one segment and a
+// trailing "*" matches any remainder.
+type Rule struct {
+	// Name identifies the rule and must be unique.
+	Name     string   `json:"name"`
+	Pattern  string   `json:"pattern"`
+	Methods  []string `json:"methods,omitempty"`
+	Priority int      `json:"priority"`
+	// Limit requests per WindowSeconds for each client.
+	Limit         int64 `json:"limit"`
+	WindowSeconds int64 `json:"window_seconds"`
+	// IdentifyBy is "ip", the default, or "header" to count clients by
+	// the first of HeaderNames present, falling back to the IP.
+	IdentifyBy    string   `json:"identify_by,omitempty"`
+	HeaderNames   []string `json:"header_names,omitempty"`
+	KeyTransforms []string `json:"key_transforms,omitempty"`
+	// MaxConcurrency caps each client's requests in flight. Zero means
+	// unlimited.
+	MaxConcurrency int64 `json:"max_concurrency,omitempty"`
+	// Algorithm overrides Config.Algorithm for this rule.
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+// Event describes a request the middleware handled.
+type Event struct {
+	Time     time.Time
+	ClientID string
+	Method   string
+	Path     string
+	// Route is the path with rule parameters templated away.
+	Route string
+	// Rule names the matched rule, empty when the default limit applied.
+	Rule      string
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	Status    int
+	Bytes     int64
+}
+
+// Config configures a Limiter.
+type Config struct {
+	Rules []Rule
+	// DefaultLimit and DefaultWindow apply to requests no rule matches.
+	// Zero values use DefaultLimit and DefaultWindow.
+	DefaultLimit  int64
+	DefaultWindow time.Duration
+	// Algorithm is the default algorithm, AlgorithmSlidingWindow if empty.
+	Algorithm string
+	// RedisAddr, when set, keeps counters in Redis instead of memory.
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	// TrustProxy takes client IPs from X-Forwarded-For / X-Real-IP.
+	TrustProxy bool
+	// TrustedProxies are the proxies in front of the application. The
+	// client IP is the rightmost X-Forwarded-For address outside them;
+	// when empty, only the connection's peer is trusted.
+	TrustedProxies []netip.Prefix
+	// OnEvent, when set, is called for every request. It runs on the
+	// request path and must not block.
+	OnEvent func(Event)
+	// CostEstimator, when set, prices each request, for example by the
+	// complexity of a GraphQL query: it uses up that many hits of its
+	// limit instead of one. rule names the matched rule, empty when the
+	// default limit applies. An estimator reading the body must leave an
+	// unread copy in r.Body.
+	CostEstimator func(r *http.Request, rule string) int64
+}
+
+// Limiter holds the rules and counters shared by every handler it wraps.
+type Limiter struct {
+	mu       sync.Mutex
+	cfg      Config
+	store    storage.Storage
+	limiters map[string]limiter.Limiter
+	rules    []rules.Rule
+	proxies  []*proxy.GatewayProxy
+}
+
+// New creates a Limiter enforcing cfg.
+func New(cfg Config) (*Limiter, error) {
+	if cfg.DefaultLimit == 0 {
+		cfg.DefaultLimit = DefaultLimit
+	}
+	if cfg.DefaultWindow == 0 {
+		cfg.DefaultWindow = DefaultWindow
+	}
+	if cfg.DefaultLimit < 0 || cfg.DefaultWindow < time.Millisecond {
+		return nil, errors.New("gatify: default limit and window must be positive")
+	}
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = AlgorithmSlidingWindow
+	}
+
+	l := &Limiter{cfg: cfg, limiters: map[string]limiter.Limiter{}}
+	if cfg.RedisAddr != "" {
+		l.store = storage.NewRedisStorage(storage.RedisOptions{Addr: cfg.RedisAddr, Password: cfg.RedisPassword, DB: cfg.RedisDB})
+	} else {
+		l.store = storage.NewMemoryStorage()
+	}
+	for _, name := range limiter.Algorithms() {
+		lim, err := limiter.New(name, l.store)
+		if err != nil {
+			return nil, err
+		}
+		l.limiters[name] = lim
+	}
+	if _, ok := l.limiters[cfg.Algorithm]; !ok {
+		return nil, fmt.Errorf("gatify: unknown algorithm %q", cfg.Algorithm)
+	}
+	if err := l.SetRules(cfg.Rules); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// SetRules atomically replaces the rules of every handler the Limiter
+// wraps. Counters of rules that keep their name carry over.
+func (l *Limiter) SetRules(list []Rule) error {
+	converted, err := convertRules(list)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rules = converted
+	for _, p := range l.proxies {
+		p.SetRules(converted)
+	}
+	return nil
+}
+
+// Middleware rate limits requests before they reach next. Rejected
+// requests get the gateway's 429 response with Retry-After; allowed ones
+// carry the X-RateLimit-* headers.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	opts := proxy.Options{
+		Next:             next,
+		Limiter:          l.limiters[l.cfg.Algorithm],
+		Limiters:         l.limiters,
+		DefaultLimit:     l.cfg.DefaultLimit,
+		DefaultWindow:    l.cfg.DefaultWindow,
+		TrustProxy:       l.cfg.TrustProxy,
+		TrustedProxies:   l.cfg.TrustedProxies,
+		ConcurrencyStore: l.store,
+	}
+	if fn := l.cfg.CostEstimator; fn != nil {
+		opts.CostEstimator = proxy.CostEstimatorFunc(func(r *http.Request, rule *rules.Rule) int64 {
+			name := ""
+			if rule != nil {
+				name = rule.Name
+			}
+			return fn(r, name)
+		})
+	}
+	if fn := l.cfg.OnEvent; fn != nil {
+		opts.Events = proxy.EventSinkFunc(func(e proxy.Event) {
+			fn(Event{
+				Time:      e.Timestamp,
+				ClientID:  e.ClientID,
+				Method:    e.Method,
+				Path:      e.Path,
+				Route:     e.Route,
+				Rule:      e.RuleID,
+				Allowed:   e.Allowed,
+				Limit:     e.Limit,
+				Remaining: e.Remaining,
+				Status:    e.Status,
+				Bytes:     e.Bytes,
+			})
+		})
+	}
+	p := proxy.New(opts)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p.SetRules(l.rules)
+	l.proxies = append(l.proxies, p)
+	return p
+}
+
+// convertRules validates list as gateway rules. Rule names double as IDs,
+// which scope the counters.
+func convertRules(list []Rule) ([]rules.Rule, error) {
+	out := make([]rules.Rule, 0, len(list))
+	seen := make(map[string]bool, len(list))
+	for _, r := range list {
+		rule := rules.Rule{
+			ID:             r.Name,
+			Name:           r.Name,
+			Pattern:        r.Pattern,
+			Methods:        append([]string(nil), r.Methods...),
+			Priority:       r.Priority,
+			Limit:          r.Limit,
+			WindowSeconds:  r.WindowSeconds,
+			IdentifyBy:     r.IdentifyBy,
+			HeaderNames:    append([]string(nil), r.HeaderNames...),
+			KeyTransforms:  append([]string(nil), r.KeyTransforms...),
+			MaxConcurrency: r.MaxConcurrency,
+			Algorithm:      r.Algorithm,
+			Enabled:        true,
+		}
+		rule.Normalize()
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("gatify: rule %q: %w", r.Name, err)
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("gatify: rule %q appears more than once", rule.Name)
+		}
+		seen[rule.Name] = true
+		out = append(out, rule)
+	}
+	return out, nil
+}
@@ -0,0 +1,112 @@
+package gatify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func serve(h http.Handler, method, path, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = ip + ":1234"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddlewareEnforcesRules(t *testing.T) {
+	var events []Event
+	lim, err := New(Config{
+		Rules:   []Rule{{Name: "login", Pattern: "/login", Methods: []string{"post"}, Limit: 2, WindowSeconds: 60}},
+		OnEvent: func(e Event) { events = append(events, e) },
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	h := lim.Middleware(ok)
+
+	for i := 0; i < 2; i++ {
+		if w := serve(h, http.MethodPost, "/login", "10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+	w := serve(h, http.MethodPost, "/login", "10.0.0.1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", w.Code, w.Header())
+	}
+	if w := serve(h, http.MethodPost, "/login", "10.0.0.2"); w.Code != http.StatusOK {
+		t.Fatalf("expected another client to be allowed, got %d", w.Code)
+	}
+	// Unmatched requests get the default limit.
+	if w := serve(h, http.MethodGet, "/login", "10.0.0.1"); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "100" {
+		t.Fatalf("expected the default limit, got %d %v", w.Code, w.Header())
+	}
+
+	if len(events) != 5 || events[2].Allowed || events[2].Rule != "login" || events[2].Status != http.StatusTooManyRequests {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestCostEstimator(t *testing.T) {
+	var priced []string
+	lim, err := New(Config{
+		Rules: []Rule{{Name: "graphql", Pattern: "/graphql", Limit: 10, WindowSeconds: 60}},
+		CostEstimator: func(r *http.Request, rule string) int64 {
+			priced = append(priced, rule)
+			return 5
+		},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	h := lim.Middleware(ok)
+
+	for i := 0; i < 2; i++ {
+		if w := serve(h, http.MethodPost, "/graphql", "10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+	if w := serve(h, http.MethodPost, "/graphql", "10.0.0.1"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the budget to be spent after two requests of cost 5, got %d", w.Code)
+	}
+	serve(h, http.MethodGet, "/other", "10.0.0.1")
+	if len(priced) != 4 || priced[0] != "graphql" || priced[3] != "" {
+		t.Fatalf("unexpected rules priced %q", priced)
+	}
+}
+
+func TestSetRules(t *testing.T) {
+	lim, err := New(Config{DefaultLimit: 1000})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	h := lim.Middleware(ok)
+	if w := serve(h, http.MethodGet, "/search", "10.0.0.1"); w.Header().Get("X-RateLimit-Limit") != "1000" {
+		t.Fatalf("expected the default limit, got %v", w.Header())
+	}
+
+	if err := lim.SetRules([]Rule{{Name: "search", Pattern: "/search", Limit: 1, WindowSeconds: 60, Algorithm: AlgorithmGCRA}}); err != nil {
+		t.Fatalf("SetRules: %v", err)
+	}
+	serve(h, http.MethodGet, "/search", "10.0.0.1")
+	if w := serve(h, http.MethodGet, "/search", "10.0.0.1"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the new rule to apply, got %d", w.Code)
+	}
+}
+
+func TestNewValidates(t *testing.T) {
+	for name, cfg := range map[string]Config{
+		"invalid rule":      {Rules: []Rule{{Name: "x", Limit: 1, WindowSeconds: 1}}},
+		"duplicate rule":    {Rules: []Rule{{Name: "x", Pattern: "/a", Limit: 1, WindowSeconds: 1}, {Name: "x", Pattern: "/b", Limit: 1, WindowSeconds: 1}}},
+		"unknown algorithm": {Algorithm: "token_bucket"},
+		"negative default":  {DefaultLimit: -1},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}